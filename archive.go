@@ -0,0 +1,369 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+
+	"github.com/luxfi/zapdb/options"
+	"github.com/luxfi/zapdb/pb"
+	"github.com/luxfi/zapdb/table"
+	"github.com/luxfi/zapdb/y"
+)
+
+// An archive packages the tables of a read-only DB into one file:
+//
+//	+---------+-----+---------+----------+-------+---------+
+//	| Table 1 | ... | Table N | Manifest | Index | Trailer |
+//	+---------+-----+---------+----------+-------+---------+
+//
+// The manifest is a pb.ManifestChangeSet with a CREATE change for every table. The index
+// holds the offset and size of every table, 8 bytes each, in the order of the changes. The
+// trailer holds the offset and size of the manifest, the number of tables, the CRC32C of
+// the manifest and index, and archiveMagic.
+const (
+	archiveMagic       = "ZAPARCH1"
+	archiveTrailerSize = 8 + 4 + 4 + 4 + len(archiveMagic)
+	archiveIndexEntry  = 16
+)
+
+// archiveTable is a table of an archive.
+type archiveTable struct {
+	change       *pb.ManifestChange
+	offset, size uint64
+}
+
+// archive is an opened archive.
+type archive struct {
+	r      io.ReaderAt
+	data   []byte      // The archive, if it is in memory.
+	mf     *z.MmapFile // The mapping of data, if any.
+	remote bool        // Read the blocks of the tables from r as they are needed.
+	tables []archiveTable
+}
+
+// WriteArchive writes the latest version of every key of the DB to w, as a single-file archive
+// that OpenArchive opens read-only. Deleted and expired keys are left out, and values are
+// stored in the tables, so the archive needs no value log. Tables are compressed with the
+// Compression of the DB and are not encrypted.
+//
+// WriteArchive can't be called on a managed DB.
+func (db *DB) WriteArchive(w io.Writer) error {
+	topt := buildTableOptions(db)
+	topt.DataKey = nil
+	level := uint32(db.opt.MaxLevels - 1)
+
+	var (
+		offset  uint64
+		changes pb.ManifestChangeSet
+		index   []byte
+	)
+	builder := table.NewTableBuilder(topt)
+	flush := func() error {
+		defer builder.Close()
+		if builder.Empty() {
+			return nil
+		}
+		data := builder.Finish()
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		changes.Changes = append(changes.Changes, &pb.ManifestChange{
+			Id:          uint64(len(changes.Changes) + 1),
+			Op:          pb.ManifestChange_CREATE,
+			Level:       level,
+			Compression: uint32(topt.Compression),
+		})
+		index = binary.BigEndian.AppendUint64(index, offset)
+		index = binary.BigEndian.AppendUint64(index, uint64(len(data)))
+		offset += uint64(len(data))
+		return nil
+	}
+
+	err := db.View(func(txn *Txn) error {
+		opt := DefaultIteratorOptions
+		opt.PrefetchValues = false
+		opt.columnFamilies = true
+		it := txn.NewIterator(opt)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if builder.ReachedCapacity() {
+				if err := flush(); err != nil {
+					return err
+				}
+				builder = table.NewTableBuilder(topt)
+			}
+			builder.Add(y.KeyWithTs(item.Key(), item.Version()), y.ValueStruct{
+				Meta:      item.meta &^ (bitValuePointer | bitTxn | bitFinTxn | bitTransformed),
+				UserMeta:  item.UserMeta(),
+				ExpiresAt: item.ExpiresAt(),
+				Value:     val,
+			}, 0)
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	} else {
+		builder.Close()
+	}
+	if err != nil {
+		return y.Wrap(err, "WriteArchive")
+	}
+
+	manifest, err := changes.Marshal()
+	if err != nil {
+		return y.Wrap(err, "WriteArchive")
+	}
+	trailer := make([]byte, 0, archiveTrailerSize)
+	trailer = binary.BigEndian.AppendUint64(trailer, offset)
+	trailer = binary.BigEndian.AppendUint32(trailer, uint32(len(manifest)))
+	trailer = binary.BigEndian.AppendUint32(trailer, uint32(len(changes.Changes)))
+	crc := crc32.Checksum(manifest, y.CastagnoliCrcTable)
+	crc = crc32.Update(crc, y.CastagnoliCrcTable, index)
+	trailer = binary.BigEndian.AppendUint32(trailer, crc)
+	trailer = append(trailer, archiveMagic...)
+	for _, b := range [][]byte{manifest, index, trailer} {
+		if _, err := w.Write(b); err != nil {
+			return y.Wrap(err, "WriteArchive")
+		}
+	}
+	return nil
+}
+
+// readArchive reads the manifest and index of the archive of the given size in r.
+func readArchive(r io.ReaderAt, size int64) (*archive, error) {
+	if size < int64(archiveTrailerSize) {
+		return nil, ErrInvalidArchive
+	}
+	trailer := make([]byte, archiveTrailerSize)
+	if err := readFullAt(r, trailer, size-int64(archiveTrailerSize)); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(trailer[archiveTrailerSize-len(archiveMagic):], []byte(archiveMagic)) {
+		return nil, ErrInvalidArchive
+	}
+	manifestOff := binary.BigEndian.Uint64(trailer)
+	manifestLen := uint64(binary.BigEndian.Uint32(trailer[8:]))
+	numTables := uint64(binary.BigEndian.Uint32(trailer[12:]))
+	crc := binary.BigEndian.Uint32(trailer[16:])
+
+	end := uint64(size) - uint64(archiveTrailerSize)
+	if manifestOff > end || manifestLen+numTables*archiveIndexEntry != end-manifestOff {
+		return nil, ErrInvalidArchive
+	}
+	meta := make([]byte, end-manifestOff)
+	if err := readFullAt(r, meta, int64(manifestOff)); err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(meta, y.CastagnoliCrcTable) != crc {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidArchive)
+	}
+	var changes pb.ManifestChangeSet
+	if err := changes.Unmarshal(meta[:manifestLen]); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if uint64(len(changes.Changes)) != numTables {
+		return nil, ErrInvalidArchive
+	}
+
+	a := &archive{r: r}
+	index := meta[manifestLen:]
+	for i, change := range changes.Changes {
+		t := archiveTable{
+			change: change,
+			offset: binary.BigEndian.Uint64(index[i*archiveIndexEntry:]),
+			size:   binary.BigEndian.Uint64(index[i*archiveIndexEntry+8:]),
+		}
+		if t.offset > manifestOff || t.size > manifestOff-t.offset {
+			return nil, ErrInvalidArchive
+		}
+		a.tables = append(a.tables, t)
+	}
+	return a, nil
+}
+
+// readFullAt fills buf from r at off.
+func readFullAt(r io.ReaderAt, buf []byte, off int64) error {
+	n, err := r.ReadAt(buf, off)
+	if n == len(buf) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// tableData returns the encoding of t. It is a slice of data if the archive is in memory, and
+// is read from r otherwise.
+func (a *archive) tableData(t archiveTable) ([]byte, error) {
+	if a.data != nil {
+		return a.data[t.offset : t.offset+t.size], nil
+	}
+	buf := make([]byte, t.size)
+	if err := readFullAt(a.r, buf, int64(t.offset)); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (a *archive) close() error {
+	if a.mf == nil {
+		return nil
+	}
+	return a.mf.Close(-1)
+}
+
+// OpenArchive opens the archive written by DB.WriteArchive at path. The DB is read-only,
+// keeps nothing on disk besides the archive, and serves its tables from a mapping of it.
+// Dir, ValueDir, InMemory and ReadOnly of opt are ignored.
+func OpenArchive(path string, opt Options) (*DB, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, y.Wrapf(err, "OpenArchive")
+	}
+	if fi, err := fd.Stat(); err != nil || fi.Size() < int64(archiveTrailerSize) {
+		_ = fd.Close()
+		if err == nil {
+			err = ErrInvalidArchive
+		}
+		return nil, fmt.Errorf("OpenArchive %s: %w", path, err)
+	}
+	mf, err := z.OpenMmapFileUsing(fd, 0, false)
+	if err != nil {
+		_ = fd.Close()
+		return nil, y.Wrapf(err, "OpenArchive")
+	}
+	db, err := openArchiveData(mf.Data, opt, mf)
+	if err != nil {
+		_ = mf.Close(-1)
+		return nil, fmt.Errorf("OpenArchive %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// OpenArchiveBytes opens the archive written by DB.WriteArchive in data, such as a slice
+// embedded with //go:embed. The tables are served from data, which must not be modified while
+// the DB is open. See OpenArchive.
+func OpenArchiveBytes(data []byte, opt Options) (*DB, error) {
+	db, err := openArchiveData(data, opt, nil)
+	if err != nil {
+		return nil, fmt.Errorf("OpenArchiveBytes: %w", err)
+	}
+	return db, nil
+}
+
+// OpenArchiveReaderAt opens the archive written by DB.WriteArchive of the given size in r,
+// such as a file or a reader of HTTP range requests. The tables are read once, into memory,
+// and r isn't used after OpenArchiveReaderAt returns. See OpenArchive.
+func OpenArchiveReaderAt(r io.ReaderAt, size int64, opt Options) (*DB, error) {
+	a, err := readArchive(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("OpenArchiveReaderAt: %w", err)
+	}
+	db, err := openArchive(a, opt)
+	if err != nil {
+		return nil, fmt.Errorf("OpenArchiveReaderAt: %w", err)
+	}
+	return db, nil
+}
+
+// OpenRemoteArchive opens the archive written by DB.WriteArchive of the given size in r, like
+// OpenArchiveReaderAt, but only reads the manifest and the indexes of the tables at once. The
+// blocks of the tables are read from r as they are needed, and kept in the block cache, so
+// that an archive in object storage can be served with little local data. r must stay usable
+// until the DB is closed. See objstore.HTTPReaderAt for reading an archive over HTTP, and
+// objstore.CachedReaderAt for caching the blocks read in a local file.
+func OpenRemoteArchive(r io.ReaderAt, size int64, opt Options) (*DB, error) {
+	a, err := readArchive(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("OpenRemoteArchive: %w", err)
+	}
+	a.remote = true
+	db, err := openArchive(a, opt)
+	if err != nil {
+		return nil, fmt.Errorf("OpenRemoteArchive: %w", err)
+	}
+	return db, nil
+}
+
+func openArchiveData(data []byte, opt Options, mf *z.MmapFile) (*DB, error) {
+	a, err := readArchive(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	a.data, a.mf = data, mf
+	return openArchive(a, opt)
+}
+
+func openArchive(a *archive, opt Options) (*DB, error) {
+	opt.Dir, opt.ValueDir = "", ""
+	opt.InMemory = true
+	opt.ReadOnly = true
+	opt.archive = a
+	return Open(opt)
+}
+
+// openArchive adds the tables of a to the levels.
+func (s *levelsController) openArchive(a *archive) error {
+	db := s.kv
+	tables := make([][]*table.Table, db.opt.MaxLevels)
+	var (
+		maxFileID uint64
+		err       error
+	)
+	for _, at := range a.tables {
+		c := at.change
+		if int(c.Level) >= db.opt.MaxLevels {
+			closeAllTables(tables)
+			return fmt.Errorf("archive table %d is on level %d, MaxLevels is %d",
+				c.Id, c.Level, db.opt.MaxLevels)
+		}
+		topt := buildTableOptions(db)
+		topt.Compression = options.CompressionType(c.Compression)
+		topt.DataKey = nil
+		var t *table.Table
+		if a.remote {
+			r := io.NewSectionReader(a.r, int64(at.offset), int64(at.size))
+			t, err = table.OpenTableReaderAt(r, int64(at.size), c.Id, &topt)
+		} else {
+			var data []byte
+			if data, err = a.tableData(at); err != nil {
+				closeAllTables(tables)
+				return y.Wrapf(err, "reading archive table %d", c.Id)
+			}
+			t, err = table.OpenInMemoryTable(data, c.Id, &topt)
+		}
+		if err == nil && (topt.ChkMode == options.OnTableRead ||
+			topt.ChkMode == options.OnTableAndBlockRead) {
+			err = t.VerifyChecksum()
+		}
+		if err != nil {
+			closeAllTables(tables)
+			return y.Wrapf(err, "opening archive table %d", c.Id)
+		}
+		tables[c.Level] = append(tables[c.Level], t)
+		maxFileID = max(maxFileID, c.Id)
+	}
+	s.nextFileID.Store(maxFileID + 1)
+	for i, tbls := range tables {
+		s.levels[i].initTables(tbls)
+	}
+	return nil
+}
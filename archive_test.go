@@ -0,0 +1,175 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/objstore"
+)
+
+const archiveTestKeys = 2000
+
+var archiveTestBigValue = bytes.Repeat([]byte("v"), 2<<10)
+
+// writeTestArchive writes the archive checked by checkTestArchive to path.
+func writeTestArchive(t *testing.T, dir, path string) {
+	opt := getTestOptions(filepath.Join(dir, "db"))
+	opt.BaseTableSize = 1 << 15
+	opt.ValueThreshold = 1 << 10
+	db, err := Open(opt)
+	require.NoError(t, err)
+	for i := 0; i < archiveTestKeys; i += 100 {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			for j := i; j < i+100; j++ {
+				val := []byte(fmt.Sprintf("val%04d", j))
+				if j%10 == 0 {
+					// Stored in the value log.
+					val = archiveTestBigValue
+				}
+				if err := txn.SetEntry(NewEntry([]byte(fmt.Sprintf("key%04d", j)), val).
+					WithMeta(byte(j))); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+	}
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.Delete([]byte("key0001"))
+	}))
+
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, db.WriteArchive(f))
+	require.NoError(t, f.Close())
+	require.NoError(t, db.Close())
+}
+
+func checkTestArchive(t *testing.T, db *DB) {
+	require.Greater(t, len(db.Tables()), 1)
+	require.NoError(t, db.View(func(txn *Txn) error {
+		_, err := txn.Get([]byte("key0001"))
+		require.ErrorIs(t, err, ErrKeyNotFound)
+
+		it := txn.NewIterator(DefaultIteratorOptions)
+		defer it.Close()
+		var count int
+		for it.Rewind(); it.Valid(); it.Next() {
+			count++
+		}
+		require.Equal(t, archiveTestKeys-1, count)
+
+		for _, i := range []int{0, 10, 1234, archiveTestKeys - 1} {
+			item, err := txn.Get([]byte(fmt.Sprintf("key%04d", i)))
+			require.NoError(t, err)
+			require.Equal(t, byte(i), item.UserMeta())
+			want := []byte(fmt.Sprintf("val%04d", i))
+			if i%10 == 0 {
+				want = archiveTestBigValue
+			}
+			require.Equal(t, want, getItemValue(t, item))
+		}
+		return nil
+	}))
+
+	err := db.Update(func(txn *Txn) error {
+		return txn.Set([]byte("key"), []byte("val"))
+	})
+	require.ErrorIs(t, err, ErrReadOnlyTxn)
+	require.NoError(t, db.Close())
+}
+
+func TestArchive(t *testing.T) {
+	dir, err := os.MkdirTemp("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+	path := filepath.Join(dir, "data.zap")
+	writeTestArchive(t, dir, path)
+	opt := DefaultOptions("").WithLoggingLevel(WARNING)
+
+	t.Run("file", func(t *testing.T) {
+		db, err := OpenArchive(path, opt)
+		require.NoError(t, err)
+		checkTestArchive(t, db)
+	})
+	t.Run("bytes", func(t *testing.T) {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		db, err := OpenArchiveBytes(data, opt)
+		require.NoError(t, err)
+		checkTestArchive(t, db)
+	})
+	t.Run("ReaderAt", func(t *testing.T) {
+		f, err := os.Open(path)
+		require.NoError(t, err)
+		fi, err := f.Stat()
+		require.NoError(t, err)
+		db, err := OpenArchiveReaderAt(f, fi.Size(), opt)
+		require.NoError(t, err)
+		// The tables were read into memory.
+		require.NoError(t, f.Close())
+		checkTestArchive(t, db)
+
+		_, err = OpenArchiveReaderAt(f, fi.Size(), opt)
+		require.ErrorIs(t, err, os.ErrClosed)
+	})
+	t.Run("remote", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeFile(w, r, path)
+		}))
+		defer srv.Close()
+		r, err := objstore.NewHTTPReaderAt(srv.Client(), srv.URL)
+		require.NoError(t, err)
+		c, err := objstore.NewCachedReaderAt(r, r.Size(), filepath.Join(dir, "cache"), 4096)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, c.Close()) }()
+
+		db, err := OpenRemoteArchive(c, c.Size(), opt)
+		require.NoError(t, err)
+		checkTestArchive(t, db)
+		require.LessOrEqual(t, c.Fetched(), r.Size())
+	})
+}
+
+func TestArchiveInvalid(t *testing.T) {
+	dir, err := os.MkdirTemp("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Set([]byte("key"), []byte("val"))
+		}))
+		var buf bytes.Buffer
+		require.NoError(t, db.WriteArchive(&buf))
+		data := buf.Bytes()
+		flipped := bytes.Clone(data)
+		flipped[len(data)-archiveTrailerSize-1]++
+
+		for name, corrupt := range map[string][]byte{
+			"truncated": data[:len(data)-1],
+			"checksum":  flipped,
+			"empty":     {},
+		} {
+			path := filepath.Join(dir, name)
+			require.NoError(t, os.WriteFile(path, corrupt, 0o644))
+			_, err := OpenArchive(path, DefaultOptions(""))
+			require.True(t, errors.Is(err, ErrInvalidArchive), "%s: %v", name, err)
+			_, err = OpenArchiveBytes(corrupt, DefaultOptions(""))
+			require.True(t, errors.Is(err, ErrInvalidArchive), "%s: %v", name, err)
+		}
+	})
+}
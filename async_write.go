@@ -0,0 +1,44 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+// ApplyAsync writes entries in one transaction, without waiting for the write: cb is called with
+// its result from another goroutine, once the entries are written, and synced if
+// Options.SyncWrites is set. Callers can pipeline their writes, acknowledging them out of band
+// once they're durable. ApplyAsync blocks while Options.MaxAsyncWrites writes are in flight. It
+// returns an error, and doesn't call cb, if the entries can't be written, like ErrTxnTooBig.
+//
+//	err := db.ApplyAsync([]*badger.Entry{badger.NewEntry(key, val)}, func(err error) {
+//		ack(key, err)
+//	})
+//
+// ApplyAsync is not supported on ManagedDB. Calling this would result in a panic.
+func (db *DB) ApplyAsync(entries []*Entry, cb func(error)) error {
+	if db.opt.managedTxns {
+		panic("Cannot use ApplyAsync with managedDB=true.")
+	}
+	if cb == nil {
+		panic("Nil callback provided to ApplyAsync")
+	}
+	if db.IsClosed() {
+		return ErrDBClosed
+	}
+
+	db.asyncWrites <- struct{}{}
+	txn := db.newTransaction(true, false)
+	for _, e := range entries {
+		if err := txn.SetEntry(e); err != nil {
+			txn.Discard()
+			<-db.asyncWrites
+			return err
+		}
+	}
+	txn.CommitWith(func(err error) {
+		<-db.asyncWrites
+		cb(err)
+	})
+	return nil
+}
@@ -0,0 +1,59 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyAsync(t *testing.T) {
+	opt := getTestOptions("").WithMaxAsyncWrites(2)
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		key := func(i int) []byte { return fmt.Appendf(nil, "key%03d", i) }
+		var wg sync.WaitGroup
+		var failed, maxInFlight atomic.Int64
+		for i := range 100 {
+			wg.Add(1)
+			err := db.ApplyAsync([]*Entry{NewEntry(key(i), key(i))}, func(err error) {
+				defer wg.Done()
+				if err != nil {
+					failed.Add(1)
+				}
+				n := int64(db.WritePipelineStats().AsyncWrites)
+				for m := maxInFlight.Load(); n > m && !maxInFlight.CompareAndSwap(m, n); {
+					m = maxInFlight.Load()
+				}
+			})
+			require.NoError(t, err)
+		}
+		wg.Wait()
+		require.Zero(t, failed.Load())
+		require.LessOrEqual(t, maxInFlight.Load(), int64(2))
+
+		require.NoError(t, db.View(func(txn *Txn) error {
+			for i := range 100 {
+				item, err := txn.Get(key(i))
+				require.NoError(t, err)
+				require.Equal(t, key(i), getItemValue(t, item))
+			}
+			return nil
+		}))
+
+		// A write which can't be done fails right away, without the callback.
+		big := make([]*Entry, 0, db.opt.maxBatchCount)
+		for i := range int(db.opt.maxBatchCount) {
+			big = append(big, NewEntry(fmt.Appendf(nil, "big%d", i), nil))
+		}
+		err := db.ApplyAsync(big, func(error) { t.Fatal("callback of a failed write") })
+		require.ErrorIs(t, err, ErrTxnTooBig)
+		require.Zero(t, db.WritePipelineStats().AsyncWrites)
+	})
+}
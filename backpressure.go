@@ -0,0 +1,160 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateLimiter budgets the bytes written per second. See Options.WriteRateLimiter and
+// Options.CompactionRateLimiter.
+type RateLimiter interface {
+	// Wait blocks until n more bytes can be written within the budget.
+	Wait(n int64)
+	// Delay returns how long a write would wait now.
+	Delay() time.Duration
+}
+
+// NewRateLimiter returns a RateLimiter spacing out writes so that they average bytesPerSec. It
+// can be shared by DBs and by the writes and compactions of a DB, to give them a single budget.
+func NewRateLimiter(bytesPerSec int64) RateLimiter {
+	return &rateLimiter{bytesPerSec: float64(bytesPerSec)}
+}
+
+// rateLimiter spaces out writes so that they average bytesPerSec. A nil rateLimiter doesn't wait.
+type rateLimiter struct {
+	bytesPerSec float64
+	mu          sync.Mutex
+	next        time.Time
+}
+
+func (r *rateLimiter) Wait(n int64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	delay := r.next.Sub(now)
+	r.next = r.next.Add(time.Duration(float64(n) / r.bytesPerSec * float64(time.Second)))
+	r.mu.Unlock()
+	time.Sleep(delay)
+}
+
+func (r *rateLimiter) Delay() time.Duration {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return max(time.Until(r.next), 0)
+}
+
+// The causes of stalls of the writes, as reported by DB.Backpressure.
+const (
+	// StallLevel0 is a stall because level 0 has NumLevelZeroTablesStall tables.
+	StallLevel0 = "level0"
+	// StallMemtables is a stall because the NumMemtables memtables are all full.
+	StallMemtables = "memtables"
+)
+
+// stallTracker tracks the stalls of the writes with a cause.
+type stallTracker struct {
+	count atomic.Int64
+	total atomic.Int64 // in nanoseconds.
+	since atomic.Int64 // the start of the current stall in nanoseconds since the epoch, or 0.
+}
+
+// start marks the start of a stall, and returns it.
+func (s *stallTracker) start() time.Time {
+	now := time.Now()
+	s.since.Store(now.UnixNano())
+	return now
+}
+
+// done marks the end of the stall started at start, and returns its duration.
+func (s *stallTracker) done(start time.Time) time.Duration {
+	d := time.Since(start)
+	s.since.Store(0)
+	s.count.Add(1)
+	s.total.Add(int64(d))
+	return d
+}
+
+// current returns how long the current stall has lasted, and how long it should still last from
+// the mean duration of the past stalls. ok is false if there is no current stall.
+func (s *stallTracker) current() (elapsed, remaining time.Duration, ok bool) {
+	since := s.since.Load()
+	if since == 0 {
+		return 0, 0, false
+	}
+	elapsed = time.Since(time.Unix(0, since))
+	if n := s.count.Load(); n > 0 {
+		remaining = max(time.Duration(s.total.Load()/n)-elapsed, 0)
+	}
+	return elapsed, remaining, true
+}
+
+// Backpressure is the state of the stalls of the writes of a DB, as returned by DB.Backpressure.
+type Backpressure struct {
+	// Stalled tells if writes are stalled, because of Cause, StallLevel0 or StallMemtables.
+	Stalled bool
+	Cause   string
+	// StalledFor is how long the current stall has lasted.
+	StalledFor time.Duration
+	// Pressure is how close writes are to stalling, from 0 to 1: the higher of the fractions of
+	// NumLevelZeroTablesStall tables in level 0, and of NumMemtables memtables waiting to be
+	// flushed. It's 1 while stalled.
+	Pressure float64
+	// EstimatedDelay is how long a write would wait now: the rest of the current stall, from
+	// the mean duration of the past stalls of its cause, and the wait of WriteRateLimiter.
+	EstimatedDelay time.Duration
+	// PendingWrites is the number of write requests queued to be written.
+	PendingWrites int
+	// Level0Tables and ImmutableMemtables are the numbers of tables in level 0, and of memtables
+	// waiting to be flushed.
+	Level0Tables       int
+	ImmutableMemtables int
+}
+
+// Backpressure returns the state of the stalls of the writes, so that services can shed load as
+// Pressure or EstimatedDelay rise, before writes stall.
+func (db *DB) Backpressure() Backpressure {
+	db.lock.RLock()
+	imm := len(db.imm)
+	db.lock.RUnlock()
+	bp := Backpressure{
+		PendingWrites:      len(db.writeCh),
+		Level0Tables:       db.lc.levels[0].numTables(),
+		ImmutableMemtables: imm,
+	}
+	bp.Pressure = max(float64(bp.Level0Tables)/float64(db.opt.NumLevelZeroTablesStall),
+		float64(imm)/float64(db.opt.NumMemtables))
+	for _, s := range []struct {
+		cause   string
+		tracker *stallTracker
+	}{
+		{StallLevel0, &db.lc.l0stall},
+		{StallMemtables, &db.memtableStall},
+	} {
+		if elapsed, remaining, ok := s.tracker.current(); ok {
+			bp.Stalled, bp.Cause, bp.StalledFor = true, s.cause, elapsed
+			bp.EstimatedDelay = remaining
+			break
+		}
+	}
+	if bp.Stalled || bp.Pressure > 1 {
+		bp.Pressure = 1
+	}
+	if l := db.opt.WriteRateLimiter; l != nil {
+		bp.EstimatedDelay += l.Delay()
+	}
+	return bp
+}
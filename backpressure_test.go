@@ -0,0 +1,47 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackpressure(t *testing.T) {
+	limiter := NewRateLimiter(100 << 10)
+	opt := getTestOptions("").WithWriteRateLimiter(limiter)
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		bp := db.Backpressure()
+		require.False(t, bp.Stalled)
+		require.Less(t, bp.Pressure, 1.0)
+		require.Zero(t, bp.EstimatedDelay)
+
+		// The writes wait for the budget of the limiter, which delays the next one.
+		start := time.Now()
+		for i := range 3 {
+			require.NoError(t, db.Update(func(txn *Txn) error {
+				return txn.Set(fmt.Appendf(nil, "key%d", i), bytes.Repeat([]byte("v"), 50<<10))
+			}))
+		}
+		require.GreaterOrEqual(t, time.Since(start), time.Second)
+		require.Greater(t, db.Backpressure().EstimatedDelay, time.Duration(0))
+
+		// A stall is reported with its cause, and the rest of it estimated from the past ones.
+		db.lc.l0stall.done(db.lc.l0stall.start().Add(-time.Hour))
+		db.lc.l0stall.start()
+		bp = db.Backpressure()
+		require.True(t, bp.Stalled)
+		require.Equal(t, StallLevel0, bp.Cause)
+		require.Equal(t, 1.0, bp.Pressure)
+		require.Greater(t, bp.EstimatedDelay, 59*time.Minute)
+		db.lc.l0stall.done(time.Now())
+		require.False(t, db.Backpressure().Stalled)
+	})
+}
@@ -50,6 +50,20 @@ func (db *DB) Backup(w io.Writer, since uint64) (uint64, error) {
 //
 // This can be used to backup the data in a database at a given point in time.
 func (stream *Stream) Backup(w io.Writer, since uint64) (uint64, error) {
+	var maxVersion uint64
+	stream.setupBackup(w, since, &maxVersion, nil)
+	if err := stream.Orchestrate(context.Background()); err != nil {
+		return 0, err
+	}
+	return maxVersion, nil
+}
+
+// setupBackup sets KeyToList and Send of stream to write the versions since since to w, keeping
+// the highest of them in maxVersion. If set, write writes the lists instead.
+func (stream *Stream) setupBackup(w io.Writer, since uint64, maxVersion *uint64,
+	write func(*pb.KVList) error) {
+	// An incremental backup has the range tombstones to delete the versions backed up before.
+	stream.rangeTombstones = since > 0
 	stream.KeyToList = func(key []byte, itr *Iterator) (*pb.KVList, error) {
 		list := &pb.KVList{}
 		a := itr.Alloc
@@ -79,6 +93,12 @@ func (stream *Stream) Backup(w io.Writer, since uint64) (uint64, error) {
 
 			// clear txn bits
 			meta := item.meta &^ (bitTxn | bitFinTxn)
+			if meta&bitMergeEntry > 0 && stream.db.mergeOps.get(item.key) != nil {
+				// The value of a merge delta was read merged.
+				meta &^= bitMergeEntry
+			}
+			// The value was read decoded.
+			meta &^= bitTransformed
 			kv := y.NewKV(a)
 			*kv = pb.KV{
 				Key:       a.Copy(item.Key()),
@@ -108,7 +128,6 @@ func (stream *Stream) Backup(w io.Writer, since uint64) (uint64, error) {
 		return list, nil
 	}
 
-	var maxVersion uint64
 	stream.Send = func(buf *z.Buffer) error {
 		list, err := BufferToKVList(buf)
 		if err != nil {
@@ -116,8 +135,8 @@ func (stream *Stream) Backup(w io.Writer, since uint64) (uint64, error) {
 		}
 		out := list.Kv[:0]
 		for _, kv := range list.Kv {
-			if maxVersion < kv.Version {
-				maxVersion = kv.Version
+			if *maxVersion < kv.Version {
+				*maxVersion = kv.Version
 			}
 			if !kv.StreamDone {
 				// Don't pick stream done changes.
@@ -125,23 +144,22 @@ func (stream *Stream) Backup(w io.Writer, since uint64) (uint64, error) {
 			}
 		}
 		list.Kv = out
+		if write != nil {
+			return write(list)
+		}
 		return writeTo(list, w)
 	}
-
-	if err := stream.Orchestrate(context.Background()); err != nil {
-		return 0, err
-	}
-	return maxVersion, nil
 }
 
 func writeTo(list *pb.KVList, w io.Writer) error {
 	if err := binary.Write(w, binary.LittleEndian, uint64(pb.Size(list))); err != nil {
 		return err
 	}
-	buf, err := pb.Marshal(list)
+	buf, err := pb.MarshalTo(nil, list)
 	if err != nil {
 		return err
 	}
+	defer pb.ReleaseBuffer(buf)
 	_, err = w.Write(buf)
 	return err
 }
@@ -223,7 +241,8 @@ func (l *KVLoader) Finish() error {
 
 // Load reads a ZAP binary-encoded list of all entries from a reader and writes
 // them to the database. This can be used to restore the database from a backup
-// made by calling DB.Backup(). If more complex logic is needed to restore a badger
+// made by calling DB.Backup(), or by upstream Badger and the grpc build, which
+// encode the lists with protobuf. If more complex logic is needed to restore a badger
 // backup, the KVLoader interface should be used instead.
 //
 // DB.Load() should be called on a database that is not running any other
@@ -251,7 +270,7 @@ func (db *DB) Load(r io.Reader, maxPendingWrites int) error {
 		}
 
 		list := &pb.KVList{}
-		if err := pb.Unmarshal(unmarshalBuf[:sz], list); err != nil {
+		if err := unmarshalBackupList(unmarshalBuf[:sz], list); err != nil {
 			return err
 		}
 
@@ -274,3 +293,17 @@ func (db *DB) Load(r io.Reader, maxPendingWrites int) error {
 	db.orc.txnMark.Done(db.orc.nextTxnTs - 1)
 	return nil
 }
+
+// unmarshalBackupList decodes a list of a backup. Lists written by Backup start
+// with the pb version header. Anything else is tried as protobuf before the
+// original header-less layout, which would read the first bytes of a protobuf
+// list as an arbitrary, possibly huge, count.
+func unmarshalBackupList(data []byte, list *pb.KVList) error {
+	if v, err := pb.Version(data); err != nil || v > 0 {
+		return pb.Unmarshal(data, list)
+	}
+	if pb.UnmarshalLegacyProto(data, list) == nil {
+		return nil
+	}
+	return pb.Unmarshal(data, list)
+}
@@ -0,0 +1,354 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"path"
+
+	"github.com/luxfi/zapdb/objstore"
+	"github.com/luxfi/zapdb/pb"
+	"github.com/luxfi/zapdb/y"
+)
+
+// DefaultBackupChunkSize is the size of the chunks of a backup to a BackupSink if none is given.
+const DefaultBackupChunkSize = 64 << 20
+
+// BackupSink stores a backup as a sequence of chunks, along with the state needed to resume it.
+// See DB.BackupToSink.
+type BackupSink interface {
+	// PutChunk stores chunk n of the backup, replacing any chunk n stored before.
+	PutChunk(ctx context.Context, n int, data []byte) error
+	// Chunk returns a reader over chunk n of the backup. The caller must close it.
+	Chunk(ctx context.Context, n int) (io.ReadCloser, error)
+	// PutState stores state, once the chunks it lists are stored.
+	PutState(ctx context.Context, state *BackupState) error
+	// State returns the state stored last, or nil if there is none.
+	State(ctx context.Context) (*BackupState, error)
+}
+
+// BackupChunk describes a chunk of a backup.
+type BackupChunk struct {
+	Size     int64  `json:"size"`
+	Checksum uint32 `json:"crc32c"`
+}
+
+// BackupState is the progress of a backup to a BackupSink.
+type BackupState struct {
+	// Since is the version the backup starts from, as passed to DB.Backup.
+	Since uint64 `json:"since"`
+	// ReadTs is the read timestamp of the first attempt. The chunks of later attempts are at
+	// later timestamps: the versions written since are backed up again before the backup is
+	// done, so that it is consistent.
+	ReadTs uint64 `json:"read_ts"`
+	// NextKey is the first key left to back up, some versions of which may be backed up already.
+	// Scanned is set once every key is backed up.
+	NextKey []byte        `json:"next_key,omitempty"`
+	Scanned bool          `json:"scanned"`
+	Chunks  []BackupChunk `json:"chunks"`
+	// MaxVersion is the highest version backed up so far.
+	MaxVersion uint64 `json:"max_version"`
+	Done       bool   `json:"done"`
+}
+
+// ObjectBackupOptions are the options of a backup to a BackupSink.
+type ObjectBackupOptions struct {
+	// Since is the version to back up from, like the argument of DB.Backup. Zero backs up
+	// everything.
+	Since uint64
+	// ChunkSize is the size of the chunks. Zero means DefaultBackupChunkSize.
+	ChunkSize int64
+}
+
+// BackupToObjectStore backs up the DB to objects under prefix in store, like
+// BackupToSink(ctx, NewObjectStoreBackupSink(store, prefix), opt).
+func (db *DB) BackupToObjectStore(ctx context.Context, store objstore.Store, prefix string,
+	opt ObjectBackupOptions) (uint64, error) {
+	return db.BackupToSink(ctx, NewObjectStoreBackupSink(store, prefix), opt)
+}
+
+// BackupToSink writes a backup of the DB, like DB.Backup, to sink in chunks of opt.ChunkSize
+// bytes, each with its checksum. It returns the highest version backed up.
+//
+// The state of the backup is stored after every chunk. If sink has the state of an unfinished
+// backup, it is resumed after the last chunk stored: keys are backed up in order, by a single
+// goroutine, to allow it. If the backup is already done, BackupToSink returns right away.
+//
+// The backup is read from the DB as of a single timestamp for every attempt, and the chunks of
+// the earlier attempts of a resumed backup are followed by the versions written meanwhile. The
+// concatenation of the chunks can be loaded with DB.Load, or with DB.LoadFromSink. Like
+// DB.NewStream, BackupToSink can't be used in managed mode.
+func (db *DB) BackupToSink(ctx context.Context, sink BackupSink, opt ObjectBackupOptions) (
+	uint64, error) {
+	if opt.ChunkSize <= 0 {
+		opt.ChunkSize = DefaultBackupChunkSize
+	}
+	state, err := sink.State(ctx)
+	if err != nil {
+		return 0, y.Wrapf(err, "while reading backup state")
+	}
+	resumed := state != nil
+	switch {
+	case state == nil:
+		state = &BackupState{Since: opt.Since}
+	case state.Since != opt.Since:
+		return 0, fmt.Errorf("Backup in sink starts from version %d, not %d", state.Since,
+			opt.Since)
+	case state.Done:
+		return state.MaxVersion, nil
+	}
+
+	// The read keeps the versions at readTs from being discarded by compactions meanwhile.
+	txn := db.NewTransaction(false)
+	defer txn.Discard()
+	if state.ReadTs == 0 {
+		state.ReadTs = txn.readTs
+	}
+
+	w := &chunkWriter{ctx: ctx, sink: sink, state: state, size: opt.ChunkSize}
+	var maxVersion uint64
+	newStream := func(since uint64, choose func(key []byte) bool) *Stream {
+		stream := db.NewStream()
+		stream.LogPrefix = "DB.BackupToSink"
+		stream.readTs = txn.readTs
+		stream.NumGo = 1
+		stream.SinceTs = since
+		stream.ChooseKey = func(item *Item) bool { return choose(item.Key()) }
+		return stream
+	}
+
+	// Back up the keys left, as of now.
+	start, scanned := state.NextKey, state.Scanned
+	if !scanned {
+		stream := newStream(state.Since, func(key []byte) bool {
+			return bytes.Compare(key, start) >= 0
+		})
+		stream.setupBackup(nil, state.Since, &maxVersion, func(list *pb.KVList) error {
+			state.MaxVersion = max(state.MaxVersion, maxVersion)
+			return w.writeList(list, true)
+		})
+		if err := stream.Orchestrate(ctx); err != nil {
+			return 0, err
+		}
+		state.Scanned = true
+		state.MaxVersion = max(state.MaxVersion, maxVersion)
+		if err := w.flush(nil, true); err != nil {
+			return 0, err
+		}
+	}
+
+	// Back up the versions written since the first attempt of the keys backed up by the earlier
+	// attempts.
+	if resumed {
+		// SinceTs of a Stream excludes the version itself, unlike the argument of Backup.
+		since := max(state.Since, state.ReadTs+1)
+		stream := newStream(since-1, func(key []byte) bool {
+			return scanned || bytes.Compare(key, start) < 0
+		})
+		stream.setupBackup(nil, since, &maxVersion, func(list *pb.KVList) error {
+			state.MaxVersion = max(state.MaxVersion, maxVersion)
+			return w.writeList(list, false)
+		})
+		if err := stream.Orchestrate(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	state.MaxVersion = max(state.MaxVersion, maxVersion)
+	state.Done = true
+	if err := w.flush(nil, true); err != nil {
+		return 0, err
+	}
+	return state.MaxVersion, nil
+}
+
+// chunkWriter buffers a backup, to store it in chunks in a BackupSink.
+type chunkWriter struct {
+	ctx   context.Context
+	sink  BackupSink
+	state *BackupState
+	size  int64
+	buf   bytes.Buffer
+}
+
+// writeList writes the versions of list to the buffer, storing a chunk whenever it is full. To
+// keep the chunks small, the versions are written as lists of a fraction of the chunk size, each
+// ending with the last version of a key. If next is set, the last key of the buffer is the next
+// key to back up if the backup is resumed: it may have more versions in the next list.
+func (w *chunkWriter) writeList(list *pb.KVList, next bool) error {
+	limit := min(w.size/4, 1<<20)
+	var sub pb.KVList
+	var size int64
+	for i, kv := range list.Kv {
+		sub.Kv = append(sub.Kv, kv)
+		size += int64(len(kv.Key) + len(kv.Value))
+		last := i == len(list.Kv)-1
+		if !last && (size < limit || bytes.Equal(kv.Key, list.Kv[i+1].Key)) {
+			continue
+		}
+		if err := writeTo(&sub, &w.buf); err != nil {
+			return err
+		}
+		var key []byte
+		if next {
+			key = y.SafeCopy(nil, kv.Key)
+		}
+		if err := w.flush(key, false); err != nil {
+			return err
+		}
+		sub.Kv, size = sub.Kv[:0], 0
+	}
+	return nil
+}
+
+// flush stores the buffer as the next chunk if it is full, or if force is set, and then the
+// state, with next as NextKey unless the keys are all scanned.
+func (w *chunkWriter) flush(next []byte, force bool) error {
+	if int64(w.buf.Len()) < w.size && !force {
+		return nil
+	}
+	if w.buf.Len() > 0 {
+		n := len(w.state.Chunks)
+		if err := w.sink.PutChunk(w.ctx, n, w.buf.Bytes()); err != nil {
+			return y.Wrapf(err, "while storing backup chunk %d", n)
+		}
+		w.state.Chunks = append(w.state.Chunks, BackupChunk{
+			Size:     int64(w.buf.Len()),
+			Checksum: crc32.Checksum(w.buf.Bytes(), y.CastagnoliCrcTable),
+		})
+		w.buf.Reset()
+	}
+	if !w.state.Scanned {
+		w.state.NextKey = next
+	}
+	if err := w.sink.PutState(w.ctx, w.state); err != nil {
+		return y.Wrapf(err, "while storing backup state")
+	}
+	return nil
+}
+
+// LoadFromObjectStore loads the backup under prefix in store, like
+// LoadFromSink(ctx, NewObjectStoreBackupSink(store, prefix), maxPendingWrites).
+func (db *DB) LoadFromObjectStore(ctx context.Context, store objstore.Store, prefix string,
+	maxPendingWrites int) error {
+	return db.LoadFromSink(ctx, NewObjectStoreBackupSink(store, prefix), maxPendingWrites)
+}
+
+// LoadFromSink loads a backup written by DB.BackupToSink, like DB.Load, checking the size and
+// checksum of every chunk before loading it. The backup must be done.
+func (db *DB) LoadFromSink(ctx context.Context, sink BackupSink, maxPendingWrites int) error {
+	state, err := sink.State(ctx)
+	if err != nil {
+		return y.Wrapf(err, "while reading backup state")
+	}
+	if state == nil || !state.Done {
+		return errors.New("Backup in sink is not done")
+	}
+	return db.Load(&chunkReader{ctx: ctx, sink: sink, chunks: state.Chunks}, maxPendingWrites)
+}
+
+// chunkReader reads the chunks of a backup in order, checking each of them as a whole.
+type chunkReader struct {
+	ctx    context.Context
+	sink   BackupSink
+	chunks []BackupChunk
+	n      int
+	cur    bytes.Reader
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for r.cur.Len() == 0 {
+		if r.n == len(r.chunks) {
+			return 0, io.EOF
+		}
+		data, err := r.readChunk(r.n)
+		if err != nil {
+			return 0, err
+		}
+		r.cur.Reset(data)
+		r.n++
+	}
+	return r.cur.Read(p)
+}
+
+func (r *chunkReader) readChunk(n int) ([]byte, error) {
+	rc, err := r.sink.Chunk(r.ctx, n)
+	if err != nil {
+		return nil, y.Wrapf(err, "while reading backup chunk %d", n)
+	}
+	defer rc.Close()
+	want := r.chunks[n]
+	data, err := io.ReadAll(io.LimitReader(rc, want.Size+1))
+	if err != nil {
+		return nil, y.Wrapf(err, "while reading backup chunk %d", n)
+	}
+	if int64(len(data)) != want.Size {
+		return nil, fmt.Errorf("Backup chunk %d is %d bytes, expected %d", n, len(data), want.Size)
+	}
+	if sum := crc32.Checksum(data, y.CastagnoliCrcTable); sum != want.Checksum {
+		return nil, fmt.Errorf("Backup chunk %d has checksum %08x, expected %08x", n, sum,
+			want.Checksum)
+	}
+	return data, nil
+}
+
+// objectStoreSink is a BackupSink storing a backup as objects of a store.
+type objectStoreSink struct {
+	store  objstore.Store
+	prefix string
+}
+
+// NewObjectStoreBackupSink returns a BackupSink storing the chunks of a backup as objects under
+// prefix in store, such as an S3 bucket, along with a BACKUP object holding its state as JSON.
+func NewObjectStoreBackupSink(store objstore.Store, prefix string) BackupSink {
+	return &objectStoreSink{store: store, prefix: prefix}
+}
+
+func (s *objectStoreSink) chunkKey(n int) string {
+	return path.Join(s.prefix, fmt.Sprintf("chunk-%06d", n))
+}
+
+func (s *objectStoreSink) PutChunk(ctx context.Context, n int, data []byte) error {
+	return s.store.Put(ctx, s.chunkKey(n), bytes.NewReader(data), int64(len(data)))
+}
+
+func (s *objectStoreSink) Chunk(ctx context.Context, n int) (io.ReadCloser, error) {
+	return s.store.Get(ctx, s.chunkKey(n))
+}
+
+func (s *objectStoreSink) PutState(ctx context.Context, state *BackupState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	key := path.Join(s.prefix, "BACKUP")
+	return s.store.Put(ctx, key, bytes.NewReader(data), int64(len(data)))
+}
+
+func (s *objectStoreSink) State(ctx context.Context) (*BackupState, error) {
+	rc, err := s.store.Get(ctx, path.Join(s.prefix, "BACKUP"))
+	if errors.Is(err, objstore.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	state := new(BackupState)
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid backup state: %w", err)
+	}
+	return state, nil
+}
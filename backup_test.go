@@ -7,7 +7,11 @@ package badger
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -17,7 +21,9 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
 
+	"github.com/luxfi/zapdb/objstore"
 	"github.com/luxfi/zapdb/pb"
 )
 
@@ -312,6 +318,45 @@ func TestBackup(t *testing.T) {
 	})
 }
 
+func TestLoadLegacyProtoBackup(t *testing.T) {
+	// A backup as upstream Badger writes it: lists of protobuf-encoded KVs,
+	// each preceded by its little-endian uint64 size.
+	var bb bytes.Buffer
+	for l := 0; l < 3; l++ {
+		var list []byte
+		for i := 0; i < 10; i++ {
+			var kv []byte
+			kv = protowire.AppendTag(kv, 1, protowire.BytesType)
+			kv = protowire.AppendBytes(kv, []byte(fmt.Sprintf("key%02d", l*10+i)))
+			kv = protowire.AppendTag(kv, 2, protowire.BytesType)
+			kv = protowire.AppendBytes(kv, []byte(fmt.Sprintf("val%02d", l*10+i)))
+			kv = protowire.AppendTag(kv, 4, protowire.VarintType)
+			kv = protowire.AppendVarint(kv, 5)
+			list = protowire.AppendTag(list, 1, protowire.BytesType)
+			list = protowire.AppendBytes(list, kv)
+		}
+		var sz [8]byte
+		binary.LittleEndian.PutUint64(sz[:], uint64(len(list)))
+		bb.Write(sz[:])
+		bb.Write(list)
+	}
+
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		require.NoError(t, db.Load(&bb, 16))
+		require.NoError(t, db.View(func(txn *Txn) error {
+			for i := 0; i < 30; i++ {
+				item, err := txn.Get([]byte(fmt.Sprintf("key%02d", i)))
+				require.NoError(t, err)
+				require.Equal(t, uint64(5), item.Version())
+				val, err := item.ValueCopy(nil)
+				require.NoError(t, err)
+				require.Equal(t, fmt.Sprintf("val%02d", i), string(val))
+			}
+			return nil
+		}))
+	})
+}
+
 func TestBackupRestore3(t *testing.T) {
 	var bb bytes.Buffer
 	tmpdir, err := os.MkdirTemp("", "badger-test")
@@ -552,3 +597,97 @@ func TestBackupBitClear(t *testing.T) {
 		return nil
 	}))
 }
+
+// failingSink fails to store chunks once it stored limit of them.
+type failingSink struct {
+	BackupSink
+	limit, stored int
+}
+
+func (s *failingSink) PutChunk(ctx context.Context, n int, data []byte) error {
+	if s.stored == s.limit {
+		return errors.New("injected failure")
+	}
+	s.stored++
+	return s.BackupSink.PutChunk(ctx, n, data)
+}
+
+// dbContents returns the keys and values of db.
+func dbContents(t *testing.T, db *DB) map[string]string {
+	kvs := make(map[string]string)
+	require.NoError(t, db.View(func(txn *Txn) error {
+		it := txn.NewIterator(DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			kvs[string(it.Item().Key())] = string(getItemValue(t, it.Item()))
+		}
+		return nil
+	}))
+	return kvs
+}
+
+func TestBackupToObjectStore(t *testing.T) {
+	ctx := context.Background()
+	store := objstore.NewMemory()
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key%05d", i)) }
+	var contents map[string]string
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		for i := 0; i < 3000; i += 100 {
+			require.NoError(t, db.Update(func(txn *Txn) error {
+				for j := i; j < i+100; j++ {
+					require.NoError(t, txn.Set(key(j), bytes.Repeat([]byte{byte(j)}, 100)))
+				}
+				return nil
+			}))
+		}
+
+		// The first attempt fails after a few chunks.
+		opt := ObjectBackupOptions{ChunkSize: 16 << 10}
+		sink := &failingSink{BackupSink: NewObjectStoreBackupSink(store, "backups/1"), limit: 5}
+		_, err := db.BackupToSink(ctx, sink, opt)
+		require.Error(t, err)
+		state, err := sink.State(ctx)
+		require.NoError(t, err)
+		require.Len(t, state.Chunks, 5)
+		require.False(t, state.Done)
+		require.NotNil(t, state.NextKey)
+
+		// Keys before and after the resumed key are changed meanwhile.
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			require.NoError(t, txn.Delete(key(0)))
+			require.NoError(t, txn.Set(key(1), []byte("new")))
+			return txn.Set(key(2999), []byte("new"))
+		}))
+		maxVersion, err := db.BackupToObjectStore(ctx, store, "backups/1", opt)
+		require.NoError(t, err)
+		require.Equal(t, db.MaxVersion(), maxVersion)
+		state, err = sink.State(ctx)
+		require.NoError(t, err)
+		require.True(t, state.Done)
+		require.Greater(t, len(state.Chunks), 5)
+		// A done backup isn't written again.
+		again, err := db.BackupToObjectStore(ctx, store, "backups/1", opt)
+		require.NoError(t, err)
+		require.Equal(t, maxVersion, again)
+		contents = dbContents(t, db)
+	})
+	require.Len(t, contents, 2999)
+
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		require.NoError(t, db.LoadFromObjectStore(ctx, store, "backups/1", 16))
+		require.Equal(t, contents, dbContents(t, db))
+	})
+
+	// A corrupt chunk isn't loaded.
+	rc, err := store.Get(ctx, "backups/1/chunk-000002")
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	data[len(data)/2]++
+	require.NoError(t, store.Put(ctx, "backups/1/chunk-000002", bytes.NewReader(data),
+		int64(len(data))))
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		err := db.LoadFromObjectStore(ctx, store, "backups/1", 16)
+		require.ErrorContains(t, err, "checksum")
+	})
+}
@@ -390,9 +390,15 @@ func printInfo(dir, valueDir string, bopt badger.Options) error {
 		})
 		for _, tableID := range tableIDs {
 			tableFile := table.IDToFilename(tableID)
-			_, ok1 := manifest.Tables[tableID]
+			tm, ok1 := manifest.Tables[tableID]
 			file, ok2 := fileinfoByName[tableFile]
-			if ok1 && ok2 {
+			if ok1 && tm.Cold {
+				// The table is in the cold storage directory, which isn't listed.
+				fmt.Printf("%s L%d [COLD]\n", tableFile, level)
+			} else if ok1 && tm.Remote {
+				// The table is in the remote table store.
+				fmt.Printf("%s L%d [REMOTE]\n", tableFile, level)
+			} else if ok1 && ok2 {
 				fileinfoMarked[tableFile] = true
 				emptyString := ""
 				fileSize := file.Size()
@@ -0,0 +1,66 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/luxfi/zapdb"
+)
+
+var rotateDataKeyCmd = &cobra.Command{
+	Use:   "rotate-data-key",
+	Short: "Rotate the data key encrypting new data.",
+	Long: `
+This command generates a new data key, which encrypts the data written from now on, and rewrites
+the key registry with it. With --rewrite, the tables and value log files encrypted with earlier
+data keys are rewritten with the new one as well.
+`,
+	RunE: rotateDataKey,
+}
+
+var rdo = struct {
+	keyPath string
+	rewrite bool
+}{}
+
+func init() {
+	RootCmd.AddCommand(rotateDataKeyCmd)
+	rotateDataKeyCmd.Flags().StringVar(&rdo.keyPath, "encryption-key-file", "",
+		"Path of the encryption key file.")
+	rotateDataKeyCmd.Flags().BoolVar(&rdo.rewrite, "rewrite", false,
+		"Rewrite the tables and value log files encrypted with earlier data keys.")
+}
+
+func rotateDataKey(cmd *cobra.Command, args []string) error {
+	encKey, err := getKey(rdo.keyPath)
+	if err != nil {
+		return err
+	}
+	opt := badger.DefaultOptions(sstDir).
+		WithValueDir(vlogDir).
+		WithBlockCacheSize(100 << 20).
+		WithIndexCacheSize(200 << 20).
+		WithEncryptionKey(encKey)
+	db, err := badger.Open(opt)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.RotateDataKey(context.Background(), badger.RotateDataKeyOptions{
+		Rewrite: rdo.rewrite,
+		Progress: func(p badger.RotationProgress) {
+			fmt.Printf("Data key: %d. Compactions: %d. Value log files rewritten: %d. "+
+				"Tables left: %d. Value log files left: %d.\n", p.KeyID, p.Compactions,
+				p.ValueLogFilesRewritten, p.TablesLeft, p.ValueLogFilesLeft)
+		},
+	})
+	return err
+}
@@ -133,7 +133,7 @@ func (wb *WriteBatch) SetEntryAt(e *Entry, ts uint64) error {
 
 // Should be called with lock acquired.
 func (wb *WriteBatch) handleEntry(e *Entry) error {
-	if err := wb.txn.SetEntry(e); err != ErrTxnTooBig {
+	if err := wb.txn.SetEntry(e); !errors.Is(err, ErrTxnTooBig) {
 		return err
 	}
 	// Txn has reached it's zenith. Commit now.
@@ -173,7 +173,7 @@ func (wb *WriteBatch) Delete(k []byte) error {
 	wb.Lock()
 	defer wb.Unlock()
 
-	if err := wb.txn.Delete(k); err != ErrTxnTooBig {
+	if err := wb.txn.Delete(k); !errors.Is(err, ErrTxnTooBig) {
 		return err
 	}
 	if err := wb.commit(); err != nil {
@@ -186,6 +186,30 @@ func (wb *WriteBatch) Delete(k []byte) error {
 	return nil
 }
 
+// Merge is equivalent of Txn.Merge.
+func (wb *WriteBatch) Merge(k, delta []byte) error {
+	wb.Lock()
+	defer wb.Unlock()
+
+	// The batch doesn't read the keys, so the deltas of a key go to different transactions.
+	if e, ok := wb.txn.pendingWrites[string(k)]; ok && e.meta&bitMergeEntry > 0 {
+		if err := wb.commit(); err != nil {
+			return err
+		}
+	}
+	if err := wb.txn.Merge(k, delta); !errors.Is(err, ErrTxnTooBig) {
+		return err
+	}
+	if err := wb.commit(); err != nil {
+		return err
+	}
+	if err := wb.txn.Merge(k, delta); err != nil {
+		wb.err.Store(err)
+		return err
+	}
+	return nil
+}
+
 // Caller to commit must hold a write lock.
 func (wb *WriteBatch) commit() error {
 	if err := wb.Error(); err != nil {
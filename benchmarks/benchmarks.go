@@ -0,0 +1,131 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package benchmarks contains the standard micro and macro benchmarks of zapdb, along with
+// helpers to store their results as JSON and to compare them against a stored baseline.
+//
+// The benchmarks can be run with go test:
+//
+//	go test -run XXX -bench . ./benchmarks
+//
+// or programmatically, via Run, to catch performance regressions:
+//
+//	results := benchmarks.Run(benchmarks.Standard())
+//	regressions := benchmarks.Compare(baseline, results, 0.10)
+package benchmarks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"testing"
+)
+
+// Benchmark is a named benchmark function.
+type Benchmark struct {
+	Name string
+	F    func(b *testing.B)
+}
+
+// Result is the machine-readable result of a Benchmark.
+type Result struct {
+	Name        string  `json:"name"`
+	N           int     `json:"n"`
+	NsPerOp     float64 `json:"ns_per_op"`
+	AllocsPerOp int64   `json:"allocs_per_op"`
+	BytesPerOp  int64   `json:"bytes_per_op"`
+}
+
+// Run runs the benchmarks one after another, and returns their results.
+func Run(benchmarks []Benchmark) []Result {
+	results := make([]Result, 0, len(benchmarks))
+	for _, bm := range benchmarks {
+		r := testing.Benchmark(func(b *testing.B) {
+			b.ReportAllocs()
+			bm.F(b)
+		})
+		res := Result{
+			Name:        bm.Name,
+			N:           r.N,
+			AllocsPerOp: r.AllocsPerOp(),
+			BytesPerOp:  r.AllocedBytesPerOp(),
+		}
+		if r.N > 0 {
+			res.NsPerOp = float64(r.T.Nanoseconds()) / float64(r.N)
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// WriteResults writes the results as indented JSON.
+func WriteResults(w io.Writer, results []Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+// ReadResults reads results written by WriteResults.
+func ReadResults(r io.Reader) ([]Result, error) {
+	var results []Result
+	if err := json.NewDecoder(r).Decode(&results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Regression describes a benchmark which got slower, or allocates more, than its baseline.
+type Regression struct {
+	Name     string
+	Metric   string
+	Baseline float64
+	Current  float64
+}
+
+// Ratio returns the relative change of the metric, e.g. 0.25 for 25% worse than the baseline.
+func (r Regression) Ratio() float64 {
+	if r.Baseline == 0 {
+		return r.Current
+	}
+	return (r.Current - r.Baseline) / r.Baseline
+}
+
+func (r Regression) String() string {
+	return fmt.Sprintf("%s: %s regressed by %.1f%% (%.1f -> %.1f)",
+		r.Name, r.Metric, 100*r.Ratio(), r.Baseline, r.Current)
+}
+
+// Compare compares current results against the baseline, and returns the benchmarks whose
+// ns/op or allocs/op exceed the baseline by more than threshold, e.g. 0.10 for 10%. Benchmarks
+// missing from either side are ignored.
+func Compare(baseline, current []Result, threshold float64) []Regression {
+	base := make(map[string]Result, len(baseline))
+	for _, r := range baseline {
+		base[r.Name] = r
+	}
+	var regressions []Regression
+	check := func(name, metric string, b, c float64) {
+		if c > b*(1+threshold) {
+			regressions = append(regressions,
+				Regression{Name: name, Metric: metric, Baseline: b, Current: c})
+		}
+	}
+	for _, cur := range current {
+		b, ok := base[cur.Name]
+		if !ok {
+			continue
+		}
+		check(cur.Name, "ns/op", b.NsPerOp, cur.NsPerOp)
+		check(cur.Name, "allocs/op", float64(b.AllocsPerOp), float64(cur.AllocsPerOp))
+	}
+	sort.Slice(regressions, func(i, j int) bool {
+		if regressions[i].Name != regressions[j].Name {
+			return regressions[i].Name < regressions[j].Name
+		}
+		return regressions[i].Metric < regressions[j].Metric
+	})
+	return regressions
+}
@@ -0,0 +1,100 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package benchmarks
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	baselinePath = flag.String("benchmarks.baseline", "",
+		"Compare the standard benchmarks against the baseline results in this JSON file.")
+	threshold = flag.Float64("benchmarks.threshold", 0.10,
+		"Relative regression of ns/op or allocs/op tolerated against the baseline.")
+	outPath = flag.String("benchmarks.out", "", "Write the standard benchmark results to this file.")
+)
+
+func BenchmarkStandard(b *testing.B) {
+	for _, bm := range Standard() {
+		b.Run(bm.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			bm.F(b)
+		})
+	}
+}
+
+// TestBaseline runs the standard benchmarks and compares them against a stored baseline. It is
+// skipped unless -benchmarks.baseline or -benchmarks.out is set.
+func TestBaseline(t *testing.T) {
+	if *baselinePath == "" && *outPath == "" {
+		t.Skip("Set -benchmarks.baseline or -benchmarks.out to run the standard benchmarks.")
+	}
+	results := Run(Standard())
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		require.NoError(t, err)
+		require.NoError(t, WriteResults(f, results))
+		require.NoError(t, f.Close())
+	}
+	if *baselinePath == "" {
+		return
+	}
+	f, err := os.Open(*baselinePath)
+	require.NoError(t, err)
+	defer f.Close()
+	baseline, err := ReadResults(f)
+	require.NoError(t, err)
+	for _, r := range Compare(baseline, results, *threshold) {
+		t.Error(r)
+	}
+}
+
+func TestResultsRoundTrip(t *testing.T) {
+	results := []Result{
+		{Name: "A", N: 10, NsPerOp: 12.5, AllocsPerOp: 1, BytesPerOp: 16},
+		{Name: "B", N: 20, NsPerOp: 3},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, WriteResults(&buf, results))
+	got, err := ReadResults(&buf)
+	require.NoError(t, err)
+	require.Equal(t, results, got)
+}
+
+func TestCompare(t *testing.T) {
+	baseline := []Result{
+		{Name: "Fast", NsPerOp: 100, AllocsPerOp: 2},
+		{Name: "Slow", NsPerOp: 100, AllocsPerOp: 2},
+		{Name: "Removed", NsPerOp: 100},
+	}
+	current := []Result{
+		{Name: "Fast", NsPerOp: 105, AllocsPerOp: 2},
+		{Name: "Slow", NsPerOp: 150, AllocsPerOp: 4},
+		{Name: "Added", NsPerOp: 100},
+	}
+	regressions := Compare(baseline, current, 0.10)
+	require.Len(t, regressions, 2)
+	require.Equal(t, "Slow", regressions[0].Name)
+	require.Equal(t, "allocs/op", regressions[0].Metric)
+	require.InDelta(t, 1.0, regressions[0].Ratio(), 1e-9)
+	require.Equal(t, "ns/op", regressions[1].Metric)
+	require.InDelta(t, 0.5, regressions[1].Ratio(), 1e-9)
+}
+
+func TestStandard(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping the standard benchmarks in short mode.")
+	}
+	for _, bm := range Standard() {
+		r := testing.Benchmark(bm.F)
+		require.Greater(t, r.N, 0, bm.Name)
+	}
+}
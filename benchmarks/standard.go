@@ -0,0 +1,165 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package benchmarks
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	badger "github.com/luxfi/zapdb"
+	"github.com/luxfi/zapdb/pb"
+)
+
+const (
+	numKeys   = 10000
+	valueSize = 128
+)
+
+// Standard returns the standard benchmark suite.
+func Standard() []Benchmark {
+	return []Benchmark{
+		{Name: "PBMarshalKVList", F: benchPBMarshal},
+		{Name: "PBUnmarshalKVList", F: benchPBUnmarshal},
+		{Name: "PointGet", F: benchPointGet},
+		{Name: "Scan", F: benchScan},
+		{Name: "Ingest", F: benchIngest},
+	}
+}
+
+func benchKey(i int) []byte {
+	return []byte(fmt.Sprintf("key%08d", i))
+}
+
+func benchKVList() *pb.KVList {
+	list := &pb.KVList{}
+	for i := 0; i < 100; i++ {
+		list.Kv = append(list.Kv, &pb.KV{
+			Key:     benchKey(i),
+			Value:   make([]byte, valueSize),
+			Version: uint64(i),
+		})
+	}
+	return list
+}
+
+func benchPBMarshal(b *testing.B) {
+	list := benchKVList()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := pb.Marshal(list); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchPBUnmarshal(b *testing.B) {
+	buf, err := pb.Marshal(benchKVList())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(buf)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var list pb.KVList
+		if err := pb.Unmarshal(buf, &list); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func openDB(b *testing.B) *badger.DB {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return db
+}
+
+func fillDB(b *testing.B, db *badger.DB) {
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+	val := make([]byte, valueSize)
+	for i := 0; i < numKeys; i++ {
+		if err := wb.Set(benchKey(i), val); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := wb.Flush(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func benchPointGet(b *testing.B) {
+	db := openDB(b)
+	defer db.Close()
+	fillDB(b, db)
+
+	rng := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+	err := db.View(func(txn *badger.Txn) error {
+		for i := 0; i < b.N; i++ {
+			item, err := txn.Get(benchKey(rng.Intn(numKeys)))
+			if err != nil {
+				return err
+			}
+			if err := item.Value(func([]byte) error { return nil }); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+}
+
+// benchScan measures the cost of iterating over a single key-value pair.
+func benchScan(b *testing.B) {
+	db := openDB(b)
+	defer db.Close()
+	fillDB(b, db)
+
+	b.ResetTimer()
+	err := db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		it.Rewind()
+		for i := 0; i < b.N; i++ {
+			if !it.Valid() {
+				it.Rewind()
+			}
+			if err := it.Item().Value(func([]byte) error { return nil }); err != nil {
+				return err
+			}
+			it.Next()
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+}
+
+// benchIngest measures the cost of writing a single key-value pair via a WriteBatch.
+func benchIngest(b *testing.B) {
+	db := openDB(b)
+	defer db.Close()
+
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+	val := make([]byte, valueSize)
+	b.SetBytes(valueSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := wb.Set(benchKey(i), val); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := wb.Flush(); err != nil {
+		b.Fatal(err)
+	}
+}
@@ -0,0 +1,418 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package blob stores large objects as fixed-size, checksummed chunks.
+//
+// Every object gets a generated ID. Its chunks are stored under prefix + "c" + ID + chunk
+// index, and the name of the object, under prefix + "r" + name, refers to the ID. Writing
+// an object only publishes the reference once all of its chunks are written, so readers
+// never see a partial object. Chunks whose ID is no longer referenced, because the object
+// was overwritten, or a writer failed half way, are removed by Store.GC.
+package blob
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+	"time"
+
+	badger "github.com/luxfi/zapdb"
+)
+
+var (
+	// ErrNotFound is returned if there is no object with the given name.
+	ErrNotFound = errors.New("blob: object not found")
+	// ErrChecksum is returned if a chunk doesn't match its checksum.
+	ErrChecksum = errors.New("blob: checksum mismatch")
+	// ErrCorrupt is returned if a chunk of an object is missing.
+	ErrCorrupt = errors.New("blob: object is corrupt")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+const (
+	idSize  = 16 // Creation time in unix nanoseconds, followed by 8 random bytes.
+	refSize = idSize + 8 + 4
+)
+
+// Options configures a Store.
+type Options struct {
+	// ChunkSize is the number of bytes of an object stored per key. It must not be more than
+	// the MaxValueSize of the DB, less 4 bytes for the checksum.
+	ChunkSize int
+}
+
+// DefaultOptions is used by New for a zero ChunkSize.
+var DefaultOptions = Options{ChunkSize: 256 << 10}
+
+// Store stores objects under a key prefix of a DB.
+type Store struct {
+	db     *badger.DB
+	prefix []byte
+	opt    Options
+
+	// Objects being written by this Store, which GC must not remove.
+	mu      sync.Mutex
+	writing map[string]struct{}
+}
+
+// New returns a Store keeping its objects under prefix.
+func New(db *badger.DB, prefix []byte, opt Options) *Store {
+	if opt.ChunkSize <= 0 {
+		opt.ChunkSize = DefaultOptions.ChunkSize
+	}
+	return &Store{
+		db:      db,
+		prefix:  append([]byte{}, prefix...),
+		opt:     opt,
+		writing: make(map[string]struct{}),
+	}
+}
+
+func (s *Store) refKey(name string) []byte {
+	key := make([]byte, 0, len(s.prefix)+1+len(name))
+	key = append(key, s.prefix...)
+	key = append(key, 'r')
+	return append(key, name...)
+}
+
+func (s *Store) chunkPrefix() []byte {
+	return append(append([]byte{}, s.prefix...), 'c')
+}
+
+func (s *Store) chunkKey(id []byte, i uint32) []byte {
+	key := append(s.chunkPrefix(), id...)
+	return binary.BigEndian.AppendUint32(key, i)
+}
+
+// ref is the value stored under the name of an object.
+type ref struct {
+	id     []byte
+	size   uint64
+	chunks uint32
+}
+
+func (r ref) encode() []byte {
+	buf := make([]byte, 0, refSize)
+	buf = append(buf, r.id...)
+	buf = binary.BigEndian.AppendUint64(buf, r.size)
+	return binary.BigEndian.AppendUint32(buf, r.chunks)
+}
+
+func decodeRef(buf []byte) (ref, error) {
+	if len(buf) != refSize {
+		return ref{}, fmt.Errorf("%w: reference has %d bytes", ErrCorrupt, len(buf))
+	}
+	return ref{
+		id:     append([]byte{}, buf[:idSize]...),
+		size:   binary.BigEndian.Uint64(buf[idSize:]),
+		chunks: binary.BigEndian.Uint32(buf[idSize+8:]),
+	}, nil
+}
+
+func newID() ([]byte, error) {
+	id := binary.BigEndian.AppendUint64(make([]byte, 0, idSize), uint64(time.Now().UnixNano()))
+	id = id[:idSize]
+	if _, err := rand.Read(id[8:]); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+func (s *Store) getRef(txn *badger.Txn, name string) (ref, error) {
+	item, err := txn.Get(s.refKey(name))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return ref{}, ErrNotFound
+	}
+	if err != nil {
+		return ref{}, err
+	}
+	var r ref
+	err = item.Value(func(val []byte) error {
+		r, err = decodeRef(val)
+		return err
+	})
+	return r, err
+}
+
+// Put stores data as the object name, replacing any earlier object of that name.
+func (s *Store) Put(name string, data []byte) error {
+	w, err := s.NewWriter(name)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+// Get returns the contents of the object name.
+func (s *Store) Get(name string) ([]byte, error) {
+	r, err := s.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	buf := bytes.NewBuffer(make([]byte, 0, r.Size()))
+	if _, err := io.Copy(buf, r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Delete removes the object name. Deleting a missing object is not an error.
+func (s *Store) Delete(name string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		r, err := s.getRef(txn, name)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for i := uint32(0); i < r.chunks; i++ {
+			if err := txn.Delete(s.chunkKey(r.id, i)); err != nil {
+				return err
+			}
+		}
+		return txn.Delete(s.refKey(name))
+	})
+}
+
+// Writer streams an object into a Store. The object becomes visible on Close.
+type Writer struct {
+	s    *Store
+	name string
+	wb   *badger.WriteBatch
+	ref  ref
+	buf  []byte
+	err  error
+	done bool
+}
+
+// NewWriter returns a Writer for the object name. Either Close or Abort must be called on it.
+func (s *Store) NewWriter(name string) (*Writer, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.writing[string(id)] = struct{}{}
+	s.mu.Unlock()
+	return &Writer{
+		s:    s,
+		name: name,
+		wb:   s.db.NewWriteBatch(),
+		ref:  ref{id: id},
+		buf:  make([]byte, 0, s.opt.ChunkSize),
+	}, nil
+}
+
+func (w *Writer) flushChunk() error {
+	val := make([]byte, 4, 4+len(w.buf))
+	binary.BigEndian.PutUint32(val, crc32.Checksum(w.buf, castagnoli))
+	val = append(val, w.buf...)
+	if err := w.wb.Set(w.s.chunkKey(w.ref.id, w.ref.chunks), val); err != nil {
+		return err
+	}
+	w.ref.chunks++
+	w.ref.size += uint64(len(w.buf))
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Write implements io.Writer.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		k := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+k]
+		p = p[k:]
+		if len(w.buf) == cap(w.buf) {
+			if w.err = w.flushChunk(); w.err != nil {
+				return n - len(p), w.err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (w *Writer) finish() {
+	w.done = true
+	w.s.mu.Lock()
+	delete(w.s.writing, string(w.ref.id))
+	w.s.mu.Unlock()
+}
+
+// Close writes the remaining data and publishes the object, replacing any earlier object of the
+// same name. The chunks of the replaced object are removed by the next GC.
+func (w *Writer) Close() error {
+	if w.done {
+		return w.err
+	}
+	defer w.finish()
+	if w.err == nil && len(w.buf) > 0 {
+		w.err = w.flushChunk()
+	}
+	if w.err != nil {
+		w.wb.Cancel()
+		return w.err
+	}
+	if w.err = w.wb.Flush(); w.err != nil {
+		return w.err
+	}
+	w.err = w.s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(w.s.refKey(w.name), w.ref.encode())
+	})
+	return w.err
+}
+
+// Abort discards the object. Chunks already written are removed by the next GC.
+func (w *Writer) Abort() {
+	if w.done {
+		return
+	}
+	w.wb.Cancel()
+	w.err = errors.New("blob: writer aborted")
+	w.finish()
+}
+
+// Reader streams an object out of a Store. It reads from a snapshot of the DB taken by
+// Store.Open, so it is unaffected by later writes.
+type Reader struct {
+	s   *Store
+	txn *badger.Txn
+	ref ref
+	i   uint32
+	buf []byte
+}
+
+// Open returns a Reader for the object name. The Reader must be closed.
+func (s *Store) Open(name string) (*Reader, error) {
+	txn := s.db.NewTransaction(false)
+	r, err := s.getRef(txn, name)
+	if err != nil {
+		txn.Discard()
+		return nil, err
+	}
+	return &Reader{s: s, txn: txn, ref: r}, nil
+}
+
+// Size returns the size of the object.
+func (r *Reader) Size() int64 {
+	return int64(r.ref.size)
+}
+
+// Read implements io.Reader.
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.i == r.ref.chunks {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *Reader) next() error {
+	item, err := r.txn.Get(r.s.chunkKey(r.ref.id, r.i))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return fmt.Errorf("%w: chunk %d is missing", ErrCorrupt, r.i)
+	}
+	if err != nil {
+		return err
+	}
+	val, err := item.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+	if len(val) < 4 || binary.BigEndian.Uint32(val) != crc32.Checksum(val[4:], castagnoli) {
+		return fmt.Errorf("%w: chunk %d", ErrChecksum, r.i)
+	}
+	r.buf = val[4:]
+	r.i++
+	return nil
+}
+
+// Close releases the snapshot held by the Reader.
+func (r *Reader) Close() error {
+	r.txn.Discard()
+	return nil
+}
+
+// GC removes chunks that no object refers to, and returns how many it removed. Chunks younger
+// than minAge are kept, so that objects being written by other Stores on the same DB survive.
+func (s *Store) GC(minAge time.Duration) (int, error) {
+	live := make(map[string]struct{})
+	err := s.db.View(func(txn *badger.Txn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.Prefix = s.refKey("")
+		it := txn.NewIterator(opt)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if err := it.Item().Value(func(val []byte) error {
+				r, err := decodeRef(val)
+				live[string(r.id)] = struct{}{}
+				return err
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := uint64(time.Now().Add(-minAge).UnixNano())
+	prefix := s.chunkPrefix()
+	wb := s.db.NewWriteBatch()
+	var removed int
+	err = s.db.View(func(txn *badger.Txn) error {
+		opt := badger.IteratorOptions{Prefix: prefix}
+		it := txn.NewIterator(opt)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			key := it.Item().Key()
+			if len(key) != len(prefix)+idSize+4 {
+				continue
+			}
+			id := key[len(prefix) : len(prefix)+idSize]
+			if _, ok := live[string(id)]; ok || binary.BigEndian.Uint64(id) > cutoff {
+				continue
+			}
+			s.mu.Lock()
+			_, writing := s.writing[string(id)]
+			s.mu.Unlock()
+			if writing {
+				continue
+			}
+			if err := wb.Delete(it.Item().KeyCopy(nil)); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		wb.Cancel()
+		return 0, err
+	}
+	return removed, wb.Flush()
+}
@@ -0,0 +1,127 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package blob
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	badger "github.com/luxfi/zapdb"
+	"github.com/luxfi/zapdb/testkit"
+)
+
+func TestPutGetDelete(t *testing.T) {
+	s := New(testkit.OpenInMemory(t), []byte("blob/"), Options{ChunkSize: 1000})
+
+	data := make([]byte, 10500)
+	rand.New(rand.NewSource(1)).Read(data)
+	require.NoError(t, s.Put("a", data))
+	require.NoError(t, s.Put("empty", nil))
+
+	got, err := s.Get("a")
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+	got, err = s.Get("empty")
+	require.NoError(t, err)
+	require.Empty(t, got)
+
+	r, err := s.Open("a")
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), r.Size())
+	// Read in pieces that don't line up with chunks.
+	var buf bytes.Buffer
+	_, err = io.CopyBuffer(&buf, struct{ io.Reader }{r}, make([]byte, 333))
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, data, buf.Bytes())
+
+	require.NoError(t, s.Delete("a"))
+	_, err = s.Get("a")
+	require.ErrorIs(t, err, ErrNotFound)
+	require.NoError(t, s.Delete("a"))
+}
+
+func TestWriterStreams(t *testing.T) {
+	s := New(testkit.OpenInMemory(t), []byte("blob/"), Options{ChunkSize: 64})
+
+	w, err := s.NewWriter("obj")
+	require.NoError(t, err)
+	var want []byte
+	for i := 0; i < 100; i++ {
+		p := bytes.Repeat([]byte{byte(i)}, i)
+		want = append(want, p...)
+		_, err := w.Write(p)
+		require.NoError(t, err)
+	}
+	// Nothing is visible before Close.
+	_, err = s.Get("obj")
+	require.ErrorIs(t, err, ErrNotFound)
+	require.NoError(t, w.Close())
+
+	got, err := s.Get("obj")
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+}
+
+func TestChecksum(t *testing.T) {
+	db := testkit.OpenInMemory(t)
+	s := New(db, []byte("blob/"), Options{ChunkSize: 16})
+	require.NoError(t, s.Put("a", bytes.Repeat([]byte("x"), 40)))
+
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		r, err := s.getRef(txn, "a")
+		require.NoError(t, err)
+		return txn.Set(s.chunkKey(r.id, 1), []byte("\x00\x00\x00\x00garbage"))
+	}))
+	_, err := s.Get("a")
+	require.ErrorIs(t, err, ErrChecksum)
+}
+
+func TestGC(t *testing.T) {
+	db := testkit.OpenInMemory(t)
+	s := New(db, []byte("blob/"), Options{ChunkSize: 10})
+
+	require.NoError(t, s.Put("a", bytes.Repeat([]byte("1"), 35)))
+	// Overwriting leaves the 4 chunks of the first object behind.
+	require.NoError(t, s.Put("a", bytes.Repeat([]byte("2"), 15)))
+	// So does an aborted writer.
+	w, err := s.NewWriter("b")
+	require.NoError(t, err)
+	_, err = w.Write(bytes.Repeat([]byte("3"), 25))
+	require.NoError(t, err)
+	require.NoError(t, w.wb.Flush())
+	w.finish()
+	// An object being written must survive.
+	pending, err := s.NewWriter("c")
+	require.NoError(t, err)
+	_, err = pending.Write(bytes.Repeat([]byte("4"), 25))
+	require.NoError(t, err)
+	require.NoError(t, pending.wb.Flush())
+	pending.wb = db.NewWriteBatch()
+
+	// Everything is younger than an hour.
+	removed, err := s.GC(time.Hour)
+	require.NoError(t, err)
+	require.Zero(t, removed)
+
+	removed, err = s.GC(0)
+	require.NoError(t, err)
+	require.Equal(t, 4+2, removed)
+
+	got, err := s.Get("a")
+	require.NoError(t, err)
+	require.Equal(t, bytes.Repeat([]byte("2"), 15), got)
+
+	require.NoError(t, pending.Close())
+	got, err = s.Get("c")
+	require.NoError(t, err)
+	require.Equal(t, bytes.Repeat([]byte("4"), 25), got)
+}
@@ -0,0 +1,153 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"sync/atomic"
+
+	"github.com/dgraph-io/ristretto/v2"
+	"github.com/dgraph-io/ristretto/v2/z"
+
+	"github.com/luxfi/zapdb/table"
+	"github.com/luxfi/zapdb/y"
+)
+
+// blockCacheIDs sets the keys of the DBs apart in the block caches of Options.BlockCache, which
+// may be shared.
+var blockCacheIDs atomic.Uint32
+
+// ShardedBlockCache is a block cache split into shards, ristretto caches of their own, so that
+// the gets and sets of many cores don't contend on one cache. The keys are spread over the shards
+// by hash. See Options.BlockCacheShards.
+type ShardedBlockCache struct {
+	shards []*ristretto.Cache[[]byte, *table.Block]
+}
+
+// NewShardedBlockCache returns a block cache of size bytes, split evenly into n shards, for
+// blocks of about blockSize bytes.
+func NewShardedBlockCache(size int64, blockSize, n int) (*ShardedBlockCache, error) {
+	n = max(n, 1)
+	c := &ShardedBlockCache{}
+	for range n {
+		shard, err := newRistrettoBlockCache(max(size/int64(n), 1), blockSize)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.shards = append(c.shards, shard)
+	}
+	return c, nil
+}
+
+func (c *ShardedBlockCache) shard(key []byte) *ristretto.Cache[[]byte, *table.Block] {
+	// The shards hash the keys with the other hash of KeyToHash, so that each shard spreads its
+	// keys over its own internal shards.
+	_, h := z.KeyToHash(key)
+	return c.shards[h%uint64(len(c.shards))]
+}
+
+// Get returns the block of key, if cached.
+func (c *ShardedBlockCache) Get(key []byte) (*table.Block, bool) { return c.shard(key).Get(key) }
+
+// Set caches b under key, at cost.
+func (c *ShardedBlockCache) Set(key []byte, b *table.Block, cost int64) bool {
+	return c.shard(key).Set(key, b, cost)
+}
+
+// Del deletes the block of key.
+func (c *ShardedBlockCache) Del(key []byte) { c.shard(key).Del(key) }
+
+// Wait waits for the pending sets of every shard to be applied.
+func (c *ShardedBlockCache) Wait() {
+	for _, s := range c.shards {
+		s.Wait()
+	}
+}
+
+// Clear deletes every block.
+func (c *ShardedBlockCache) Clear() {
+	for _, s := range c.shards {
+		s.Clear()
+	}
+}
+
+// Close closes the shards.
+func (c *ShardedBlockCache) Close() {
+	for _, s := range c.shards {
+		s.Close()
+	}
+}
+
+// MaxCost returns the total max cost of the shards.
+func (c *ShardedBlockCache) MaxCost() int64 {
+	var cost int64
+	for _, s := range c.shards {
+		cost += s.MaxCost()
+	}
+	return cost
+}
+
+// UpdateMaxCost splits maxCost evenly between the shards.
+func (c *ShardedBlockCache) UpdateMaxCost(maxCost int64) {
+	for _, s := range c.shards {
+		s.UpdateMaxCost(max(maxCost/int64(len(c.shards)), 1))
+	}
+}
+
+// ShardMetrics returns the metrics of the shards.
+func (c *ShardedBlockCache) ShardMetrics() []*ristretto.Metrics {
+	ms := make([]*ristretto.Metrics, 0, len(c.shards))
+	for _, s := range c.shards {
+		ms = append(ms, s.Metrics)
+	}
+	return ms
+}
+
+// newBlockCache returns a block cache of size bytes, sharded if shards is more than one, or nil
+// if size is zero.
+func newBlockCache(size int64, blockSize, shards int) (table.BlockCache, error) {
+	switch {
+	case size <= 0:
+		return nil, nil
+	case shards > 1:
+		return NewShardedBlockCache(size, blockSize, shards)
+	}
+	return newRistrettoBlockCache(size, blockSize)
+}
+
+func newRistrettoBlockCache(size int64, blockSize int) (*ristretto.Cache[[]byte, *table.Block], error) {
+	numInCache := size / int64(blockSize)
+	if numInCache == 0 {
+		// Make the value of this variable at least one since the cache requires
+		// the number of counters to be greater than zero.
+		numInCache = 1
+	}
+
+	config := ristretto.Config[[]byte, *table.Block]{
+		NumCounters: numInCache * 8,
+		MaxCost:     size,
+		BufferItems: 64,
+		Metrics:     true,
+		OnExit:      table.BlockEvictHandler,
+	}
+	cache, err := ristretto.NewCache[[]byte, *table.Block](&config)
+	if err != nil {
+		return nil, y.Wrap(err, "failed to create data cache")
+	}
+	return cache, nil
+}
+
+// blockCacheMetrics returns the metrics of the shards of c, or of c itself if it's a ristretto
+// cache. It returns nil for the other caches.
+func blockCacheMetrics(c table.BlockCache) []*ristretto.Metrics {
+	switch c := c.(type) {
+	case *ristretto.Cache[[]byte, *table.Block]:
+		return []*ristretto.Metrics{c.Metrics}
+	case *ShardedBlockCache:
+		return c.ShardMetrics()
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedBlockCache(t *testing.T) {
+	key := func(i int) []byte { return fmt.Appendf(nil, "key%04d", i) }
+	write := func(db *DB, val string) {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			for i := range 1000 {
+				if err := txn.Set(key(i), []byte(val)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+	}
+	read := func(db *DB, val string) {
+		require.NoError(t, db.View(func(txn *Txn) error {
+			for i := range 1000 {
+				item, err := txn.Get(key(i))
+				require.NoError(t, err)
+				require.Equal(t, []byte(val), getItemValue(t, item))
+			}
+			return nil
+		}))
+	}
+
+	t.Run("shards", func(t *testing.T) {
+		opt := getTestOptions(t.TempDir()).
+			WithBlockCacheSize(8 << 20).
+			WithBlockCacheShards(4).
+			WithBlockSize(256)
+		db, err := Open(opt)
+		require.NoError(t, err)
+		write(db, "value")
+		require.NoError(t, db.Close())
+
+		db, err = Open(opt)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, db.Close()) }()
+		require.Nil(t, db.BlockCacheMetrics())
+		read(db, "value")
+		db.blockCache.Wait()
+		read(db, "value")
+
+		shards := db.BlockCacheShardMetrics()
+		require.Len(t, shards, 4)
+		for _, m := range shards {
+			// The blocks are spread over every shard.
+			require.NotZero(t, m.KeysAdded())
+			require.NotZero(t, m.Hits())
+		}
+		maxCost, err := db.CacheMaxCost(BlockCache, -1)
+		require.NoError(t, err)
+		require.Equal(t, int64(8<<20), maxCost)
+	})
+
+	t.Run("shared", func(t *testing.T) {
+		cache, err := NewShardedBlockCache(8<<20, 256, 2)
+		require.NoError(t, err)
+		defer cache.Close()
+
+		var dbs []*DB
+		for i := range 2 {
+			opt := getTestOptions(t.TempDir()).WithBlockCache(cache).WithBlockSize(256)
+			db, err := Open(opt)
+			require.NoError(t, err)
+			write(db, fmt.Sprint(i))
+			require.NoError(t, db.Close())
+			db, err = Open(opt)
+			require.NoError(t, err)
+			dbs = append(dbs, db)
+		}
+		// The tables of both DBs have the same IDs, but their blocks don't collide.
+		for i, db := range dbs {
+			read(db, fmt.Sprint(i))
+			cache.Wait()
+		}
+		for i, db := range dbs {
+			read(db, fmt.Sprint(i))
+			require.NoError(t, db.Close())
+		}
+		// Both DBs cached their blocks in the shared cache.
+		var added uint64
+		for _, m := range cache.ShardMetrics() {
+			added += m.KeysAdded()
+		}
+		require.NotZero(t, added)
+	})
+}
@@ -0,0 +1,537 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package bucket offers an API modelled on bbolt, with nested buckets and cursors, on top of a
+// DB. It eases moving code written for bbolt, which serializes all writers, to a DB that runs
+// write transactions concurrently.
+//
+// Every bucket has a random 8 byte ID. Its entries are stored under prefix + "d" + ID + key,
+// with a value holding either the user value or the ID of a nested bucket, so keys and nested
+// buckets sort together as in bbolt. Top level buckets are the nested buckets of a root bucket
+// with ID zero. Bucket sequences are stored under prefix + "s" + ID.
+//
+// Unlike bbolt, write transactions can fail with badger.ErrConflict when they race with
+// another, and must then be retried. A transaction, deleting buckets included, must also fit in
+// the limits of a badger.Txn.
+package bucket
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+
+	badger "github.com/luxfi/zapdb"
+)
+
+var (
+	// ErrBucketNotFound is returned when deleting a bucket that doesn't exist.
+	ErrBucketNotFound = errors.New("bucket: bucket not found")
+	// ErrBucketExists is returned when creating a bucket that already exists.
+	ErrBucketExists = errors.New("bucket: bucket already exists")
+	// ErrBucketNameRequired is returned when creating a bucket with an empty name.
+	ErrBucketNameRequired = errors.New("bucket: bucket name required")
+	// ErrKeyRequired is returned when putting an empty key.
+	ErrKeyRequired = errors.New("bucket: key required")
+	// ErrIncompatibleValue is returned when using a key holding a value as a bucket, or a key
+	// holding a bucket as a value.
+	ErrIncompatibleValue = errors.New("bucket: incompatible value")
+	// ErrTxNotWritable is returned when writing in a read-only transaction.
+	ErrTxNotWritable = errors.New("bucket: tx not writable")
+)
+
+const (
+	kindValue  = 0
+	kindBucket = 1
+	idSize     = 8
+)
+
+// DB stores buckets under a key prefix of a badger.DB.
+type DB struct {
+	db     *badger.DB
+	prefix []byte
+}
+
+// New returns a DB keeping its buckets under prefix.
+func New(db *badger.DB, prefix []byte) *DB {
+	return &DB{db: db, prefix: append([]byte{}, prefix...)}
+}
+
+// Update runs fn in a read-write transaction, committed if fn returns nil.
+func (d *DB) Update(fn func(*Tx) error) error {
+	return d.db.Update(func(txn *badger.Txn) error {
+		return d.run(txn, true, fn)
+	})
+}
+
+// View runs fn in a read-only transaction.
+func (d *DB) View(fn func(*Tx) error) error {
+	return d.db.View(func(txn *badger.Txn) error {
+		return d.run(txn, false, fn)
+	})
+}
+
+func (d *DB) run(txn *badger.Txn, writable bool, fn func(*Tx) error) error {
+	tx := &Tx{db: d, txn: txn, writable: writable}
+	defer tx.closeCursors()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.err
+}
+
+// Tx is a transaction over the buckets of a DB. It is only valid inside Update or View.
+type Tx struct {
+	db       *DB
+	txn      *badger.Txn
+	writable bool
+	// gen is bumped by every write, so cursors know to pick them up.
+	gen     int
+	cursors []*Cursor
+	// err is the first error met by a method with no error result, returned by Update or View.
+	err error
+}
+
+// Writable returns true in the transactions of Update.
+func (tx *Tx) Writable() bool {
+	return tx.writable
+}
+
+// Txn returns the underlying transaction.
+func (tx *Tx) Txn() *badger.Txn {
+	return tx.txn
+}
+
+func (tx *Tx) root() *Bucket {
+	return &Bucket{tx: tx}
+}
+
+// Bucket returns the top level bucket name, or nil if it doesn't exist.
+func (tx *Tx) Bucket(name []byte) *Bucket {
+	return tx.root().Bucket(name)
+}
+
+// CreateBucket creates the top level bucket name.
+func (tx *Tx) CreateBucket(name []byte) (*Bucket, error) {
+	return tx.root().CreateBucket(name)
+}
+
+// CreateBucketIfNotExists returns the top level bucket name, creating it if needed.
+func (tx *Tx) CreateBucketIfNotExists(name []byte) (*Bucket, error) {
+	return tx.root().CreateBucketIfNotExists(name)
+}
+
+// DeleteBucket deletes the top level bucket name, and everything in it.
+func (tx *Tx) DeleteBucket(name []byte) error {
+	return tx.root().DeleteBucket(name)
+}
+
+// ForEach calls fn for every top level bucket, in name order.
+func (tx *Tx) ForEach(fn func(name []byte, b *Bucket) error) error {
+	root := tx.root()
+	return root.ForEach(func(k, _ []byte) error {
+		return fn(k, root.Bucket(k))
+	})
+}
+
+// Cursor returns a cursor over the top level buckets. Their values are nil.
+func (tx *Tx) Cursor() *Cursor {
+	return tx.root().Cursor()
+}
+
+func (tx *Tx) fail(err error) {
+	if tx.err == nil {
+		tx.err = err
+	}
+}
+
+func (tx *Tx) set(key, val []byte) error {
+	if !tx.writable {
+		return ErrTxNotWritable
+	}
+	tx.gen++
+	return tx.txn.Set(key, val)
+}
+
+func (tx *Tx) delete(key []byte) error {
+	if !tx.writable {
+		return ErrTxNotWritable
+	}
+	tx.gen++
+	return tx.txn.Delete(key)
+}
+
+func (tx *Tx) closeCursors() {
+	for _, c := range tx.cursors {
+		c.close()
+	}
+	tx.cursors = nil
+}
+
+// Bucket is a collection of keys, values and nested buckets.
+type Bucket struct {
+	tx *Tx
+	id [idSize]byte
+}
+
+// Tx returns the transaction of the bucket.
+func (b *Bucket) Tx() *Tx {
+	return b.tx
+}
+
+func (b *Bucket) dataPrefix() []byte {
+	p := append(append([]byte{}, b.tx.db.prefix...), 'd')
+	return append(p, b.id[:]...)
+}
+
+func (b *Bucket) dataKey(key []byte) []byte {
+	return append(b.dataPrefix(), key...)
+}
+
+func (b *Bucket) seqKey() []byte {
+	p := append(append([]byte{}, b.tx.db.prefix...), 's')
+	return append(p, b.id[:]...)
+}
+
+// entry returns the raw value stored for key, or nil if there is none.
+func (b *Bucket) entry(key []byte) ([]byte, error) {
+	item, err := b.tx.txn.Get(b.dataKey(key))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	val, err := item.ValueCopy(nil)
+	if err == nil && len(val) == 0 {
+		err = errors.New("bucket: corrupt entry")
+	}
+	return val, err
+}
+
+func (b *Bucket) child(val []byte) *Bucket {
+	c := &Bucket{tx: b.tx}
+	copy(c.id[:], val[1:])
+	return c
+}
+
+// Get returns a copy of the value of key, or nil if key is missing or holds a bucket.
+func (b *Bucket) Get(key []byte) []byte {
+	val, err := b.entry(key)
+	if err != nil {
+		b.tx.fail(err)
+		return nil
+	}
+	if val == nil || val[0] != kindValue {
+		return nil
+	}
+	return val[1:]
+}
+
+// Put sets the value of key.
+func (b *Bucket) Put(key, value []byte) error {
+	if len(key) == 0 {
+		return ErrKeyRequired
+	}
+	val, err := b.entry(key)
+	if err != nil {
+		return err
+	}
+	if val != nil && val[0] != kindValue {
+		return ErrIncompatibleValue
+	}
+	return b.tx.set(b.dataKey(key), append([]byte{kindValue}, value...))
+}
+
+// Delete removes key. Deleting a missing key is not an error.
+func (b *Bucket) Delete(key []byte) error {
+	val, err := b.entry(key)
+	if err != nil || val == nil {
+		return err
+	}
+	if val[0] != kindValue {
+		return ErrIncompatibleValue
+	}
+	return b.tx.delete(b.dataKey(key))
+}
+
+// Bucket returns the nested bucket name, or nil if it doesn't exist.
+func (b *Bucket) Bucket(name []byte) *Bucket {
+	val, err := b.entry(name)
+	if err != nil {
+		b.tx.fail(err)
+		return nil
+	}
+	if val == nil || val[0] != kindBucket || len(val) != 1+idSize {
+		return nil
+	}
+	return b.child(val)
+}
+
+// CreateBucket creates the nested bucket name.
+func (b *Bucket) CreateBucket(name []byte) (*Bucket, error) {
+	if len(name) == 0 {
+		return nil, ErrBucketNameRequired
+	}
+	val, err := b.entry(name)
+	switch {
+	case err != nil:
+		return nil, err
+	case val != nil && val[0] == kindBucket:
+		return nil, ErrBucketExists
+	case val != nil:
+		return nil, ErrIncompatibleValue
+	}
+	val = make([]byte, 1+idSize)
+	val[0] = kindBucket
+	// A random ID doesn't make concurrent transactions creating buckets conflict.
+	if _, err := rand.Read(val[1:]); err != nil {
+		return nil, err
+	}
+	if err := b.tx.set(b.dataKey(name), val); err != nil {
+		return nil, err
+	}
+	return b.child(val), nil
+}
+
+// CreateBucketIfNotExists returns the nested bucket name, creating it if needed.
+func (b *Bucket) CreateBucketIfNotExists(name []byte) (*Bucket, error) {
+	c, err := b.CreateBucket(name)
+	if errors.Is(err, ErrBucketExists) {
+		return b.Bucket(name), nil
+	}
+	return c, err
+}
+
+// DeleteBucket deletes the nested bucket name, and everything in it.
+func (b *Bucket) DeleteBucket(name []byte) error {
+	val, err := b.entry(name)
+	switch {
+	case err != nil:
+		return err
+	case val == nil:
+		return ErrBucketNotFound
+	case val[0] != kindBucket:
+		return ErrIncompatibleValue
+	}
+	if err := b.child(val).clear(); err != nil {
+		return err
+	}
+	return b.tx.delete(b.dataKey(name))
+}
+
+// clear deletes everything in the bucket, nested buckets included.
+func (b *Bucket) clear() error {
+	var keys [][]byte
+	var children []*Bucket
+	prefix := b.dataPrefix()
+	it := b.tx.txn.NewIterator(badger.IteratorOptions{Prefix: prefix, PrefetchValues: false})
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		keys = append(keys, item.KeyCopy(nil))
+		err := item.Value(func(val []byte) error {
+			if len(val) == 1+idSize && val[0] == kindBucket {
+				children = append(children, b.child(val))
+			}
+			return nil
+		})
+		if err != nil {
+			it.Close()
+			return err
+		}
+	}
+	it.Close()
+	for _, c := range children {
+		if err := c.clear(); err != nil {
+			return err
+		}
+	}
+	for _, key := range keys {
+		if err := b.tx.delete(key); err != nil {
+			return err
+		}
+	}
+	return b.tx.delete(b.seqKey())
+}
+
+// ForEach calls fn for every key in the bucket, in order. The value of nested buckets is nil.
+func (b *Bucket) ForEach(fn func(k, v []byte) error) error {
+	c := b.Cursor()
+	defer c.close()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return b.tx.err
+}
+
+// Sequence returns the current sequence of the bucket.
+func (b *Bucket) Sequence() uint64 {
+	item, err := b.tx.txn.Get(b.seqKey())
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return 0
+	}
+	var seq uint64
+	if err == nil {
+		err = item.Value(func(val []byte) error {
+			if len(val) != 8 {
+				return errors.New("bucket: corrupt sequence")
+			}
+			seq = binary.BigEndian.Uint64(val)
+			return nil
+		})
+	}
+	if err != nil {
+		b.tx.fail(err)
+	}
+	return seq
+}
+
+// SetSequence sets the sequence of the bucket.
+func (b *Bucket) SetSequence(v uint64) error {
+	return b.tx.set(b.seqKey(), binary.BigEndian.AppendUint64(nil, v))
+}
+
+// NextSequence increments the sequence of the bucket and returns it.
+func (b *Bucket) NextSequence() (uint64, error) {
+	seq := b.Sequence() + 1
+	if b.tx.err != nil {
+		return 0, b.tx.err
+	}
+	return seq, b.SetSequence(seq)
+}
+
+// Cursor returns a cursor over the bucket. It is valid until the end of the transaction.
+func (b *Bucket) Cursor() *Cursor {
+	c := &Cursor{b: b, prefix: b.dataPrefix()}
+	b.tx.cursors = append(b.tx.cursors, c)
+	return c
+}
+
+// Cursor iterates over the keys of a bucket in order. Writes made through the transaction are
+// visible to it once it moves.
+type Cursor struct {
+	b      *Bucket
+	prefix []byte
+
+	it      *badger.Iterator
+	reverse bool
+	gen     int
+	key     []byte // The current key, without the prefix.
+}
+
+// Bucket returns the bucket of the cursor.
+func (c *Cursor) Bucket() *Bucket {
+	return c.b
+}
+
+func (c *Cursor) close() {
+	if c.it != nil {
+		c.it.Close()
+		c.it = nil
+	}
+}
+
+// iterator returns an iterator in the given direction that has seen every write so far.
+func (c *Cursor) iterator(reverse bool) *badger.Iterator {
+	if c.it != nil && c.reverse == reverse && c.gen == c.b.tx.gen {
+		return c.it
+	}
+	c.close()
+	opt := badger.IteratorOptions{Reverse: reverse, PrefetchValues: true, PrefetchSize: 16}
+	if !reverse {
+		// A reverse iterator can't start from the end of its prefix, so it filters by hand.
+		opt.Prefix = c.prefix
+	}
+	c.it = c.b.tx.txn.NewIterator(opt)
+	c.reverse, c.gen = reverse, c.b.tx.gen
+	return c.it
+}
+
+// seek positions a fresh iterator at the first key at or after key, or at or before it in
+// reverse. If strict, key itself is skipped.
+func (c *Cursor) seek(key []byte, reverse, strict bool) ([]byte, []byte) {
+	it := c.iterator(reverse)
+	it.Seek(key)
+	for strict && it.Valid() && bytes.Equal(it.Item().Key(), key) {
+		it.Next()
+	}
+	return c.read()
+}
+
+func (c *Cursor) read() ([]byte, []byte) {
+	c.key = nil
+	if !c.it.Valid() || !bytes.HasPrefix(c.it.Item().Key(), c.prefix) {
+		return nil, nil
+	}
+	item := c.it.Item()
+	val, err := item.ValueCopy(nil)
+	if err == nil && len(val) == 0 {
+		err = errors.New("bucket: corrupt entry")
+	}
+	if err != nil {
+		c.b.tx.fail(err)
+		return nil, nil
+	}
+	c.key = append([]byte{}, item.Key()[len(c.prefix):]...)
+	if val[0] != kindValue {
+		return c.key, nil
+	}
+	return c.key, val[1:]
+}
+
+// First moves to the first key of the bucket, and returns it with its value. It returns nil
+// keys once past either end.
+func (c *Cursor) First() (key, value []byte) {
+	return c.seek(c.prefix, false, false)
+}
+
+// Last moves to the last key of the bucket.
+func (c *Cursor) Last() (key, value []byte) {
+	// The bucket prefix is never all 0xff, as it includes 'd'.
+	end := append([]byte{}, c.prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i]++; end[i] != 0 {
+			end = end[:i+1]
+			break
+		}
+	}
+	return c.seek(end, true, true)
+}
+
+// Seek moves to the first key at or after seek.
+func (c *Cursor) Seek(seek []byte) (key, value []byte) {
+	return c.seek(append(append([]byte{}, c.prefix...), seek...), false, false)
+}
+
+// Next moves to the next key.
+func (c *Cursor) Next() (key, value []byte) {
+	return c.move(false)
+}
+
+// Prev moves to the previous key.
+func (c *Cursor) Prev() (key, value []byte) {
+	return c.move(true)
+}
+
+func (c *Cursor) move(reverse bool) ([]byte, []byte) {
+	if c.key == nil {
+		return nil, nil
+	}
+	if c.it != nil && c.reverse == reverse && c.gen == c.b.tx.gen {
+		c.it.Next()
+		return c.read()
+	}
+	return c.seek(append(append([]byte{}, c.prefix...), c.key...), reverse, true)
+}
+
+// Delete removes the current key. It returns ErrIncompatibleValue on a nested bucket.
+func (c *Cursor) Delete() error {
+	if c.key == nil {
+		return nil
+	}
+	return c.b.Delete(c.key)
+}
@@ -0,0 +1,152 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package bucket
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	badger "github.com/luxfi/zapdb"
+	"github.com/luxfi/zapdb/testkit"
+)
+
+func openDB(t *testing.T) *DB {
+	return New(testkit.OpenInMemory(t), []byte("bolt/"))
+}
+
+type kv struct{ k, v string }
+
+func collect(first func() ([]byte, []byte), next func() ([]byte, []byte)) []kv {
+	var out []kv
+	for k, v := first(); k != nil; k, v = next() {
+		out = append(out, kv{string(k), string(v)})
+	}
+	return out
+}
+
+func TestBuckets(t *testing.T) {
+	db := openDB(t)
+	require.NoError(t, db.Update(func(tx *Tx) error {
+		users, err := tx.CreateBucket([]byte("users"))
+		require.NoError(t, err)
+		require.NoError(t, users.Put([]byte("bob"), []byte("2")))
+		require.NoError(t, users.Put([]byte("alice"), []byte("1")))
+		admins, err := users.CreateBucket([]byte("admins"))
+		require.NoError(t, err)
+		require.NoError(t, admins.Put([]byte("root"), []byte("0")))
+
+		_, err = tx.CreateBucket([]byte("users"))
+		require.ErrorIs(t, err, ErrBucketExists)
+		_, err = users.CreateBucket([]byte("bob"))
+		require.ErrorIs(t, err, ErrIncompatibleValue)
+		require.ErrorIs(t, users.Put([]byte("admins"), nil), ErrIncompatibleValue)
+		require.ErrorIs(t, users.Put(nil, nil), ErrKeyRequired)
+		_, err = tx.CreateBucketIfNotExists([]byte("users"))
+		require.NoError(t, err)
+		_, err = tx.CreateBucket([]byte("groups"))
+		return err
+	}))
+
+	require.NoError(t, db.View(func(tx *Tx) error {
+		require.False(t, tx.Writable())
+		users := tx.Bucket([]byte("users"))
+		require.NotNil(t, users)
+		require.Equal(t, []byte("1"), users.Get([]byte("alice")))
+		require.Nil(t, users.Get([]byte("carol")))
+		require.Nil(t, users.Get([]byte("admins")))
+		require.Nil(t, tx.Bucket([]byte("missing")))
+		require.Equal(t, []byte("0"), users.Bucket([]byte("admins")).Get([]byte("root")))
+		require.ErrorIs(t, users.Put([]byte("carol"), nil), ErrTxNotWritable)
+
+		// Nested buckets sort with the keys, with a nil value.
+		var got []kv
+		require.NoError(t, users.ForEach(func(k, v []byte) error {
+			got = append(got, kv{string(k), string(v)})
+			return nil
+		}))
+		require.Equal(t, []kv{{"admins", ""}, {"alice", "1"}, {"bob", "2"}}, got)
+
+		var names []string
+		require.NoError(t, tx.ForEach(func(name []byte, b *Bucket) error {
+			require.NotNil(t, b)
+			names = append(names, string(name))
+			return nil
+		}))
+		require.Equal(t, []string{"groups", "users"}, names)
+		return nil
+	}))
+
+	require.NoError(t, db.Update(func(tx *Tx) error {
+		require.NoError(t, tx.DeleteBucket([]byte("users")))
+		require.ErrorIs(t, tx.DeleteBucket([]byte("users")), ErrBucketNotFound)
+		return nil
+	}))
+	// Deleting a bucket removes everything under it, nested buckets included.
+	require.NoError(t, db.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: []byte("bolt/")})
+		defer it.Close()
+		var n int
+		for it.Rewind(); it.Valid(); it.Next() {
+			n++
+		}
+		require.Equal(t, 1, n) // The groups bucket.
+		return nil
+	}))
+}
+
+func TestCursor(t *testing.T) {
+	db := openDB(t)
+	require.NoError(t, db.Update(func(tx *Tx) error {
+		b, err := tx.CreateBucket([]byte("b"))
+		require.NoError(t, err)
+		for _, k := range []string{"a", "c", "e", "g"} {
+			require.NoError(t, b.Put([]byte(k), []byte(k+k)))
+		}
+		// An entry of a bucket created next must not show in b.
+		other, err := tx.CreateBucket([]byte("c"))
+		require.NoError(t, err)
+		return other.Put([]byte("z"), nil)
+	}))
+
+	require.NoError(t, db.Update(func(tx *Tx) error {
+		c := tx.Bucket([]byte("b")).Cursor()
+		require.Equal(t, []kv{{"a", "aa"}, {"c", "cc"}, {"e", "ee"}, {"g", "gg"}},
+			collect(c.First, c.Next))
+		require.Equal(t, []kv{{"g", "gg"}, {"e", "ee"}, {"c", "cc"}, {"a", "aa"}},
+			collect(c.Last, c.Prev))
+
+		k, v := c.Seek([]byte("d"))
+		require.Equal(t, "e", string(k))
+		require.Equal(t, "ee", string(v))
+		k, _ = c.Prev()
+		require.Equal(t, "c", string(k))
+		k, _ = c.Next()
+		require.Equal(t, "e", string(k))
+		k, _ = c.Seek([]byte("h"))
+		require.Nil(t, k)
+
+		// Deleting and writing while iterating.
+		b := c.Bucket()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			if k[0] == 'c' {
+				require.NoError(t, c.Delete())
+				require.NoError(t, b.Put([]byte("d"), []byte("dd")))
+			}
+		}
+		require.Equal(t, []kv{{"a", "aa"}, {"d", "dd"}, {"e", "ee"}, {"g", "gg"}},
+			collect(c.First, c.Next))
+
+		seq, err := b.NextSequence()
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), seq)
+		seq, err = b.NextSequence()
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), seq)
+		require.Equal(t, uint64(2), b.Sequence())
+		return nil
+	}))
+}
@@ -0,0 +1,465 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package cache is a size bounded cache with TTLs, persisted in a DB.
+//
+// Entries live under a namespace key prefix, and expire through the TTL of their DB entries.
+// The cache keeps an approximate size of every entry in memory, rebuilt by a key scan when it
+// is created, and evicts the least recently used entries once it holds more than
+// Options.MaxBytes. A new entry is only admitted over a victim if it was asked for more often
+// recently, as estimated by a count-min sketch, so that one-off keys don't push popular ones
+// out. Like groupcache, GetOrLoad runs a single load for concurrent misses of the same key.
+//
+// With Options.Loader and Options.Writer, the cache is a layer in front of a slower source:
+// GetThrough loads the keys missing from the source, and SetThrough and DeleteThrough write to
+// the source before the cache. The keys the source doesn't have are cached for
+// Options.NegativeTTL, so that misses don't reach it again meanwhile.
+//
+// The cache assumes it is the only writer of its namespace.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	badger "github.com/luxfi/zapdb"
+)
+
+var (
+	// ErrNotFound is returned by Get for missing and expired keys.
+	ErrNotFound = errors.New("cache: not found")
+	// ErrNoLoader is returned by GetThrough when Options.Loader isn't set.
+	ErrNoLoader = errors.New("cache: no loader")
+	// ErrNoWriter is returned by SetThrough and DeleteThrough when Options.Writer isn't set.
+	ErrNoWriter = errors.New("cache: no writer")
+)
+
+// errNegative is returned by get for the keys cached as missing from the source.
+var errNegative = errors.New("cache: negative entry")
+
+// negativeMeta is the user meta of the DB entries of the keys cached as missing from the source.
+const negativeMeta byte = 1 << 0
+
+// entryOverhead approximates the per-entry cost of a DB entry beyond its key and value.
+const entryOverhead = 32
+
+// Options configures a Cache.
+type Options struct {
+	// Namespace is the key prefix of the entries.
+	Namespace []byte
+	// MaxBytes bounds the approximate size of the entries. Zero means no bound.
+	MaxBytes int64
+	// DefaultTTL is the TTL of entries set with a zero TTL. Zero means no expiry.
+	DefaultTTL time.Duration
+	// ReapInterval is how often expired entries are dropped from the size accounting. Zero
+	// disables the background reaper; Reap can still be called by hand.
+	ReapInterval time.Duration
+	// NegativeTTL is how long a key a load returned ErrNotFound for is cached as missing. Zero
+	// doesn't cache missing keys.
+	NegativeTTL time.Duration
+	// Loader loads the keys missing from the cache for GetThrough.
+	Loader Loader
+	// Writer writes the keys set and deleted by SetThrough and DeleteThrough to the source.
+	Writer Writer
+}
+
+// Loader loads the values of keys from the source the cache is in front of.
+type Loader interface {
+	// Load returns the value of key, and the TTL to cache it for, zero for
+	// Options.DefaultTTL. It returns ErrNotFound if the source doesn't have key.
+	Load(ctx context.Context, key []byte) ([]byte, time.Duration, error)
+}
+
+// LoaderFunc is a function implementing Loader.
+type LoaderFunc func(ctx context.Context, key []byte) ([]byte, time.Duration, error)
+
+// Load calls f.
+func (f LoaderFunc) Load(ctx context.Context, key []byte) ([]byte, time.Duration, error) {
+	return f(ctx, key)
+}
+
+// Writer writes the values of keys to the source the cache is in front of.
+type Writer interface {
+	Write(ctx context.Context, key, value []byte) error
+	Delete(ctx context.Context, key []byte) error
+}
+
+// Stats are counters of a Cache.
+type Stats struct {
+	Entries    int
+	Bytes      int64
+	Hits       int64
+	Misses     int64
+	Evictions  int64
+	Rejections int64
+	// NegativeHits counts the lookups of keys cached as missing from the source.
+	NegativeHits int64
+}
+
+type entry struct {
+	key       string
+	size      int64
+	expiresAt uint64
+}
+
+func (e *entry) expired(now int64) bool {
+	return e.expiresAt != 0 && e.expiresAt <= uint64(now)
+}
+
+type call struct {
+	wg  sync.WaitGroup
+	val []byte
+	err error
+}
+
+// Cache is a persistent cache. It is safe for concurrent use.
+type Cache struct {
+	db  *badger.DB
+	opt Options
+
+	// mu guards the accounting below, and is held across writes to keep it exact.
+	mu      sync.Mutex
+	lru     *list.List // Of *entry, most recently used first.
+	entries map[string]*list.Element
+	used    int64
+	sketch  *sketch
+
+	loadMu   sync.Mutex
+	inflight map[string]*call
+
+	hits, misses, negativeHits, evictions, rejections atomic.Int64
+
+	closer    chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// New returns a Cache over the entries already stored under opt.Namespace.
+func New(db *badger.DB, opt Options) (*Cache, error) {
+	c := &Cache{
+		db:       db,
+		opt:      opt,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		inflight: make(map[string]*call),
+		closer:   make(chan struct{}),
+	}
+	c.opt.Namespace = append([]byte{}, opt.Namespace...)
+	err := db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: c.opt.Namespace})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			e := &entry{
+				key:       string(item.Key()[len(c.opt.Namespace):]),
+				size:      int64(len(item.Key())) + item.ValueSize() + entryOverhead,
+				expiresAt: item.ExpiresAt(),
+			}
+			c.entries[e.key] = c.lru.PushBack(e)
+			c.used += e.size
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.sketch = newSketch(max(1024, 2*len(c.entries)))
+	if opt.ReapInterval > 0 {
+		c.wg.Add(1)
+		go c.reapLoop()
+	}
+	return c, nil
+}
+
+// Close stops the reaper. The entries stay in the DB.
+func (c *Cache) Close() {
+	c.closeOnce.Do(func() { close(c.closer) })
+	c.wg.Wait()
+}
+
+func (c *Cache) dbKey(key string) []byte {
+	return append(append([]byte{}, c.opt.Namespace...), key...)
+}
+
+// remove drops e from the accounting. c.mu must be held.
+func (c *Cache) remove(elem *list.Element) {
+	e := c.lru.Remove(elem).(*entry)
+	delete(c.entries, e.key)
+	c.used -= e.size
+}
+
+// Get returns the value of key, or ErrNotFound.
+func (c *Cache) Get(key []byte) ([]byte, error) {
+	val, err := c.get(key)
+	if errors.Is(err, errNegative) {
+		return nil, ErrNotFound
+	}
+	return val, err
+}
+
+// get is Get, but returns errNegative for the keys cached as missing from the source.
+func (c *Cache) get(key []byte) ([]byte, error) {
+	c.mu.Lock()
+	c.sketch.increment(key)
+	elem, ok := c.entries[string(key)]
+	if ok && elem.Value.(*entry).expired(time.Now().Unix()) {
+		c.remove(elem)
+		ok = false
+	}
+	if !ok {
+		c.mu.Unlock()
+		c.misses.Add(1)
+		return nil, ErrNotFound
+	}
+	c.lru.MoveToFront(elem)
+	c.mu.Unlock()
+
+	var val []byte
+	err := c.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(c.dbKey(string(key)))
+		if err != nil {
+			return err
+		}
+		if item.UserMeta()&negativeMeta > 0 {
+			return errNegative
+		}
+		val, err = item.ValueCopy(nil)
+		return err
+	})
+	if errors.Is(err, errNegative) {
+		c.negativeHits.Add(1)
+		return nil, err
+	}
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		// The DB expired it first.
+		c.mu.Lock()
+		if elem, ok := c.entries[string(key)]; ok {
+			c.remove(elem)
+		}
+		c.mu.Unlock()
+		err = ErrNotFound
+	}
+	if err != nil {
+		c.misses.Add(1)
+		return nil, err
+	}
+	c.hits.Add(1)
+	return val, nil
+}
+
+// Set stores value under key for ttl, or Options.DefaultTTL if ttl is zero. If the cache is
+// full, the least recently used entries are evicted, unless key is less popular than them, in
+// which case the value is dropped and counted in Stats.Rejections.
+func (c *Cache) Set(key, value []byte, ttl time.Duration) error {
+	return c.set(key, value, ttl, 0)
+}
+
+// set is Set, storing the DB entry with userMeta.
+func (c *Cache) set(key, value []byte, ttl time.Duration, userMeta byte) error {
+	if ttl == 0 {
+		ttl = c.opt.DefaultTTL
+	}
+	e := &entry{key: string(key), size: int64(len(c.opt.Namespace)+len(key)+len(value)) + entryOverhead}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	old, exists := c.entries[e.key]
+	used := c.used + e.size
+	if exists {
+		used -= old.Value.(*entry).size
+	}
+	var victims []*list.Element
+	if c.opt.MaxBytes > 0 {
+		if e.size > c.opt.MaxBytes {
+			c.rejections.Add(1)
+			return nil
+		}
+		for elem := c.lru.Back(); elem != nil && used > c.opt.MaxBytes; elem = elem.Prev() {
+			if elem == old {
+				continue
+			}
+			victims = append(victims, elem)
+			used -= elem.Value.(*entry).size
+		}
+		// Updates are always admitted, as the key is cached already.
+		if len(victims) > 0 && !exists {
+			victim := []byte(victims[0].Value.(*entry).key)
+			if c.sketch.estimate(key) < c.sketch.estimate(victim) {
+				c.rejections.Add(1)
+				return nil
+			}
+		}
+	}
+
+	err := c.db.Update(func(txn *badger.Txn) error {
+		ent := badger.NewEntry(c.dbKey(e.key), value).WithMeta(userMeta)
+		if ttl > 0 {
+			ent = ent.WithTTL(ttl)
+		}
+		e.expiresAt = ent.ExpiresAt
+		if err := txn.SetEntry(ent); err != nil {
+			return err
+		}
+		for _, elem := range victims {
+			if err := txn.Delete(c.dbKey(elem.Value.(*entry).key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, elem := range victims {
+		c.remove(elem)
+	}
+	c.evictions.Add(int64(len(victims)))
+	if exists {
+		c.remove(old)
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.used += e.size
+	return nil
+}
+
+// GetOrLoad returns the value of key, calling load on a miss and caching what it returns.
+// Concurrent misses of the same key share a single call to load. If load returns ErrNotFound,
+// key is cached as missing for Options.NegativeTTL.
+func (c *Cache) GetOrLoad(key []byte, load func() ([]byte, time.Duration, error)) ([]byte, error) {
+	val, err := c.get(key)
+	switch {
+	case errors.Is(err, errNegative):
+		return nil, ErrNotFound
+	case !errors.Is(err, ErrNotFound):
+		return val, err
+	}
+
+	c.loadMu.Lock()
+	if cl, ok := c.inflight[string(key)]; ok {
+		c.loadMu.Unlock()
+		cl.wg.Wait()
+		return cl.val, cl.err
+	}
+	cl := &call{}
+	cl.wg.Add(1)
+	c.inflight[string(key)] = cl
+	c.loadMu.Unlock()
+
+	var ttl time.Duration
+	cl.val, ttl, cl.err = load()
+	switch {
+	case cl.err == nil:
+		cl.err = c.Set(key, cl.val, ttl)
+	case errors.Is(cl.err, ErrNotFound) && c.opt.NegativeTTL > 0:
+		if err := c.set(key, nil, c.opt.NegativeTTL, negativeMeta); err != nil {
+			cl.err = err
+		}
+	}
+	cl.wg.Done()
+
+	c.loadMu.Lock()
+	delete(c.inflight, string(key))
+	c.loadMu.Unlock()
+	return cl.val, cl.err
+}
+
+// GetThrough returns the value of key, loading it with Options.Loader on a miss. Concurrent
+// misses of the same key share a single load, with the ctx of the first of them. It returns
+// ErrNotFound if the source doesn't have key.
+func (c *Cache) GetThrough(ctx context.Context, key []byte) ([]byte, error) {
+	if c.opt.Loader == nil {
+		return nil, ErrNoLoader
+	}
+	return c.GetOrLoad(key, func() ([]byte, time.Duration, error) {
+		return c.opt.Loader.Load(ctx, key)
+	})
+}
+
+// SetThrough writes value under key to the source with Options.Writer, then to the cache for
+// ttl, like Set.
+func (c *Cache) SetThrough(ctx context.Context, key, value []byte, ttl time.Duration) error {
+	if c.opt.Writer == nil {
+		return ErrNoWriter
+	}
+	if err := c.opt.Writer.Write(ctx, key, value); err != nil {
+		return err
+	}
+	return c.Set(key, value, ttl)
+}
+
+// DeleteThrough deletes key from the source with Options.Writer, then from the cache.
+func (c *Cache) DeleteThrough(ctx context.Context, key []byte) error {
+	if c.opt.Writer == nil {
+		return ErrNoWriter
+	}
+	if err := c.opt.Writer.Delete(ctx, key); err != nil {
+		return err
+	}
+	return c.Delete(key)
+}
+
+// Delete removes key from the cache.
+func (c *Cache) Delete(key []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(c.dbKey(string(key)))
+	}); err != nil {
+		return err
+	}
+	if elem, ok := c.entries[string(key)]; ok {
+		c.remove(elem)
+	}
+	return nil
+}
+
+// Reap drops expired entries from the size accounting, and returns how many it dropped. The DB
+// stops returning them on its own, and removes them during compactions.
+func (c *Cache) Reap() int {
+	now := time.Now().Unix()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var n int
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		if elem.Value.(*entry).expired(now) {
+			c.remove(elem)
+			n++
+		}
+		elem = next
+	}
+	return n
+}
+
+func (c *Cache) reapLoop() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.opt.ReapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closer:
+			return
+		case <-ticker.C:
+			c.Reap()
+		}
+	}
+}
+
+// Stats returns the counters of the cache.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	s := Stats{Entries: len(c.entries), Bytes: c.used}
+	c.mu.Unlock()
+	s.Hits = c.hits.Load()
+	s.Misses = c.misses.Load()
+	s.NegativeHits = c.negativeHits.Load()
+	s.Evictions = c.evictions.Load()
+	s.Rejections = c.rejections.Load()
+	return s
+}
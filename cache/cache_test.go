@@ -0,0 +1,222 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	badger "github.com/luxfi/zapdb"
+	"github.com/luxfi/zapdb/testkit"
+)
+
+func TestCacheSetGet(t *testing.T) {
+	db := testkit.OpenInMemory(t)
+	c, err := New(db, Options{Namespace: []byte("c/")})
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Get([]byte("a"))
+	require.ErrorIs(t, err, ErrNotFound)
+	require.NoError(t, c.Set([]byte("a"), []byte("1"), 0))
+	require.NoError(t, c.Set([]byte("b"), []byte("2"), 0))
+	val, err := c.Get([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), val)
+	require.NoError(t, c.Delete([]byte("b")))
+	_, err = c.Get([]byte("b"))
+	require.ErrorIs(t, err, ErrNotFound)
+
+	s := c.Stats()
+	require.Equal(t, 1, s.Entries)
+	require.Equal(t, int64(1), s.Hits)
+	require.Equal(t, int64(2), s.Misses)
+
+	// A new Cache picks up the entries and their sizes from the DB.
+	c2, err := New(db, Options{Namespace: []byte("c/")})
+	require.NoError(t, err)
+	defer c2.Close()
+	require.Equal(t, s.Bytes, c2.Stats().Bytes)
+	val, err = c2.Get([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), val)
+}
+
+func TestCacheEviction(t *testing.T) {
+	db := testkit.OpenInMemory(t)
+	value := make([]byte, 100)
+	size := int64(len("c/k0")+len(value)) + entryOverhead
+	c, err := New(db, Options{Namespace: []byte("c/"), MaxBytes: 3 * size})
+	require.NoError(t, err)
+	defer c.Close()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, c.Set([]byte(fmt.Sprintf("k%d", i)), value, 0))
+	}
+	// k0 is the most popular, and the most recently used.
+	for i := 0; i < 3; i++ {
+		_, err := c.Get([]byte("k0"))
+		require.NoError(t, err)
+	}
+	_, err = c.Get([]byte("k1"))
+	require.NoError(t, err)
+
+	// k2 was never read, so k3 displaces it once asked for.
+	_, _ = c.Get([]byte("k3"))
+	require.NoError(t, c.Set([]byte("k3"), value, 0))
+	_, err = c.Get([]byte("k2"))
+	require.ErrorIs(t, err, ErrNotFound, "the least recently used entry is evicted")
+	for _, k := range []string{"k0", "k1", "k3"} {
+		_, err := c.Get([]byte(k))
+		require.NoError(t, err, k)
+	}
+	require.Equal(t, int64(1), c.Stats().Evictions)
+	require.Equal(t, 3*size, c.Stats().Bytes)
+
+	// k4 was never asked for, and k0 to k3 were, so it is rejected.
+	require.NoError(t, c.Set([]byte("k4"), value, 0))
+	_, err = c.Get([]byte("k4"))
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Equal(t, int64(1), c.Stats().Rejections)
+
+	// The eviction was persisted.
+	require.NoError(t, db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte("c/k2"))
+		require.ErrorIs(t, err, badger.ErrKeyNotFound)
+		return nil
+	}))
+}
+
+func TestCacheTTL(t *testing.T) {
+	db := testkit.OpenInMemory(t)
+	c, err := New(db, Options{
+		Namespace: []byte("c/"), DefaultTTL: time.Second, ReapInterval: 50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.Set([]byte("short"), []byte("1"), 0))
+	require.NoError(t, c.Set([]byte("long"), []byte("2"), time.Hour))
+	_, err = c.Get([]byte("short"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return c.Stats().Entries == 1 }, 5*time.Second,
+		50*time.Millisecond)
+	_, err = c.Get([]byte("short"))
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = c.Get([]byte("long"))
+	require.NoError(t, err)
+}
+
+func TestCacheGetOrLoad(t *testing.T) {
+	db := testkit.OpenInMemory(t)
+	c, err := New(db, Options{Namespace: []byte("c/")})
+	require.NoError(t, err)
+	defer c.Close()
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func() ([]byte, time.Duration, error) {
+		loads.Add(1)
+		<-release
+		return []byte("loaded"), 0, nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			val, err := c.GetOrLoad([]byte("k"), load)
+			require.NoError(t, err)
+			require.Equal(t, []byte("loaded"), val)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	require.Equal(t, int32(1), loads.Load())
+
+	// Once loaded, the value comes from the cache.
+	before := loads.Load()
+	val, err := c.GetOrLoad([]byte("k"), load)
+	require.NoError(t, err)
+	require.Equal(t, []byte("loaded"), val)
+	require.Equal(t, before, loads.Load())
+}
+
+type source struct {
+	vals  map[string]string
+	loads atomic.Int32
+}
+
+func (s *source) Load(_ context.Context, key []byte) ([]byte, time.Duration, error) {
+	s.loads.Add(1)
+	val, ok := s.vals[string(key)]
+	if !ok {
+		return nil, 0, ErrNotFound
+	}
+	return []byte(val), 0, nil
+}
+
+func (s *source) Write(_ context.Context, key, value []byte) error {
+	s.vals[string(key)] = string(value)
+	return nil
+}
+
+func (s *source) Delete(_ context.Context, key []byte) error {
+	delete(s.vals, string(key))
+	return nil
+}
+
+func TestCacheThrough(t *testing.T) {
+	db := testkit.OpenInMemory(t)
+	src := &source{vals: map[string]string{"a": "1"}}
+	c, err := New(db, Options{Namespace: []byte("c/"), NegativeTTL: time.Hour, Loader: src,
+		Writer: src})
+	require.NoError(t, err)
+	defer c.Close()
+
+	val, err := c.GetThrough(context.Background(), []byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), val)
+	_, err = c.GetThrough(context.Background(), []byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, int32(1), src.loads.Load())
+
+	// A key missing from the source is cached as missing.
+	for range 2 {
+		_, err = c.GetThrough(context.Background(), []byte("b"))
+		require.ErrorIs(t, err, ErrNotFound)
+	}
+	require.Equal(t, int32(2), src.loads.Load())
+	_, err = c.Get([]byte("b"))
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Equal(t, int64(2), c.Stats().NegativeHits)
+
+	// Writes go to the source, then to the cache.
+	require.NoError(t, c.SetThrough(context.Background(), []byte("b"), []byte("2"), 0))
+	require.Equal(t, "2", src.vals["b"])
+	val, err = c.Get([]byte("b"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("2"), val)
+	require.NoError(t, c.DeleteThrough(context.Background(), []byte("a")))
+	require.NotContains(t, src.vals, "a")
+	_, err = c.Get([]byte("a"))
+	require.ErrorIs(t, err, ErrNotFound)
+
+	c2, err := New(db, Options{Namespace: []byte("c2/")})
+	require.NoError(t, err)
+	defer c2.Close()
+	_, err = c2.GetThrough(context.Background(), []byte("a"))
+	require.ErrorIs(t, err, ErrNoLoader)
+	require.ErrorIs(t, c2.DeleteThrough(context.Background(), []byte("a")), ErrNoWriter)
+}
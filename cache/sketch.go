@@ -0,0 +1,63 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package cache
+
+import "github.com/cespare/xxhash/v2"
+
+const sketchDepth = 4
+
+// sketch is a count-min sketch estimating how often keys were accessed recently. Counters
+// saturate at 255, and are halved once the number of increments reaches ten times the width,
+// so that old popularity fades.
+type sketch struct {
+	rows  [sketchDepth][]uint8
+	mask  uint64
+	adds  int
+	reset int
+}
+
+func newSketch(width int) *sketch {
+	w := 64
+	for w < width {
+		w <<= 1
+	}
+	s := &sketch{mask: uint64(w - 1), reset: 10 * w}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, w)
+	}
+	return s
+}
+
+func (s *sketch) index(h uint64, row int) uint64 {
+	// Derive the row hashes from two halves of one hash.
+	return (h + uint64(row)*(h>>32|1)) & s.mask
+}
+
+func (s *sketch) increment(key []byte) {
+	h := xxhash.Sum64(key)
+	for i := range s.rows {
+		if c := &s.rows[i][s.index(h, i)]; *c < 255 {
+			*c++
+		}
+	}
+	if s.adds++; s.adds >= s.reset {
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] >>= 1
+			}
+		}
+		s.adds /= 2
+	}
+}
+
+func (s *sketch) estimate(key []byte) uint8 {
+	h := xxhash.Sum64(key)
+	est := uint8(255)
+	for i := range s.rows {
+		est = min(est, s.rows[i][s.index(h, i)])
+	}
+	return est
+}
@@ -0,0 +1,234 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"context"
+	"sort"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+
+	"github.com/luxfi/zapdb/pb"
+	"github.com/luxfi/zapdb/trie"
+	"github.com/luxfi/zapdb/y"
+)
+
+// changefeedBatchSize is the number of KVs passed to the callback of Changefeed at most, unless
+// a single commit has more.
+const changefeedBatchSize = 1000
+
+// Changefeed calls cb with the committed versions of the keys matching matches, in the order of
+// their commits, from the first commit after sinceVersion on. The versions kept by the DB are
+// replayed first, then the new commits are passed as they are made. It blocks until ctx is done,
+// the DB is closed, or cb returns an error.
+//
+// Each KVList holds the versions written by one or more whole commits, with ascending versions,
+// and the keys of a commit in order, preceded by its metadata if set, see CommitMetadata. A
+// deleted key has a KV with bit 0 of Meta set, and no value. The version of the last KV handled
+// is the cursor to resume from with sinceVersion, after a restart as well, so that downstream
+// indexes or queues can be fed exactly once if they store it with what they derive from the KVs.
+//
+// The commits replayed are those whose versions the DB keeps: overwritten versions are discarded
+// past NumVersionsToKeep, and the deletes of keys past the last level. A range deleted by
+// Txn.DeleteRange has a delete of each key it deleted whose versions the DB still keeps, and the
+// versions it deleted before they were fed are skipped. A VersionGC, such as
+// VersionGCByAge, keeps the versions a consumer may still resume from.
+//
+// Changefeed can't be used in managed mode.
+func (db *DB) Changefeed(ctx context.Context, sinceVersion uint64, matches []pb.Match,
+	cb func(kv *KVList) error) error {
+	if cb == nil {
+		return ErrNilCallback
+	}
+	if db.opt.managedTxns {
+		return ErrManagedTxn
+	}
+	filter := trie.NewTrie()
+	for _, m := range matches {
+		if err := filter.AddMatch(m, 0); err != nil {
+			return y.Wrapf(err, "while creating the changefeed")
+		}
+	}
+
+	// The subscriber wakes the changefeed up once the DB is written to.
+	c := z.NewCloser(1)
+	s, err := db.pub.newSubscriber(c, matches)
+	if err != nil {
+		return y.Wrapf(err, "while creating a new subscriber")
+	}
+	drain := func() {
+		for {
+			select {
+			case _, ok := <-s.sendCh:
+				if !ok {
+					return
+				}
+			default:
+				return
+			}
+		}
+	}
+	stop := func() {
+		c.Done()
+		s.active.Store(0)
+		drain()
+		db.pub.deleteSubscriber(s.id)
+	}
+
+	cursor := sinceVersion
+	for {
+		// The commits written while feeding are fed by the next pass.
+		drain()
+		if cursor, err = db.feedChanges(filter, cursor, cb); err != nil {
+			stop()
+			return err
+		}
+		select {
+		case <-c.HasBeenClosed():
+			// The subscriber is deleted by cleanSubscribers.
+			c.Done()
+			return nil
+		case <-ctx.Done():
+			stop()
+			return ctx.Err()
+		case <-s.sendCh:
+		}
+	}
+}
+
+// feedChanges passes the versions of the keys matching filter committed after since to cb, and
+// returns the version of the last of them, or since if there is none.
+func (db *DB) feedChanges(filter *trie.Trie, since uint64, cb func(kv *KVList) error) (
+	uint64, error) {
+	txn := db.NewTransaction(false)
+	defer txn.Discard()
+	opt := DefaultIteratorOptions
+	opt.AllVersions = true
+	opt.PrefetchValues = false
+	opt.SinceTs = since
+	it := txn.NewIterator(opt)
+	defer it.Close()
+
+	var kvs []*pb.KV
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		if len(filter.Get(item.Key())) == 0 {
+			continue
+		}
+		kv := &pb.KV{
+			Key:       item.KeyCopy(nil),
+			UserMeta:  []byte{item.UserMeta()},
+			Version:   item.Version(),
+			ExpiresAt: item.ExpiresAt(),
+		}
+		if item.meta&bitDelete > 0 {
+			kv.Meta = []byte{bitDelete}
+		} else {
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return since, err
+			}
+			kv.Value = val
+		}
+		kvs = append(kvs, kv)
+	}
+	// The versions deleted by a range tombstone aren't read, and the keys it deletes have a delete
+	// at its version instead.
+	for _, t := range txn.rangeTombstonesSince(since, nil) {
+		kvs = append(kvs, db.rangeDeletes(t, filter)...)
+	}
+	if len(kvs) > 0 {
+		metas, err := commitMetadataSince(txn, since, kvs)
+		if err != nil {
+			return since, err
+		}
+		kvs = append(kvs, metas...)
+	}
+	sort.Slice(kvs, func(i, j int) bool {
+		if kvs[i].Version != kvs[j].Version {
+			return kvs[i].Version < kvs[j].Version
+		}
+		// The metadata of a commit precedes its KVs.
+		if mi, mj := bytes.Equal(kvs[i].Key, commitMetadataKey),
+			bytes.Equal(kvs[j].Key, commitMetadataKey); mi != mj {
+			return mi
+		}
+		return bytes.Compare(kvs[i].Key, kvs[j].Key) < 0
+	})
+
+	for len(kvs) > 0 {
+		// A batch ends at the end of a commit.
+		n := min(len(kvs), changefeedBatchSize)
+		for n < len(kvs) && kvs[n].Version == kvs[n-1].Version {
+			n++
+		}
+		if err := cb(&pb.KVList{Kv: kvs[:n]}); err != nil {
+			return since, err
+		}
+		since = kvs[n-1].Version
+		kvs = kvs[n:]
+	}
+	return since, nil
+}
+
+// rangeDeletes returns a delete, at the version of t, of each key matching filter which t deletes,
+// read as of before t.
+func (db *DB) rangeDeletes(t rangeTombstone, filter *trie.Trie) []*pb.KV {
+	txn := db.newTransaction(false, true)
+	txn.readTs = t.version - 1
+	txn.doneRead = true
+	defer txn.Discard()
+	opt := DefaultIteratorOptions
+	opt.PrefetchValues = false
+	it := txn.NewIterator(opt)
+	defer it.Close()
+
+	var kvs []*pb.KV
+	for it.Seek(t.start); it.Valid(); it.Next() {
+		item := it.Item()
+		if bytes.Compare(item.Key(), t.end) >= 0 {
+			break
+		}
+		if !t.deletes(item.Key()) || len(filter.Get(item.Key())) == 0 {
+			continue
+		}
+		kvs = append(kvs, &pb.KV{
+			Key:      item.KeyCopy(nil),
+			UserMeta: []byte{0},
+			Version:  t.version,
+			Meta:     []byte{bitDelete},
+		})
+	}
+	return kvs
+}
+
+// commitMetadataSince returns the metadata of the commits after since of the versions of kvs.
+func commitMetadataSince(txn *Txn, since uint64, kvs []*pb.KV) ([]*pb.KV, error) {
+	versions := make(map[uint64]struct{}, len(kvs))
+	for _, kv := range kvs {
+		versions[kv.Version] = struct{}{}
+	}
+	opt := DefaultIteratorOptions
+	opt.InternalAccess = true
+	opt.SinceTs = since
+	it := txn.NewKeyIterator(commitMetadataKey, opt)
+	defer it.Close()
+
+	var metas []*pb.KV
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		if _, ok := versions[item.Version()]; !ok || item.IsDeletedOrExpired() {
+			continue
+		}
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		metas = append(metas, &pb.KV{Key: commitMetadataKey, Value: val, Version: item.Version()})
+	}
+	return metas, nil
+}
@@ -0,0 +1,170 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/pb"
+)
+
+func TestChangefeed(t *testing.T) {
+	dir := t.TempDir()
+	opt := getTestOptions(dir).WithNumVersionsToKeep(10)
+	db, err := Open(opt)
+	require.NoError(t, err)
+
+	set := func(db *DB, key, val string) {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Set([]byte(key), []byte(val))
+		}))
+	}
+	set(db, "a/1", "v1")
+	set(db, "b/1", "skipped")
+	set(db, "a/1", "v2")
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.Delete([]byte("a/1"))
+	}))
+	require.NoError(t, db.Close())
+
+	// The commits kept are replayed after a restart, then the new ones are fed as they're made.
+	db, err = Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	type change struct {
+		key, val string
+		deleted  bool
+	}
+	got := make(chan change, 100)
+	var cursor uint64
+	done := make(chan error)
+	go func() {
+		done <- db.Changefeed(ctx, 0, []pb.Match{{Prefix: []byte("a/")}}, func(kvs *KVList) error {
+			for _, kv := range kvs.Kv {
+				require.Greater(t, kv.Version, cursor)
+				cursor = kv.Version
+				got <- change{string(kv.Key), string(kv.Value), len(kv.Meta) > 0 && kv.Meta[0]&bitDelete > 0}
+			}
+			return nil
+		})
+	}()
+	next := func() change {
+		select {
+		case c := <-got:
+			return c
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for changefeed")
+		}
+		return change{}
+	}
+	require.Equal(t, change{key: "a/1", val: "v1"}, next())
+	require.Equal(t, change{key: "a/1", val: "v2"}, next())
+	require.Equal(t, change{key: "a/1", deleted: true}, next())
+	for i := range 3 {
+		set(db, fmt.Sprintf("a/%d", i), "live")
+		require.Equal(t, change{key: fmt.Sprintf("a/%d", i), val: "live"}, next())
+	}
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+
+	// Resuming from the cursor feeds the later commits only.
+	set(db, "a/9", "after")
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		done <- db.Changefeed(ctx, cursor, []pb.Match{{Prefix: []byte("a/")}}, func(kvs *KVList) error {
+			for _, kv := range kvs.Kv {
+				got <- change{key: string(kv.Key), val: string(kv.Value)}
+			}
+			return nil
+		})
+	}()
+	require.Equal(t, change{key: "a/9", val: "after"}, next())
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestCommitMetadata(t *testing.T) {
+	opt := getTestOptions(t.TempDir()).WithNumVersionsToKeep(10)
+	db, err := Open(opt)
+	require.NoError(t, err)
+
+	type change struct{ key, val, meta string }
+	// collect turns the KVs of a list into changes, with the metadata of their commits.
+	collect := func(kvs *KVList) []change {
+		var out []change
+		metas := make(map[uint64]string)
+		for _, kv := range kvs.Kv {
+			if m, ok := CommitMetadata(kv); ok {
+				metas[kv.Version] = string(m)
+				continue
+			}
+			out = append(out, change{string(kv.Key), string(kv.Value), metas[kv.Version]})
+		}
+		return out
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	got := make(chan change, 10)
+	subscribed := make(chan error)
+	go func() {
+		subscribed <- db.Subscribe(ctx, func(kvs *KVList) error {
+			for _, c := range collect(kvs) {
+				got <- c
+			}
+			return nil
+		}, []pb.Match{{Prefix: []byte("a/")}})
+	}()
+	require.Eventually(t, func() bool {
+		db.pub.Lock()
+		defer db.pub.Unlock()
+		return len(db.pub.subscribers) == 1
+	}, 5*time.Second, time.Millisecond)
+
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		require.NoError(t, txn.SetCommitMetadata([]byte("first")))
+		require.NoError(t, txn.SetCommitMetadata([]byte("req-1")))
+		return txn.Set([]byte("a/1"), []byte("v1"))
+	}))
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.Set([]byte("a/2"), []byte("v2"))
+	}))
+	require.Equal(t, change{"a/1", "v1", "req-1"}, <-got)
+	require.Equal(t, change{"a/2", "v2", ""}, <-got)
+	cancel()
+	require.ErrorIs(t, <-subscribed, context.Canceled)
+
+	// The metadata isn't iterated as a key, and is replayed by Changefeed after a restart.
+	require.NoError(t, db.View(func(txn *Txn) error {
+		it := txn.NewIterator(DefaultIteratorOptions)
+		defer it.Close()
+		var keys []string
+		for it.Rewind(); it.Valid(); it.Next() {
+			keys = append(keys, string(it.Item().Key()))
+		}
+		require.Equal(t, []string{"a/1", "a/2"}, keys)
+		return nil
+	}))
+	require.NoError(t, db.Close())
+	db, err = Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	err = db.Changefeed(ctx, 0, []pb.Match{{Prefix: []byte("a/")}}, func(kvs *KVList) error {
+		require.Equal(t, []change{{"a/1", "v1", "req-1"}, {"a/2", "v2", ""}}, collect(kvs))
+		cancel()
+		return nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,219 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/luxfi/zapdb/table"
+	"github.com/luxfi/zapdb/y"
+)
+
+// Checkpoint writes a copy of the DB, as of the time it is called, into dir, which must not exist.
+// The copy can be opened like any other DB, with the same options. Tables and value log files are
+// immutable once written, so they are hard linked into dir, unless dir is on another file system;
+// only the value log file being written is copied. The memtable is flushed first, so that the
+// copy doesn't need the write-ahead log.
+//
+// Writes continue while the checkpoint is taken, and are left out of it. The directories of the
+// checkpoint are both dir, even if the DB has a separate ValueDir.
+func (db *DB) Checkpoint(dir string) (err error) {
+	if db.opt.InMemory {
+		return ErrCheckpointInMemoryMode
+	}
+	if db.opt.ReadOnly {
+		return errors.New("Cannot checkpoint a DB opened in ReadOnly mode")
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return fmt.Errorf("Checkpoint directory %q already exists", dir)
+	} else if !os.IsNotExist(err) {
+		return y.Wrapf(err, "while checking checkpoint directory %q", dir)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return y.Wrapf(err, "while creating checkpoint directory %q", dir)
+	}
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(dir)
+		}
+	}()
+
+	if err := db.flushMemTableForCheckpoint(); err != nil {
+		return err
+	}
+
+	// The value log GC deletes a file once its entries have been moved to the memtable. Holding
+	// filesLock from before the tables are linked until the value log files are keeps every file
+	// the tables point to.
+	db.vlog.filesLock.RLock()
+	manifest, err := db.linkTables(dir)
+	if err != nil {
+		db.vlog.filesLock.RUnlock()
+		return err
+	}
+	active, offset, err := db.linkValueLogFiles(dir)
+	db.vlog.filesLock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if active != "" {
+		if err := copyActiveValueLogFile(active, offset); err != nil {
+			return err
+		}
+	}
+	fp, _, err := helpRewrite(dir, &manifest, db.opt.ExternalMagicVersion)
+	if err != nil {
+		return y.Wrapf(err, "while writing checkpoint manifest")
+	}
+	if err := fp.Close(); err != nil {
+		return err
+	}
+	registry := filepath.Join(db.opt.Dir, KeyRegistryFileName)
+	if _, err := os.Stat(registry); err == nil {
+		if err := copyFile(registry, filepath.Join(dir, KeyRegistryFileName), -1); err != nil {
+			return y.Wrapf(err, "while copying key registry")
+		}
+	}
+	return syncDir(dir)
+}
+
+// flushMemTableForCheckpoint has the writer hand the memtable to the flusher, and waits until it
+// and the ones before it are flushed to level 0. Writes go on to a new memtable meanwhile.
+func (db *DB) flushMemTableForCheckpoint() error {
+	if db.IsClosed() {
+		return ErrDBClosed
+	}
+	req := requestPool.Get().(*request)
+	req.reset()
+	req.rotate = flushCauseManual
+	req.Wg.Add(1)
+	req.IncrRef()
+	db.writeCh <- req
+	req.Wg.Wait()
+	mt, err := req.rotated, req.Err
+	req.DecrRef()
+	if err != nil || mt == nil {
+		return err
+	}
+
+	// Memtables are flushed in order, so mt is the last of db.imm until it is flushed.
+	for {
+		db.lock.RLock()
+		flushed := len(db.imm) == 0 || db.imm[len(db.imm)-1] != mt
+		db.lock.RUnlock()
+		if flushed {
+			return nil
+		}
+		if db.IsClosed() {
+			return ErrDBClosed
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// linkTables links the tables of the manifest into dir, and returns a copy of the manifest. The
+// tables in Options.RemoteTableStore are downloaded. The manifest lock keeps the tables from being
+// deleted meanwhile.
+func (db *DB) linkTables(dir string) (Manifest, error) {
+	mf := db.manifest
+	mf.appendLock.Lock()
+	defer mf.appendLock.Unlock()
+
+	for id, tm := range mf.manifest.Tables {
+		dst := table.NewFilename(id, dir)
+		var err error
+		if tm.Remote {
+			err = downloadTable(db.opt.RemoteTableStore, id, dst)
+		} else {
+			err = linkOrCopy(table.NewFilename(id, db.tableDir(tm.Cold)), dst)
+		}
+		if err != nil {
+			return Manifest{}, y.Wrapf(err, "while linking table %d", id)
+		}
+	}
+	// The checkpoint holds every table in dir.
+	ret := mf.manifest.clone(db.opt)
+	for id, tm := range ret.Tables {
+		tm.Cold, tm.Remote = false, false
+		ret.Tables[id] = tm
+	}
+	return ret, nil
+}
+
+// linkValueLogFiles links the value log files, but the one being written, into dir. It returns
+// the path of the one being written and the length of its data, to be copied by
+// copyActiveValueLogFile. Must be called with vlog.filesLock held.
+func (db *DB) linkValueLogFiles(dir string) (string, uint32, error) {
+	vlog := &db.vlog
+	for fid, lf := range vlog.filesMap {
+		if fid == vlog.maxFid {
+			continue
+		}
+		if err := linkOrCopy(lf.path, vlogFilePath(dir, fid)); err != nil {
+			return "", 0, y.Wrapf(err, "while linking value log file %d", fid)
+		}
+	}
+	lf, ok := vlog.filesMap[vlog.maxFid]
+	if !ok {
+		return "", 0, nil
+	}
+	// Link it under another name, so that it outlives a deletion while it is copied.
+	tmp := vlogFilePath(dir, vlog.maxFid) + ".tmp"
+	if err := linkOrCopy(lf.path, tmp); err != nil {
+		return "", 0, y.Wrapf(err, "while linking value log file %d", vlog.maxFid)
+	}
+	return tmp, vlog.woffset(), nil
+}
+
+// copyActiveValueLogFile copies the first offset bytes of the link made by linkValueLogFiles to
+// the value log file it stands for, and removes the link.
+func copyActiveValueLogFile(tmp string, offset uint32) error {
+	path := tmp[:len(tmp)-len(".tmp")]
+	if err := copyFile(tmp, path, int64(offset)); err != nil {
+		return y.Wrapf(err, "while copying value log file %s", path)
+	}
+	return os.Remove(tmp)
+}
+
+// linkOrCopy hard links src to dst, or copies it if they are on different file systems.
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	return copyFile(src, dst, -1)
+}
+
+// copyFile copies the first n bytes of src, or all of it if n is negative, to a new file dst.
+func copyFile(src, dst string, n int64) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	var r io.Reader = in
+	if n >= 0 {
+		r = io.LimitReader(in, n)
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
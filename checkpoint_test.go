@@ -0,0 +1,106 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir, err := os.MkdirTemp("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	// Large values go to the value log, and small ones stay in the tables.
+	opt := getTestOptions(dir).WithValueThreshold(64).WithValueLogFileSize(1 << 20)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	val := func(i int) []byte {
+		if i%2 == 0 {
+			return []byte(fmt.Sprintf("small%d", i))
+		}
+		return bytes.Repeat([]byte(fmt.Sprintf("%08d", i)), 32)
+	}
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key%08d", i)) }
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Set(key(i), val(i))
+		}))
+	}
+
+	// Keys are written in order while the checkpoint is taken: it holds a prefix of them.
+	var written atomic.Int64
+	written.Store(1000)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1000; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			require.NoError(t, db.Update(func(txn *Txn) error {
+				return txn.Set(key(i), val(i))
+			}))
+			written.Add(1)
+		}
+	}()
+	for written.Load() < 2000 {
+	}
+	cpDir := filepath.Join(dir, "checkpoint")
+	before := int(written.Load())
+	require.NoError(t, db.Checkpoint(cpDir))
+	close(stop)
+	wg.Wait()
+	require.Error(t, db.Checkpoint(cpDir))
+
+	cp, err := Open(getTestOptions(cpDir))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, cp.Close()) }()
+	var n int
+	require.NoError(t, cp.View(func(txn *Txn) error {
+		it := txn.NewIterator(DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			require.Equal(t, key(n), it.Item().Key())
+			require.Equal(t, val(n), getItemValue(t, it.Item()))
+			n++
+		}
+		return nil
+	}))
+	require.GreaterOrEqual(t, n, before)
+	require.Less(t, n, int(written.Load()))
+
+	// The checkpoint and the DB are independent.
+	require.NoError(t, cp.Update(func(txn *Txn) error {
+		return txn.Set([]byte("cp"), []byte("val"))
+	}))
+	require.NoError(t, db.View(func(txn *Txn) error {
+		_, err := txn.Get([]byte("cp"))
+		require.ErrorIs(t, err, ErrKeyNotFound)
+		return nil
+	}))
+}
+
+func TestCheckpointInMemory(t *testing.T) {
+	db, err := Open(DefaultOptions("").WithInMemory(true))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	require.ErrorIs(t, db.Checkpoint(t.TempDir()), ErrCheckpointInMemoryMode)
+}
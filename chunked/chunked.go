@@ -0,0 +1,150 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package chunked stores values larger than Options.MaxValueSize by splitting them into chunks.
+//
+// The value stored under the key is a small header recording the total size and the number of
+// chunks. Chunk i is stored under the key followed by "\x00chunk\x00" and i as a big-endian
+// uint32, so those keys must not be used for anything else. Keys written with plain Set are
+// returned as they are by Get, so callers can switch to chunked values without migrating
+// existing data.
+//
+// A large value usually doesn't fit into a single transaction, in which case pass a
+// badger.WriteBatch to Set.
+package chunked
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	badger "github.com/luxfi/zapdb"
+)
+
+// ErrCorrupt is returned by Get if a chunk is missing or doesn't match the header.
+var ErrCorrupt = errors.New("chunked: value is corrupt")
+
+var magic = []byte("\x00chunked")
+
+const headerSize = 8 + 8 + 4 + 4 // magic, size, number of chunks, chunk size.
+
+// Writer is implemented by both badger.Txn and badger.WriteBatch.
+type Writer interface {
+	SetEntry(e *badger.Entry) error
+}
+
+// ChunkKey returns the key under which chunk i of key is stored.
+func ChunkKey(key []byte, i uint32) []byte {
+	out := make([]byte, 0, len(key)+7+4)
+	out = append(out, key...)
+	out = append(out, "\x00chunk\x00"...)
+	return binary.BigEndian.AppendUint32(out, i)
+}
+
+type header struct {
+	size      uint64
+	chunks    uint32
+	chunkSize uint32
+}
+
+func (h header) encode() []byte {
+	buf := make([]byte, headerSize)
+	copy(buf, magic)
+	binary.BigEndian.PutUint64(buf[8:], h.size)
+	binary.BigEndian.PutUint32(buf[16:], h.chunks)
+	binary.BigEndian.PutUint32(buf[20:], h.chunkSize)
+	return buf
+}
+
+func decodeHeader(buf []byte) (header, bool) {
+	if len(buf) != headerSize || !bytes.HasPrefix(buf, magic) {
+		return header{}, false
+	}
+	return header{
+		size:      binary.BigEndian.Uint64(buf[8:]),
+		chunks:    binary.BigEndian.Uint32(buf[16:]),
+		chunkSize: binary.BigEndian.Uint32(buf[20:]),
+	}, true
+}
+
+// Set writes value under key as chunks of at most chunkSize bytes. chunkSize must not be more
+// than Options.MaxValueSize. Chunks of an earlier, longer value under the same key are left
+// behind, so call Delete first when overwriting.
+func Set(w Writer, key, value []byte, chunkSize int) error {
+	if chunkSize <= 0 {
+		return fmt.Errorf("chunked: invalid chunk size %d", chunkSize)
+	}
+	h := header{size: uint64(len(value)), chunkSize: uint32(chunkSize)}
+	for off := 0; off < len(value); off += chunkSize {
+		end := min(off+chunkSize, len(value))
+		if err := w.SetEntry(badger.NewEntry(ChunkKey(key, h.chunks), value[off:end])); err != nil {
+			return err
+		}
+		h.chunks++
+	}
+	// The header goes last, so that a reader never sees it before all of its chunks.
+	return w.SetEntry(badger.NewEntry(key, h.encode()))
+}
+
+// Get returns the value of key, joining its chunks if it was written by Set.
+func Get(txn *badger.Txn, key []byte) ([]byte, error) {
+	item, err := txn.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	val, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+	h, ok := decodeHeader(val)
+	if !ok {
+		return val, nil
+	}
+	out := make([]byte, 0, h.size)
+	for i := uint32(0); i < h.chunks; i++ {
+		item, err := txn.Get(ChunkKey(key, i))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, fmt.Errorf("%w: chunk %d of %q is missing", ErrCorrupt, i, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := item.Value(func(val []byte) error {
+			out = append(out, val...)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if uint64(len(out)) != h.size {
+		return nil, fmt.Errorf("%w: %q has %d bytes, want %d", ErrCorrupt, key, len(out), h.size)
+	}
+	return out, nil
+}
+
+// Delete removes key and all of its chunks.
+func Delete(txn *badger.Txn, key []byte) error {
+	item, err := txn.Get(key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var h header
+	if err := item.Value(func(val []byte) error {
+		h, _ = decodeHeader(val)
+		return nil
+	}); err != nil {
+		return err
+	}
+	for i := uint32(0); i < h.chunks; i++ {
+		if err := txn.Delete(ChunkKey(key, i)); err != nil {
+			return err
+		}
+	}
+	return txn.Delete(key)
+}
@@ -0,0 +1,72 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chunked
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	badger "github.com/luxfi/zapdb"
+)
+
+func TestChunked(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).
+		WithMaxValueSize(1 << 10).WithLogger(nil))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	big := bytes.Repeat([]byte("0123456789"), 1000)
+	key := []byte("big")
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		require.ErrorIs(t, txn.Set(key, big), badger.ErrValueTooLarge)
+		return nil
+	}))
+
+	wb := db.NewWriteBatch()
+	require.NoError(t, Set(wb, key, big, 1<<10))
+	require.NoError(t, wb.Flush())
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		require.NoError(t, Set(txn, []byte("empty"), nil, 1<<10))
+		return txn.Set([]byte("plain"), []byte("value"))
+	}))
+
+	require.NoError(t, db.View(func(txn *badger.Txn) error {
+		got, err := Get(txn, key)
+		require.NoError(t, err)
+		require.Equal(t, big, got)
+
+		got, err = Get(txn, []byte("empty"))
+		require.NoError(t, err)
+		require.Empty(t, got)
+
+		got, err = Get(txn, []byte("plain"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("value"), got)
+		return nil
+	}))
+
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(ChunkKey(key, 3))
+	}))
+	require.NoError(t, db.View(func(txn *badger.Txn) error {
+		_, err := Get(txn, key)
+		require.ErrorIs(t, err, ErrCorrupt)
+		return nil
+	}))
+
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		return Delete(txn, key)
+	}))
+	require.NoError(t, db.View(func(txn *badger.Txn) error {
+		_, err := Get(txn, key)
+		require.ErrorIs(t, err, badger.ErrKeyNotFound)
+		_, err = txn.Get(ChunkKey(key, 0))
+		require.ErrorIs(t, err, badger.ErrKeyNotFound)
+		return nil
+	}))
+}
@@ -0,0 +1,251 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+
+	"github.com/luxfi/zapdb/pb"
+	"github.com/luxfi/zapdb/table"
+	"github.com/luxfi/zapdb/y"
+)
+
+// The tiers of the tables in the MOVE changes of the manifest: coldTier for the tables in
+// Options.ColdStorageDir, and remoteTier for those in Options.RemoteTableStore.
+const (
+	coldTier   = 1
+	remoteTier = 2
+)
+
+// coldStorageInterval is how often the tables are checked for the cold storage policy.
+const coldStorageInterval = time.Minute
+
+// tableDir returns the directory of the table files, Options.ColdStorageDir if cold.
+func (db *DB) tableDir(cold bool) string {
+	if cold {
+		return db.opt.ColdStorageDir
+	}
+	return db.opt.Dir
+}
+
+// isColdTable returns whether the file of t is in Options.ColdStorageDir.
+func (db *DB) isColdTable(t *table.Table) bool {
+	return db.opt.ColdStorageDir != "" &&
+		filepath.Dir(t.Filename()) == filepath.Clean(db.opt.ColdStorageDir)
+}
+
+// isRemoteTable returns whether t is in Options.RemoteTableStore.
+func (db *DB) isRemoteTable(t *table.Table) bool {
+	return db.opt.RemoteTableStore != nil && t.IsRemote()
+}
+
+// coldStorageTier returns the tier the tables of the cold storage policy are moved to, or zero
+// if there is none.
+func (db *DB) coldStorageTier() uint32 {
+	switch {
+	case db.opt.RemoteTableStore != nil:
+		return remoteTier
+	case db.opt.ColdStorageDir != "":
+		return coldTier
+	}
+	return 0
+}
+
+// coldLevel returns the first level whose tables are moved to cold storage.
+func (s *levelsController) coldLevel() int {
+	if l := s.kv.opt.ColdStorageLevel; l > 0 {
+		return l
+	}
+	return len(s.levels) - 1
+}
+
+// runColdStorage moves the tables to cold storage every coldStorageInterval, until lc is closed.
+func (s *levelsController) runColdStorage(lc *z.Closer) {
+	defer lc.Done()
+
+	ticker := time.NewTicker(coldStorageInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lc.HasBeenClosed():
+			return
+		case <-ticker.C:
+		}
+		if _, err := s.moveColdTables(lc); err != nil {
+			s.kv.opt.Warningf("While moving tables to cold storage: %v", err)
+		}
+	}
+}
+
+// MoveColdTables moves the tables of Options.ColdStorageLevel and below, older than
+// Options.ColdStorageAge, to Options.ColdStorageDir or Options.RemoteTableStore, and returns how
+// many it moved. The tables are moved in the background every minute, and this moves them now.
+// The tables being compacted are skipped.
+func (db *DB) MoveColdTables() (int, error) {
+	if db.coldStorageTier() == 0 {
+		return 0, errors.New("Neither ColdStorageDir nor RemoteTableStore is set")
+	}
+	if db.opt.ReadOnly {
+		return 0, errors.New("Cannot move tables to cold storage in a DB opened in ReadOnly mode")
+	}
+	if db.IsClosed() {
+		return 0, ErrDBClosed
+	}
+	return db.lc.moveColdTables(nil)
+}
+
+// moveColdTables moves the tables of the policy to cold storage, until lc is closed, if not nil.
+func (s *levelsController) moveColdTables(lc *z.Closer) (int, error) {
+	now := time.Now()
+	var moved int
+	for _, l := range s.levels[max(s.coldLevel(), 1):] {
+		l.RLock()
+		var tables []*table.Table
+		for _, t := range l.tables {
+			if !s.kv.isColdTable(t) && !s.kv.isRemoteTable(t) &&
+				now.Sub(t.CreatedAt) >= s.kv.opt.ColdStorageAge {
+				// Keep the table around while it's copied, even if compacted meanwhile.
+				t.IncrRef()
+				tables = append(tables, t)
+			}
+		}
+		l.RUnlock()
+
+		var err error
+		for _, t := range tables {
+			if err == nil && (lc == nil || lc.Ctx().Err() == nil) {
+				var ok bool
+				if ok, err = s.moveToColdStorage(l, t); ok {
+					moved++
+				}
+			}
+			_ = t.DecrRef()
+		}
+		if err != nil {
+			return moved, err
+		}
+	}
+	return moved, nil
+}
+
+// moveToColdStorage moves t of level l to cold storage, unless a compaction holds it. It
+// returns whether it moved it.
+//
+// The table is copied to Options.ColdStorageDir or Options.RemoteTableStore, and the copy
+// replaces it in the level once the move is recorded in the manifest. The file in Options.Dir is
+// deleted once the reads of the table are done. If the move is interrupted, the copy that isn't
+// in the manifest is deleted when the DB is opened.
+func (s *levelsController) moveToColdStorage(l *levelHandler, t *table.Table) (bool, error) {
+	db := s.kv
+	// Reserve the key range of the table like a compaction, so that no compaction replaces it
+	// while it's moved.
+	kr := getKeyRange(t)
+	cs := s.cstatus.levels[l.level]
+	s.cstatus.Lock()
+	if _, ok := s.cstatus.tables[t.ID()]; ok || cs.overlapsWith(kr) {
+		s.cstatus.Unlock()
+		return false, nil
+	}
+	cs.ranges = append(cs.ranges, kr)
+	s.cstatus.tables[t.ID()] = struct{}{}
+	s.cstatus.Unlock()
+	defer func() {
+		s.cstatus.Lock()
+		cs.remove(kr)
+		delete(s.cstatus.tables, t.ID())
+		s.cstatus.Unlock()
+	}()
+
+	l.RLock()
+	found := slices.Contains(l.tables, t)
+	l.RUnlock()
+	if !found {
+		// Compacted before being reserved.
+		return false, nil
+	}
+
+	dk, err := db.registry.DataKey(t.KeyID())
+	if err != nil {
+		return false, y.Wrapf(err, "Error while reading datakey")
+	}
+	topt := buildTableOptions(db)
+	topt.Compression = t.CompressionType()
+	topt.DataKey = dk
+	tier := db.coldStorageTier()
+	var cold *table.Table
+	if tier == remoteTier {
+		cold, err = db.uploadTable(t, topt)
+	} else {
+		cold, err = db.copyTableToColdStorage(t, topt)
+	}
+	if err != nil {
+		return false, y.Wrapf(err, "while moving table %d to cold storage", t.ID())
+	}
+
+	if err := db.manifest.addChanges([]*pb.ManifestChange{newMoveChange(t.ID(), tier)},
+		db.opt); err != nil {
+		// Deletes the copy.
+		_ = cold.DecrRef()
+		return false, y.Wrapf(err, "while moving table %d to cold storage", t.ID())
+	}
+	if err := l.replaceTables([]*table.Table{t}, []*table.Table{cold}); err != nil {
+		return true, err
+	}
+	// replaceTables took its own reference.
+	_ = cold.DecrRef()
+	db.opt.Debugf("Moved table %d of level %d to cold storage", t.ID(), l.level)
+	return true, nil
+}
+
+// copyTableToColdStorage copies t to Options.ColdStorageDir, and opens the copy with topt.
+func (db *DB) copyTableToColdStorage(t *table.Table, topt table.Options) (*table.Table, error) {
+	dst := table.NewFilename(t.ID(), db.opt.ColdStorageDir)
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := copyFile(t.Filename(), dst, -1); err != nil {
+		return nil, err
+	}
+	if err := syncDir(db.opt.ColdStorageDir); err != nil {
+		return nil, err
+	}
+	mf, err := z.OpenMmapFile(dst, db.opt.getFileFlags(), 0)
+	if err != nil {
+		return nil, y.Wrapf(err, "Opening file: %q", dst)
+	}
+	cold, err := table.OpenTable(mf, topt)
+	if err != nil {
+		_ = mf.Delete()
+		return nil, y.Wrapf(err, "Opening table: %q", dst)
+	}
+	return cold, nil
+}
+
+// uploadTable uploads t to Options.RemoteTableStore, and opens the upload with topt.
+func (db *DB) uploadTable(t *table.Table, topt table.Options) (*table.Table, error) {
+	store := db.opt.RemoteTableStore
+	f, err := os.Open(t.Filename())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := store.Put(context.Background(), t.ID(), f, int64(t.Size())); err != nil {
+		return nil, err
+	}
+	remote, err := openRemoteTable(store, t.ID(), &topt)
+	if err != nil {
+		_ = store.Delete(context.Background(), t.ID())
+		return nil, y.Wrapf(err, "Opening remote table %d", t.ID())
+	}
+	return remote, nil
+}
@@ -0,0 +1,87 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/pb"
+	"github.com/luxfi/zapdb/table"
+)
+
+func TestColdStorage(t *testing.T) {
+	dir, coldDir := t.TempDir(), filepath.Join(t.TempDir(), "cold")
+	opt := getTestOptions(dir).WithColdStorageDir(coldDir)
+
+	key := func(i int) []byte { return fmt.Appendf(nil, "key%05d", i) }
+	check := func(db *DB) {
+		require.NoError(t, db.View(func(txn *Txn) error {
+			for i := range 2000 {
+				item, err := txn.Get(key(i))
+				require.NoError(t, err)
+				require.Equal(t, fmt.Appendf(nil, "value%d", i), getItemValue(t, item))
+			}
+			return nil
+		}))
+	}
+
+	db, err := Open(opt)
+	require.NoError(t, err)
+	// The stream writer writes the tables to the last level.
+	buf := z.NewBuffer(1<<20, "test")
+	defer func() { require.NoError(t, buf.Release()) }()
+	for i := range 2000 {
+		KVToBuffer(&pb.KV{Key: key(i), Value: fmt.Appendf(nil, "value%d", i), Version: 1}, buf)
+	}
+	sw := db.NewStreamWriter()
+	require.NoError(t, sw.Prepare())
+	require.NoError(t, sw.Write(buf))
+	require.NoError(t, sw.Flush())
+	require.NoError(t, db.Close())
+
+	db, err = Open(opt.WithColdStorageAge(time.Hour))
+	require.NoError(t, err)
+	n, err := db.MoveColdTables()
+	require.NoError(t, err)
+	require.Zero(t, n)
+	require.NoError(t, db.Close())
+
+	db, err = Open(opt)
+	require.NoError(t, err)
+	n, err = db.MoveColdTables()
+	require.NoError(t, err)
+	require.NotZero(t, n)
+
+	tables := db.Tables()
+	require.NotEmpty(t, tables)
+	for _, ti := range tables {
+		require.Equal(t, opt.MaxLevels-1, ti.Level)
+		require.True(t, ti.Cold)
+		require.FileExists(t, table.NewFilename(ti.ID, coldDir))
+		require.NoFileExists(t, table.NewFilename(ti.ID, dir))
+	}
+	check(db)
+	require.NoError(t, db.Close())
+
+	// A copy left by an interrupted move is deleted.
+	stray := table.NewFilename(tables[0].ID+1000, coldDir)
+	require.NoError(t, os.WriteFile(stray, nil, 0600))
+	db, err = Open(opt)
+	require.NoError(t, err)
+	require.NoFileExists(t, stray)
+	check(db)
+	require.NoError(t, db.Close())
+
+	_, err = Open(opt.WithColdStorageDir(""))
+	require.ErrorContains(t, err, "cold storage")
+}
@@ -0,0 +1,198 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/luxfi/zapdb/options"
+	"github.com/luxfi/zapdb/table"
+)
+
+// columnFamilyPrefix starts the keys of every column family. It is followed by the length of the
+// name of the column family, the name, and the key within the column family. Like the other
+// internal keys, they are hidden from iterators of the DB.
+var columnFamilyPrefix = []byte("!badger!cf")
+
+// ColumnFamilyOptions are the options of a column family. See Options.WithColumnFamily.
+type ColumnFamilyOptions struct {
+	// Compression and ZSTDCompressionLevel of the tables holding the column family. Tables
+	// flushed to level 0 hold the keys of every column family, and use the options of the DB;
+	// compactions move the column family to tables of its own.
+	Compression          options.CompressionType
+	ZSTDCompressionLevel int
+
+	// DefaultTTL is the TTL of the entries set without an expiry. Zero means they don't expire.
+	DefaultTTL time.Duration
+
+	// DontCache keeps the blocks of the column family out of the block cache, leaving it to the
+	// rest of the DB. Use it for data that is rarely read twice.
+	DontCache bool
+}
+
+// ColumnFamily is a named keyspace of a DB. Its keys don't collide with the keys of the DB or of
+// other column families, and aren't seen by their iterators, but it shares the WAL and the
+// transactions of the DB: a transaction can write to several column families atomically.
+type ColumnFamily struct {
+	db     *DB
+	name   string
+	prefix []byte
+	opt    *ColumnFamilyOptions // nil if the column family has no options of its own.
+}
+
+func checkColumnFamilyName(name string) error {
+	if len(name) == 0 || len(name) > math.MaxUint8 {
+		return fmt.Errorf("invalid column family name %q: must be 1 to %d bytes long",
+			name, math.MaxUint8)
+	}
+	return nil
+}
+
+func newColumnFamily(db *DB, name string, opt *ColumnFamilyOptions) *ColumnFamily {
+	prefix := make([]byte, 0, len(columnFamilyPrefix)+1+len(name))
+	prefix = append(prefix, columnFamilyPrefix...)
+	prefix = append(prefix, byte(len(name)))
+	prefix = append(prefix, name...)
+	return &ColumnFamily{db: db, name: name, prefix: prefix, opt: opt}
+}
+
+func newColumnFamilies(db *DB) map[string]*ColumnFamily {
+	if len(db.opt.ColumnFamilies) == 0 {
+		return nil
+	}
+	cfs := make(map[string]*ColumnFamily, len(db.opt.ColumnFamilies))
+	for name, cfo := range db.opt.ColumnFamilies {
+		cfs[name] = newColumnFamily(db, name, &cfo)
+	}
+	return cfs
+}
+
+// ColumnFamily returns the column family name, with the options set for it in
+// Options.ColumnFamilies, if any. Column families don't need to be created: a column family
+// exists as long as it has keys. ColumnFamily panics if name is empty or longer than 255 bytes.
+func (db *DB) ColumnFamily(name string) *ColumnFamily {
+	if cf, ok := db.columnFamilies[name]; ok {
+		return cf
+	}
+	if err := checkColumnFamilyName(name); err != nil {
+		panic(err)
+	}
+	return newColumnFamily(db, name, nil)
+}
+
+// columnFamilyOf returns the column family of Options.ColumnFamilies holding key, without
+// timestamp, or nil if there is none.
+func (db *DB) columnFamilyOf(key []byte) *ColumnFamily {
+	if len(db.columnFamilies) == 0 || !bytes.HasPrefix(key, columnFamilyPrefix) {
+		return nil
+	}
+	key = key[len(columnFamilyPrefix):]
+	if len(key) == 0 || len(key) < 1+int(key[0]) {
+		return nil
+	}
+	return db.columnFamilies[string(key[1:1+key[0]])]
+}
+
+// cacheOption returns the table iterator option for reads of key, or of keys with it as prefix.
+func (db *DB) cacheOption(key []byte) int {
+	if cf := db.columnFamilyOf(key); cf != nil && cf.opt.DontCache {
+		return table.NOCACHE
+	}
+	return 0
+}
+
+// setTableOptions sets the options of the tables of cf in topt. cf may be nil.
+func (cf *ColumnFamily) setTableOptions(topt *table.Options) {
+	if cf == nil || cf.opt == nil {
+		return
+	}
+	topt.Compression = cf.opt.Compression
+	topt.ZSTDCompressionLevel = cf.opt.ZSTDCompressionLevel
+}
+
+// Name returns the name of the column family.
+func (cf *ColumnFamily) Name() string {
+	return cf.name
+}
+
+// key returns the key of the DB for key of the column family.
+func (cf *ColumnFamily) key(key []byte) []byte {
+	k := make([]byte, 0, len(cf.prefix)+len(key))
+	k = append(k, cf.prefix...)
+	return append(k, key...)
+}
+
+// Set is like Txn.Set for key of the column family.
+func (cf *ColumnFamily) Set(txn *Txn, key, val []byte) error {
+	return cf.SetEntry(txn, NewEntry(key, val))
+}
+
+// SetEntry is like Txn.SetEntry for e.Key of the column family. e isn't modified, and the
+// transaction keeps a copy of it, set to expire after the DefaultTTL of the column family if e
+// doesn't expire.
+func (cf *ColumnFamily) SetEntry(txn *Txn, e *Entry) error {
+	if len(e.Key) == 0 {
+		return ErrEmptyKey
+	}
+	ce := *e
+	ce.Key = cf.key(e.Key)
+	if cf.opt != nil && cf.opt.DefaultTTL > 0 && ce.ExpiresAt == 0 {
+		ce.WithTTL(cf.opt.DefaultTTL)
+	}
+	return txn.modifyKey(&ce, true)
+}
+
+// Delete is like Txn.Delete for key of the column family.
+func (cf *ColumnFamily) Delete(txn *Txn, key []byte) error {
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+	return txn.modifyKey(&Entry{Key: cf.key(key), meta: bitDelete}, true)
+}
+
+// Get is like Txn.Get for key of the column family. Key of the returned Item is key.
+func (cf *ColumnFamily) Get(txn *Txn, key []byte) (*Item, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+	item, err := txn.Get(cf.key(key))
+	if err != nil {
+		return nil, err
+	}
+	item.cfLen = len(cf.prefix)
+	return item, nil
+}
+
+// NewIterator is like Txn.NewIterator over the keys of the column family. opt.Prefix, the keys
+// passed to Seek and ValidForPrefix, and the keys of the items are keys of the column family.
+// opt.InternalAccess is ignored.
+func (cf *ColumnFamily) NewIterator(txn *Txn, opt IteratorOptions) *Iterator {
+	opt.Prefix = cf.key(opt.Prefix)
+	opt.InternalAccess = true
+	it := txn.NewIterator(opt)
+	it.cfLen = len(cf.prefix)
+	return it
+}
+
+// DropAll drops all the keys of the column family, like DB.DropPrefix.
+func (cf *ColumnFamily) DropAll() error {
+	return cf.db.DropPrefix(cf.prefix)
+}
+
+// prefixEnd returns the smallest key greater than every key with prefix, or nil if there is none.
+func prefixEnd(prefix []byte) []byte {
+	end := bytes.Clone(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
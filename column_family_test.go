@@ -0,0 +1,223 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/options"
+	"github.com/luxfi/zapdb/table"
+)
+
+// cfKeys returns the keys and values of cf, iterating with opt.
+func cfKeys(t *testing.T, txn *Txn, cf *ColumnFamily, opt IteratorOptions) []string {
+	it := cf.NewIterator(txn, opt)
+	defer it.Close()
+	var kvs []string
+	for it.Rewind(); it.Valid(); it.Next() {
+		kvs = append(kvs, fmt.Sprintf("%s=%s", it.Item().Key(), getItemValue(t, it.Item())))
+	}
+	return kvs
+}
+
+func TestColumnFamily(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		state, receipts := db.ColumnFamily("state"), db.ColumnFamily("receipts")
+		require.Equal(t, "state", state.Name())
+
+		// One transaction writes to the DB and both column families.
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			require.NoError(t, txn.Set([]byte("a"), []byte("db")))
+			for _, k := range []string{"a", "b", "c"} {
+				require.NoError(t, state.Set(txn, []byte(k), []byte("state-"+k)))
+			}
+			return receipts.Set(txn, []byte("a"), []byte("receipt"))
+		}))
+
+		require.NoError(t, db.View(func(txn *Txn) error {
+			item, err := state.Get(txn, []byte("a"))
+			require.NoError(t, err)
+			require.Equal(t, []byte("a"), item.Key())
+			require.Equal(t, []byte("a"), item.KeyCopy(nil))
+			require.Equal(t, []byte("state-a"), getItemValue(t, item))
+			item, err = receipts.Get(txn, []byte("a"))
+			require.NoError(t, err)
+			require.Equal(t, []byte("receipt"), getItemValue(t, item))
+			_, err = receipts.Get(txn, []byte("b"))
+			require.ErrorIs(t, err, ErrKeyNotFound)
+
+			// The iterators of the DB don't see the column families.
+			it := txn.NewIterator(DefaultIteratorOptions)
+			defer it.Close()
+			var n int
+			for it.Rewind(); it.Valid(); it.Next() {
+				require.Equal(t, []byte("a"), it.Item().Key())
+				n++
+			}
+			require.Equal(t, 1, n)
+
+			require.Equal(t, []string{"a=state-a", "b=state-b", "c=state-c"},
+				cfKeys(t, txn, state, DefaultIteratorOptions))
+			require.Equal(t, []string{"a=receipt"}, cfKeys(t, txn, receipts, DefaultIteratorOptions))
+			reverse := DefaultIteratorOptions
+			reverse.Reverse = true
+			require.Equal(t, []string{"c=state-c", "b=state-b", "a=state-a"},
+				cfKeys(t, txn, state, reverse))
+			prefix := DefaultIteratorOptions
+			prefix.Prefix = []byte("b")
+			require.Equal(t, []string{"b=state-b"}, cfKeys(t, txn, state, prefix))
+
+			it2 := state.NewIterator(txn, DefaultIteratorOptions)
+			defer it2.Close()
+			it2.Seek([]byte("b"))
+			require.True(t, it2.ValidForPrefix([]byte("b")))
+			require.Equal(t, []byte("b"), it2.Item().Key())
+			require.False(t, it2.ValidForPrefix([]byte("a")))
+			return nil
+		}))
+
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return state.Delete(txn, []byte("b"))
+		}))
+		require.NoError(t, db.View(func(txn *Txn) error {
+			_, err := state.Get(txn, []byte("b"))
+			require.ErrorIs(t, err, ErrKeyNotFound)
+			return nil
+		}))
+
+		require.NoError(t, state.DropAll())
+		require.NoError(t, db.View(func(txn *Txn) error {
+			require.Empty(t, cfKeys(t, txn, state, DefaultIteratorOptions))
+			require.Equal(t, []string{"a=receipt"}, cfKeys(t, txn, receipts, DefaultIteratorOptions))
+			_, err := txn.Get([]byte("a"))
+			return err
+		}))
+
+		// The keys of column families can't be written directly.
+		err := db.Update(func(txn *Txn) error {
+			return txn.Set(state.key([]byte("a")), []byte("val"))
+		})
+		require.ErrorIs(t, err, ErrInvalidKey)
+		require.Panics(t, func() { db.ColumnFamily("") })
+	})
+}
+
+func TestColumnFamilyConflict(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		cf := db.ColumnFamily("state")
+		txn := db.NewTransaction(true)
+		defer txn.Discard()
+		_, err := cf.Get(txn, []byte("key"))
+		require.ErrorIs(t, err, ErrKeyNotFound)
+		require.NoError(t, txn.Set([]byte("other"), []byte("val")))
+
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return cf.Set(txn, []byte("key"), []byte("val"))
+		}))
+		require.ErrorIs(t, txn.Commit(), ErrConflict)
+	})
+}
+
+func TestColumnFamilyOptions(t *testing.T) {
+	dir, err := os.MkdirTemp("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	opt := getTestOptions(dir).
+		WithCompression(options.None).
+		WithMemTableSize(1<<16).
+		WithValueThreshold(1<<10).
+		WithBaseTableSize(1<<15).
+		WithColumnFamily("state", ColumnFamilyOptions{Compression: options.ZSTD, DontCache: true}).
+		WithColumnFamily("receipts", ColumnFamilyOptions{DefaultTTL: time.Hour})
+	db, err := Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	state, receipts := db.ColumnFamily("state"), db.ColumnFamily("receipts")
+
+	val := bytes.Repeat([]byte("v"), 100)
+	for i := 0; i < 2000; i += 20 {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			for j := i; j < i+20; j++ {
+				key := []byte(fmt.Sprintf("key%04d", j))
+				require.NoError(t, txn.Set(key, val))
+				require.NoError(t, state.Set(txn, key, val))
+				require.NoError(t, receipts.Set(txn, key, val))
+			}
+			return nil
+		}))
+	}
+	require.NoError(t, db.View(func(txn *Txn) error {
+		item, err := receipts.Get(txn, []byte("key0000"))
+		require.NoError(t, err)
+		require.Greater(t, item.ExpiresAt(), uint64(time.Now().Unix()))
+		item, err = state.Get(txn, []byte("key0000"))
+		require.NoError(t, err)
+		require.Zero(t, item.ExpiresAt())
+		return nil
+	}))
+
+	require.Equal(t, table.NOCACHE, db.cacheOption(state.key([]byte("key"))))
+	require.Zero(t, db.cacheOption(receipts.key([]byte("key"))))
+	require.Zero(t, db.cacheOption([]byte("key")))
+
+	require.NoError(t, db.Flatten(1))
+	var stateTables int
+	for _, l := range db.lc.levels[1:] {
+		l.RLock()
+		for _, tbl := range l.tables {
+			inState := db.columnFamilyOf(tbl.Smallest()[:len(tbl.Smallest())-8]) == state
+			// A table doesn't span column families with different options.
+			require.Equal(t, inState,
+				db.columnFamilyOf(tbl.Biggest()[:len(tbl.Biggest())-8]) == state)
+			if inState {
+				stateTables++
+				require.Equal(t, options.ZSTD, tbl.CompressionType())
+			} else {
+				require.Equal(t, options.None, tbl.CompressionType())
+			}
+		}
+		l.RUnlock()
+	}
+	require.Greater(t, stateTables, 0)
+	require.NoError(t, db.View(func(txn *Txn) error {
+		require.Len(t, cfKeys(t, txn, state, DefaultIteratorOptions), 2000)
+		return nil
+	}))
+}
+
+func TestColumnFamilyBackup(t *testing.T) {
+	var bak bytes.Buffer
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return db.ColumnFamily("state").Set(txn, []byte("key"), []byte("val"))
+		}))
+		_, err := db.Backup(&bak, 0)
+		require.NoError(t, err)
+	})
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		require.NoError(t, db.Load(&bak, 16))
+		require.NoError(t, db.View(func(txn *Txn) error {
+			item, err := db.ColumnFamily("state").Get(txn, []byte("key"))
+			require.NoError(t, err)
+			require.Equal(t, []byte("val"), getItemValue(t, item))
+			return nil
+		}))
+	})
+}
+
+func TestColumnFamilyInvalidName(t *testing.T) {
+	opt := DefaultOptions("").WithInMemory(true).
+		WithColumnFamily("", ColumnFamilyOptions{})
+	_, err := Open(opt)
+	require.Error(t, err)
+}
@@ -0,0 +1,38 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+
+	"github.com/luxfi/zapdb/pb"
+)
+
+// commitMetadataKey is the key the metadata of a commit is written to, at its version.
+var commitMetadataKey = []byte("!badger!commit")
+
+// SetCommitMetadata attaches meta, such as the ID of the request or the actor making the changes,
+// to the commit of the transaction rather than to its keys. It's passed by Subscribe and
+// Changefeed along with the KVs of the commit, see CommitMetadata, so that the changes can be
+// traced back to their origin. Setting it again replaces it.
+//
+// The metadata is kept at the version of the commit like the versions of a key, so Changefeed
+// replays it while the DB keeps the versions of that commit.
+func (txn *Txn) SetCommitMetadata(meta []byte) error {
+	if txn.db.opt.Follower {
+		return ErrFollower
+	}
+	return txn.modifyKey(&Entry{Key: commitMetadataKey, Value: meta}, true)
+}
+
+// CommitMetadata returns the metadata set by Txn.SetCommitMetadata if kv, passed by Subscribe or
+// Changefeed, holds it. Such a KV has the version of its commit, and precedes its other KVs.
+func CommitMetadata(kv *pb.KV) ([]byte, bool) {
+	if !bytes.Equal(kv.Key, commitMetadataKey) {
+		return nil, false
+	}
+	return kv.Value, true
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"sort"
 	"sync"
 
 	"github.com/luxfi/zapdb/table"
@@ -236,3 +237,93 @@ func (cs *compactStatus) delete(cd compactDef) {
 		delete(cs.tables, t.ID())
 	}
 }
+
+// checkCompactionOutput runs the checks of Options.ParanoidCompactionChecks on the tables out,
+// written by the compaction cd from the tables cd.top and bot.
+func checkCompactionOutput(cd compactDef, bot, out []*table.Table) error {
+	in := make([]*table.Table, 0, len(cd.top)+len(bot))
+	in = append(append(in, cd.top...), bot...)
+	var inKeys, outKeys uint64
+	for _, t := range in {
+		inKeys += uint64(t.KeyCount())
+	}
+	for _, t := range out {
+		if err := checkCompactionTable(t, in); err != nil {
+			return fmt.Errorf("%w: table %d: %v", ErrCompactionCheck, t.ID(), err)
+		}
+		outKeys += uint64(t.KeyCount())
+	}
+	if outKeys > inKeys {
+		return fmt.Errorf("%w: %d keys written from %d", ErrCompactionCheck, outKeys, inKeys)
+	}
+	if cd.nextLevel.level == 0 {
+		return nil
+	}
+	sorted := make([]*table.Table, len(out))
+	copy(sorted, out)
+	sort.Slice(sorted, func(i, j int) bool {
+		return y.CompareKeys(sorted[i].Smallest(), sorted[j].Smallest()) < 0
+	})
+	for i := 1; i < len(sorted); i++ {
+		if y.CompareKeys(sorted[i-1].Biggest(), sorted[i].Smallest()) >= 0 {
+			return fmt.Errorf("%w: tables %d and %d overlap", ErrCompactionCheck,
+				sorted[i-1].ID(), sorted[i].ID())
+		}
+	}
+	return nil
+}
+
+// checkCompactionTable reads t back, checking its checksums, the order and count of its keys,
+// and that its smallest and biggest keys come from the tables in.
+func checkCompactionTable(t *table.Table, in []*table.Table) error {
+	if err := t.VerifyChecksum(); err != nil {
+		return err
+	}
+	it := t.NewIterator(table.NOCACHE)
+	defer it.Close()
+	var (
+		first, last []byte
+		n           uint32
+	)
+	for it.Rewind(); it.Valid(); it.Next() {
+		if n == 0 {
+			first = y.Copy(it.Key())
+		} else if y.CompareKeys(last, it.Key()) >= 0 {
+			return fmt.Errorf("key %x follows key %x", it.Key(), last)
+		}
+		last = y.SafeCopy(last, it.Key())
+		n++
+	}
+	switch {
+	case n != t.KeyCount():
+		return fmt.Errorf("read %d keys, the index has %d", n, t.KeyCount())
+	case n == 0:
+		return nil
+	case !bytes.Equal(first, t.Smallest()) || !bytes.Equal(last, t.Biggest()):
+		return fmt.Errorf("keys range from %x to %x, the index has %x to %x",
+			first, last, t.Smallest(), t.Biggest())
+	}
+	for _, key := range [][]byte{first, last} {
+		if !tablesHaveKey(in, key) {
+			return fmt.Errorf("key %x isn't in the input tables", key)
+		}
+	}
+	return nil
+}
+
+// tablesHaveKey returns whether one of tables holds key, with its timestamp.
+func tablesHaveKey(tables []*table.Table, key []byte) bool {
+	for _, t := range tables {
+		if y.CompareKeys(key, t.Smallest()) < 0 || y.CompareKeys(key, t.Biggest()) > 0 {
+			continue
+		}
+		it := t.NewIterator(table.NOCACHE)
+		it.Seek(key)
+		found := it.Valid() && bytes.Equal(it.Key(), key)
+		_ = it.Close()
+		if found {
+			return true
+		}
+	}
+	return false
+}
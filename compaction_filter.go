@@ -0,0 +1,49 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"github.com/luxfi/zapdb/y"
+)
+
+// FilterAction is what a CompactionFilter does with an entry.
+type FilterAction uint8
+
+const (
+	// FilterKeep keeps the entry as it is.
+	FilterKeep FilterAction = iota
+	// FilterDrop deletes the key as of the version of the entry, like a Delete written at that
+	// version would. The earlier versions of the key are dropped as well.
+	FilterDrop
+	// FilterModify replaces the value of the entry with Decision.Value.
+	FilterModify
+)
+
+// Decision is the decision of a CompactionFilter on an entry. The zero Decision keeps it.
+type Decision struct {
+	Action FilterAction
+	// Value is the new value of the entry, for FilterModify.
+	Value []byte
+}
+
+// filterEntry applies Options.CompactionFilter to the version vs of key. It returns the entry to
+// write in its place, deleted if it was dropped, and whether it differs from vs.
+func (db *DB) filterEntry(key []byte, vs y.ValueStruct) (y.ValueStruct, bool, error) {
+	val, err := db.readValue(vs)
+	if err != nil {
+		return vs, false, err
+	}
+	d := db.opt.CompactionFilter(y.ParseKey(key), val, y.ParseTs(key))
+	switch d.Action {
+	case FilterDrop:
+		return y.ValueStruct{Meta: bitDelete}, true, nil
+	case FilterModify:
+		vs.Value = d.Value
+		vs.Meta &^= bitValuePointer
+		return vs, true, nil
+	}
+	return vs, false, nil
+}
@@ -0,0 +1,128 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactionFilter(t *testing.T) {
+	dir, err := os.MkdirTemp("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	// Close compacts L0, and long values go to the value log.
+	opts := getTestOptions(dir).WithValueThreshold(16).WithCompactL0OnClose(true)
+	key := func(i int) []byte { return []byte(fmt.Sprintf("state/%03d", i)) }
+	val := func(i, v int) []byte {
+		return bytes.Repeat([]byte(fmt.Sprintf("%d-%d,", i, v)), i%4+1)
+	}
+	write := func(db *DB, v int, keys func(i int) bool) {
+		wb := db.NewWriteBatch()
+		for i := 0; i < 100; i++ {
+			if keys(i) {
+				require.NoError(t, wb.Set(key(i), val(i, v)))
+			}
+		}
+		require.NoError(t, wb.Flush())
+	}
+
+	db, err := Open(opts)
+	require.NoError(t, err)
+	write(db, 1, func(int) bool { return true })
+	require.NoError(t, db.Close())
+
+	// The keys below 50 are pruned, and the values of the keys 90 and above are trimmed. The
+	// keys with a second version are pruned if their new version is. Each batch is committed at
+	// the version it writes.
+	var mismatches atomic.Int32
+	opts = opts.WithCompactionFilter(func(k, v []byte, version uint64) Decision {
+		var i int
+		if _, err := fmt.Sscanf(string(k), "state/%03d", &i); err != nil ||
+			!bytes.Equal(val(i, int(version)), v) {
+			mismatches.Add(1)
+		}
+		switch {
+		case i < 50:
+			return Decision{Action: FilterDrop}
+		case i >= 90:
+			return Decision{Action: FilterModify, Value: []byte("trimmed")}
+		}
+		return Decision{}
+	})
+	db, err = Open(opts)
+	require.NoError(t, err)
+	write(db, 2, func(i int) bool { return i%10 == 0 })
+	require.NoError(t, db.Close())
+	require.Zero(t, mismatches.Load())
+
+	db, err = Open(opts.WithCompactionFilter(nil))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	var n int
+	require.NoError(t, db.View(func(txn *Txn) error {
+		iopt := DefaultIteratorOptions
+		iopt.AllVersions = true
+		it := txn.NewIterator(iopt)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			i := 50 + n
+			require.Equal(t, key(i), it.Item().Key())
+			switch {
+			case i >= 90:
+				require.Equal(t, []byte("trimmed"), getItemValue(t, it.Item()))
+			case i%10 == 0:
+				require.Equal(t, val(i, 2), getItemValue(t, it.Item()))
+			default:
+				require.Equal(t, val(i, 1), getItemValue(t, it.Item()))
+			}
+			n++
+		}
+		return nil
+	}))
+	require.Equal(t, 50, n)
+}
+
+func TestCompactionFilterRunningTxn(t *testing.T) {
+	opts := getTestOptions(t.TempDir()).WithNumCompactors(0).
+		WithCompactionFilter(func(k, v []byte, version uint64) Decision {
+			if bytes.HasPrefix(k, []byte("old/")) {
+				return Decision{Action: FilterDrop}
+			}
+			return Decision{}
+		})
+	db, err := Open(opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	set := func(key string) {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Set([]byte(key), []byte("val"))
+		}))
+	}
+	set("old/1")
+	set("new/1")
+
+	// The newest version of a key below the discard timestamp is read by the running
+	// transactions, and filtered from under them.
+	txn := db.NewTransaction(false)
+	defer txn.Discard()
+	require.GreaterOrEqual(t, db.versionDiscardTs(), db.MaxVersion()-1)
+	_, err = txn.Get([]byte("old/1"))
+	require.NoError(t, err)
+	require.NoError(t, db.flushMemTableForCheckpoint())
+	prio := compactionPriority{level: 0, score: 1.71, t: db.lc.levelTargets()}
+	require.NoError(t, db.lc.doCompact(-1, prio))
+	_, err = txn.Get([]byte("old/1"))
+	require.ErrorIs(t, err, ErrKeyNotFound)
+	_, err = txn.Get([]byte("new/1"))
+	require.NoError(t, err)
+}
@@ -0,0 +1,119 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+
+	"github.com/luxfi/zapdb/y"
+)
+
+const (
+	// qosInterval is how often the p99 latency of Get is compared with Options.ReadLatencySLO.
+	qosInterval = time.Second
+	// qosMinGets is the number of Gets in an interval below which there are too few reads to
+	// protect, and compactions resume.
+	qosMinGets = 10
+)
+
+// compactionQoS pauses compactions while the p99 latency of Txn.Get is above
+// Options.ReadLatencySLO. Compactions the backlog demands still run. A nil compactionQoS never
+// pauses them.
+type compactionQoS struct {
+	db     *DB
+	gets   *y.Histogram
+	last   y.HistogramSnapshot // of gets, when the latency was last compared.
+	paused atomic.Bool
+}
+
+func newCompactionQoS(db *DB) *compactionQoS {
+	if db.opt.ReadLatencySLO <= 0 {
+		return nil
+	}
+	q := &compactionQoS{db: db, gets: y.NewHistogram(db.opt.LatencyBuckets)}
+	q.last = q.gets.Snapshot()
+	return q
+}
+
+func (q *compactionQoS) observeGet(d time.Duration) {
+	if q == nil {
+		return
+	}
+	q.gets.Observe(d)
+}
+
+func (q *compactionQoS) run(lc *z.Closer) {
+	defer lc.Done()
+	ticker := time.NewTicker(qosInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			q.adjust()
+		case <-lc.HasBeenClosed():
+			if q.paused.Load() {
+				q.db.metrics.NumCompactionsPausedAdd(-1)
+			}
+			return
+		}
+	}
+}
+
+// adjust pauses or resumes compactions, depending on the p99 latency of the Gets since it was
+// last called.
+func (q *compactionQoS) adjust() {
+	cur := q.gets.Snapshot()
+	window := cur.Sub(q.last)
+	q.last = cur
+	slo := q.db.opt.ReadLatencySLO
+	p99 := window.Quantile(0.99)
+	paused := window.Count >= qosMinGets && p99 > slo
+	if q.paused.Swap(paused) == paused {
+		return
+	}
+	if paused {
+		q.db.metrics.NumCompactionsPausedAdd(1)
+		q.db.metrics.NumCompactionPausesAdd(1)
+		q.db.events.record(EventCompactionPause, p99.Microseconds(), nil)
+		q.db.opt.Infof("Pausing compactions: p99 Get latency of %s is above the SLO of %s",
+			p99, slo)
+		return
+	}
+	q.db.metrics.NumCompactionsPausedAdd(-1)
+	q.db.events.record(EventCompactionResume, p99.Microseconds(), nil)
+	q.db.opt.Infof("Resuming compactions: p99 Get latency of %s is within the SLO of %s", p99, slo)
+}
+
+// allow returns whether the compaction of p may run, and if so whether it is forced by the
+// backlog while compactions are paused.
+func (q *compactionQoS) allow(p compactionPriority) (ok, forced bool) {
+	if q == nil || !q.paused.Load() {
+		return true, false
+	}
+	if p.score >= q.db.opt.CompactionBacklogScore {
+		return true, true
+	}
+	// Writes stall at NumLevelZeroTablesStall, whatever the backlog score.
+	if p.level == 0 && q.db.lc.levels[0].numTables() >= q.db.opt.NumLevelZeroTablesStall {
+		return true, true
+	}
+	return false, false
+}
+
+// forced records a compaction of level run while compactions were paused.
+func (q *compactionQoS) forced(level int) {
+	q.db.metrics.NumCompactionsForcedAdd(1)
+	q.db.events.record(EventCompactionForced, int64(level), nil)
+}
+
+// CompactionsPaused returns whether compactions are paused, because the p99 latency of Txn.Get
+// is above Options.ReadLatencySLO.
+func (db *DB) CompactionsPaused() bool {
+	return db.qos != nil && db.qos.paused.Load()
+}
@@ -0,0 +1,81 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"expvar"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactionQoS(t *testing.T) {
+	dir, err := os.MkdirTemp("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	// Every Get is slower than the SLO.
+	opt := getTestOptions(dir).WithReadLatencySLO(time.Nanosecond).WithMetricsLabel("qos")
+	db, err := Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	paused := func() int64 {
+		m := expvar.Get("badger_db").(*expvar.Map).Get("qos").(*expvar.Map)
+		return m.Get("compaction_paused_num_lsm").(*expvar.Int).Value()
+	}
+	events := func(kind EventKind) int {
+		var n int
+		for _, e := range db.FlightRecorder() {
+			if e.Kind == kind {
+				n++
+			}
+		}
+		return n
+	}
+	require.False(t, db.CompactionsPaused())
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_ = db.View(func(txn *Txn) error {
+				_, err := txn.Get([]byte("key"))
+				return err
+			})
+		}
+	}()
+	require.Eventually(t, db.CompactionsPaused, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, int64(1), paused())
+	require.Equal(t, 1, events(EventCompactionPause))
+
+	// Only the compactions the backlog demands run.
+	ok, _ := db.qos.allow(compactionPriority{level: 1, score: 1.5})
+	require.False(t, ok)
+	ok, forced := db.qos.allow(compactionPriority{level: 1, score: 2})
+	require.True(t, ok)
+	require.True(t, forced)
+
+	// Without reads, compactions resume.
+	close(stop)
+	wg.Wait()
+	require.Eventually(t, func() bool { return !db.CompactionsPaused() },
+		5*time.Second, 10*time.Millisecond)
+	require.Zero(t, paused())
+	require.Equal(t, 1, events(EventCompactionResume))
+	ok, forced = db.qos.allow(compactionPriority{level: 1, score: 1.5})
+	require.True(t, ok)
+	require.False(t, forced)
+}
@@ -0,0 +1,165 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+
+	"github.com/luxfi/zapdb/options"
+	"github.com/luxfi/zapdb/pb"
+	"github.com/luxfi/zapdb/table"
+	"github.com/luxfi/zapdb/y"
+)
+
+// CompressionDictionaryOptions are the options of DB.TrainCompressionDictionary.
+type CompressionDictionaryOptions struct {
+	// Levels are the levels whose tables are compressed with the dictionary from now on. If
+	// empty, the tables of every level are.
+	Levels []int
+	// MaxSize is the maximum size of the dictionary. 64 KB if zero.
+	MaxSize int
+}
+
+// compressionDictionaries are the ZSTD dictionaries of a DB.
+type compressionDictionaries struct {
+	// dicts are the dictionaries by ID.
+	dicts map[uint32][]byte
+	// levels are the dictionaries compressing the tables of the levels, nil for none.
+	levels []*y.ZSTDDictionary
+	// decoder decompresses the blocks compressed with any of the dictionaries. It is nil if there
+	// is none.
+	decoder *y.ZSTDDecoder
+}
+
+// newCompressionDictionaries returns the dictionaries dicts, which compress the tables of the
+// levels whose dictionary ID is set in levels.
+func newCompressionDictionaries(dicts map[uint32][]byte, levels []uint32, opt Options) (
+	*compressionDictionaries, error) {
+	cd := &compressionDictionaries{dicts: dicts}
+	if len(dicts) == 0 {
+		return cd, nil
+	}
+	var err error
+	if cd.decoder, err = y.NewZSTDDecoder(slices.Collect(maps.Values(dicts))...); err != nil {
+		return nil, y.Wrapf(err, "While loading compression dictionaries")
+	}
+	cd.levels = make([]*y.ZSTDDictionary, len(levels))
+	for level, id := range levels {
+		if id == 0 {
+			continue
+		}
+		dict, ok := dicts[id]
+		if !ok {
+			return nil, fmt.Errorf("Compression dictionary %d of level %d doesn't exist", id, level)
+		}
+		// The tables of the levels share the encoder, which is safe for concurrent use.
+		for _, d := range cd.levels {
+			if d != nil && d.ID() == id {
+				cd.levels[level] = d
+			}
+		}
+		if cd.levels[level] == nil {
+			if cd.levels[level], err = y.NewZSTDDictionary(dict, opt.ZSTDCompressionLevel); err != nil {
+				return nil, y.Wrapf(err, "While loading compression dictionary %d", id)
+			}
+		}
+	}
+	return cd, nil
+}
+
+// setTableOptions sets the decoder of opt, and if level isn't negative, the dictionary of the
+// tables of level.
+func (cd *compressionDictionaries) setTableOptions(opt *table.Options, level int) {
+	if cd == nil {
+		return
+	}
+	opt.ZSTDDecoder = cd.decoder
+	if level >= 0 && level < len(cd.levels) {
+		opt.ZSTDDictionary = cd.levels[level]
+	}
+}
+
+// TrainCompressionDictionary trains a ZSTD dictionary on samples, and compresses the blocks of the
+// tables of opt.Levels with it from now on, that is the tables flushed or compacted to these
+// levels. It returns the ID of the dictionary, which is stored in the manifest.
+//
+// A dictionary brings the data seen across samples to every block, which dramatically improves
+// the compression ratio of small blocks of repetitive key-value shapes, like RLP-encoded
+// blockchain state. samples should be like the data written to the levels, e.g. the keys and
+// values of a sample of the DB, from a few hundred kilobytes to a few megabytes in total. The
+// DB must be opened with ZSTD compression.
+//
+// The dictionaries are never dropped, so that the tables compressed with them can always be read.
+func (db *DB) TrainCompressionDictionary(samples iter.Seq[[]byte],
+	opt CompressionDictionaryOptions) (uint32, error) {
+	if db.opt.ReadOnly {
+		return 0, errors.New("Cannot train a compression dictionary in a DB opened in ReadOnly mode")
+	}
+	if db.opt.Compression != options.ZSTD {
+		return 0, errors.New("Compression dictionaries require ZSTD compression")
+	}
+	levels := opt.Levels
+	if len(levels) == 0 {
+		for level := range db.opt.MaxLevels {
+			levels = append(levels, level)
+		}
+	}
+	for _, level := range levels {
+		// The levels of a dictionary are a bit mask of 32 bits in the manifest.
+		if level < 0 || level >= db.opt.MaxLevels || level >= 32 {
+			return 0, fmt.Errorf("Invalid level %d for compression dictionary", level)
+		}
+	}
+	if opt.MaxSize == 0 {
+		opt.MaxSize = 64 << 10
+	}
+	var input [][]byte
+	for sample := range samples {
+		input = append(input, y.SafeCopy(nil, sample))
+	}
+
+	db.dictLock.Lock()
+	defer db.dictLock.Unlock()
+	old := db.dicts.Load()
+	var id uint32 = 1
+	for existing := range old.dicts {
+		id = max(id, existing+1)
+	}
+	dict, err := y.TrainZSTDDictionary(input, id, opt.MaxSize, db.opt.ZSTDCompressionLevel)
+	if err != nil {
+		return 0, y.Wrapf(err, "While training compression dictionary")
+	}
+
+	dicts := maps.Clone(old.dicts)
+	if dicts == nil {
+		dicts = make(map[uint32][]byte)
+	}
+	dicts[id] = dict
+	ids := make([]uint32, db.opt.MaxLevels)
+	for level, d := range old.levels {
+		if d != nil {
+			ids[level] = d.ID()
+		}
+	}
+	for _, level := range levels {
+		ids[level] = id
+	}
+	cd, err := newCompressionDictionaries(dicts, ids, db.opt)
+	if err != nil {
+		return 0, err
+	}
+	change := newDictionaryChange(id, dict, levels)
+	if err := db.manifest.addChanges([]*pb.ManifestChange{change}, db.opt); err != nil {
+		return 0, y.Wrapf(err, "While adding compression dictionary to manifest")
+	}
+	db.dicts.Store(cd)
+	db.opt.Infof("Trained compression dictionary %d of %d bytes for levels %v", id, len(dict), levels)
+	return id, nil
+}
@@ -0,0 +1,98 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/options"
+)
+
+func TestTrainCompressionDictionary(t *testing.T) {
+	dir, err := os.MkdirTemp("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+	opt := getTestOptions(dir).
+		WithCompression(options.ZSTD).
+		WithBlockSize(512).
+		WithNumCompactors(0)
+
+	key := func(set string, i int) []byte { return fmt.Appendf(nil, "%s-account-%06d", set, i) }
+	// The values look alike, like the accounts of a blockchain state.
+	val := func(i int) []byte {
+		return fmt.Appendf(nil, "{nonce: %d, balance: %d, storageRoot: 56e81f171bcc55a6ff8345e6, "+
+			"codeHash: c5d2460186f7233c927e7db2dcc703c0}", i%97, i*7919)
+	}
+	write := func(db *DB, set string) {
+		wb := db.NewWriteBatch()
+		for i := range 2000 {
+			require.NoError(t, wb.Set(key(set, i), val(i)))
+		}
+		require.NoError(t, wb.Flush())
+	}
+	check := func(db *DB, set string) {
+		require.NoError(t, db.View(func(txn *Txn) error {
+			for i := range 2000 {
+				item, err := txn.Get(key(set, i))
+				require.NoError(t, err)
+				require.Equal(t, val(i), getItemValue(t, item))
+			}
+			return nil
+		}))
+	}
+	// size returns the size of the tables holding set.
+	size := func(db *DB, set string) (sz uint32) {
+		for _, ti := range db.Tables() {
+			if string(ti.Left[:1]) == set {
+				sz += ti.OnDiskSize
+			}
+		}
+		return sz
+	}
+
+	// The memtables are flushed when the DB is closed.
+	db, err := Open(opt)
+	require.NoError(t, err)
+	write(db, "a")
+	require.NoError(t, db.Close())
+
+	db, err = Open(opt)
+	require.NoError(t, err)
+	id, err := db.TrainCompressionDictionary(func(yield func([]byte) bool) {
+		require.NoError(t, db.View(func(txn *Txn) error {
+			it := txn.NewIterator(DefaultIteratorOptions)
+			defer it.Close()
+			for it.Rewind(); it.Valid(); it.Next() {
+				if !yield(append(it.Item().KeyCopy(nil), getItemValue(t, it.Item())...)) {
+					break
+				}
+			}
+			return nil
+		}))
+	}, CompressionDictionaryOptions{Levels: []int{0}})
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), id)
+	write(db, "b")
+	require.NoError(t, db.Close())
+
+	db, err = Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	require.Contains(t, db.manifest.manifest.Dictionaries, id)
+	require.Equal(t, id, db.manifest.manifest.Levels[0].Dictionary)
+	check(db, "a")
+	check(db, "b")
+	// The blocks of the same data compress far better with the dictionary.
+	require.Less(t, size(db, "b"), size(db, "a")*4/5)
+
+	_, err = db.TrainCompressionDictionary(func(func([]byte) bool) {},
+		CompressionDictionaryOptions{Levels: []int{opt.MaxLevels}})
+	require.Error(t, err)
+}
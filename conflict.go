@@ -0,0 +1,79 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"fmt"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+)
+
+// ConflictError is the error of a transaction failing with ErrConflict, with the first conflict
+// found. errors.Is(err, ErrConflict) holds for it, and errors.As finds it:
+//
+//	var conflict *badger.ConflictError
+//	if errors.As(err, &conflict) {
+//		log.Printf("Conflict on %q", conflict.Key)
+//	}
+type ConflictError struct {
+	// Key is the key of the conflict, if known. The keys read are tracked by their fingerprints
+	// only, so Key is only known if the transaction wrote it too, or if it's in a range iterated
+	// by a SerializableSnapshot transaction.
+	Key []byte
+	// Fingerprint is the hash of the key of the conflict, which identifies it if Key is unknown.
+	Fingerprint uint64
+	// Version is the version of the commit which wrote the key, or zero for a conflict with a
+	// prepared transaction.
+	Version uint64
+	// Prepared is the ID of the prepared transaction holding the key, or of the transaction
+	// itself if it was committed or rolled back already.
+	Prepared string
+}
+
+// Error implements error.
+func (e *ConflictError) Error() string {
+	var on string
+	switch {
+	case e.Key != nil:
+		on = fmt.Sprintf("key %q", e.Key)
+	case e.Fingerprint != 0:
+		on = fmt.Sprintf("key with fingerprint %#x", e.Fingerprint)
+	default:
+		return fmt.Sprintf("%v: transaction %q is not prepared anymore", ErrConflict, e.Prepared)
+	}
+	if e.Prepared != "" {
+		return fmt.Sprintf("%v: %s held by prepared transaction %q", ErrConflict, on, e.Prepared)
+	}
+	return fmt.Sprintf("%v: %s written at version %d", ErrConflict, on, e.Version)
+}
+
+// Unwrap returns ErrConflict.
+func (e *ConflictError) Unwrap() error {
+	return ErrConflict
+}
+
+// conflictOn returns the conflict of txn on the key of fingerprint fp, written at version. The
+// key is looked for in the writes of txn.
+func (txn *Txn) conflictOn(fp, version uint64) *ConflictError {
+	conflict := &ConflictError{Fingerprint: fp, Version: version}
+	for key := range txn.pendingWrites {
+		if z.MemHash([]byte(key)) == fp {
+			conflict.Key = []byte(key)
+			break
+		}
+	}
+	return conflict
+}
+
+// recordConflict counts conflict in the metrics, by the first ConflictPrefixLen bytes of its key.
+// The conflicts on unknown keys are counted under "?".
+func (db *DB) recordConflict(conflict *ConflictError) {
+	prefix := "?"
+	if conflict.Key != nil {
+		prefix = string(conflict.Key[:min(len(conflict.Key), db.opt.ConflictPrefixLen)])
+	}
+	db.metrics.NumTxnConflictsAdd(prefix, 1)
+}
@@ -0,0 +1,399 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package raftstore stores the log and the stable state of a Raft node in a DB.
+//
+// Store has the methods of the LogStore and StableStore interfaces of hashicorp/raft, and those
+// of the Storage interface of etcd-raft reading the log, as well as Append and Compact to write
+// it. Its Log has the fields of the entries of both, so that a thin adapter converting raft.Log
+// or raftpb.Entry plugs it into either library without this package depending on them.
+//
+// The entries of the log are stored under the prefix of the Store followed by 'l' and their
+// index, big endian, and the stable state under the prefix followed by 's'. Truncating the log
+// deletes its entries by a range tombstone.
+package raftstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	badger "github.com/luxfi/zapdb"
+)
+
+var (
+	// ErrLogNotFound is returned by GetLog when the log has no entry at the index.
+	ErrLogNotFound = errors.New("raftstore: log not found")
+	// ErrKeyNotFound is returned by Get and GetUint64 when the key isn't set.
+	ErrKeyNotFound = errors.New("raftstore: key not found")
+	// ErrCompacted is returned by Entries and Term when the index is before the first entry.
+	ErrCompacted = errors.New("raftstore: requested index is compacted")
+	// ErrUnavailable is returned by Entries and Term when the index is after the last entry.
+	ErrUnavailable = errors.New("raftstore: requested index is unavailable")
+	// ErrCorrupt is returned when an entry of the log can't be decoded.
+	ErrCorrupt = errors.New("raftstore: log entry is corrupt")
+)
+
+// LogType is the type of an entry, as defined by the Raft library.
+type LogType uint8
+
+// Log is an entry of the log.
+type Log struct {
+	Index      uint64
+	Term       uint64
+	Type       LogType
+	Data       []byte
+	Extensions []byte
+	// AppendedAt is when the leader appended the entry, if the library records it.
+	AppendedAt time.Time
+}
+
+func (l *Log) encode() []byte {
+	buf := make([]byte, 0, 2*binary.MaxVarintLen64+1+len(l.Data)+len(l.Extensions)+8)
+	buf = binary.AppendUvarint(buf, l.Term)
+	buf = append(buf, byte(l.Type))
+	var at int64
+	if !l.AppendedAt.IsZero() {
+		at = l.AppendedAt.UnixNano()
+	}
+	buf = binary.AppendVarint(buf, at)
+	buf = binary.AppendUvarint(buf, uint64(len(l.Data)))
+	buf = append(buf, l.Data...)
+	return append(buf, l.Extensions...)
+}
+
+func (l *Log) decode(index uint64, buf []byte) error {
+	term, n := binary.Uvarint(buf)
+	if n <= 0 || len(buf) == n {
+		return fmt.Errorf("%w: index %d", ErrCorrupt, index)
+	}
+	typ := buf[n]
+	buf = buf[n+1:]
+	at, n := binary.Varint(buf)
+	if n <= 0 {
+		return fmt.Errorf("%w: index %d", ErrCorrupt, index)
+	}
+	buf = buf[n:]
+	size, n := binary.Uvarint(buf)
+	if n <= 0 || uint64(len(buf)-n) < size {
+		return fmt.Errorf("%w: index %d", ErrCorrupt, index)
+	}
+	buf = buf[n:]
+	*l = Log{Index: index, Term: term, Type: LogType(typ)}
+	if at != 0 {
+		l.AppendedAt = time.Unix(0, at)
+	}
+	if size > 0 {
+		l.Data = append([]byte(nil), buf[:size]...)
+	}
+	if len(buf) > int(size) {
+		l.Extensions = append([]byte(nil), buf[size:]...)
+	}
+	return nil
+}
+
+// Store is the log and the stable state of a Raft node, stored in a DB under a prefix. Its
+// methods can be called concurrently. The first and last indexes of the log are cached, so that
+// the DB is only read for the entries.
+type Store struct {
+	db           *badger.DB
+	logPrefix    []byte
+	stablePrefix []byte
+
+	// mu serializes the writes to the log, so that the cached indexes follow them.
+	mu    sync.Mutex
+	first atomic.Uint64
+	last  atomic.Uint64
+}
+
+// New returns the Store kept in db under prefix. Keys under prefix must not be written by
+// anything else. db must not be in managed mode.
+func New(db *badger.DB, prefix []byte) (*Store, error) {
+	s := &Store{
+		db:           db,
+		logPrefix:    append(append([]byte(nil), prefix...), 'l'),
+		stablePrefix: append(append([]byte(nil), prefix...), 's'),
+	}
+	err := db.View(func(txn *badger.Txn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.PrefetchValues = false
+		opt.Prefix = s.logPrefix
+		it := txn.NewIterator(opt)
+		defer it.Close()
+		it.Rewind()
+		if !it.Valid() {
+			return nil
+		}
+		s.first.Store(s.index(it.Item().Key()))
+
+		opt.Reverse = true
+		rit := txn.NewIterator(opt)
+		defer rit.Close()
+		rit.Seek(s.logKey(math.MaxUint64))
+		if rit.Valid() {
+			s.last.Store(s.index(rit.Item().Key()))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) logKey(index uint64) []byte {
+	return binary.BigEndian.AppendUint64(append([]byte(nil), s.logPrefix...), index)
+}
+
+func (s *Store) index(key []byte) uint64 {
+	return binary.BigEndian.Uint64(key[len(s.logPrefix):])
+}
+
+func (s *Store) stableKey(key []byte) []byte {
+	return append(append([]byte(nil), s.stablePrefix...), key...)
+}
+
+// FirstIndex returns the index of the first entry of the log, or 0 if it's empty.
+func (s *Store) FirstIndex() (uint64, error) {
+	return s.first.Load(), nil
+}
+
+// LastIndex returns the index of the last entry of the log, or 0 if it's empty.
+func (s *Store) LastIndex() (uint64, error) {
+	return s.last.Load(), nil
+}
+
+// GetLog reads the entry at index into log. It returns ErrLogNotFound if there is none.
+func (s *Store) GetLog(index uint64, log *Log) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(s.logKey(index))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrLogNotFound
+		} else if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return log.decode(index, val)
+		})
+	})
+}
+
+// StoreLog appends log to the log.
+func (s *Store) StoreLog(log *Log) error {
+	return s.StoreLogs([]*Log{log})
+}
+
+// StoreLogs appends logs, by ascending indexes, to the log. The entries are written in as few
+// transactions as they fit in, in order, so that the log has no gaps after a crash.
+func (s *Store) StoreLogs(logs []*Log) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.storeLogs(logs); err != nil {
+		return err
+	}
+	if first := s.first.Load(); first == 0 || logs[0].Index < first {
+		s.first.Store(logs[0].Index)
+	}
+	if last := logs[len(logs)-1].Index; last > s.last.Load() {
+		s.last.Store(last)
+	}
+	return nil
+}
+
+func (s *Store) storeLogs(logs []*Log) error {
+	txn := s.db.NewTransaction(true)
+	defer func() { txn.Discard() }()
+	for _, l := range logs {
+		key, val := s.logKey(l.Index), l.encode()
+		err := txn.Set(key, val)
+		if errors.Is(err, badger.ErrTxnTooBig) {
+			if err = txn.Commit(); err != nil {
+				return err
+			}
+			txn = s.db.NewTransaction(true)
+			err = txn.Set(key, val)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return txn.Commit()
+}
+
+// DeleteRange deletes the entries from min to max, inclusive. Raft libraries delete a prefix of
+// the log once it's in a snapshot, and a suffix when it conflicts with the log of the leader.
+// Whatever the number of entries, they are deleted by a single range tombstone, see
+// badger.Txn.DeleteRange, which the DB keeps until the compactions drop them. Only the indexes of
+// the log are covered, so that the tombstones of successive truncations don't overlap.
+func (s *Store) DeleteRange(min, max uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	first, last := s.first.Load(), s.last.Load()
+	if first == 0 || min > last || max < first || min > max {
+		return nil
+	}
+	lo, hi := first, last
+	if min > first {
+		lo = min
+	}
+	if max < last {
+		hi = max
+	}
+	end := s.logKey(hi + 1)
+	if hi == math.MaxUint64 {
+		end = append(append([]byte(nil), s.logPrefix[:len(s.logPrefix)-1]...), 'l'+1)
+	}
+	if err := s.db.Update(func(txn *badger.Txn) error {
+		return txn.DeleteRange(s.logKey(lo), end)
+	}); err != nil {
+		return err
+	}
+
+	switch {
+	case lo == first && hi == last:
+		s.first.Store(0)
+		s.last.Store(0)
+	case lo == first:
+		s.first.Store(hi + 1)
+	case hi == last:
+		s.last.Store(lo - 1)
+	}
+	return nil
+}
+
+// Entries returns the entries from lo, inclusive, to hi, exclusive, up to maxSize bytes of data
+// but at least one, like the Storage of etcd-raft.
+func (s *Store) Entries(lo, hi, maxSize uint64) ([]Log, error) {
+	first, last := s.first.Load(), s.last.Load()
+	switch {
+	case lo >= hi:
+		return nil, nil
+	case first == 0 || lo < first:
+		return nil, ErrCompacted
+	case hi > last+1:
+		return nil, ErrUnavailable
+	}
+	var logs []Log
+	var size uint64
+	err := s.db.View(func(txn *badger.Txn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.Prefix = s.logPrefix
+		opt.PrefetchSize = min(int(hi-lo), opt.PrefetchSize)
+		it := txn.NewIterator(opt)
+		defer it.Close()
+		end := s.logKey(hi)
+		for it.Seek(s.logKey(lo)); it.Valid(); it.Next() {
+			item := it.Item()
+			if bytes.Compare(item.Key(), end) >= 0 {
+				break
+			}
+			index := s.index(item.Key())
+			if index != lo+uint64(len(logs)) {
+				return fmt.Errorf("%w: index %d", ErrUnavailable, lo+uint64(len(logs)))
+			}
+			var l Log
+			if err := item.Value(func(val []byte) error {
+				return l.decode(index, val)
+			}); err != nil {
+				return err
+			}
+			size += uint64(len(l.Data))
+			if len(logs) > 0 && size > maxSize {
+				break
+			}
+			logs = append(logs, l)
+		}
+		return nil
+	})
+	return logs, err
+}
+
+// Term returns the term of the entry at index.
+func (s *Store) Term(index uint64) (uint64, error) {
+	first, last := s.first.Load(), s.last.Load()
+	switch {
+	case first == 0 || index < first:
+		return 0, ErrCompacted
+	case index > last:
+		return 0, ErrUnavailable
+	}
+	var l Log
+	if err := s.GetLog(index, &l); err != nil {
+		return 0, err
+	}
+	return l.Term, nil
+}
+
+// Append appends logs, by ascending indexes, to the log, after deleting the entries from the
+// first of them on, like the MemoryStorage of etcd-raft.
+func (s *Store) Append(logs []*Log) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	if last := s.last.Load(); last >= logs[0].Index {
+		if err := s.DeleteRange(logs[0].Index, last); err != nil {
+			return err
+		}
+	}
+	return s.StoreLogs(logs)
+}
+
+// Compact deletes the entries before index, once they're in a snapshot.
+func (s *Store) Compact(index uint64) error {
+	first := s.first.Load()
+	if first == 0 || index <= first {
+		return nil
+	}
+	return s.DeleteRange(first, index-1)
+}
+
+// Set sets key of the stable state to val.
+func (s *Store) Set(key, val []byte) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(s.stableKey(key), val)
+	})
+}
+
+// Get returns the value of key of the stable state, or ErrKeyNotFound if it isn't set.
+func (s *Store) Get(key []byte) ([]byte, error) {
+	var val []byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(s.stableKey(key))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrKeyNotFound
+		} else if err != nil {
+			return err
+		}
+		val, err = item.ValueCopy(nil)
+		return err
+	})
+	return val, err
+}
+
+// SetUint64 sets key of the stable state to val.
+func (s *Store) SetUint64(key []byte, val uint64) error {
+	return s.Set(key, binary.BigEndian.AppendUint64(nil, val))
+}
+
+// GetUint64 returns the value of key of the stable state set by SetUint64, or ErrKeyNotFound if
+// it isn't set.
+func (s *Store) GetUint64(key []byte) (uint64, error) {
+	val, err := s.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	if len(val) != 8 {
+		return 0, fmt.Errorf("raftstore: value of %q isn't a uint64", key)
+	}
+	return binary.BigEndian.Uint64(val), nil
+}
@@ -0,0 +1,115 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package raftstore
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	badger "github.com/luxfi/zapdb"
+)
+
+func TestStore(t *testing.T) {
+	opt := badger.DefaultOptions(t.TempDir()).WithLogger(nil)
+	db, err := badger.Open(opt)
+	require.NoError(t, err)
+
+	s, err := New(db, []byte("raft/"))
+	require.NoError(t, err)
+	first, err := s.FirstIndex()
+	require.NoError(t, err)
+	require.Zero(t, first)
+
+	var logs []*Log
+	for i := uint64(1); i <= 100; i++ {
+		logs = append(logs, &Log{Index: i, Term: i / 10, Data: []byte(fmt.Sprint(i)),
+			AppendedAt: time.Unix(int64(i), 0)})
+	}
+	require.NoError(t, s.StoreLogs(logs))
+	var l Log
+	require.NoError(t, s.GetLog(42, &l))
+	require.Equal(t, *logs[41], l)
+	require.ErrorIs(t, s.GetLog(101, &l), ErrLogNotFound)
+
+	// Truncating a prefix and a suffix updates the cached indexes.
+	require.NoError(t, s.Compact(11))
+	require.NoError(t, s.Append([]*Log{{Index: 91, Term: 20}, {Index: 92, Term: 20}}))
+	first, _ = s.FirstIndex()
+	last, _ := s.LastIndex()
+	require.Equal(t, uint64(11), first)
+	require.Equal(t, uint64(92), last)
+	_, err = s.Term(10)
+	require.ErrorIs(t, err, ErrCompacted)
+	term, err := s.Term(91)
+	require.NoError(t, err)
+	require.Equal(t, uint64(20), term)
+
+	entries, err := s.Entries(11, 93, 1<<20)
+	require.NoError(t, err)
+	require.Len(t, entries, 82)
+	entries, err = s.Entries(11, 20, 1)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	_, err = s.Entries(11, 94, 1<<20)
+	require.ErrorIs(t, err, ErrUnavailable)
+
+	require.NoError(t, s.SetUint64([]byte("CurrentTerm"), 20))
+	_, err = s.Get([]byte("LastVote"))
+	require.ErrorIs(t, err, ErrKeyNotFound)
+
+	// The indexes and the stable state are read back after a restart.
+	require.NoError(t, db.Close())
+	db, err = badger.Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	s, err = New(db, []byte("raft/"))
+	require.NoError(t, err)
+	first, _ = s.FirstIndex()
+	last, _ = s.LastIndex()
+	require.Equal(t, uint64(11), first)
+	require.Equal(t, uint64(92), last)
+	term, err = s.GetUint64([]byte("CurrentTerm"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(20), term)
+
+	require.NoError(t, s.DeleteRange(0, math.MaxUint64))
+	last, _ = s.LastIndex()
+	require.Zero(t, last)
+	require.ErrorIs(t, s.GetLog(50, &l), ErrLogNotFound)
+}
+
+func TestStoreTruncateLarge(t *testing.T) {
+	opt := badger.DefaultOptions(t.TempDir()).WithLogger(nil).WithMemTableSize(1 << 20).
+		WithValueThreshold(1 << 10)
+	db, err := badger.Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	s, err := New(db, []byte("raft/"))
+	require.NoError(t, err)
+
+	// The entries truncated don't fit in a transaction.
+	var logs []*Log
+	for i := uint64(1); i <= 20000; i++ {
+		logs = append(logs, &Log{Index: i, Data: make([]byte, 100)})
+	}
+	require.NoError(t, s.StoreLogs(logs))
+	require.NoError(t, s.Compact(19000))
+	require.NoError(t, s.DeleteRange(19500, 20000))
+	first, _ := s.FirstIndex()
+	last, _ := s.LastIndex()
+	require.Equal(t, uint64(19000), first)
+	require.Equal(t, uint64(19499), last)
+	var l Log
+	require.ErrorIs(t, s.GetLog(18999, &l), ErrLogNotFound)
+	require.NoError(t, s.GetLog(19000, &l))
+	entries, err := s.Entries(19000, 19500, math.MaxUint64)
+	require.NoError(t, err)
+	require.Len(t, entries, 500)
+}
@@ -23,12 +23,14 @@ import (
 
 	humanize "github.com/dustin/go-humanize"
 
+	"github.com/luxfi/zapdb/failpoint"
 	"github.com/luxfi/zapdb/fb"
 	"github.com/luxfi/zapdb/options"
 	"github.com/luxfi/zapdb/pb"
 	"github.com/luxfi/zapdb/skl"
 	"github.com/luxfi/zapdb/table"
 	"github.com/luxfi/zapdb/y"
+	"github.com/luxfi/zapdb/y/vfs"
 	"github.com/dgraph-io/ristretto/v2"
 	"github.com/dgraph-io/ristretto/v2/z"
 )
@@ -47,6 +49,16 @@ type closers struct {
 	valueGC     *z.Closer
 	pub         *z.Closer
 	cacheHealth *z.Closer
+	syncer      *z.Closer
+	qos         *z.Closer
+	stats       *z.Closer
+	lifecycle   *z.Closer
+	gcScheduler *z.Closer
+	heatmap     *z.Closer
+	maintenance *z.Closer
+	warm        *z.Closer
+	refresh     *z.Closer
+	memtableAge *z.Closer
 }
 
 type lockedKeys struct {
@@ -107,15 +119,115 @@ type DB struct {
 	blockWrites atomic.Int32
 	isClosed    atomic.Uint32
 
+	// Bytes written to the value log and WAL since the last sync. See Options.MaxUnsyncedBytes.
+	unsyncedBytes atomic.Int64
+	// unsyncedSince is the time in unix nanoseconds of the oldest write not synced yet, or zero.
+	unsyncedSince atomic.Int64
+	// replicatedAt is the time in unix nanoseconds of the leader at the last version a follower
+	// applied, see ReplicationLag.
+	replicatedAt atomic.Int64
+	unsyncedCh    chan struct{}
+	// memtableStall tracks the stalls of the writes waiting for a memtable to be flushed.
+	memtableStall stallTracker
+	// asyncWrites holds a slot for every write of ApplyAsync in flight.
+	asyncWrites chan struct{}
+
+	recovery RecoveryReport // Written only while opening the DB.
+	events   *flightRecorder
+	qos      *compactionQoS
+	pipeline *writePipeline
+	prefetch *prefetchBudget
+	heatmap  *heatmap
+	metrics  *y.MetricsSet
+
+	// maintenance are the windows of Options.MaintenanceWindows.
+	maintenance []*maintenanceWindow
+	// pins are the versions read by ViewAt.
+	pins versionPins
+	// refreshLock serializes the calls to Refresh.
+	refreshLock sync.Mutex
+	// moveLock serializes the calls to MovePrefix.
+	moveLock sync.Mutex
+
 	orc              *oracle
 	bannedNamespaces *lockedKeys
 	threshold        *vlogThreshold
 
 	pub        *publisher
 	registry   *KeyRegistry
-	blockCache *ristretto.Cache[[]byte, *table.Block]
+	blockCache table.BlockCache
 	indexCache *ristretto.Cache[uint64, *fb.TableIndex]
 	allocPool  *z.AllocatorPool
+
+	// cacheID sets the keys of the DB apart in caches shared through a Manager.
+	cacheID uint32
+	// compactionQuota bounds the compactions of the DB running at once, if set by a Manager.
+	compactionQuota chan struct{}
+
+	// columnFamilies are the column families of Options.ColumnFamilies, by name.
+	columnFamilies map[string]*ColumnFamily
+
+	// shadow mirrors the writes to the DB, if set by NewShadow.
+	shadow atomic.Pointer[Shadow]
+
+	// mergeOps are the merge operators registered with RegisterMergeOperator.
+	mergeOps mergeOperators
+
+	rangeDels rangeTombstones
+
+	// transformers encode and decode the values of Options.ValueTransformers.
+	transformers valueTransformers
+
+	// staleReads holds the snapshot of ViewStale.
+	staleReads staleReads
+
+	// dicts are the compression dictionaries of TrainCompressionDictionary. dictLock serializes
+	// their training.
+	dicts    atomic.Pointer[compressionDictionaries]
+	dictLock sync.Mutex
+
+	// lifecycle are the policies of SetLifecyclePolicy. lifecycleLock serializes their updates.
+	lifecycle     atomic.Pointer[lifecyclePolicies]
+	lifecycleLock sync.Mutex
+
+	// runtime are the options of SetRuntimeOptions. runtimeLock serializes their updates.
+	runtime     atomic.Pointer[RuntimeOptions]
+	runtimeLock sync.Mutex
+
+	// ingest is the session of BeginIngest running, if any, guarded by ingestLock.
+	ingest     *IngestSession
+	ingestLock sync.Mutex
+
+	// warmed is closed once the tables are loaded into the block cache, with StagedOpen.
+	warmed    chan struct{}
+	warmTotal int
+}
+
+// newIndexCache returns an index cache of size bytes, or nil if size is zero.
+func newIndexCache(size, memTableSize int64) (*ristretto.Cache[uint64, *fb.TableIndex], error) {
+	if size <= 0 {
+		return nil, nil
+	}
+	// Index size is around 5% of the table size.
+	indexSz := int64(float64(memTableSize) * 0.05)
+	numInCache := size / max(indexSz, 1)
+	if numInCache == 0 {
+		// Make the value of this variable at least one since the cache requires
+		// the number of counters to be greater than zero.
+		numInCache = 1
+	}
+
+	config := ristretto.Config[uint64, *fb.TableIndex]{
+		NumCounters: numInCache * 8,
+		MaxCost:     size,
+		BufferItems: 64,
+		Metrics:     true,
+	}
+	cache, err := ristretto.NewCache(&config)
+	if err != nil {
+		return nil, y.Wrap(err, "failed to create bf cache")
+	}
+	return cache, nil
 }
 
 const (
@@ -133,6 +245,29 @@ func checkAndSetOptions(opt *Options) error {
 	if opt.InMemory && (opt.Dir != "" || opt.ValueDir != "") {
 		return errors.New("Cannot use badger in Disk-less mode with Dir or ValueDir set")
 	}
+	if opt.InMemory && (opt.ColdStorageDir != "" || opt.RemoteTableStore != nil) {
+		return errors.New("Cannot use badger in Disk-less mode with ColdStorageDir or " +
+			"RemoteTableStore set")
+	}
+	if opt.ColdStorageDir != "" && opt.RemoteTableStore != nil {
+		return errors.New("Cannot set both ColdStorageDir and RemoteTableStore")
+	}
+	if r := opt.ValueLogGCPolicy.DiscardRatio; r < 0 || r >= 1 {
+		return errors.New("Invalid ValueLogGCPolicy.DiscardRatio, must be within range of [0, 1)")
+	}
+	if opt.ColdStorageLevel < 0 || opt.ColdStorageLevel >= opt.MaxLevels {
+		return fmt.Errorf("Invalid ColdStorageLevel, must be within range of 0-%d",
+			opt.MaxLevels-1)
+	}
+	if opt.HeatmapSampleRate < 0 || opt.HeatmapSampleRate > 1 {
+		return errors.New("Invalid HeatmapSampleRate, must be within range of [0, 1]")
+	}
+	if opt.HeatmapSampleRate > 0 && opt.HeatmapPrefixLen <= 0 {
+		return errors.New("Invalid HeatmapPrefixLen, must be positive")
+	}
+	if opt.MemTableMaxEntries < 0 || opt.MemTableMaxValueLogFiles < 0 || opt.MemTableMaxAge < 0 {
+		return errors.New("Invalid memtable flush trigger, must not be negative")
+	}
 	opt.maxBatchSize = (15 * opt.MemTableSize) / 100
 	opt.maxBatchCount = opt.maxBatchSize / int64(skl.MaxNodeSize)
 
@@ -161,23 +296,89 @@ func checkAndSetOptions(opt *Options) error {
 		return ErrValueLogSize
 	}
 
+	if opt.MaxKeySize < 0 || opt.MaxKeySize > maxKeySize {
+		return fmt.Errorf("Invalid MaxKeySize, must be within range of 0-%d", maxKeySize)
+	}
+	if opt.MaxValueSize < 0 || opt.MaxValueSize > opt.ValueLogFileSize {
+		return fmt.Errorf("Invalid MaxValueSize, must be within range of 0-%d (ValueLogFileSize)",
+			opt.ValueLogFileSize)
+	}
+	if opt.MaxKeySize == 0 {
+		opt.MaxKeySize = maxKeySize
+	}
+	if opt.MaxValueSize == 0 {
+		opt.MaxValueSize = opt.ValueLogFileSize
+	}
+	if opt.ValueSplitSize < 0 || opt.ValueSplitSize > opt.MaxValueSize {
+		return fmt.Errorf("Invalid ValueSplitSize, must be within range of 0-%d (MaxValueSize)",
+			opt.MaxValueSize)
+	}
+
 	if opt.ReadOnly {
 		// Do not perform compaction in read only mode.
 		opt.CompactL0OnClose = false
 	}
 
+	if err := resolveSyncPolicies(opt); err != nil {
+		return err
+	}
+
+	if opt.KeyProvider != nil {
+		if len(opt.EncryptionKey) > 0 {
+			return errors.New("Cannot set both EncryptionKey and KeyProvider")
+		}
+		key, err := opt.KeyProvider.GetMasterKey(context.Background())
+		if err != nil {
+			return y.Wrapf(err, "While getting master key from KeyProvider")
+		}
+		opt.EncryptionKey = key
+	}
+
 	needCache := (opt.Compression != options.None) || (len(opt.EncryptionKey) > 0)
+	for name, cfo := range opt.ColumnFamilies {
+		if err := checkColumnFamilyName(name); err != nil {
+			return err
+		}
+		needCache = needCache || cfo.Compression != options.None
+	}
 	if needCache && opt.BlockCacheSize == 0 {
 		panic("BlockCacheSize should be set since compression/encryption are enabled")
 	}
 	return nil
 }
 
+// numMemoryDBs numbers the metrics of InMemory DBs without a MetricsLabel.
+var numMemoryDBs atomic.Int64
+
+func metricsLabel(opt Options) string {
+	switch {
+	case opt.MetricsLabel != "":
+		return opt.MetricsLabel
+	case opt.InMemory:
+		return fmt.Sprintf("memory-%d", numMemoryDBs.Add(1))
+	}
+	return opt.Dir
+}
+
+// LatencyHistograms returns the latency histograms of this DB, keyed by operation: "get",
+// "put", "commit", "iterator_seek" and "compaction". It returns nil if MetricsEnabled is not set.
+func (db *DB) LatencyHistograms() map[string]y.HistogramSnapshot {
+	return db.metrics.LatencySnapshots()
+}
+
 // Open returns a new DB object.
 func Open(opt Options) (*DB, error) {
 	if err := checkAndSetOptions(&opt); err != nil {
 		return nil, err
 	}
+	transformers, err := newValueTransformers(opt.ValueTransformers)
+	if err != nil {
+		return nil, err
+	}
+	maintenance, err := newMaintenanceWindows(opt.MaintenanceWindows)
+	if err != nil {
+		return nil, err
+	}
 	var dirLockGuard, valueDirLockGuard *directoryLockGuard
 
 	// Create directories and acquire lock on it only if badger is not running in InMemory mode.
@@ -220,10 +421,12 @@ func Open(opt Options) (*DB, error) {
 		}
 	}
 
+	opt.openProgress(OpenStageManifest, 0, 1)
 	manifestFile, manifest, err := openOrCreateManifestFile(opt)
 	if err != nil {
 		return nil, err
 	}
+	opt.openProgress(OpenStageManifest, 1, 1)
 	defer func() {
 		if manifestFile != nil {
 			_ = manifestFile.close()
@@ -243,9 +446,21 @@ func Open(opt Options) (*DB, error) {
 		allocPool:        z.NewAllocatorPool(8),
 		bannedNamespaces: &lockedKeys{keys: make(map[uint64]struct{})},
 		threshold:        initVlogThreshold(&opt),
+		unsyncedCh:       make(chan struct{}, 1),
+		asyncWrites:      make(chan struct{}, max(opt.MaxAsyncWrites, 1)),
+		metrics:          y.NewMetricsSet(metricsLabel(opt), opt.MetricsEnabled, opt.LatencyBuckets),
+		events:           newFlightRecorder(opt.FlightRecorderSize),
+		pipeline:         newWritePipeline(),
+		heatmap:          newHeatmap(opt),
+		prefetch:         newPrefetchBudget(opt.MaxPrefetchMemory),
+		transformers:     transformers,
+		maintenance:      maintenance,
+		warmed:           make(chan struct{}),
 	}
 
 	db.syncChan = opt.syncChan
+	db.runtime.Store(opt.runtimeOptions())
+	db.columnFamilies = newColumnFamilies(db)
 
 	// Cleanup all the goroutines started by badger in case of an error.
 	defer func() {
@@ -256,51 +471,28 @@ func Open(opt Options) (*DB, error) {
 		}
 	}()
 
-	if opt.BlockCacheSize > 0 {
-		numInCache := opt.BlockCacheSize / int64(opt.BlockSize)
-		if numInCache == 0 {
-			// Make the value of this variable at least one since the cache requires
-			// the number of counters to be greater than zero.
-			numInCache = 1
-		}
-
-		config := ristretto.Config[[]byte, *table.Block]{
-			NumCounters: numInCache * 8,
-			MaxCost:     opt.BlockCacheSize,
-			BufferItems: 64,
-			Metrics:     true,
-			OnExit:      table.BlockEvictHandler,
-		}
-		db.blockCache, err = ristretto.NewCache[[]byte, *table.Block](&config)
-		if err != nil {
-			return nil, y.Wrap(err, "failed to create data cache")
-		}
-	}
-
-	if opt.IndexCacheSize > 0 {
-		// Index size is around 5% of the table size.
-		indexSz := int64(float64(opt.MemTableSize) * 0.05)
-		numInCache := opt.IndexCacheSize / indexSz
-		if numInCache == 0 {
-			// Make the value of this variable at least one since the cache requires
-			// the number of counters to be greater than zero.
-			numInCache = 1
+	if m := opt.manager; m != nil {
+		db.blockCache, db.indexCache = m.blockCache, m.indexCache
+		db.cacheID = m.nextCacheID()
+		if m.opt.MaxCompactionsPerDB > 0 {
+			db.compactionQuota = make(chan struct{}, m.opt.MaxCompactionsPerDB)
 		}
-
-		config := ristretto.Config[uint64, *fb.TableIndex]{
-			NumCounters: numInCache * 8,
-			MaxCost:     opt.IndexCacheSize,
-			BufferItems: 64,
-			Metrics:     true,
+	} else {
+		if opt.BlockCache != nil {
+			db.blockCache = opt.BlockCache
+			db.cacheID = blockCacheIDs.Add(1)
+		} else if db.blockCache, err = newBlockCache(opt.BlockCacheSize, opt.BlockSize,
+			opt.BlockCacheShards); err != nil {
+			return nil, err
 		}
-		db.indexCache, err = ristretto.NewCache(&config)
-		if err != nil {
-			return nil, y.Wrap(err, "failed to create bf cache")
+		if db.indexCache, err = newIndexCache(opt.IndexCacheSize, opt.MemTableSize); err != nil {
+			return nil, err
 		}
 	}
 
 	db.closers.cacheHealth = z.NewCloser(1)
 	go db.monitorCache(db.closers.cacheHealth)
+	db.publishGauges()
 
 	if db.opt.InMemory {
 		db.opt.SyncWrites = false
@@ -313,11 +505,22 @@ func Open(opt Options) (*DB, error) {
 		EncryptionKey:                 opt.EncryptionKey,
 		EncryptionKeyRotationDuration: opt.EncryptionKeyRotationDuration,
 		InMemory:                      opt.InMemory,
+		EncryptionAlgo:                opt.EncryptionAlgo,
 	}
 
 	if db.registry, err = OpenKeyRegistry(krOpt); err != nil {
 		return db, err
 	}
+	dicts, err := newCompressionDictionaries(manifest.Dictionaries, manifest.levelDictionaries(), opt)
+	if err != nil {
+		return db, err
+	}
+	db.dicts.Store(dicts)
+	lifecycle, err := decodeLifecyclePolicies(manifest.Lifecycle)
+	if err != nil {
+		return db, err
+	}
+	db.lifecycle.Store(lifecycle)
 	db.calculateSize()
 	db.closers.updateSize = z.NewCloser(1)
 	go db.updateSize(db.closers.updateSize)
@@ -343,6 +546,10 @@ func Open(opt Options) (*DB, error) {
 	if !opt.ReadOnly {
 		db.closers.compactors = z.NewCloser(1)
 		db.lc.startCompact(db.closers.compactors)
+		if db.qos = newCompactionQoS(db); db.qos != nil {
+			db.closers.qos = z.NewCloser(1)
+			go db.qos.run(db.closers.qos)
+		}
 
 		db.closers.memtable = z.NewCloser(1)
 		go func() {
@@ -351,6 +558,7 @@ func Open(opt Options) (*DB, error) {
 		// Flush them to disk asap.
 		for _, mt := range db.imm {
 			db.flushChan <- mt
+			db.metrics.NumMemtableFlushesAdd(flushCauseReplay, 1)
 		}
 	}
 	// We do increment nextTxnTs below. So, no need to do it here.
@@ -367,6 +575,10 @@ func Open(opt Options) (*DB, error) {
 	// In normal mode, we must update readMark so older versions of keys can be removed during
 	// compaction when run in offline mode via the flatten tool.
 	db.orc.readMark.Done(db.orc.nextTxnTs)
+	if !db.opt.managedTxns {
+		// The previous runs of the DB may have purged the versions up to then.
+		db.pins.bound(db.gcWatermark(db.orc.nextTxnTs))
+	}
 	db.orc.incrementNextTs()
 
 	go db.threshold.listenForValueThresholdUpdate()
@@ -374,6 +586,12 @@ func Open(opt Options) (*DB, error) {
 	if err := db.initBannedNamespaces(); err != nil {
 		return db, fmt.Errorf("While setting banned keys: %w", err)
 	}
+	if err := db.initRangeTombstones(); err != nil {
+		return db, fmt.Errorf("While loading range tombstones: %w", err)
+	}
+	if err := db.initPreparedTxns(); err != nil {
+		return db, err
+	}
 
 	db.closers.writes = z.NewCloser(1)
 	go db.doWrites(db.closers.writes)
@@ -386,6 +604,49 @@ func Open(opt Options) (*DB, error) {
 	db.closers.pub = z.NewCloser(1)
 	go db.pub.listenForUpdates(db.closers.pub)
 
+	if db.needsPeriodicSync() {
+		db.closers.syncer = z.NewCloser(1)
+		go db.periodicSync(db.closers.syncer)
+	}
+
+	if !db.opt.ReadOnly && db.opt.StatsHistoryInterval > 0 {
+		db.closers.stats = z.NewCloser(1)
+		go (&statsHistory{db: db}).run(db.closers.stats)
+	}
+	if !db.opt.ReadOnly && !db.opt.managedTxns && db.opt.LifecycleInterval > 0 {
+		db.closers.lifecycle = z.NewCloser(1)
+		go (&lifecycleJob{db: db}).run(db.closers.lifecycle)
+	}
+	if db.heatmap != nil && !db.opt.managedTxns {
+		if err := db.heatmap.load(db); err != nil {
+			return db, y.Wrap(err, "while loading heatmap")
+		}
+		if !db.opt.ReadOnly && db.opt.HeatmapInterval > 0 {
+			db.closers.heatmap = z.NewCloser(1)
+			go db.heatmap.run(db, db.closers.heatmap)
+		}
+	}
+	if !db.opt.InMemory && !db.opt.ReadOnly && db.opt.ValueLogGCPolicy.Interval > 0 {
+		db.closers.gcScheduler = z.NewCloser(1)
+		go db.vlog.runGCScheduler(db.closers.gcScheduler)
+	}
+	if !db.opt.ReadOnly && len(db.maintenance) > 0 {
+		db.closers.maintenance = z.NewCloser(1)
+		go db.runMaintenance(db.closers.maintenance)
+	}
+	if db.opt.ReadOnly && !db.opt.InMemory && db.opt.asOf == 0 && db.opt.RefreshInterval > 0 {
+		db.closers.refresh = z.NewCloser(1)
+		go db.runRefresh(db.closers.refresh)
+	}
+	if !db.opt.ReadOnly && db.opt.MemTableMaxAge > 0 {
+		db.closers.memtableAge = z.NewCloser(1)
+		go db.runMemTableAge(db.closers.memtableAge)
+	}
+
+	deep := db.warmLevelZero()
+	db.opt.openProgress(OpenStageReady, 1, 1)
+	db.warmDeepLevels(deep)
+
 	valueDirLockGuard = nil
 	dirLockGuard = nil
 	manifestFile = nil
@@ -464,20 +725,47 @@ func (db *DB) monitorCache(c *z.Closer) {
 		case <-ticker.C:
 		}
 
-		analyze("Block cache", db.BlockCacheMetrics())
+		shards := db.BlockCacheShardMetrics()
+		for i, metrics := range shards {
+			if len(shards) == 1 {
+				analyze("Block cache", metrics)
+			} else {
+				analyze(fmt.Sprintf("Block cache shard %d", i), metrics)
+			}
+		}
 		analyze("Index cache", db.IndexCacheMetrics())
 		count++
 	}
 }
 
+// closeCaches closes the caches of the DB, unless they are shared through a Manager.
+func (db *DB) closeCaches() {
+	if m := db.opt.manager; m != nil {
+		m.remove(db)
+		return
+	}
+	if db.blockCache != nil && db.opt.BlockCache == nil {
+		db.blockCache.Close()
+	}
+	db.indexCache.Close()
+}
+
 // cleanup stops all the goroutines started by badger. This is used in open to
 // cleanup goroutines in case of an error.
 func (db *DB) cleanup() {
 	db.stopMemoryFlush()
 	db.stopCompactions()
+	if db.opt.ReadOnly {
+		// Nothing is flushed in read-only mode. Release the memtables replayed, and their WALs.
+		db.lock.Lock()
+		for _, mt := range db.imm {
+			mt.DecrRef()
+		}
+		db.imm = nil
+		db.lock.Unlock()
+	}
 
-	db.blockCache.Close()
-	db.indexCache.Close()
+	db.closeCaches()
 	if db.closers.updateSize != nil {
 		db.closers.updateSize.Signal()
 	}
@@ -490,6 +778,12 @@ func (db *DB) cleanup() {
 	if db.closers.pub != nil {
 		db.closers.pub.Signal()
 	}
+	if db.closers.syncer != nil {
+		db.closers.syncer.Signal()
+	}
+	if db.closers.qos != nil {
+		db.closers.qos.Signal()
+	}
 
 	db.orc.Stop()
 
@@ -497,14 +791,21 @@ func (db *DB) cleanup() {
 	// want to truncate files unless the user has specified the truncate flag.
 }
 
-// BlockCacheMetrics returns the metrics for the underlying block cache.
+// BlockCacheMetrics returns the metrics for the underlying block cache. It returns nil if the
+// cache is sharded, see BlockCacheShardMetrics, or isn't a ristretto cache.
 func (db *DB) BlockCacheMetrics() *ristretto.Metrics {
-	if db.blockCache != nil {
-		return db.blockCache.Metrics
+	if ms := blockCacheMetrics(db.blockCache); len(ms) == 1 {
+		return ms[0]
 	}
 	return nil
 }
 
+// BlockCacheShardMetrics returns the metrics of the shards of the block cache, or of the cache
+// itself if it isn't sharded. It returns nil if the cache isn't a ristretto cache.
+func (db *DB) BlockCacheShardMetrics() []*ristretto.Metrics {
+	return blockCacheMetrics(db.blockCache)
+}
+
 // IndexCacheMetrics returns the metrics for the underlying index cache.
 func (db *DB) IndexCacheMetrics() *ristretto.Metrics {
 	if db.indexCache != nil {
@@ -531,12 +832,39 @@ func (db *DB) IsClosed() bool {
 
 func (db *DB) close() (err error) {
 	defer db.allocPool.Release()
+	defer db.metrics.Unpublish()
 
 	db.opt.Debugf("Closing database")
+	unregisterDB(db)
 	db.opt.Infof("Lifetime L0 stalled for: %s\n", time.Duration(db.lc.l0stallsMs.Load()))
 
+	if db.closers.warm != nil {
+		db.closers.warm.SignalAndWait()
+	}
+	if db.closers.stats != nil {
+		db.closers.stats.SignalAndWait()
+	}
+	if db.closers.lifecycle != nil {
+		db.closers.lifecycle.SignalAndWait()
+	}
+	if db.closers.gcScheduler != nil {
+		db.closers.gcScheduler.SignalAndWait()
+	}
+	if db.closers.heatmap != nil {
+		db.closers.heatmap.SignalAndWait()
+	}
+	if db.closers.maintenance != nil {
+		db.closers.maintenance.SignalAndWait()
+	}
+	if db.closers.refresh != nil {
+		db.closers.refresh.SignalAndWait()
+	}
+	if db.closers.memtableAge != nil {
+		db.closers.memtableAge.SignalAndWait()
+	}
 	db.blockWrites.Store(1)
 	db.isClosed.Store(1)
+	db.dropStaleSnapshot()
 
 	if !db.opt.InMemory {
 		// Stop value GC first.
@@ -551,6 +879,12 @@ func (db *DB) close() (err error) {
 
 	db.closers.pub.SignalAndWait()
 	db.closers.cacheHealth.Signal()
+	if db.closers.syncer != nil {
+		db.closers.syncer.SignalAndWait()
+	}
+	if db.closers.qos != nil {
+		db.closers.qos.SignalAndWait()
+	}
 
 	// Make sure that block writer is done pushing stuff into memtable!
 	// Otherwise, you will have a race condition: we are trying to flush memtables
@@ -570,6 +904,7 @@ func (db *DB) close() (err error) {
 					y.AssertTrue(db.mt != nil)
 					select {
 					case db.flushChan <- db.mt:
+						db.metrics.NumMemtableFlushesAdd(flushCauseClose, 1)
 						db.imm = append(db.imm, db.mt) // Flusher will attempt to remove this from s.imm.
 						db.mt = nil                    // Will segfault if we try writing!
 						db.opt.Debugf("pushed to flush chan\n")
@@ -619,11 +954,15 @@ func (db *DB) close() (err error) {
 	db.opt.Debugf("Waiting for closer")
 	db.closers.updateSize.SignalAndWait()
 	db.orc.Stop()
-	db.blockCache.Close()
-	db.indexCache.Close()
+	db.closeCaches()
 
 	db.threshold.close()
 
+	if a := db.opt.archive; a != nil {
+		if archiveErr := a.close(); err == nil {
+			err = y.Wrap(archiveErr, "DB.Close")
+		}
+	}
 	if db.opt.InMemory {
 		return
 	}
@@ -697,9 +1036,12 @@ func (db *DB) Sync() error {
 	                    :: of data and then the machine shuts down or the disk failure happens,
 						:: this will result in partial writes. [[This case needs verification]]
 	*/
+	// Reset before syncing, so writes racing with the sync are aged from the next one.
+	db.unsyncedSince.Store(0)
 	db.lock.RLock()
 	memtableSyncError := db.mt.SyncWAL()
 	db.lock.RUnlock()
+	db.pipeline.countSync(db.metrics)
 
 	vLogSyncError := db.vlog.sync()
 	return y.CombineErrors(memtableSyncError, vLogSyncError)
@@ -712,8 +1054,8 @@ func (db *DB) getMemTables() ([]*memTable, func()) {
 
 	var tables []*memTable
 
-	// Mutable memtable does not exist in read-only mode.
-	if !db.opt.ReadOnly {
+	// Mutable memtable does not exist in read-only mode, nor once flushed by close.
+	if !db.opt.ReadOnly && db.mt != nil {
 		// Get mutable memtable.
 		tables = append(tables, db.mt)
 		db.mt.IncrRef()
@@ -756,16 +1098,16 @@ func (db *DB) get(key []byte) (y.ValueStruct, error) {
 	var maxVs y.ValueStruct
 	version := y.ParseTs(key)
 
-	y.NumGetsAdd(db.opt.MetricsEnabled, 1)
+	db.metrics.NumGetsAdd(1)
 	for i := 0; i < len(tables); i++ {
 		vs := tables[i].sl.Get(key)
-		y.NumMemtableGetsAdd(db.opt.MetricsEnabled, 1)
+		db.metrics.NumMemtableGetsAdd(1)
 		if vs.Meta == 0 && vs.Value == nil {
 			continue
 		}
 		// Found the required version of the key, return immediately.
 		if vs.Version == version {
-			y.NumGetsWithResultsAdd(db.opt.MetricsEnabled, 1)
+			db.metrics.NumGetsWithResultsAdd(1)
 			return vs, nil
 		}
 		if maxVs.Version < vs.Version {
@@ -789,6 +1131,7 @@ func (db *DB) writeToLSM(b *request) error {
 		return fmt.Errorf("Ptrs and Entries don't match: %+v", b)
 	}
 
+	start := time.Now()
 	for i, entry := range b.Entries {
 		var err error
 		if entry.skipVlogAndSetThreshold(db.valueThreshold()) {
@@ -817,13 +1160,43 @@ func (db *DB) writeToLSM(b *request) error {
 		if err != nil {
 			return y.Wrapf(err, "while writing to memTable")
 		}
+		if t, ok := parseRangeTombstone(entry.Key); ok {
+			db.rangeDels.add(t)
+		}
 	}
+	db.pipeline.memtableApply.observe(db.metrics, time.Since(start))
 	if db.opt.SyncWrites {
-		return db.mt.SyncWAL()
+		syncStart := time.Now()
+		err := db.mt.SyncWAL()
+		db.pipeline.sync.observe(db.metrics, time.Since(syncStart))
+		db.pipeline.countSync(db.metrics)
+		return err
 	}
 	return nil
 }
 
+// trackUnsynced accounts for bytes written without a sync, and wakes up the background syncer
+// once they exceed MaxUnsyncedBytes.
+func (db *DB) trackUnsynced(reqs []*request) {
+	if db.opt.SyncWrites || db.opt.InMemory {
+		return
+	}
+	var size int64
+	for _, req := range reqs {
+		size += int64(estimateRequestSize(req))
+	}
+	total := db.unsyncedBytes.Add(size)
+	if db.unsyncedSince.Load() == 0 {
+		db.unsyncedSince.CompareAndSwap(0, time.Now().UnixNano())
+	}
+	if db.opt.MaxUnsyncedBytes > 0 && total >= db.opt.MaxUnsyncedBytes {
+		select {
+		case db.unsyncedCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
 // writeRequests is called serially by only one goroutine.
 func (db *DB) writeRequests(reqs []*request) error {
 	if len(reqs) == 0 {
@@ -836,8 +1209,21 @@ func (db *DB) writeRequests(reqs []*request) error {
 			r.Wg.Done()
 		}
 	}
+	now := time.Now()
+	for _, r := range reqs {
+		if !r.enqueued.IsZero() {
+			db.pipeline.queueWait.observe(db.metrics, now.Sub(r.enqueued))
+		}
+	}
+
+	db.pipeline.observeBatch(db.metrics, reqs)
+	db.heatmap.recordWrites(reqs)
+
 	db.opt.Debugf("writeRequests called. Writing to value log")
 	err := db.vlog.write(reqs)
+	if err == nil {
+		err = failpoint.Inject(failpoint.AfterValueLogWrite)
+	}
 	if err != nil {
 		done(err)
 		return err
@@ -852,7 +1238,11 @@ func (db *DB) writeRequests(reqs []*request) error {
 		count += len(b.Entries)
 		var i uint64
 		var err error
+		var stallStart time.Time
 		for err = db.ensureRoomForWrite(); err == errNoRoom; err = db.ensureRoomForWrite() {
+			if i == 0 {
+				stallStart = db.memtableStall.start()
+			}
 			i++
 			if i%100 == 0 {
 				db.opt.Debugf("Making room for writes")
@@ -862,6 +1252,9 @@ func (db *DB) writeRequests(reqs []*request) error {
 			// you will get a deadlock.
 			time.Sleep(10 * time.Millisecond)
 		}
+		if i > 0 {
+			db.memtableStall.done(stallStart)
+		}
 		if err != nil {
 			done(err)
 			return y.Wrap(err, "writeRequests")
@@ -872,9 +1265,50 @@ func (db *DB) writeRequests(reqs []*request) error {
 		}
 	}
 
+	for _, r := range reqs {
+		cause := r.rotate
+		if cause == flushCauseAge {
+			// The memtable may have been flushed since the request was sent.
+			cause = db.mt.flushCause()
+		}
+		if cause == "" {
+			continue
+		}
+		var err error
+		for {
+			if r.rotated, err = db.rotateMemTable(cause); err != errNoRoom {
+				break
+			}
+			// Let the flusher make room, as above.
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			done(err)
+			return y.Wrap(err, "writeRequests")
+		}
+	}
+	for _, r := range reqs {
+		if r.fence != nil {
+			r.fence()
+		}
+	}
+
+	db.trackUnsynced(reqs)
+	db.events.record(EventCommit, int64(count), nil)
+	now = time.Now()
+	for _, r := range reqs {
+		if !r.enqueued.IsZero() {
+			db.metrics.LatencyObserve(y.LatencyPut, now.Sub(r.enqueued))
+		}
+	}
+
 	db.opt.Debugf("Sending updates to subscribers")
 	db.pub.sendUpdates(reqs)
 
+	if shadow := db.shadow.Load(); shadow != nil {
+		shadow.mirror(reqs)
+	}
+
 	done(nil)
 	db.opt.Debugf("%d entries written", count)
 	return nil
@@ -889,10 +1323,13 @@ func (db *DB) sendToWriteCh(entries []*Entry) (*request, error) {
 		size += e.estimateSizeAndSetThreshold(db.valueThreshold())
 		count++
 	}
-	y.NumBytesWrittenUserAdd(db.opt.MetricsEnabled, size)
+	db.metrics.NumBytesWrittenUserAdd(size)
 	if count >= db.opt.maxBatchCount || size >= db.opt.maxBatchSize {
 		return nil, ErrTxnTooBig
 	}
+	if l := db.opt.WriteRateLimiter; l != nil {
+		l.Wait(size)
+	}
 
 	// We can only service one request because we need each txn to be stored in a contiguous section.
 	// Txns should not interleave among other txns or rewrites.
@@ -900,9 +1337,10 @@ func (db *DB) sendToWriteCh(entries []*Entry) (*request, error) {
 	req.reset()
 	req.Entries = entries
 	req.Wg.Add(1)
-	req.IncrRef()     // for db write
+	req.IncrRef() // for db write
+	req.enqueued = time.Now()
 	db.writeCh <- req // Handled in doWrites.
-	y.NumPutsAdd(db.opt.MetricsEnabled, int64(len(entries)))
+	db.metrics.NumPutsAdd(int64(len(entries)))
 
 	return req, nil
 }
@@ -920,9 +1358,12 @@ func (db *DB) doWrites(lc *z.Closer) {
 
 	// This variable tracks the number of pending writes.
 	reqLen := new(expvar.Int)
-	y.PendingWritesSet(db.opt.MetricsEnabled, db.opt.Dir, reqLen)
+	db.metrics.PendingWritesSet(db.opt.Dir, reqLen)
 
 	reqs := make([]*request, 0, 10)
+	// window is done once the batch has waited GroupCommitWindow for more writes. A nil window
+	// doesn't wait.
+	var window <-chan time.Time
 	for {
 		var r *request
 		select {
@@ -930,6 +1371,9 @@ func (db *DB) doWrites(lc *z.Closer) {
 		case <-lc.HasBeenClosed():
 			goto closedCase
 		}
+		if db.opt.GroupCommitWindow > 0 {
+			window = time.After(db.opt.GroupCommitWindow)
+		}
 
 		for {
 			reqs = append(reqs, r)
@@ -940,6 +1384,17 @@ func (db *DB) doWrites(lc *z.Closer) {
 				goto writeCase
 			}
 
+			if window != nil {
+				select {
+				case r = <-db.writeCh:
+					continue
+				case <-window:
+					window = nil
+				case <-lc.HasBeenClosed():
+					goto closedCase
+				}
+			}
+
 			select {
 			// Either push to pending, or continue to pick from writeCh.
 			case r = <-db.writeCh:
@@ -968,6 +1423,7 @@ func (db *DB) doWrites(lc *z.Closer) {
 		go writeRequests(reqs)
 		reqs = make([]*request, 0, 10)
 		reqLen.Set(0)
+		window = nil
 	}
 }
 
@@ -1013,7 +1469,8 @@ func (db *DB) ensureRoomForWrite() error {
 	defer db.lock.Unlock()
 
 	y.AssertTrue(db.mt != nil) // A nil mt indicates that DB is being closed.
-	if !db.mt.isFull() {
+	cause := db.mt.flushCause()
+	if cause == "" {
 		return nil
 	}
 
@@ -1021,6 +1478,7 @@ func (db *DB) ensureRoomForWrite() error {
 	case db.flushChan <- db.mt:
 		db.opt.Debugf("Flushing memtable, mt.size=%d size of flushChan: %d\n",
 			db.mt.sl.MemSize(), len(db.flushChan))
+		db.metrics.NumMemtableFlushesAdd(cause, 1)
 		// We manage to push this task. Let's modify imm.
 		db.imm = append(db.imm, db.mt)
 		db.mt, err = db.newMemTable()
@@ -1035,6 +1493,66 @@ func (db *DB) ensureRoomForWrite() error {
 	}
 }
 
+// rotateMemTable is like ensureRoomForWrite, but hands the memtable to the flusher even if it
+// isn't full, for cause. It returns the last memtable to be flushed, or nil if there is none.
+func (db *DB) rotateMemTable(cause string) (*memTable, error) {
+	var err error
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.mt.sl.Empty() {
+		if len(db.imm) == 0 {
+			return nil, nil
+		}
+		return db.imm[len(db.imm)-1], nil
+	}
+	select {
+	case db.flushChan <- db.mt:
+		db.metrics.NumMemtableFlushesAdd(cause, 1)
+		mt := db.mt
+		db.imm = append(db.imm, db.mt)
+		db.mt, err = db.newMemTable()
+		if err != nil {
+			return nil, y.Wrapf(err, "cannot create new mem table")
+		}
+		return mt, nil
+	default:
+		return nil, errNoRoom
+	}
+}
+
+// runMemTableAge has the writer hand the memtable to the flusher once its first write is
+// Options.MemTableMaxAge old, checking every quarter of it, until lc is closed.
+func (db *DB) runMemTableAge(lc *z.Closer) {
+	defer lc.Done()
+	ticker := time.NewTicker(max(db.opt.MemTableMaxAge/4, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lc.HasBeenClosed():
+			return
+		case now := <-ticker.C:
+			db.lock.RLock()
+			age := sinceNanos(now, db.mt.firstWrite.Load())
+			db.lock.RUnlock()
+			if age < db.opt.MemTableMaxAge || db.blockWrites.Load() == 1 {
+				continue
+			}
+			req := requestPool.Get().(*request)
+			req.reset()
+			req.rotate = flushCauseAge
+			req.Wg.Add(1)
+			req.IncrRef()
+			db.writeCh <- req
+			req.Wg.Wait()
+			if req.Err != nil {
+				db.opt.Warningf("While flushing memtable by age: %v", req.Err)
+			}
+			req.DecrRef()
+		}
+	}
+}
+
 func arenaSize(opt Options) int64 {
 	return opt.MemTableSize + opt.maxBatchSize + opt.maxBatchCount*int64(skl.MaxNodeSize)
 }
@@ -1060,8 +1578,12 @@ func buildL0Table(iter y.Iterator, dropPrefixes [][]byte, bopts table.Options) *
 }
 
 // handleMemTableFlush must be run serially.
-func (db *DB) handleMemTableFlush(mt *memTable, dropPrefixes [][]byte) error {
+func (db *DB) handleMemTableFlush(mt *memTable, dropPrefixes [][]byte) (err error) {
+	db.events.record(EventFlushStart, mt.sl.MemSize(), nil)
+	defer func() { db.events.record(EventFlushDone, mt.sl.MemSize(), err) }()
+
 	bopts := buildTableOptions(db)
+	db.dicts.Load().setTableOptions(&bopts, 0)
 	itr := mt.sl.NewUniIterator(false)
 	builder := buildL0Table(itr, nil, bopts)
 	defer builder.Close()
@@ -1076,12 +1598,17 @@ func (db *DB) handleMemTableFlush(mt *memTable, dropPrefixes [][]byte) error {
 
 	fileID := db.lc.reserveFileID()
 	var tbl *table.Table
-	var err error
 	if db.opt.InMemory {
 		data := builder.Finish()
 		tbl, err = table.OpenInMemoryTable(data, fileID, &bopts)
 	} else {
 		tbl, err = table.CreateTable(table.NewFilename(fileID, db.opt.Dir), builder)
+		if err == nil && db.opt.TableSyncPolicy != options.SyncNever {
+			// The table must be visible after a crash before the MANIFEST refers to it.
+			if err = db.syncDir(db.opt.Dir); err != nil {
+				_ = tbl.DecrRef()
+			}
+		}
 	}
 	if err != nil {
 		return y.Wrap(err, "error while creating table")
@@ -1172,12 +1699,12 @@ func (db *DB) calculateSize() {
 	}
 
 	lsmSize, vlogSize := totalSize(db.opt.Dir)
-	y.LSMSizeSet(db.opt.MetricsEnabled, db.opt.Dir, newInt(lsmSize))
+	db.metrics.LSMSizeSet(db.opt.Dir, newInt(lsmSize))
 	// If valueDir is different from dir, we'd have to do another walk.
 	if db.opt.ValueDir != db.opt.Dir {
 		_, vlogSize = totalSize(db.opt.ValueDir)
 	}
-	y.VlogSizeSet(db.opt.MetricsEnabled, db.opt.ValueDir, newInt(vlogSize))
+	db.metrics.VlogSizeSet(db.opt.ValueDir, newInt(vlogSize))
 }
 
 func (db *DB) updateSize(lc *z.Closer) {
@@ -1230,6 +1757,9 @@ func (db *DB) RunValueLogGC(discardRatio float64) error {
 	if db.opt.InMemory {
 		return ErrGCInMemoryMode
 	}
+	if db.opt.ReadOnly {
+		return ErrReadOnlyDB
+	}
 	if discardRatio >= 1.0 || discardRatio <= 0.0 {
 		return ErrInvalidRequest
 	}
@@ -1241,12 +1771,12 @@ func (db *DB) RunValueLogGC(discardRatio float64) error {
 // Size returns the size of lsm and value log files in bytes. It can be used to decide how often to
 // call RunValueLogGC.
 func (db *DB) Size() (lsm, vlog int64) {
-	if y.LSMSizeGet(db.opt.MetricsEnabled, db.opt.Dir) == nil {
+	if db.metrics.LSMSizeGet(db.opt.Dir) == nil {
 		lsm, vlog = 0, 0
 		return
 	}
-	lsm = y.LSMSizeGet(db.opt.MetricsEnabled, db.opt.Dir).(*expvar.Int).Value()
-	vlog = y.VlogSizeGet(db.opt.MetricsEnabled, db.opt.ValueDir).(*expvar.Int).Value()
+	lsm = db.metrics.LSMSizeGet(db.opt.Dir).(*expvar.Int).Value()
+	vlog = db.metrics.VlogSizeGet(db.opt.ValueDir).(*expvar.Int).Value()
 	return
 }
 
@@ -1726,6 +2256,7 @@ func (db *DB) dropAll() (func(), error) {
 	if err != nil {
 		return resume, err
 	}
+	db.rangeDels.reset()
 	db.opt.Infof("Deleted %d SSTables. Now deleting value logs...\n", num)
 
 	num, err = db.vlog.dropAll()
@@ -1734,8 +2265,17 @@ func (db *DB) dropAll() (func(), error) {
 	}
 	db.lc.nextFileID.Store(1)
 	db.opt.Infof("Deleted %d value log files. DropAll done.\n", num)
-	db.blockCache.Clear()
-	db.indexCache.Clear()
+	if m := db.opt.manager; m != nil {
+		// Shared caches hold the entries of other DBs, so move to a fresh key space instead,
+		// as table IDs start over.
+		db.cacheID = m.nextCacheID()
+	} else if db.opt.BlockCache != nil {
+		db.cacheID = blockCacheIDs.Add(1)
+		db.indexCache.Clear()
+	} else {
+		db.blockCache.Clear()
+		db.indexCache.Clear()
+	}
 	db.threshold.Clear(db.opt)
 	return resume, nil
 }
@@ -1811,6 +2351,7 @@ func (db *DB) filterPrefixesToDrop(prefixes [][]byte) ([][]byte, error) {
 			iopts := DefaultIteratorOptions
 			iopts.Prefix = prefix
 			iopts.PrefetchValues = false
+			iopts.columnFamilies = true
 			itr := txn.NewIterator(iopts)
 			defer itr.Close()
 			itr.Rewind()
@@ -1879,7 +2420,7 @@ type KVList = pb.KVList
 // For example: ignore = "2-3", and prefix = "abc" will match for keys "abxxc", "abdfc" etc.
 // This function blocks until the given context is done or an error occurs.
 // The given function will be called with a new KVList containing the modified keys and the
-// corresponding values.
+// corresponding values, preceded by the metadata of their commit if set, see CommitMetadata.
 func (db *DB) Subscribe(ctx context.Context, cb func(kv *KVList) error, matches []pb.Match) error {
 	if cb == nil {
 		return ErrNilCallback
@@ -1947,6 +2488,12 @@ func (db *DB) Subscribe(ctx context.Context, cb func(kv *KVList) error, matches
 	}
 }
 
+// When you create or delete a file, you have to ensure the directory entry for the file is synced
+// in order to guarantee the file is visible (if the system crashes).
+func syncDir(dir string) error {
+	return vfs.SyncDir(dir)
+}
+
 func (db *DB) syncDir(dir string) error {
 	if db.opt.InMemory {
 		return nil
@@ -1955,7 +2502,11 @@ func (db *DB) syncDir(dir string) error {
 }
 
 func createDirs(opt Options) error {
-	for _, path := range []string{opt.Dir, opt.ValueDir} {
+	dirs := []string{opt.Dir, opt.ValueDir}
+	if opt.ColdStorageDir != "" {
+		dirs = append(dirs, opt.ColdStorageDir)
+	}
+	for _, path := range dirs {
 		dirExists, err := exists(path)
 		if err != nil {
 			return y.Wrapf(err, "Invalid Dir: %q", path)
@@ -2030,6 +2581,9 @@ func (db *DB) CacheMaxCost(cache CacheType, maxCost int64) (int64, error) {
 	if maxCost < 0 {
 		switch cache {
 		case BlockCache:
+			if db.blockCache == nil {
+				return 0, nil
+			}
 			return db.blockCache.MaxCost(), nil
 		case IndexCache:
 			return db.indexCache.MaxCost(), nil
@@ -2040,7 +2594,9 @@ func (db *DB) CacheMaxCost(cache CacheType, maxCost int64) (int64, error) {
 
 	switch cache {
 	case BlockCache:
-		db.blockCache.UpdateMaxCost(maxCost)
+		if db.blockCache != nil {
+			db.blockCache.UpdateMaxCost(maxCost)
+		}
 		return maxCost, nil
 	case IndexCache:
 		db.indexCache.UpdateMaxCost(maxCost)
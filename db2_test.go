@@ -191,6 +191,38 @@ func TestTruncateVlogNoClose3(t *testing.T) {
 	}
 }
 
+func TestMaxKeyValueSize(t *testing.T) {
+	opt := getTestOptions("")
+	opt.MaxKeySize = 16
+	opt.MaxValueSize = 1 << 10
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		bigK := make([]byte, 17)
+		bigV := make([]byte, 1<<10+1)
+		txn := db.NewTransaction(true)
+		defer txn.Discard()
+		require.ErrorIs(t, txn.Set(bigK, nil), ErrKeyTooLarge)
+		require.ErrorIs(t, txn.Delete(bigK), ErrKeyTooLarge)
+		require.ErrorIs(t, txn.Set([]byte("key"), bigV), ErrValueTooLarge)
+		require.NoError(t, txn.Set(bigK[:16], bigV[:1<<10]))
+		require.NoError(t, txn.Commit())
+
+		wb := db.NewWriteBatch()
+		defer wb.Cancel()
+		require.ErrorIs(t, wb.Set([]byte("key"), bigV), ErrValueTooLarge)
+	})
+
+	for _, opt := range []Options{
+		getTestOptions("").WithMaxKeySize(maxKeySize + 1),
+		getTestOptions("").WithMaxValueSize(-1),
+	} {
+		dir, err := os.MkdirTemp("", "badger-test")
+		require.NoError(t, err)
+		defer removeDir(dir)
+		_, err = Open(opt.WithDir(dir).WithValueDir(dir))
+		require.Error(t, err)
+	}
+}
+
 func TestBigKeyValuePairs(t *testing.T) {
 	// This test takes too much memory. So, run separately.
 	if !*manual {
@@ -1124,3 +1156,34 @@ func TestAssertValueLogIsNotWrittenToOnStartup(t *testing.T) {
 	assertOnReadDb(db)
 	require.Equal(t, latestVLogFileSize(db, db.vlog.maxFid), vLogFileSize)
 }
+
+func TestWritePipelineStats(t *testing.T) {
+	opt := getTestOptions("").WithSyncWrites(true)
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Set([]byte("key"), []byte("value"))
+		}))
+		var wg sync.WaitGroup
+		wg.Add(1)
+		txn := db.NewTransaction(true)
+		require.NoError(t, txn.Set([]byte("key2"), []byte("value")))
+		txn.CommitWith(func(err error) {
+			require.NoError(t, err)
+			wg.Done()
+		})
+		wg.Wait()
+
+		require.Eventually(t, func() bool {
+			return db.WritePipelineStats().Callback.Count == 1
+		}, 5*time.Second, time.Millisecond)
+
+		stats := db.WritePipelineStats()
+		require.Equal(t, int64(2), stats.QueueWait.Count)
+		require.Equal(t, int64(2), stats.MemtableApply.Count)
+		require.GreaterOrEqual(t, stats.ValueLogWrite.Count, int64(1))
+		// Both the value log and the WAL are synced.
+		require.GreaterOrEqual(t, stats.Sync.Count, stats.ValueLogWrite.Count+2)
+		require.Greater(t, stats.Sync.Total, time.Duration(0))
+		require.GreaterOrEqual(t, stats.Sync.Max, stats.Sync.Mean())
+	})
+}
@@ -1742,75 +1742,126 @@ func TestTestSequence2(t *testing.T) {
 }
 
 func TestReadOnly(t *testing.T) {
-	t.Skipf("TODO: ReadOnly needs truncation, so this fails")
-
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("Read-only mode is not supported")
+	}
 	dir, err := os.MkdirTemp("", "badger-test")
 	require.NoError(t, err)
 	defer removeDir(dir)
 	opts := getTestOptions(dir)
+	opts.ValueThreshold = 32
 
-	// Create the DB
+	// The writes stay in the WAL and the value log of the writer, which keeps running.
 	db, err := Open(opts)
 	require.NoError(t, err)
-	for i := 0; i < 10000; i++ {
+	defer func() { require.NoError(t, db.Close()) }()
+	for i := 0; i < 1000; i++ {
 		txnSet(t, db, []byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)), 0x00)
 	}
+	txnSet(t, db, []byte("big"), bytes.Repeat([]byte("v"), 100), 0x00)
 
-	// Attempt a read-only open while it's open read-write.
-	opts.ReadOnly = true
-	_, err = Open(opts)
-	require.Error(t, err)
-	if err == ErrWindowsNotSupported {
-		require.NoError(t, db.Close())
-		return
+	files := func() map[string]int64 {
+		sizes := make(map[string]int64)
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		for _, e := range entries {
+			info, err := e.Info()
+			require.NoError(t, err)
+			sizes[e.Name()] = info.Size()
+		}
+		return sizes
 	}
-	require.Contains(t, err.Error(), "Another process is using this Badger database")
-	db.Close()
+	before := files()
 
-	// Open one read-only
+	// Any number of read-only DBs can be opened while it's open read-write.
 	opts.ReadOnly = true
 	kv1, err := Open(opts)
 	require.NoError(t, err)
-	defer kv1.Close()
-
-	// Open another read-only
 	kv2, err := Open(opts)
 	require.NoError(t, err)
-	defer kv2.Close()
 
-	// Attempt a read-write open while it's open for read-only
-	opts.ReadOnly = false
-	_, err = Open(opts)
-	require.Error(t, err)
-	require.Contains(t, err.Error(), "Another process is using this Badger database")
+	for _, kv := range []*DB{kv1, kv2} {
+		require.NoError(t, kv.View(func(txn *Txn) error {
+			item, err := txn.Get([]byte("key999"))
+			require.NoError(t, err)
+			require.Equal(t, []byte("value999"), getItemValue(t, item))
+			item, err = txn.Get([]byte("big"))
+			require.NoError(t, err)
+			require.Equal(t, bytes.Repeat([]byte("v"), 100), getItemValue(t, item))
+			return nil
+		}))
+	}
 
-	// Get a thing from the DB
-	txn1 := kv1.NewTransaction(true)
-	v1, err := txn1.Get([]byte("key1"))
-	require.NoError(t, err)
-	b1, err := v1.ValueCopy(nil)
-	require.NoError(t, err)
-	require.Equal(t, b1, []byte("value1"))
-	err = txn1.Commit()
-	require.NoError(t, err)
+	// The writes fail.
+	txn := kv1.NewTransaction(true)
+	require.ErrorIs(t, txn.SetEntry(NewEntry([]byte("key"), []byte("value"))), ErrReadOnlyTxn)
+	txn.Discard()
+	require.ErrorIs(t, kv1.RunValueLogGC(0.5), ErrReadOnlyDB)
+
+	// The read-only DBs see the writes up to their opening, and leave the files alone.
+	txnSet(t, db, []byte("later"), []byte("value"), 0x00)
+	require.NoError(t, kv1.View(func(txn *Txn) error {
+		_, err := txn.Get([]byte("later"))
+		require.ErrorIs(t, err, ErrKeyNotFound)
+		return nil
+	}))
+	require.NoError(t, kv1.Close())
+	require.NoError(t, kv2.Close())
+	require.Equal(t, before, files())
 
-	// Get a thing from the DB via the other connection
-	txn2 := kv2.NewTransaction(true)
-	v2, err := txn2.Get([]byte("key2000"))
-	require.NoError(t, err)
-	b2, err := v2.ValueCopy(nil)
-	require.NoError(t, err)
-	require.Equal(t, b2, []byte("value2000"))
-	err = txn2.Commit()
+	// The writer carries on.
+	txnSet(t, db, []byte("key"), []byte("value"), 0x00)
+}
+
+func TestReadOnlyWhileWriterCompacts(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("Read-only mode is not supported")
+	}
+	opts := getTestOptions(t.TempDir()).WithNumCompactors(0).WithValueLogFileSize(1 << 20).
+		WithValueThreshold(1 << 10)
+	db, err := Open(opts)
 	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	val := func(i int) []byte { return bytes.Repeat([]byte{byte(i)}, 32<<10) }
+	for i := 0; i < 100; i++ {
+		txnSet(t, db, []byte(fmt.Sprintf("key%03d", i)), val(i), 0x00)
+		if i%25 == 24 {
+			require.NoError(t, db.flushMemTableForCheckpoint())
+		}
+	}
+	for i := 0; i < 45; i++ {
+		txnDelete(t, db, []byte(fmt.Sprintf("key%03d", i)))
+	}
 
-	// Attempt to set a value on a read-only connection
-	txn := kv1.NewTransaction(true)
-	err = txn.SetEntry(NewEntry([]byte("key"), []byte("value")))
-	require.Error(t, err)
-	require.Contains(t, err.Error(), "No sets or deletes are allowed in a read-only transaction")
-	err = txn.Commit()
+	ro, err := Open(opts.WithReadOnly(true))
 	require.NoError(t, err)
+	defer func() { require.NoError(t, ro.Close()) }()
+	check := func() {
+		require.NoError(t, ro.View(func(txn *Txn) error {
+			for i := 45; i < 100; i++ {
+				item, err := txn.Get([]byte(fmt.Sprintf("key%03d", i)))
+				require.NoError(t, err)
+				require.Equal(t, val(i), getItemValue(t, item))
+			}
+			return nil
+		}))
+		require.NotEmpty(t, ro.Tables())
+	}
+	check()
+
+	// The writer removes the tables it compacts and the value log files it rewrites, which the
+	// read-only DB still reads.
+	tables := db.Levels()[0].NumTables
+	prio := compactionPriority{level: 0, score: 1.71, t: db.lc.levelTargets()}
+	require.NoError(t, db.lc.doCompact(-1, prio))
+	require.Less(t, db.Levels()[0].NumTables, tables)
+	db.vlog.filesLock.RLock()
+	lf := db.vlog.filesMap[db.vlog.sortedFids()[0]]
+	db.vlog.filesLock.RUnlock()
+	require.NoError(t, db.vlog.rewrite(lf))
+	_, err = os.Stat(lf.path)
+	require.True(t, os.IsNotExist(err))
+	check()
 }
 
 func TestLSMOnly(t *testing.T) {
@@ -26,7 +26,7 @@ import (
 type directoryLockGuard struct {
 	// The absolute path to our pid file.
 	path string
-	// Was this a shared lock for a read-only database?
+	// Was this a read-only database, which took no lock?
 	readOnly bool
 }
 
@@ -44,7 +44,8 @@ var aixFlockMapLock sync.Mutex
 
 // acquireDirectoryLock gets a lock on the directory (using flock). If
 // this is not read-only, it will also write our pid to
-// dirPath/pidFileName for convenience.
+// dirPath/pidFileName for convenience. A read-only DB takes no lock, so
+// that it can be opened while another process writes to it.
 func acquireDirectoryLock(dirPath string, pidFileName string, readOnly bool) (
 	*directoryLockGuard, error) {
 
@@ -55,11 +56,14 @@ func acquireDirectoryLock(dirPath string, pidFileName string, readOnly bool) (
 		return nil, y.Wrapf(err, "cannot get absolute path for pid lock file")
 	}
 
+	lg := &directoryLockGuard{absPidFilePath, readOnly}
+	if readOnly {
+		return lg, nil
+	}
+
 	aixFlockMapLock.Lock()
 	defer aixFlockMapLock.Unlock()
 
-	lg := &directoryLockGuard{absPidFilePath, readOnly}
-
 	if lock, fnd := aixFlockMap[absPidFilePath]; fnd {
 		if !readOnly || lock.readOnly != readOnly {
 			return nil, fmt.Errorf(
@@ -104,6 +108,9 @@ func acquireDirectoryLock(dirPath string, pidFileName string, readOnly bool) (
 // Release deletes the pid file and releases our lock on the directory.
 func (guard *directoryLockGuard) release() error {
 	var err error
+	if guard.readOnly {
+		return nil
+	}
 
 	aixFlockMapLock.Lock()
 	defer aixFlockMapLock.Unlock()
@@ -129,16 +136,3 @@ func (guard *directoryLockGuard) release() error {
 
 	return err
 }
-
-// openDir opens a directory for syncing.
-func openDir(path string) (*os.File, error) { return os.Open(path) }
-
-// When you create or delete a file, you have to ensure the directory entry for the file is synced
-// in order to guarantee the file is visible (if the system crashes). (See the man page for fsync,
-// or see https://github.com/coreos/etcd/issues/6368 for an example.)
-func syncDir(dir string) error {
-	var err error
-	// AIX does not support fsync on a directory.
-	// Data durability on crash may be affected.
-	return err
-}
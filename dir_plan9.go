@@ -89,26 +89,6 @@ func (guard *directoryLockGuard) release() error {
 	return err
 }
 
-// openDir opens a directory for syncing.
-func openDir(path string) (*os.File, error) { return os.Open(path) }
-
-// When you create or delete a file, you have to ensure the directory entry for the file is synced
-// in order to guarantee the file is visible (if the system crashes). (See the man page for fsync,
-// or see https://github.com/coreos/etcd/issues/6368 for an example.)
-func syncDir(dir string) error {
-	f, err := openDir(dir)
-	if err != nil {
-		return y.Wrapf(err, "While opening directory: %s.", dir)
-	}
-
-	err = f.Sync()
-	closeErr := f.Close()
-	if err != nil {
-		return y.Wrapf(err, "While syncing directory: %s.", dir)
-	}
-	return y.Wrapf(closeErr, "While closing directory: %s.", dir)
-}
-
 // Opening an exclusive-use file returns an error.
 // The expected error strings are:
 //
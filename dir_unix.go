@@ -25,13 +25,14 @@ type directoryLockGuard struct {
 	f *os.File
 	// The absolute path to our pid file.
 	path string
-	// Was this a shared lock for a read-only database?
+	// Was this a read-only database, which took no lock?
 	readOnly bool
 }
 
 // acquireDirectoryLock gets a lock on the directory (using flock). If
 // this is not read-only, it will also write our pid to
-// dirPath/pidFileName for convenience.
+// dirPath/pidFileName for convenience. A read-only DB takes no lock, so
+// that it can be opened while another process writes to it.
 func acquireDirectoryLock(dirPath string, pidFileName string, readOnly bool) (
 	*directoryLockGuard, error) {
 	// Convert to absolute path so that Release still works even if we do an unbalanced
@@ -44,12 +45,11 @@ func acquireDirectoryLock(dirPath string, pidFileName string, readOnly bool) (
 	if err != nil {
 		return nil, y.Wrapf(err, "cannot open directory %q", dirPath)
 	}
-	opts := unix.LOCK_EX | unix.LOCK_NB
 	if readOnly {
-		opts = unix.LOCK_SH | unix.LOCK_NB
+		return &directoryLockGuard{f, absPidFilePath, readOnly}, nil
 	}
 
-	err = unix.Flock(int(f.Fd()), opts)
+	err = unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
 	if err != nil {
 		f.Close()
 		return nil, y.Wrapf(err,
@@ -57,15 +57,13 @@ func acquireDirectoryLock(dirPath string, pidFileName string, readOnly bool) (
 			dirPath)
 	}
 
-	if !readOnly {
-		// Yes, we happily overwrite a pre-existing pid file.  We're the
-		// only read-write badger process using this directory.
-		err = os.WriteFile(absPidFilePath, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0666)
-		if err != nil {
-			f.Close()
-			return nil, y.Wrapf(err,
-				"Cannot write pid file %q", absPidFilePath)
-		}
+	// Yes, we happily overwrite a pre-existing pid file.  We're the
+	// only read-write badger process using this directory.
+	err = os.WriteFile(absPidFilePath, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0666)
+	if err != nil {
+		f.Close()
+		return nil, y.Wrapf(err,
+			"Cannot write pid file %q", absPidFilePath)
 	}
 	return &directoryLockGuard{f, absPidFilePath, readOnly}, nil
 }
@@ -86,23 +84,3 @@ func (guard *directoryLockGuard) release() error {
 
 	return err
 }
-
-// openDir opens a directory for syncing.
-func openDir(path string) (*os.File, error) { return os.Open(path) }
-
-// When you create or delete a file, you have to ensure the directory entry for the file is synced
-// in order to guarantee the file is visible (if the system crashes). (See the man page for fsync,
-// or see https://github.com/coreos/etcd/issues/6368 for an example.)
-func syncDir(dir string) error {
-	f, err := openDir(dir)
-	if err != nil {
-		return y.Wrapf(err, "While opening directory: %s.", dir)
-	}
-
-	err = f.Sync()
-	closeErr := f.Close()
-	if err != nil {
-		return y.Wrapf(err, "While syncing directory: %s.", dir)
-	}
-	return y.Wrapf(closeErr, "While closing directory: %s.", dir)
-}
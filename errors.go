@@ -43,6 +43,14 @@ var (
 	// reserved for internal usage.
 	ErrInvalidKey = stderrors.New("Key is using a reserved !badger! prefix")
 
+	// ErrKeyTooLarge is returned if a key is longer than Options.MaxKeySize, or than the
+	// 65000 bytes supported by the table format.
+	ErrKeyTooLarge = stderrors.New("Key is too large")
+
+	// ErrValueTooLarge is returned if a value is longer than Options.MaxValueSize, or than
+	// what fits into a single value log file.
+	ErrValueTooLarge = stderrors.New("Value is too large")
+
 	// ErrBannedKey is returned if the read/write key belongs to any banned namespace.
 	ErrBannedKey = stderrors.New("Key is using the banned prefix")
 
@@ -84,6 +92,13 @@ var (
 	// ErrPlan9NotSupported is returned when opt.ReadOnly is used on Plan 9
 	ErrPlan9NotSupported = stderrors.New("Read-only mode is not supported on Plan 9")
 
+	// ErrReadOnlyDB is returned by the operations writing to a DB opened with Options.ReadOnly.
+	ErrReadOnlyDB = stderrors.New("The DB is opened in read-only mode")
+
+	// ErrNotReadOnly is returned by DB.Refresh if the DB isn't opened with Options.ReadOnly, or is
+	// opened by OpenAt.
+	ErrNotReadOnly = stderrors.New("Only the DBs opened read-only at the latest version refresh")
+
 	// ErrTruncateNeeded is returned when the value log gets corrupt, and requires truncation of
 	// corrupt data to allow Badger to run properly.
 	ErrTruncateNeeded = stderrors.New(
@@ -109,6 +124,79 @@ var (
 	// ErrGCInMemoryMode is returned when db.RunValueLogGC is called in in-memory mode.
 	ErrGCInMemoryMode = stderrors.New("Cannot run value log GC when DB is opened in InMemory mode")
 
+	// ErrCheckpointInMemoryMode is returned when db.Checkpoint is called in in-memory mode.
+	ErrCheckpointInMemoryMode = stderrors.New("Cannot checkpoint a DB opened in InMemory mode")
+
 	// ErrDBClosed is returned when a get operation is performed after closing the DB.
 	ErrDBClosed = stderrors.New("DB Closed")
+
+	// ErrInvalidArchive is returned by OpenArchive when the file is not an archive written by
+	// DB.WriteArchive, or is corrupt.
+	ErrInvalidArchive = stderrors.New("Invalid archive")
+
+	// ErrNoMergeOperator is returned by Txn.Merge when no merge operator is registered for the
+	// key.
+	ErrNoMergeOperator = stderrors.New("No merge operator registered")
+
+	// ErrCompactionCheck is returned when the tables written by a compaction fail the checks of
+	// Options.ParanoidCompactionChecks.
+	ErrCompactionCheck = stderrors.New("Compaction output failed paranoid checks")
+
+	// ErrInvalidRange is returned by Txn.DeleteRange when the start of the range isn't before its
+	// end.
+	ErrInvalidRange = stderrors.New("Start of range must be before its end")
+
+	// ErrOverlappingPrefixes is returned by MovePrefix when one of the prefixes starts with the
+	// other.
+	ErrOverlappingPrefixes = stderrors.New("Prefixes to move from and to must not overlap")
+
+	// ErrNoKeyProvider is returned by DB.RotateMasterKey when Options.KeyProvider isn't set.
+	ErrNoKeyProvider = stderrors.New("No KeyProvider set to rotate the master key with")
+
+	// ErrUnknownValueTransformer is returned when reading a value encoded by a ValueTransformer
+	// which isn't in Options.ValueTransformers anymore.
+	ErrUnknownValueTransformer = stderrors.New("Value encoded by unknown value transformer")
+
+	// ErrInvariantViolated is matched by the InvariantError returned when a check of
+	// Options.StrictInvariantChecks fails.
+	ErrInvariantViolated = stderrors.New("Invariant violated")
+
+	// ErrTxnPrepared is returned when writing to a transaction prepared with Txn.Prepare, which can
+	// only be committed or rolled back.
+	ErrTxnPrepared = stderrors.New("Transaction is prepared")
+
+	// ErrPreparedTxnNotFound is returned when there is no prepared transaction of an ID, or it has
+	// been committed or rolled back already.
+	ErrPreparedTxnNotFound = stderrors.New("Prepared transaction not found")
+
+	// ErrIngestInProgress is returned by DB.BeginIngest when another ingest session is running.
+	ErrIngestInProgress = stderrors.New("Another ingest session is running")
+
+	// ErrIngestOffset is returned by IngestSession.Upload when the chunk isn't at the offset the
+	// session is at, see IngestSession.Offset.
+	ErrIngestOffset = stderrors.New("Chunk not at the offset of the ingest session")
+
+	// ErrIngestDone is returned when using an ingest session committed or aborted.
+	ErrIngestDone = stderrors.New("Ingest session is done")
+
+	// ErrFollower is returned when writing to a DB opened with Options.Follower, which only the
+	// writes replicated from its leader change.
+	ErrFollower = stderrors.New("Writes are not allowed on a follower")
+
+	// ErrNotFollower is returned by DB.Follow when the DB isn't opened with Options.Follower.
+	ErrNotFollower = stderrors.New("DB is not opened as a follower")
+
+	// ErrNameRegistered is returned by Register when another DB is registered under the name.
+	ErrNameRegistered = stderrors.New("Another DB is registered under the name")
+
+	// ErrVersionDiscarded is returned by DB.ViewAt when the versions it would read may have been
+	// purged by the compactions.
+	ErrVersionDiscarded = stderrors.New("Versions at the read timestamp may have been discarded")
+
+	// ErrFutureVersion is returned by DB.ViewAt when the version to read at isn't committed yet.
+	ErrFutureVersion = stderrors.New("Version to read at isn't committed yet")
+
+	// ErrSavepointNotFound is returned by Txn.RollbackToSavepoint and Txn.ReleaseSavepoint when
+	// the transaction has no savepoint of the ID.
+	ErrSavepointNotFound = stderrors.New("Savepoint not found")
 )
@@ -0,0 +1,139 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package eventlog keeps time-ordered events under a key prefix of a DB.
+//
+// Every event is stored under prefix + ULID, so events sort by the time they were appended.
+// Events are read back newest first, and expired by deleting every key before the ULID prefix
+// of a point in time. The ULID and KSUID helpers can also be used on their own, for keys
+// following the same pattern.
+package eventlog
+
+import (
+	"bytes"
+	"time"
+
+	badger "github.com/luxfi/zapdb"
+)
+
+// Log stores events under a key prefix of a DB.
+type Log struct {
+	prefix []byte
+}
+
+// New returns a Log keeping its events under prefix.
+func New(prefix []byte) *Log {
+	return &Log{prefix: append([]byte{}, prefix...)}
+}
+
+// Key returns the key of the event id.
+func (l *Log) Key(id ULID) []byte {
+	return append(append([]byte{}, l.prefix...), id[:]...)
+}
+
+// Append stores value as a new event, and returns its ID.
+func (l *Log) Append(txn *badger.Txn, value []byte) (ULID, error) {
+	id := NewULID()
+	return id, txn.Set(l.Key(id), value)
+}
+
+// Recent returns an iterator over all events, newest first.
+func (l *Log) Recent(txn *badger.Txn) *Events {
+	seek := append(append([]byte{}, l.prefix...), bytes.Repeat([]byte{0xff}, len(ULID{})+1)...)
+	return l.events(txn, seek)
+}
+
+// Before returns an iterator over the events appended before t, newest first.
+func (l *Log) Before(txn *badger.Txn, t time.Time) *Events {
+	return l.events(txn, append(append([]byte{}, l.prefix...), ULIDPrefix(t)...))
+}
+
+func (l *Log) events(txn *badger.Txn, seek []byte) *Events {
+	e := &Events{
+		it: txn.NewIterator(badger.IteratorOptions{
+			Prefix: l.prefix, Reverse: true, PrefetchValues: true, PrefetchSize: 100,
+		}),
+		keyLen: len(l.prefix) + len(ULID{}),
+	}
+	e.it.Seek(seek)
+	e.skip()
+	return e
+}
+
+// DeleteBefore deletes the events appended before t, and returns how many it deleted.
+func (l *Log) DeleteBefore(db *badger.DB, t time.Time) (int, error) {
+	end := append(append([]byte{}, l.prefix...), ULIDPrefix(t)...)
+	wb := db.NewWriteBatch()
+	var deleted int
+	err := db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: l.prefix})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			key := it.Item().Key()
+			if bytes.Compare(key, end) >= 0 {
+				break
+			}
+			if len(key) != len(l.prefix)+len(ULID{}) {
+				continue
+			}
+			if err := wb.Delete(it.Item().KeyCopy(nil)); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+	if err != nil {
+		wb.Cancel()
+		return 0, err
+	}
+	return deleted, wb.Flush()
+}
+
+// DeleteOlderThan deletes the events older than age, and returns how many it deleted.
+func (l *Log) DeleteOlderThan(db *badger.DB, age time.Duration) (int, error) {
+	return l.DeleteBefore(db, time.Now().Add(-age))
+}
+
+// Events iterates over events, newest first. It must be closed.
+type Events struct {
+	it     *badger.Iterator
+	keyLen int
+}
+
+// skip moves past keys under the prefix that aren't events.
+func (e *Events) skip() {
+	for e.it.Valid() && len(e.it.Item().Key()) != e.keyLen {
+		e.it.Next()
+	}
+}
+
+// Valid returns false when iteration is done.
+func (e *Events) Valid() bool {
+	return e.it.Valid()
+}
+
+// Next advances to the next older event.
+func (e *Events) Next() {
+	e.it.Next()
+	e.skip()
+}
+
+// ID returns the ID of the current event.
+func (e *Events) ID() ULID {
+	var id ULID
+	copy(id[:], e.it.Item().Key()[e.keyLen-len(id):])
+	return id
+}
+
+// Item returns the item of the current event. It is only valid until Next is called.
+func (e *Events) Item() *badger.Item {
+	return e.it.Item()
+}
+
+// Close releases the iterator.
+func (e *Events) Close() {
+	e.it.Close()
+}
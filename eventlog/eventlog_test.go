@@ -0,0 +1,117 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package eventlog
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	badger "github.com/luxfi/zapdb"
+	"github.com/luxfi/zapdb/testkit"
+)
+
+func TestULID(t *testing.T) {
+	now := time.UnixMilli(time.Now().UnixMilli())
+	id := ULIDAt(now)
+	require.Equal(t, now, id.Time())
+	require.Len(t, id.String(), 26)
+
+	parsed, err := ParseULID(strings.ToLower(id.String()))
+	require.NoError(t, err)
+	require.Equal(t, id, parsed)
+	_, err = ParseULID("8ZZZZZZZZZZZZZZZZZZZZZZZZZ")
+	require.ErrorIs(t, err, ErrInvalidID)
+	_, err = ParseULID("short")
+	require.ErrorIs(t, err, ErrInvalidID)
+
+	// IDs of one process keep their order, as bytes and as strings.
+	ids := make([]ULID, 1000)
+	for i := range ids {
+		ids[i] = NewULID()
+	}
+	require.True(t, sort.SliceIsSorted(ids, func(i, j int) bool {
+		return ids[i].Compare(ids[j]) < 0
+	}))
+	for i := 1; i < len(ids); i++ {
+		require.Less(t, ids[i-1].String(), ids[i].String())
+	}
+}
+
+func TestKSUID(t *testing.T) {
+	now := time.Unix(time.Now().Unix(), 0)
+	id := KSUIDAt(now)
+	require.Equal(t, now, id.Time())
+	require.True(t, bytes.HasPrefix(id[:], KSUIDPrefix(now)))
+
+	s := id.String()
+	require.Len(t, s, 27)
+	parsed, err := ParseKSUID(s)
+	require.NoError(t, err)
+	require.Equal(t, id, parsed)
+
+	var max KSUID
+	for i := range max {
+		max[i] = 0xff
+	}
+	require.Equal(t, "aWgEPTl1tmebfsQzFP4bxwgy80V", max.String())
+	_, err = ParseKSUID("aWgEPTl1tmebfsQzFP4bxwgy80W")
+	require.ErrorIs(t, err, ErrInvalidID)
+	require.Less(t, KSUIDAt(now).String(), KSUIDAt(now.Add(time.Second)).String())
+}
+
+func TestLog(t *testing.T) {
+	db := testkit.OpenInMemory(t)
+
+	log := New([]byte("events/"))
+	var ids []ULID
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		for i := 0; i < 5; i++ {
+			id, err := log.Append(txn, []byte{byte(i)})
+			require.NoError(t, err)
+			ids = append(ids, id)
+		}
+		// Keys sorting after the events under the same prefix are skipped.
+		return txn.Set([]byte("events/\xff"), nil)
+	}))
+	// An older event, as if appended long ago.
+	old := ULIDAt(time.Now().Add(-time.Hour))
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		return txn.Set(log.Key(old), []byte("old"))
+	}))
+
+	read := func(e *Events) []ULID {
+		defer e.Close()
+		var out []ULID
+		for ; e.Valid(); e.Next() {
+			out = append(out, e.ID())
+		}
+		return out
+	}
+	require.NoError(t, db.View(func(txn *badger.Txn) error {
+		require.Equal(t, []ULID{ids[4], ids[3], ids[2], ids[1], ids[0], old}, read(log.Recent(txn)))
+		require.Equal(t, []ULID{old}, read(log.Before(txn, time.Now().Add(-time.Minute))))
+
+		e := log.Recent(txn)
+		defer e.Close()
+		val, err := e.Item().ValueCopy(nil)
+		require.NoError(t, err)
+		require.Equal(t, []byte{4}, val)
+		return nil
+	}))
+
+	n, err := log.DeleteOlderThan(db, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.NoError(t, db.View(func(txn *badger.Txn) error {
+		require.Equal(t, []ULID{ids[4], ids[3], ids[2], ids[1], ids[0]}, read(log.Recent(txn)))
+		return nil
+	}))
+}
@@ -0,0 +1,210 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package eventlog
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidID is returned when parsing a malformed ULID or KSUID.
+var ErrInvalidID = errors.New("eventlog: invalid ID")
+
+// ULID is a 16 byte ID made of a 48 bit Unix time in milliseconds and 80 random bits. IDs sort
+// by time, bytewise and as strings.
+type ULID [16]byte
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var ulidGen struct {
+	sync.Mutex
+	last ULID
+}
+
+// NewULID returns a ULID for the current time. IDs returned by one process within the same
+// millisecond are increasing, so they keep the order of the calls.
+func NewULID() ULID {
+	id := ULIDAt(time.Now())
+	ulidGen.Lock()
+	defer ulidGen.Unlock()
+	if id.Compare(ulidGen.last) <= 0 {
+		// Increment the previous ID, carrying into the time if the random bits overflow.
+		id = ulidGen.last
+		for i := len(id) - 1; i >= 0; i-- {
+			if id[i]++; id[i] != 0 {
+				break
+			}
+		}
+	}
+	ulidGen.last = id
+	return id
+}
+
+// ULIDAt returns a ULID with time t and random bits.
+func ULIDAt(t time.Time) ULID {
+	var id ULID
+	copy(id[:], ULIDPrefix(t))
+	_, err := rand.Read(id[6:])
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+// ULIDPrefix returns the 6 byte time prefix of the ULIDs created at time t. Every ULID created
+// before t sorts before it.
+func ULIDPrefix(t time.Time) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(t.UnixMilli()))
+	return buf[2:]
+}
+
+// Time returns the time of the ID, with millisecond precision.
+func (id ULID) Time() time.Time {
+	var buf [8]byte
+	copy(buf[2:], id[:6])
+	return time.UnixMilli(int64(binary.BigEndian.Uint64(buf[:])))
+}
+
+// Compare returns -1, 0 or 1 as id sorts before, equal to or after other.
+func (id ULID) Compare(other ULID) int {
+	for i := range id {
+		if id[i] != other[i] {
+			if id[i] < other[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// bit returns the i-th bit of id, counting from the most significant one. The 26 characters of
+// a ULID string hold 130 bits, so the first two are always zero.
+func (id ULID) bit(i int) byte {
+	i -= 2
+	if i < 0 {
+		return 0
+	}
+	return id[i/8] >> (7 - i%8) & 1
+}
+
+// String returns the 26 character Crockford base32 form of the ID.
+func (id ULID) String() string {
+	var sb strings.Builder
+	for c := 0; c < 26; c++ {
+		var v byte
+		for b := 0; b < 5; b++ {
+			v = v<<1 | id.bit(c*5+b)
+		}
+		sb.WriteByte(crockford[v])
+	}
+	return sb.String()
+}
+
+// ParseULID parses the string form of a ULID. It is case insensitive.
+func ParseULID(s string) (ULID, error) {
+	var id ULID
+	if len(s) != 26 {
+		return id, ErrInvalidID
+	}
+	s = strings.ToUpper(s)
+	for c := 0; c < 26; c++ {
+		v := strings.IndexByte(crockford, s[c])
+		if v < 0 || (c == 0 && v > 7) {
+			return id, ErrInvalidID
+		}
+		for b := 0; b < 5; b++ {
+			i := c*5 + b - 2
+			if i >= 0 && v>>(4-b)&1 == 1 {
+				id[i/8] |= 1 << (7 - i%8)
+			}
+		}
+	}
+	return id, nil
+}
+
+// KSUID is a 20 byte ID made of a 32 bit time in seconds since the KSUID epoch, 2014-05-13,
+// and 128 random bits. IDs sort by time, bytewise and as strings.
+type KSUID [20]byte
+
+const (
+	ksuidEpoch = 1400000000
+	base62     = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+// NewKSUID returns a KSUID for the current time.
+func NewKSUID() KSUID {
+	return KSUIDAt(time.Now())
+}
+
+// KSUIDAt returns a KSUID with time t and random bits. t must be in the 136 years following
+// the KSUID epoch.
+func KSUIDAt(t time.Time) KSUID {
+	var id KSUID
+	copy(id[:], KSUIDPrefix(t))
+	_, err := rand.Read(id[4:])
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+// KSUIDPrefix returns the 4 byte time prefix of the KSUIDs created at time t.
+func KSUIDPrefix(t time.Time) []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(t.Unix()-ksuidEpoch))
+}
+
+// Time returns the time of the ID, with second precision.
+func (id KSUID) Time() time.Time {
+	return time.Unix(int64(binary.BigEndian.Uint32(id[:]))+ksuidEpoch, 0)
+}
+
+// String returns the 27 character base62 form of the ID.
+func (id KSUID) String() string {
+	num := append([]byte{}, id[:]...)
+	out := make([]byte, 27)
+	for i := len(out) - 1; i >= 0; i-- {
+		// Divide num by 62 in place, keeping the remainder as the next digit.
+		var rem int
+		for j, b := range num {
+			cur := rem<<8 | int(b)
+			num[j] = byte(cur / 62)
+			rem = cur % 62
+		}
+		out[i] = base62[rem]
+	}
+	return string(out)
+}
+
+// ParseKSUID parses the string form of a KSUID.
+func ParseKSUID(s string) (KSUID, error) {
+	var id KSUID
+	if len(s) != 27 {
+		return id, ErrInvalidID
+	}
+	for i := 0; i < len(s); i++ {
+		v := strings.IndexByte(base62, s[i])
+		if v < 0 {
+			return id, ErrInvalidID
+		}
+		// Multiply id by 62 and add v.
+		carry := v
+		for j := len(id) - 1; j >= 0; j-- {
+			cur := int(id[j])*62 + carry
+			id[j] = byte(cur)
+			carry = cur >> 8
+		}
+		if carry != 0 {
+			return KSUID{}, ErrInvalidID
+		}
+	}
+	return id, nil
+}
@@ -0,0 +1,212 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/luxfi/zapdb/options"
+	"github.com/luxfi/zapdb/table"
+	"github.com/luxfi/zapdb/y"
+)
+
+// TableExportFile is the name of the description of the tables written by ExportTables, in
+// their directory.
+const TableExportFile = "EXPORT.json"
+
+// ExportedTable is a table file written by ExportTables.
+type ExportedTable struct {
+	// File is the name of the table file, in the directory of the export.
+	File string
+	// Smallest and Biggest are the first and last keys of the table, without their versions.
+	Smallest, Biggest []byte
+	KeyCount          uint32
+	Size              int64
+	MaxVersion        uint64
+}
+
+// TableExport describes the table files written by ExportTables, stored in their directory as
+// TableExportFile.
+type TableExport struct {
+	// Start and End are the range of the keys exported, End excluded, or up to the last key if
+	// it's nil, and ReadTs the version they were read at.
+	Start, End []byte
+	ReadTs     uint64
+	// Compression is the compression of the blocks of the tables.
+	Compression options.CompressionType
+	// Tables are in the order of their keys, which don't overlap.
+	Tables []ExportedTable
+}
+
+// ExportTables writes the keys from start to end, excluded, or to the last key if end is nil, as
+// of the time it is called, into table files in dir, which must not exist, and describes them in
+// TableExportFile. The newest version of every key is exported, with its value, and the deleted
+// and expired keys are left out: the tables are self-contained, not encrypted and not compressed
+// with a dictionary, so that another DB can ingest them with IngestExternalFiles, moving a shard
+// a file at a time rather than a key at a time.
+//
+// ExportTables is not supported on ManagedDB. Use ExportTablesAt instead.
+func (db *DB) ExportTables(dir string, start, end []byte) (*TableExport, error) {
+	if db.opt.managedTxns {
+		panic("Cannot use ExportTables with managedDB=true. Use ExportTablesAt.")
+	}
+	txn := db.NewTransaction(false)
+	defer txn.Discard()
+	return db.exportTables(txn, dir, start, end)
+}
+
+// ExportTablesAt is like ExportTables, but exports the keys as of readTs. It's only supported on
+// ManagedDB.
+func (db *DB) ExportTablesAt(readTs uint64, dir string, start, end []byte) (*TableExport, error) {
+	if !db.opt.managedTxns {
+		panic("Cannot use ExportTablesAt with managedDB=false. Use ExportTables.")
+	}
+	txn := db.NewTransactionAt(readTs, false)
+	defer txn.Discard()
+	return db.exportTables(txn, dir, start, end)
+}
+
+// ReadTableExport reads the description of the tables exported into dir.
+func ReadTableExport(dir string) (*TableExport, error) {
+	data, err := os.ReadFile(filepath.Join(dir, TableExportFile))
+	if err != nil {
+		return nil, y.Wrapf(err, "while reading table export in %q", dir)
+	}
+	exp := &TableExport{}
+	if err := json.Unmarshal(data, exp); err != nil {
+		return nil, y.Wrapf(err, "while decoding table export in %q", dir)
+	}
+	return exp, nil
+}
+
+func (db *DB) exportTables(txn *Txn, dir string, start, end []byte) (
+	exp *TableExport, err error) {
+	if end != nil && bytes.Compare(start, end) >= 0 {
+		return nil, fmt.Errorf("Empty range of keys to export: [%q, %q)", start, end)
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return nil, fmt.Errorf("Export directory %q already exists", dir)
+	} else if !os.IsNotExist(err) {
+		return nil, y.Wrapf(err, "while checking export directory %q", dir)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, y.Wrapf(err, "while creating export directory %q", dir)
+	}
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(dir)
+		}
+	}()
+
+	bopts := buildTableOptions(db)
+	// The tables must be readable by another DB, without the keys and dictionaries of this one.
+	bopts.DataKey = nil
+	bopts.ZSTDDictionary, bopts.ZSTDDecoder = nil, nil
+	bopts.BlockCache, bopts.IndexCache = nil, nil
+	exp = &TableExport{
+		Start:       y.SafeCopy(nil, start),
+		End:         y.SafeCopy(nil, end),
+		ReadTs:      txn.readTs,
+		Compression: bopts.Compression,
+	}
+
+	var builder *table.Builder
+	defer func() {
+		if builder != nil {
+			builder.Close()
+		}
+	}()
+	var cur ExportedTable
+	finish := func() error {
+		if builder == nil {
+			return nil
+		}
+		cur.File = filepath.Base(table.NewFilename(uint64(len(exp.Tables)+1), dir))
+		size, err := writeTableFile(filepath.Join(dir, cur.File), builder)
+		builder.Close()
+		builder = nil
+		if err != nil {
+			return err
+		}
+		cur.Size = size
+		exp.Tables = append(exp.Tables, cur)
+		cur = ExportedTable{}
+		return nil
+	}
+
+	opt := DefaultIteratorOptions
+	opt.uncounted = true
+	it := txn.NewIterator(opt)
+	defer it.Close()
+	for it.Seek(start); it.Valid(); it.Next() {
+		item := it.Item()
+		if end != nil && bytes.Compare(item.Key(), end) >= 0 {
+			break
+		}
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return nil, y.Wrapf(err, "while reading value of key %q", item.Key())
+		}
+		if builder == nil {
+			builder = table.NewTableBuilder(bopts)
+			cur.Smallest = item.KeyCopy(nil)
+		}
+		builder.Add(y.KeyWithTs(item.Key(), item.Version()), y.ValueStruct{
+			Value:     val,
+			UserMeta:  item.UserMeta(),
+			ExpiresAt: item.ExpiresAt(),
+		}, 0)
+		cur.Biggest = item.KeyCopy(cur.Biggest)
+		cur.KeyCount++
+		cur.MaxVersion = max(cur.MaxVersion, item.Version())
+		if builder.ReachedCapacity() {
+			if err := finish(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(exp)
+	if err != nil {
+		return nil, y.Wrapf(err, "while encoding table export")
+	}
+	if err := writeFileSync(filepath.Join(dir, TableExportFile), data); err != nil {
+		return nil, err
+	}
+	return exp, syncDir(dir)
+}
+
+// writeTableFile writes the table built by builder into the file fname, and returns its size.
+func writeTableFile(fname string, builder *table.Builder) (int64, error) {
+	bd := builder.Done()
+	data := make([]byte, bd.Size)
+	bd.Copy(data)
+	return int64(len(data)), writeFileSync(fname, data)
+}
+
+// writeFileSync writes data into the new file fname, and syncs it.
+func writeFileSync(fname string, data []byte) error {
+	f, err := os.OpenFile(fname, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return y.Wrapf(err, "while creating %q", fname)
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return y.Wrapf(err, "while writing %q", fname)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return y.Wrapf(err, "while syncing %q", fname)
+	}
+	return f.Close()
+}
@@ -0,0 +1,90 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/table"
+	"github.com/luxfi/zapdb/y"
+)
+
+func TestExportTables(t *testing.T) {
+	opt := getTestOptions("")
+	opt.BaseTableSize = 1 << 15
+	opt.ValueThreshold = 1 << 10
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		key := func(i int) []byte { return fmt.Appendf(nil, "key%05d", i) }
+		val := func(i int) []byte {
+			// Some of the values are in the value log.
+			if i%10 == 0 {
+				v := make([]byte, 2<<10)
+				rand.New(rand.NewSource(int64(i))).Read(v)
+				return v
+			}
+			return fmt.Appendf(nil, "val%d", i)
+		}
+		wb := db.NewWriteBatch()
+		for i := range 2000 {
+			require.NoError(t, wb.Set(key(i), val(i)))
+		}
+		for i := 0; i < 2000; i += 3 {
+			require.NoError(t, wb.Delete(key(i)))
+		}
+		require.NoError(t, wb.Flush())
+
+		dir := filepath.Join(t.TempDir(), "export")
+		exp, err := db.ExportTables(dir, key(500), key(1500))
+		require.NoError(t, err)
+		require.Greater(t, len(exp.Tables), 1)
+		read, err := ReadTableExport(dir)
+		require.NoError(t, err)
+		require.Equal(t, exp, read)
+
+		// The tables have the keys of the range left, in order, with their values.
+		var want []int
+		for i := 500; i < 1500; i++ {
+			if i%3 != 0 {
+				want = append(want, i)
+			}
+		}
+		var got []int
+		for _, et := range exp.Tables {
+			mf, err := z.OpenMmapFile(filepath.Join(dir, et.File), os.O_RDWR, 0)
+			require.NoError(t, err)
+			tbl, err := table.OpenTable(mf, table.Options{
+				BlockSize:   opt.BlockSize,
+				Compression: exp.Compression,
+			})
+			require.NoError(t, err)
+			require.Equal(t, et.Smallest, y.ParseKey(tbl.Smallest()))
+			require.Equal(t, et.Biggest, y.ParseKey(tbl.Biggest()))
+			require.Equal(t, et.KeyCount, tbl.KeyCount())
+			require.Equal(t, et.MaxVersion, tbl.MaxVersion())
+
+			it := tbl.NewIterator(0)
+			for it.Rewind(); it.Valid(); it.Next() {
+				i := want[len(got)]
+				require.Equal(t, key(i), y.ParseKey(it.Key()))
+				require.Equal(t, val(i), it.Value().Value)
+				got = append(got, i)
+			}
+			require.NoError(t, it.Close())
+			require.NoError(t, tbl.Close(-1))
+		}
+		require.Equal(t, want, got)
+
+		_, err = db.ExportTables(dir, key(0), nil)
+		require.Error(t, err)
+	})
+}
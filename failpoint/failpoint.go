@@ -0,0 +1,62 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package failpoint injects faults at critical points of the DB, so that tests can check how it
+// recovers from a failure or a crash at an exact point.
+//
+// The failpoints are compiled in only with the failpoints build tag, e.g.
+//
+//	go test -tags failpoints ./...
+//
+// Without it, Inject does nothing and is inlined away, and Enable returns ErrNotBuilt.
+//
+// An Action enabled at a failpoint runs on the goroutine reaching it. The error it returns, if
+// any, fails the operation there, as an I/O error would. To simulate a crash, an Action made by
+// Pause blocks the goroutine, while the test copies the directory of the DB, as a crash would
+// leave it, and opens the copy.
+package failpoint
+
+import "errors"
+
+// The failpoints of the DB.
+const (
+	// AfterValueLogWrite is reached by the writer once a batch of writes is in the value log,
+	// before it is in the memtable.
+	AfterValueLogWrite = "after-value-log-write"
+	// ManifestRewriteBeforeRename is reached while the MANIFEST is rewritten, once the new
+	// MANIFEST is written and synced, before it replaces the old one.
+	ManifestRewriteBeforeRename = "manifest-rewrite-before-rename"
+	// CompactionAfterManifest is reached by a compaction once the MANIFEST records the tables it
+	// built and deleted, before the levels are updated.
+	CompactionAfterManifest = "compaction-after-manifest"
+	// CompactionAfterReplace is reached by a compaction once the tables it built replaced those
+	// of the next level, before those it compacted are deleted from their level.
+	CompactionAfterReplace = "compaction-after-replace"
+)
+
+// ErrNotBuilt is returned by Enable when the failpoints aren't compiled in.
+var ErrNotBuilt = errors.New("failpoint: the failpoints build tag is not set")
+
+// Action is run by the goroutine reaching a failpoint. The error it returns fails the operation
+// there.
+type Action func() error
+
+// Error returns an Action failing the operation with err.
+func Error(err error) Action {
+	return func() error { return err }
+}
+
+// Pause returns an Action which signals reached, without blocking if it's full, and blocks until
+// release is closed.
+func Pause(reached chan<- struct{}, release <-chan struct{}) Action {
+	return func() error {
+		select {
+		case reached <- struct{}{}:
+		default:
+		}
+		<-release
+		return nil
+	}
+}
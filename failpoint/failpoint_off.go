@@ -0,0 +1,28 @@
+//go:build !failpoints
+// +build !failpoints
+
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package failpoint
+
+// Enabled is whether the failpoints are compiled in.
+const Enabled = false
+
+// Enable returns ErrNotBuilt, as the failpoints aren't compiled in.
+func Enable(name string, action Action) error {
+	return ErrNotBuilt
+}
+
+// Disable does nothing, as the failpoints aren't compiled in.
+func Disable(name string) {}
+
+// Reset does nothing, as the failpoints aren't compiled in.
+func Reset() {}
+
+// Inject does nothing, as the failpoints aren't compiled in.
+func Inject(name string) error {
+	return nil
+}
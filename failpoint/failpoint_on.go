@@ -0,0 +1,52 @@
+//go:build failpoints
+// +build failpoints
+
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package failpoint
+
+import "sync"
+
+// Enabled is whether the failpoints are compiled in.
+const Enabled = true
+
+var (
+	mu      sync.RWMutex
+	actions = make(map[string]Action)
+)
+
+// Enable has the goroutines reaching the failpoint name run action, until it's disabled.
+func Enable(name string, action Action) error {
+	mu.Lock()
+	defer mu.Unlock()
+	actions[name] = action
+	return nil
+}
+
+// Disable disables the failpoint name. The goroutines running its action keep running it.
+func Disable(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(actions, name)
+}
+
+// Reset disables all the failpoints.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	clear(actions)
+}
+
+// Inject runs the action enabled at the failpoint name, if any, and returns its error.
+func Inject(name string) error {
+	mu.RLock()
+	action := actions[name]
+	mu.RUnlock()
+	if action == nil {
+		return nil
+	}
+	return action()
+}
@@ -0,0 +1,48 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package failpoint
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailpoint(t *testing.T) {
+	defer Reset()
+	errTest := errors.New("test")
+	require.NoError(t, Inject(AfterValueLogWrite))
+
+	err := Enable(AfterValueLogWrite, Error(errTest))
+	if !Enabled {
+		// The failpoints do nothing without the build tag.
+		require.ErrorIs(t, err, ErrNotBuilt)
+		require.NoError(t, Inject(AfterValueLogWrite))
+		return
+	}
+	require.NoError(t, err)
+	require.ErrorIs(t, Inject(AfterValueLogWrite), errTest)
+	require.NoError(t, Inject(CompactionAfterManifest))
+	Disable(AfterValueLogWrite)
+	require.NoError(t, Inject(AfterValueLogWrite))
+
+	reached, release := make(chan struct{}, 1), make(chan struct{})
+	require.NoError(t, Enable(CompactionAfterReplace, Pause(reached, release)))
+	done := make(chan error)
+	go func() { done <- Inject(CompactionAfterReplace) }()
+	<-reached
+	select {
+	case <-done:
+		t.Fatal("Inject returned before the release")
+	default:
+	}
+	close(release)
+	require.NoError(t, <-done)
+
+	Reset()
+	require.NoError(t, Inject(CompactionAfterReplace))
+}
@@ -0,0 +1,168 @@
+//go:build failpoints
+// +build failpoints
+
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/failpoint"
+	"github.com/luxfi/zapdb/pb"
+)
+
+// crashImage copies the files of dir into a new directory, as a crash would leave them, and
+// returns it.
+func crashImage(t *testing.T, dir string) string {
+	image := t.TempDir()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, e := range entries {
+		if e.IsDir() || e.Name() == lockFile {
+			continue
+		}
+		require.NoError(t, copyFile(filepath.Join(dir, e.Name()), filepath.Join(image, e.Name()), -1))
+	}
+	return image
+}
+
+func TestFailpointValueLogWrite(t *testing.T) {
+	defer failpoint.Reset()
+	opt := getTestOptions(t.TempDir())
+	db, err := Open(opt)
+	require.NoError(t, err)
+	set := func(key string) error {
+		return db.Update(func(txn *Txn) error {
+			return txn.Set([]byte(key), []byte("val"))
+		})
+	}
+	require.NoError(t, set("a"))
+
+	// The write fails once in the value log, before it's in the memtable, and the next ones go
+	// on.
+	errTest := errors.New("test")
+	require.NoError(t, failpoint.Enable(failpoint.AfterValueLogWrite, failpoint.Error(errTest)))
+	require.ErrorIs(t, set("b"), errTest)
+	failpoint.Disable(failpoint.AfterValueLogWrite)
+	require.NoError(t, set("c"))
+	require.NoError(t, db.Close())
+
+	db, err = Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	require.NoError(t, db.View(func(txn *Txn) error {
+		for _, key := range []string{"a", "c"} {
+			if _, err := txn.Get([]byte(key)); err != nil {
+				return err
+			}
+		}
+		_, err := txn.Get([]byte("b"))
+		require.ErrorIs(t, err, ErrKeyNotFound)
+		return nil
+	}))
+}
+
+func TestFailpointManifestRewrite(t *testing.T) {
+	defer failpoint.Reset()
+	dir := t.TempDir()
+	opt := getTestOptions(dir)
+	deletionsThreshold := 10
+	mf, _, err := helpOpenOrCreateManifestFile(dir, false, 0, deletionsThreshold, opt)
+	require.NoError(t, err)
+	require.NoError(t, mf.addChanges([]*pb.ManifestChange{newCreateChange(0, 0, 0, 0, 0)}, opt))
+
+	// The rewrite fails with the new MANIFEST written, and the old one in place.
+	errTest := errors.New("test")
+	require.NoError(t, failpoint.Enable(failpoint.ManifestRewriteBeforeRename,
+		failpoint.Error(errTest)))
+	var id uint64
+	for ; err == nil; id++ {
+		err = mf.addChanges([]*pb.ManifestChange{
+			newCreateChange(id+1, 0, 0, 0, 0),
+			newDeleteChange(id),
+		}, opt)
+	}
+	require.ErrorIs(t, err, errTest)
+	_ = mf.close()
+	failpoint.Disable(failpoint.ManifestRewriteBeforeRename)
+	_, err = os.Stat(filepath.Join(dir, manifestRewriteFilename))
+	require.NoError(t, err)
+
+	// The changes before the one which failed are there.
+	mf, m, err := helpOpenOrCreateManifestFile(dir, false, 0, deletionsThreshold, opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, mf.close()) }()
+	require.Len(t, m.Tables, 1)
+	require.Contains(t, m.Tables, id-1)
+}
+
+func TestFailpointCompaction(t *testing.T) {
+	for _, point := range []string{
+		failpoint.CompactionAfterManifest,
+		failpoint.CompactionAfterReplace,
+	} {
+		t.Run(point, func(t *testing.T) {
+			defer failpoint.Reset()
+			opt := getTestOptions(t.TempDir()).WithNumCompactors(0)
+			db, err := Open(opt)
+			require.NoError(t, err)
+			key := func(i int) []byte { return fmt.Appendf(nil, "key%04d", i) }
+			for i := 0; i < 1000; i++ {
+				require.NoError(t, db.Update(func(txn *Txn) error {
+					return txn.Set(key(i), fmt.Appendf(nil, "val%d", i))
+				}))
+				if i%250 == 249 {
+					require.NoError(t, db.flushMemTableForCheckpoint())
+				}
+			}
+			require.Equal(t, 4, db.Levels()[0].NumTables)
+
+			// The DB crashes in the middle of a compaction of level 0.
+			reached, release := make(chan struct{}, 1), make(chan struct{})
+			require.NoError(t, failpoint.Enable(point, failpoint.Pause(reached, release)))
+			compacted := make(chan error, 1)
+			go func() {
+				prio := compactionPriority{level: 0, score: 1.71, t: db.lc.levelTargets()}
+				compacted <- db.lc.doCompact(-1, prio)
+			}()
+			select {
+			case <-reached:
+			case err := <-compacted:
+				t.Fatalf("Compaction done without reaching the failpoint: %v", err)
+			}
+			image := crashImage(t, opt.Dir)
+			close(release)
+			require.NoError(t, <-compacted)
+			numL0 := db.Levels()[0].NumTables
+			require.Less(t, numL0, 4)
+			require.NoError(t, db.Close())
+
+			// The compaction is done for the MANIFEST of the crash, and all the keys are read from
+			// the tables it refers to.
+			db, err = Open(opt.WithDir(image).WithValueDir(image))
+			require.NoError(t, err)
+			defer func() { require.NoError(t, db.Close()) }()
+			require.Equal(t, numL0, db.Levels()[0].NumTables)
+			require.NoError(t, db.View(func(txn *Txn) error {
+				for i := 0; i < 1000; i++ {
+					item, err := txn.Get(key(i))
+					if err != nil {
+						return err
+					}
+					require.Equal(t, fmt.Appendf(nil, "val%d", i), getItemValue(t, item))
+				}
+				return nil
+			}))
+		})
+	}
+}
@@ -0,0 +1,131 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// EventKind is the kind of an internal event recorded by the flight recorder.
+type EventKind uint8
+
+const (
+	// EventCommit is recorded when a batch of write requests is applied. Value is the number
+	// of entries written.
+	EventCommit EventKind = iota + 1
+	// EventFlushStart and EventFlushDone bracket a memtable flush. Value is the memtable size.
+	EventFlushStart
+	EventFlushDone
+	// EventStall is recorded when writes stalled because of too many L0 tables. Value is the
+	// duration of the stall in milliseconds.
+	EventStall
+	// EventCompaction is recorded when a compaction completes. Value is the source level.
+	EventCompaction
+	// EventValueLogGC is recorded when a value log GC pass completes. Value is the fid of the
+	// rewritten value log file.
+	EventValueLogGC
+	// EventCompactionPause and EventCompactionResume are recorded when compactions are paused
+	// because the p99 latency of Get went above Options.ReadLatencySLO, and when they resume.
+	// Value is that latency in microseconds.
+	EventCompactionPause
+	EventCompactionResume
+	// EventCompactionForced is recorded when a level is compacted while compactions are paused,
+	// because of its backlog. Value is the level.
+	EventCompactionForced
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventCommit:
+		return "commit"
+	case EventFlushStart:
+		return "flush-start"
+	case EventFlushDone:
+		return "flush-done"
+	case EventStall:
+		return "stall"
+	case EventCompaction:
+		return "compaction"
+	case EventValueLogGC:
+		return "vlog-gc"
+	case EventCompactionPause:
+		return "compaction-pause"
+	case EventCompactionResume:
+		return "compaction-resume"
+	case EventCompactionForced:
+		return "compaction-forced"
+	}
+	return fmt.Sprintf("EventKind(%d)", uint8(k))
+}
+
+// Event is an internal event recorded by the flight recorder.
+type Event struct {
+	Time  time.Time
+	Kind  EventKind
+	Value int64
+	Err   error
+}
+
+func (e Event) String() string {
+	s := fmt.Sprintf("%s %s %d", e.Time.Format(time.RFC3339Nano), e.Kind, e.Value)
+	if e.Err != nil {
+		s += " err: " + e.Err.Error()
+	}
+	return s
+}
+
+// flightRecorder keeps the last events in a ring buffer. A nil flightRecorder records nothing.
+type flightRecorder struct {
+	sync.Mutex
+	events []Event
+	next   int
+	full   bool
+}
+
+func newFlightRecorder(size int) *flightRecorder {
+	if size <= 0 {
+		return nil
+	}
+	return &flightRecorder{events: make([]Event, size)}
+}
+
+func (fr *flightRecorder) record(kind EventKind, value int64, err error) {
+	if fr == nil {
+		return
+	}
+	now := time.Now()
+	fr.Lock()
+	fr.events[fr.next] = Event{Time: now, Kind: kind, Value: value, Err: err}
+	fr.next++
+	if fr.next == len(fr.events) {
+		fr.next = 0
+		fr.full = true
+	}
+	fr.Unlock()
+}
+
+func (fr *flightRecorder) dump() []Event {
+	if fr == nil {
+		return nil
+	}
+	fr.Lock()
+	defer fr.Unlock()
+	if !fr.full {
+		return append([]Event{}, fr.events[:fr.next]...)
+	}
+	out := make([]Event, 0, len(fr.events))
+	out = append(out, fr.events[fr.next:]...)
+	return append(out, fr.events[:fr.next]...)
+}
+
+// FlightRecorder returns the last Options.FlightRecorderSize internal events, like commits,
+// flushes, stalls and GC passes, oldest first. It is meant to be dumped after an incident, to
+// see what the DB was doing leading up to it.
+func (db *DB) FlightRecorder() []Event {
+	return db.events.dump()
+}
@@ -0,0 +1,69 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlightRecorderRing(t *testing.T) {
+	var fr *flightRecorder
+	fr.record(EventCommit, 1, nil)
+	require.Nil(t, fr.dump())
+
+	fr = newFlightRecorder(3)
+	fr.record(EventCommit, 1, nil)
+	fr.record(EventCommit, 2, nil)
+	events := fr.dump()
+	require.Len(t, events, 2)
+	require.Equal(t, int64(1), events[0].Value)
+
+	fr.record(EventFlushStart, 3, nil)
+	fr.record(EventFlushDone, 4, errors.New("boom"))
+	events = fr.dump()
+	require.Len(t, events, 3)
+	for i, want := range []int64{2, 3, 4} {
+		require.Equal(t, want, events[i].Value)
+	}
+	require.False(t, events[0].Time.After(events[2].Time))
+	require.Contains(t, events[2].String(), "flush-done 4 err: boom")
+}
+
+func TestFlightRecorder(t *testing.T) {
+	opt := getTestOptions("").WithFlightRecorderSize(16)
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		for i := 0; i < 20; i++ {
+			require.NoError(t, db.Update(func(txn *Txn) error {
+				return txn.Set([]byte("key"), []byte("value"))
+			}))
+		}
+		events := db.FlightRecorder()
+		require.Len(t, events, 16)
+		for _, e := range events {
+			require.Equal(t, EventCommit, e.Kind)
+		}
+
+		// Flushing the memtable is recorded.
+		require.NoError(t, db.DropPrefix([]byte("key")))
+		var kinds []EventKind
+		for _, e := range db.FlightRecorder() {
+			kinds = append(kinds, e.Kind)
+		}
+		require.Contains(t, kinds, EventFlushStart)
+		require.Contains(t, kinds, EventFlushDone)
+	})
+
+	opt = getTestOptions("").WithFlightRecorderSize(0)
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Set([]byte("key"), []byte("value"))
+		}))
+		require.Empty(t, db.FlightRecorder())
+	})
+}
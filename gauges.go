@@ -0,0 +1,59 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"time"
+
+	"github.com/luxfi/zapdb/y"
+)
+
+// publishGauges publishes the ages of the data not yet durable in the MetricsSet of the DB, in
+// milliseconds:
+//
+//   - unflushed_age_ms_memtable is the age of the oldest entry not flushed to a table yet.
+//   - unsynced_age_ms_logs is the age of the oldest write not synced to the WAL and value log.
+//   - apply_lag_ms_follower is how far behind the leader the reads of a follower are, see
+//     DB.ReplicationLag.
+func (db *DB) publishGauges() {
+	ms := func(age func(time.Time) time.Duration) y.Gauge {
+		return func() int64 { return age(time.Now()).Milliseconds() }
+	}
+	db.metrics.GaugeSet("unflushed_age_ms_memtable", ms(db.unflushedAge))
+	db.metrics.GaugeSet("unsynced_age_ms_logs", ms(db.unsyncedAge))
+	if db.opt.Follower {
+		db.metrics.GaugeSet("apply_lag_ms_follower", ms(db.replicationLag))
+	}
+}
+
+// sinceNanos returns how long before now the time in unix nanoseconds t is, or zero if t is.
+func sinceNanos(now time.Time, t int64) time.Duration {
+	if t == 0 {
+		return 0
+	}
+	return max(now.Sub(time.Unix(0, t)), 0)
+}
+
+// unflushedAge returns the age of the oldest entry in the memtables at now.
+func (db *DB) unflushedAge(now time.Time) time.Duration {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	// The immutable memtables are older than the mutable one, the first the oldest.
+	for _, mt := range db.imm {
+		if t := mt.firstWrite.Load(); t != 0 {
+			return sinceNanos(now, t)
+		}
+	}
+	if db.mt == nil {
+		return 0
+	}
+	return sinceNanos(now, db.mt.firstWrite.Load())
+}
+
+// unsyncedAge returns the age of the oldest write not synced at now.
+func (db *DB) unsyncedAge(now time.Time) time.Duration {
+	return sinceNanos(now, db.unsyncedSince.Load())
+}
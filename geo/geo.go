@@ -0,0 +1,247 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package geo indexes points by latitude and longitude on top of a DB.
+//
+// Points are stored under prefix + "h" + geohash + ID, so the points of any geohash cell are
+// found with a prefix scan. Bounding box and radius queries scan the few cells covering the
+// area and filter out the points outside of it. The location of every point is also kept under
+// prefix + "p" + ID, so that moving or deleting a point removes its old entry.
+package geo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	badger "github.com/luxfi/zapdb"
+)
+
+// ErrInvalidPoint is returned for a latitude outside [-90, 90] or a longitude outside
+// [-180, 180].
+var ErrInvalidPoint = errors.New("geo: invalid point")
+
+// earthRadius is the mean radius of the Earth in meters.
+const earthRadius = 6371008.8
+
+// Point is an indexed location.
+type Point struct {
+	ID       []byte
+	Lat, Lon float64
+}
+
+// Box is an area bounded by latitudes and longitudes. Boxes crossing the antimeridian are not
+// supported; split them in two.
+type Box struct {
+	MinLat, MinLon, MaxLat, MaxLon float64
+}
+
+// Contains returns true if the point is inside the box, borders included.
+func (b Box) Contains(lat, lon float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lon >= b.MinLon && lon <= b.MaxLon
+}
+
+// Distance returns the great-circle distance in meters between two points.
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dlat := (lat2 - lat1) * rad
+	dlon := (lon2 - lon1) * rad
+	a := math.Sin(dlat/2)*math.Sin(dlat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dlon/2)*math.Sin(dlon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+func valid(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// Index stores points under a key prefix of a DB.
+type Index struct {
+	prefix []byte
+}
+
+// New returns an Index keeping its points under prefix.
+func New(prefix []byte) *Index {
+	return &Index{prefix: append([]byte{}, prefix...)}
+}
+
+func (x *Index) cellKey(hash string) []byte {
+	key := append(append([]byte{}, x.prefix...), 'h')
+	return append(key, hash...)
+}
+
+func (x *Index) pointKey(id []byte) []byte {
+	key := append(append([]byte{}, x.prefix...), 'p')
+	return append(key, id...)
+}
+
+func encodeLocation(lat, lon float64) []byte {
+	buf := binary.BigEndian.AppendUint64(nil, math.Float64bits(lat))
+	return binary.BigEndian.AppendUint64(buf, math.Float64bits(lon))
+}
+
+func decodeLocation(buf []byte) (lat, lon float64, err error) {
+	if len(buf) != 16 {
+		return 0, 0, fmt.Errorf("geo: corrupt location of %d bytes", len(buf))
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(buf)),
+		math.Float64frombits(binary.BigEndian.Uint64(buf[8:])), nil
+}
+
+// Put stores the point id at the given location, moving it if it was stored before.
+func (x *Index) Put(txn *badger.Txn, id []byte, lat, lon float64) error {
+	if !valid(lat, lon) {
+		return ErrInvalidPoint
+	}
+	if err := x.Delete(txn, id); err != nil {
+		return err
+	}
+	loc := encodeLocation(lat, lon)
+	if err := txn.Set(append(x.cellKey(Encode(lat, lon, MaxPrecision)), id...), loc); err != nil {
+		return err
+	}
+	return txn.Set(x.pointKey(id), loc)
+}
+
+// Get returns the location of the point id, or badger.ErrKeyNotFound.
+func (x *Index) Get(txn *badger.Txn, id []byte) (lat, lon float64, err error) {
+	item, err := txn.Get(x.pointKey(id))
+	if err != nil {
+		return 0, 0, err
+	}
+	err = item.Value(func(val []byte) error {
+		lat, lon, err = decodeLocation(val)
+		return err
+	})
+	return lat, lon, err
+}
+
+// Delete removes the point id. Deleting a missing point is not an error.
+func (x *Index) Delete(txn *badger.Txn, id []byte) error {
+	lat, lon, err := x.Get(txn, id)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := txn.Delete(append(x.cellKey(Encode(lat, lon, MaxPrecision)), id...)); err != nil {
+		return err
+	}
+	return txn.Delete(x.pointKey(id))
+}
+
+// Within returns an iterator over the points inside b, cell by cell.
+func (x *Index) Within(txn *badger.Txn, b Box) *Points {
+	return x.points(txn, b, b.Contains)
+}
+
+// Radius returns an iterator over the points within meters of the given center.
+func (x *Index) Radius(txn *badger.Txn, lat, lon, meters float64) *Points {
+	dlat := meters / earthRadius * 180 / math.Pi
+	b := Box{MinLat: math.Max(-90, lat-dlat), MaxLat: math.Min(90, lat+dlat)}
+	// Near the poles, or for large radii, every longitude can be in range.
+	farthest := math.Max(math.Abs(b.MinLat), math.Abs(b.MaxLat))
+	if coslat := math.Cos(farthest * math.Pi / 180); coslat > 0 {
+		dlon := dlat / coslat
+		b.MinLon, b.MaxLon = lon-dlon, lon+dlon
+	}
+	if b.MaxLon-b.MinLon >= 360 || b.MinLon < -180 || b.MaxLon > 180 {
+		// Cover the whole band of latitudes rather than wrapping around the antimeridian.
+		b.MinLon, b.MaxLon = -180, 180
+	}
+	return x.points(txn, b, func(plat, plon float64) bool {
+		return Distance(lat, lon, plat, plon) <= meters
+	})
+}
+
+func (x *Index) points(txn *badger.Txn, b Box, match func(lat, lon float64) bool) *Points {
+	p := &Points{x: x, txn: txn, match: match}
+	if valid(b.MinLat, b.MinLon) && valid(b.MaxLat, b.MaxLon) &&
+		b.MinLat <= b.MaxLat && b.MinLon <= b.MaxLon {
+		p.cells = cover(b)
+	}
+	p.Next()
+	return p
+}
+
+// Points iterates over the points matching a query. It must be closed.
+type Points struct {
+	x     *Index
+	txn   *badger.Txn
+	match func(lat, lon float64) bool
+	cells []string
+
+	it     *badger.Iterator
+	prefix []byte
+	point  Point
+	valid  bool
+	err    error
+}
+
+// Valid returns false when iteration is done, or failed.
+func (p *Points) Valid() bool {
+	return p.valid
+}
+
+// Point returns the current point.
+func (p *Points) Point() Point {
+	return p.point
+}
+
+// Err returns the error that ended the iteration, if any.
+func (p *Points) Err() error {
+	return p.err
+}
+
+// Next advances to the next matching point.
+func (p *Points) Next() {
+	p.valid = false
+	for p.err == nil {
+		if p.it == nil {
+			if len(p.cells) == 0 {
+				return
+			}
+			p.prefix = p.x.cellKey(p.cells[0])
+			p.cells = p.cells[1:]
+			p.it = p.txn.NewIterator(badger.IteratorOptions{
+				Prefix: p.prefix, PrefetchValues: true, PrefetchSize: 100,
+			})
+			p.it.Rewind()
+		} else {
+			p.it.Next()
+		}
+		if !p.it.Valid() {
+			p.it.Close()
+			p.it = nil
+			continue
+		}
+		item := p.it.Item()
+		var lat, lon float64
+		p.err = item.Value(func(val []byte) error {
+			var err error
+			lat, lon, err = decodeLocation(val)
+			return err
+		})
+		if p.err != nil || !p.match(lat, lon) {
+			// The loop stops on an error.
+			continue
+		}
+		key := item.Key()
+		id := key[len(p.x.prefix)+1+MaxPrecision:]
+		p.point = Point{ID: append([]byte{}, id...), Lat: lat, Lon: lon}
+		p.valid = true
+		return
+	}
+}
+
+// Close releases the iterator.
+func (p *Points) Close() {
+	if p.it != nil {
+		p.it.Close()
+		p.it = nil
+	}
+}
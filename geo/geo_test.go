@@ -0,0 +1,110 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package geo
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	badger "github.com/luxfi/zapdb"
+	"github.com/luxfi/zapdb/testkit"
+)
+
+func TestGeohash(t *testing.T) {
+	// Reference values from the original geohash.org implementation.
+	require.Equal(t, "ezs42", Encode(42.6, -5.6, 5))
+	require.Equal(t, "u4pruydqqvj", Encode(57.64911, 10.40744, 11))
+
+	b := Bounds("ezs42")
+	require.True(t, b.Contains(42.6, -5.6))
+	require.InDelta(t, 42.583, b.MinLat, 0.001)
+	require.InDelta(t, -5.625, b.MinLon, 0.001)
+}
+
+func TestDistance(t *testing.T) {
+	// Paris to London is about 344km.
+	require.InDelta(t, 343.5e3, Distance(48.8566, 2.3522, 51.5074, -0.1278), 1e3)
+	require.Zero(t, Distance(10, 10, 10, 10))
+}
+
+func ids(t *testing.T, p *Points) []string {
+	defer p.Close()
+	var out []string
+	for ; p.Valid(); p.Next() {
+		out = append(out, string(p.Point().ID))
+	}
+	require.NoError(t, p.Err())
+	sort.Strings(out)
+	return out
+}
+
+func TestIndex(t *testing.T) {
+	db := testkit.OpenInMemory(t)
+
+	x := New([]byte("geo/"))
+	type point struct {
+		lat, lon float64
+	}
+	points := make(map[string]point)
+	r := rand.New(rand.NewSource(1))
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		for i := 0; i < 500; i++ {
+			// Points around Europe.
+			p := point{lat: 35 + r.Float64()*25, lon: -10 + r.Float64()*40}
+			id := fmt.Sprintf("p%03d", i)
+			points[id] = p
+			require.NoError(t, x.Put(txn, []byte(id), p.lat, p.lon))
+		}
+		require.ErrorIs(t, x.Put(txn, []byte("bad"), 91, 0), ErrInvalidPoint)
+		return nil
+	}))
+
+	check := func(q func(txn *badger.Txn) *Points, match func(p point) bool) {
+		var want []string
+		for id, p := range points {
+			if match(p) {
+				want = append(want, id)
+			}
+		}
+		sort.Strings(want)
+		require.NoError(t, db.View(func(txn *badger.Txn) error {
+			require.Equal(t, want, ids(t, q(txn)))
+			return nil
+		}))
+	}
+
+	for _, b := range []Box{
+		{MinLat: 45, MinLon: 0, MaxLat: 50, MaxLon: 10},
+		{MinLat: 48.1, MinLon: 2.1, MaxLat: 48.3, MaxLon: 2.4},
+		{MinLat: -90, MinLon: -180, MaxLat: 90, MaxLon: 180},
+	} {
+		check(func(txn *badger.Txn) *Points { return x.Within(txn, b) },
+			func(p point) bool { return b.Contains(p.lat, p.lon) })
+	}
+	for _, meters := range []float64{1e3, 100e3, 1000e3, 30000e3} {
+		check(func(txn *badger.Txn) *Points { return x.Radius(txn, 48.85, 2.35, meters) },
+			func(p point) bool { return Distance(48.85, 2.35, p.lat, p.lon) <= meters })
+	}
+
+	// Moving and deleting points updates the index.
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		require.NoError(t, x.Put(txn, []byte("p000"), 0, 0))
+		return x.Delete(txn, []byte("p001"))
+	}))
+	points["p000"] = point{}
+	delete(points, "p001")
+	check(func(txn *badger.Txn) *Points {
+		return x.Within(txn, Box{MinLat: -90, MinLon: -180, MaxLat: 90, MaxLon: 180})
+	}, func(point) bool { return true })
+	require.NoError(t, db.View(func(txn *badger.Txn) error {
+		require.Equal(t, []string{"p000"}, ids(t, x.Radius(txn, 0, 0, 1)))
+		return nil
+	}))
+}
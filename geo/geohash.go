@@ -0,0 +1,118 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package geo
+
+import (
+	"math"
+	"strings"
+)
+
+const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// MaxPrecision is the length of the geohashes points are indexed under, about 3.7cm by 1.9cm.
+const MaxPrecision = 12
+
+// Encode returns the geohash of the given point with precision characters.
+func Encode(lat, lon float64, precision int) string {
+	latLo, latHi := -90.0, 90.0
+	lonLo, lonHi := -180.0, 180.0
+	var sb strings.Builder
+	var ch, bit int
+	even := true
+	for sb.Len() < precision {
+		if even {
+			mid := (lonLo + lonHi) / 2
+			if lon >= mid {
+				ch |= 1 << (4 - bit)
+				lonLo = mid
+			} else {
+				lonHi = mid
+			}
+		} else {
+			mid := (latLo + latHi) / 2
+			if lat >= mid {
+				ch |= 1 << (4 - bit)
+				latLo = mid
+			} else {
+				latHi = mid
+			}
+		}
+		even = !even
+		if bit++; bit == 5 {
+			sb.WriteByte(base32[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return sb.String()
+}
+
+// Bounds returns the box covered by a geohash.
+func Bounds(hash string) Box {
+	b := Box{MinLat: -90, MaxLat: 90, MinLon: -180, MaxLon: 180}
+	even := true
+	for i := 0; i < len(hash); i++ {
+		ch := strings.IndexByte(base32, hash[i])
+		for bit := 4; bit >= 0; bit-- {
+			set := ch>>bit&1 == 1
+			if even {
+				mid := (b.MinLon + b.MaxLon) / 2
+				if set {
+					b.MinLon = mid
+				} else {
+					b.MaxLon = mid
+				}
+			} else {
+				mid := (b.MinLat + b.MaxLat) / 2
+				if set {
+					b.MinLat = mid
+				} else {
+					b.MaxLat = mid
+				}
+			}
+			even = !even
+		}
+	}
+	return b
+}
+
+// cellSize returns the height and width in degrees of geohash cells of the given precision.
+func cellSize(precision int) (lat, lon float64) {
+	bits := 5 * precision
+	lonBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / math.Pow(2, float64(latBits)), 360 / math.Pow(2, float64(lonBits))
+}
+
+// maxCells bounds the number of prefix scans of a query.
+const maxCells = 32
+
+// cover returns geohash prefixes whose cells together cover b. It picks the longest precision
+// that needs no more than maxCells cells.
+func cover(b Box) []string {
+	for p := MaxPrecision; p >= 1; p-- {
+		dlat, dlon := cellSize(p)
+		nlat := int(math.Floor(b.MaxLat/dlat) - math.Floor(b.MinLat/dlat) + 1)
+		nlon := int(math.Floor(b.MaxLon/dlon) - math.Floor(b.MinLon/dlon) + 1)
+		if nlat*nlon > maxCells && p > 1 {
+			continue
+		}
+		seen := make(map[string]struct{})
+		var cells []string
+		for i := 0; i < nlat; i++ {
+			lat := math.Min(b.MinLat+float64(i)*dlat, b.MaxLat)
+			for j := 0; j < nlon; j++ {
+				lon := math.Min(b.MinLon+float64(j)*dlon, b.MaxLon)
+				h := Encode(lat, lon, p)
+				if _, ok := seen[h]; !ok {
+					seen[h] = struct{}{}
+					cells = append(cells, h)
+				}
+			}
+		}
+		return cells
+	}
+	return nil
+}
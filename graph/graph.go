@@ -0,0 +1,213 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package graph stores directed, labelled edges on top of a DB.
+//
+// Every edge (src, predicate, dst) is stored twice under the prefix of the Graph: once keyed
+// by src, to find the outgoing edges of a node, and once keyed by dst, to find the incoming
+// ones. Both keys are written in the same transaction, so the two indexes never disagree.
+// Components are length prefixed, so any bytes, including empty ones, can be used for nodes
+// and predicates.
+package graph
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	badger "github.com/luxfi/zapdb"
+)
+
+// ErrInvalidKey is returned if an edge component is longer than 65535 bytes.
+var ErrInvalidKey = errors.New("graph: edge component too long")
+
+const (
+	outTag = 'o'
+	inTag  = 'i'
+)
+
+// Edge is a directed edge from Src to Dst, labelled with Pred.
+type Edge struct {
+	Src, Pred, Dst []byte
+}
+
+func (e Edge) String() string {
+	return fmt.Sprintf("%q -%q-> %q", e.Src, e.Pred, e.Dst)
+}
+
+// Graph stores edges under a key prefix of a DB.
+type Graph struct {
+	prefix []byte
+}
+
+// New returns a Graph keeping its edges under prefix.
+func New(prefix []byte) *Graph {
+	return &Graph{prefix: append([]byte{}, prefix...)}
+}
+
+func appendComponent(key, c []byte) []byte {
+	key = binary.BigEndian.AppendUint16(key, uint16(len(c)))
+	return append(key, c...)
+}
+
+// key returns the key of the edge from a to b in the index given by tag. With a nil b, it returns
+// the prefix of all edges from a labelled pred. Without withPred, it returns the prefix of all
+// edges from a.
+func (g *Graph) key(tag byte, a, pred, b []byte, withPred bool) []byte {
+	key := make([]byte, 0, len(g.prefix)+1+6+len(a)+len(pred)+len(b))
+	key = append(key, g.prefix...)
+	key = append(key, tag)
+	key = appendComponent(key, a)
+	if !withPred {
+		return key
+	}
+	key = appendComponent(key, pred)
+	return append(key, b...)
+}
+
+func (g *Graph) decode(tag byte, key []byte) (Edge, error) {
+	rest := key[len(g.prefix)+1:]
+	next := func() ([]byte, error) {
+		if len(rest) < 2 {
+			return nil, fmt.Errorf("graph: malformed key %q", key)
+		}
+		n := int(binary.BigEndian.Uint16(rest))
+		if len(rest) < 2+n {
+			return nil, fmt.Errorf("graph: malformed key %q", key)
+		}
+		c := append([]byte{}, rest[2:2+n]...)
+		rest = rest[2+n:]
+		return c, nil
+	}
+	a, err := next()
+	if err != nil {
+		return Edge{}, err
+	}
+	pred, err := next()
+	if err != nil {
+		return Edge{}, err
+	}
+	b := append([]byte{}, rest...)
+	if tag == inTag {
+		a, b = b, a
+	}
+	return Edge{Src: a, Pred: pred, Dst: b}, nil
+}
+
+func validate(e Edge) error {
+	for _, c := range [][]byte{e.Src, e.Pred, e.Dst} {
+		if len(c) > 1<<16-1 {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
+
+// AddEdge adds e with an optional value to both indexes. Adding an existing edge replaces its
+// value.
+func (g *Graph) AddEdge(txn *badger.Txn, e Edge, value []byte) error {
+	if err := validate(e); err != nil {
+		return err
+	}
+	if err := txn.Set(g.key(outTag, e.Src, e.Pred, e.Dst, true), value); err != nil {
+		return err
+	}
+	return txn.Set(g.key(inTag, e.Dst, e.Pred, e.Src, true), nil)
+}
+
+// RemoveEdge removes e from both indexes. Removing a missing edge is not an error.
+func (g *Graph) RemoveEdge(txn *badger.Txn, e Edge) error {
+	if err := validate(e); err != nil {
+		return err
+	}
+	if err := txn.Delete(g.key(outTag, e.Src, e.Pred, e.Dst, true)); err != nil {
+		return err
+	}
+	return txn.Delete(g.key(inTag, e.Dst, e.Pred, e.Src, true))
+}
+
+// EdgeValue returns the value stored with e, or badger.ErrKeyNotFound if there is no such edge.
+func (g *Graph) EdgeValue(txn *badger.Txn, e Edge) ([]byte, error) {
+	if err := validate(e); err != nil {
+		return nil, err
+	}
+	item, err := txn.Get(g.key(outTag, e.Src, e.Pred, e.Dst, true))
+	if err != nil {
+		return nil, err
+	}
+	return item.ValueCopy(nil)
+}
+
+// Out returns an iterator over the edges leaving src. With a nil pred, it iterates over edges of
+// every predicate, grouped by predicate.
+func (g *Graph) Out(txn *badger.Txn, src, pred []byte) *Neighbors {
+	return g.neighbors(txn, outTag, src, pred)
+}
+
+// In returns an iterator over the edges arriving at dst. With a nil pred, it iterates over edges
+// of every predicate, grouped by predicate.
+func (g *Graph) In(txn *badger.Txn, dst, pred []byte) *Neighbors {
+	return g.neighbors(txn, inTag, dst, pred)
+}
+
+func (g *Graph) neighbors(txn *badger.Txn, tag byte, node, pred []byte) *Neighbors {
+	opt := badger.DefaultIteratorOptions
+	opt.PrefetchValues = tag == outTag
+	opt.Prefix = g.key(tag, node, pred, nil, pred != nil)
+	n := &Neighbors{g: g, tag: tag, it: txn.NewIterator(opt)}
+	n.it.Rewind()
+	n.parse()
+	return n
+}
+
+// Neighbors iterates over the edges of a node. It must be closed.
+type Neighbors struct {
+	g    *Graph
+	tag  byte
+	it   *badger.Iterator
+	edge Edge
+	err  error
+}
+
+func (n *Neighbors) parse() {
+	if n.it.Valid() {
+		n.edge, n.err = n.g.decode(n.tag, n.it.Item().Key())
+	}
+}
+
+// Valid returns false when iteration is done, or failed.
+func (n *Neighbors) Valid() bool {
+	return n.err == nil && n.it.Valid()
+}
+
+// Next advances to the next edge.
+func (n *Neighbors) Next() {
+	n.it.Next()
+	n.parse()
+}
+
+// Edge returns the current edge.
+func (n *Neighbors) Edge() Edge {
+	return n.edge
+}
+
+// Value returns a copy of the value stored with the current edge. Only iterators returned by Out
+// carry values; for edges from In, use Graph.EdgeValue.
+func (n *Neighbors) Value() ([]byte, error) {
+	if n.tag == outTag {
+		return n.it.Item().ValueCopy(nil)
+	}
+	return nil, errors.New("graph: In iterators don't carry edge values; use Graph.EdgeValue")
+}
+
+// Err returns the error that ended the iteration, if any.
+func (n *Neighbors) Err() error {
+	return n.err
+}
+
+// Close releases the iterator.
+func (n *Neighbors) Close() {
+	n.it.Close()
+}
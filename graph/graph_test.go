@@ -0,0 +1,85 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	badger "github.com/luxfi/zapdb"
+	"github.com/luxfi/zapdb/testkit"
+)
+
+func edges(t *testing.T, n *Neighbors) []Edge {
+	defer n.Close()
+	var out []Edge
+	for ; n.Valid(); n.Next() {
+		out = append(out, n.Edge())
+	}
+	require.NoError(t, n.Err())
+	return out
+}
+
+func e(src, pred, dst string) Edge {
+	return Edge{Src: []byte(src), Pred: []byte(pred), Dst: []byte(dst)}
+}
+
+func TestGraph(t *testing.T) {
+	db := testkit.OpenInMemory(t)
+
+	g := New([]byte("g/"))
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		for _, edge := range []Edge{
+			e("alice", "follows", "bob"),
+			e("alice", "follows", "carol"),
+			e("alice", "likes", "bob"),
+			// alice is a prefix of alicia; their edges must not mix.
+			e("alicia", "follows", "alice"),
+			e("bob", "follows", "alice"),
+		} {
+			require.NoError(t, g.AddEdge(txn, edge, []byte(edge.String())))
+		}
+		return nil
+	}))
+
+	require.NoError(t, db.View(func(txn *badger.Txn) error {
+		// Predicates are length prefixed, so shorter ones come first.
+		require.Equal(t, []Edge{
+			e("alice", "likes", "bob"),
+			e("alice", "follows", "bob"),
+			e("alice", "follows", "carol"),
+		}, edges(t, g.Out(txn, []byte("alice"), nil)))
+		require.Equal(t, []Edge{
+			e("alice", "likes", "bob"),
+		}, edges(t, g.Out(txn, []byte("alice"), []byte("likes"))))
+		require.Equal(t, []Edge{
+			e("alicia", "follows", "alice"),
+			e("bob", "follows", "alice"),
+		}, edges(t, g.In(txn, []byte("alice"), []byte("follows"))))
+		require.Empty(t, edges(t, g.In(txn, []byte("alice"), []byte("likes"))))
+
+		n := g.Out(txn, []byte("bob"), nil)
+		defer n.Close()
+		require.True(t, n.Valid())
+		val, err := n.Value()
+		require.NoError(t, err)
+		require.Equal(t, e("bob", "follows", "alice").String(), string(val))
+		return nil
+	}))
+
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		return g.RemoveEdge(txn, e("alice", "follows", "bob"))
+	}))
+	require.NoError(t, db.View(func(txn *badger.Txn) error {
+		_, err := g.EdgeValue(txn, e("alice", "follows", "bob"))
+		require.ErrorIs(t, err, badger.ErrKeyNotFound)
+		require.Equal(t, []Edge{
+			e("alice", "likes", "bob"),
+		}, edges(t, g.In(txn, []byte("bob"), nil)))
+		return nil
+	}))
+}
@@ -0,0 +1,227 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+
+	"github.com/luxfi/zapdb/y"
+)
+
+// heatmapKey is the key the sampled access counts of the heatmap are persisted to.
+var heatmapKey = []byte("!badger!heatmap")
+
+// heatmapMaxPrefixes bounds the number of prefixes counted by the heatmap. The accesses of the
+// prefixes seen once the heatmap is full aren't counted.
+const heatmapMaxPrefixes = 1 << 16
+
+// PrefixHeat is the estimated number of accesses to the keys with a prefix, as returned by
+// DB.Heatmap.
+type PrefixHeat struct {
+	Prefix []byte `json:"prefix"`
+	// Reads counts the point reads of Txn.Get, and Writes the entries written.
+	Reads  uint64 `json:"reads"`
+	Writes uint64 `json:"writes"`
+}
+
+// heatmap counts a sample of the accesses to the keys of a DB by their prefixes of up to
+// HeatmapPrefixLen bytes. A nil heatmap counts nothing.
+type heatmap struct {
+	sync.Mutex
+	rate float64
+	// weight is the number of accesses a sampled access stands for.
+	weight    uint64
+	prefixLen int
+	counts    map[string]*PrefixHeat
+}
+
+func newHeatmap(opt Options) *heatmap {
+	if opt.HeatmapSampleRate <= 0 {
+		return nil
+	}
+	return &heatmap{
+		rate:      opt.HeatmapSampleRate,
+		weight:    uint64(1/opt.HeatmapSampleRate + 0.5),
+		prefixLen: opt.HeatmapPrefixLen,
+		counts:    make(map[string]*PrefixHeat),
+	}
+}
+
+// sampled tells if an access is part of the sample.
+func (h *heatmap) sampled() bool {
+	return h != nil && (h.rate >= 1 || rand.Float64() < h.rate)
+}
+
+// record counts a sampled access to key, a read or a write. Internal keys aren't counted.
+func (h *heatmap) record(key []byte, write bool) {
+	if bytes.HasPrefix(key, badgerPrefix) {
+		return
+	}
+	prefix := key[:min(len(key), h.prefixLen)]
+	h.Lock()
+	defer h.Unlock()
+	c, ok := h.counts[string(prefix)]
+	if !ok {
+		if len(h.counts) >= heatmapMaxPrefixes {
+			return
+		}
+		c = &PrefixHeat{Prefix: y.SafeCopy(nil, prefix)}
+		h.counts[string(prefix)] = c
+	}
+	if write {
+		c.Writes += h.weight
+	} else {
+		c.Reads += h.weight
+	}
+}
+
+// recordRead counts a read of key, if sampled.
+func (h *heatmap) recordRead(key []byte) {
+	if h.sampled() {
+		h.record(key, false)
+	}
+}
+
+// recordWrites counts the writes of the entries of reqs which are sampled.
+func (h *heatmap) recordWrites(reqs []*request) {
+	if h == nil {
+		return
+	}
+	for _, r := range reqs {
+		for _, e := range r.Entries {
+			if h.sampled() {
+				h.record(y.ParseKey(e.Key), true)
+			}
+		}
+	}
+}
+
+// snapshot returns a copy of the counts, in no particular order.
+func (h *heatmap) snapshot() []PrefixHeat {
+	h.Lock()
+	defer h.Unlock()
+	out := make([]PrefixHeat, 0, len(h.counts))
+	for _, c := range h.counts {
+		out = append(out, *c)
+	}
+	return out
+}
+
+// load adds the counts persisted by a previous run of the DB.
+func (h *heatmap) load(db *DB) error {
+	var saved []PrefixHeat
+	err := db.View(func(txn *Txn) error {
+		item, err := txn.Get(heatmapKey)
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &saved)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	h.Lock()
+	defer h.Unlock()
+	for _, s := range saved {
+		if len(h.counts) >= heatmapMaxPrefixes {
+			break
+		}
+		c, ok := h.counts[string(s.Prefix)]
+		if !ok {
+			c = &PrefixHeat{Prefix: s.Prefix}
+			h.counts[string(s.Prefix)] = c
+		}
+		c.Reads += s.Reads
+		c.Writes += s.Writes
+	}
+	return nil
+}
+
+// save persists the counts, to be loaded by the next run of the DB.
+func (h *heatmap) save(db *DB) error {
+	val, err := json.Marshal(h.snapshot())
+	if err != nil {
+		return err
+	}
+	return db.Update(func(txn *Txn) error {
+		return txn.modifyKey(&Entry{Key: heatmapKey, Value: val}, true)
+	})
+}
+
+// run persists the counts every HeatmapInterval, and once more when lc is closed.
+func (h *heatmap) run(db *DB, lc *z.Closer) {
+	defer lc.Done()
+	ticker := time.NewTicker(db.opt.HeatmapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lc.HasBeenClosed():
+			if err := h.save(db); err != nil {
+				db.opt.Warningf("While saving heatmap: %v", err)
+			}
+			return
+		case <-ticker.C:
+		}
+		if err := h.save(db); err != nil {
+			db.opt.Warningf("While saving heatmap: %v", err)
+		}
+	}
+}
+
+// Heatmap returns the estimated number of reads and writes of the keys by their prefixes of
+// prefixDepth bytes, hottest first, from a sample of HeatmapSampleRate of the accesses. Keys
+// shorter than prefixDepth count as their own prefix. The counts are kept across restarts, so
+// that the skew of the accesses can be told from data when designing caches and shards.
+//
+// prefixDepth is capped at HeatmapPrefixLen. Heatmap returns nil if HeatmapSampleRate isn't set.
+func (db *DB) Heatmap(prefixDepth int) ([]PrefixHeat, error) {
+	if db.IsClosed() {
+		return nil, ErrDBClosed
+	}
+	if prefixDepth <= 0 {
+		return nil, errors.New("prefixDepth must be positive")
+	}
+	if db.heatmap == nil {
+		return nil, nil
+	}
+	byPrefix := make(map[string]*PrefixHeat)
+	var out []*PrefixHeat
+	for _, c := range db.heatmap.snapshot() {
+		prefix := c.Prefix[:min(len(c.Prefix), prefixDepth)]
+		agg, ok := byPrefix[string(prefix)]
+		if !ok {
+			agg = &PrefixHeat{Prefix: prefix}
+			byPrefix[string(prefix)] = agg
+			out = append(out, agg)
+		}
+		agg.Reads += c.Reads
+		agg.Writes += c.Writes
+	}
+	sort.Slice(out, func(i, j int) bool {
+		hi, hj := out[i].Reads+out[i].Writes, out[j].Reads+out[j].Writes
+		if hi != hj {
+			return hi > hj
+		}
+		return bytes.Compare(out[i].Prefix, out[j].Prefix) < 0
+	})
+	heats := make([]PrefixHeat, len(out))
+	for i, c := range out {
+		heats[i] = *c
+	}
+	return heats, nil
+}
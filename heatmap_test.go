@@ -0,0 +1,60 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeatmap(t *testing.T) {
+	dir := t.TempDir()
+	opt := getTestOptions(dir).WithHeatmapSampleRate(1).WithHeatmapPrefixLen(4)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		for i := range 10 {
+			if err := txn.Set(fmt.Appendf(nil, "hot/%d", i), []byte("v")); err != nil {
+				return err
+			}
+		}
+		return txn.Set([]byte("cold"), []byte("v"))
+	}))
+	require.NoError(t, db.View(func(txn *Txn) error {
+		for range 5 {
+			if _, err := txn.Get([]byte("hot/1")); err != nil {
+				return err
+			}
+		}
+		_, err := txn.Get([]byte("hot"))
+		require.ErrorIs(t, err, ErrKeyNotFound)
+		return nil
+	}))
+
+	heat, err := db.Heatmap(4)
+	require.NoError(t, err)
+	require.Equal(t, []PrefixHeat{
+		{Prefix: []byte("hot/"), Reads: 5, Writes: 10},
+		{Prefix: []byte("cold"), Writes: 1},
+		{Prefix: []byte("hot"), Reads: 1},
+	}, heat)
+	require.NoError(t, db.Close())
+
+	// The counts are kept across restarts, and summed up by shorter prefixes.
+	db, err = Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	heat, err = db.Heatmap(1)
+	require.NoError(t, err)
+	require.Equal(t, []PrefixHeat{
+		{Prefix: []byte("h"), Reads: 6, Writes: 10},
+		{Prefix: []byte("c"), Writes: 1},
+	}, heat)
+	_, err = db.Heatmap(0)
+	require.Error(t, err)
+}
@@ -0,0 +1,131 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/luxfi/zapdb/y"
+)
+
+// HotBackupFiles writes a physical backup of the DB into dest, which must not exist, and returns
+// the version it is as of. Unlike Checkpoint, it doesn't flush the memtables: the writes wait
+// while the tables, the value log files and the WALs are hard linked into dest, and the version
+// of the last write is recorded. Only the tails of the WAL and of the value log file being written
+// are copied afterwards, up to their lengths then. It takes seconds for large DBs, where
+// streaming their keys with Backup takes long.
+//
+// The backup can be opened like any other DB, with the same options, and replays the WALs up to
+// the version. The tables in Options.RemoteTableStore are downloaded while the writes wait. The
+// directories of the backup are both dest, even if the DB has a separate ValueDir.
+func (db *DB) HotBackupFiles(dest string) (version uint64, err error) {
+	if db.opt.InMemory {
+		return 0, ErrCheckpointInMemoryMode
+	}
+	if db.opt.ReadOnly {
+		return 0, errors.New("Cannot back up a DB opened in ReadOnly mode")
+	}
+	if db.IsClosed() {
+		return 0, ErrDBClosed
+	}
+	if _, err := os.Stat(dest); err == nil {
+		return 0, fmt.Errorf("Backup directory %q already exists", dest)
+	} else if !os.IsNotExist(err) {
+		return 0, y.Wrapf(err, "while checking backup directory %q", dest)
+	}
+	if err := os.MkdirAll(dest, 0700); err != nil {
+		return 0, y.Wrapf(err, "while creating backup directory %q", dest)
+	}
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(dest)
+		}
+	}()
+
+	var (
+		manifest Manifest
+		// The WAL and the value log file being written are linked under temporary names, and
+		// copied up to their lengths at the fence.
+		wal      string
+		walLen   uint32
+		vlog     string
+		vlogLen  uint32
+		fenceErr error
+	)
+	fence := func() {
+		version = db.MaxVersion()
+		// The lock keeps the memtables flushed meanwhile, and their WALs, until their tables
+		// are in the manifest linked.
+		db.lock.RLock()
+		defer db.lock.RUnlock()
+		for _, mt := range db.imm {
+			dst := filepath.Join(dest, filepath.Base(mt.wal.path))
+			if err := linkOrCopy(mt.wal.path, dst); err != nil {
+				fenceErr = y.Wrapf(err, "while linking WAL %d", mt.wal.fid)
+				return
+			}
+		}
+		wal = filepath.Join(dest, filepath.Base(db.mt.wal.path)) + ".tmp"
+		walLen = db.mt.wal.writeAt
+		if err := linkOrCopy(db.mt.wal.path, wal); err != nil {
+			fenceErr = y.Wrapf(err, "while linking WAL %d", db.mt.wal.fid)
+			return
+		}
+		if manifest, fenceErr = db.linkTables(dest); fenceErr != nil {
+			return
+		}
+		db.vlog.filesLock.RLock()
+		vlog, vlogLen, fenceErr = db.linkValueLogFiles(dest)
+		db.vlog.filesLock.RUnlock()
+	}
+	if err := db.fenceWrites(fence); err != nil {
+		return 0, err
+	}
+	if fenceErr != nil {
+		return 0, fenceErr
+	}
+
+	if err := copyActiveValueLogFile(wal, walLen); err != nil {
+		return 0, err
+	}
+	if vlog != "" {
+		if err := copyActiveValueLogFile(vlog, vlogLen); err != nil {
+			return 0, err
+		}
+	}
+	fp, _, err := helpRewrite(dest, &manifest, db.opt.ExternalMagicVersion)
+	if err != nil {
+		return 0, y.Wrapf(err, "while writing backup manifest")
+	}
+	if err := fp.Close(); err != nil {
+		return 0, err
+	}
+	registry := filepath.Join(db.opt.Dir, KeyRegistryFileName)
+	if _, err := os.Stat(registry); err == nil {
+		if err := copyFile(registry, filepath.Join(dest, KeyRegistryFileName), -1); err != nil {
+			return 0, y.Wrapf(err, "while copying key registry")
+		}
+	}
+	return version, syncDir(dest)
+}
+
+// fenceWrites has the writer call fence once the writes before are written, while those after
+// wait.
+func (db *DB) fenceWrites(fence func()) error {
+	req := requestPool.Get().(*request)
+	req.reset()
+	req.fence = fence
+	req.Wg.Add(1)
+	req.IncrRef()
+	db.writeCh <- req
+	req.Wg.Wait()
+	err := req.Err
+	req.DecrRef()
+	return err
+}
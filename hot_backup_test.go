@@ -0,0 +1,91 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHotBackupFiles(t *testing.T) {
+	dir := t.TempDir()
+	// Large values go to the value log, and the memtables are flushed as they're written.
+	opt := getTestOptions(dir).WithValueThreshold(64).WithValueLogFileSize(1 << 20).
+		WithMemTableSize(1 << 20)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	val := func(i int) []byte {
+		if i%2 == 0 {
+			return []byte(fmt.Sprintf("small%d", i))
+		}
+		return bytes.Repeat([]byte(fmt.Sprintf("%08d", i)), 32)
+	}
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key%08d", i)) }
+	for i := 0; i < 5000; i++ {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Set(key(i), val(i))
+		}))
+	}
+
+	// Keys are written in order while the backup is taken: it holds a prefix of them, up to its
+	// version.
+	var written atomic.Int64
+	written.Store(5000)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 5000; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			require.NoError(t, db.Update(func(txn *Txn) error {
+				return txn.Set(key(i), val(i))
+			}))
+			written.Add(1)
+		}
+	}()
+	for written.Load() < 6000 {
+	}
+	backupDir := filepath.Join(dir, "backup")
+	before := int(written.Load())
+	version, err := db.HotBackupFiles(backupDir)
+	require.NoError(t, err)
+	close(stop)
+	wg.Wait()
+	_, err = db.HotBackupFiles(backupDir)
+	require.Error(t, err)
+
+	backup, err := Open(getTestOptions(backupDir))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, backup.Close()) }()
+	require.Equal(t, version, backup.MaxVersion())
+	var n int
+	require.NoError(t, backup.View(func(txn *Txn) error {
+		it := txn.NewIterator(DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			require.Equal(t, key(n), it.Item().Key())
+			require.Equal(t, val(n), getItemValue(t, it.Item()))
+			require.LessOrEqual(t, it.Item().Version(), version)
+			n++
+		}
+		return nil
+	}))
+	require.GreaterOrEqual(t, n, before)
+	require.Less(t, n, int(written.Load()))
+}
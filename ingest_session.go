@@ -0,0 +1,147 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"sync"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+)
+
+// IngestOptions are the options of an IngestSession.
+type IngestOptions struct {
+	// Incremental writes the keys on top of those of the DB, like
+	// StreamWriter.PrepareIncremental, rather than replacing them.
+	Incremental bool
+	// BytesPerSec throttles the chunks uploaded to that rate on average, so that a bulk load
+	// doesn't saturate the network or the disks of the DB. Zero doesn't throttle them.
+	BytesPerSec int64
+}
+
+// IngestSession is a resumable bulk load of a DB with a StreamWriter, for the loads sent over a
+// network. The load is uploaded in chunks, each at its offset in the load, and the session
+// keeps the offset it is at: a client restarting after a network failure, or a crash, resumes
+// the load from Offset instead of from the start, and the chunks sent again are skipped.
+//
+// The session lives in the DB until it is committed or aborted: a server exposes it to its
+// clients by ID, and the clients find it again with BeginIngest.
+type IngestSession struct {
+	id      string
+	db      *DB
+	sw      *StreamWriter
+	limiter *rateLimiter
+
+	mu     sync.Mutex
+	offset int64
+	// err is the error the session failed with, if any, or ErrIngestDone once it's done.
+	err error
+}
+
+// BeginIngest starts the ingest session id, or returns it if it's running already, with the
+// offset it's at, in which case opt is ignored. There can be one session at most in a DB, and
+// unless opt.Incremental is set, starting it drops all the data of the DB, like
+// StreamWriter.Prepare. It returns ErrIngestInProgress if another session is running.
+func (db *DB) BeginIngest(id string, opt IngestOptions) (*IngestSession, error) {
+	db.ingestLock.Lock()
+	defer db.ingestLock.Unlock()
+	if s := db.ingest; s != nil {
+		if s.id != id {
+			return nil, ErrIngestInProgress
+		}
+		return s, nil
+	}
+
+	sw := db.NewStreamWriter()
+	prepare := sw.Prepare
+	if opt.Incremental {
+		prepare = sw.PrepareIncremental
+	}
+	if err := prepare(); err != nil {
+		sw.Cancel()
+		return nil, err
+	}
+	s := &IngestSession{id: id, db: db, sw: sw}
+	if opt.BytesPerSec > 0 {
+		s.limiter = &rateLimiter{bytesPerSec: float64(opt.BytesPerSec)}
+	}
+	db.ingest = s
+	return s, nil
+}
+
+// ID returns the ID of the session.
+func (s *IngestSession) ID() string {
+	return s.id
+}
+
+// Offset returns the offset in the load up to which the chunks are uploaded, where the next
+// chunk goes.
+func (s *IngestSession) Offset() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offset
+}
+
+// Upload writes chunk, at offset in the load, and returns the offset of the next chunk. A chunk
+// is a buffer of KVs, like those written by StreamWriter.Write, as built by KVToBuffer, and the
+// offset of a chunk is the total size of the chunks before it. A chunk uploaded already is
+// skipped. It returns ErrIngestOffset, with the offset of the session, if the chunk is past it,
+// or overlaps it.
+func (s *IngestSession) Upload(offset int64, chunk []byte) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.err != nil:
+		return s.offset, s.err
+	case offset+int64(len(chunk)) <= s.offset:
+		return s.offset, nil
+	case offset != s.offset:
+		return s.offset, ErrIngestOffset
+	}
+
+	s.limiter.Wait(int64(len(chunk)))
+	if err := s.sw.Write(z.NewBufferSlice(chunk)); err != nil {
+		// The writes of the chunk can't be told apart from the others anymore.
+		s.err = err
+		return s.offset, err
+	}
+	s.offset += int64(len(chunk))
+	return s.offset, nil
+}
+
+// Commit writes the last tables of the load, and ends the session.
+func (s *IngestSession) Commit() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.err = ErrIngestDone
+	defer s.end()
+	return s.sw.Flush()
+}
+
+// Abort ends the session without writing the last tables of the load. Like with
+// StreamWriter.Cancel, some of the keys uploaded may be left in the DB, until another load
+// replaces them.
+func (s *IngestSession) Abort() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == ErrIngestDone {
+		return
+	}
+	s.err = ErrIngestDone
+	s.sw.Cancel()
+	s.end()
+}
+
+// end removes the session from the DB.
+func (s *IngestSession) end() {
+	s.db.ingestLock.Lock()
+	defer s.db.ingestLock.Unlock()
+	if s.db.ingest == s {
+		s.db.ingest = nil
+	}
+}
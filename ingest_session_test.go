@@ -0,0 +1,80 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/pb"
+)
+
+func TestIngestSession(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		key := func(i int) []byte { return fmt.Appendf(nil, "key%04d", i) }
+		var chunks [][]byte
+		for c := range 3 {
+			buf := z.NewBuffer(1<<20, "test")
+			defer func() { require.NoError(t, buf.Release()) }()
+			for i := c * 100; i < (c+1)*100; i++ {
+				KVToBuffer(&pb.KV{Key: key(i), Value: key(i), Version: 1}, buf)
+			}
+			chunks = append(chunks, buf.Bytes())
+		}
+		size := int64(len(chunks[0]))
+
+		start := time.Now()
+		s, err := db.BeginIngest("load", IngestOptions{BytesPerSec: 10 * size})
+		require.NoError(t, err)
+		off, err := s.Upload(0, chunks[0])
+		require.NoError(t, err)
+		require.Equal(t, size, off)
+
+		// The client restarts, and resumes the session from its offset.
+		s, err = db.BeginIngest("load", IngestOptions{})
+		require.NoError(t, err)
+		require.Equal(t, size, s.Offset())
+		_, err = db.BeginIngest("other", IngestOptions{})
+		require.ErrorIs(t, err, ErrIngestInProgress)
+
+		// The chunks uploaded again are skipped, and the chunks must follow each other.
+		off, err = s.Upload(0, chunks[0])
+		require.NoError(t, err)
+		require.Equal(t, size, off)
+		off, err = s.Upload(off+1, chunks[1])
+		require.ErrorIs(t, err, ErrIngestOffset)
+		require.Equal(t, size, off)
+		for _, chunk := range chunks[1:] {
+			off, err = s.Upload(off, chunk)
+			require.NoError(t, err)
+		}
+		require.Equal(t, s.Offset(), off)
+		// The uploads are throttled to 10 chunks per second.
+		require.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+
+		require.NoError(t, s.Commit())
+		_, err = s.Upload(off, chunks[0])
+		require.ErrorIs(t, err, ErrIngestDone)
+		require.NoError(t, db.View(func(txn *Txn) error {
+			for i := range 300 {
+				item, err := txn.Get(key(i))
+				require.NoError(t, err)
+				require.Equal(t, key(i), getItemValue(t, item))
+			}
+			return nil
+		}))
+
+		// Another session can start once the first one is done.
+		s, err = db.BeginIngest("other", IngestOptions{Incremental: true})
+		require.NoError(t, err)
+		s.Abort()
+		require.Nil(t, db.ingest)
+	})
+}
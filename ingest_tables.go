@@ -0,0 +1,347 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+
+	"github.com/luxfi/zapdb/options"
+	"github.com/luxfi/zapdb/pb"
+	"github.com/luxfi/zapdb/table"
+	"github.com/luxfi/zapdb/y"
+)
+
+// ingestAttempts is the number of times ingestFenced flushes the memtables holding keys in
+// the range of the tables, written while it ingests them, before giving up.
+const ingestAttempts = 3
+
+// externalTable is a table file ingested by IngestExternalFiles, or built by DB.MovePrefix.
+type externalTable struct {
+	path string
+	t    *table.Table
+	// minVersion is the oldest version of the keys of the table.
+	minVersion uint64
+}
+
+// keyRange returns the range of the keys of the table, with all their versions.
+func (et *externalTable) keyRange() keyRange {
+	return keyRange{
+		left:  y.KeyWithTs(y.ParseKey(et.t.Smallest()), math.MaxUint64),
+		right: y.KeyWithTs(y.ParseKey(et.t.Biggest()), 0),
+	}
+}
+
+// IngestExternalFiles moves the table files at paths, built by a TableBuilder or written by
+// ExportTables, into the LSM tree of the DB, each at the lowest level which doesn't overlap it,
+// nor the levels above it. Their keys are loaded without going through the memtables and the
+// compactions of the levels above, for a fast initial sync from a snapshot. The files are hard
+// linked into the directory of the DB, or copied if it's on another file system, and removed once
+// ingested.
+//
+// The tables keep the versions of their keys, which must be newer than those of the keys of the
+// DB they overlap, e.g. above DB.MaxVersion: IngestExternalFiles fails otherwise. Unless the DB
+// is managed, the transactions started afterwards read at the newest of their versions, at
+// least. The memtables holding keys in the range of a table are flushed first.
+//
+// The tables must not overlap each other, and must hold their values: the tables copied from the
+// directory of another DB, which point into its value log, are rejected. Their blocks must be
+// compressed with the Options.Compression of the DB, unless they are listed in a TableExportFile
+// next to them, which tells their compression. They can't be ingested into an encrypted DB, as
+// they aren't encrypted.
+func (db *DB) IngestExternalFiles(paths []string) (err error) {
+	switch {
+	case db.opt.ReadOnly:
+		return ErrReadOnlyDB
+	case db.opt.InMemory:
+		return errors.New("Cannot ingest table files into a DB in InMemory mode")
+	case len(db.opt.EncryptionKey) > 0 || db.opt.KeyProvider != nil:
+		return errors.New("Cannot ingest unencrypted table files into an encrypted DB")
+	case db.IsClosed():
+		return ErrDBClosed
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	tables, err := db.openExternalTables(paths)
+	if err != nil {
+		return err
+	}
+	// The tables are deleted if they aren't ingested, and released by the levels otherwise.
+	defer func() {
+		for _, et := range tables {
+			if derr := et.t.DecrRef(); derr != nil && err == nil {
+				err = derr
+			}
+		}
+	}()
+
+	var maxVersion uint64
+	for _, et := range tables {
+		maxVersion = max(maxVersion, et.t.MaxVersion())
+	}
+	err = db.ingestFenced(tables, func() error {
+		if err := db.lc.ingestTables(tables); err != nil || db.opt.managedTxns {
+			return err
+		}
+		db.orc.Lock()
+		if maxVersion >= db.orc.nextTxnTs {
+			db.orc.txnMark.Done(maxVersion)
+			db.orc.nextTxnTs = maxVersion + 1
+		}
+		db.orc.Unlock()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, et := range tables {
+		if err := os.Remove(et.path); err != nil {
+			db.opt.Warningf("While removing ingested table file %s: %v", et.path, err)
+		}
+	}
+	return nil
+}
+
+// errIngestRetry has ingestFenced flush the memtables written to meanwhile, and try again.
+var errIngestRetry = errors.New("Memtables overlap the tables ingested")
+
+// ingestFenced has the writer call fenced, which adds tables to the levels, once the memtables holding
+// keys in their range are flushed. The compactions are stopped, and the writes wait, while the
+// levels are picked and the tables added to them.
+func (db *DB) ingestFenced(tables []*externalTable, fenced func() error) error {
+	for attempt := 1; ; attempt++ {
+		if db.memTablesOverlap(tables) {
+			if err := db.flushMemTableForCheckpoint(); err != nil {
+				return y.Wrapf(err, "while flushing memtables")
+			}
+		}
+		var ingestErr error
+		db.stopCompactions()
+		err := db.fenceWrites(func() {
+			if db.memTablesOverlap(tables) {
+				ingestErr = errIngestRetry
+				return
+			}
+			ingestErr = fenced()
+		})
+		db.startCompactions()
+		if err == nil {
+			err = ingestErr
+		}
+		if err != errIngestRetry {
+			return err
+		}
+		if attempt == ingestAttempts {
+			return errors.New("Keys were written to the range of the tables while they were ingested")
+		}
+	}
+}
+
+// openExternalTables links the table files at paths into the directory of the DB, under new IDs,
+// and opens them, in the order of their keys. It checks that the keys of each are in order, and
+// that the tables don't overlap.
+func (db *DB) openExternalTables(paths []string) (tables []*externalTable, err error) {
+	defer func() {
+		if err != nil {
+			for _, et := range tables {
+				_ = et.t.DecrRef()
+			}
+			tables = nil
+		}
+	}()
+	exports := make(map[string]*TableExport)
+	for _, path := range paths {
+		compression, err := db.externalTableCompression(path, exports)
+		if err != nil {
+			return nil, err
+		}
+		fname := table.NewFilename(db.lc.reserveFileID(), db.opt.Dir)
+		if err := linkOrCopy(path, fname); err != nil {
+			return nil, y.Wrapf(err, "while linking table file %s", path)
+		}
+		t, err := db.openExternalTable(fname, compression)
+		if err != nil {
+			_ = os.Remove(fname)
+			return nil, y.Wrapf(err, "while opening table file %s", path)
+		}
+		et := &externalTable{path: path, t: t}
+		tables = append(tables, et)
+		if et.minVersion, err = checkExternalTable(t); err != nil {
+			return nil, y.Wrapf(err, "in table file %s", path)
+		}
+	}
+	if err := db.syncDir(db.opt.Dir); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(tables, func(a, b *externalTable) int {
+		return y.CompareKeys(a.t.Smallest(), b.t.Smallest())
+	})
+	for i := 1; i < len(tables); i++ {
+		if tables[i-1].keyRange().overlapsWith(tables[i].keyRange()) {
+			return nil, fmt.Errorf("Table files %s and %s overlap", tables[i-1].path,
+				tables[i].path)
+		}
+	}
+	return tables, nil
+}
+
+// externalTableCompression returns the compression of the table file at path: that recorded in
+// the TableExportFile of its directory, if it lists it, or that of the DB. exports caches the
+// exports read, by directory.
+func (db *DB) externalTableCompression(path string,
+	exports map[string]*TableExport) (options.CompressionType, error) {
+	dir := filepath.Dir(path)
+	exp, ok := exports[dir]
+	if !ok {
+		if _, err := os.Stat(filepath.Join(dir, TableExportFile)); err == nil {
+			if exp, err = ReadTableExport(dir); err != nil {
+				return 0, err
+			}
+		}
+		exports[dir] = exp
+	}
+	if exp != nil {
+		for _, et := range exp.Tables {
+			if et.File == filepath.Base(path) {
+				return exp.Compression, nil
+			}
+		}
+	}
+	return db.opt.Compression, nil
+}
+
+// openExternalTable opens the table file fname, unencrypted and compressed with compression.
+func (db *DB) openExternalTable(fname string, compression options.CompressionType) (
+	*table.Table, error) {
+	topt := buildTableOptions(db)
+	topt.Compression = compression
+	topt.DataKey = nil
+	mf, err := z.OpenMmapFile(fname, db.opt.getFileFlags(), 0)
+	if err != nil {
+		return nil, err
+	}
+	t, err := table.OpenTable(mf, topt)
+	if err != nil {
+		_ = mf.Close(-1)
+		return nil, err
+	}
+	return t, nil
+}
+
+// checkExternalTable checks that the keys of t are in order, with their values in the table, and
+// returns their oldest version. A value pointer would point into the value log of another DB.
+func checkExternalTable(t *table.Table) (uint64, error) {
+	it := t.NewIterator(0)
+	minVersion := uint64(math.MaxUint64)
+	var last []byte
+	for it.Rewind(); it.Valid(); it.Next() {
+		key := it.Key()
+		if last != nil && y.CompareKeys(last, key) >= 0 {
+			_ = it.Close()
+			return 0, fmt.Errorf("Key %q at version %d is out of order", y.ParseKey(key),
+				y.ParseTs(key))
+		}
+		if it.Value().Meta&bitValuePointer > 0 {
+			_ = it.Close()
+			return 0, fmt.Errorf("Key %q at version %d has its value in a value log",
+				y.ParseKey(key), y.ParseTs(key))
+		}
+		last = y.SafeCopy(last, key)
+		minVersion = min(minVersion, y.ParseTs(key))
+	}
+	return minVersion, it.Close()
+}
+
+// memTablesOverlap returns whether the memtables hold keys in the range of one of tables.
+func (db *DB) memTablesOverlap(tables []*externalTable) bool {
+	mts, decr := db.getMemTables()
+	defer decr()
+	for _, mt := range mts {
+		it := mt.sl.NewIterator()
+		for _, et := range tables {
+			kr := et.keyRange()
+			it.Seek(kr.left)
+			if it.Valid() && y.CompareKeys(it.Key(), kr.right) <= 0 {
+				_ = it.Close()
+				return true
+			}
+		}
+		_ = it.Close()
+	}
+	return false
+}
+
+// ingestTables adds tables to the levels, each to the lowest level which doesn't overlap it, nor
+// the levels above it, or to level 0 if it overlaps level 0. The keys of the tables it overlaps
+// below must be older than its own. The compactions must be stopped.
+func (s *levelsController) ingestTables(tables []*externalTable) error {
+	targets := make([]int, len(tables))
+	for i, et := range tables {
+		kr := et.keyRange()
+		target := len(s.levels) - 1
+		var below []*table.Table
+		for _, l := range s.levels {
+			l.RLock()
+			var overlap []*table.Table
+			if l.level == 0 {
+				for _, t := range l.tables {
+					if kr.overlapsWith(keyRange{left: t.Smallest(), right: t.Biggest()}) {
+						overlap = append(overlap, t)
+					}
+				}
+			} else {
+				lo, hi := l.overlappingTables(levelHandlerRLocked{}, kr)
+				overlap = l.tables[lo:hi]
+			}
+			if len(overlap) > 0 && len(below) == 0 {
+				target = max(l.level-1, 0)
+			}
+			below = append(below, overlap...)
+			l.RUnlock()
+		}
+		for _, t := range below {
+			if t.MaxVersion() >= et.minVersion {
+				return fmt.Errorf("Table file %s overlaps keys of the DB at versions up to %d, "+
+					"not older than its own from %d", et.path, t.MaxVersion(), et.minVersion)
+			}
+		}
+		targets[i] = target
+	}
+
+	changes := make([]*pb.ManifestChange, 0, len(tables))
+	for i, et := range tables {
+		changes = append(changes, newCreateChange(et.t.ID(), targets[i], et.t.KeyID(),
+			et.t.CompressionType(), et.t.EncryptionAlgo()))
+	}
+	// The manifest is updated before the tables are in the levels, like for the flushes.
+	if err := s.kv.manifest.addChanges(changes, s.kv.opt); err != nil {
+		return err
+	}
+	for i, et := range tables {
+		// The table holds no version below minVersion for a range tombstone to delete.
+		s.kv.rangeDels.setCleanTs(et.t.ID(), et.minVersion)
+		s.levels[targets[i]].addTable(et.t)
+		s.kv.opt.Infof("Table file %s ingested as table %d at level %d", et.path, et.t.ID(),
+			targets[i])
+	}
+	for _, target := range slices.Compact(slices.Sorted(slices.Values(targets))) {
+		// Level 0 is in the order of the flushes, the ingested tables being the newest.
+		if target > 0 {
+			s.levels[target].sortTables()
+		}
+	}
+	return nil
+}
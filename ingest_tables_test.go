@@ -0,0 +1,154 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/options"
+	"github.com/luxfi/zapdb/table"
+	"github.com/luxfi/zapdb/y"
+)
+
+func TestIngestExternalFiles(t *testing.T) {
+	key := func(prefix string, i int) []byte { return fmt.Appendf(nil, "%s%03d", prefix, i) }
+	get := func(t *testing.T, db *DB, k []byte) string {
+		var val []byte
+		require.NoError(t, db.View(func(txn *Txn) error {
+			item, err := txn.Get(k)
+			if err != nil {
+				return err
+			}
+			val, err = item.ValueCopy(nil)
+			return err
+		}))
+		return string(val)
+	}
+	build := func(t *testing.T, opt Options, path, prefix string, from, to int, version uint64) {
+		b := NewTableBuilder(opt)
+		for i := from; i < to; i++ {
+			require.NoError(t, b.Add(&Entry{Key: key(prefix, i), Value: []byte("ext")}, version))
+		}
+		require.NoError(t, b.Finish(path))
+	}
+	tableLevel := func(db *DB, k []byte) int {
+		for _, ti := range db.Tables() {
+			if string(k) >= string(y.ParseKey(ti.Left)) && string(k) <= string(y.ParseKey(ti.Right)) {
+				return ti.Level
+			}
+		}
+		return -1
+	}
+
+	dir := t.TempDir()
+	opt := getTestOptions(dir)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Set(key("key", i), []byte("db"))
+		}))
+	}
+
+	ext := t.TempDir()
+	a := filepath.Join(ext, "a.sst")
+	b := filepath.Join(ext, "b.sst")
+	version := db.MaxVersion() + 1
+	build(t, opt, a, "ext", 0, 100, version)
+	// b overwrites keys of the memtable, which is flushed first.
+	build(t, opt, b, "key", 50, 60, version)
+
+	b2 := NewTableBuilder(opt)
+	require.NoError(t, b2.Add(&Entry{Key: []byte("b")}, 2))
+	require.Error(t, b2.Add(&Entry{Key: []byte("a")}, 2))
+	require.Error(t, b2.Add(&Entry{Key: []byte("b")}, 3))
+	require.Error(t, b2.Add(&Entry{Key: []byte("c")}, 0))
+	b2.Close()
+
+	require.NoError(t, db.IngestExternalFiles([]string{b, a}))
+	for _, path := range []string{a, b} {
+		_, err := os.Stat(path)
+		require.True(t, os.IsNotExist(err))
+	}
+	require.Equal(t, len(db.Levels())-1, tableLevel(db, key("ext", 0)))
+	require.Equal(t, 0, tableLevel(db, key("key", 55)))
+	require.GreaterOrEqual(t, db.MaxVersion(), version)
+
+	check := func(db *DB) {
+		for i := 0; i < 100; i++ {
+			require.Equal(t, "ext", get(t, db, key("ext", i)))
+			want := "db"
+			if i >= 50 && i < 60 {
+				want = "ext"
+			}
+			require.Equal(t, want, get(t, db, key("key", i)))
+		}
+	}
+	check(db)
+	// The transactions read the keys ingested, and write above them.
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.Set(key("ext", 0), []byte("new"))
+	}))
+	require.Equal(t, "new", get(t, db, key("ext", 0)))
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.Set(key("ext", 0), []byte("ext"))
+	}))
+
+	// The keys of a table must be newer than those of the DB it overlaps.
+	c := filepath.Join(ext, "c.sst")
+	build(t, opt, c, "key", 0, 10, 1)
+	require.Error(t, db.IngestExternalFiles([]string{c}))
+	_, err = os.Stat(c)
+	require.NoError(t, err)
+
+	// The tables must not overlap each other.
+	d := filepath.Join(ext, "d.sst")
+	e := filepath.Join(ext, "e.sst")
+	build(t, opt, d, "new", 0, 10, db.MaxVersion()+1)
+	build(t, opt, e, "new", 5, 15, db.MaxVersion()+1)
+	require.Error(t, db.IngestExternalFiles([]string{d, e}))
+
+	// The values of the tables must be in the tables, not in a value log.
+	f := filepath.Join(ext, "f.sst")
+	tb := table.NewTableBuilder(buildTableOptions(db))
+	vp := valuePointer{Fid: 1, Len: 10, Offset: 20}
+	tb.Add(y.KeyWithTs([]byte("vptr"), db.MaxVersion()+1),
+		y.ValueStruct{Value: vp.Encode(), Meta: bitValuePointer}, 0)
+	_, err = writeTableFile(f, tb)
+	tb.Close()
+	require.NoError(t, err)
+	require.ErrorContains(t, db.IngestExternalFiles([]string{f}), "value log")
+
+	require.NoError(t, db.Close())
+	db, err = Open(opt)
+	require.NoError(t, err)
+	check(db)
+
+	// The tables of an export are read with the compression it records.
+	exp := filepath.Join(t.TempDir(), "export")
+	_, err = db.ExportTables(exp, key("ext", 0), nil)
+	require.NoError(t, err)
+	read, err := ReadTableExport(exp)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	db, err = Open(getTestOptions(t.TempDir()).WithCompression(options.ZSTD))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	var paths []string
+	for _, et := range read.Tables {
+		paths = append(paths, filepath.Join(exp, et.File))
+	}
+	require.NoError(t, db.IngestExternalFiles(paths))
+	for i := 0; i < 100; i++ {
+		require.Equal(t, "ext", get(t, db, key("ext", i)))
+	}
+}
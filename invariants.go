@@ -0,0 +1,124 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/luxfi/zapdb/y"
+)
+
+// Checks of Options.StrictInvariantChecks, as named by InvariantError.Check.
+const (
+	// InvariantKeyOrder is violated by an iterator returning keys out of order.
+	InvariantKeyOrder = "key order"
+	// InvariantVersionOrder is violated by versions of a key out of order, or read above the
+	// read timestamp of their transaction.
+	InvariantVersionOrder = "version order"
+	// InvariantValuePointer is violated by a value pointer which doesn't point to an entry of the
+	// value log.
+	InvariantValuePointer = "value pointer"
+)
+
+// InvariantError is returned when a check of Options.StrictInvariantChecks fails. It matches
+// ErrInvariantViolated with errors.Is.
+type InvariantError struct {
+	// Check is the invariant violated, one of the Invariant constants.
+	Check string
+	// Key is the key, with its version, the invariant was violated at, if known.
+	Key []byte
+	// Detail describes the violation.
+	Detail string
+}
+
+func (e *InvariantError) Error() string {
+	if len(e.Key) < 8 {
+		return fmt.Sprintf("%s: %s: %s", ErrInvariantViolated, e.Check, e.Detail)
+	}
+	return fmt.Sprintf("%s: %s at key %q version %d: %s", ErrInvariantViolated, e.Check,
+		y.ParseKey(e.Key), y.ParseTs(e.Key), e.Detail)
+}
+
+// Is makes errors.Is(err, ErrInvariantViolated) true for an InvariantError.
+func (e *InvariantError) Is(target error) bool {
+	return target == ErrInvariantViolated
+}
+
+// checkedIterator wraps the merge iterator of an Iterator, to check the order of the keys it
+// returns. It stops at the first key out of order, as if the iteration was done.
+type checkedIterator struct {
+	y.Iterator
+	reversed bool
+	last     []byte
+	err      *InvariantError
+}
+
+func (it *checkedIterator) Rewind() {
+	it.Iterator.Rewind()
+	it.reset()
+}
+
+func (it *checkedIterator) Seek(key []byte) {
+	it.Iterator.Seek(key)
+	it.reset()
+}
+
+func (it *checkedIterator) reset() {
+	it.last, it.err = it.last[:0], nil
+	if it.Iterator.Valid() {
+		it.last = append(it.last, it.Iterator.Key()...)
+	}
+}
+
+func (it *checkedIterator) Next() {
+	it.Iterator.Next()
+	if !it.Iterator.Valid() {
+		return
+	}
+	key := it.Iterator.Key()
+	cmp := y.CompareKeys(it.last, key)
+	if it.reversed {
+		cmp = -cmp
+	}
+	if cmp >= 0 {
+		check := InvariantKeyOrder
+		if bytes.Equal(y.ParseKey(it.last), y.ParseKey(key)) {
+			check = InvariantVersionOrder
+		}
+		it.err = &InvariantError{Check: check, Key: y.Copy(key),
+			Detail: fmt.Sprintf("returned after version %d of key %q", y.ParseTs(it.last),
+				y.ParseKey(it.last))}
+		return
+	}
+	it.last = append(it.last[:0], key...)
+}
+
+func (it *checkedIterator) Valid() bool {
+	return it.err == nil && it.Iterator.Valid()
+}
+
+// checkVersion returns an InvariantError if a read at readTs returned version of key.
+func checkVersion(key []byte, version, readTs uint64) error {
+	if version <= readTs {
+		return nil
+	}
+	return &InvariantError{Check: InvariantVersionOrder, Key: y.KeyWithTs(key, version),
+		Detail: fmt.Sprintf("read at timestamp %d", readTs)}
+}
+
+// checkValuePointer returns an InvariantError unless buf, read from vp, is a single entry of the
+// value log file lf, of header h, at hlen bytes.
+func checkValuePointer(lf *logFile, vp valuePointer, buf []byte, h header, hlen int) error {
+	want := hlen + int(h.klen) + int(h.vlen) + lf.sealOverhead() + crc32.Size
+	if want == len(buf) {
+		return nil
+	}
+	return &InvariantError{Check: InvariantValuePointer,
+		Detail: fmt.Sprintf("%+v points to %d bytes, the entry there takes %d", vp, len(buf),
+			want)}
+}
@@ -0,0 +1,128 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/y"
+)
+
+// sliceIterator iterates over keys, in the order given.
+type sliceIterator struct {
+	keys [][]byte
+	i    int
+}
+
+func (s *sliceIterator) Next()                { s.i++ }
+func (s *sliceIterator) Rewind()              { s.i = 0 }
+func (s *sliceIterator) Seek(key []byte)      { s.i = 0 }
+func (s *sliceIterator) Key() []byte          { return s.keys[s.i] }
+func (s *sliceIterator) Value() y.ValueStruct { return y.ValueStruct{} }
+func (s *sliceIterator) Valid() bool          { return s.i < len(s.keys) }
+func (s *sliceIterator) Close() error         { return nil }
+
+func TestCheckedIterator(t *testing.T) {
+	k := y.KeyWithTs
+	tests := []struct {
+		keys     [][]byte
+		reversed bool
+		n        int
+		check    string
+	}{
+		{keys: [][]byte{k([]byte("a"), 2), k([]byte("a"), 1), k([]byte("b"), 3)}, n: 3},
+		{keys: [][]byte{k([]byte("b"), 1), k([]byte("a"), 1), k([]byte("c"), 1)}, n: 1,
+			check: InvariantKeyOrder},
+		{keys: [][]byte{k([]byte("a"), 1), k([]byte("a"), 2)}, n: 1, check: InvariantVersionOrder},
+		{keys: [][]byte{k([]byte("a"), 1), k([]byte("a"), 1)}, n: 1, check: InvariantVersionOrder},
+		{keys: [][]byte{k([]byte("b"), 1), k([]byte("a"), 1), k([]byte("a"), 2)}, reversed: true,
+			n: 3},
+		{keys: [][]byte{k([]byte("a"), 1), k([]byte("b"), 1)}, reversed: true, n: 1,
+			check: InvariantKeyOrder},
+	}
+	for i, tc := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			it := &checkedIterator{Iterator: &sliceIterator{keys: tc.keys}, reversed: tc.reversed}
+			var n int
+			for it.Rewind(); it.Valid(); it.Next() {
+				n++
+			}
+			require.Equal(t, tc.n, n)
+			if tc.check == "" {
+				require.Nil(t, it.err)
+				return
+			}
+			require.ErrorIs(t, it.err, ErrInvariantViolated)
+			require.Equal(t, tc.check, it.err.Check)
+			require.Equal(t, tc.keys[n], it.err.Key)
+			// Rewinding starts over.
+			it.Rewind()
+			require.True(t, it.Valid())
+		})
+	}
+}
+
+func TestStrictInvariantChecks(t *testing.T) {
+	opt := getTestOptions("").WithStrictInvariantChecks(true).WithValueThreshold(32)
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		val := bytes.Repeat([]byte("v"), 64)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, db.Update(func(txn *Txn) error {
+				for j := 0; j < 10; j++ {
+					if err := txn.Set([]byte(fmt.Sprintf("key%d", j)), val); err != nil {
+						return err
+					}
+				}
+				return nil
+			}))
+		}
+		for _, reverse := range []bool{false, true} {
+			require.NoError(t, db.View(func(txn *Txn) error {
+				iopt := DefaultIteratorOptions
+				iopt.AllVersions = true
+				iopt.Reverse = reverse
+				it := txn.NewIterator(iopt)
+				defer it.Close()
+				var n int
+				for it.Rewind(); it.Valid(); it.Next() {
+					v, err := it.Item().ValueCopy(nil)
+					require.NoError(t, err)
+					require.Equal(t, val, v)
+					n++
+				}
+				require.Equal(t, 30, n)
+				return it.Err()
+			}))
+		}
+		require.NoError(t, db.View(func(txn *Txn) error {
+			item, err := txn.Get([]byte("key1"))
+			require.NoError(t, err)
+			_, err = item.ValueCopy(nil)
+			return err
+		}))
+		require.ErrorIs(t, checkVersion([]byte("a"), 5, 4), ErrInvariantViolated)
+
+		// A value pointer one byte too short cuts its entry.
+		e := &Entry{Key: y.KeyWithTs([]byte("ptr"), 1), Value: val, meta: bitValuePointer}
+		b := &request{Entries: []*Entry{e}}
+		require.NoError(t, db.vlog.write([]*request{b}))
+		vp := b.Ptrs[0]
+		_, cb, err := db.vlog.Read(vp, nil)
+		runCallback(cb)
+		require.NoError(t, err)
+		vp.Len--
+		_, cb, err = db.vlog.Read(vp, nil)
+		runCallback(cb)
+		var ie *InvariantError
+		require.True(t, errors.As(err, &ie))
+		require.Equal(t, InvariantValuePointer, ie.Check)
+	})
+}
@@ -0,0 +1,181 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+
+	"github.com/luxfi/zapdb/y"
+)
+
+// IsolationLevel is the isolation of a transaction from the transactions committed while it
+// runs. The conflicts of every level require Options.DetectConflicts.
+type IsolationLevel int
+
+const (
+	// DefaultIsolation is the isolation of NewTransaction: serializable snapshot isolation on the
+	// keys read. The transaction reads a snapshot, and fails with ErrConflict if a transaction
+	// committed since wrote one of the keys it read. The keys added to the ranges it iterated
+	// aren't conflicts.
+	DefaultIsolation IsolationLevel = iota
+	// SerializableSnapshot is DefaultIsolation, where the ranges iterated are conflicts too: the
+	// transaction fails with ErrConflict if a transaction committed since wrote a key in a range
+	// it iterated, so that it doesn't miss the keys added to it, the phantoms. The transactions
+	// committed while one of its kind runs keep the keys they write, to be checked.
+	SerializableSnapshot
+	// SnapshotIsolation doesn't track the keys read. The transaction reads a snapshot, and fails
+	// with ErrConflict only if a transaction committed since wrote one of the keys it writes. Two
+	// transactions each writing a key the other read both commit, the write skew.
+	SnapshotIsolation
+	// ReadCommitted doesn't track the keys read, and never conflicts. Every Get and NewIterator
+	// reads the transactions committed so far, rather than a snapshot. It applies to the
+	// transactions created by NewTransactionWithOptions only, not to those of managed mode.
+	ReadCommitted
+)
+
+// TxnOptions are the options of a transaction, see NewTransactionWithOptions.
+type TxnOptions struct {
+	Isolation IsolationLevel
+}
+
+// NewTransactionWithOptions is like NewTransaction, but creates a transaction with opt, like
+// with an IsolationLevel other than the default:
+//
+//	txn := db.NewTransactionWithOptions(true, badger.TxnOptions{Isolation: badger.SnapshotIsolation})
+//	defer txn.Discard()
+func (db *DB) NewTransactionWithOptions(update bool, opt TxnOptions) *Txn {
+	return db.newTransactionWithOptions(update, false, opt)
+}
+
+// tracksReads returns whether the keys read by txn are conflicts.
+func (txn *Txn) tracksReads() bool {
+	return txn.update && (txn.isolation == DefaultIsolation ||
+		txn.isolation == SerializableSnapshot)
+}
+
+// refreshReadTs moves the read timestamp of a ReadCommitted transaction to the last commit, so
+// that it reads every transaction committed so far.
+func (txn *Txn) refreshReadTs() {
+	o := txn.db.orc
+	if txn.isolation != ReadCommitted || o.isManaged || txn.doneRead {
+		return
+	}
+	// Keep the versions of the new read timestamp before releasing those of the old one.
+	ts := o.readTs()
+	o.readMark.Done(txn.readTs)
+	txn.readTs = ts
+}
+
+// readRange is a range of keys iterated by a SerializableSnapshot transaction, from start to
+// end, excluded, or to the last key if end is nil.
+type readRange struct {
+	start, end []byte
+}
+
+func (r readRange) contains(key []byte) bool {
+	return bytes.Compare(key, r.start) >= 0 && (r.end == nil || bytes.Compare(key, r.end) < 0)
+}
+
+// keyAfter returns the smallest key after key.
+func keyAfter(key []byte) []byte {
+	return append(y.SafeCopy(nil, key), 0)
+}
+
+// writesReadRange returns the first key committed wrote in a range iterated by txn, if any.
+func (txn *Txn) writesReadRange(committed committedTxn) ([]byte, bool) {
+	for _, key := range committed.keys {
+		for _, r := range txn.readRanges {
+			if r.contains([]byte(key)) {
+				return []byte(key), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// writesWritten returns the fingerprint of the first key written by txn committed wrote, if any.
+func (txn *Txn) writesWritten(committed committedTxn) (uint64, bool) {
+	for fp := range txn.conflictKeys {
+		if _, has := committed.conflictKeys[fp]; has {
+			return fp, true
+		}
+	}
+	return 0, false
+}
+
+// rangeBound returns the end of the keys the iterator can reach, nil if it's the last key.
+func (it *Iterator) rangeBound() []byte {
+	if it.opt.prefixIsKey {
+		return keyAfter(it.opt.Prefix)
+	}
+	return prefixEnd(it.opt.Prefix)
+}
+
+// seekRange starts tracking the range of keys read from a seek to key, for a SerializableSnapshot
+// transaction, once the range read since the previous seek is added to the transaction.
+func (it *Iterator) seekRange(key []byte) {
+	if !it.tracksRange {
+		return
+	}
+	it.flushRange()
+	if len(key) == 0 || (!it.opt.Reverse && bytes.Compare(key, it.opt.Prefix) < 0) {
+		key = nil
+	}
+	it.rangeFrom = y.SafeCopy(it.rangeFrom[:0], key)
+	it.rangeOpen, it.rangeReached, it.rangeDone = true, false, false
+}
+
+// extendRange extends the range of keys read to the current key, or to the last key the
+// iterator can reach once it's done.
+func (it *Iterator) extendRange(valid bool) {
+	if !it.rangeOpen || it.rangeDone {
+		return
+	}
+	if valid {
+		it.rangeTo = y.SafeCopy(it.rangeTo[:0], it.item.key)
+		it.rangeReached = true
+	} else {
+		it.rangeDone = true
+	}
+}
+
+// flushRange adds the range of keys read since the last seek to the transaction.
+func (it *Iterator) flushRange() {
+	if !it.rangeOpen {
+		return
+	}
+	it.rangeOpen = false
+	if !it.rangeReached && !it.rangeDone {
+		return
+	}
+	var r readRange
+	if !it.opt.Reverse {
+		r.start = y.SafeCopy(nil, it.rangeFrom)
+		if len(r.start) == 0 {
+			r.start = y.SafeCopy(nil, it.opt.Prefix)
+		}
+		if it.rangeDone {
+			r.end = it.rangeBound()
+		} else {
+			r.end = keyAfter(it.rangeTo)
+		}
+	} else {
+		if len(it.rangeFrom) == 0 {
+			r.end = it.rangeBound()
+		} else {
+			r.end = keyAfter(it.rangeFrom)
+		}
+		if it.rangeDone {
+			r.start = y.SafeCopy(nil, it.opt.Prefix)
+		} else {
+			r.start = y.SafeCopy(nil, it.rangeTo)
+		}
+	}
+	txn := it.txn
+	txn.readsLock.Lock()
+	txn.readRanges = append(txn.readRanges, r)
+	txn.readsLock.Unlock()
+}
@@ -0,0 +1,154 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotIsolation(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			require.NoError(t, txn.Set([]byte("x"), []byte("1")))
+			return txn.Set([]byte("y"), []byte("1"))
+		}))
+		opt := TxnOptions{Isolation: SnapshotIsolation}
+
+		// Each reads the key the other writes, the write skew, and both commit.
+		txn1 := db.NewTransactionWithOptions(true, opt)
+		defer txn1.Discard()
+		txn2 := db.NewTransactionWithOptions(true, opt)
+		defer txn2.Discard()
+		for _, txn := range []*Txn{txn1, txn2} {
+			for _, key := range []string{"x", "y"} {
+				_, err := txn.Get([]byte(key))
+				require.NoError(t, err)
+			}
+		}
+		require.Empty(t, txn1.reads)
+		require.NoError(t, txn1.Set([]byte("x"), []byte("0")))
+		require.NoError(t, txn2.Set([]byte("y"), []byte("0")))
+		require.NoError(t, txn1.Commit())
+		require.NoError(t, txn2.Commit())
+
+		// Both write the same key, and the second fails.
+		txn1 = db.NewTransactionWithOptions(true, opt)
+		defer txn1.Discard()
+		txn2 = db.NewTransactionWithOptions(true, opt)
+		defer txn2.Discard()
+		require.NoError(t, txn1.Set([]byte("x"), []byte("2")))
+		require.NoError(t, txn2.Set([]byte("x"), []byte("3")))
+		require.NoError(t, txn1.Commit())
+		require.ErrorIs(t, txn2.Commit(), ErrConflict)
+	})
+}
+
+func TestSerializableSnapshotRangeConflict(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Set([]byte("q1"), []byte("1"))
+		}))
+		count := func(txn *Txn, reverse bool) int {
+			opt := DefaultIteratorOptions
+			opt.Prefix = []byte("p")
+			opt.Reverse = reverse
+			it := txn.NewIterator(opt)
+			defer it.Close()
+			seek := opt.Prefix
+			if reverse {
+				seek = append(seek, 0xff)
+			}
+			var n int
+			for it.Seek(seek); it.Valid(); it.Next() {
+				n++
+			}
+			return n
+		}
+		insert := func(key string) {
+			require.NoError(t, db.Update(func(txn *Txn) error {
+				return txn.Set([]byte(key), []byte("1"))
+			}))
+		}
+
+		for _, reverse := range []bool{false, true} {
+			// The key added to the range iterated is a conflict.
+			txn := db.NewTransactionWithOptions(true, TxnOptions{Isolation: SerializableSnapshot})
+			require.Zero(t, count(txn, reverse))
+			require.NoError(t, txn.Set([]byte("r"), []byte("1")))
+			insert("p1")
+			require.ErrorIs(t, txn.Commit(), ErrConflict)
+			txn.Discard()
+
+			// Not with DefaultIsolation.
+			txn = db.NewTransaction(true)
+			require.Equal(t, 1, count(txn, reverse))
+			require.NoError(t, txn.Set([]byte("r"), []byte("1")))
+			insert("p2")
+			require.NoError(t, txn.Commit())
+
+			// Nor out of the range.
+			txn = db.NewTransactionWithOptions(true, TxnOptions{Isolation: SerializableSnapshot})
+			require.Equal(t, 2, count(txn, reverse))
+			require.NoError(t, txn.Set([]byte("r"), []byte("1")))
+			insert("q2")
+			require.NoError(t, txn.Commit())
+
+			require.NoError(t, db.DropPrefix([]byte("p")))
+		}
+
+		// A seek only reads from the key sought on.
+		txn := db.NewTransactionWithOptions(true, TxnOptions{Isolation: SerializableSnapshot})
+		defer txn.Discard()
+		it := txn.NewIterator(DefaultIteratorOptions)
+		it.Seek([]byte("q"))
+		require.True(t, it.Valid())
+		require.Equal(t, []byte("q1"), it.Item().Key())
+		it.Close()
+		require.NoError(t, txn.Set([]byte("r"), []byte("1")))
+		insert("p3")
+		require.NoError(t, txn.Commit())
+		require.Zero(t, db.orc.rangeTxns)
+	})
+}
+
+func TestReadCommitted(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		set := func(val string) {
+			require.NoError(t, db.Update(func(txn *Txn) error {
+				return txn.Set([]byte("x"), []byte(val))
+			}))
+		}
+		get := func(txn *Txn) string {
+			item, err := txn.Get([]byte("x"))
+			require.NoError(t, err)
+			return string(getItemValue(t, item))
+		}
+		set("1")
+
+		// Each read sees the transactions committed so far.
+		txn := db.NewTransactionWithOptions(false, TxnOptions{Isolation: ReadCommitted})
+		defer txn.Discard()
+		require.Equal(t, "1", get(txn))
+		set("2")
+		require.Equal(t, "2", get(txn))
+		set("3")
+		it := txn.NewIterator(DefaultIteratorOptions)
+		it.Rewind()
+		require.True(t, it.Valid())
+		require.Equal(t, "3", string(getItemValue(t, it.Item())))
+		it.Close()
+
+		// The keys read aren't conflicts.
+		txn = db.NewTransactionWithOptions(true, TxnOptions{Isolation: ReadCommitted})
+		defer txn.Discard()
+		require.Equal(t, "3", get(txn))
+		set("4")
+		require.NoError(t, txn.Set([]byte("y"), []byte("1")))
+		require.NoError(t, txn.Commit())
+	})
+}
@@ -7,6 +7,7 @@ package badger
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"hash/crc32"
 	"math"
@@ -43,6 +44,10 @@ type Item struct {
 	status   prefetchStatus
 	meta     byte // We need to store meta to know about bitValuePointer.
 	userMeta byte
+	charge   int64 // Bytes reserved from the DB's prefetch budget.
+	cfLen    int   // Length of the column family prefix of key, if any.
+
+	rangeDeleted bool // Set if the version is deleted by a range tombstone.
 }
 
 // String returns a string representation of Item
@@ -55,14 +60,14 @@ func (item *Item) String() string {
 // Key is only valid as long as item is valid, or transaction is valid.  If you need to use it
 // outside its validity, please use KeyCopy.
 func (item *Item) Key() []byte {
-	return item.key
+	return item.key[item.cfLen:]
 }
 
 // KeyCopy returns a copy of the key of the item, writing it to dst slice.
 // If nil is passed, or capacity of dst isn't sufficient, a new slice would be allocated and
 // returned.
 func (item *Item) KeyCopy(dst []byte) []byte {
-	return y.SafeCopy(dst, item.key)
+	return y.SafeCopy(dst, item.Key())
 }
 
 // Version returns the commit timestamp of the item.
@@ -127,7 +132,20 @@ func (item *Item) hasValue() bool {
 
 // IsDeletedOrExpired returns true if item contains deleted or expired value.
 func (item *Item) IsDeletedOrExpired() bool {
-	return isDeletedOrExpired(item.meta, item.expiresAt)
+	return isDeletedOrExpired(item.meta, item.expiresAt) || item.rangeDeleted
+}
+
+// IsRangeDeleted returns whether the version of the item is deleted by Txn.DeleteRange. Such
+// versions are only yielded by iterators with IteratorOptions.ShowTombstones set.
+func (item *Item) IsRangeDeleted() bool {
+	return item.rangeDeleted
+}
+
+// Meta returns the meta bits the item is stored with, for debugging. Bit 0 is set for a delete
+// marker, bit 1 if the value is stored in the value log, bit 2 if earlier versions can be
+// discarded and bit 3 for a merge delta. Other bits may be set, and their meaning may change.
+func (item *Item) Meta() byte {
+	return item.meta
 }
 
 // DiscardEarlierVersions returns whether the item was created with the
@@ -137,7 +155,22 @@ func (item *Item) DiscardEarlierVersions() bool {
 }
 
 func (item *Item) yieldItemValue() ([]byte, func(), error) {
-	key := item.Key() // No need to copy.
+	val, cb, err := item.yieldStoredValue()
+	if err != nil || val == nil || item.meta&bitTransformed == 0 {
+		return val, cb, err
+	}
+	// The decoded value doesn't reference the stored one.
+	defer runCallback(cb)
+	db := item.txn.db
+	val, err = db.decodeValue(item.key, val, func(chunkKey []byte) ([]byte, error) {
+		return db.readChunk(chunkKey, item.version)
+	})
+	return val, nil, err
+}
+
+// yieldStoredValue returns the value of the item as stored.
+func (item *Item) yieldStoredValue() ([]byte, func(), error) {
+	key := item.key // No need to copy.
 	if !item.hasValue() {
 		return nil, nil, nil
 	}
@@ -146,6 +179,12 @@ func (item *Item) yieldItemValue() ([]byte, func(), error) {
 		item.slice = new(y.Slice)
 	}
 
+	if item.meta&bitMergeEntry > 0 {
+		if f := item.txn.db.mergeOps.get(item.key); f != nil {
+			return item.yieldMergedValue(f)
+		}
+	}
+
 	if (item.meta & bitValuePointer) == 0 {
 		val := item.slice.Resize(len(item.vptr))
 		copy(val, item.vptr)
@@ -172,7 +211,7 @@ func (item *Item) yieldItemValue() ([]byte, func(), error) {
 		iopt.InternalAccess = true
 		iopt.PrefetchValues = false
 
-		it := txn.NewKeyIterator(item.Key(), iopt)
+		it := txn.NewKeyIterator(item.key, iopt)
 		defer it.Close()
 		for it.Rewind(); it.Valid(); it.Next() {
 			item := it.Item()
@@ -181,13 +220,42 @@ func (item *Item) yieldItemValue() ([]byte, func(), error) {
 				vp.Decode(item.vptr)
 			}
 			db.opt.Errorf("Key: %v, Version : %v, meta: %v, userMeta: %v valuePointer: %+v",
-				item.Key(), item.version, item.meta, item.userMeta, vp)
+				item.key, item.version, item.meta, item.userMeta, vp)
+		}
+	}
+	// Invariants checked on request, and values tampered with, fail the read, unlike other
+	// errors.
+	var ie *InvariantError
+	if errors.As(err, &ie) {
+		if ie.Key == nil {
+			ie.Key = y.KeyWithTs(key, item.version)
 		}
+		return nil, cb, err
+	}
+	if errors.Is(err, y.ErrAuthenticationFailed) {
+		return nil, cb, err
 	}
 	// Don't return error if we cannot read the value. Just log the error.
 	return result, cb, nil
 }
 
+// yieldMergedValue returns the value of the item, a merge delta, merged by f into the earlier
+// versions of the key. The delta is read again along with them, as a compaction may have merged
+// it into a value meanwhile.
+func (item *Item) yieldMergedValue(f MergeFunc) ([]byte, func(), error) {
+	txn := item.txn
+	if txn.update && item.version == txn.readTs {
+		// A pending write of the transaction is merged into the versions it reads, which
+		// include readTs.
+		if e, ok := txn.pendingWrites[string(item.key)]; ok && e.meta&bitMergeEntry > 0 {
+			val, err := txn.db.mergeValue(f, item.key, txn.readTs, e.Value)
+			return val, nil, err
+		}
+	}
+	val, err := txn.db.mergeValue(f, item.key, item.version, nil)
+	return val, nil, err
+}
+
 func runCallback(cb func()) {
 	if cb != nil {
 		cb()
@@ -228,7 +296,7 @@ func (item *Item) EstimatedSize() int64 {
 // KeySize returns the size of the key.
 // Exact size of the key is key + 8 bytes of timestamp
 func (item *Item) KeySize() int64 {
-	return int64(len(item.key))
+	return int64(len(item.Key()))
 }
 
 // ValueSize returns the approximate size of the value.
@@ -312,12 +380,31 @@ type IteratorOptions struct {
 	AllVersions    bool // Fetch all valid versions of the same key.
 	InternalAccess bool // Used to allow internal access to badger keys.
 
+	// ShowTombstones yields the versions reads hide, for debugging: for every key, its newest
+	// version is yielded even if it is a delete marker, has expired, or is deleted by a range
+	// tombstone, and with AllVersions, the versions deleted by range tombstones are yielded too.
+	// Use Item.IsDeletedOrExpired, Item.IsRangeDeleted, Item.Meta and Item.Version to tell what
+	// happened to a key.
+	ShowTombstones bool
+
+	// ReuseItem makes the iterator recycle a single Item, along with its key and value
+	// buffers, across Next, Seek and Rewind calls. This avoids allocations in tight scan
+	// loops. The Item returned by Iterator.Item, and any slices obtained from it via Key
+	// or Value, are overwritten by the next call to Next, Seek or Rewind. Use KeyCopy and
+	// ValueCopy to retain data beyond the current step. Since only the current item is
+	// kept, PrefetchSize has no effect in this mode. If PrefetchValues is set, the value
+	// of the current item is read synchronously once the iterator has settled on it.
+	ReuseItem bool
+
 	// The following option is used to narrow down the SSTables that iterator
 	// picks up. If Prefix is specified, only tables which could have this
 	// prefix are picked based on their range of keys.
 	prefixIsKey bool   // If set, use the prefix for bloom filter lookup.
 	Prefix      []byte // Only iterate over this given prefix.
 	SinceTs     uint64 // Only read data that has version > SinceTs.
+
+	columnFamilies bool // Also yield the keys of column families, with their prefix.
+	uncounted      bool // Not counted in the metrics, for the scans of the DB itself.
 }
 
 func (opt *IteratorOptions) compareToPrefix(key []byte) int {
@@ -348,6 +435,9 @@ func (opt *IteratorOptions) pickTable(t table.TableInterface) bool {
 	if opt.prefixIsKey && t.DoesNotHave(y.Hash(opt.Prefix)) {
 		return false
 	}
+	if !opt.prefixIsKey && t.DoesNotHavePrefix(opt.Prefix) {
+		return false
+	}
 	return true
 }
 
@@ -388,8 +478,13 @@ func (opt *IteratorOptions) pickTables(all []*table.Table) []*table.Table {
 		eIdx := sort.Search(len(filtered), func(i int) bool {
 			return opt.compareToPrefix(filtered[i].Smallest()) > 0
 		})
-		out := make([]*table.Table, len(filtered[:eIdx]))
-		copy(out, filtered[:eIdx])
+		// The prefix bloom filters skip the tables which can't have the prefix.
+		out := make([]*table.Table, 0, eIdx)
+		for _, t := range filtered[:eIdx] {
+			if !t.DoesNotHavePrefix(opt.Prefix) {
+				out = append(out, t)
+			}
+		}
 		return filterTables(out)
 	}
 
@@ -434,9 +529,20 @@ type Iterator struct {
 	waste list
 
 	lastKey []byte // Used to skip over multiple versions of the same key.
+	cfLen   int    // Length of the column family prefix of opt.Prefix, if any.
 
-	closed  bool
-	scanned int // Used to estimate the size of data scanned by iterator.
+	// The keys read since the last seek, from rangeFrom to rangeTo, tracked for the range
+	// conflicts of SerializableSnapshot. See seekRange.
+	tracksRange  bool
+	rangeOpen    bool
+	rangeReached bool
+	rangeDone    bool
+	rangeFrom    []byte
+	rangeTo      []byte
+
+	closed     bool
+	scanned    int   // Used to estimate the size of data scanned by iterator.
+	prefetched int64 // Bytes reserved from the DB's prefetch budget.
 
 	// ThreadId is an optional value that can be set to identify which goroutine created
 	// the iterator. It can be used, for example, to uniquely identify each of the
@@ -464,10 +570,13 @@ func (txn *Txn) NewIterator(opt IteratorOptions) *Iterator {
 		panic(ErrDBClosed)
 	}
 
-	y.NumIteratorsCreatedAdd(txn.db.opt.MetricsEnabled, 1)
+	if !opt.uncounted {
+		txn.db.metrics.NumIteratorsCreatedAdd(1)
+	}
 
 	// Keep track of the number of active iterators.
 	txn.numIterators.Add(1)
+	txn.refreshReadTs()
 
 	// TODO: If Prefix is set, only pick those memtables which have keys with the prefix.
 	tables, decr := txn.db.getMemTables()
@@ -486,10 +595,28 @@ func (txn *Txn) NewIterator(opt IteratorOptions) *Iterator {
 		iitr:   table.NewMergeIterator(iters, opt.Reverse),
 		opt:    opt,
 		readTs: txn.readTs,
+
+		tracksRange: txn.tracksRange,
+	}
+	if txn.db.opt.StrictInvariantChecks {
+		res.iitr = &checkedIterator{Iterator: res.iitr, reversed: opt.Reverse}
+	}
+	if res.prefetchesValues() && txn.db.prefetch != nil {
+		txn.db.prefetch.active.Add(1)
 	}
 	return res
 }
 
+func (it *Iterator) prefetchesValues() bool {
+	return it.opt.PrefetchValues && !it.opt.ReuseItem
+}
+
+// recycle releases the prefetch budget held by item and hands it back for reuse.
+func (it *Iterator) recycle(item *Item) {
+	it.txn.db.prefetch.release(it, item)
+	it.waste.push(item)
+}
+
 // NewKeyIterator is just like NewIterator, but allows the user to iterate over all versions of a
 // single key. Internally, it sets the Prefix option in provided opt, and uses that prefix to
 // additionally run bloom filter lookups before picking tables from the LSM tree.
@@ -506,7 +633,7 @@ func (txn *Txn) NewKeyIterator(key []byte, opt IteratorOptions) *Iterator {
 func (it *Iterator) newItem() *Item {
 	item := it.waste.pop()
 	if item == nil {
-		item = &Item{slice: new(y.Slice), txn: it.txn}
+		item = &Item{slice: it.txn.db.prefetch.getSlice(), txn: it.txn}
 	}
 	return item
 }
@@ -515,25 +642,39 @@ func (it *Iterator) newItem() *Item {
 // This item is only valid until it.Next() gets called.
 func (it *Iterator) Item() *Item {
 	tx := it.txn
-	tx.addReadKey(it.item.Key())
+	tx.addReadKey(it.item.key)
 	return it.item
 }
 
 // Valid returns false when iteration is done.
 func (it *Iterator) Valid() bool {
-	if it.item == nil {
-		return false
+	var valid bool
+	switch {
+	case it.item == nil:
+	case it.opt.prefixIsKey:
+		valid = bytes.Equal(it.item.key, it.opt.Prefix)
+	default:
+		valid = bytes.HasPrefix(it.item.key, it.opt.Prefix)
 	}
-	if it.opt.prefixIsKey {
-		return bytes.Equal(it.item.key, it.opt.Prefix)
+	if it.tracksRange {
+		it.extendRange(valid)
 	}
-	return bytes.HasPrefix(it.item.key, it.opt.Prefix)
+	return valid
+}
+
+// Err returns the InvariantError which stopped the iteration, if Options.StrictInvariantChecks
+// is set, or nil. Valid returns false once the keys before the one out of order are consumed.
+func (it *Iterator) Err() error {
+	if ci, ok := it.iitr.(*checkedIterator); ok && ci.err != nil {
+		return ci.err
+	}
+	return nil
 }
 
 // ValidForPrefix returns false when iteration is done
 // or when the current key is not prefixed by the specified prefix.
 func (it *Iterator) ValidForPrefix(prefix []byte) bool {
-	return it.Valid() && bytes.HasPrefix(it.item.key, prefix)
+	return it.Valid() && bytes.HasPrefix(it.item.Key(), prefix)
 }
 
 // Close would close the iterator. It is important to call this when you're done with iteration.
@@ -542,23 +683,32 @@ func (it *Iterator) Close() {
 		return
 	}
 	it.closed = true
-	if it.iitr == nil {
-		it.txn.numIterators.Add(-1)
-		return
+	it.flushRange()
+	// The iterator has no iterator of its own if there was nothing to read, but is counted.
+	if it.iitr != nil {
+		it.iitr.Close()
 	}
-
-	it.iitr.Close()
 	// It is important to wait for the fill goroutines to finish. Otherwise, we might leave zombie
 	// goroutines behind, which are waiting to acquire file read locks after DB has been closed.
+	budget := it.txn.db.prefetch
 	waitFor := func(l list) {
 		item := l.pop()
 		for item != nil {
 			item.wg.Wait()
+			budget.release(it, item)
+			budget.putSlice(item.slice)
 			item = l.pop()
 		}
 	}
+	if it.item != nil {
+		it.data.push(it.item)
+		it.item = nil
+	}
 	waitFor(it.waste)
 	waitFor(it.data)
+	if it.prefetchesValues() && budget != nil {
+		budget.active.Add(-1)
+	}
 
 	// TODO: We could handle this error.
 	_ = it.txn.db.vlog.decrIteratorCount()
@@ -574,7 +724,8 @@ func (it *Iterator) Next() {
 	// Reuse current item
 	it.item.wg.Wait() // Just cleaner to wait before pushing to avoid doing ref counting.
 	it.scanned += len(it.item.key) + len(it.item.val) + len(it.item.vptr) + 2
-	it.waste.push(it.item)
+	it.recycle(it.item)
+	it.txn.db.prefetch.evict(it)
 
 	// Set next item to current
 	it.item = it.data.pop()
@@ -609,6 +760,11 @@ func (it *Iterator) parseItem() bool {
 	key := mi.Key()
 
 	setItem := func(item *Item) {
+		if it.opt.ReuseItem && it.opt.PrefetchValues {
+			// Only fetch the value of the item we hand out. Older versions skipped over
+			// during reverse iteration never pay for a value read.
+			item.prefetchValue()
+		}
 		if it.item == nil {
 			it.item = item
 		} else {
@@ -618,7 +774,8 @@ func (it *Iterator) parseItem() bool {
 
 	isInternalKey := bytes.HasPrefix(key, badgerPrefix)
 	// Skip badger keys.
-	if !it.opt.InternalAccess && isInternalKey {
+	if !it.opt.InternalAccess && isInternalKey &&
+		!(it.opt.columnFamilies && bytes.HasPrefix(key, columnFamilyPrefix)) {
 		mi.Next()
 		return false
 	}
@@ -638,10 +795,17 @@ func (it *Iterator) parseItem() bool {
 	}
 
 	if it.opt.AllVersions {
+		// Versions deleted by a range tombstone are skipped unless shown, since they aren't kept.
+		rangeDeleted := !isInternalKey && it.txn.rangeDeleted(y.ParseKey(key), version)
+		if rangeDeleted && !it.opt.ShowTombstones {
+			mi.Next()
+			return false
+		}
 		// Return deleted or expired values also, otherwise user can't figure out
 		// whether the key was deleted.
 		item := it.newItem()
 		it.fill(item)
+		item.rangeDeleted = rangeDeleted
 		setItem(item)
 		mi.Next()
 		return true
@@ -665,13 +829,15 @@ func (it *Iterator) parseItem() bool {
 FILL:
 	// If deleted, advance and return.
 	vs := mi.Value()
-	if isDeletedOrExpired(vs.Meta, vs.ExpiresAt) {
+	rangeDeleted := it.txn.rangeDeleted(y.ParseKey(mi.Key()), y.ParseTs(mi.Key()))
+	if (isDeletedOrExpired(vs.Meta, vs.ExpiresAt) || rangeDeleted) && !it.opt.ShowTombstones {
 		mi.Next()
 		return false
 	}
 
 	item := it.newItem()
 	it.fill(item)
+	item.rangeDeleted = rangeDeleted
 	// fill item based on current cursor position. All Next calls have returned, so reaching here
 	// means no Next was called.
 
@@ -685,7 +851,10 @@ FILL:
 	nextTs := y.ParseTs(mi.Key())
 	mik := y.ParseKey(mi.Key())
 	if nextTs <= it.readTs && bytes.Equal(mik, item.key) {
-		// This is a valid potential candidate.
+		// This is a valid potential candidate. The item is recycled once its value is prefetched,
+		// releasing its budget.
+		item.wg.Wait()
+		it.recycle(item)
 		goto FILL
 	}
 	// Ignore the next candidate. Return the current one.
@@ -701,10 +870,16 @@ func (it *Iterator) fill(item *Item) {
 
 	item.version = y.ParseTs(it.iitr.Key())
 	item.key = y.SafeCopy(item.key, y.ParseKey(it.iitr.Key()))
+	item.cfLen = it.cfLen
 
 	item.vptr = y.SafeCopy(item.vptr, vs.Value)
 	item.val = nil
-	if it.opt.PrefetchValues {
+	item.status = 0
+	if !it.prefetchesValues() {
+		return
+	}
+	if sz := item.EstimatedSize(); it.txn.db.prefetch.acquire(it, sz) {
+		item.charge = sz
 		item.wg.Add(1)
 		go func() {
 			// FIXME we are not handling errors here.
@@ -728,6 +903,10 @@ func (it *Iterator) prefetch() {
 	if it.opt.PrefetchValues && it.opt.PrefetchSize > 1 {
 		prefetchSize = it.opt.PrefetchSize
 	}
+	if it.opt.ReuseItem {
+		// Keep only the current item, so that Next can hand the same Item back.
+		prefetchSize = 1
+	}
 
 	i := it.iitr
 	var count int
@@ -750,17 +929,41 @@ func (it *Iterator) Seek(key []byte) {
 	if it.iitr == nil {
 		return
 	}
+	if !it.opt.uncounted {
+		start := time.Now()
+		defer func() {
+			it.txn.db.metrics.LatencyObserve(y.LatencyIteratorSeek, time.Since(start))
+		}()
+	}
+	if len(key) > 0 && it.cfLen > 0 {
+		key = append(y.SafeCopy(nil, it.opt.Prefix[:it.cfLen]), key...)
+	}
 	if len(key) > 0 {
 		it.txn.addReadKey(key)
 	}
+	it.seekRange(key)
 	for i := it.data.pop(); i != nil; i = it.data.pop() {
 		i.wg.Wait()
-		it.waste.push(i)
+		it.recycle(i)
+	}
+	if it.opt.ReuseItem && it.item != nil {
+		// Hand the current item back, so that the seek lands on the same Item.
+		it.waste.push(it.item)
+		it.item = nil
 	}
 
 	it.lastKey = it.lastKey[:0]
 	if len(key) == 0 {
 		key = it.opt.Prefix
+		if it.cfLen > 0 && it.opt.Reverse {
+			// Start from the last key of the column family, instead of before its first one.
+			key = prefixEnd(key)
+			if len(key) > 0 {
+				it.iitr.Seek(y.KeyWithTs(key, math.MaxUint64))
+				it.prefetch()
+				return
+			}
+		}
 	}
 	if len(key) == 0 {
 		it.iitr.Rewind()
@@ -26,10 +26,11 @@ type tableMock struct {
 	left, right []byte
 }
 
-func (tm *tableMock) Smallest() []byte             { return tm.left }
-func (tm *tableMock) Biggest() []byte              { return tm.right }
-func (tm *tableMock) DoesNotHave(hash uint32) bool { return false }
-func (tm *tableMock) MaxVersion() uint64           { return math.MaxUint64 }
+func (tm *tableMock) Smallest() []byte                     { return tm.left }
+func (tm *tableMock) Biggest() []byte                      { return tm.right }
+func (tm *tableMock) DoesNotHave(hash uint32) bool         { return false }
+func (tm *tableMock) DoesNotHavePrefix(prefix []byte) bool { return false }
+func (tm *tableMock) MaxVersion() uint64                   { return math.MaxUint64 }
 
 func TestPickTables(t *testing.T) {
 	opt := DefaultIteratorOptions
@@ -114,6 +115,61 @@ func TestPickSortTables(t *testing.T) {
 	require.Equal(t, y.ParseKey(filtered[0].Biggest()), []byte("abc"))
 }
 
+func TestIteratePrefixFilter(t *testing.T) {
+	dir, err := os.MkdirTemp("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+	// The memtables are flushed to L0 tables when the DB is closed.
+	opt := getTestOptions(dir).WithPrefixExtractor(FixedPrefixExtractor(4))
+
+	for _, keys := range [][]string{{"aaa/1", "ccc/1"}, {"bbb/1", "bbb/2"}} {
+		db, err := Open(opt)
+		require.NoError(t, err)
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			for _, key := range keys {
+				require.NoError(t, txn.Set([]byte(key), []byte(key)))
+			}
+			return nil
+		}))
+		require.NoError(t, db.Close())
+	}
+
+	db, err := Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	tables := db.lc.levels[0].tables
+	require.Len(t, tables, 2)
+	picked := func(prefix string) (n int) {
+		iopt := DefaultIteratorOptions
+		iopt.Prefix = []byte(prefix)
+		for _, t := range tables {
+			if iopt.pickTable(t) {
+				n++
+			}
+		}
+		return n
+	}
+	// The table of aaa/1 and ccc/1 can't have bbb/.
+	require.Equal(t, 1, picked("bbb/"))
+	require.Equal(t, 1, picked("bbb/1"))
+	require.Equal(t, 0, picked("bbc/"))
+	// Any key may start with a prefix shorter than the prefixes of the filters.
+	require.Equal(t, 2, picked("b"))
+
+	require.NoError(t, db.View(func(txn *Txn) error {
+		iopt := DefaultIteratorOptions
+		iopt.Prefix = []byte("bbb/")
+		it := txn.NewIterator(iopt)
+		defer it.Close()
+		var keys []string
+		for it.Rewind(); it.Valid(); it.Next() {
+			keys = append(keys, string(it.Item().Key()))
+		}
+		require.Equal(t, []string{"bbb/1", "bbb/2"}, keys)
+		return nil
+	}))
+}
+
 func TestIterateSinceTs(t *testing.T) {
 	bkey := func(i int) []byte {
 		return []byte(fmt.Sprintf("%04d", i))
@@ -168,6 +224,306 @@ func TestIterateSinceTsWithPendingWrites(t *testing.T) {
 	})
 }
 
+func TestIteratorReuseItem(t *testing.T) {
+	bkey := func(i int) []byte {
+		return []byte(fmt.Sprintf("%04d", i))
+	}
+	n := 500
+
+	test := func(t *testing.T, valSize int) {
+		bval := func(i int) []byte {
+			val := make([]byte, valSize)
+			copy(val, fmt.Sprintf("val-%04d", i))
+			return val
+		}
+
+		opt := getTestOptions("")
+		opt.ValueThreshold = 64
+		runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+			batch := db.NewWriteBatch()
+			for i := 0; i < n; i++ {
+				require.NoError(t, batch.Set(bkey(i), bval(i)))
+			}
+			require.NoError(t, batch.Flush())
+			// Overwrite a few keys, so reverse iteration has to skip older versions.
+			for i := 0; i < n; i += 50 {
+				txnSet(t, db, bkey(i), bval(i), 0)
+			}
+
+			for _, reverse := range []bool{false, true} {
+				for _, prefetch := range []bool{false, true} {
+					iopt := DefaultIteratorOptions
+					iopt.ReuseItem = true
+					iopt.Reverse = reverse
+					iopt.PrefetchValues = prefetch
+
+					require.NoError(t, db.View(func(txn *Txn) error {
+						it := txn.NewIterator(iopt)
+						defer it.Close()
+
+						var first *Item
+						var count int
+						for it.Rewind(); it.Valid(); it.Next() {
+							item := it.Item()
+							if first == nil {
+								first = item
+							}
+							require.True(t, first == item, "item should be reused")
+							idx := count
+							if reverse {
+								idx = n - 1 - count
+							}
+							require.Equal(t, bkey(idx), item.Key())
+							require.Equal(t, bval(idx), getItemValue(t, item))
+							count++
+						}
+						require.Equal(t, n, count)
+
+						// Seek must hand back the same item as well.
+						it.Seek(bkey(n / 2))
+						require.True(t, it.Valid())
+						require.True(t, first == it.Item(), "item should be reused across Seek")
+						require.Equal(t, bkey(n/2), it.Item().Key())
+						return nil
+					}))
+				}
+			}
+
+			// With PrefetchValues, the value is held in the item's own buffer. A slice
+			// obtained via Value is overwritten by Next, while ValueCopy is not.
+			require.NoError(t, db.View(func(txn *Txn) error {
+				iopt := DefaultIteratorOptions
+				iopt.ReuseItem = true
+				it := txn.NewIterator(iopt)
+				defer it.Close()
+
+				it.Rewind()
+				require.True(t, it.Valid())
+				var held []byte
+				require.NoError(t, it.Item().Value(func(val []byte) error {
+					held = val
+					return nil
+				}))
+				copied, err := it.Item().ValueCopy(nil)
+				require.NoError(t, err)
+				require.Equal(t, bval(0), held)
+
+				it.Next()
+				require.True(t, it.Valid())
+				require.Equal(t, bval(1), held)
+				require.Equal(t, bval(0), copied)
+				return nil
+			}))
+		})
+	}
+
+	t.Run("inline values", func(t *testing.T) { test(t, 16) })
+	t.Run("vlog values", func(t *testing.T) { test(t, 256) })
+}
+
+func TestIteratorReuseItemAllocs(t *testing.T) {
+	n := 1000
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		batch := db.NewWriteBatch()
+		for i := 0; i < n; i++ {
+			require.NoError(t, batch.Set([]byte(fmt.Sprintf("%04d", i)), []byte("value")))
+		}
+		require.NoError(t, batch.Flush())
+
+		txn := db.NewTransaction(false)
+		defer txn.Discard()
+		scan := func(reuse bool) float64 {
+			iopt := DefaultIteratorOptions
+			iopt.ReuseItem = reuse
+			return testing.AllocsPerRun(10, func() {
+				it := txn.NewIterator(iopt)
+				var count int
+				for it.Rewind(); it.Valid(); it.Next() {
+					count++
+				}
+				it.Close()
+				require.Equal(t, n, count)
+			})
+		}
+		withReuse, withoutReuse := scan(true), scan(false)
+		t.Logf("Allocations per scan of %d keys. ReuseItem: %.0f, default: %.0f",
+			n, withReuse, withoutReuse)
+		// The cost with ReuseItem should be that of setting up the iterator, and must not
+		// grow with the number of keys scanned.
+		require.Less(t, withReuse, float64(n/10))
+		require.Less(t, withReuse, withoutReuse)
+	})
+}
+
+func TestIteratorMaxPrefetchMemory(t *testing.T) {
+	bkey := func(i int) []byte {
+		return []byte(fmt.Sprintf("%04d", i))
+	}
+	bval := func(i int) []byte {
+		val := make([]byte, 1<<10)
+		copy(val, fmt.Sprintf("val-%04d", i))
+		return val
+	}
+	n := 200
+
+	opt := getTestOptions("")
+	opt.ValueThreshold = 64
+	opt.MaxPrefetchMemory = 16 << 10
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		batch := db.NewWriteBatch()
+		for i := 0; i < n; i++ {
+			require.NoError(t, batch.Set(bkey(i), bval(i)))
+		}
+		require.NoError(t, batch.Flush())
+
+		budget := db.prefetch
+		require.NotNil(t, budget)
+		for _, reverse := range []bool{false, true} {
+			require.NoError(t, db.View(func(txn *Txn) error {
+				iopt := DefaultIteratorOptions
+				iopt.PrefetchSize = n
+				iopt.Reverse = reverse
+				its := []*Iterator{txn.NewIterator(iopt), txn.NewIterator(iopt)}
+				require.Equal(t, int64(2), budget.active.Load())
+
+				for _, it := range its {
+					it.Rewind()
+				}
+				for i := 0; i < n; i++ {
+					for _, it := range its {
+						require.True(t, it.Valid())
+						require.LessOrEqual(t, it.prefetched, budget.share())
+						require.LessOrEqual(t, budget.used.Load(), budget.limit)
+
+						want := i
+						if reverse {
+							want = n - 1 - i
+						}
+						item := it.Item()
+						require.Equal(t, bkey(want), item.Key())
+						val, err := item.ValueCopy(nil)
+						require.NoError(t, err)
+						require.Equal(t, bval(want), val)
+						it.Next()
+					}
+				}
+				for _, it := range its {
+					require.False(t, it.Valid())
+					it.Close()
+				}
+				return nil
+			}))
+			require.Zero(t, budget.used.Load())
+			require.Zero(t, budget.active.Load())
+		}
+	})
+}
+
+func TestIteratorPrefetchReverseVersions(t *testing.T) {
+	bkey := func(i int) []byte {
+		return []byte(fmt.Sprintf("%04d", i))
+	}
+	bval := func(i, v int) []byte {
+		val := make([]byte, 1<<10)
+		copy(val, fmt.Sprintf("val-%04d-%d", i, v))
+		return val
+	}
+	n := 50
+
+	opt := getTestOptions("")
+	opt.ValueThreshold = 64
+	opt.MaxPrefetchMemory = 1 << 20
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		for v := 0; v < 3; v++ {
+			batch := db.NewWriteBatch()
+			for i := 0; i < n; i++ {
+				require.NoError(t, batch.Set(bkey(i), bval(i, v)))
+			}
+			require.NoError(t, batch.Flush())
+		}
+
+		// In reverse, the older versions of a key are read before it, and their items recycled
+		// with their budget.
+		budget := db.prefetch
+		require.NoError(t, db.View(func(txn *Txn) error {
+			iopt := DefaultIteratorOptions
+			iopt.Reverse = true
+			it := txn.NewIterator(iopt)
+			i := n - 1
+			for it.Rewind(); it.Valid(); it.Next() {
+				item := it.Item()
+				require.Equal(t, bkey(i), item.Key())
+				val, err := item.ValueCopy(nil)
+				require.NoError(t, err)
+				require.Equal(t, bval(i, 2), val)
+				i--
+			}
+			require.Equal(t, -1, i)
+			it.Close()
+			return nil
+		}))
+		require.Zero(t, budget.used.Load())
+	})
+}
+
+func TestIteratorPrefetchEviction(t *testing.T) {
+	bkey := func(i int) []byte {
+		return []byte(fmt.Sprintf("%04d", i))
+	}
+	bval := func(i int) []byte {
+		val := make([]byte, 1<<10)
+		copy(val, fmt.Sprintf("val-%04d", i))
+		return val
+	}
+	n := 100
+
+	opt := getTestOptions("")
+	opt.ValueThreshold = 64
+	opt.MaxPrefetchMemory = 16 << 10
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		batch := db.NewWriteBatch()
+		for i := 0; i < n; i++ {
+			require.NoError(t, batch.Set(bkey(i), bval(i)))
+		}
+		require.NoError(t, batch.Flush())
+
+		budget := db.prefetch
+		require.NoError(t, db.View(func(txn *Txn) error {
+			iopt := DefaultIteratorOptions
+			iopt.PrefetchSize = n
+			first := txn.NewIterator(iopt)
+			defer first.Close()
+			first.Rewind()
+			held := first.prefetched
+			require.Greater(t, held, budget.limit/2)
+
+			// The first iterator gives up the values over its new share as it moves on, for
+			// the second to get its own.
+			second := txn.NewIterator(iopt)
+			defer second.Close()
+			first.Next()
+			require.LessOrEqual(t, first.prefetched, budget.share())
+			require.Positive(t, budget.evicted.Load())
+			second.Rewind()
+			require.Greater(t, second.prefetched, budget.limit/4)
+
+			// The values evicted are loaded lazily.
+			for i := 1; i < n; i++ {
+				require.True(t, first.Valid())
+				item := first.Item()
+				require.Equal(t, bkey(i), item.Key())
+				val, err := item.ValueCopy(nil)
+				require.NoError(t, err)
+				require.Equal(t, bval(i), val)
+				first.Next()
+			}
+			require.False(t, first.Valid())
+			return nil
+		}))
+		require.Zero(t, budget.used.Load())
+	})
+}
+
 func TestIteratePrefix(t *testing.T) {
 	if !*manual {
 		t.Skip("Skipping test meant to be run manually.")
@@ -307,6 +663,64 @@ func TestIteratorReadOnlyWithNoData(t *testing.T) {
 	}))
 }
 
+func TestIteratorShowTombstones(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			require.NoError(t, txn.Set([]byte("a"), []byte("val")))
+			require.NoError(t, txn.SetEntry(&Entry{Key: []byte("b"), Value: []byte("val"),
+				ExpiresAt: 1}))
+			require.NoError(t, txn.Set([]byte("c"), []byte("val")))
+			return txn.Set([]byte("d"), []byte("val"))
+		}))
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			require.NoError(t, txn.Delete([]byte("a")))
+			return txn.DeleteRange([]byte("c"), []byte("d"))
+		}))
+
+		iterate := func(opt IteratorOptions) (keys []string, items []*Item) {
+			require.NoError(t, db.View(func(txn *Txn) error {
+				it := txn.NewIterator(opt)
+				defer it.Close()
+				for it.Rewind(); it.Valid(); it.Next() {
+					item := it.Item()
+					keys = append(keys, string(item.KeyCopy(nil)))
+					items = append(items, item)
+				}
+				return nil
+			}))
+			return keys, items
+		}
+		opt := DefaultIteratorOptions
+		keys, _ := iterate(opt)
+		require.Equal(t, []string{"d"}, keys)
+		opt.AllVersions = true
+		keys, _ = iterate(opt)
+		require.Equal(t, []string{"a", "a", "b", "d"}, keys)
+
+		opt = DefaultIteratorOptions
+		opt.ShowTombstones = true
+		keys, items := iterate(opt)
+		require.Equal(t, []string{"a", "b", "c", "d"}, keys)
+		require.True(t, items[0].IsDeletedOrExpired())
+		require.Equal(t, byte(bitDelete), items[0].Meta()&bitDelete)
+		require.Equal(t, uint64(2), items[0].Version())
+		require.True(t, items[1].IsDeletedOrExpired())
+		require.Zero(t, items[1].Meta()&bitDelete)
+		require.True(t, items[2].IsDeletedOrExpired())
+		require.True(t, items[2].IsRangeDeleted())
+		require.Equal(t, uint64(1), items[2].Version())
+		require.False(t, items[3].IsDeletedOrExpired())
+
+		opt.Reverse = true
+		keys, _ = iterate(opt)
+		require.Equal(t, []string{"d", "c", "b", "a"}, keys)
+		opt.Reverse = false
+		opt.AllVersions = true
+		keys, _ = iterate(opt)
+		require.Equal(t, []string{"a", "a", "b", "c", "d"}, keys)
+	})
+}
+
 // go test -v -run=XXX -bench=BenchmarkIterate -benchtime=3s
 // Benchmark with opt.Prefix set ===
 // goos: linux
@@ -0,0 +1,110 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"math"
+
+	"github.com/luxfi/zapdb/table"
+	"github.com/luxfi/zapdb/y"
+)
+
+// KeyVersion is a version of a key, as found by DB.KeyDebug.
+type KeyVersion struct {
+	Version   uint64
+	Meta      byte // See Item.Meta.
+	UserMeta  byte
+	ExpiresAt uint64
+}
+
+// KeyLocation is a memtable or a table which may hold a key, as found by DB.KeyDebug.
+type KeyLocation struct {
+	// Level is the level of the table, or -1 for a memtable.
+	Level int
+	// ID is the ID of the table, or the ID of the WAL of the memtable, zero in InMemory mode.
+	ID uint64
+	// Versions are the versions of the key held, newest first. They are empty if the bloom
+	// filter of the table is a false positive.
+	Versions []KeyVersion
+}
+
+// KeyDebug returns where key is stored, to debug missing, duplicate or resurrected versions: the
+// memtables holding key, newest first, followed by the tables whose range and bloom filter say
+// they may hold it, from the newest table of L0 down to the last level, with the versions of key
+// each of them holds. Versions hidden from reads, such as delete markers, are returned too.
+func (db *DB) KeyDebug(key []byte) ([]KeyLocation, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+	if db.IsClosed() {
+		return nil, ErrDBClosed
+	}
+	seek := y.KeyWithTs(key, math.MaxUint64)
+	var out []KeyLocation
+
+	mts, decr := db.getMemTables()
+	defer decr()
+	for _, mt := range mts {
+		loc := KeyLocation{Level: -1}
+		if mt.wal != nil {
+			loc.ID = uint64(mt.wal.fid)
+		}
+		it := mt.sl.NewIterator()
+		for it.Seek(seek); it.Valid() && y.SameKey(it.Key(), seek); it.Next() {
+			loc.Versions = append(loc.Versions, keyVersionOf(it.Key(), it.Value()))
+		}
+		_ = it.Close()
+		if len(loc.Versions) > 0 {
+			out = append(out, loc)
+		}
+	}
+
+	hash := y.Hash(key)
+	for _, l := range db.lc.levels {
+		tables := l.tablesMayHave(key, hash)
+		for _, t := range tables {
+			loc := KeyLocation{Level: l.level, ID: t.ID()}
+			it := t.NewIterator(table.NOCACHE)
+			for it.Seek(seek); it.Valid() && y.SameKey(it.Key(), seek); it.Next() {
+				loc.Versions = append(loc.Versions, keyVersionOf(it.Key(), it.Value()))
+			}
+			_ = it.Close()
+			out = append(out, loc)
+		}
+		if err := decrRefs(tables); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// tablesMayHave returns the tables of the level whose range and bloom filter say they may hold
+// key, with a reference each. The tables of L0 are returned newest first.
+func (s *levelHandler) tablesMayHave(key []byte, hash uint32) []*table.Table {
+	s.RLock()
+	defer s.RUnlock()
+	var out []*table.Table
+	for i := len(s.tables) - 1; i >= 0; i-- {
+		t := s.tables[i]
+		if bytes.Compare(key, y.ParseKey(t.Smallest())) < 0 ||
+			bytes.Compare(key, y.ParseKey(t.Biggest())) > 0 || t.DoesNotHave(hash) {
+			continue
+		}
+		t.IncrRef()
+		out = append(out, t)
+	}
+	return out
+}
+
+func keyVersionOf(key []byte, vs y.ValueStruct) KeyVersion {
+	return KeyVersion{
+		Version:   y.ParseTs(key),
+		Meta:      vs.Meta,
+		UserMeta:  vs.UserMeta,
+		ExpiresAt: vs.ExpiresAt,
+	}
+}
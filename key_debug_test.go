@@ -0,0 +1,58 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyDebug(t *testing.T) {
+	dir := t.TempDir()
+	opt := getTestOptions(dir)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	set := func(key string) {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Set([]byte(key), []byte("val"))
+		}))
+	}
+	set("key")
+	set("other")
+	require.NoError(t, db.Close())
+
+	// The memtable was flushed to L0 on close.
+	db, err = Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	set("key")
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.Delete([]byte("key"))
+	}))
+
+	locs, err := db.KeyDebug([]byte("key"))
+	require.NoError(t, err)
+	require.Len(t, locs, 2)
+	require.Equal(t, -1, locs[0].Level)
+	require.Len(t, locs[0].Versions, 2)
+	require.Equal(t, uint64(4), locs[0].Versions[0].Version)
+	require.Equal(t, bitDelete, locs[0].Versions[0].Meta&bitDelete)
+	require.Equal(t, uint64(3), locs[0].Versions[1].Version)
+	require.Equal(t, 0, locs[1].Level)
+	require.Equal(t, db.Tables()[0].ID, locs[1].ID)
+	require.Equal(t, []KeyVersion{{Version: 1, Meta: bitTxn}}, locs[1].Versions)
+
+	// A table which may hold a key has no versions of it if its bloom filter is wrong.
+	locs, err = db.KeyDebug([]byte("missing"))
+	require.NoError(t, err)
+	for _, loc := range locs {
+		require.NotEqual(t, -1, loc.Level)
+		require.Empty(t, loc.Versions)
+	}
+	_, err = db.KeyDebug(nil)
+	require.ErrorIs(t, err, ErrEmptyKey)
+}
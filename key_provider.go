@@ -0,0 +1,49 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"context"
+	"errors"
+
+	"github.com/luxfi/zapdb/y"
+)
+
+// KeyProvider gives the master key which encrypts the data keys of the key registry, from a key
+// management service such as AWS KMS, HashiCorp Vault or an HSM. See Options.KeyProvider.
+//
+// The master key has the length of an EncryptionKey: 16, 24 or 32 bytes.
+type KeyProvider interface {
+	// GetMasterKey returns the current master key.
+	GetMasterKey(ctx context.Context) ([]byte, error)
+	// RotateMasterKey generates a new master key and calls rewrap with it, before making it the
+	// current one. If rewrap fails, the current master key must be left as it was.
+	RotateMasterKey(ctx context.Context, rewrap func(newKey []byte) error) error
+}
+
+// RotateMasterKey replaces the master key given by Options.KeyProvider with a new one, and
+// rewrites the key registry with the data keys encrypted with it. The data keys themselves are
+// kept, so that no table or value log file is rewritten.
+//
+// The key registry is rewritten atomically, before the provider makes the new key the current
+// one. If the process stops in between, the DB opens with the new key only, which the provider
+// should keep retrievable.
+func (db *DB) RotateMasterKey(ctx context.Context) error {
+	if db.opt.KeyProvider == nil {
+		return ErrNoKeyProvider
+	}
+	if db.opt.ReadOnly {
+		return errors.New("Cannot rotate the master key of a DB opened in ReadOnly mode")
+	}
+	err := db.opt.KeyProvider.RotateMasterKey(ctx, func(newKey []byte) error {
+		return db.registry.rewrap(newKey)
+	})
+	if err != nil {
+		return y.Wrapf(err, "While rotating master key")
+	}
+	db.opt.Infof("Rotated master key of the key registry")
+	return nil
+}
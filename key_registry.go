@@ -10,6 +10,7 @@ import (
 	"crypto/aes"
 	"crypto/rand"
 	"encoding/binary"
+	"errors"
 	"hash/crc32"
 	"io"
 	"os"
@@ -17,8 +18,11 @@ import (
 	"sync"
 	"time"
 
+	"golang.org/x/crypto/chacha20poly1305"
+
 	"github.com/luxfi/zapdb/pb"
 	"github.com/luxfi/zapdb/y"
+	"github.com/luxfi/zapdb/y/vfs"
 )
 
 const (
@@ -47,6 +51,9 @@ type KeyRegistryOptions struct {
 	EncryptionKey                 []byte
 	EncryptionKeyRotationDuration time.Duration
 	InMemory                      bool
+	// EncryptionAlgo is the algorithm of the data keys generated. The data keys are encrypted with
+	// their own algorithm, so that the algorithm can change across restarts.
+	EncryptionAlgo pb.EncryptionAlgo
 }
 
 // newKeyRegistry returns KeyRegistry.
@@ -63,11 +70,8 @@ func newKeyRegistry(opt KeyRegistryOptions) *KeyRegistry {
 func OpenKeyRegistry(opt KeyRegistryOptions) (*KeyRegistry, error) {
 	// sanity check the encryption key length.
 	if len(opt.EncryptionKey) > 0 {
-		switch len(opt.EncryptionKey) {
-		default:
-			return nil, y.Wrapf(ErrInvalidEncryptionKey, "During OpenKeyRegistry")
-		case 16, 24, 32:
-			break
+		if err := checkEncryptionKey(opt.EncryptionKey, opt.EncryptionAlgo); err != nil {
+			return nil, y.Wrapf(err, "During OpenKeyRegistry")
 		}
 	}
 	// If db is opened in InMemory mode, we don't need to write key registry to the disk.
@@ -117,6 +121,19 @@ func OpenKeyRegistry(opt KeyRegistryOptions) (*KeyRegistry, error) {
 	return kr, nil
 }
 
+// checkEncryptionKey checks that the length of the storage key fits the algorithm.
+func checkEncryptionKey(key []byte, algo pb.EncryptionAlgo) error {
+	switch len(key) {
+	default:
+		return ErrInvalidEncryptionKey
+	case 16, 24, 32:
+	}
+	if algo == pb.EncryptionAlgo_chacha20poly1305 && len(key) != chacha20poly1305.KeySize {
+		return y.Wrapf(ErrInvalidEncryptionKey, "ChaCha20-Poly1305 needs a key of 32 bytes")
+	}
+	return nil
+}
+
 // keyRegistryIterator reads all the datakey from the key registry
 type keyRegistryIterator struct {
 	encryptionKey []byte
@@ -148,7 +165,8 @@ func validRegistry(fp *os.File, encryptionKey []byte) error {
 	}
 	if len(encryptionKey) > 0 {
 		// Decrypting sanity text.
-		if eSanityText, err = y.XORBlockAllocate(eSanityText, encryptionKey, iv); err != nil {
+		eSanityText, err = y.XORBlockAllocate(pb.EncryptionAlgo_aes, eSanityText, encryptionKey, iv)
+		if err != nil {
 			return y.Wrapf(err, "During validRegistry")
 		}
 	}
@@ -189,7 +207,8 @@ func (kri *keyRegistryIterator) next() (*pb.DataKey, error) {
 	}
 	if len(kri.encryptionKey) > 0 {
 		// Decrypt the key if the storage key exists.
-		if dataKey.Data, err = y.XORBlockAllocate(dataKey.Data, kri.encryptionKey, dataKey.Iv); err != nil {
+		if dataKey.Data, err = y.XORBlockAllocate(dataKey.EncryptionAlgo, dataKey.Data,
+			kri.encryptionKey, dataKey.Iv); err != nil {
 			return nil, y.Wrapf(err, "While decrypting datakey in keyRegistryIterator.next")
 		}
 	}
@@ -239,11 +258,12 @@ func WriteKeyRegistry(reg *KeyRegistry, opt KeyRegistryOptions) error {
 	buf := &bytes.Buffer{}
 	iv, err := y.GenerateIV()
 	y.Check(err)
-	// Encrypt sanity text if the encryption key is presents.
+	// Encrypt sanity text if the encryption key is presents. It is always encrypted with AES, which
+	// takes keys of every size, so that the key is checked whatever the algorithm of data keys.
 	eSanity := sanityText
 	if len(opt.EncryptionKey) > 0 {
 		var err error
-		eSanity, err = y.XORBlockAllocate(eSanity, opt.EncryptionKey, iv)
+		eSanity, err = y.XORBlockAllocate(pb.EncryptionAlgo_aes, eSanity, opt.EncryptionKey, iv)
 		if err != nil {
 			return y.Wrapf(err, "Error while encrypting sanity text in WriteKeyRegistry")
 		}
@@ -275,12 +295,11 @@ func WriteKeyRegistry(reg *KeyRegistry, opt KeyRegistryOptions) error {
 	if err = fp.Close(); err != nil {
 		return y.Wrapf(err, "Error while closing tmp file in WriteKeyRegistry")
 	}
-	// Rename to the original file.
-	if err = os.Rename(tmpPath, filepath.Join(opt.Dir, KeyRegistryFileName)); err != nil {
-		return y.Wrapf(err, "Error while renaming file in WriteKeyRegistry")
+	// Sync and rename to the original file, then sync the directory.
+	if err = vfs.AtomicReplace(tmpPath, filepath.Join(opt.Dir, KeyRegistryFileName)); err != nil {
+		return y.Wrapf(err, "Error while replacing file in WriteKeyRegistry")
 	}
-	// Sync Dir.
-	return syncDir(opt.Dir)
+	return nil
 }
 
 // DataKey returns datakey of the given key id.
@@ -331,7 +350,16 @@ func (kr *KeyRegistry) LatestDataKey() (*pb.DataKey, error) {
 	if valid {
 		return key, nil
 	}
+	return kr.generateDataKey()
+}
+
+// generateDataKey generates a new data key, the latest one from now on, and stores it. It must be
+// called with the lock held.
+func (kr *KeyRegistry) generateDataKey() (*pb.DataKey, error) {
 	k := make([]byte, len(kr.opt.EncryptionKey))
+	if kr.opt.EncryptionAlgo == pb.EncryptionAlgo_chacha20poly1305 {
+		k = make([]byte, chacha20poly1305.KeySize)
+	}
 	iv, err := y.GenerateIV()
 	if err != nil {
 		return nil, err
@@ -343,10 +371,11 @@ func (kr *KeyRegistry) LatestDataKey() (*pb.DataKey, error) {
 	// Otherwise Increment the KeyID and generate new datakey.
 	kr.nextKeyID++
 	dk := &pb.DataKey{
-		KeyId:     kr.nextKeyID,
-		Data:      k,
-		CreatedAt: time.Now().Unix(),
-		Iv:        iv,
+		KeyId:          kr.nextKeyID,
+		Data:           k,
+		CreatedAt:      time.Now().Unix(),
+		Iv:             iv,
+		EncryptionAlgo: kr.opt.EncryptionAlgo,
 	}
 	// Don't store the datakey on file if badger is running in InMemory mode.
 	if !kr.opt.InMemory {
@@ -367,6 +396,66 @@ func (kr *KeyRegistry) LatestDataKey() (*pb.DataKey, error) {
 	return dk, nil
 }
 
+// rewrap rewrites the key registry with the data keys encrypted with the given storage key, in
+// place of the current one. The data keys themselves are unchanged, so that the data encrypted
+// with them is read as before.
+func (kr *KeyRegistry) rewrap(key []byte) error {
+	if kr.opt.ReadOnly {
+		return errors.New("Cannot rewrap the data keys of a read-only key registry")
+	}
+	if err := checkEncryptionKey(key, kr.opt.EncryptionAlgo); err != nil {
+		return y.Wrapf(err, "During rewrap")
+	}
+	kr.Lock()
+	defer kr.Unlock()
+	opt := kr.opt
+	opt.EncryptionKey = key
+	return kr.rewrite(opt)
+}
+
+// rotate generates a new data key, the latest one from now on whatever the rotation duration, and
+// rewrites the key registry with it.
+func (kr *KeyRegistry) rotate() (*pb.DataKey, error) {
+	if kr.opt.ReadOnly {
+		return nil, errors.New("Cannot rotate the data key of a read-only key registry")
+	}
+	if len(kr.opt.EncryptionKey) == 0 {
+		return nil, errors.New("Cannot rotate the data key without an encryption key")
+	}
+	kr.Lock()
+	defer kr.Unlock()
+	dk, err := kr.generateDataKey()
+	if err != nil {
+		return nil, y.Wrapf(err, "Error while generating data key.")
+	}
+	return dk, kr.rewrite(kr.opt)
+}
+
+// rewrite replaces the key registry file by one written with opt, and makes opt the options of
+// kr. It must be called with the lock held.
+func (kr *KeyRegistry) rewrite(opt KeyRegistryOptions) error {
+	if !kr.opt.InMemory {
+		if err := WriteKeyRegistry(kr, opt); err != nil {
+			return y.Wrapf(err, "Error while rewriting key registry.")
+		}
+		// The file of kr.fp was replaced: the data keys generated from now on are appended to
+		// the new one.
+		fp, err := y.OpenExistingFile(filepath.Join(opt.Dir, KeyRegistryFileName), y.Sync)
+		if err != nil {
+			return y.Wrapf(err, "Error while opening rewritten key registry.")
+		}
+		if _, err := fp.Seek(0, io.SeekEnd); err != nil {
+			fp.Close()
+			return y.Wrapf(err, "Error while seeking rewritten key registry.")
+		}
+		// The replaced file is gone already, closing it loses nothing.
+		_ = kr.fp.Close()
+		kr.fp = fp
+	}
+	kr.opt = opt
+	return nil
+}
+
 // Close closes the key registry.
 func (kr *KeyRegistry) Close() error {
 	if !(kr.opt.ReadOnly || kr.opt.InMemory) {
@@ -384,7 +473,7 @@ func storeDataKey(buf *bytes.Buffer, storageKey []byte, k *pb.DataKey) error {
 			return nil
 		}
 		var err error
-		k.Data, err = y.XORBlockAllocate(k.Data, storageKey, k.Iv)
+		k.Data, err = y.XORBlockAllocate(k.EncryptionAlgo, k.Data, storageKey, k.Iv)
 		return err
 	}
 	// In memory datakey will be plain text so encrypting before storing to the disk.
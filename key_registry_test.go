@@ -6,11 +6,18 @@
 package badger
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/crc32"
 	"math/rand"
 	"os"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/pb"
+	"github.com/luxfi/zapdb/y"
 )
 
 func getRegistryTestOptions(dir string, key []byte) KeyRegistryOptions {
@@ -147,3 +154,219 @@ func TestKeyRegistryInMemory(t *testing.T) {
 	require.NoError(t, err)
 	require.NoError(t, kr.Close())
 }
+
+func TestEncryptionAlgoChaCha(t *testing.T) {
+	encryptionKey := make([]byte, 32)
+	_, err := rand.Read(encryptionKey)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	opt := getTestOptions(dir).
+		WithEncryptionKey(encryptionKey).
+		WithEncryptionAlgo(pb.EncryptionAlgo_chacha20poly1305).
+		WithIndexCacheSize(10 << 20).
+		WithValueThreshold(32).
+		WithBaseTableSize(1 << 15)
+
+	_, err = Open(opt.WithEncryptionKey(encryptionKey[:16]))
+	require.ErrorContains(t, err, ErrInvalidEncryptionKey.Error())
+
+	val := func(i int) []byte { return bytes.Repeat([]byte{byte(i)}, 10+i%64) }
+	write := func(db *DB, prefix string) {
+		wb := db.NewWriteBatch()
+		for i := 0; i < 1000; i++ {
+			require.NoError(t, wb.Set([]byte(fmt.Sprintf("%s%04d", prefix, i)), val(i)))
+		}
+		require.NoError(t, wb.Flush())
+	}
+	check := func(db *DB, prefix string) {
+		require.NoError(t, db.View(func(txn *Txn) error {
+			for i := 0; i < 1000; i++ {
+				item, err := txn.Get([]byte(fmt.Sprintf("%s%04d", prefix, i)))
+				require.NoError(t, err)
+				v, err := item.ValueCopy(nil)
+				require.NoError(t, err)
+				require.Equal(t, val(i), v)
+			}
+			return nil
+		}))
+	}
+
+	db, err := Open(opt)
+	require.NoError(t, err)
+	write(db, "a")
+	require.NoError(t, db.Flatten(1))
+	check(db, "a")
+	dk, err := db.registry.LatestDataKey()
+	require.NoError(t, err)
+	require.Equal(t, pb.EncryptionAlgo_chacha20poly1305, dk.EncryptionAlgo)
+	require.Len(t, dk.Data, 32)
+	require.NoError(t, db.Close())
+
+	// Data written with ChaCha20-Poly1305 is still read once the DB switches to AES.
+	db, err = Open(opt.WithEncryptionAlgo(pb.EncryptionAlgo_aes))
+	require.NoError(t, err)
+	check(db, "a")
+	write(db, "b")
+	require.NoError(t, db.Close())
+
+	db, err = Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	check(db, "a")
+	check(db, "b")
+}
+
+func TestEncryptionAlgoAuthenticated(t *testing.T) {
+	encryptionKey := make([]byte, 16)
+	_, err := rand.Read(encryptionKey)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	opt := getTestOptions(dir).
+		WithEncryptionKey(encryptionKey).
+		WithEncryptionAlgo(pb.EncryptionAlgo_aes_gcm).
+		WithIndexCacheSize(10 << 20).
+		WithValueThreshold(32)
+
+	db, err := Open(opt)
+	require.NoError(t, err)
+	e := &Entry{Key: []byte("key"), Value: bytes.Repeat([]byte("v"), 64), meta: bitValuePointer}
+	b := &request{Entries: []*Entry{e}}
+	require.NoError(t, db.vlog.write([]*request{b}))
+	buf, lf, err := db.vlog.readValueBytes(b.Ptrs[0])
+	require.NoError(t, err)
+	require.Equal(t, 16, lf.sealOverhead())
+	decoded, err := lf.decodeEntry(buf, b.Ptrs[0].Offset)
+	require.NoError(t, err)
+	require.Equal(t, e.Value, decoded.Value)
+	// An entry tampered with fails authentication.
+	tampered := append([]byte{}, buf...)
+	tampered[len(tampered)-crc32.Size-1]++
+	_, err = lf.decodeEntry(tampered, b.Ptrs[0].Offset)
+	require.ErrorIs(t, err, y.ErrAuthenticationFailed)
+	// So does its header, which isn't encrypted.
+	tampered = append(tampered[:0], buf...)
+	tampered[1]++
+	_, err = lf.decodeEntry(tampered, b.Ptrs[0].Offset)
+	require.ErrorIs(t, err, y.ErrAuthenticationFailed)
+	runCallback(db.vlog.getUnlockCallback(lf))
+
+	// A value tampered with in the value log fails the read.
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.Set([]byte("tampered"), e.Value)
+	}))
+	require.NoError(t, db.View(func(txn *Txn) error {
+		item, err := txn.Get([]byte("tampered"))
+		require.NoError(t, err)
+		var vp valuePointer
+		vp.Decode(item.vptr)
+		lf, err := db.vlog.getFileRLocked(vp)
+		require.NoError(t, err)
+		lf.Data[vp.Offset+vp.Len-crc32.Size-1]++
+		lf.lock.RUnlock()
+		_, err = item.ValueCopy(nil)
+		require.ErrorIs(t, err, y.ErrAuthenticationFailed)
+		return nil
+	}))
+
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.Set([]byte("a"), []byte("a"))
+	}))
+	require.NoError(t, db.Close())
+	// The memtable was flushed into a table on close.
+	db, err = Open(opt)
+	require.NoError(t, err)
+	require.NotEmpty(t, db.manifest.manifest.Tables)
+	for _, tm := range db.manifest.manifest.Tables {
+		require.Equal(t, pb.EncryptionAlgo_aes_gcm, tm.EncryptionAlgo)
+	}
+	// The value log file truncated by recovery isn't written again, which would reuse the nonces
+	// of the offsets past its last entry.
+	last := db.vlog.filesMap[db.vlog.maxFid-1]
+	_, err = last.encodeEntry(&bytes.Buffer{}, e, last.size.Load())
+	require.ErrorContains(t, err, "truncated by recovery")
+	require.NoError(t, db.Close())
+
+	// Tables recorded as authenticated aren't read with a data key downgraded to AES.
+	kopt := getRegistryTestOptions(dir, encryptionKey)
+	kr, err := OpenKeyRegistry(kopt)
+	require.NoError(t, err)
+	for _, dk := range kr.dataKeys {
+		dk.EncryptionAlgo = pb.EncryptionAlgo_aes
+	}
+	require.NoError(t, WriteKeyRegistry(kr, kopt))
+	require.NoError(t, kr.Close())
+	_, err = Open(opt)
+	require.ErrorContains(t, err, "but not its data key")
+}
+
+// testKeyProvider keeps its master keys in memory, the current one last.
+type testKeyProvider struct {
+	keys [][]byte
+}
+
+func (p *testKeyProvider) GetMasterKey(ctx context.Context) ([]byte, error) {
+	return p.keys[len(p.keys)-1], nil
+}
+
+func (p *testKeyProvider) RotateMasterKey(ctx context.Context,
+	rewrap func(newKey []byte) error) error {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	if err := rewrap(key); err != nil {
+		return err
+	}
+	p.keys = append(p.keys, key)
+	return nil
+}
+
+func TestKeyProvider(t *testing.T) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	p := &testKeyProvider{keys: [][]byte{key}}
+	dir := t.TempDir()
+	opt := getTestOptions(dir).WithKeyProvider(p).WithIndexCacheSize(10 << 20)
+
+	db, err := Open(opt)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.Set([]byte("before"), []byte("rotation"))
+	}))
+	require.NoError(t, db.RotateMasterKey(context.Background()))
+	require.Len(t, p.keys, 2)
+	// The data keys generated after the rotation are stored with the new master key.
+	db.registry.Lock()
+	db.registry.opt.EncryptionKeyRotationDuration = 0
+	db.registry.Unlock()
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.Set([]byte("after"), []byte("rotation"))
+	}))
+	require.NoError(t, db.Close())
+
+	// The registry is read with the new master key only.
+	_, err = OpenKeyRegistry(getRegistryTestOptions(dir, key))
+	require.ErrorIs(t, err, ErrEncryptionKeyMismatch)
+	db, err = Open(opt)
+	require.NoError(t, err)
+	require.Greater(t, len(db.registry.dataKeys), 1)
+	for _, k := range []string{"before", "after"} {
+		require.NoError(t, db.View(func(txn *Txn) error {
+			item, err := txn.Get([]byte(k))
+			require.NoError(t, err)
+			return item.Value(func(v []byte) error {
+				require.Equal(t, []byte("rotation"), v)
+				return nil
+			})
+		}))
+	}
+	require.NoError(t, db.Close())
+
+	_, err = Open(opt.WithEncryptionKey(key))
+	require.Error(t, err)
+	db, err = Open(getTestOptions(t.TempDir()))
+	require.NoError(t, err)
+	require.ErrorIs(t, db.RotateMasterKey(context.Background()), ErrNoKeyProvider)
+	require.NoError(t, db.Close())
+}
@@ -0,0 +1,172 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+
+	"github.com/luxfi/zapdb/table"
+	"github.com/luxfi/zapdb/y"
+)
+
+// RotateDataKeyOptions are the options of DB.RotateDataKey.
+type RotateDataKeyOptions struct {
+	// Rewrite rewrites the tables and value log files encrypted with earlier data keys, so that
+	// they are encrypted with the new one.
+	Rewrite bool
+	// Progress, if set, is called once the data key is rotated, and after every table compacted
+	// and value log file rewritten.
+	Progress func(RotationProgress)
+}
+
+// RotationProgress is the progress of DB.RotateDataKey.
+type RotationProgress struct {
+	// KeyID is the ID of the new data key.
+	KeyID uint64
+	// TablesLeft and ValueLogFilesLeft are the number of files still encrypted with earlier data
+	// keys, or not encrypted at all.
+	TablesLeft        int
+	ValueLogFilesLeft int
+	// Compactions and ValueLogFilesRewritten are the number of compactions run and value log
+	// files rewritten so far.
+	Compactions            int
+	ValueLogFilesRewritten int
+}
+
+// RotateDataKey generates a new data key, which encrypts the data written from now on whatever
+// Options.EncryptionKeyRotationDuration, and rewrites the key registry with it. It returns the ID
+// of the new data key. The DB must be opened with an encryption key.
+//
+// Data written before stays encrypted with the data keys it was written with, until it's
+// compacted or garbage collected. With opt.Rewrite, RotateDataKey rewrites it right away: the
+// tables encrypted with earlier data keys are compacted level by level, and the value log files
+// rewritten like value log GC does, while the DB serves reads and writes. It returns once no
+// file is left but the memtables' write-ahead logs, which are dropped when the memtables are
+// flushed, or with the error of ctx if it is done first. Call it in its own goroutine to rewrite
+// the data in the background; the rotation itself is done once Progress is first called.
+func (db *DB) RotateDataKey(ctx context.Context, opt RotateDataKeyOptions) (uint64, error) {
+	if db.opt.ReadOnly {
+		return 0, errors.New("Cannot rotate the data key of a DB opened in ReadOnly mode")
+	}
+	dk, err := db.registry.rotate()
+	if err != nil {
+		return 0, y.Wrapf(err, "While rotating data key")
+	}
+	db.opt.Infof("Rotated data key to ID %d", dk.KeyId)
+	progress := RotationProgress{KeyID: dk.KeyId}
+	report := func() {
+		progress.TablesLeft = len(db.lc.tablesKeyedBelow(dk.KeyId, -1))
+		progress.ValueLogFilesLeft = len(db.vlog.filesKeyedBelow(dk.KeyId))
+		if opt.Progress != nil {
+			opt.Progress(progress)
+		}
+	}
+	if !opt.Rewrite {
+		report()
+		return dk.KeyId, nil
+	}
+	// The value log file written to is encrypted with an earlier data key: an empty write starts
+	// a new one, so that it can be rewritten like the others.
+	if !db.opt.InMemory {
+		db.vlog.rotate.Store(true)
+		if err := db.batchSet(nil); err != nil {
+			return dk.KeyId, y.Wrapf(err, "While rotating value log file")
+		}
+	}
+	report()
+
+	lc := z.NewCloser(0)
+	defer context.AfterFunc(ctx, lc.Signal)()
+	for level := range db.lc.levels {
+		p := compactionPriority{level: level, rekeyBelow: dk.KeyId}
+		for len(db.lc.tablesKeyedBelow(dk.KeyId, level)) > 0 {
+			if err := ctx.Err(); err != nil {
+				return dk.KeyId, err
+			}
+			if db.IsClosed() {
+				return dk.KeyId, ErrDBClosed
+			}
+			if !db.acquireCompaction(lc) {
+				return dk.KeyId, ctx.Err()
+			}
+			err := db.lc.doCompact(177, p)
+			db.releaseCompaction()
+			switch {
+			case err == errFillTables:
+				// The tables are being compacted already.
+				time.Sleep(10 * time.Millisecond)
+				continue
+			case err != nil:
+				return dk.KeyId, y.Wrapf(err, "While compacting tables of level %d", level)
+			}
+			progress.Compactions++
+			report()
+		}
+	}
+
+	for _, lf := range db.vlog.filesKeyedBelow(dk.KeyId) {
+		if db.IsClosed() {
+			return dk.KeyId, ErrDBClosed
+		}
+		select {
+		case db.vlog.garbageCh <- struct{}{}:
+		case <-ctx.Done():
+			return dk.KeyId, ctx.Err()
+		}
+		err := db.vlog.doRunGC(lf)
+		<-db.vlog.garbageCh
+		if err != nil {
+			return dk.KeyId, y.Wrapf(err, "While rewriting value log file %d", lf.fid)
+		}
+		progress.ValueLogFilesRewritten++
+		report()
+	}
+	return dk.KeyId, nil
+}
+
+// tablesKeyedBelow returns the tables of level, or of every level if level is negative, which
+// are encrypted with a data key of an ID lower than id.
+func (s *levelsController) tablesKeyedBelow(id uint64, level int) []*table.Table {
+	var out []*table.Table
+	for _, l := range s.levels {
+		if level >= 0 && l.level != level {
+			continue
+		}
+		l.RLock()
+		out = append(out, tablesKeyedBelow(l.tables, id)...)
+		l.RUnlock()
+	}
+	return out
+}
+
+// tablesKeyedBelow returns the tables encrypted with a data key of an ID lower than id.
+func tablesKeyedBelow(tables []*table.Table, id uint64) []*table.Table {
+	var out []*table.Table
+	for _, t := range tables {
+		if t.KeyID() < id {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// filesKeyedBelow returns the value log files, but the one written to, which are encrypted with
+// a data key of an ID lower than id, and aren't to be deleted.
+func (vlog *valueLog) filesKeyedBelow(id uint64) []*logFile {
+	vlog.filesLock.RLock()
+	defer vlog.filesLock.RUnlock()
+	var out []*logFile
+	for _, fid := range vlog.sortedFids() {
+		if lf := vlog.filesMap[fid]; fid < vlog.maxFid && lf.keyID() < id {
+			out = append(out, lf)
+		}
+	}
+	return out
+}
@@ -0,0 +1,89 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotateDataKey(t *testing.T) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	opt := getTestOptions(t.TempDir()).
+		WithEncryptionKey(key).
+		WithIndexCacheSize(10 << 20).
+		WithValueThreshold(32)
+
+	db, err := Open(opt)
+	require.NoError(t, err)
+	val := bytes.Repeat([]byte("v"), 64)
+	write := func(n int) {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			for i := 0; i < n; i++ {
+				if err := txn.Set([]byte(fmt.Sprintf("key%03d", i)), val); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+	}
+	write(100)
+	require.NoError(t, db.Close())
+	db, err = Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	write(50)
+	// A table of the last level, which isn't encrypted.
+	createAndOpen(db, []keyValVersion{{"zzz", "val", 1, 0}}, len(db.lc.levels)-1)
+	require.NotEmpty(t, db.lc.tablesKeyedBelow(2, -1))
+
+	var progress []RotationProgress
+	id, err := db.RotateDataKey(context.Background(), RotateDataKeyOptions{
+		Rewrite:  true,
+		Progress: func(p RotationProgress) { progress = append(progress, p) },
+	})
+	require.NoError(t, err)
+	require.Greater(t, id, uint64(1))
+	require.NotEmpty(t, progress)
+	require.Positive(t, progress[0].TablesLeft+progress[0].ValueLogFilesLeft)
+	last := progress[len(progress)-1]
+	require.Zero(t, last.TablesLeft)
+	require.Zero(t, last.ValueLogFilesLeft)
+	require.Positive(t, last.Compactions)
+	require.Positive(t, last.ValueLogFilesRewritten)
+	require.Empty(t, db.lc.tablesKeyedBelow(id, -1))
+
+	require.NoError(t, db.View(func(txn *Txn) error {
+		for i := 0; i < 100; i++ {
+			item, err := txn.Get([]byte(fmt.Sprintf("key%03d", i)))
+			require.NoError(t, err)
+			v, err := item.ValueCopy(nil)
+			require.NoError(t, err)
+			require.Equal(t, val, v)
+		}
+		_, err := txn.Get([]byte("zzz"))
+		return err
+	}))
+
+	// The new data key is written to the key registry.
+	kr, err := OpenKeyRegistry(getRegistryTestOptions(opt.Dir, key))
+	require.NoError(t, err)
+	require.Contains(t, kr.dataKeys, id)
+	require.NoError(t, kr.Close())
+
+	plain, err := Open(getTestOptions(t.TempDir()))
+	require.NoError(t, err)
+	_, err = plain.RotateDataKey(context.Background(), RotateDataKeyOptions{})
+	require.Error(t, err)
+	require.NoError(t, plain.Close())
+}
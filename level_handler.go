@@ -271,14 +271,14 @@ func (s *levelHandler) get(key []byte) (y.ValueStruct, error) {
 	var maxVs y.ValueStruct
 	for _, th := range tables {
 		if th.DoesNotHave(hash) {
-			y.NumLSMBloomHitsAdd(s.db.opt.MetricsEnabled, s.strLevel, 1)
+			s.db.metrics.NumLSMBloomHitsAdd(s.strLevel, 1)
 			continue
 		}
 
-		it := th.NewIterator(0)
+		it := th.NewIterator(s.db.cacheOption(keyNoTs))
 		defer it.Close()
 
-		y.NumLSMGetsAdd(s.db.opt.MetricsEnabled, s.strLevel, 1)
+		s.db.metrics.NumLSMGetsAdd(s.strLevel, 1)
 		it.Seek(key)
 		if !it.Valid() {
 			continue
@@ -299,9 +299,9 @@ func (s *levelHandler) appendIterators(iters []y.Iterator, opt *IteratorOptions)
 	s.RLock()
 	defer s.RUnlock()
 
-	var topt int
+	topt := s.db.cacheOption(opt.Prefix)
 	if opt.Reverse {
-		topt = table.REVERSED
+		topt |= table.REVERSED
 	}
 	if s.level == 0 {
 		// Remember to add in reverse order!
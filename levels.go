@@ -23,6 +23,8 @@ import (
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 
+	"github.com/luxfi/zapdb/failpoint"
+	"github.com/luxfi/zapdb/options"
 	"github.com/luxfi/zapdb/pb"
 	"github.com/luxfi/zapdb/table"
 	"github.com/luxfi/zapdb/y"
@@ -32,31 +34,64 @@ import (
 type levelsController struct {
 	nextFileID atomic.Uint64
 	l0stallsMs atomic.Int64
+	l0stall    stallTracker
+	reaper     *ttlReaper
 
 	// The following are initialized once and const.
 	levels []*levelHandler
 	kv     *DB
 
 	cstatus compactStatus
+
+	// compactors are the compaction workers running until lc is closed, of which those with IDs
+	// below RuntimeOptions.NumCompactors compact.
+	compactors struct {
+		sync.Mutex
+		lc      *z.Closer
+		running int
+	}
 }
 
 // revertToManifest checks that all necessary table files exist and removes all table files not
-// referenced by the manifest. idMap is a set of table file id's that were read from the directory
-// listing.
-func revertToManifest(kv *DB, mf *Manifest, idMap map[uint64]struct{}) error {
+// referenced by the manifest. idMap, coldIDMap and remoteIDMap are the sets of table file id's
+// that were read from the listings of Options.Dir, Options.ColdStorageDir and
+// Options.RemoteTableStore.
+func revertToManifest(kv *DB, mf *Manifest, idMap, coldIDMap,
+	remoteIDMap map[uint64]struct{}) error {
+	tierIDs := map[uint32]map[uint64]struct{}{0: idMap, coldTier: coldIDMap, remoteTier: remoteIDMap}
+
 	// 1. Check all files in manifest exist.
-	for id := range mf.Tables {
-		if _, ok := idMap[id]; !ok {
+	for id, tm := range mf.Tables {
+		switch {
+		case tm.Cold && kv.opt.ColdStorageDir == "":
+			return fmt.Errorf("table %d is in cold storage, but ColdStorageDir isn't set", id)
+		case tm.Remote && kv.opt.RemoteTableStore == nil:
+			return fmt.Errorf("table %d is in remote storage, but RemoteTableStore isn't set", id)
+		}
+		if _, ok := tierIDs[tm.tier()][id]; !ok {
 			return fmt.Errorf("file does not exist for table %d", id)
 		}
 	}
 
-	// 2. Delete files that shouldn't exist.
-	for id := range idMap {
-		if _, ok := mf.Tables[id]; !ok {
+	// 2. Delete files that shouldn't exist, like the copies of the tables left by a move
+	// interrupted before or after it was recorded in the manifest. In read-only mode, they may be
+	// the tables another process is writing.
+	if kv.opt.ReadOnly {
+		return nil
+	}
+	for _, tier := range []uint32{0, coldTier, remoteTier} {
+		for id := range tierIDs[tier] {
+			if tm, ok := mf.Tables[id]; ok && tm.tier() == tier {
+				continue
+			}
 			kv.opt.Debugf("Table file %d not referenced in MANIFEST\n", id)
-			filename := table.NewFilename(id, kv.opt.Dir)
-			if err := os.Remove(filename); err != nil {
+			var err error
+			if tier == remoteTier {
+				err = kv.opt.RemoteTableStore.Delete(context.Background(), id)
+			} else {
+				err = os.Remove(table.NewFilename(id, kv.tableDir(tier == coldTier)))
+			}
+			if err != nil {
 				return y.Wrapf(err, "While removing table %d", id)
 			}
 		}
@@ -70,6 +105,7 @@ func newLevelsController(db *DB, mf *Manifest) (*levelsController, error) {
 	s := &levelsController{
 		kv:     db,
 		levels: make([]*levelHandler, db.opt.MaxLevels),
+		reaper: &ttlReaper{db: db},
 	}
 	s.cstatus.tables = make(map[uint64]struct{})
 	s.cstatus.levels = make([]*levelCompactStatus, db.opt.MaxLevels)
@@ -80,10 +116,29 @@ func newLevelsController(db *DB, mf *Manifest) (*levelsController, error) {
 	}
 
 	if db.opt.InMemory {
+		if a := db.opt.archive; a != nil {
+			if err := s.openArchive(a); err != nil {
+				return nil, err
+			}
+		}
 		return s, nil
 	}
 	// Compare manifest against directory, check for existent/non-existent files, and remove.
-	if err := revertToManifest(db, mf, getIDMap(db.opt.Dir)); err != nil {
+	var coldIDMap, remoteIDMap map[uint64]struct{}
+	if db.opt.ColdStorageDir != "" {
+		coldIDMap = getIDMap(db.opt.ColdStorageDir)
+	}
+	if store := db.opt.RemoteTableStore; store != nil {
+		ids, err := store.List(context.Background())
+		if err != nil {
+			return nil, y.Wrapf(err, "Listing remote tables")
+		}
+		remoteIDMap = make(map[uint64]struct{}, len(ids))
+		for _, id := range ids {
+			remoteIDMap[id] = struct{}{}
+		}
+	}
+	if err := revertToManifest(db, mf, getIDMap(db.opt.Dir), coldIDMap, remoteIDMap); err != nil {
 		return nil, err
 	}
 
@@ -101,14 +156,15 @@ func newLevelsController(db *DB, mf *Manifest) (*levelsController, error) {
 	tick := time.NewTicker(3 * time.Second)
 	defer tick.Stop()
 
+	db.opt.openProgress(OpenStageTables, 0, len(mf.Tables))
 	for fileID, tf := range mf.Tables {
-		fname := table.NewFilename(fileID, db.opt.Dir)
 		select {
 		case <-tick.C:
 			db.opt.Infof("%d tables out of %d opened in %s\n", numOpened.Load(),
 				len(mf.Tables), time.Since(start).Round(time.Millisecond))
 		default:
 		}
+		db.opt.openProgress(OpenStageTables, int(numOpened.Load()), len(mf.Tables))
 		if err := throttle.Do(); err != nil {
 			closeAllTables(tables)
 			return nil, err
@@ -116,48 +172,27 @@ func newLevelsController(db *DB, mf *Manifest) (*levelsController, error) {
 		if fileID > maxFileID {
 			maxFileID = fileID
 		}
-		go func(fname string, tf TableManifest) {
+		go func(tf TableManifest) {
 			var rerr error
 			defer func() {
 				throttle.Done(rerr)
 				numOpened.Add(1)
 			}()
-			dk, err := db.registry.DataKey(tf.KeyID)
-			if err != nil {
-				rerr = y.Wrapf(err, "Error while reading datakey")
-				return
-			}
-			topt := buildTableOptions(db)
-			// Explicitly set Compression and DataKey based on how the table was generated.
-			topt.Compression = tf.Compression
-			topt.DataKey = dk
-
-			mf, err := z.OpenMmapFile(fname, db.opt.getFileFlags(), 0)
-			if err != nil {
-				rerr = y.Wrapf(err, "Opening file: %q", fname)
+			t, err := openTable(db, fileID, tf)
+			if err != nil || t == nil {
+				rerr = err
 				return
 			}
-			t, err := table.OpenTable(mf, topt)
-			if err != nil {
-				if strings.HasPrefix(err.Error(), "CHECKSUM_MISMATCH:") {
-					db.opt.Errorf(err.Error())
-					db.opt.Errorf("Ignoring table %s", mf.Fd.Name())
-					// Do not set rerr. We will continue without this table.
-				} else {
-					rerr = y.Wrapf(err, "Opening table: %q", fname)
-				}
-				return
-			}
-
 			mu.Lock()
 			tables[tf.Level] = append(tables[tf.Level], t)
 			mu.Unlock()
-		}(fname, tf)
+		}(tf)
 	}
 	if err := throttle.Finish(); err != nil {
 		closeAllTables(tables)
 		return nil, err
 	}
+	db.opt.openProgress(OpenStageTables, len(mf.Tables), len(mf.Tables))
 	db.opt.Infof("All %d tables opened in %s\n", numOpened.Load(),
 		time.Since(start).Round(time.Millisecond))
 	s.nextFileID.Store(maxFileID + 1)
@@ -184,6 +219,58 @@ func newLevelsController(db *DB, mf *Manifest) (*levelsController, error) {
 // Closes the tables, for cleanup in newLevelsController.  (We Close() instead of using DecrRef()
 // because that would delete the underlying files.)  We ignore errors, which is OK because tables
 // are read-only.
+// openTable opens the table fileID of the manifest. The table is nil if it's ignored for a
+// checksum mismatch.
+func openTable(db *DB, fileID uint64, tf TableManifest) (*table.Table, error) {
+	fname := table.NewFilename(fileID, db.tableDir(tf.Cold))
+	dk, err := db.registry.DataKey(tf.KeyID)
+	if err != nil {
+		return nil, y.Wrapf(err, "Error while reading datakey")
+	}
+	// A table recorded as authenticated must stay so, so that its data isn't
+	// read unauthenticated if its data key was tampered with.
+	if y.SealOverhead(tf.EncryptionAlgo) > 0 &&
+		(dk == nil || dk.EncryptionAlgo != tf.EncryptionAlgo) {
+		return nil, fmt.Errorf("Table %s is encrypted with algorithm %d, "+
+			"but not its data key %d", fname, tf.EncryptionAlgo,
+			tf.KeyID)
+	}
+	topt := buildTableOptions(db)
+	// Explicitly set Compression and DataKey based on how the table was generated.
+	topt.Compression = tf.Compression
+	topt.DataKey = dk
+
+	if tf.Remote {
+		t, err := openRemoteTable(db.opt.RemoteTableStore, fileID, &topt)
+		if err == nil && (topt.ChkMode == options.OnTableRead ||
+			topt.ChkMode == options.OnTableAndBlockRead) {
+			if err = t.VerifyChecksum(); err != nil {
+				_ = t.Close(-1)
+			}
+		}
+		if err != nil {
+			return nil, y.Wrapf(err, "Opening remote table %d", fileID)
+		}
+		return t, nil
+	}
+
+	mf, err := z.OpenMmapFile(fname, db.opt.getFileFlags(), 0)
+	if err != nil {
+		return nil, y.Wrapf(err, "Opening file: %q", fname)
+	}
+	t, err := table.OpenTable(mf, topt)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "CHECKSUM_MISMATCH:") {
+			db.opt.Errorf(err.Error())
+			db.opt.Errorf("Ignoring table %s", mf.Fd.Name())
+			// Do not return the error. We will continue without this table.
+			return nil, nil
+		}
+		return nil, y.Wrapf(err, "Opening table: %q", fname)
+	}
+	return t, nil
+}
+
 func closeAllTables(tables [][]*table.Table) {
 	for _, tableSlice := range tables {
 		for _, table := range tableSlice {
@@ -342,11 +429,39 @@ func (s *levelsController) dropPrefixes(prefixes [][]byte) error {
 }
 
 func (s *levelsController) startCompact(lc *z.Closer) {
-	n := s.kv.opt.NumCompactors
+	s.compactors.Lock()
+	n := s.kv.runtime.Load().NumCompactors
+	s.compactors.lc, s.compactors.running = lc, n
 	lc.AddRunning(n - 1)
 	for i := 0; i < n; i++ {
 		go s.runCompactor(i, lc)
 	}
+	s.compactors.Unlock()
+	// The reaper stops with the compactors, so that it doesn't compact while they are stopped.
+	if s.kv.opt.TTLReaperInterval > 0 {
+		lc.AddRunning(1)
+		go s.reaper.run(lc)
+	}
+	// So do the moves to cold storage, which reserve the tables like compactions.
+	if s.kv.coldStorageTier() != 0 {
+		lc.AddRunning(1)
+		go s.runColdStorage(lc)
+	}
+}
+
+// addCompactors starts compaction workers up to n, if fewer are running.
+func (s *levelsController) addCompactors(n int) {
+	s.compactors.Lock()
+	defer s.compactors.Unlock()
+	lc := s.compactors.lc
+	if lc == nil || lc.Ctx().Err() != nil || n <= s.compactors.running {
+		return
+	}
+	lc.AddRunning(n - s.compactors.running)
+	for i := s.compactors.running; i < n; i++ {
+		go s.runCompactor(i, lc)
+	}
+	s.compactors.running = n
 }
 
 type targets struct {
@@ -456,9 +571,20 @@ func (s *levelsController) runCompactor(id int, lc *z.Closer) {
 	}
 
 	run := func(p compactionPriority) bool {
+		ok, forced := s.kv.qos.allow(p)
+		if !ok {
+			return false
+		}
+		if !s.kv.acquireCompaction(lc) {
+			return false
+		}
 		err := s.doCompact(id, p)
+		s.kv.releaseCompaction()
 		switch err {
 		case nil:
+			if forced {
+				s.kv.qos.forced(p.level)
+			}
 			return true
 		case errFillTables:
 			// pass
@@ -507,6 +633,10 @@ func (s *levelsController) runCompactor(id int, lc *z.Closer) {
 		select {
 		// Can add a done channel or other stuff.
 		case <-ticker.C:
+			if id >= s.kv.runtime.Load().NumCompactors {
+				// Lowered by SetRuntimeOptions.
+				continue
+			}
 			count++
 			// Each ticker is 50ms so 50*200=10seconds.
 			if s.kv.opt.LmaxCompaction && id == 2 && count >= 200 {
@@ -527,6 +657,11 @@ type compactionPriority struct {
 	adjusted     float64
 	dropPrefixes [][]byte
 	t            targets
+	// reapTTL only compacts the tables whose keys with a TTL have all expired. See ttlReaper.
+	reapTTL bool
+	// rekeyBelow, if set, only compacts the tables encrypted with a data key of a lower ID. See
+	// DB.RotateDataKey.
+	rekeyBelow uint64
 }
 
 func (s *levelsController) lastLevel() *levelHandler {
@@ -645,7 +780,7 @@ func (s *levelsController) subcompact(it y.Iterator, kr keyRange, cd compactDef,
 	// Pick a discard ts, so we can discard versions below this ts. We should
 	// never discard any versions starting from above this timestamp, because
 	// that would affect the snapshot view guarantee provided by transactions.
-	discardTs := s.kv.orc.discardAtOrBelow()
+	discardTs := s.kv.versionDiscardTs()
 
 	// Try to collect stats so that we can inform value log about GC. That would help us find which
 	// value log file should be GCed.
@@ -681,16 +816,76 @@ func (s *levelsController) subcompact(it y.Iterator, kr keyRange, cd compactDef,
 	var (
 		lastKey, skipKey       []byte
 		numBuilds, numVersions int
+		// maxVersions is the number of versions of lastKey to keep.
+		maxVersions int
 		// Denotes if the first key is a series of duplicate keys had
 		// "DiscardEarlierVersions" set
 		firstKeyHasDiscardSet bool
+		// merge holds the merge deltas of lastKey no transaction reads anymore, until the value
+		// they merge into is found.
+		merge mergeDeltas
+		// singleDel holds the single delete of lastKey no transaction reads anymore, until it's
+		// known whether the put it deletes is in this compaction.
+		singleDel    y.ValueStruct
+		singleDelKey []byte
+		singleDelHit bool
 	)
 
-	addKeys := func(builder *table.Builder) {
+	addKeys := func(builder *table.Builder, cf *ColumnFamily) {
 		timeStart := time.Now()
 		var numKeys, numSkips uint64
 		var rangeCheck int
 		var tableKr keyRange
+		// addDeltas adds the deltas of merge as they are.
+		addDeltas := func() {
+			for i, key := range merge.keys {
+				var vp valuePointer
+				if merge.vs[i].Meta&bitValuePointer > 0 {
+					vp.Decode(merge.vs[i].Value)
+				}
+				builder.Add(key, merge.vs[i], vp.Len)
+				numKeys++
+			}
+			merge.reset()
+		}
+		// addMerged adds the deltas of merge merged into existing, in place of them.
+		addMerged := func(existing []byte, exists bool) {
+			builder.Add(merge.keys[0], merge.merged(existing, exists), 0)
+			numKeys++
+			for _, vs := range merge.vs {
+				updateStats(vs)
+			}
+			numSkips += uint64(len(merge.keys) - 1)
+			merge.reset()
+		}
+		// endMerge adds the deltas of merge once the versions of their key are over. The value
+		// they merge into may be in a lower level, or in the tables of L0 left out of an L0 to
+		// L0 compaction.
+		endMerge := func() {
+			switch {
+			case len(merge.keys) == 0:
+			case hasOverlap || cd.nextLevel.level == 0:
+				addDeltas()
+			default:
+				addMerged(nil, false)
+			}
+		}
+		defer endMerge()
+		// endSingleDelete keeps the single delete of singleDel once the versions of its key are
+		// over, unless it met the put it deletes: both are dropped then, as no other version of
+		// the key is left below.
+		endSingleDelete := func() {
+			switch {
+			case len(singleDelKey) == 0:
+			case singleDelHit:
+				numSkips++
+			default:
+				builder.AddStaleKey(singleDelKey, singleDel, 0)
+				numKeys++
+			}
+			singleDelKey, singleDelHit = singleDelKey[:0], false
+		}
+		defer endSingleDelete()
 		for ; it.Valid(); it.Next() {
 			// See if we need to skip the prefix.
 			if len(cd.dropPrefixes) > 0 && hasAnyPrefixes(it.Key(), cd.dropPrefixes) {
@@ -704,6 +899,7 @@ func (s *levelsController) subcompact(it y.Iterator, kr keyRange, cd compactDef,
 				if y.SameKey(it.Key(), skipKey) {
 					numSkips++
 					updateStats(it.Value())
+					singleDelHit = len(singleDelKey) > 0
 					continue
 				} else {
 					skipKey = skipKey[:0]
@@ -711,6 +907,8 @@ func (s *levelsController) subcompact(it y.Iterator, kr keyRange, cd compactDef,
 			}
 
 			if !y.SameKey(it.Key(), lastKey) {
+				endMerge()
+				endSingleDelete()
 				firstKeyHasDiscardSet = false
 				if len(kr.right) > 0 && y.CompareKeys(it.Key(), kr.right) >= 0 {
 					break
@@ -721,8 +919,14 @@ func (s *levelsController) subcompact(it y.Iterator, kr keyRange, cd compactDef,
 					// not divided across multiple tables at the same level.
 					break
 				}
+				if s.kv.columnFamilyOf(y.ParseKey(it.Key())) != cf {
+					// The keys of a column family with options of its own go to tables of their
+					// own, built with its options.
+					break
+				}
 				lastKey = y.SafeCopy(lastKey, it.Key())
 				numVersions = 0
+				maxVersions = s.kv.numVersionsToKeep(y.ParseKey(lastKey))
 				firstKeyHasDiscardSet = it.Value().Meta&bitDiscardEarlierVersions > 0
 
 				if len(tableKr.left) == 0 {
@@ -749,8 +953,75 @@ func (s *levelsController) subcompact(it y.Iterator, kr keyRange, cd compactDef,
 
 			isExpired := isDeletedOrExpired(vs.Meta, vs.ExpiresAt)
 
-			// Do not discard entries inserted by merge operator. These entries will be
-			// discarded once they're merged
+			// The entries of the range tombstones removed are deleted.
+			if !isExpired && version <= discardTs &&
+				bytes.HasPrefix(it.Key(), rangeTombstonePrefix) && s.kv.rangeDels.dropped(it.Key()) {
+				vs = y.ValueStruct{Meta: bitDelete}
+				isExpired = true
+			}
+
+			// A version deleted by a range tombstone no transaction reads around anymore is
+			// deleted like any other.
+			if !isExpired && version <= discardTs &&
+				s.kv.rangeDels.covers(y.ParseKey(it.Key()), version, discardTs) {
+				updateStats(vs)
+				vs = y.ValueStruct{Meta: bitDelete}
+				isExpired = true
+			}
+
+			// The chunks of the split values discarded are deleted once no transaction reads
+			// around them.
+			if !isExpired && version <= discardTs && bytes.HasPrefix(it.Key(), splitChunkPrefix) &&
+				!s.kv.splitChunkLive(it.Key()) {
+				updateStats(vs)
+				vs = y.ValueStruct{Meta: bitDelete}
+				isExpired = true
+			}
+
+			// The deltas no transaction reads anymore are merged into a single value, with the
+			// version of the newest of them.
+			if version <= discardTs && vs.Meta&bitMergeEntry > 0 &&
+				s.kv.mergeOps.get(y.ParseKey(it.Key())) != nil {
+				err := merge.add(s.kv, it.Key(), vs)
+				if err == nil {
+					continue
+				}
+				s.kv.opt.Warningf("While reading merge delta of key %q: %v",
+					y.ParseKey(it.Key()), err)
+				addDeltas()
+			} else if len(merge.keys) > 0 {
+				// This version is the value the deltas merge into.
+				var existing []byte
+				var err error
+				if !isExpired {
+					existing, err = s.kv.readValue(vs)
+				}
+				if err == nil {
+					addMerged(existing, !isExpired)
+					numSkips++
+					updateStats(vs)
+					skipKey = y.SafeCopy(skipKey, it.Key())
+					continue
+				}
+				s.kv.opt.Warningf("While reading value of key %q to merge into: %v",
+					y.ParseKey(it.Key()), err)
+				addDeltas()
+			}
+
+			if s.kv.opt.CompactionFilter != nil && version <= discardTs && !isExpired &&
+				vs.Meta&bitMergeEntry == 0 && !bytes.HasPrefix(it.Key(), badgerPrefix) {
+				switch fvs, changed, err := s.kv.filterEntry(it.Key(), vs); {
+				case err != nil:
+					s.kv.opt.Warningf("While reading value of key %q to filter: %v",
+						y.ParseKey(it.Key()), err)
+				case changed:
+					// The value of vs isn't referenced anymore.
+					updateStats(vs)
+					vs = fvs
+					isExpired = isDeletedOrExpired(vs.Meta, vs.ExpiresAt)
+				}
+			}
+
 			if version <= discardTs && vs.Meta&bitMergeEntry == 0 {
 				// Keep track of the number of versions encountered for this key. Only consider the
 				// versions which are below the minReadTs, otherwise, we might end up discarding the
@@ -758,10 +1029,21 @@ func (s *levelsController) subcompact(it y.Iterator, kr keyRange, cd compactDef,
 				numVersions++
 				// Keep the current version and discard all the next versions if
 				// - The `discardEarlierVersions` bit is set OR
-				// - We've already processed `NumVersionsToKeep` number of versions
+				// - We've already processed `maxVersions` number of versions
 				// (including the current item being processed)
+				// With a VersionGC, it decides whether to keep the versions past maxVersions.
+				versionGC := s.kv.opt.VersionGC
 				lastValidVersion := vs.Meta&bitDiscardEarlierVersions > 0 ||
-					numVersions == s.kv.opt.NumVersionsToKeep
+					(numVersions == maxVersions && versionGC == nil)
+
+				if versionGC != nil && !isExpired && !lastValidVersion && numVersions > maxVersions &&
+					!versionGC.Retain(y.ParseKey(it.Key()), version, numVersions) {
+					// Skip this version and the next ones.
+					skipKey = y.SafeCopy(skipKey, it.Key())
+					numSkips++
+					updateStats(vs)
+					continue
+				}
 
 				if isExpired || lastValidVersion {
 					// If this version of the key is deleted or expired, skip all the rest of the
@@ -774,6 +1056,12 @@ func (s *levelsController) subcompact(it y.Iterator, kr keyRange, cd compactDef,
 					case !isExpired && lastValidVersion:
 						// Add this key. We have set skipKey, so the following key versions
 						// would be skipped.
+					case hasOverlap && vs.Meta&bitSingleDelete > 0:
+						// Hold the single delete until the next version of the key, the put
+						// it deletes, is skipped, if it's in this compaction.
+						singleDelKey = y.SafeCopy(singleDelKey, it.Key())
+						singleDel = vs
+						continue
 					case hasOverlap:
 						// If this key range has overlap with lower levels, then keep the deletion
 						// marker with the latest version, discarding the rest. We have set skipKey,
@@ -822,10 +1110,13 @@ func (s *levelsController) subcompact(it y.Iterator, kr keyRange, cd compactDef,
 		bopts := buildTableOptions(s.kv)
 		// Set TableSize to the target file size for that level.
 		bopts.TableSize = uint64(cd.t.fileSz[cd.nextLevel.level])
+		s.kv.dicts.Load().setTableOptions(&bopts, cd.nextLevel.level)
+		cf := s.kv.columnFamilyOf(y.ParseKey(it.Key()))
+		cf.setTableOptions(&bopts)
 		builder := table.NewTableBuilder(bopts)
 
 		// This would do the iteration and add keys to builder.
-		addKeys(builder)
+		addKeys(builder, cf)
 
 		// It was true that it.Valid() at least once in the loop above, which means we
 		// called Add() at least once, and builder is not Empty().
@@ -857,6 +1148,8 @@ func (s *levelsController) subcompact(it y.Iterator, kr keyRange, cd compactDef,
 			if err != nil {
 				return
 			}
+			s.kv.throttleCompaction(tbl.Size())
+			s.kv.rangeDels.setCleanTs(tbl.ID(), discardTs)
 			res <- tbl
 		}(builder, s.reserveFileID())
 	}
@@ -872,8 +1165,8 @@ func (s *levelsController) compactBuildTables(
 	botTables := cd.bot
 
 	numTables := int64(len(topTables) + len(botTables))
-	y.NumCompactionTablesAdd(s.kv.opt.MetricsEnabled, numTables)
-	defer y.NumCompactionTablesAdd(s.kv.opt.MetricsEnabled, -numTables)
+	s.kv.metrics.NumCompactionTablesAdd(numTables)
+	defer s.kv.metrics.NumCompactionTablesAdd(-numTables)
 
 	keepTable := func(t *table.Table) bool {
 		for _, prefix := range cd.dropPrefixes {
@@ -939,6 +1232,9 @@ func (s *levelsController) compactBuildTables(
 	close(res)
 	wg.Wait() // Wait for all tables to be picked up.
 
+	if err == nil && s.kv.opt.ParanoidCompactionChecks {
+		err = checkCompactionOutput(cd, valid, newTables)
+	}
 	if err == nil {
 		// Ensure created files' directory entries are visible.  We don't mind the extra latency
 		// from not doing this ASAP after all file creation has finished because this is a
@@ -963,7 +1259,8 @@ func buildChangeSet(cd *compactDef, newTables []*table.Table) pb.ManifestChangeS
 	changes := []*pb.ManifestChange{}
 	for _, table := range newTables {
 		changes = append(changes,
-			newCreateChange(table.ID(), cd.nextLevel.level, table.KeyID(), table.CompressionType()))
+			newCreateChange(table.ID(), cd.nextLevel.level, table.KeyID(),
+				table.CompressionType(), table.EncryptionAlgo()))
 	}
 	for _, table := range cd.top {
 		// Add a delete change only if the table is not in memory.
@@ -1302,7 +1599,7 @@ func (s *levelsController) fillMaxLevelTables(tables []*table.Table, cd *compact
 	for _, t := range sortedTables {
 		// If the maxVersion is above the discardTs, we won't clean anything in
 		// the compaction. So skip this table.
-		if t.MaxVersion() > s.kv.orc.discardAtOrBelow() {
+		if t.MaxVersion() > s.kv.versionDiscardTs() {
 			continue
 		}
 		if now.Sub(t.CreatedAt) < time.Hour {
@@ -1357,6 +1654,18 @@ func (s *levelsController) fillTables(cd *compactDef) bool {
 
 	tables := make([]*table.Table, len(cd.thisLevel.tables))
 	copy(tables, cd.thisLevel.tables)
+	if cd.p.reapTTL {
+		tables = expiredTables(tables, time.Now(), s.kv.versionDiscardTs())
+		if cd.thisLevel.isLastLevel() {
+			return s.fillSingleMaxLevelTable(tables, cd)
+		}
+	}
+	if cd.p.rekeyBelow > 0 {
+		tables = tablesKeyedBelow(tables, cd.p.rekeyBelow)
+		if cd.thisLevel.isLastLevel() {
+			return s.fillSingleMaxLevelTable(tables, cd)
+		}
+	}
 	if len(tables) == 0 {
 		return false
 	}
@@ -1440,6 +1749,9 @@ func (s *levelsController) runCompactDef(id, l int, cd compactDef) (err error) {
 	if err := s.kv.manifest.addChanges(changeSet.Changes, s.kv.opt); err != nil {
 		return err
 	}
+	if err := failpoint.Inject(failpoint.CompactionAfterManifest); err != nil {
+		return err
+	}
 
 	getSizes := func(tables []*table.Table) int64 {
 		size := int64(0)
@@ -1454,7 +1766,7 @@ func (s *levelsController) runCompactDef(id, l int, cd compactDef) (err error) {
 	if s.kv.opt.MetricsEnabled {
 		sizeNewTables = getSizes(newTables)
 		sizeOldTables = getSizes(cd.bot) + getSizes(cd.top)
-		y.NumBytesCompactionWrittenAdd(s.kv.opt.MetricsEnabled, nextLevel.strLevel, sizeNewTables)
+		s.kv.metrics.NumBytesCompactionWrittenAdd(nextLevel.strLevel, sizeNewTables)
 	}
 
 	// See comment earlier in this function about the ordering of these ops, and the order in which
@@ -1462,9 +1774,14 @@ func (s *levelsController) runCompactDef(id, l int, cd compactDef) (err error) {
 	if err := nextLevel.replaceTables(cd.bot, newTables); err != nil {
 		return err
 	}
+	if err := failpoint.Inject(failpoint.CompactionAfterReplace); err != nil {
+		return err
+	}
 	if err := thisLevel.deleteTables(cd.top); err != nil {
 		return err
 	}
+	s.kv.rangeDels.dropTables(cd.top, cd.bot)
+	s.kv.collectRangeTombstones()
 
 	// Note: For level 0, while doCompact is running, it is possible that new tables are added.
 	// However, the tables are added only to the end, so it is ok to just delete the first table.
@@ -1542,17 +1859,20 @@ func (s *levelsController) doCompact(id int, p compactionPriority) error {
 	defer s.cstatus.delete(cd) // Remove the ranges from compaction status.
 
 	span.SetAttributes(attribute.String("Compaction", fmt.Sprintf("%+v", cd)))
+	start := time.Now()
 	if err := s.runCompactDef(id, l, cd); err != nil {
 		// This compaction couldn't be done successfully.
 		s.kv.opt.Warningf("[Compactor: %d] LOG Compact FAILED with error: %+v: %+v", id, err, cd)
 		return err
 	}
+	s.kv.metrics.LatencyObserve(y.LatencyCompaction, time.Since(start))
 
 	span.SetAttributes(
 		attribute.Int("Top tables count", len(cd.top)),
 		attribute.Int("Bottom tables count", len(cd.bot)))
 
 	s.kv.opt.Debugf("[Compactor: %d] Compaction for level: %d DONE", id, cd.thisLevel.level)
+	s.kv.events.record(EventCompaction, int64(cd.thisLevel.level), nil)
 	return nil
 }
 
@@ -1565,7 +1885,8 @@ func (s *levelsController) addLevel0Table(t *table.Table) error {
 		// the proper order. (That means this update happens before that of some compaction which
 		// deletes the table.)
 		err := s.kv.manifest.addChanges([]*pb.ManifestChange{
-			newCreateChange(t.ID(), 0, t.KeyID(), t.CompressionType()),
+			newCreateChange(t.ID(), 0, t.KeyID(), t.CompressionType(),
+				t.EncryptionAlgo()),
 		}, s.kv.opt)
 		if err != nil {
 			return err
@@ -1574,15 +1895,16 @@ func (s *levelsController) addLevel0Table(t *table.Table) error {
 
 	for !s.levels[0].tryAddLevel0Table(t) {
 		// Before we uninstall, we need to make sure that level 0 is healthy.
-		timeStart := time.Now()
+		timeStart := s.l0stall.start()
 		for s.levels[0].numTables() >= s.kv.opt.NumLevelZeroTablesStall {
 			time.Sleep(10 * time.Millisecond)
 		}
-		dur := time.Since(timeStart)
+		dur := s.l0stall.done(timeStart)
 		if dur > time.Second {
 			s.kv.opt.Infof("L0 was stalled for %s\n", dur.Round(time.Millisecond))
 		}
 		s.l0stallsMs.Add(int64(dur.Round(time.Millisecond)))
+		s.kv.events.record(EventStall, dur.Milliseconds(), nil)
 	}
 
 	return nil
@@ -1619,7 +1941,7 @@ func (s *levelsController) get(key []byte, maxVs y.ValueStruct, startLevel int)
 		if vs.Value == nil && vs.Meta == 0 {
 			continue
 		}
-		y.NumBytesReadsLSMAdd(s.kv.opt.MetricsEnabled, int64(len(vs.Value)))
+		s.kv.metrics.NumBytesReadsLSMAdd(int64(len(vs.Value)))
 		if vs.Version == version {
 			return vs, nil
 		}
@@ -1628,7 +1950,7 @@ func (s *levelsController) get(key []byte, maxVs y.ValueStruct, startLevel int)
 		}
 	}
 	if len(maxVs.Value) > 0 {
-		y.NumGetsWithResultsAdd(s.kv.opt.MetricsEnabled, 1)
+		s.kv.metrics.NumGetsWithResultsAdd(1)
 	}
 	return maxVs, nil
 }
@@ -1666,6 +1988,8 @@ type TableInfo struct {
 	MaxVersion       uint64
 	IndexSz          int
 	BloomFilterSize  int
+	Cold             bool // Whether the table is in Options.ColdStorageDir
+	Remote           bool // Whether the table is in Options.RemoteTableStore
 }
 
 func (s *levelsController) getTableInfo() (result []TableInfo) {
@@ -1684,6 +2008,8 @@ func (s *levelsController) getTableInfo() (result []TableInfo) {
 				BloomFilterSize:  t.BloomFilterSize(),
 				UncompressedSize: t.UncompressedSize(),
 				MaxVersion:       t.MaxVersion(),
+				Cold:             s.kv.isColdTable(t),
+				Remote:           s.kv.isRemoteTable(t),
 			}
 			result = append(result, info)
 		}
@@ -44,7 +44,7 @@ func createAndOpen(db *DB, td []keyValVersion, level int) {
 		panic(err)
 	}
 	if err := db.manifest.addChanges([]*pb.ManifestChange{
-		newCreateChange(tab.ID(), level, 0, tab.CompressionType()),
+		newCreateChange(tab.ID(), level, 0, tab.CompressionType(), pb.EncryptionAlgo_aes),
 	}, db.opt); err != nil {
 		panic(err)
 	}
@@ -1192,7 +1192,8 @@ func TestFillTableCleanup(t *testing.T) {
 			for i := byte(1); i < byte(num_tab); i++ {
 				tab := buildTable(i)
 				require.NoError(t, db.manifest.addChanges([]*pb.ManifestChange{
-					newCreateChange(tab.ID(), level, 0, tab.CompressionType()),
+					newCreateChange(tab.ID(), level, 0, tab.CompressionType(),
+						pb.EncryptionAlgo_aes),
 				}, db.opt))
 				tab.CreatedAt = time.Now().Add(-10 * time.Hour)
 				// Add table to the given level.
@@ -1269,7 +1270,8 @@ func TestStaleDataCleanup(t *testing.T) {
 		for i := byte(1); i < 5; i++ {
 			tab := buildStaleTable(i)
 			require.NoError(t, db.manifest.addChanges([]*pb.ManifestChange{
-				newCreateChange(tab.ID(), level, 0, tab.CompressionType()),
+				newCreateChange(tab.ID(), level, 0, tab.CompressionType(),
+					pb.EncryptionAlgo_aes),
 			}, db.opt))
 			tab.CreatedAt = time.Now().Add(-10 * time.Hour)
 			// Add table to the given level.
@@ -1290,3 +1292,90 @@ func TestStaleDataCleanup(t *testing.T) {
 
 	})
 }
+
+func TestParanoidCompactionChecks(t *testing.T) {
+	opt := DefaultOptions("").WithNumCompactors(0).WithNumVersionsToKeep(1).
+		WithParanoidCompactionChecks(true)
+	opt.managedTxns = true
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		createAndOpen(db, []keyValVersion{{"foo", "bar", 3, 0}, {"fooz", "baz", 1, 0}}, 0)
+		createAndOpen(db, []keyValVersion{{"foo", "bar", 1, 0}}, 1)
+		db.SetDiscardTs(10)
+		cdef := compactDef{
+			thisLevel: db.lc.levels[0],
+			nextLevel: db.lc.levels[1],
+			top:       db.lc.levels[0].tables,
+			bot:       db.lc.levels[1].tables,
+			t:         db.lc.levelTargets(),
+		}
+		cdef.t.baseLevel = 1
+		require.NoError(t, db.lc.runCompactDef(-1, 0, cdef))
+		getAllAndCheck(t, db, []keyValVersion{{"foo", "bar", 3, 0}, {"fooz", "baz", 1, 0}})
+
+		// The output of a compaction must come from its input.
+		in := db.lc.levels[1].tables
+		createAndOpen(db, []keyValVersion{{"foo", "bar", 3, 0}, {"fooz", "baz", 1, 0}}, 2)
+		createAndOpen(db, []keyValVersion{{"foo", "bar", 3, 0}, {"other", "baz", 1, 0}}, 3)
+		cdef = compactDef{nextLevel: db.lc.levels[2]}
+		require.NoError(t, checkCompactionOutput(cdef, in, db.lc.levels[2].tables))
+		err := checkCompactionOutput(cdef, in, db.lc.levels[3].tables)
+		require.ErrorIs(t, err, ErrCompactionCheck)
+		require.Contains(t, err.Error(), "isn't in the input tables")
+
+		// Overlapping tables.
+		out := append(db.lc.levels[2].tables, db.lc.levels[2].tables...)
+		require.ErrorIs(t, checkCompactionOutput(cdef, append(in, in...), out), ErrCompactionCheck)
+
+		// A corrupt table.
+		tbl := db.lc.levels[2].tables[0]
+		tbl.Data[10]++
+		require.ErrorIs(t, checkCompactionOutput(cdef, in, db.lc.levels[2].tables),
+			ErrCompactionCheck)
+		tbl.Data[10]--
+	})
+}
+
+func TestCompactionSingleDelete(t *testing.T) {
+	opt := DefaultOptions("").WithNumCompactors(0).WithNumVersionsToKeep(1)
+	opt.managedTxns = true
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		sd := bitDelete | bitSingleDelete
+		// The single delete of foo meets its put in the compaction, the one of fooz doesn't.
+		l1 := []keyValVersion{{"foo", "", 3, sd}, {"fooz", "", 3, sd}}
+		l2 := []keyValVersion{{"foo", "bar", 2, 0}}
+		l3 := []keyValVersion{{"fooz", "baz", 2, 0}}
+		createAndOpen(db, l1, 1)
+		createAndOpen(db, l2, 2)
+		createAndOpen(db, l3, 3)
+		db.SetDiscardTs(10)
+
+		cdef := compactDef{
+			thisLevel: db.lc.levels[1],
+			nextLevel: db.lc.levels[2],
+			top:       db.lc.levels[1].tables,
+			bot:       db.lc.levels[2].tables,
+			t:         db.lc.levelTargets(),
+		}
+		cdef.t.baseLevel = 2
+		require.NoError(t, db.lc.runCompactDef(-1, 1, cdef))
+		// A plain delete of foo would have been kept, as L3 overlaps the compaction.
+		getAllAndCheck(t, db, []keyValVersion{
+			{"fooz", "", 3, sd},
+			{"fooz", "baz", 2, 0},
+		})
+	})
+
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Set([]byte("key"), []byte("val"))
+		}))
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.SingleDelete([]byte("key"))
+		}))
+		require.NoError(t, db.View(func(txn *Txn) error {
+			_, err := txn.Get([]byte("key"))
+			require.ErrorIs(t, err, ErrKeyNotFound)
+			return nil
+		}))
+	})
+}
@@ -0,0 +1,424 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+
+	"github.com/luxfi/zapdb/pb"
+	"github.com/luxfi/zapdb/y"
+)
+
+// lifecycleClockPrefix starts the keys of the marks of the lifecycle clock. It is followed by the
+// time of the mark, in nanoseconds since the epoch, big endian. The version of a mark is the
+// commit timestamp of its time, so that the age of a key is told by its version.
+var lifecycleClockPrefix = []byte("!badger!lifecycle")
+
+// lifecycleBatchSize is the number of keys deleted by a transaction of the lifecycle job.
+const lifecycleBatchSize = 1000
+
+// LifecyclePolicy is the lifecycle of the keys with a prefix. See DB.SetLifecyclePolicy.
+type LifecyclePolicy struct {
+	// Prefix is the prefix of the keys of the policy. The policy of the longest prefix of a key
+	// applies to it.
+	Prefix []byte `json:"prefix"`
+	// TTL is the TTL of the entries set without an expiry. Zero means they don't expire.
+	TTL time.Duration `json:"ttl,omitempty"`
+	// MaxVersions is the number of versions of the keys kept by compactions, in place of
+	// Options.NumVersionsToKeep. Zero means Options.NumVersionsToKeep.
+	MaxVersions int `json:"max_versions,omitempty"`
+	// ArchiveAfter, if set, archives the keys not written for that long to
+	// Options.LifecycleArchive.
+	ArchiveAfter time.Duration `json:"archive_after,omitempty"`
+	// DeleteAfter, if set, deletes the keys not written for that long, once they are archived if
+	// ArchiveAfter is set.
+	DeleteAfter time.Duration `json:"delete_after,omitempty"`
+}
+
+// lifecyclePolicy is a LifecyclePolicy, as persisted in the manifest.
+type lifecyclePolicy struct {
+	LifecyclePolicy
+	// ArchivedTs is the version up to which the keys of the policy are archived.
+	ArchivedTs uint64 `json:"archived_ts,omitempty"`
+}
+
+// lifecyclePolicies are the lifecycle policies of a DB, the longest prefixes first. They are
+// replaced as a whole, and never modified.
+type lifecyclePolicies []*lifecyclePolicy
+
+// decodeLifecyclePolicies decodes the policies persisted in the manifest.
+func decodeLifecyclePolicies(data []byte) (*lifecyclePolicies, error) {
+	policies := lifecyclePolicies{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &policies); err != nil {
+			return nil, y.Wrapf(err, "While decoding lifecycle policies")
+		}
+	}
+	return &policies, nil
+}
+
+// get returns the policy of key, or nil if there is none.
+func (lp *lifecyclePolicies) get(key []byte) *lifecyclePolicy {
+	if lp == nil || bytes.HasPrefix(key, badgerPrefix) {
+		return nil
+	}
+	for _, p := range *lp {
+		if bytes.HasPrefix(key, p.Prefix) {
+			return p
+		}
+	}
+	return nil
+}
+
+// setTTL returns e set to expire after the TTL of its policy, or e itself if it expires already,
+// or has no policy with a TTL.
+func (lp *lifecyclePolicies) setTTL(e *Entry) *Entry {
+	if lp == nil || len(*lp) == 0 || e.ExpiresAt != 0 || e.meta&(bitDelete|bitMergeEntry) > 0 {
+		return e
+	}
+	p := lp.get(e.Key)
+	if p == nil || p.TTL == 0 {
+		return e
+	}
+	ne := *e
+	ne.WithTTL(p.TTL)
+	return &ne
+}
+
+// numVersionsToKeep returns the number of versions of key, without timestamp, kept by
+// compactions.
+func (db *DB) numVersionsToKeep(key []byte) int {
+	if p := db.lifecycle.Load().get(key); p != nil && p.MaxVersions > 0 {
+		return p.MaxVersions
+	}
+	return db.opt.NumVersionsToKeep
+}
+
+// SetLifecyclePolicy sets the lifecycle policy of the keys with p.Prefix, replacing the one set
+// before for the prefix, if any. The policies are persisted in the manifest.
+//
+// The TTL of a policy applies to the entries set from now on, and its MaxVersions to the versions
+// compacted from now on. Its keys are archived and deleted every Options.LifecycleInterval, once
+// they were not written for ArchiveAfter and DeleteAfter. The age of a key is told by the DB from
+// its version, to the precision of the interval, so that these policies can't be used in managed
+// mode.
+func (db *DB) SetLifecyclePolicy(p LifecyclePolicy) error {
+	switch {
+	case db.opt.ReadOnly:
+		return errors.New("Cannot set a lifecycle policy in a DB opened in ReadOnly mode")
+	case bytes.HasPrefix(p.Prefix, badgerPrefix):
+		return fmt.Errorf("Lifecycle policy prefix %q is internal", p.Prefix)
+	case p.TTL < 0 || p.MaxVersions < 0 || p.ArchiveAfter < 0 || p.DeleteAfter < 0:
+		return fmt.Errorf("Invalid lifecycle policy of prefix %q", p.Prefix)
+	case (p.ArchiveAfter > 0 || p.DeleteAfter > 0) && db.opt.managedTxns:
+		return errors.New("Lifecycle policies can't archive or delete keys in managed mode")
+	case p.ArchiveAfter > 0 && db.opt.LifecycleArchive == nil:
+		return errors.New("Lifecycle policies can't archive keys without Options.LifecycleArchive")
+	}
+	p.Prefix = y.SafeCopy(nil, p.Prefix)
+	return db.updateLifecycle(p.Prefix, func(old *lifecyclePolicy) *lifecyclePolicy {
+		np := &lifecyclePolicy{LifecyclePolicy: p}
+		if old != nil {
+			np.ArchivedTs = old.ArchivedTs
+		}
+		return np
+	})
+}
+
+// DeleteLifecyclePolicy deletes the lifecycle policy of prefix, if any.
+func (db *DB) DeleteLifecyclePolicy(prefix []byte) error {
+	if db.opt.ReadOnly {
+		return errors.New("Cannot delete a lifecycle policy in a DB opened in ReadOnly mode")
+	}
+	return db.updateLifecycle(prefix, func(*lifecyclePolicy) *lifecyclePolicy { return nil })
+}
+
+// LifecyclePolicies returns the lifecycle policies, by prefix.
+func (db *DB) LifecyclePolicies() []LifecyclePolicy {
+	var out []LifecyclePolicy
+	for _, p := range *db.lifecycle.Load() {
+		lp := p.LifecyclePolicy
+		lp.Prefix = y.SafeCopy(nil, lp.Prefix)
+		out = append(out, lp)
+	}
+	sort.Slice(out, func(i, j int) bool { return bytes.Compare(out[i].Prefix, out[j].Prefix) < 0 })
+	return out
+}
+
+// updateLifecycle replaces the policy of prefix, or nil if there is none, with the one update
+// returns, or deletes it if it returns nil, and persists the policies in the manifest.
+func (db *DB) updateLifecycle(prefix []byte,
+	update func(old *lifecyclePolicy) *lifecyclePolicy) error {
+	db.lifecycleLock.Lock()
+	defer db.lifecycleLock.Unlock()
+	var old *lifecyclePolicy
+	policies := lifecyclePolicies{}
+	for _, p := range *db.lifecycle.Load() {
+		if bytes.Equal(p.Prefix, prefix) {
+			old = p
+		} else {
+			policies = append(policies, p)
+		}
+	}
+	np := update(old)
+	if np == old {
+		return nil
+	}
+	if np != nil {
+		policies = append(policies, np)
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		if a, b := policies[i].Prefix, policies[j].Prefix; len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		return bytes.Compare(policies[i].Prefix, policies[j].Prefix) < 0
+	})
+	data, err := json.Marshal(policies)
+	if err != nil {
+		return err
+	}
+	change := newLifecycleChange(data)
+	if err := db.manifest.addChanges([]*pb.ManifestChange{change}, db.opt); err != nil {
+		return y.Wrapf(err, "While adding lifecycle policies to manifest")
+	}
+	db.lifecycle.Store(&policies)
+	return nil
+}
+
+// lifecycleJob archives and deletes the keys of the lifecycle policies.
+type lifecycleJob struct {
+	db *DB
+}
+
+// run evaluates the policies every LifecycleInterval, until lc is closed.
+func (j *lifecycleJob) run(lc *z.Closer) {
+	defer lc.Done()
+	ticker := time.NewTicker(j.db.opt.LifecycleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lc.HasBeenClosed():
+			return
+		case <-ticker.C:
+		}
+		if err := j.evaluate(lc.Ctx(), time.Now()); err != nil {
+			j.db.opt.Warningf("While evaluating lifecycle policies: %v", err)
+		}
+	}
+}
+
+// evaluate marks the lifecycle clock at now, and archives and deletes the keys of the policies
+// old enough by then.
+func (j *lifecycleJob) evaluate(ctx context.Context, now time.Time) error {
+	policies := j.db.lifecycle.Load()
+	var maxAge time.Duration
+	for _, p := range *policies {
+		maxAge = max(maxAge, p.ArchiveAfter, p.DeleteAfter)
+	}
+	if maxAge == 0 {
+		return nil
+	}
+	if err := j.tick(now, maxAge); err != nil {
+		return y.Wrapf(err, "While marking lifecycle clock")
+	}
+
+	for _, p := range *policies {
+		archivedTs := p.ArchivedTs
+		if p.ArchiveAfter > 0 {
+			ts, err := j.versionAt(now.Add(-p.ArchiveAfter))
+			if err != nil {
+				return err
+			}
+			if ts > archivedTs {
+				if err := j.archive(ctx, policies, p, ts); err != nil {
+					return y.Wrapf(err, "While archiving keys of prefix %q", p.Prefix)
+				}
+				archivedTs = ts
+			}
+		}
+		if p.DeleteAfter > 0 {
+			ts, err := j.versionAt(now.Add(-p.DeleteAfter))
+			if err != nil {
+				return err
+			}
+			if p.ArchiveAfter > 0 {
+				ts = min(ts, archivedTs)
+			}
+			if err := j.delete(policies, p, ts); err != nil {
+				return y.Wrapf(err, "While deleting keys of prefix %q", p.Prefix)
+			}
+		}
+	}
+	return nil
+}
+
+func lifecycleClockKey(t time.Time) []byte {
+	return binary.BigEndian.AppendUint64(y.SafeCopy(nil, lifecycleClockPrefix),
+		uint64(t.UnixNano()))
+}
+
+// tick marks the lifecycle clock at now, and deletes the marks older than maxAge but the latest
+// of them, which tells the versions of that age.
+func (j *lifecycleJob) tick(now time.Time, maxAge time.Duration) error {
+	return j.db.Update(func(txn *Txn) error {
+		opt := DefaultIteratorOptions
+		opt.Prefix = lifecycleClockPrefix
+		opt.PrefetchValues = false
+		opt.InternalAccess = true
+		it := txn.NewIterator(opt)
+		var old [][]byte
+		oldest := lifecycleClockKey(now.Add(-maxAge))
+		for it.Rewind(); it.Valid() && bytes.Compare(it.Item().Key(), oldest) <= 0; it.Next() {
+			old = append(old, it.Item().KeyCopy(nil))
+		}
+		it.Close()
+		for i := 0; i < len(old)-1; i++ {
+			if err := txn.modifyKey(&Entry{Key: old[i], meta: bitDelete}, true); err != nil {
+				return err
+			}
+		}
+		return txn.modifyKey(&Entry{Key: lifecycleClockKey(now)}, true)
+	})
+}
+
+// versionAt returns the commit timestamp of the DB as of the latest mark of the lifecycle clock
+// at t or before, so that the versions up to it were written by t. It returns zero if there is
+// no such mark.
+func (j *lifecycleJob) versionAt(t time.Time) (uint64, error) {
+	var ts uint64
+	err := j.db.View(func(txn *Txn) error {
+		opt := DefaultIteratorOptions
+		opt.Prefix = lifecycleClockPrefix
+		opt.PrefetchValues = false
+		opt.Reverse = true
+		opt.InternalAccess = true
+		it := txn.NewIterator(opt)
+		defer it.Close()
+		if it.Seek(lifecycleClockKey(t)); it.Valid() {
+			ts = it.Item().Version()
+		}
+		return nil
+	})
+	return ts, err
+}
+
+// archive writes the keys of p last written after p.ArchivedTs, and up to ts, to
+// Options.LifecycleArchive, as a backup named after the prefix and ts.
+func (j *lifecycleJob) archive(ctx context.Context, policies *lifecyclePolicies,
+	p *lifecyclePolicy, ts uint64) error {
+	db := j.db
+	var buf bytes.Buffer
+	list := &pb.KVList{}
+	flush := func() error {
+		if len(list.Kv) == 0 {
+			return nil
+		}
+		err := writeTo(list, &buf)
+		list.Kv = list.Kv[:0]
+		return err
+	}
+	var n int
+	err := db.View(func(txn *Txn) error {
+		opt := DefaultIteratorOptions
+		opt.Prefix = p.Prefix
+		it := txn.NewIterator(opt)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			if v := item.Version(); v <= p.ArchivedTs || v > ts || policies.get(item.Key()) != p {
+				continue
+			}
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			list.Kv = append(list.Kv, &pb.KV{
+				Key:       item.KeyCopy(nil),
+				Value:     val,
+				UserMeta:  []byte{item.UserMeta()},
+				Version:   item.Version(),
+				ExpiresAt: item.ExpiresAt(),
+			})
+			n++
+			if len(list.Kv) == lifecycleBatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		return flush()
+	})
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		name := fmt.Sprintf("lifecycle-%x/%020d", p.Prefix, ts)
+		if err := db.opt.LifecycleArchive.Put(ctx, name, &buf, int64(buf.Len())); err != nil {
+			return err
+		}
+		db.opt.Infof("Archived %d keys of prefix %q to %s", n, p.Prefix, name)
+	}
+	return db.updateLifecycle(p.Prefix, func(old *lifecyclePolicy) *lifecyclePolicy {
+		if old == nil {
+			return nil
+		}
+		np := *old
+		np.ArchivedTs = max(np.ArchivedTs, ts)
+		return &np
+	})
+}
+
+// delete deletes the keys of p last written up to ts. The keys written meanwhile are kept, as
+// the transactions deleting them conflict.
+func (j *lifecycleJob) delete(policies *lifecyclePolicies, p *lifecyclePolicy, ts uint64) error {
+	if ts == 0 {
+		return nil
+	}
+	db := j.db
+	var n int
+	seek := p.Prefix
+	for more := true; more; {
+		err := db.Update(func(txn *Txn) error {
+			opt := DefaultIteratorOptions
+			opt.Prefix = p.Prefix
+			opt.PrefetchValues = false
+			it := txn.NewIterator(opt)
+			var keys [][]byte
+			for it.Seek(seek); it.Valid() && len(keys) < lifecycleBatchSize; it.Next() {
+				item := it.Item()
+				if item.Version() <= ts && policies.get(item.Key()) == p {
+					keys = append(keys, item.KeyCopy(nil))
+				}
+				seek = append(item.KeyCopy(seek[:0:0]), 0)
+			}
+			more = it.Valid()
+			it.Close()
+			for _, key := range keys {
+				if err := txn.Delete(key); err != nil {
+					return err
+				}
+			}
+			n += len(keys)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if n > 0 {
+		db.opt.Infof("Deleted %d keys of prefix %q", n, p.Prefix)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/objstore"
+)
+
+func TestLifecyclePolicy(t *testing.T) {
+	dir, err := os.MkdirTemp("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+	ctx := context.Background()
+	archive := objstore.NewMemory()
+	// Close compacts L0. The lifecycle job is run by hand.
+	opts := getTestOptions(dir).
+		WithCompactL0OnClose(true).
+		WithLifecycleArchive(archive).
+		WithLifecycleInterval(0)
+
+	set := func(db *DB, key string) {
+		require.NoError(t, db.Update(func(txn *Txn) error { return txn.Set([]byte(key), []byte(key)) }))
+	}
+	versions := func(db *DB, key string) (n int) {
+		require.NoError(t, db.View(func(txn *Txn) error {
+			iopt := DefaultIteratorOptions
+			iopt.AllVersions = true
+			iopt.Prefix = []byte(key)
+			it := txn.NewIterator(iopt)
+			defer it.Close()
+			for it.Rewind(); it.Valid(); it.Next() {
+				n++
+			}
+			return nil
+		}))
+		return n
+	}
+	exists := func(db *DB, key string) bool {
+		err := db.View(func(txn *Txn) error {
+			_, err := txn.Get([]byte(key))
+			return err
+		})
+		if err == ErrKeyNotFound {
+			return false
+		}
+		require.NoError(t, err)
+		return true
+	}
+	archived := func() (keys []string) {
+		names, err := archive.List(ctx, "")
+		require.NoError(t, err)
+		db, err := Open(DefaultOptions("").WithInMemory(true).WithLogger(nil))
+		require.NoError(t, err)
+		defer func() { require.NoError(t, db.Close()) }()
+		for _, name := range names {
+			rc, err := archive.Get(ctx, name)
+			require.NoError(t, err)
+			require.NoError(t, db.Load(rc, 16))
+			require.NoError(t, rc.Close())
+		}
+		require.NoError(t, db.View(func(txn *Txn) error {
+			it := txn.NewIterator(DefaultIteratorOptions)
+			defer it.Close()
+			for it.Rewind(); it.Valid(); it.Next() {
+				keys = append(keys, string(it.Item().Key()))
+			}
+			return nil
+		}))
+		return keys
+	}
+
+	db, err := Open(opts)
+	require.NoError(t, err)
+	require.Error(t, db.SetLifecyclePolicy(LifecyclePolicy{Prefix: []byte("!badger!x")}))
+	require.Error(t, db.SetLifecyclePolicy(LifecyclePolicy{Prefix: []byte("tmp/"), TTL: -1}))
+	for _, p := range []LifecyclePolicy{
+		{Prefix: []byte("tmp/"), TTL: time.Hour},
+		{Prefix: []byte("hist/"), MaxVersions: 3},
+		{Prefix: []byte("logs/"), ArchiveAfter: time.Hour, DeleteAfter: 2 * time.Hour},
+		{Prefix: []byte("logs/keep/")},
+	} {
+		require.NoError(t, db.SetLifecyclePolicy(p))
+	}
+
+	set(db, "tmp/a")
+	require.NoError(t, db.View(func(txn *Txn) error {
+		item, err := txn.Get([]byte("tmp/a"))
+		require.NoError(t, err)
+		require.InDelta(t, time.Now().Add(time.Hour).Unix(), int64(item.ExpiresAt()), 5)
+		return nil
+	}))
+	for range 5 {
+		set(db, "hist/a")
+		set(db, "other/a")
+	}
+	set(db, "logs/a")
+	set(db, "logs/b")
+	set(db, "logs/keep/a")
+
+	// The keys written before a mark of the clock are as old as the mark.
+	job := &lifecycleJob{db: db}
+	now := time.Now()
+	require.NoError(t, job.evaluate(ctx, now))
+	set(db, "logs/c")
+	require.NoError(t, job.evaluate(ctx, now.Add(90*time.Minute)))
+	require.Equal(t, []string{"logs/a", "logs/b"}, archived())
+	require.True(t, exists(db, "logs/a"))
+
+	require.NoError(t, job.evaluate(ctx, now.Add(150*time.Minute)))
+	require.Equal(t, []string{"logs/a", "logs/b", "logs/c"}, archived())
+	require.False(t, exists(db, "logs/a"))
+	require.False(t, exists(db, "logs/b"))
+	require.True(t, exists(db, "logs/c"))
+	require.True(t, exists(db, "logs/keep/a"))
+	require.NoError(t, db.Close())
+
+	// The policies are persisted, and compactions keep MaxVersions versions of their keys.
+	db, err = Open(opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	require.Len(t, db.LifecyclePolicies(), 4)
+	require.NotZero(t, db.lifecycle.Load().get([]byte("logs/c")).ArchivedTs)
+	require.Equal(t, 3, versions(db, "hist/a"))
+	require.Equal(t, 1, versions(db, "other/a"))
+
+	require.NoError(t, db.DeleteLifecyclePolicy([]byte("tmp/")))
+	require.Len(t, db.LifecyclePolicies(), 3)
+	require.Equal(t, []byte("hist/"), db.LifecyclePolicies()[0].Prefix)
+}
@@ -0,0 +1,246 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+)
+
+// MaintenanceJob is a background job which Options.MaintenanceWindows schedule.
+type MaintenanceJob string
+
+// The jobs of the maintenance windows.
+const (
+	// MaintenanceValueLogGC is the value log GC of Options.ValueLogGCPolicy.
+	MaintenanceValueLogGC MaintenanceJob = "vlog_gc"
+	// MaintenanceTTLReap is the compaction of the tables of expired keys of
+	// Options.TTLReaperInterval.
+	MaintenanceTTLReap MaintenanceJob = "ttl_reap"
+	// MaintenanceFlatten is DB.Flatten, with one worker.
+	MaintenanceFlatten MaintenanceJob = "flatten"
+	// MaintenanceScrub is DB.VerifyChecksum, which reads all the tables to check them.
+	MaintenanceScrub MaintenanceJob = "scrub"
+)
+
+var maintenanceJobs = []MaintenanceJob{MaintenanceValueLogGC, MaintenanceTTLReap,
+	MaintenanceFlatten, MaintenanceScrub}
+
+// MaintenanceWindow is a recurring window of time for the background jobs, see
+// Options.MaintenanceWindows.
+type MaintenanceWindow struct {
+	// Cron is when the window starts, as the five fields of a cron spec: minute, hour, day of
+	// the month, month and day of the week, each either *, a number, a range a-b, or a list of
+	// them separated by commas, optionally followed by a step /n. The days match like in cron:
+	// either one matches when neither is *.
+	Cron string
+	// Duration is how long the window lasts. Zero only triggers the jobs at the start.
+	Duration time.Duration
+	// Jobs are run at the start of the window, and the periodic runs of MaintenanceValueLogGC
+	// and MaintenanceTTLReap are restricted to the windows listing them.
+	Jobs []MaintenanceJob
+	// Location is the time zone of Cron. Nil is UTC.
+	Location *time.Location
+}
+
+// cronSpec is a parsed cron spec. Each field is the bitset of the values it matches.
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+	// anyDay is set if either day field is *, in which case both must match.
+	anyDay bool
+}
+
+// cronFields are the ranges of the fields of a cron spec.
+var cronFields = [5]struct{ min, max int }{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+func parseCron(spec string) (cronSpec, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return cronSpec{}, fmt.Errorf("cron spec %q must have %d fields", spec, len(cronFields))
+	}
+	var bits [5]uint64
+	for i, f := range fields {
+		for _, part := range strings.Split(f, ",") {
+			lo, hi, step := cronFields[i].min, cronFields[i].max, 1
+			rng := part
+			if r, s, ok := strings.Cut(part, "/"); ok {
+				n, err := strconv.Atoi(s)
+				if err != nil || n <= 0 {
+					return cronSpec{}, fmt.Errorf("invalid step in cron spec %q", spec)
+				}
+				rng, step = r, n
+			}
+			if rng != "*" {
+				a, b, isRange := strings.Cut(rng, "-")
+				var err error
+				if lo, err = strconv.Atoi(a); err != nil {
+					return cronSpec{}, fmt.Errorf("invalid field %q in cron spec %q", f, spec)
+				}
+				hi = lo
+				if isRange {
+					if hi, err = strconv.Atoi(b); err != nil {
+						return cronSpec{}, fmt.Errorf("invalid field %q in cron spec %q", f, spec)
+					}
+				} else if step > 1 {
+					hi = cronFields[i].max
+				}
+			}
+			if lo < cronFields[i].min || hi > cronFields[i].max || lo > hi {
+				return cronSpec{}, fmt.Errorf("field %q out of range in cron spec %q", f, spec)
+			}
+			for v := lo; v <= hi; v += step {
+				bits[i] |= 1 << v
+			}
+		}
+	}
+	return cronSpec{
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		anyDay: fields[2] == "*" || fields[4] == "*",
+	}, nil
+}
+
+// matches tells if the minute of t matches the spec.
+func (c cronSpec) matches(t time.Time) bool {
+	has := func(bits uint64, v int) bool { return bits&(1<<v) != 0 }
+	if !has(c.minute, t.Minute()) || !has(c.hour, t.Hour()) || !has(c.month, int(t.Month())) {
+		return false
+	}
+	dom, dow := has(c.dom, t.Day()), has(c.dow, int(t.Weekday()))
+	if c.anyDay {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// maintenanceWindow is a MaintenanceWindow with its spec parsed.
+type maintenanceWindow struct {
+	MaintenanceWindow
+	spec cronSpec
+	// started is the minute the jobs were last run at the start of the window.
+	started time.Time
+}
+
+func newMaintenanceWindows(windows []MaintenanceWindow) ([]*maintenanceWindow, error) {
+	var out []*maintenanceWindow
+	for _, w := range windows {
+		spec, err := parseCron(w.Cron)
+		if err != nil {
+			return nil, err
+		}
+		if w.Duration < 0 {
+			return nil, fmt.Errorf("Duration of maintenance window %q must not be negative", w.Cron)
+		}
+		for _, job := range w.Jobs {
+			if !slices.Contains(maintenanceJobs, job) {
+				return nil, fmt.Errorf("Unknown maintenance job %q", job)
+			}
+		}
+		if w.Location == nil {
+			w.Location = time.UTC
+		}
+		out = append(out, &maintenanceWindow{MaintenanceWindow: w, spec: spec})
+	}
+	return out, nil
+}
+
+// open tells if the window is open at t: if it started less than Duration before.
+func (w *maintenanceWindow) open(t time.Time) bool {
+	t = t.In(w.Location).Truncate(time.Minute)
+	for start := t; t.Sub(start) < w.Duration; start = start.Add(-time.Minute) {
+		if w.spec.matches(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// maintenanceAllowed tells if the periodic runs of job may run at now: if no window with a
+// Duration lists it, or one of them is open.
+func (db *DB) maintenanceAllowed(job MaintenanceJob, now time.Time) bool {
+	allowed := true
+	for _, w := range db.maintenance {
+		if w.Duration == 0 || !slices.Contains(w.Jobs, job) {
+			continue
+		}
+		if w.open(now) {
+			return true
+		}
+		allowed = false
+	}
+	return allowed
+}
+
+// maintenanceCheckInterval is how often the scheduler checks for the start of the windows.
+const maintenanceCheckInterval = 10 * time.Second
+
+// runMaintenance runs the jobs of the maintenance windows as they start, until lc is closed.
+func (db *DB) runMaintenance(lc *z.Closer) {
+	defer lc.Done()
+	ticker := time.NewTicker(maintenanceCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lc.HasBeenClosed():
+			return
+		case now := <-ticker.C:
+			db.startMaintenance(lc, now)
+		}
+	}
+}
+
+// startMaintenance runs the jobs of the windows starting at the minute of now, once per window.
+func (db *DB) startMaintenance(lc *z.Closer, now time.Time) {
+	var jobs []MaintenanceJob
+	for _, w := range db.maintenance {
+		minute := now.In(w.Location).Truncate(time.Minute)
+		if minute.Equal(w.started) || !w.spec.matches(minute) {
+			continue
+		}
+		w.started = minute
+		for _, job := range w.Jobs {
+			if !slices.Contains(jobs, job) {
+				jobs = append(jobs, job)
+			}
+		}
+	}
+	for _, job := range jobs {
+		if lc.Ctx().Err() != nil {
+			return
+		}
+		if err := db.runMaintenanceJob(lc, job); err != nil {
+			db.opt.Warningf("While running maintenance job %s: %v", job, err)
+		}
+	}
+}
+
+func (db *DB) runMaintenanceJob(lc *z.Closer, job MaintenanceJob) error {
+	db.opt.Infof("Running maintenance job %s", job)
+	switch job {
+	case MaintenanceValueLogGC:
+		if db.opt.InMemory {
+			return nil
+		}
+		_, err := db.vlog.scheduledGC(lc)
+		if errors.Is(err, ErrRejected) {
+			return nil
+		}
+		return err
+	case MaintenanceTTLReap:
+		db.lc.reaper.reap(lc)
+		return nil
+	case MaintenanceFlatten:
+		return db.Flatten(1)
+	case MaintenanceScrub:
+		return db.VerifyChecksum()
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron(t *testing.T) {
+	at := func(s string) time.Time {
+		ts, err := time.Parse("2006-01-02 15:04", s)
+		require.NoError(t, err)
+		return ts
+	}
+	spec, err := parseCron("*/15 2-4 * * 1-5")
+	require.NoError(t, err)
+	require.True(t, spec.matches(at("2025-06-02 02:45")))  // A Monday.
+	require.False(t, spec.matches(at("2025-06-02 02:40"))) // Not on a step.
+	require.False(t, spec.matches(at("2025-06-02 05:00")))
+	require.False(t, spec.matches(at("2025-06-01 03:00"))) // A Sunday.
+
+	// Either day matches when neither is *.
+	spec, err = parseCron("0 0 1,15 * 0")
+	require.NoError(t, err)
+	require.True(t, spec.matches(at("2025-06-15 00:00")))
+	require.True(t, spec.matches(at("2025-06-08 00:00")))
+	require.False(t, spec.matches(at("2025-06-09 00:00")))
+
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "5-1 * * * *",
+		"*/0 * * * *", "a * * * *"} {
+		_, err := parseCron(bad)
+		require.Error(t, err, bad)
+	}
+}
+
+func TestMaintenanceWindows(t *testing.T) {
+	_, err := Open(getTestOptions(t.TempDir()).WithMaintenanceWindows([]MaintenanceWindow{
+		{Cron: "0 2 * * *", Jobs: []MaintenanceJob{"defrag"}}}))
+	require.Error(t, err)
+
+	opt := getTestOptions(t.TempDir()).WithMaintenanceWindows([]MaintenanceWindow{
+		{Cron: "0 2 * * *", Duration: 2 * time.Hour, Jobs: []MaintenanceJob{MaintenanceValueLogGC}},
+		{Cron: "30 3 * * *", Jobs: []MaintenanceJob{MaintenanceScrub, MaintenanceFlatten}},
+	})
+	db, err := Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.Set([]byte("key"), []byte("val"))
+	}))
+
+	day := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+	// The periodic value log GC only runs in its window, while the reaper isn't restricted.
+	require.False(t, db.maintenanceAllowed(MaintenanceValueLogGC, day.Add(time.Hour+59*time.Minute)))
+	require.True(t, db.maintenanceAllowed(MaintenanceValueLogGC, day.Add(2*time.Hour)))
+	require.True(t, db.maintenanceAllowed(MaintenanceValueLogGC, day.Add(3*time.Hour+59*time.Minute)))
+	require.False(t, db.maintenanceAllowed(MaintenanceValueLogGC, day.Add(4*time.Hour)))
+	require.True(t, db.maintenanceAllowed(MaintenanceTTLReap, day.Add(4*time.Hour)))
+
+	// The jobs of a window are run once at its start.
+	lc := z.NewCloser(0)
+	defer lc.Signal()
+	start := day.Add(3*time.Hour + 30*time.Minute)
+	db.startMaintenance(lc, start.Add(10*time.Second))
+	require.Equal(t, start, db.maintenance[1].started)
+	require.True(t, db.maintenance[0].started.IsZero())
+	db.startMaintenance(lc, start.Add(20*time.Second))
+	require.Equal(t, start, db.maintenance[1].started)
+}
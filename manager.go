@@ -0,0 +1,249 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/dgraph-io/ristretto/v2"
+	"github.com/dgraph-io/ristretto/v2/z"
+
+	"github.com/luxfi/zapdb/fb"
+	"github.com/luxfi/zapdb/table"
+)
+
+// ManagerOptions configures the resources a Manager shares between its DBs.
+type ManagerOptions struct {
+	// BlockCacheSize and IndexCacheSize are the sizes of the caches shared by all DBs. The
+	// cache sizes in the Options of the DBs are ignored.
+	BlockCacheSize int64
+	IndexCacheSize int64
+	// BlockCacheShards is the number of shards of the shared block cache, see
+	// Options.BlockCacheShards.
+	BlockCacheShards int
+
+	// NumCompactors bounds the compactions running at once, across all DBs. Zero means no
+	// bound. Every DB still runs its own Options.NumCompactors workers, which wait for a slot.
+	NumCompactors int
+
+	// MaxCompactionsPerDB bounds the compactions of any one DB running at once, so that a busy
+	// DB doesn't take every slot. Zero means no bound.
+	MaxCompactionsPerDB int
+
+	// CompactionBytesPerSec bounds the rate at which all DBs write compacted tables. Zero means
+	// no bound.
+	CompactionBytesPerSec int64
+
+	// MemTableBudget bounds the memtable memory of every DB, MemTableSize times NumMemtables.
+	// DBs asking for more get a smaller MemTableSize. Zero keeps the sizes of their Options.
+	MemTableBudget int64
+}
+
+// DefaultManagerOptions returns the ManagerOptions of a Manager with the cache size of one DB,
+// and as many compactions as two.
+func DefaultManagerOptions() ManagerOptions {
+	return ManagerOptions{
+		BlockCacheSize: 256 << 20,
+		NumCompactors:  8,
+	}
+}
+
+// Manager opens many DBs sharing a block cache, an index cache, compaction slots and a
+// compaction write rate, so that the memory and background work of the process don't grow
+// with the number of DBs.
+type Manager struct {
+	opt        ManagerOptions
+	blockCache table.BlockCache
+	indexCache *ristretto.Cache[uint64, *fb.TableIndex]
+
+	compactions chan struct{}
+	limiter     *rateLimiter
+
+	mu      sync.Mutex
+	dbs     map[string]*DB
+	cacheID uint32
+	closed  bool
+}
+
+// NewManager returns a Manager with the shared resources of opt.
+func NewManager(opt ManagerOptions) (*Manager, error) {
+	m := &Manager{opt: opt, dbs: make(map[string]*DB)}
+	var err error
+	if m.blockCache, err = newBlockCache(opt.BlockCacheSize, 4<<10,
+		opt.BlockCacheShards); err != nil {
+		return nil, err
+	}
+	if m.indexCache, err = newIndexCache(opt.IndexCacheSize, 64<<20); err != nil {
+		if m.blockCache != nil {
+			m.blockCache.Close()
+		}
+		return nil, err
+	}
+	if opt.NumCompactors > 0 {
+		m.compactions = make(chan struct{}, opt.NumCompactors)
+	}
+	if opt.CompactionBytesPerSec > 0 {
+		m.limiter = &rateLimiter{bytesPerSec: float64(opt.CompactionBytesPerSec)}
+	}
+	return m, nil
+}
+
+// Open opens a DB with the shared resources of the Manager, and registers it under name. The
+// DB is removed from the Manager once closed.
+func (m *Manager) Open(name string, opt Options) (*DB, error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, ErrDBClosed
+	}
+	if _, ok := m.dbs[name]; ok {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("manager: a DB named %q is already open", name)
+	}
+	// Hold the name while opening, which can take a while.
+	m.dbs[name] = nil
+	m.mu.Unlock()
+
+	opt.manager = m
+	opt.BlockCacheSize, opt.IndexCacheSize = m.opt.BlockCacheSize, m.opt.IndexCacheSize
+	opt.BlockCacheShards, opt.BlockCache = m.opt.BlockCacheShards, nil
+	if b := m.opt.MemTableBudget; b > 0 && opt.NumMemtables > 0 &&
+		opt.MemTableSize*int64(opt.NumMemtables) > b {
+		opt.MemTableSize = b / int64(opt.NumMemtables)
+	}
+	db, err := Open(opt)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		delete(m.dbs, name)
+		return nil, err
+	}
+	m.dbs[name] = db
+	return db, nil
+}
+
+// Get returns the open DB registered under name, or nil.
+func (m *Manager) Get(name string) *DB {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.dbs[name]
+}
+
+// Names returns the names of the open DBs, sorted.
+func (m *Manager) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.dbs))
+	for name, db := range m.dbs {
+		if db != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BlockCacheMetrics returns the metrics of the shared block cache, or nil if it's sharded.
+func (m *Manager) BlockCacheMetrics() *ristretto.Metrics {
+	if ms := blockCacheMetrics(m.blockCache); len(ms) == 1 {
+		return ms[0]
+	}
+	return nil
+}
+
+// BlockCacheShardMetrics returns the metrics of the shards of the shared block cache.
+func (m *Manager) BlockCacheShardMetrics() []*ristretto.Metrics {
+	return blockCacheMetrics(m.blockCache)
+}
+
+// Close closes every open DB, then the shared caches.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	dbs := make([]*DB, 0, len(m.dbs))
+	for _, db := range m.dbs {
+		if db != nil {
+			dbs = append(dbs, db)
+		}
+	}
+	m.mu.Unlock()
+
+	var firstErr error
+	for _, db := range dbs {
+		if err := db.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if m.blockCache != nil {
+		m.blockCache.Close()
+	}
+	m.indexCache.Close()
+	return firstErr
+}
+
+func (m *Manager) nextCacheID() uint32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cacheID++
+	return m.cacheID
+}
+
+// remove unregisters a closed DB.
+func (m *Manager) remove(db *DB) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, d := range m.dbs {
+		if d == db {
+			delete(m.dbs, name)
+		}
+	}
+}
+
+// acquireCompaction waits for a compaction slot of the DB, and returns false if lc was closed
+// first.
+func (db *DB) acquireCompaction(lc *z.Closer) bool {
+	if db.compactionQuota != nil {
+		select {
+		case db.compactionQuota <- struct{}{}:
+		case <-lc.HasBeenClosed():
+			return false
+		}
+	}
+	if m := db.opt.manager; m != nil && m.compactions != nil {
+		select {
+		case m.compactions <- struct{}{}:
+		case <-lc.HasBeenClosed():
+			if db.compactionQuota != nil {
+				<-db.compactionQuota
+			}
+			return false
+		}
+	}
+	return true
+}
+
+func (db *DB) releaseCompaction() {
+	if m := db.opt.manager; m != nil && m.compactions != nil {
+		<-m.compactions
+	}
+	if db.compactionQuota != nil {
+		<-db.compactionQuota
+	}
+}
+
+// throttleCompaction waits until writing n more compacted bytes keeps the shared write rate, and
+// the budget of CompactionRateLimiter.
+func (db *DB) throttleCompaction(n int64) {
+	if m := db.opt.manager; m != nil {
+		m.limiter.Wait(n)
+	}
+	if l := db.opt.CompactionRateLimiter; l != nil {
+		l.Wait(n)
+	}
+}
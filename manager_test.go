@@ -0,0 +1,129 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+)
+
+func TestManagerSharedCache(t *testing.T) {
+	dir, err := os.MkdirTemp("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	// Every DB gets tables with the same IDs, and the same keys with different values.
+	names := []string{"a", "b", "c"}
+	for _, name := range names {
+		db, err := Open(getTestOptions(filepath.Join(dir, name)))
+		require.NoError(t, err)
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			for i := 0; i < 100; i++ {
+				if err := txn.Set([]byte(fmt.Sprintf("key%03d", i)), []byte(name)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+		require.NoError(t, db.Close())
+	}
+
+	m, err := NewManager(ManagerOptions{
+		BlockCacheSize: 1 << 20, IndexCacheSize: 1 << 20, NumCompactors: 2, MaxCompactionsPerDB: 1,
+	})
+	require.NoError(t, err)
+	dbs := make(map[string]*DB)
+	for _, name := range names {
+		opt := getTestOptions(filepath.Join(dir, name))
+		opt.BlockCacheSize = 0
+		db, err := m.Open(name, opt)
+		require.NoError(t, err)
+		require.Equal(t, m.blockCache, db.blockCache)
+		dbs[name] = db
+	}
+	_, err = m.Open("a", getTestOptions(filepath.Join(dir, "a")))
+	require.Error(t, err)
+	require.Equal(t, names, m.Names())
+
+	// Read twice, so that the second round is served by the shared caches.
+	for round := 0; round < 2; round++ {
+		for _, name := range names {
+			require.NoError(t, dbs[name].View(func(txn *Txn) error {
+				item, err := txn.Get([]byte("key050"))
+				require.NoError(t, err)
+				val, err := item.ValueCopy(nil)
+				require.NoError(t, err)
+				require.Equal(t, name, string(val))
+				return nil
+			}))
+		}
+	}
+
+	require.NoError(t, dbs["b"].Close())
+	require.Nil(t, m.Get("b"))
+	require.Equal(t, []string{"a", "c"}, m.Names())
+	require.NoError(t, m.Close())
+	require.True(t, dbs["a"].IsClosed())
+	_, err = m.Open("d", getTestOptions(filepath.Join(dir, "d")))
+	require.ErrorIs(t, err, ErrDBClosed)
+}
+
+func TestManagerCompactionSlots(t *testing.T) {
+	m, err := NewManager(ManagerOptions{
+		BlockCacheSize: 1 << 20, NumCompactors: 1, MemTableBudget: 64 << 20,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, m.Close()) }()
+
+	opt := DefaultOptions("").WithInMemory(true).WithLogger(nil).
+		WithMemTableSize(32 << 20).WithNumMemtables(4)
+	db1, err := m.Open("one", opt)
+	require.NoError(t, err)
+	db2, err := m.Open("two", opt)
+	require.NoError(t, err)
+	require.Equal(t, int64(16<<20), db1.opt.MemTableSize)
+
+	lc := z.NewCloser(0)
+	defer lc.Signal()
+	require.True(t, db1.acquireCompaction(lc))
+	acquired := make(chan struct{})
+	go func() {
+		require.True(t, db2.acquireCompaction(lc))
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("a second compaction ran past the shared slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+	db1.releaseCompaction()
+	<-acquired
+	db2.releaseCompaction()
+
+	// A closed closer gives up waiting.
+	require.True(t, db1.acquireCompaction(lc))
+	closed := z.NewCloser(0)
+	closed.Signal()
+	require.False(t, db2.acquireCompaction(closed))
+	db1.releaseCompaction()
+}
+
+func TestRateLimiter(t *testing.T) {
+	r := &rateLimiter{bytesPerSec: 1000}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		r.Wait(100)
+	}
+	// The first write goes through at once, the next ones wait 100ms each.
+	require.GreaterOrEqual(t, time.Since(start), 190*time.Millisecond)
+}
@@ -18,9 +18,11 @@ import (
 	"path/filepath"
 	"sync"
 
+	"github.com/luxfi/zapdb/failpoint"
 	"github.com/luxfi/zapdb/options"
 	"github.com/luxfi/zapdb/pb"
 	"github.com/luxfi/zapdb/y"
+	"github.com/luxfi/zapdb/y/vfs"
 )
 
 // Manifest represents the contents of the MANIFEST file in a Badger store.
@@ -34,6 +36,12 @@ import (
 type Manifest struct {
 	Levels []levelManifest
 	Tables map[uint64]TableManifest
+	// Dictionaries are the compression dictionaries trained by DB.TrainCompressionDictionary,
+	// by ID.
+	Dictionaries map[uint32][]byte
+	// Lifecycle is the encoding of the lifecycle policies set with DB.SetLifecyclePolicy, nil if
+	// none was ever set.
+	Lifecycle []byte
 
 	// Contains total number of creation and deletion changes in the manifest -- used to compute
 	// whether it'd be useful to rewrite the manifest.
@@ -44,15 +52,17 @@ type Manifest struct {
 func createManifest() Manifest {
 	levels := make([]levelManifest, 0)
 	return Manifest{
-		Levels: levels,
-		Tables: make(map[uint64]TableManifest),
+		Levels:       levels,
+		Tables:       make(map[uint64]TableManifest),
+		Dictionaries: make(map[uint32][]byte),
 	}
 }
 
 // levelManifest contains information about LSM tree levels
 // in the MANIFEST file.
 type levelManifest struct {
-	Tables map[uint64]struct{} // Set of table id's
+	Tables     map[uint64]struct{} // Set of table id's
+	Dictionary uint32              // ID of the compression dictionary, 0 if none
 }
 
 // TableManifest contains information about a specific table
@@ -61,6 +71,25 @@ type TableManifest struct {
 	Level       uint8
 	KeyID       uint64
 	Compression options.CompressionType
+	// EncryptionAlgo is the algorithm the table was encrypted with. Tables created before it was
+	// recorded have pb.EncryptionAlgo_aes, whatever their data key, so that only the algorithms
+	// which authenticate the data are enforced.
+	EncryptionAlgo pb.EncryptionAlgo
+	// Cold is whether the table file is in Options.ColdStorageDir rather than Options.Dir, and
+	// Remote whether it's in Options.RemoteTableStore.
+	Cold   bool
+	Remote bool
+}
+
+// tier returns the tier of the file of the table, coldTier, remoteTier or zero for Options.Dir.
+func (tm TableManifest) tier() uint32 {
+	switch {
+	case tm.Remote:
+		return remoteTier
+	case tm.Cold:
+		return coldTier
+	}
+	return 0
 }
 
 // manifestFile holds the file pointer (and other info) about the manifest file, which is a log
@@ -83,6 +112,10 @@ type manifestFile struct {
 
 	// Used to indicate if badger was opened in InMemory mode.
 	inMemory bool
+
+	// Set when changes were appended without a sync, under ManifestSyncPolicy SyncInterval.
+	// Guarded by appendLock.
+	dirty bool
 }
 
 const (
@@ -96,13 +129,38 @@ const (
 // asChanges returns a sequence of changes that could be used to recreate the Manifest in its
 // present state.
 func (m *Manifest) asChanges() []*pb.ManifestChange {
-	changes := make([]*pb.ManifestChange, 0, len(m.Tables))
+	changes := make([]*pb.ManifestChange, 0, len(m.Tables)+len(m.Dictionaries))
+	for id, dict := range m.Dictionaries {
+		var levels []int
+		for level, lm := range m.Levels {
+			if lm.Dictionary == id {
+				levels = append(levels, level)
+			}
+		}
+		changes = append(changes, newDictionaryChange(id, dict, levels))
+	}
+	if m.Lifecycle != nil {
+		changes = append(changes, newLifecycleChange(m.Lifecycle))
+	}
 	for id, tm := range m.Tables {
-		changes = append(changes, newCreateChange(id, int(tm.Level), tm.KeyID, tm.Compression))
+		changes = append(changes, newCreateChange(
+			id, int(tm.Level), tm.KeyID, tm.Compression, tm.EncryptionAlgo))
+		if tier := tm.tier(); tier != 0 {
+			changes = append(changes, newMoveChange(id, tier))
+		}
 	}
 	return changes
 }
 
+// levelDictionaries returns the IDs of the compression dictionaries of the levels.
+func (m *Manifest) levelDictionaries() []uint32 {
+	ids := make([]uint32, len(m.Levels))
+	for level, lm := range m.Levels {
+		ids[level] = lm.Dictionary
+	}
+	return ids
+}
+
 func (m *Manifest) clone(opt Options) Manifest {
 	changeSet := pb.ManifestChangeSet{Changes: m.asChanges()}
 	ret := createManifest()
@@ -224,9 +282,33 @@ func (mf *manifestFile) addChanges(changesParam []*pb.ManifestChange, opt Option
 		}
 	}
 
+	switch opt.ManifestSyncPolicy {
+	case options.SyncNever:
+		return nil
+	case options.SyncInterval:
+		mf.dirty = true
+		return nil
+	}
 	return syncFunc(mf.fp)
 }
 
+// syncIfDirty syncs the manifest file if changes were appended to it without a sync.
+func (mf *manifestFile) syncIfDirty() error {
+	if mf.inMemory {
+		return nil
+	}
+	mf.appendLock.Lock()
+	defer mf.appendLock.Unlock()
+	if !mf.dirty {
+		return nil
+	}
+	if err := syncFunc(mf.fp); err != nil {
+		return err
+	}
+	mf.dirty = false
+	return nil
+}
+
 // this function is saved here to allow injection of fake filesystem latency at test time.
 var syncFunc = func(f *os.File) error { return f.Sync() }
 
@@ -273,17 +355,16 @@ func helpRewrite(dir string, m *Manifest, extMagic uint16) (*os.File, int, error
 		fp.Close()
 		return nil, 0, err
 	}
-	if err := fp.Sync(); err != nil {
-		fp.Close()
-		return nil, 0, err
-	}
 
 	// In Windows the files should be closed before doing a Rename.
 	if err = fp.Close(); err != nil {
 		return nil, 0, err
 	}
+	if err := failpoint.Inject(failpoint.ManifestRewriteBeforeRename); err != nil {
+		return nil, 0, err
+	}
 	manifestPath := filepath.Join(dir, ManifestFilename)
-	if err := os.Rename(rewritePath, manifestPath); err != nil {
+	if err := vfs.AtomicReplace(rewritePath, manifestPath); err != nil {
 		return nil, 0, err
 	}
 	fp, err = y.OpenExistingFile(manifestPath, 0)
@@ -294,10 +375,6 @@ func helpRewrite(dir string, m *Manifest, extMagic uint16) (*os.File, int, error
 		fp.Close()
 		return nil, 0, err
 	}
-	if err := syncDir(dir); err != nil {
-		fp.Close()
-		return nil, 0, err
-	}
 
 	return fp, netCreations, nil
 }
@@ -431,13 +508,12 @@ func applyManifestChange(build *Manifest, tc *pb.ManifestChange, opt Options) er
 			return fmt.Errorf("MANIFEST invalid, table %d exists", tc.Id)
 		}
 		build.Tables[tc.Id] = TableManifest{
-			Level:       uint8(tc.Level),
-			KeyID:       tc.KeyId,
-			Compression: options.CompressionType(tc.Compression),
-		}
-		for len(build.Levels) <= int(tc.Level) {
-			build.Levels = append(build.Levels, levelManifest{make(map[uint64]struct{})})
+			Level:          uint8(tc.Level),
+			KeyID:          tc.KeyId,
+			Compression:    options.CompressionType(tc.Compression),
+			EncryptionAlgo: tc.EncryptionAlgo,
 		}
+		build.growLevels(int(tc.Level))
 		build.Levels[tc.Level].Tables[tc.Id] = struct{}{}
 		build.Creations++
 	case pb.ManifestChange_DELETE:
@@ -452,12 +528,55 @@ func applyManifestChange(build *Manifest, tc *pb.ManifestChange, opt Options) er
 			delete(build.Tables, tc.Id)
 		}
 		build.Deletions++
+	case pb.ManifestChange_DICTIONARY:
+		id := uint32(tc.Id)
+		if len(tc.Dictionary) > 0 {
+			build.Dictionaries[id] = tc.Dictionary
+		}
+		if _, ok := build.Dictionaries[id]; !ok {
+			return fmt.Errorf("MANIFEST invalid, dictionary %d doesn't exist", id)
+		}
+		// Level is the bit mask of the levels compressed with the dictionary.
+		for level := 0; level < 32; level++ {
+			if tc.Level&(1<<level) != 0 {
+				build.growLevels(level)
+				build.Levels[level].Dictionary = id
+			}
+		}
+	case pb.ManifestChange_MOVE:
+		tm, ok := build.Tables[tc.Id]
+		if !ok {
+			return fmt.Errorf("MANIFEST invalid, table %d doesn't exist to move", tc.Id)
+		}
+		// The move replaces the location of the table, like a deletion and a creation.
+		tm.Cold, tm.Remote = tc.Level == coldTier, tc.Level == remoteTier
+		build.Tables[tc.Id] = tm
+		build.Creations++
+		build.Deletions++
+	case pb.ManifestChange_LIFECYCLE:
+		// The lifecycle replaces the one before, which counts as deleted so that it's dropped
+		// when the manifest is rewritten.
+		if build.Lifecycle != nil {
+			build.Deletions++
+		}
+		build.Lifecycle = tc.Lifecycle
+		if build.Lifecycle == nil {
+			build.Lifecycle = []byte{}
+		}
+		build.Creations++
 	default:
 		return fmt.Errorf("MANIFEST file has invalid manifestChange op")
 	}
 	return nil
 }
 
+// growLevels adds levels to the manifest, up to level.
+func (m *Manifest) growLevels(level int) {
+	for len(m.Levels) <= level {
+		m.Levels = append(m.Levels, levelManifest{Tables: make(map[uint64]struct{})})
+	}
+}
+
 // This is not a "recoverable" error -- opening the KV store fails because the MANIFEST file is
 // just plain broken.
 func applyChangeSet(build *Manifest, changeSet *pb.ManifestChangeSet, opt Options) error {
@@ -469,19 +588,51 @@ func applyChangeSet(build *Manifest, changeSet *pb.ManifestChangeSet, opt Option
 	return nil
 }
 
-func newCreateChange(
-	id uint64, level int, keyID uint64, c options.CompressionType) *pb.ManifestChange {
+func newCreateChange(id uint64, level int, keyID uint64, c options.CompressionType,
+	algo pb.EncryptionAlgo) *pb.ManifestChange {
 	return &pb.ManifestChange{
-		Id:    id,
-		Op:    pb.ManifestChange_CREATE,
-		Level: uint32(level),
-		KeyId: keyID,
-		// Hard coding it, since we're supporting only AES for now.
-		EncryptionAlgo: pb.EncryptionAlgo_aes,
+		Id:             id,
+		Op:             pb.ManifestChange_CREATE,
+		Level:          uint32(level),
+		KeyId:          keyID,
+		EncryptionAlgo: algo,
 		Compression:    uint32(c),
 	}
 }
 
+// newDictionaryChange returns the change adding the compression dictionary dict of ID id, which
+// compresses the tables of levels from now on.
+func newDictionaryChange(id uint32, dict []byte, levels []int) *pb.ManifestChange {
+	var mask uint32
+	for _, level := range levels {
+		mask |= 1 << level
+	}
+	return &pb.ManifestChange{
+		Id:         uint64(id),
+		Op:         pb.ManifestChange_DICTIONARY,
+		Level:      mask,
+		Dictionary: dict,
+	}
+}
+
+// newLifecycleChange returns the change setting the encoding of the lifecycle policies.
+func newLifecycleChange(lifecycle []byte) *pb.ManifestChange {
+	return &pb.ManifestChange{
+		Op:        pb.ManifestChange_LIFECYCLE,
+		Lifecycle: lifecycle,
+	}
+}
+
+// newMoveChange returns the change moving the file of table id to tier, coldTier or remoteTier,
+// or back to Options.Dir if zero.
+func newMoveChange(id uint64, tier uint32) *pb.ManifestChange {
+	return &pb.ManifestChange{
+		Id:    id,
+		Op:    pb.ManifestChange_MOVE,
+		Level: tier,
+	}
+}
+
 func newDeleteChange(id uint64) *pb.ManifestChange {
 	return &pb.ManifestChange{
 		Id: id,
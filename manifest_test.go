@@ -218,13 +218,13 @@ func TestManifestRewrite(t *testing.T) {
 	require.Equal(t, 0, m.Deletions)
 
 	err = mf.addChanges([]*pb.ManifestChange{
-		newCreateChange(0, 0, 0, 0),
+		newCreateChange(0, 0, 0, 0, pb.EncryptionAlgo_aes),
 	}, db.opt)
 	require.NoError(t, err)
 
 	for i := uint64(0); i < uint64(deletionsThreshold*3); i++ {
 		ch := []*pb.ManifestChange{
-			newCreateChange(i+1, 0, 0, 0),
+			newCreateChange(i+1, 0, 0, 0, pb.EncryptionAlgo_aes),
 			newDeleteChange(i),
 		}
 		err := mf.addChanges(ch, db.opt)
@@ -264,7 +264,7 @@ func TestConcurrentManifestCompaction(t *testing.T) {
 	cs := &pb.ManifestChangeSet{}
 	for i := uint64(0); i < 1000; i++ {
 		cs.Changes = append(cs.Changes,
-			newCreateChange(i, 0, 0, 0),
+			newCreateChange(i, 0, 0, 0, pb.EncryptionAlgo_aes),
 			newDeleteChange(i),
 		)
 	}
@@ -21,6 +21,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/luxfi/zapdb/pb"
 	"github.com/luxfi/zapdb/skl"
@@ -37,7 +38,20 @@ type memTable struct {
 	wal        *logFile
 	maxVersion uint64
 	opt        Options
+	metrics    *y.MetricsSet
 	buf        *bytes.Buffer
+	// recovered is set by UpdateSkipList if a torn tail was truncated from the WAL.
+	recovered *LogRecovery
+	// replayed is the end of the transactions replayed from the WAL, in read-only mode.
+	replayed uint32
+	// firstWrite is the time in unix nanoseconds of the first entry put into the memtable, or
+	// of its replay from the WAL, or zero while it's empty.
+	firstWrite atomic.Int64
+	// entries is the number of entries put into the memtable, and vlogFids the first and last
+	// value log files its value pointers point into, if hasVlog, for the flush triggers.
+	entries  int64
+	vlogFids [2]uint32
+	hasVlog  bool
 }
 
 func (db *DB) openMemTables(opt Options) error {
@@ -45,29 +59,12 @@ func (db *DB) openMemTables(opt Options) error {
 	if db.opt.InMemory {
 		return nil
 	}
-	files, err := os.ReadDir(db.opt.Dir)
+	fids, err := memTableFids(db.opt.Dir)
 	if err != nil {
-		return errFile(err, db.opt.Dir, "Unable to open mem dir.")
-	}
-
-	var fids []int
-	for _, file := range files {
-		if !strings.HasSuffix(file.Name(), memFileExt) {
-			continue
-		}
-		fsz := len(file.Name())
-		fid, err := strconv.ParseInt(file.Name()[:fsz-len(memFileExt)], 10, 64)
-		if err != nil {
-			return errFile(err, file.Name(), "Unable to parse log id.")
-		}
-		fids = append(fids, int(fid))
+		return err
 	}
-
-	// Sort in ascending order.
-	sort.Slice(fids, func(i, j int) bool {
-		return fids[i] < fids[j]
-	})
-	for _, fid := range fids {
+	db.opt.openProgress(OpenStageMemtables, 0, len(fids))
+	for i, fid := range fids {
 		flags := os.O_RDWR
 		if db.opt.ReadOnly {
 			flags = os.O_RDONLY
@@ -84,6 +81,7 @@ func (db *DB) openMemTables(opt Options) error {
 		}
 		// These should no longer be written to. So, make them part of the imm.
 		db.imm = append(db.imm, mt)
+		db.opt.openProgress(OpenStageMemtables, i+1, len(fids))
 	}
 	if len(fids) != 0 {
 		db.nextMemFid = fids[len(fids)-1]
@@ -94,13 +92,41 @@ func (db *DB) openMemTables(opt Options) error {
 
 const memFileExt string = ".mem"
 
+// memTableFids returns the IDs of the WAL files in dir, in ascending order.
+func memTableFids(dir string) ([]int, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errFile(err, dir, "Unable to open mem dir.")
+	}
+
+	var fids []int
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), memFileExt) {
+			continue
+		}
+		fsz := len(file.Name())
+		fid, err := strconv.ParseInt(file.Name()[:fsz-len(memFileExt)], 10, 64)
+		if err != nil {
+			return nil, errFile(err, file.Name(), "Unable to parse log id.")
+		}
+		fids = append(fids, int(fid))
+	}
+
+	// Sort in ascending order.
+	sort.Slice(fids, func(i, j int) bool {
+		return fids[i] < fids[j]
+	})
+	return fids, nil
+}
+
 func (db *DB) openMemTable(fid, flags int) (*memTable, error) {
 	filepath := db.mtFilePath(fid)
 	s := skl.NewSkiplist(arenaSize(db.opt))
 	mt := &memTable{
-		sl:  s,
-		opt: db.opt,
-		buf: &bytes.Buffer{},
+		sl:      s,
+		opt:     db.opt,
+		metrics: db.metrics,
+		buf:     &bytes.Buffer{},
 	}
 	// We don't need to create the wal for the skiplist in in-memory mode so return the mt.
 	if db.opt.InMemory {
@@ -120,8 +146,14 @@ func (db *DB) openMemTable(fid, flags int) (*memTable, error) {
 	}
 
 	// Have a callback set to delete WAL when skiplist reference count goes down to zero. That is,
-	// when it gets flushed to L0.
+	// when it gets flushed to L0. A read-only DB leaves the WAL to the process writing it.
 	s.OnClose = func() {
+		if db.opt.ReadOnly {
+			if err := mt.wal.Close(-1); err != nil {
+				db.opt.Errorf("while closing file: %s, err: %v", filepath, err)
+			}
+			return
+		}
 		if err := mt.wal.Delete(); err != nil {
 			db.opt.Errorf("while deleting file: %s, err: %v", filepath, err)
 		}
@@ -131,6 +163,7 @@ func (db *DB) openMemTable(fid, flags int) (*memTable, error) {
 		return mt, lerr
 	}
 	err := mt.UpdateSkipList()
+	db.recordRecovery(mt.recovered)
 	return mt, y.Wrapf(err, "while updating skiplist")
 }
 
@@ -138,6 +171,12 @@ func (db *DB) newMemTable() (*memTable, error) {
 	mt, err := db.openMemTable(db.nextMemFid, os.O_CREATE|os.O_RDWR)
 	if err == z.NewFile {
 		db.nextMemFid++
+		if db.logsSynced() {
+			// The WAL gets synced, so its directory entry must be durable as well.
+			if err := db.syncDir(db.opt.Dir); err != nil {
+				return nil, y.Wrapf(err, "newMemTable")
+			}
+		}
 		return mt, nil
 	}
 
@@ -156,15 +195,37 @@ func (mt *memTable) SyncWAL() error {
 	return mt.wal.Sync()
 }
 
-func (mt *memTable) isFull() bool {
-	if mt.sl.MemSize() >= mt.opt.MemTableSize {
-		return true
-	}
-	if mt.opt.InMemory {
-		// InMemory mode doesn't have any WAL.
-		return false
-	}
-	return int64(mt.wal.writeAt) >= mt.opt.MemTableSize
+// The causes of the memtable flushes, by which they're counted in the flush_num_memtable metric.
+const (
+	flushCauseSize          = "size"
+	flushCauseEntries       = "entries"
+	flushCauseValueLogFiles = "value_log_files"
+	flushCauseAge           = "age"
+	flushCauseManual        = "manual"
+	flushCauseClose         = "close"
+	flushCauseReplay        = "replay"
+)
+
+// flushCause returns the cause of the flush of the memtable if it's due, by its size, the number
+// of its entries, the value log files its values are in or its age, or "" if it isn't.
+func (mt *memTable) flushCause() string {
+	opt := &mt.opt
+	switch {
+	case mt.sl.MemSize() >= opt.MemTableSize:
+		return flushCauseSize
+	// InMemory mode doesn't have any WAL.
+	case !opt.InMemory && int64(mt.wal.writeAt) >= opt.MemTableSize:
+		return flushCauseSize
+	case opt.MemTableMaxEntries > 0 && mt.entries >= opt.MemTableMaxEntries:
+		return flushCauseEntries
+	case opt.MemTableMaxValueLogFiles > 0 && mt.hasVlog &&
+		int(mt.vlogFids[1]-mt.vlogFids[0]) >= opt.MemTableMaxValueLogFiles-1:
+		return flushCauseValueLogFiles
+	case opt.MemTableMaxAge > 0 && mt.firstWrite.Load() != 0 &&
+		sinceNanos(time.Now(), mt.firstWrite.Load()) >= opt.MemTableMaxAge:
+		return flushCauseAge
+	}
+	return ""
 }
 
 func (mt *memTable) Put(key []byte, value y.ValueStruct) error {
@@ -191,10 +252,22 @@ func (mt *memTable) Put(key []byte, value y.ValueStruct) error {
 
 	// Write to skiplist and update maxVersion encountered.
 	mt.sl.Put(key, value)
+	if mt.firstWrite.Load() == 0 {
+		mt.firstWrite.Store(time.Now().UnixNano())
+	}
+	mt.entries++
+	if value.Meta&bitValuePointer > 0 {
+		var vp valuePointer
+		vp.Decode(value.Value)
+		if !mt.hasVlog {
+			mt.vlogFids, mt.hasVlog = [2]uint32{vp.Fid, vp.Fid}, true
+		}
+		mt.vlogFids[0], mt.vlogFids[1] = min(mt.vlogFids[0], vp.Fid), max(mt.vlogFids[1], vp.Fid)
+	}
 	if ts := y.ParseTs(entry.Key); ts > mt.maxVersion {
 		mt.maxVersion = ts
 	}
-	y.NumBytesWrittenToL0Add(mt.opt.MetricsEnabled, entry.estimateSizeAndSetThreshold(mt.opt.ValueThreshold))
+	mt.metrics.NumBytesWrittenToL0Add(entry.estimateSizeAndSetThreshold(mt.opt.ValueThreshold))
 	return nil
 }
 
@@ -206,9 +279,14 @@ func (mt *memTable) UpdateSkipList() error {
 	if err != nil {
 		return y.Wrapf(err, "while iterating wal: %s", mt.wal.Fd.Name())
 	}
-	if endOff < mt.wal.size.Load() && mt.opt.ReadOnly {
-		return y.Wrapf(ErrTruncateNeeded, "end offset: %d < size: %d", endOff, mt.wal.size.Load())
+	if mt.opt.ReadOnly {
+		// The transactions after endOff are torn, or still being written by another process.
+		// They're left out of the memtable, without truncating the WAL, until DB.Refresh.
+		mt.replayed = endOff
+		return nil
 	}
+	mt.recovered = mt.wal.tornTail(endOff)
+	mt.wal.truncated = true
 	return mt.wal.Truncate(int64(endOff))
 }
 
@@ -242,6 +320,9 @@ func (mt *memTable) replayFunction(opt Options) func(Entry, valuePointer) error
 		// depending upon how big the original value was. Skiplist makes a copy of the key and
 		// value.
 		mt.sl.Put(e.Key, v)
+		if mt.firstWrite.Load() == 0 {
+			mt.firstWrite.Store(time.Now().UnixNano())
+		}
 		return nil
 	}
 }
@@ -262,6 +343,10 @@ type logFile struct {
 	registry *KeyRegistry
 	writeAt  uint32
 	opt      Options
+	// truncated is set once recovery truncated the file after its last valid entry. The offsets
+	// past it were used by the entries discarded, so that writing there again would reuse the
+	// nonces they were encrypted with: the writes go to a new file instead.
+	truncated bool
 }
 
 func (lf *logFile) Truncate(end int64) error {
@@ -275,12 +360,23 @@ func (lf *logFile) Truncate(end int64) error {
 	return lf.MmapFile.Truncate(end)
 }
 
+// Delete removes the file, without truncating it, for the read-only DBs mapping it.
+func (lf *logFile) Delete() error {
+	return y.DeleteMmapFile(lf.MmapFile)
+}
+
 // encodeEntry will encode entry to the buf
 // layout of entry
-// +--------+-----+-------+-------+
-// | header | key | value | crc32 |
-// +--------+-----+-------+-------+
+// +--------+-----+-------+-----+-------+
+// | header | key | value | tag | crc32 |
+// +--------+-----+-------+-----+-------+
+// The tag authenticates the encrypted key and value, with the header, if the data key's algorithm
+// does, see sealOverhead.
 func (lf *logFile) encodeEntry(buf *bytes.Buffer, e *Entry, offset uint32) (int, error) {
+	if lf.truncated {
+		return 0, fmt.Errorf("Log file %s was truncated by recovery, and isn't written anymore",
+			lf.path)
+	}
 	h := header{
 		klen:      uint32(len(e.Key)),
 		vlen:      uint32(len(e.Value)),
@@ -297,17 +393,19 @@ func (lf *logFile) encodeEntry(buf *bytes.Buffer, e *Entry, offset uint32) (int,
 	sz := h.Encode(headerEnc[:])
 	y.Check2(writer.Write(headerEnc[:sz]))
 	// we'll encrypt only key and value.
+	tagLen := lf.sealOverhead()
 	if lf.encryptionEnabled() {
-		// TODO: no need to allocate the bytes. we can calculate the encrypted buf one by one
-		// since we're using ctr mode of AES encryption. Ordering won't changed. Need some
-		// refactoring in XORBlock which will work like stream cipher.
-		eBuf := make([]byte, 0, len(e.Key)+len(e.Value))
+		kvLen := len(e.Key) + len(e.Value)
+		eBuf := make([]byte, 0, kvLen+tagLen)
 		eBuf = append(eBuf, e.Key...)
 		eBuf = append(eBuf, e.Value...)
-		if err := y.XORBlockStream(
-			writer, eBuf, lf.dataKey.Data, lf.generateIV(offset)); err != nil {
+		// Encrypted in place, with the tag appended.
+		sealed := eBuf[:kvLen+tagLen]
+		if err := y.SealBlock(lf.dataKey.EncryptionAlgo, sealed, eBuf,
+			lf.dataKey.Data, lf.generateIV(offset), headerEnc[:sz]); err != nil {
 			return 0, y.Wrapf(err, "Error while encoding entry for vlog.")
 		}
+		y.Check2(writer.Write(sealed))
 	} else {
 		// Encryption is disabled so writing directly to the buffer.
 		y.Check2(writer.Write(e.Key))
@@ -318,7 +416,7 @@ func (lf *logFile) encodeEntry(buf *bytes.Buffer, e *Entry, offset uint32) (int,
 	binary.BigEndian.PutUint32(crcBuf[:], hash.Sum32())
 	y.Check2(buf.Write(crcBuf[:]))
 	// return encoded length.
-	return len(headerEnc[:sz]) + len(e.Key) + len(e.Value) + len(crcBuf), nil
+	return len(headerEnc[:sz]) + len(e.Key) + len(e.Value) + tagLen + len(crcBuf), nil
 }
 
 func (lf *logFile) writeEntry(buf *bytes.Buffer, e *Entry, opt Options) error {
@@ -340,9 +438,9 @@ func (lf *logFile) decodeEntry(buf []byte, offset uint32) (*Entry, error) {
 	kv := buf[hlen:]
 	if lf.encryptionEnabled() {
 		var err error
-		// No need to worry about mmap. because, XORBlock allocates a byte array to do the
-		// xor. So, the given slice is not being mutated.
-		if kv, err = lf.decryptKV(kv, offset); err != nil {
+		// No need to worry about mmap. because, decryptKV allocates a byte array to decrypt
+		// into. So, the given slice is not being mutated.
+		if kv, err = lf.decryptKV(kv, h, offset); err != nil {
 			return nil, err
 		}
 	}
@@ -357,8 +455,32 @@ func (lf *logFile) decodeEntry(buf []byte, offset uint32) (*Entry, error) {
 	return e, nil
 }
 
-func (lf *logFile) decryptKV(buf []byte, offset uint32) ([]byte, error) {
-	return y.XORBlockAllocate(buf, lf.dataKey.Data, lf.generateIV(offset))
+// decryptKV decrypts the key and value of the entry with header h, which buf starts with, and
+// checks their tag, with h, if the data key's algorithm authenticates them.
+func (lf *logFile) decryptKV(buf []byte, h header, offset uint32) ([]byte, error) {
+	n := int(h.klen) + int(h.vlen) + lf.sealOverhead()
+	if len(buf) < n {
+		return nil, fmt.Errorf("Invalid read: Len: %d, encrypted entry of %d bytes",
+			len(buf), n)
+	}
+	var headerEnc [maxHeaderSize]byte
+	sz := h.Encode(headerEnc[:])
+	dst := make([]byte, n-lf.sealOverhead())
+	if err := y.OpenBlock(lf.dataKey.EncryptionAlgo, dst, buf[:n], lf.dataKey.Data,
+		lf.generateIV(offset), headerEnc[:sz]); err != nil {
+		return nil, fmt.Errorf("%w: while decrypting entry at offset %d of %s",
+			err, offset, lf.path)
+	}
+	return dst, nil
+}
+
+// sealOverhead returns the size of the tag which follows the key and value of every entry, if the
+// log file is encrypted with an algorithm which authenticates them.
+func (lf *logFile) sealOverhead() int {
+	if lf.dataKey == nil {
+		return 0
+	}
+	return y.SealOverhead(lf.dataKey.EncryptionAlgo)
 }
 
 // KeyID returns datakey's ID.
@@ -471,7 +593,7 @@ loop:
 		}
 
 		var vp valuePointer
-		vp.Len = uint32(e.hlen + len(e.Key) + len(e.Value) + crc32.Size)
+		vp.Len = uint32(e.hlen + len(e.Key) + len(e.Value) + lf.sealOverhead() + crc32.Size)
 		read.recordOffset += vp.Len
 
 		vp.Offset = e.offset
@@ -0,0 +1,82 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemTableFlushTriggers(t *testing.T) {
+	flushes := func(db *DB, cause string) int64 {
+		v := db.metrics.Vars().Get("flush_num_memtable").(*expvar.Map).Get(cause)
+		if v == nil {
+			return 0
+		}
+		return v.(*expvar.Int).Value()
+	}
+	numL0 := func(db *DB) int {
+		return db.Levels()[0].NumTables
+	}
+	set := func(t *testing.T, db *DB, i int, val []byte) {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Set([]byte(fmt.Sprintf("key%06d", i)), val)
+		}))
+	}
+
+	t.Run("entries", func(t *testing.T) {
+		db, err := Open(getTestOptions(t.TempDir()).WithMemTableMaxEntries(100).
+			WithNumCompactors(0))
+		require.NoError(t, err)
+		defer func() { require.NoError(t, db.Close()) }()
+
+		// The memtable is flushed before the write of the entry above the limit.
+		for i := 0; i < 350; i++ {
+			set(t, db, i, []byte("val"))
+		}
+		require.Equal(t, int64(3), flushes(db, flushCauseEntries))
+		require.Zero(t, flushes(db, flushCauseSize))
+		require.Eventually(t, func() bool { return numL0(db) == 3 }, 10*time.Second,
+			10*time.Millisecond)
+	})
+
+	t.Run("value log files", func(t *testing.T) {
+		db, err := Open(getTestOptions(t.TempDir()).WithMemTableMaxValueLogFiles(2).
+			WithValueThreshold(1 << 10).WithValueLogFileSize(1 << 20).WithNumCompactors(0))
+		require.NoError(t, err)
+		defer func() { require.NoError(t, db.Close()) }()
+
+		// Ten values fill a value log file, so the values of a memtable are in two files after
+		// the eleventh.
+		val := bytes.Repeat([]byte("v"), 100<<10)
+		for i := 0; i < 25; i++ {
+			set(t, db, i, val)
+		}
+		require.Equal(t, int64(2), flushes(db, flushCauseValueLogFiles))
+	})
+
+	t.Run("age", func(t *testing.T) {
+		db, err := Open(getTestOptions(t.TempDir()).WithMemTableMaxAge(200 * time.Millisecond).
+			WithNumCompactors(0))
+		require.NoError(t, err)
+		defer func() { require.NoError(t, db.Close()) }()
+
+		// Without more writes, the memtable is flushed by the background check.
+		set(t, db, 0, []byte("val"))
+		require.Eventually(t, func() bool { return numL0(db) == 1 }, 10*time.Second,
+			10*time.Millisecond)
+		require.Equal(t, int64(1), flushes(db, flushCauseAge))
+
+		// An empty memtable is never flushed.
+		time.Sleep(500 * time.Millisecond)
+		require.Equal(t, int64(1), flushes(db, flushCauseAge))
+	})
+}
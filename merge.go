@@ -6,23 +6,15 @@
 package badger
 
 import (
-	stderrors "errors"
+	"bytes"
+	"cmp"
+	"fmt"
+	"slices"
 	"sync"
-	"time"
 
 	"github.com/luxfi/zapdb/y"
-	"github.com/dgraph-io/ristretto/v2/z"
 )
 
-// MergeOperator represents a Badger merge operator.
-type MergeOperator struct {
-	sync.RWMutex
-	f      MergeFunc
-	db     *DB
-	key    []byte
-	closer *z.Closer
-}
-
 // MergeFunc accepts two byte slices, one representing an existing value, and
 // another representing a new value that needs to be ‘merged’ into it. MergeFunc
 // contains the logic to perform the ‘merge’ and return an updated value.
@@ -30,118 +22,267 @@ type MergeOperator struct {
 // Note that the ordering of the operands is maintained.
 type MergeFunc func(existingVal, newVal []byte) []byte
 
-// GetMergeOperator creates a new MergeOperator for a given key and returns a
-// pointer to it. It also fires off a goroutine that performs a compaction using
-// the merge function that runs periodically, as specified by dur.
-func (db *DB) GetMergeOperator(key []byte,
-	f MergeFunc, dur time.Duration) *MergeOperator {
-	op := &MergeOperator{
-		f:      f,
-		db:     db,
-		key:    key,
-		closer: z.NewCloser(1),
+// mergeOperator is a MergeFunc registered for the keys starting with prefix, or only for the key
+// prefix if exact is set.
+type mergeOperator struct {
+	prefix []byte
+	exact  bool
+	f      MergeFunc
+}
+
+// mergeOperators holds the merge operators registered with a DB.
+type mergeOperators struct {
+	sync.RWMutex
+	ops []mergeOperator
+}
+
+func (m *mergeOperators) register(op mergeOperator) {
+	m.Lock()
+	defer m.Unlock()
+	for i, o := range m.ops {
+		if o.exact == op.exact && bytes.Equal(o.prefix, op.prefix) {
+			m.ops[i] = op
+			return
+		}
 	}
+	m.ops = append(m.ops, op)
+}
 
-	go op.runCompactions(dur)
-	return op
+// get returns the MergeFunc of key, or nil if none is registered. The operator with the longest
+// prefix wins, and one registered for key only over one registered for its prefix.
+func (m *mergeOperators) get(key []byte) MergeFunc {
+	m.RLock()
+	defer m.RUnlock()
+	var best *mergeOperator
+	for i, o := range m.ops {
+		if o.exact && !bytes.Equal(o.prefix, key) || !bytes.HasPrefix(key, o.prefix) {
+			continue
+		}
+		if best == nil || len(o.prefix) > len(best.prefix) || o.exact && !best.exact {
+			best = &m.ops[i]
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.f
 }
 
-var errNoMerge = stderrors.New("No need for merge")
+// RegisterMergeOperator registers f as the merge operator of the keys starting with prefix.
+// Txn.Merge writes a delta to such a key without reading it, and reads of the key return its value
+// with the deltas written since merged into it, in order, by f. The first delta written to a key
+// without a value, or after it was deleted, is its value.
+//
+// Deltas are resolved lazily: reads merge the deltas they find, and compactions merge the deltas
+// no transaction can read unmerged anymore into a single value, so that they don't pile up.
+//
+// Operators aren't persisted. They must be registered every time the DB is opened, before the
+// keys are read. Until then, reads return the last delta as it was written, and compactions keep
+// the deltas. If several prefixes of a key have an operator, the longest one is used. Registering
+// a prefix again replaces its operator.
+func (db *DB) RegisterMergeOperator(prefix []byte, f MergeFunc) {
+	db.mergeOps.register(mergeOperator{prefix: y.SafeCopy(nil, prefix), f: f})
+}
 
-func (op *MergeOperator) iterateAndMerge() (newVal []byte, latest uint64, err error) {
-	txn := op.db.NewTransaction(false)
-	defer txn.Discard()
-	opt := DefaultIteratorOptions
-	opt.AllVersions = true
-	it := txn.NewKeyIterator(op.key, opt)
-	defer it.Close()
+// Merge writes delta to be merged into the value of key by its merge operator, registered with
+// DB.RegisterMergeOperator. Unlike a Get followed by a Set, it doesn't read key, so concurrent
+// transactions merging into the same key don't conflict. It returns ErrNoMergeOperator if no
+// operator is registered for key.
+//
+// A transaction writes a key once: merging into a key already written by the transaction merges
+// delta into the pending write, which reads key if that write is a delta as well.
+func (txn *Txn) Merge(key, delta []byte) error {
+	f := txn.db.mergeOps.get(key)
+	if f == nil {
+		return fmt.Errorf("%w for key %q", ErrNoMergeOperator, key)
+	}
+	e, has := txn.pendingWrites[string(key)]
+	if !has || !bytes.Equal(e.Key, key) {
+		return txn.SetEntry(NewEntry(key, delta).withMergeBit())
+	}
+	ne := NewEntry(key, delta)
+	switch {
+	case isDeletedOrExpired(e.meta, e.ExpiresAt):
+	case e.meta&bitMergeEntry > 0:
+		existing, err := txn.db.mergeValue(f, key, txn.readTs, e.Value)
+		if err != nil {
+			return err
+		}
+		txn.addReadKey(key)
+		ne.Value = f(existing, delta)
+	default:
+		ne.Value = f(e.Value, delta)
+		ne.UserMeta, ne.ExpiresAt = e.UserMeta, e.ExpiresAt
+	}
+	return txn.SetEntry(ne)
+}
 
-	var numVersions int
-	for it.Rewind(); it.Valid(); it.Next() {
-		item := it.Item()
-		if item.IsDeletedOrExpired() {
+// mergeValue returns the value of key as of readTs, with its deltas merged by f, and with delta
+// merged into it unless nil. Older deltas are merged first, back to the last version which isn't
+// a delta.
+func (db *DB) mergeValue(f MergeFunc, key []byte, readTs uint64, delta []byte) ([]byte, error) {
+	versions, release := db.keyVersions(key, readTs)
+	defer release()
+	var deltas [][]byte
+	if delta != nil {
+		deltas = append(deltas, delta)
+	}
+	var existing []byte
+	var exists bool
+	for _, vs := range versions {
+		if isDeletedOrExpired(vs.Meta, vs.ExpiresAt) ||
+			db.rangeDels.covers(key, vs.Version, readTs) {
 			break
 		}
-		numVersions++
-		if numVersions == 1 {
-			// This should be the newVal, considering this is the latest version.
-			newVal, err = item.ValueCopy(newVal)
-			if err != nil {
-				return nil, 0, err
-			}
-			latest = item.Version()
-		} else {
-			if err := item.Value(func(oldVal []byte) error {
-				// The merge should always be on the newVal considering it has the merge result of
-				// the latest version. The value read should be the oldVal.
-				newVal = op.f(oldVal, newVal)
-				return nil
-			}); err != nil {
-				return nil, 0, err
-			}
+		val, err := db.readValue(vs)
+		if err != nil {
+			return nil, err
 		}
-		if item.DiscardEarlierVersions() {
+		if vs.Meta&bitMergeEntry == 0 {
+			existing, exists = val, true
 			break
 		}
+		deltas = append(deltas, val)
 	}
-	if numVersions == 0 {
-		return nil, latest, ErrKeyNotFound
-	} else if numVersions == 1 {
-		return newVal, latest, errNoMerge
+	if len(deltas) == 0 {
+		return existing, nil
 	}
-	return newVal, latest, nil
+	return foldMerge(f, existing, exists, deltas), nil
 }
 
-func (op *MergeOperator) compact() error {
-	op.Lock()
-	defer op.Unlock()
-	val, version, err := op.iterateAndMerge()
-	if err == ErrKeyNotFound || err == errNoMerge {
-		return nil
-	} else if err != nil {
-		return err
+// keyVersions returns the versions of key up to readTs, newest first, read from a snapshot of the
+// memtables and the tables. They are valid until release is called.
+//
+// A compaction merges deltas into a value with the version of the newest of them, so that a
+// snapshot taken while it replaces the tables of a level may hold the same version both as a delta
+// and as the value: the value wins, since it holds the deltas below as well, which may be gone
+// from the snapshot already.
+func (db *DB) keyVersions(key []byte, readTs uint64) (versions []y.ValueStruct, release func()) {
+	mts, decr := db.getMemTables()
+	var iters []y.Iterator
+	for _, mt := range mts {
+		iters = append(iters, mt.sl.NewUniIterator(false))
 	}
-	entries := []*Entry{
-		{
-			Key:   y.KeyWithTs(op.key, version),
-			Value: val,
-			meta:  bitDiscardEarlierVersions,
-		},
+	decr()
+	iters = db.lc.appendIterators(iters, &IteratorOptions{Prefix: key, prefixIsKey: true})
+	db.vlog.incrIteratorCount()
+	release = func() {
+		for _, it := range iters {
+			_ = it.Close()
+		}
+		_ = db.vlog.decrIteratorCount()
 	}
-	// Write value back to the DB. It is important that we do not set the bitMergeEntry bit
-	// here. When compaction happens, all the older merged entries will be removed.
-	return op.db.batchSetAsync(entries, func(err error) {
-		if err != nil {
-			op.db.opt.Errorf("failed to insert the result of merge compaction: %s", err)
+
+	seek := y.KeyWithTs(key, readTs)
+	found := make(map[uint64]int)
+	for _, it := range iters {
+		for it.Seek(seek); it.Valid() && y.SameKey(it.Key(), seek); it.Next() {
+			vs := it.Value()
+			vs.Version = y.ParseTs(it.Key())
+			i, ok := found[vs.Version]
+			switch {
+			case !ok:
+				found[vs.Version] = len(versions)
+				versions = append(versions, vs)
+			case versions[i].Meta&bitMergeEntry > 0 && vs.Meta&bitMergeEntry == 0:
+				versions[i] = vs
+			}
 		}
+	}
+	slices.SortFunc(versions, func(a, b y.ValueStruct) int {
+		return cmp.Compare(b.Version, a.Version)
 	})
+	return versions, release
 }
 
-func (op *MergeOperator) runCompactions(dur time.Duration) {
-	ticker := time.NewTicker(dur)
-	defer op.closer.Done()
-	var stop bool
-	for {
-		select {
-		case <-op.closer.HasBeenClosed():
-			stop = true
-		case <-ticker.C: // wait for tick
-		}
-		if err := op.compact(); err != nil {
-			op.db.opt.Errorf("failure while running merge operation: %s", err)
-		}
-		if stop {
-			ticker.Stop()
-			break
-		}
+// foldMerge merges deltas, newest first, into existing with f. If the value doesn't exist, the
+// oldest delta is its value.
+func foldMerge(f MergeFunc, existing []byte, exists bool, deltas [][]byte) []byte {
+	i := len(deltas) - 1
+	if !exists {
+		existing = deltas[i]
+		i--
+	}
+	for ; i >= 0; i-- {
+		existing = f(existing, deltas[i])
+	}
+	return existing
+}
+
+// readValue returns a copy of the value of vs, read from the value log if need be.
+func (db *DB) readValue(vs y.ValueStruct) ([]byte, error) {
+	if vs.Meta&bitValuePointer == 0 {
+		return y.SafeCopy(nil, vs.Value), nil
+	}
+	var vp valuePointer
+	vp.Decode(vs.Value)
+	buf, cb, err := db.vlog.Read(vp, nil)
+	defer runCallback(cb)
+	if err != nil {
+		return nil, err
+	}
+	return y.SafeCopy(nil, buf), nil
+}
+
+// mergeDeltas collects the deltas of a key met by a compaction, newest first, to merge them into
+// a single value.
+type mergeDeltas struct {
+	f    MergeFunc
+	keys [][]byte        // With their versions.
+	vs   []y.ValueStruct // As found in the tables.
+	vals [][]byte
+}
+
+// add adds the delta vs of key, which must have a merge operator.
+func (m *mergeDeltas) add(db *DB, key []byte, vs y.ValueStruct) error {
+	if m.f == nil {
+		m.f = db.mergeOps.get(y.ParseKey(key))
+	}
+	val, err := db.readValue(vs)
+	if err != nil {
+		return err
 	}
+	vs.Value = y.SafeCopy(nil, vs.Value)
+	m.keys = append(m.keys, y.SafeCopy(nil, key))
+	m.vs = append(m.vs, vs)
+	m.vals = append(m.vals, val)
+	return nil
 }
 
-// Add records a value in Badger which will eventually be merged by a background
-// routine into the values that were recorded by previous invocations to Add().
+// merged returns the value the deltas make once merged into existing.
+func (m *mergeDeltas) merged(existing []byte, exists bool) y.ValueStruct {
+	return y.ValueStruct{
+		Value:     foldMerge(m.f, existing, exists, m.vals),
+		UserMeta:  m.vs[0].UserMeta,
+		ExpiresAt: m.vs[0].ExpiresAt,
+	}
+}
+
+func (m *mergeDeltas) reset() {
+	m.f = nil
+	m.keys, m.vs, m.vals = m.keys[:0], m.vs[:0], m.vals[:0]
+}
+
+// MergeOperator represents a Badger merge operator.
+//
+// Deprecated: Use DB.RegisterMergeOperator and Txn.Merge, which merge into any number of keys.
+type MergeOperator struct {
+	db  *DB
+	key []byte
+}
+
+// GetMergeOperator registers f as the merge operator of key, like DB.RegisterMergeOperator does
+// for a prefix, and returns a MergeOperator to merge into key. The deltas are merged by reads and
+// compactions, without a goroutine of its own to stop.
+func (db *DB) GetMergeOperator(key []byte, f MergeFunc) *MergeOperator {
+	db.mergeOps.register(mergeOperator{prefix: y.SafeCopy(nil, key), exact: true, f: f})
+	return &MergeOperator{db: db, key: key}
+}
+
+// Add merges val into the value of the key of the merge operator.
 func (op *MergeOperator) Add(val []byte) error {
 	return op.db.Update(func(txn *Txn) error {
-		return txn.SetEntry(NewEntry(op.key, val).withMergeBit())
+		return txn.Merge(op.key, val)
 	})
 }
 
@@ -150,21 +291,14 @@ func (op *MergeOperator) Add(val []byte) error {
 //
 // If Add has not been called even once, Get will return ErrKeyNotFound.
 func (op *MergeOperator) Get() ([]byte, error) {
-	op.RLock()
-	defer op.RUnlock()
-	var existing []byte
-	err := op.db.View(func(txn *Txn) (err error) {
-		existing, _, err = op.iterateAndMerge()
+	var val []byte
+	err := op.db.View(func(txn *Txn) error {
+		item, err := txn.Get(op.key)
+		if err != nil {
+			return err
+		}
+		val, err = item.ValueCopy(nil)
 		return err
 	})
-	if err == errNoMerge {
-		return existing, nil
-	}
-	return existing, err
-}
-
-// Stop waits for any pending merge to complete and then stops the background
-// goroutine.
-func (op *MergeOperator) Stop() {
-	op.closer.SignalAndWait()
+	return val, err
 }
@@ -6,10 +6,11 @@
 package badger
 
 import (
+	"bytes"
 	"encoding/binary"
+	"fmt"
 	"os"
 	"testing"
-	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -17,8 +18,7 @@ import (
 func TestGetMergeOperator(t *testing.T) {
 	t.Run("Get before Add", func(t *testing.T) {
 		runBadgerTest(t, nil, func(t *testing.T, db *DB) {
-			m := db.GetMergeOperator([]byte("merge"), add, 200*time.Millisecond)
-			defer m.Stop()
+			m := db.GetMergeOperator([]byte("merge"), add)
 
 			val, err := m.Get()
 			require.Equal(t, ErrKeyNotFound, err)
@@ -28,8 +28,7 @@ func TestGetMergeOperator(t *testing.T) {
 	t.Run("Add and Get", func(t *testing.T) {
 		key := []byte("merge")
 		runBadgerTest(t, nil, func(t *testing.T, db *DB) {
-			m := db.GetMergeOperator(key, add, 200*time.Millisecond)
-			defer m.Stop()
+			m := db.GetMergeOperator(key, add)
 
 			require.NoError(t, m.Add(uint64ToBytes(1)))
 			require.NoError(t, m.Add(uint64ToBytes(2)))
@@ -47,8 +46,7 @@ func TestGetMergeOperator(t *testing.T) {
 			return append(originalValue, newValue...)
 		}
 		runBadgerTest(t, nil, func(t *testing.T, db *DB) {
-			m := db.GetMergeOperator([]byte("fooprefix"), add, 2*time.Millisecond)
-			defer m.Stop()
+			m := db.GetMergeOperator([]byte("fooprefix"), add)
 
 			require.NoError(t, m.Add([]byte("A")))
 			require.NoError(t, m.Add([]byte("B")))
@@ -62,8 +60,7 @@ func TestGetMergeOperator(t *testing.T) {
 	t.Run("Get Before Compact", func(t *testing.T) {
 		key := []byte("merge")
 		runBadgerTest(t, nil, func(t *testing.T, db *DB) {
-			m := db.GetMergeOperator(key, add, 500*time.Millisecond)
-			defer m.Stop()
+			m := db.GetMergeOperator(key, add)
 
 			require.NoError(t, m.Add(uint64ToBytes(1)))
 			require.NoError(t, m.Add(uint64ToBytes(2)))
@@ -78,13 +75,12 @@ func TestGetMergeOperator(t *testing.T) {
 	t.Run("Get after Delete", func(t *testing.T) {
 		key := []byte("merge")
 		runBadgerTest(t, nil, func(t *testing.T, db *DB) {
-			m := db.GetMergeOperator(key, add, 200*time.Millisecond)
+			m := db.GetMergeOperator(key, add)
 
 			require.NoError(t, m.Add(uint64ToBytes(1)))
 			require.NoError(t, m.Add(uint64ToBytes(2)))
 			require.NoError(t, m.Add(uint64ToBytes(3)))
 
-			m.Stop()
 			res, err := m.Get()
 			require.NoError(t, err)
 			require.Equal(t, uint64(6), bytesToUint64(res))
@@ -93,9 +89,8 @@ func TestGetMergeOperator(t *testing.T) {
 				return txn.Delete(key)
 			}))
 
-			m = db.GetMergeOperator(key, add, 200*time.Millisecond)
+			m = db.GetMergeOperator(key, add)
 			require.NoError(t, m.Add(uint64ToBytes(1)))
-			m.Stop()
 
 			res, err = m.Get()
 			require.NoError(t, err)
@@ -103,21 +98,6 @@ func TestGetMergeOperator(t *testing.T) {
 		})
 	})
 
-	t.Run("Get after Stop", func(t *testing.T) {
-		key := []byte("merge")
-		runBadgerTest(t, nil, func(t *testing.T, db *DB) {
-			m := db.GetMergeOperator(key, add, 1*time.Second)
-
-			require.NoError(t, m.Add(uint64ToBytes(1)))
-			require.NoError(t, m.Add(uint64ToBytes(2)))
-			require.NoError(t, m.Add(uint64ToBytes(3)))
-
-			m.Stop()
-			res, err := m.Get()
-			require.NoError(t, err)
-			require.Equal(t, uint64(6), bytesToUint64(res))
-		})
-	})
 	t.Run("Old keys should be removed after compaction", func(t *testing.T) {
 		dir, err := os.MkdirTemp("", "badger-test")
 		require.NoError(t, err)
@@ -128,7 +108,7 @@ func TestGetMergeOperator(t *testing.T) {
 		db, err := Open(opts)
 		require.NoError(t, err)
 		mergeKey := []byte("foo")
-		m := db.GetMergeOperator(mergeKey, add, 2*time.Millisecond)
+		m := db.GetMergeOperator(mergeKey, add)
 
 		count := 5000 // This will cause compaction from L0->L1
 		for i := 0; i < count; i++ {
@@ -137,7 +117,6 @@ func TestGetMergeOperator(t *testing.T) {
 		value, err := m.Get()
 		require.Nil(t, err)
 		require.Equal(t, uint64(count), bytesToUint64(value))
-		m.Stop()
 
 		// Force compaction by closing DB. The compaction should discard all the old merged values
 		require.Nil(t, db.Close())
@@ -162,6 +141,165 @@ func TestGetMergeOperator(t *testing.T) {
 
 }
 
+func TestRegisterMergeOperator(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		db.RegisterMergeOperator([]byte("counter/"), add)
+		db.RegisterMergeOperator([]byte("counter/list/"), func(existing, delta []byte) []byte {
+			return append(existing, delta...)
+		})
+		get := func(key string) []byte {
+			var val []byte
+			require.NoError(t, db.View(func(txn *Txn) error {
+				item, err := txn.Get([]byte(key))
+				require.NoError(t, err)
+				val, err = item.ValueCopy(nil)
+				return err
+			}))
+			return val
+		}
+
+		require.ErrorIs(t, db.Update(func(txn *Txn) error {
+			return txn.Merge([]byte("other"), uint64ToBytes(1))
+		}), ErrNoMergeOperator)
+
+		// Merges don't read the key, so concurrent transactions don't conflict.
+		txn1, txn2 := db.NewTransaction(true), db.NewTransaction(true)
+		require.NoError(t, txn1.Merge([]byte("counter/a"), uint64ToBytes(1)))
+		require.NoError(t, txn2.Merge([]byte("counter/a"), uint64ToBytes(2)))
+		require.NoError(t, txn1.Commit())
+		require.NoError(t, txn2.Commit())
+		require.Equal(t, uint64(3), bytesToUint64(get("counter/a")))
+
+		// Merging twice into a key in a transaction merges into the pending write.
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			require.NoError(t, txn.Merge([]byte("counter/a"), uint64ToBytes(10)))
+			require.NoError(t, txn.Merge([]byte("counter/a"), uint64ToBytes(20)))
+			item, err := txn.Get([]byte("counter/a"))
+			require.NoError(t, err)
+			require.Equal(t, uint64(33), bytesToUint64(getItemValue(t, item)))
+
+			require.NoError(t, txn.Set([]byte("counter/b"), uint64ToBytes(5)))
+			return txn.Merge([]byte("counter/b"), uint64ToBytes(1))
+		}))
+		require.Equal(t, uint64(33), bytesToUint64(get("counter/a")))
+		require.Equal(t, uint64(6), bytesToUint64(get("counter/b")))
+
+		// The longest prefix wins, and the first delta after a delete is the value.
+		wb := db.NewWriteBatch()
+		for _, v := range []string{"A", "B", "C"} {
+			require.NoError(t, wb.Merge([]byte("counter/list/x"), []byte(v)))
+		}
+		require.NoError(t, wb.Flush())
+		require.Equal(t, "ABC", string(get("counter/list/x")))
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Delete([]byte("counter/list/x"))
+		}))
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Merge([]byte("counter/list/x"), []byte("D"))
+		}))
+		require.Equal(t, "D", string(get("counter/list/x")))
+
+		// Iterators read the merged values, including those of pending writes.
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			require.NoError(t, txn.Merge([]byte("counter/b"), uint64ToBytes(1)))
+			it := txn.NewIterator(DefaultIteratorOptions)
+			defer it.Close()
+			var vals []uint64
+			for it.Seek([]byte("counter/")); it.ValidForPrefix([]byte("counter/")); it.Next() {
+				if !bytes.HasPrefix(it.Item().Key(), []byte("counter/list/")) {
+					vals = append(vals, bytesToUint64(getItemValue(t, it.Item())))
+				}
+			}
+			require.Equal(t, []uint64{33, 7}, vals)
+			return nil
+		}))
+	})
+}
+
+func TestMergeOperatorCompaction(t *testing.T) {
+	dir, err := os.MkdirTemp("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	opts := getTestOptions(dir).WithValueThreshold(16).WithCompactL0OnClose(true)
+	db, err := Open(opts)
+	require.NoError(t, err)
+	db.RegisterMergeOperator([]byte("list/"), func(existing, delta []byte) []byte {
+		return append(existing, delta...)
+	})
+	key := func(i int) []byte { return []byte(fmt.Sprintf("list/%02d", i)) }
+	// Some keys have a value to merge into, and long deltas go to the value log.
+	for i := 0; i < 10; i++ {
+		if i%2 == 0 {
+			require.NoError(t, db.Update(func(txn *Txn) error {
+				return txn.Set(key(i), []byte("base:"))
+			}))
+		}
+		for j := 0; j < 20; j++ {
+			require.NoError(t, db.Update(func(txn *Txn) error {
+				return txn.Merge(key(i), bytes.Repeat([]byte{byte('a' + j)}, 2*i+1))
+			}))
+		}
+	}
+	want := func(i int) []byte {
+		var val []byte
+		if i%2 == 0 {
+			val = []byte("base:")
+		}
+		for j := 0; j < 20; j++ {
+			val = append(val, bytes.Repeat([]byte{byte('a' + j)}, 2*i+1)...)
+		}
+		return val
+	}
+	require.NoError(t, db.View(func(txn *Txn) error {
+		for i := 0; i < 10; i++ {
+			item, err := txn.Get(key(i))
+			require.NoError(t, err)
+			require.Equal(t, want(i), getItemValue(t, item))
+		}
+		return nil
+	}))
+	// Backups hold the merged values.
+	var bak bytes.Buffer
+	_, err = db.Backup(&bak, 0)
+	require.NoError(t, err)
+	restored, err := Open(getTestOptions(t.TempDir()))
+	require.NoError(t, err)
+	require.NoError(t, restored.Load(&bak, 16))
+	require.NoError(t, restored.View(func(txn *Txn) error {
+		for i := 0; i < 10; i++ {
+			item, err := txn.Get(key(i))
+			require.NoError(t, err)
+			require.Equal(t, want(i), getItemValue(t, item))
+		}
+		return nil
+	}))
+	require.NoError(t, restored.Close())
+
+	// Close flushes the deltas to L0, and compacts it.
+	require.NoError(t, db.Close())
+
+	// The deltas were merged by the compaction: the values are read right without the operator,
+	// and a single version of every key is left.
+	db, err = Open(opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	require.NoError(t, db.View(func(txn *Txn) error {
+		iopt := DefaultIteratorOptions
+		iopt.AllVersions = true
+		it := txn.NewIterator(iopt)
+		defer it.Close()
+		var i int
+		for it.Rewind(); it.Valid(); it.Next() {
+			require.Equal(t, key(i), it.Item().Key())
+			require.Equal(t, want(i), getItemValue(t, it.Item()))
+			i++
+		}
+		require.Equal(t, 10, i)
+		return nil
+	}))
+}
+
 func uint64ToBytes(i uint64) []byte {
 	var buf [8]byte
 	binary.BigEndian.PutUint64(buf[:], i)
@@ -176,3 +314,61 @@ func bytesToUint64(b []byte) uint64 {
 func add(existing, latest []byte) []byte {
 	return uint64ToBytes(bytesToUint64(existing) + bytesToUint64(latest))
 }
+
+func TestMergeOperatorSnapshot(t *testing.T) {
+	db, err := Open(getTestOptions(t.TempDir()).WithNumCompactors(0))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	db.RegisterMergeOperator([]byte("ctr/"), func(existing, delta []byte) []byte {
+		return uint64ToBytes(binary.BigEndian.Uint64(existing) + binary.BigEndian.Uint64(delta))
+	})
+	key := func(i int) []byte { return []byte(fmt.Sprintf("ctr/%03d", i)) }
+
+	// The reads of a transaction see the same values while compactions merge the deltas below.
+	for round := 1; round <= 5; round++ {
+		for j := 0; j < 10; j++ {
+			require.NoError(t, db.Update(func(txn *Txn) error {
+				for i := 0; i < 200; i++ {
+					if err := txn.Merge(key(i), uint64ToBytes(1)); err != nil {
+						return err
+					}
+				}
+				return nil
+			}))
+		}
+		require.NoError(t, db.flushMemTableForCheckpoint())
+		txn := db.NewTransaction(false)
+		want := uint64(10 * round)
+		stop, read := make(chan struct{}), make(chan error)
+		go func() {
+			for {
+				select {
+				case <-stop:
+					read <- nil
+					return
+				default:
+				}
+				for i := 0; i < 200; i++ {
+					item, err := txn.Get(key(i))
+					if err == nil {
+						var val []byte
+						if val, err = item.ValueCopy(nil); err == nil &&
+							binary.BigEndian.Uint64(val) != want {
+							err = fmt.Errorf("Key %s is %d, not %d", key(i),
+								binary.BigEndian.Uint64(val), want)
+						}
+					}
+					if err != nil {
+						read <- err
+						return
+					}
+				}
+			}
+		}()
+		prio := compactionPriority{level: 0, score: 1.71, t: db.lc.levelTargets()}
+		require.NoError(t, db.lc.doCompact(-1, prio))
+		close(stop)
+		require.NoError(t, <-read)
+		txn.Discard()
+	}
+}
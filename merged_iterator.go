@@ -0,0 +1,283 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"errors"
+)
+
+// SortedSource is a sorted source of keys merged with those of a DB by a MergedIterator, like an
+// in-memory overlay of writes, or a remote shard. It yields the newest version of every key, or
+// its newest versions first, in the order of the MergedIterator: ascending, or descending if
+// IteratorOptions.Reverse is set. Its key, version and value are only valid until it moves.
+type SortedSource interface {
+	// Rewind moves to the first key, and Seek to the first key at or after key, or at or before
+	// key in reverse.
+	Rewind()
+	Seek(key []byte)
+	Next()
+	Valid() bool
+
+	Key() []byte
+	Version() uint64
+	// IsDeleted returns whether the version is a tombstone, hiding the older versions of the key
+	// in the other sources.
+	IsDeleted() bool
+	Value() ([]byte, error)
+
+	Close() error
+}
+
+// NewIteratorSource returns the SortedSource of the keys of it, such as those of another DB.
+// It should have IteratorOptions.ShowTombstones set, for its deletes to hide the keys of the
+// other sources, and not AllVersions. Closing the source closes it.
+func NewIteratorSource(it *Iterator) SortedSource {
+	return &iteratorSource{Iterator: it}
+}
+
+type iteratorSource struct {
+	*Iterator
+	// read is whether the current key was tracked as read by the transaction.
+	read bool
+}
+
+func (s *iteratorSource) Rewind() {
+	s.read = false
+	s.Iterator.Rewind()
+}
+
+func (s *iteratorSource) Seek(key []byte) {
+	s.read = false
+	s.Iterator.Seek(key)
+}
+
+func (s *iteratorSource) Next() {
+	s.read = false
+	s.Iterator.Next()
+}
+
+func (s *iteratorSource) Key() []byte {
+	if !s.read {
+		// Like the keys of Iterator.Item, the first time only.
+		s.read = true
+		return s.Item().Key()
+	}
+	return s.item.Key()
+}
+
+func (s *iteratorSource) Version() uint64 {
+	return s.item.Version()
+}
+
+func (s *iteratorSource) IsDeleted() bool {
+	return s.item.IsDeletedOrExpired()
+}
+
+func (s *iteratorSource) Value() ([]byte, error) {
+	return s.Item().ValueCopy(nil)
+}
+
+func (s *iteratorSource) Close() error {
+	s.Iterator.Close()
+	return s.Err()
+}
+
+// MergedIterator iterates over the keys of a DB merged with those of SortedSources, as one
+// store. Of the versions of a key in the DB and the sources, the newest wins, and on equal
+// versions, the one of the first source, the DB coming after the sources: an overlay source
+// shadows the DB with the versions it has at the read timestamp of the transaction. A key whose
+// winning version is a tombstone is skipped, unless IteratorOptions.ShowTombstones is set.
+type MergedIterator struct {
+	sources []SortedSource
+	reverse bool
+	prefix  []byte
+	// showTombstones yields the keys whose winning version is a tombstone.
+	showTombstones bool
+
+	key    []byte
+	winner int // The index in sources of the winning version of key, -1 when done.
+}
+
+// NewMergedIterator returns a MergedIterator over the keys of txn merged with those of sources,
+// iterated with opt. AllVersions isn't supported. The keys of the sources outside of
+// opt.Prefix are skipped. Closing the iterator closes the sources.
+//
+//	it := txn.NewMergedIterator(badger.DefaultIteratorOptions, overlay)
+//	defer it.Close()
+//	for it.Rewind(); it.Valid(); it.Next() {
+//		val, err := it.Value()
+//		...
+//	}
+func (txn *Txn) NewMergedIterator(opt IteratorOptions, sources ...SortedSource) *MergedIterator {
+	if opt.AllVersions {
+		panic("AllVersions isn't supported by a MergedIterator")
+	}
+	mi := &MergedIterator{
+		reverse:        opt.Reverse,
+		prefix:         opt.Prefix,
+		showTombstones: opt.ShowTombstones,
+		winner:         -1,
+	}
+	opt.ShowTombstones = true
+	if opt.Reverse {
+		// The iterator of the DB isn't valid past the prefix, where a reverse seek to its end can
+		// land, so the prefix is checked here like for the sources.
+		opt.Prefix = nil
+	}
+	mi.sources = append(append(mi.sources, sources...), NewIteratorSource(txn.NewIterator(opt)))
+	return mi
+}
+
+// Rewind moves to the first key, or the last one in reverse.
+func (mi *MergedIterator) Rewind() {
+	// In reverse, the last key within the prefix is at or before the end of it.
+	start := mi.prefix
+	if mi.reverse {
+		start = prefixEnd(mi.prefix)
+	}
+	for _, s := range mi.sources {
+		if len(start) > 0 {
+			s.Seek(start)
+		} else {
+			s.Rewind()
+		}
+	}
+	mi.settle()
+}
+
+// Seek moves to the first key at or after key, or at or before key in reverse.
+func (mi *MergedIterator) Seek(key []byte) {
+	if len(key) == 0 {
+		mi.Rewind()
+		return
+	}
+	if !mi.reverse && bytes.Compare(key, mi.prefix) < 0 {
+		key = mi.prefix
+	}
+	for _, s := range mi.sources {
+		s.Seek(key)
+	}
+	mi.settle()
+}
+
+// Next moves to the next key.
+func (mi *MergedIterator) Next() {
+	if mi.winner < 0 {
+		return
+	}
+	mi.skipKey()
+	mi.settle()
+}
+
+// Valid returns whether the iterator is on a key.
+func (mi *MergedIterator) Valid() bool {
+	return mi.winner >= 0
+}
+
+// Key returns the current key. It's valid until the iterator moves.
+func (mi *MergedIterator) Key() []byte {
+	return mi.key
+}
+
+// Version returns the version of the current key.
+func (mi *MergedIterator) Version() uint64 {
+	return mi.sources[mi.winner].Version()
+}
+
+// IsDeleted returns whether the current key is a tombstone, which is only yielded with
+// IteratorOptions.ShowTombstones.
+func (mi *MergedIterator) IsDeleted() bool {
+	return mi.sources[mi.winner].IsDeleted()
+}
+
+// Value returns the value of the current key. It's valid until the iterator moves.
+func (mi *MergedIterator) Value() ([]byte, error) {
+	return mi.sources[mi.winner].Value()
+}
+
+// Source returns the index of the source of the current key in those passed to
+// NewMergedIterator, or -1 if it's from the DB.
+func (mi *MergedIterator) Source() int {
+	if mi.winner == len(mi.sources)-1 {
+		return -1
+	}
+	return mi.winner
+}
+
+// Close closes the sources, and the iterator of the DB.
+func (mi *MergedIterator) Close() error {
+	var errs []error
+	for _, s := range mi.sources {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// valid returns whether s is on a key within the prefix, skipping the keys before it in the order
+// of iteration.
+func (mi *MergedIterator) valid(s SortedSource) bool {
+	for ; s.Valid(); s.Next() {
+		key := s.Key()
+		if bytes.HasPrefix(key, mi.prefix) {
+			return true
+		}
+		// The keys past the prefix are out of it too.
+		if (bytes.Compare(key, mi.prefix) > 0) != mi.reverse {
+			return false
+		}
+	}
+	return false
+}
+
+// compare compares a and b in the order of iteration.
+func (mi *MergedIterator) compare(a, b []byte) int {
+	if mi.reverse {
+		return bytes.Compare(b, a)
+	}
+	return bytes.Compare(a, b)
+}
+
+// settle moves to the next key of the sources whose winning version isn't a tombstone, unless
+// they're shown.
+func (mi *MergedIterator) settle() {
+	for {
+		mi.winner = -1
+		for i, s := range mi.sources {
+			if !mi.valid(s) {
+				continue
+			}
+			if mi.winner < 0 {
+				mi.winner = i
+				continue
+			}
+			w := mi.sources[mi.winner]
+			switch c := mi.compare(s.Key(), w.Key()); {
+			case c < 0, c == 0 && s.Version() > w.Version():
+				mi.winner = i
+			}
+		}
+		if mi.winner < 0 {
+			mi.key = mi.key[:0]
+			return
+		}
+		w := mi.sources[mi.winner]
+		mi.key = append(mi.key[:0], w.Key()...)
+		if mi.showTombstones || !w.IsDeleted() {
+			return
+		}
+		mi.skipKey()
+	}
+}
+
+// skipKey moves the sources past the versions of the current key.
+func (mi *MergedIterator) skipKey() {
+	for _, s := range mi.sources {
+		for s.Valid() && bytes.Equal(s.Key(), mi.key) {
+			s.Next()
+		}
+	}
+}
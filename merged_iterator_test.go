@@ -0,0 +1,130 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// overlaySource is an in-memory SortedSource.
+type overlaySource struct {
+	entries []overlayEntry
+	reverse bool
+	pos     int
+	closed  bool
+}
+
+type overlayEntry struct {
+	key, val string
+	version  uint64
+	deleted  bool
+}
+
+func newOverlaySource(reverse bool, entries ...overlayEntry) *overlaySource {
+	sort.Slice(entries, func(i, j int) bool {
+		if reverse {
+			return entries[i].key > entries[j].key
+		}
+		return entries[i].key < entries[j].key
+	})
+	return &overlaySource{entries: entries, reverse: reverse}
+}
+
+func (s *overlaySource) Rewind() { s.pos = 0 }
+
+func (s *overlaySource) Seek(key []byte) {
+	s.pos = sort.Search(len(s.entries), func(i int) bool {
+		c := bytes.Compare([]byte(s.entries[i].key), key)
+		return (!s.reverse && c >= 0) || (s.reverse && c <= 0)
+	})
+}
+
+func (s *overlaySource) Next()                  { s.pos++ }
+func (s *overlaySource) Valid() bool            { return s.pos < len(s.entries) }
+func (s *overlaySource) Key() []byte            { return []byte(s.entries[s.pos].key) }
+func (s *overlaySource) Version() uint64        { return s.entries[s.pos].version }
+func (s *overlaySource) IsDeleted() bool        { return s.entries[s.pos].deleted }
+func (s *overlaySource) Value() ([]byte, error) { return []byte(s.entries[s.pos].val), nil }
+func (s *overlaySource) Close() error           { s.closed = true; return nil }
+
+func TestMergedIterator(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		set := func(key, val string) {
+			require.NoError(t, db.Update(func(txn *Txn) error {
+				return txn.Set([]byte(key), []byte(val))
+			}))
+		}
+		set("a", "db")
+		set("b", "db")
+		set("c", "db")
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Delete([]byte("d"))
+		}))
+		// With the next writes, the DB has a@1, c@3, d@4 deleted, b@5 and e@6.
+		set("b", "db")
+		set("e", "db")
+
+		entries := func(reverse bool) []overlayEntry {
+			return []overlayEntry{
+				{key: "a", val: "overlay", version: 2},                // Newer than the DB.
+				{key: "b", val: "overlay", version: 2},                // Older than the DB.
+				{key: "c", version: 10, deleted: true},                // Deletes the key of the DB.
+				{key: "d", val: "overlay", version: 3},                // Deleted by the DB.
+				{key: "e", val: "overlay", version: 6},                // As new as the DB.
+				{key: "f", val: "overlay", version: 1},                // Only in the overlay.
+				{key: "g", val: "deleted", version: 1, deleted: true}, // Deleted in the overlay.
+			}
+		}
+		scan := func(opt IteratorOptions, seek string) []string {
+			txn := db.NewTransaction(false)
+			defer txn.Discard()
+			overlay := newOverlaySource(opt.Reverse, entries(opt.Reverse)...)
+			it := txn.NewMergedIterator(opt, overlay)
+			var got []string
+			for it.Seek([]byte(seek)); it.Valid(); it.Next() {
+				val, err := it.Value()
+				require.NoError(t, err)
+				got = append(got, fmt.Sprintf("%s=%s@%d", it.Key(), val, it.Source()))
+			}
+			require.NoError(t, it.Close())
+			require.True(t, overlay.closed)
+			return got
+		}
+
+		want := []string{"a=overlay@0", "b=db@-1", "e=overlay@0", "f=overlay@0"}
+		require.Equal(t, want, scan(IteratorOptions{}, ""))
+		require.Equal(t, want[2:], scan(IteratorOptions{}, "c"))
+		require.Equal(t, []string{"f=overlay@0", "e=overlay@0", "b=db@-1", "a=overlay@0"},
+			scan(IteratorOptions{Reverse: true}, ""))
+		require.Equal(t, []string{"b=db@-1", "a=overlay@0"},
+			scan(IteratorOptions{Reverse: true}, "d"))
+
+		set("ba", "db")
+		require.Equal(t, []string{"b=db@-1", "ba=db@-1"},
+			scan(IteratorOptions{Prefix: []byte("b")}, ""))
+		require.Equal(t, []string{"ba=db@-1", "b=db@-1"},
+			scan(IteratorOptions{Prefix: []byte("b"), Reverse: true}, ""))
+
+		// The tombstones, when shown.
+		txn := db.NewTransaction(false)
+		defer txn.Discard()
+		it := txn.NewMergedIterator(IteratorOptions{ShowTombstones: true},
+			newOverlaySource(false, entries(false)...))
+		defer func() { require.NoError(t, it.Close()) }()
+		var deleted []string
+		for it.Rewind(); it.Valid(); it.Next() {
+			if it.IsDeleted() {
+				deleted = append(deleted, fmt.Sprintf("%s@%d", it.Key(), it.Version()))
+			}
+		}
+		require.Equal(t, []string{"c@10", "d@4", "g@1"}, deleted)
+	})
+}
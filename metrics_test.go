@@ -7,10 +7,14 @@ package badger
 
 import (
 	"expvar"
+	"fmt"
 	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/y"
 )
 
 func clearAllMetrics() {
@@ -190,3 +194,103 @@ func TestReadMetrics(t *testing.T) {
 		require.Equal(t, int64(1), rangeQueries.(*expvar.Int).Value())
 	})
 }
+
+func TestPerDBMetrics(t *testing.T) {
+	perDB := func(label string) *expvar.Map {
+		v := expvar.Get("badger_db").(*expvar.Map).Get(label)
+		if v == nil {
+			return nil
+		}
+		return v.(*expvar.Map)
+	}
+	puts := func(label string) int64 {
+		return perDB(label).Get("put_num_user").(*expvar.Int).Value()
+	}
+
+	open := func(label string) *DB {
+		db, err := Open(DefaultOptions("").WithInMemory(true).WithMetricsLabel(label))
+		require.NoError(t, err)
+		return db
+	}
+	db1, db2 := open("tenant-1"), open("tenant-2")
+	before := expvar.Get("badger_put_num_user").(*expvar.Int).Value()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, db1.Update(func(txn *Txn) error {
+			return txn.Set([]byte("key"), []byte("value"))
+		}))
+	}
+	require.NoError(t, db2.Update(func(txn *Txn) error {
+		return txn.Set([]byte("key"), []byte("value"))
+	}))
+
+	// Every commit also writes an entry marking the end of the transaction.
+	require.Equal(t, int64(6), puts("tenant-1"))
+	require.Equal(t, int64(2), puts("tenant-2"))
+	// The process-wide metric keeps the sum.
+	require.Equal(t, before+8, expvar.Get("badger_put_num_user").(*expvar.Int).Value())
+
+	require.NoError(t, db1.Close())
+	require.Nil(t, perDB("tenant-1"))
+	require.NotNil(t, perDB("tenant-2"))
+	require.NoError(t, db2.Close())
+
+	db3, err := Open(DefaultOptions("").WithInMemory(true).WithMetricsEnabled(false))
+	require.NoError(t, err)
+	require.Nil(t, db3.metrics)
+	require.NoError(t, db3.Close())
+}
+
+func TestAgeGauges(t *testing.T) {
+	db, err := Open(getTestOptions(t.TempDir()).WithMetricsLabel("ages"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	gauge := func(name string) int64 {
+		return db.metrics.Vars().Get(name).(y.Gauge).Value()
+	}
+	require.Zero(t, gauge("unflushed_age_ms_memtable"))
+	require.Zero(t, gauge("unsynced_age_ms_logs"))
+	require.Nil(t, db.metrics.Vars().Get("apply_lag_ms_follower"))
+
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.Set([]byte("key"), []byte("value"))
+	}))
+	time.Sleep(20 * time.Millisecond)
+	require.GreaterOrEqual(t, gauge("unflushed_age_ms_memtable"), int64(20))
+	require.GreaterOrEqual(t, gauge("unsynced_age_ms_logs"), int64(20))
+
+	// Syncing resets the age of the unsynced writes, not of the unflushed ones.
+	require.NoError(t, db.Sync())
+	require.Zero(t, gauge("unsynced_age_ms_logs"))
+	require.NotZero(t, gauge("unflushed_age_ms_memtable"))
+}
+
+func TestLatencyHistograms(t *testing.T) {
+	opt := getTestOptions("").WithLatencyBuckets([]time.Duration{time.Millisecond, time.Second})
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		for i := 0; i < 5; i++ {
+			require.NoError(t, db.Update(func(txn *Txn) error {
+				return txn.Set([]byte(fmt.Sprintf("key%d", i)), []byte("value"))
+			}))
+		}
+		require.NoError(t, db.View(func(txn *Txn) error {
+			_, err := txn.Get([]byte("key1"))
+			require.NoError(t, err)
+			it := txn.NewIterator(DefaultIteratorOptions)
+			defer it.Close()
+			it.Seek([]byte("key3"))
+			return nil
+		}))
+
+		hs := db.LatencyHistograms()
+		require.Equal(t, int64(5), hs["commit"].Count)
+		require.Equal(t, int64(5), hs["put"].Count)
+		require.Equal(t, int64(1), hs["get"].Count)
+		require.Equal(t, int64(1), hs["iterator_seek"].Count)
+		require.Equal(t, []int64{1000, 1000000}, hs["get"].Bounds)
+
+		perDB := expvar.Get("badger_db").(*expvar.Map).Get(db.metrics.Label()).(*expvar.Map)
+		commit := perDB.Get("latency_us").(*expvar.Map).Get("commit")
+		require.Contains(t, commit.String(), `"count":5`)
+	})
+}
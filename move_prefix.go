@@ -0,0 +1,271 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+
+	"github.com/luxfi/zapdb/table"
+	"github.com/luxfi/zapdb/y"
+)
+
+// moveVersionGap is the number of versions DB.MovePrefix leaves, below the version it writes the
+// moved keys at, to the transactions committing while it builds their tables.
+const moveVersionGap = 1 << 32
+
+// checkMove returns an error unless the keys with prefix src can be moved to prefix dst.
+func checkMove(src, dst []byte) error {
+	switch {
+	case bytes.HasPrefix(src, dst) || bytes.HasPrefix(dst, src):
+		return ErrOverlappingPrefixes
+	case bytes.HasPrefix(dst, badgerPrefix) || bytes.HasPrefix(badgerPrefix, dst):
+		return ErrInvalidKey
+	case prefixEnd(src) == nil:
+		return ErrInvalidRange
+	}
+	return nil
+}
+
+// moveKey returns key, which starts with src, with dst instead.
+func moveKey(key, src, dst []byte) []byte {
+	out := make([]byte, 0, len(dst)+len(key)-len(src))
+	return append(append(out, dst...), key[len(src):]...)
+}
+
+// MovePrefix moves the keys with prefix src, as read by the transaction, to prefix dst, with their
+// values, user metadata and expiry, as of the commit of the transaction. The keys under src are
+// deleted by a single range tombstone, see DeleteRange. Keys already under dst are kept, unless a
+// moved key replaces them. It returns ErrOverlappingPrefixes if one of the prefixes starts with
+// the other.
+//
+// The moved keys are written by the transaction, so MovePrefix is meant for small ranges, and
+// returns ErrTxnTooBig otherwise: DB.MovePrefix moves prefixes of any size. Like the other writes
+// of the transaction, the move is seen by reads all at once, or not at all if the DB crashes
+// before the commit is done.
+func (txn *Txn) MovePrefix(src, dst []byte) error {
+	if err := checkMove(src, dst); err != nil {
+		return err
+	}
+	opt := DefaultIteratorOptions
+	opt.Prefix = src
+	it := txn.NewIterator(opt)
+	var entries []*Entry
+	var moved []uint64
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			it.Close()
+			return err
+		}
+		moved = append(moved, z.MemHash(item.Key()))
+		e := NewEntry(moveKey(item.Key(), src, dst), val).WithMeta(item.UserMeta())
+		e.ExpiresAt = item.ExpiresAt()
+		entries = append(entries, e)
+	}
+	it.Close()
+
+	if err := txn.DeleteRange(src, prefixEnd(src)); err != nil {
+		return err
+	}
+	// The keys moved are written by the transaction, for those which read them to conflict with
+	// it.
+	if txn.db.opt.DetectConflicts {
+		for _, fp := range moved {
+			txn.conflictKeys[fp] = struct{}{}
+		}
+	}
+	for _, e := range entries {
+		if err := txn.SetEntry(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MovePrefix moves the keys with prefix src to prefix dst, like Txn.MovePrefix, whatever their
+// number. The keys are read from a snapshot, and written with their values into new tables, at a
+// version above those of the transactions committing meanwhile. The tables, with the range
+// tombstone deleting the keys under src, are then added to the levels at once, by a single change
+// of the manifest, like by IngestExternalFiles: reads see all the keys moved, or none, even if the
+// DB crashes. The moved keys don't go through the memtables, nor the compactions of the levels
+// above their tables.
+//
+// The writes only wait for the tables to be added. The transactions which read keys under src or
+// dst before the move conflict with it, and the move fails with ErrConflict if keys under src are
+// written while it reads them. Without Options.DetectConflicts, those keys are deleted by the move.
+//
+// The calls to MovePrefix run one at a time. It isn't supported in InMemory mode, where
+// Txn.MovePrefix is to be used, nor on ManagedDB. Calling this would result in a panic.
+func (db *DB) MovePrefix(src, dst []byte) (err error) {
+	if db.opt.managedTxns {
+		panic("Cannot use MovePrefix with managedDB=true.")
+	}
+	switch {
+	case db.opt.ReadOnly:
+		return ErrReadOnlyDB
+	case db.opt.InMemory:
+		return errors.New("Cannot move keys into tables in InMemory mode, see Txn.MovePrefix")
+	case db.IsClosed():
+		return ErrDBClosed
+	}
+	if err := checkMove(src, dst); err != nil {
+		return err
+	}
+	db.moveLock.Lock()
+	defer db.moveLock.Unlock()
+
+	txn := db.newTransactionWithOptions(true, false, TxnOptions{Isolation: SerializableSnapshot})
+	defer txn.Discard()
+	version := txn.readTs + moveVersionGap
+	tables, err := db.buildMoveTables(txn, src, dst, version)
+	if err != nil {
+		return err
+	}
+	// The tables are deleted if they aren't ingested, and released by the levels otherwise.
+	defer func() {
+		for _, et := range tables {
+			if derr := et.t.DecrRef(); derr != nil && err == nil {
+				err = derr
+			}
+		}
+	}()
+	if len(tables) == 0 {
+		return nil
+	}
+
+	tombstone := rangeTombstone{start: y.SafeCopy(nil, src), end: prefixEnd(src), version: version}
+	return db.ingestFenced(tables, func() error {
+		conflict, err := db.orc.commitMove(txn, version)
+		if conflict != nil {
+			db.recordConflict(conflict)
+			return conflict
+		}
+		if err != nil {
+			return err
+		}
+		defer db.orc.doneCommit(version)
+		if err := db.lc.ingestTables(tables); err != nil {
+			return err
+		}
+		db.rangeDels.add(tombstone)
+		return nil
+	})
+}
+
+// buildMoveTables writes the keys with prefix src read by txn into new tables, under prefix dst,
+// at version, and the range tombstone deleting them into a table of its own, after them. It
+// returns no table if there's no key to move.
+func (db *DB) buildMoveTables(txn *Txn, src, dst []byte, version uint64) (
+	tables []*externalTable, err error) {
+	defer func() {
+		if err != nil {
+			for _, et := range tables {
+				_ = et.t.DecrRef()
+			}
+			tables = nil
+		}
+	}()
+	bopts := buildTableOptions(db)
+	var builder *table.Builder
+	finish := func() error {
+		if builder == nil {
+			return nil
+		}
+		fname := table.NewFilename(db.lc.reserveFileID(), db.opt.Dir)
+		t, err := table.CreateTable(fname, builder)
+		builder.Close()
+		builder = nil
+		if err != nil {
+			return y.Wrapf(err, "while creating table %s", fname)
+		}
+		tables = append(tables, &externalTable{path: fname, t: t, minVersion: version})
+		return nil
+	}
+	defer func() {
+		if builder != nil {
+			builder.Close()
+		}
+	}()
+
+	opt := DefaultIteratorOptions
+	opt.Prefix = src
+	it := txn.NewIterator(opt)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		key := moveKey(item.Key(), src, dst)
+		if len(key) > db.opt.MaxKeySize {
+			return nil, exceedsSize(ErrKeyTooLarge, "Key", int64(db.opt.MaxKeySize), key)
+		}
+		if err := db.isBanned(key); err != nil {
+			return nil, err
+		}
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return nil, y.Wrapf(err, "while reading value of key %q", item.Key())
+		}
+		if builder == nil {
+			builder = table.NewTableBuilder(bopts)
+		}
+		builder.Add(y.KeyWithTs(key, version), y.ValueStruct{
+			Value:     val,
+			UserMeta:  item.UserMeta(),
+			ExpiresAt: item.ExpiresAt(),
+		}, 0)
+		// Both keys are written by the move, for the transactions which read them to conflict
+		// with it.
+		if txn.conflictKeys != nil {
+			txn.conflictKeys[z.MemHash(item.Key())] = struct{}{}
+			txn.conflictKeys[z.MemHash(key)] = struct{}{}
+		}
+		if builder.ReachedCapacity() {
+			if err := finish(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	if len(tables) == 0 {
+		return nil, nil
+	}
+
+	builder = table.NewTableBuilder(bopts)
+	builder.Add(y.KeyWithTs(rangeTombstoneKey(src, prefixEnd(src)), version), y.ValueStruct{}, 0)
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	// The tables must be found after a crash once the manifest refers to them.
+	return tables, db.syncDir(db.opt.Dir)
+}
+
+// commitMove commits txn at ts, the version reserved by DB.MovePrefix, or returns the conflict it
+// fails with. It fails if the transactions committed meanwhile took ts.
+func (o *oracle) commitMove(txn *Txn, ts uint64) (*ConflictError, error) {
+	o.Lock()
+	defer o.Unlock()
+
+	if conflict := o.findConflict(txn); conflict != nil {
+		return conflict, nil
+	}
+	if conflict := o.preparedConflict(txn); conflict != nil {
+		return conflict, nil
+	}
+	if o.nextTxnTs > ts {
+		return nil, errors.New("Too many transactions committed while the keys were moved")
+	}
+	o.doneRead(txn)
+	o.cleanupCommittedTransactions()
+	o.nextTxnTs = ts + 1
+	o.txnMark.Begin(ts)
+	o.addCommitted(txn, ts)
+	return nil, nil
+}
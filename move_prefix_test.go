@@ -0,0 +1,204 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// prefixKeys returns the keys with prefix, with their values.
+func prefixKeys(t *testing.T, db *DB, prefix string) map[string][]byte {
+	out := make(map[string][]byte)
+	require.NoError(t, db.View(func(txn *Txn) error {
+		opt := DefaultIteratorOptions
+		opt.Prefix = []byte(prefix)
+		it := txn.NewIterator(opt)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			val, err := it.Item().ValueCopy(nil)
+			require.NoError(t, err)
+			out[string(it.Item().Key())] = val
+		}
+		return nil
+	}))
+	return out
+}
+
+func TestMovePrefix(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(getTestOptions(dir))
+	require.NoError(t, err)
+
+	val := func(i int) []byte { return bytes.Repeat([]byte{byte(i)}, 1<<10) }
+	wb := db.NewWriteBatch()
+	for i := 0; i < 1000; i++ {
+		e := NewEntry([]byte(fmt.Sprintf("a/%04d", i)), val(i))
+		if i == 0 {
+			e.WithMeta(7)
+		}
+		require.NoError(t, wb.SetEntry(e))
+	}
+	require.NoError(t, wb.Set([]byte("b/0"), []byte("b")))
+	require.NoError(t, wb.Flush())
+
+	// A transaction which read a moved key conflicts with the move.
+	txn := db.NewTransaction(true)
+	defer txn.Discard()
+	_, err = txn.Get([]byte("a/0001"))
+	require.NoError(t, err)
+	require.NoError(t, txn.Set([]byte("b/1"), []byte("b")))
+
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		require.ErrorIs(t, txn.MovePrefix([]byte("a/"), []byte("!badger!a/")), ErrInvalidKey)
+		return txn.MovePrefix([]byte("a/"), []byte("c/"))
+	}))
+	require.ErrorIs(t, txn.Commit(), ErrConflict)
+
+	check := func() {
+		require.Empty(t, prefixKeys(t, db, "a/"))
+		moved := prefixKeys(t, db, "c/")
+		require.Len(t, moved, 1000)
+		for i := 0; i < 1000; i++ {
+			require.Equal(t, val(i), moved[fmt.Sprintf("c/%04d", i)])
+		}
+		require.Len(t, prefixKeys(t, db, "b/"), 1)
+		require.NoError(t, db.View(func(txn *Txn) error {
+			item, err := txn.Get([]byte("c/0000"))
+			require.NoError(t, err)
+			require.Equal(t, byte(7), item.UserMeta())
+			return nil
+		}))
+	}
+	check()
+
+	// The move is replayed from the WAL.
+	require.NoError(t, db.Close())
+	db, err = Open(getTestOptions(dir))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	check()
+}
+
+func TestDBMovePrefix(t *testing.T) {
+	dir := t.TempDir()
+	opt := getTestOptions(dir).WithMemTableSize(1 << 20).WithBaseTableSize(256 << 10).
+		WithValueThreshold(1 << 10)
+	db, err := Open(opt)
+	require.NoError(t, err)
+
+	val := func(i int) []byte { return bytes.Repeat([]byte{byte(i)}, 1<<10) }
+	wb := db.NewWriteBatch()
+	for i := 0; i < 2000; i++ {
+		e := NewEntry([]byte(fmt.Sprintf("a/%04d", i)), val(i))
+		if i == 0 {
+			e.WithMeta(7)
+		}
+		require.NoError(t, wb.SetEntry(e))
+	}
+	require.NoError(t, wb.Set([]byte("b/0"), []byte("b")))
+	require.NoError(t, wb.Set([]byte("c/0001"), []byte("c")))
+	require.NoError(t, wb.Set([]byte("c/x"), []byte("c")))
+	require.NoError(t, wb.Flush())
+
+	require.NoError(t, db.MovePrefix([]byte("d/"), []byte("e/")))
+	require.ErrorIs(t, db.MovePrefix([]byte("a"), []byte("a/0")), ErrOverlappingPrefixes)
+	require.ErrorIs(t, db.MovePrefix([]byte("a/"), []byte("!badger!a/")), ErrInvalidKey)
+	require.ErrorIs(t, db.Update(func(txn *Txn) error {
+		return txn.MovePrefix([]byte("a/"), []byte("c/"))
+	}), ErrTxnTooBig)
+
+	// A transaction which read a moved key conflicts with the move, and those started before it
+	// don't see it.
+	txn := db.NewTransaction(true)
+	defer txn.Discard()
+	_, err = txn.Get([]byte("a/0001"))
+	require.NoError(t, err)
+	require.NoError(t, txn.Set([]byte("b/1"), []byte("b")))
+	snap := db.NewTransaction(false)
+	defer snap.Discard()
+
+	require.NoError(t, db.MovePrefix([]byte("a/"), []byte("c/")))
+	require.ErrorIs(t, txn.Commit(), ErrConflict)
+	require.Len(t, prefixKeysTxn(t, snap, "a/"), 2000)
+	require.Equal(t, []string{"c/0001", "c/x"}, prefixKeysTxn(t, snap, "c/"))
+
+	// The keys written under src after the move are kept.
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.Set([]byte("a/new"), []byte("a"))
+	}))
+
+	check := func() {
+		require.Equal(t, map[string][]byte{"a/new": []byte("a")}, prefixKeys(t, db, "a/"))
+		moved := prefixKeys(t, db, "c/")
+		require.Len(t, moved, 2001)
+		for i := 0; i < 2000; i++ {
+			require.Equal(t, val(i), moved[fmt.Sprintf("c/%04d", i)])
+		}
+		require.Equal(t, []byte("c"), moved["c/x"])
+		require.Len(t, prefixKeys(t, db, "b/"), 1)
+		require.NoError(t, db.View(func(txn *Txn) error {
+			item, err := txn.Get([]byte("c/0000"))
+			require.NoError(t, err)
+			require.Equal(t, byte(7), item.UserMeta())
+			return nil
+		}))
+	}
+	check()
+
+	// The moved keys are in the tables of the manifest, and the keys under src still deleted.
+	require.NoError(t, db.Close())
+	db, err = Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	check()
+}
+
+func TestTxnMovePrefix(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			for _, k := range []string{"a/0", "a/1", "c/1", "c/2"} {
+				if err := txn.Set([]byte(k), []byte(k)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			// Pending writes are moved too.
+			if err := txn.Set([]byte("a/2"), []byte("a/2")); err != nil {
+				return err
+			}
+			require.ErrorIs(t, txn.MovePrefix([]byte("a/"), []byte("a/b")), ErrOverlappingPrefixes)
+			if err := txn.MovePrefix([]byte("a/"), []byte("c/")); err != nil {
+				return err
+			}
+			require.Empty(t, prefixKeysTxn(t, txn, "a/"))
+			return nil
+		}))
+		require.Empty(t, prefixKeys(t, db, "a/"))
+		require.Equal(t, map[string][]byte{
+			"c/0": []byte("a/0"),
+			"c/1": []byte("a/1"),
+			"c/2": []byte("a/2"),
+		}, prefixKeys(t, db, "c/"))
+	})
+}
+
+func prefixKeysTxn(t *testing.T, txn *Txn, prefix string) []string {
+	opt := DefaultIteratorOptions
+	opt.Prefix = []byte(prefix)
+	it := txn.NewIterator(opt)
+	defer it.Close()
+	var out []string
+	for it.Rewind(); it.Valid(); it.Next() {
+		out = append(out, string(it.Item().Key()))
+	}
+	return out
+}
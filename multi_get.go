@@ -0,0 +1,266 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/luxfi/zapdb/table"
+	"github.com/luxfi/zapdb/y"
+)
+
+// multiGetConcurrency is the number of tables of a level read at once by a MultiGet.
+const multiGetConcurrency = 8
+
+// MultiGet looks keys up like Get, at the same read timestamp, and returns their items in the
+// order of keys, nil for the keys not found. It sorts the keys, so that every table is read once
+// for all the keys it may have, the blocks holding several of them once, and reads the tables
+// of a level in parallel: it's faster than a Get per key. It fails if any of the lookups fails.
+func (txn *Txn) MultiGet(keys [][]byte) ([]*Item, error) {
+	if txn.discarded {
+		return nil, ErrDiscardedTxn
+	}
+	for _, key := range keys {
+		if len(key) == 0 {
+			return nil, ErrEmptyKey
+		}
+		if err := txn.db.isBanned(key); err != nil {
+			return nil, err
+		}
+	}
+	txn.refreshReadTs()
+
+	items := make([]*Item, len(keys))
+	// lookups are the indexes of the keys read from the DB, rather than from the writes of txn.
+	lookups := make([]int, 0, len(keys))
+	for i, key := range keys {
+		if txn.update {
+			if _, has := txn.pendingWrites[string(key)]; has {
+				item, err := txn.Get(key)
+				switch {
+				case errors.Is(err, ErrKeyNotFound):
+				case err != nil:
+					return nil, err
+				default:
+					items[i] = item
+				}
+				continue
+			}
+			txn.addReadKey(key)
+		}
+		lookups = append(lookups, i)
+	}
+	sort.SliceStable(lookups, func(a, b int) bool {
+		return bytes.Compare(keys[lookups[a]], keys[lookups[b]]) < 0
+	})
+	seeks := make([][]byte, 0, len(lookups))
+	for j, i := range lookups {
+		if j == 0 || !bytes.Equal(keys[i], keys[lookups[j-1]]) {
+			seeks = append(seeks, y.KeyWithTs(keys[i], txn.readTs))
+		}
+	}
+
+	vss, err := txn.db.multiGet(seeks)
+	if err != nil {
+		return nil, y.Wrapf(err, "DB::MultiGet")
+	}
+	k := -1
+	for j, i := range lookups {
+		if j == 0 || !bytes.Equal(keys[i], keys[lookups[j-1]]) {
+			k++
+		}
+		item, err := txn.readItem(new(Item), keys[i], vss[k])
+		switch {
+		case errors.Is(err, ErrKeyNotFound):
+		case err != nil:
+			return nil, err
+		default:
+			items[i] = item
+		}
+	}
+	return items, nil
+}
+
+// multiGet returns the value of every key, sorted, like get.
+func (db *DB) multiGet(keys [][]byte) ([]y.ValueStruct, error) {
+	if db.IsClosed() {
+		return nil, ErrDBClosed
+	}
+	tables, decr := db.getMemTables() // Lock should be released.
+	defer decr()
+
+	vss := make([]y.ValueStruct, len(keys))
+	// done is whether the version of the key read, its timestamp, was found.
+	done := make([]bool, len(keys))
+	db.metrics.NumGetsAdd(int64(len(keys)))
+	for i, key := range keys {
+		version := y.ParseTs(key)
+		for _, mt := range tables {
+			vs := mt.sl.Get(key)
+			db.metrics.NumMemtableGetsAdd(1)
+			if vs.Meta == 0 && vs.Value == nil {
+				continue
+			}
+			if vs.Version == version {
+				db.metrics.NumGetsWithResultsAdd(1)
+				vss[i], done[i] = vs, true
+				break
+			}
+			if vss[i].Version < vs.Version {
+				vss[i] = vs
+			}
+		}
+	}
+	return vss, db.lc.multiGet(keys, vss, done)
+}
+
+// multiGet completes the values of the keys not done with those of the levels, like get.
+func (s *levelsController) multiGet(keys [][]byte, vss []y.ValueStruct, done []bool) error {
+	if s.kv.IsClosed() {
+		return ErrDBClosed
+	}
+	// The levels are read from 0 on upward, like by get.
+	for _, h := range s.levels {
+		if err := h.multiGet(keys, vss, done); err != nil {
+			return y.Wrapf(err, "multi get of %d keys", len(keys))
+		}
+	}
+	for i, vs := range vss {
+		if !done[i] && len(vs.Value) > 0 {
+			s.kv.metrics.NumGetsWithResultsAdd(1)
+		}
+	}
+	return nil
+}
+
+// tableKeys are the keys a MultiGet looks up in a table, by their indexes.
+type tableKeys struct {
+	t   *table.Table
+	idx []int
+}
+
+// multiGet completes the values of the keys not done with those of the level.
+func (s *levelHandler) multiGet(keys [][]byte, vss []y.ValueStruct, done []bool) (rerr error) {
+	groups := s.tablesForKeys(keys, done)
+	defer func() {
+		for _, g := range groups {
+			if err := g.t.DecrRef(); err != nil && rerr == nil {
+				rerr = err
+			}
+		}
+	}()
+
+	// Each table has its own values, as the tables of level 0 can have the same keys.
+	out := make([][]y.ValueStruct, len(groups))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, multiGetConcurrency)
+	for n, g := range groups {
+		out[n] = make([]y.ValueStruct, len(g.idx))
+		if len(groups) == 1 {
+			s.multiGetTable(g, keys, out[n])
+			break
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			s.multiGetTable(g, keys, out[n])
+		}()
+	}
+	wg.Wait()
+
+	for n, g := range groups {
+		for j, i := range g.idx {
+			vs := out[n][j]
+			if vs.Value == nil && vs.Meta == 0 {
+				continue
+			}
+			s.db.metrics.NumBytesReadsLSMAdd(int64(len(vs.Value)))
+			if vs.Version == y.ParseTs(keys[i]) {
+				vss[i], done[i] = vs, true
+			} else if vss[i].Version < vs.Version {
+				vss[i] = vs
+			}
+		}
+	}
+	return nil
+}
+
+// tablesForKeys returns the tables of the level which can have the keys not done, with the
+// keys, like getTableForKey. The tables are referenced.
+func (s *levelHandler) tablesForKeys(keys [][]byte, done []bool) []tableKeys {
+	s.RLock()
+	defer s.RUnlock()
+
+	var groups []tableKeys
+	if s.level == 0 {
+		// Any table of level 0 can have a key within its range.
+		for n := len(s.tables) - 1; n >= 0; n-- {
+			t := s.tables[n]
+			g := tableKeys{t: t}
+			smallest, biggest := y.ParseKey(t.Smallest()), y.ParseKey(t.Biggest())
+			for i, key := range keys {
+				keyNoTs := y.ParseKey(key)
+				if !done[i] && bytes.Compare(keyNoTs, smallest) >= 0 &&
+					bytes.Compare(keyNoTs, biggest) <= 0 {
+					g.idx = append(g.idx, i)
+				}
+			}
+			if len(g.idx) > 0 {
+				t.IncrRef()
+				groups = append(groups, g)
+			}
+		}
+		return groups
+	}
+	// The keys are sorted, so the keys of a table follow each other.
+	for i, key := range keys {
+		if done[i] {
+			continue
+		}
+		n := sort.Search(len(s.tables), func(n int) bool {
+			return y.CompareKeys(s.tables[n].Biggest(), key) >= 0
+		})
+		if n >= len(s.tables) {
+			break
+		}
+		t := s.tables[n]
+		if last := len(groups) - 1; last >= 0 && groups[last].t == t {
+			groups[last].idx = append(groups[last].idx, i)
+			continue
+		}
+		t.IncrRef()
+		groups = append(groups, tableKeys{t: t, idx: []int{i}})
+	}
+	return groups
+}
+
+// multiGetTable looks the keys of g up in its table, seeking them in order with one iterator,
+// so that the keys in the same block share its read.
+func (s *levelHandler) multiGetTable(g tableKeys, keys [][]byte, out []y.ValueStruct) {
+	it := g.t.NewIterator(s.db.cacheOption(y.ParseKey(keys[g.idx[0]])))
+	defer func() { _ = it.Close() }()
+
+	for j, i := range g.idx {
+		key := keys[i]
+		if g.t.DoesNotHave(y.Hash(y.ParseKey(key))) {
+			s.db.metrics.NumLSMBloomHitsAdd(s.strLevel, 1)
+			continue
+		}
+		s.db.metrics.NumLSMGetsAdd(s.strLevel, 1)
+		it.Seek(key)
+		if it.Valid() && y.SameKey(key, it.Key()) {
+			out[j] = it.ValueCopy()
+			out[j].Version = y.ParseTs(it.Key())
+		}
+	}
+}
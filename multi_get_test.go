@@ -0,0 +1,73 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiGet(t *testing.T) {
+	opt := getTestOptions("")
+	// Small memtables, so that the keys are spread over the memtables and many tables.
+	opt.MemTableSize = 1 << 15
+	opt.ValueThreshold = 1 << 10
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		key := func(i int) []byte { return fmt.Appendf(nil, "key%05d", i) }
+		const n = 3000
+		wb := db.NewWriteBatch()
+		for i := range n {
+			require.NoError(t, wb.Set(key(i), fmt.Appendf(nil, "val%d", i)))
+		}
+		require.NoError(t, wb.Flush())
+		wb = db.NewWriteBatch()
+		for i := 0; i < n; i += 7 {
+			require.NoError(t, wb.Set(key(i), fmt.Appendf(nil, "new%d", i)))
+		}
+		for i := 3; i < n; i += 11 {
+			require.NoError(t, wb.Delete(key(i)))
+		}
+		require.NoError(t, wb.Flush())
+		require.Eventually(t, func() bool { return len(db.Tables()) > 1 }, 10*time.Second,
+			10*time.Millisecond)
+
+		// Unsorted, duplicated and missing keys.
+		var keys [][]byte
+		for _, i := range rand.Perm(n + 100) {
+			keys = append(keys, key(i))
+		}
+		keys = append(keys, key(7), key(3))
+
+		txn := db.NewTransaction(true)
+		defer txn.Discard()
+		require.NoError(t, txn.Set(key(5), []byte("pending")))
+		require.NoError(t, txn.Delete(key(8)))
+		items, err := txn.MultiGet(keys)
+		require.NoError(t, err)
+		require.Len(t, items, len(keys))
+		for i, k := range keys {
+			item, err := txn.Get(k)
+			if err == ErrKeyNotFound {
+				require.Nil(t, items[i], "key %s", k)
+				continue
+			}
+			require.NoError(t, err)
+			require.NotNil(t, items[i], "key %s", k)
+			require.Equal(t, k, items[i].Key())
+			require.Equal(t, item.Version(), items[i].Version())
+			require.Equal(t, getItemValue(t, item), getItemValue(t, items[i]))
+		}
+		require.Nil(t, items[len(keys)-1])
+		require.Equal(t, []byte("new7"), getItemValue(t, items[len(keys)-2]))
+
+		_, err = txn.MultiGet([][]byte{key(1), nil})
+		require.ErrorIs(t, err, ErrEmptyKey)
+	})
+}
@@ -0,0 +1,174 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package objstore
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// DefaultPageSize is the page size of a CachedReaderAt if none is given.
+const DefaultPageSize = 64 << 10
+
+// CachedReaderAt caches what is read through it from a slow io.ReaderAt, like an HTTPReaderAt, in
+// a local file. The source is read in pages, each of them once, and pages which are next to each
+// other are read with a single call. The cache file is sparse, so that only the pages which have
+// been read take space. CachedReaderAt is safe for concurrent use.
+type CachedReaderAt struct {
+	src      io.ReaderAt
+	size     int64
+	pageSize int64
+	file     *os.File
+
+	mu       sync.Mutex
+	cached   []bool
+	fetching map[int64]chan struct{} // Closed once the page is read.
+	fetched  int64                   // Bytes read from src.
+}
+
+// NewCachedReaderAt returns a reader of the size bytes of src, caching them in a file created at
+// path. A pageSize of zero means DefaultPageSize.
+func NewCachedReaderAt(src io.ReaderAt, size int64, path string, pageSize int) (
+	*CachedReaderAt, error) {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("objstore: cache: %w", err)
+	}
+	if err := f.Truncate(size); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("objstore: cache: %w", err)
+	}
+	numPages := (size + int64(pageSize) - 1) / int64(pageSize)
+	return &CachedReaderAt{
+		src:      src,
+		size:     size,
+		pageSize: int64(pageSize),
+		file:     f,
+		cached:   make([]bool, numPages),
+		fetching: make(map[int64]chan struct{}),
+	}, nil
+}
+
+// Size returns the size of the source.
+func (c *CachedReaderAt) Size() int64 {
+	return c.size
+}
+
+// Fetched returns the number of bytes read from the source so far.
+func (c *CachedReaderAt) Fetched() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fetched
+}
+
+// ReadAt reads len(p) bytes at off from the cache file, once the pages holding them are cached.
+func (c *CachedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("objstore: cache: negative offset")
+	}
+	if off >= c.size {
+		return 0, io.EOF
+	}
+	end := min(off+int64(len(p)), c.size)
+	if end == off {
+		return 0, nil
+	}
+	if err := c.fetch(off/c.pageSize, (end-1)/c.pageSize); err != nil {
+		return 0, err
+	}
+	n, err := c.file.ReadAt(p[:end-off], off)
+	if err == nil && end-off < int64(len(p)) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// fetch caches the pages first to last. Runs of missing pages are read by the first caller that
+// needs them, while the others wait for them.
+func (c *CachedReaderAt) fetch(first, last int64) error {
+	for {
+		c.mu.Lock()
+		var wait chan struct{}
+		start := int64(-1)
+		for i := first; i <= last; i++ {
+			if c.cached[i] {
+				continue
+			}
+			if ch, ok := c.fetching[i]; ok {
+				wait = ch
+				break
+			}
+			start = i
+			break
+		}
+		if start < 0 && wait == nil {
+			c.mu.Unlock()
+			return nil
+		}
+		if wait != nil {
+			c.mu.Unlock()
+			<-wait
+			// Check again: the fetch may have failed.
+			continue
+		}
+
+		stop := start
+		for stop < last && !c.cached[stop+1] && c.fetching[stop+1] == nil {
+			stop++
+		}
+		done := make(chan struct{})
+		for i := start; i <= stop; i++ {
+			c.fetching[i] = done
+		}
+		c.mu.Unlock()
+
+		err := c.fetchPages(start, stop)
+
+		c.mu.Lock()
+		for i := start; i <= stop; i++ {
+			delete(c.fetching, i)
+			c.cached[i] = err == nil
+		}
+		c.mu.Unlock()
+		close(done)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// fetchPages reads the pages first to last from the source into the cache file.
+func (c *CachedReaderAt) fetchPages(first, last int64) error {
+	off := first * c.pageSize
+	buf := make([]byte, min((last+1)*c.pageSize, c.size)-off)
+	if n, err := c.src.ReadAt(buf, off); n < len(buf) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("objstore: cache: %w", err)
+	}
+	if _, err := c.file.WriteAt(buf, off); err != nil {
+		return fmt.Errorf("objstore: cache: %w", err)
+	}
+	c.mu.Lock()
+	c.fetched += int64(len(buf))
+	c.mu.Unlock()
+	return nil
+}
+
+// Close closes and removes the cache file. The source is left open.
+func (c *CachedReaderAt) Close() error {
+	err := c.file.Close()
+	if rerr := os.Remove(c.file.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
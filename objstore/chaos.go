@@ -0,0 +1,190 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package objstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrInjected is returned by a Chaos store for injected failures.
+var ErrInjected = errors.New("objstore: injected failure")
+
+// Latency is a distribution of latencies.
+type Latency interface {
+	Sample(rng *rand.Rand) time.Duration
+}
+
+type fixedLatency time.Duration
+
+func (l fixedLatency) Sample(*rand.Rand) time.Duration { return time.Duration(l) }
+
+// FixedLatency returns a distribution which always returns d.
+func FixedLatency(d time.Duration) Latency { return fixedLatency(d) }
+
+type uniformLatency struct{ min, max time.Duration }
+
+func (l uniformLatency) Sample(rng *rand.Rand) time.Duration {
+	if l.max <= l.min {
+		return l.min
+	}
+	return l.min + time.Duration(rng.Int63n(int64(l.max-l.min)))
+}
+
+// UniformLatency returns a distribution uniform over [min, max).
+func UniformLatency(min, max time.Duration) Latency { return uniformLatency{min, max} }
+
+type normalLatency struct{ mean, stddev time.Duration }
+
+func (l normalLatency) Sample(rng *rand.Rand) time.Duration {
+	d := time.Duration(rng.NormFloat64()*float64(l.stddev)) + l.mean
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// NormalLatency returns a normal distribution of latencies, truncated at zero.
+func NormalLatency(mean, stddev time.Duration) Latency { return normalLatency{mean, stddev} }
+
+// ChaosConfig describes the misbehavior injected by a Chaos store.
+type ChaosConfig struct {
+	// Latency is added before every operation. Nil means no added latency.
+	Latency Latency
+	// ErrorRate is the probability of an operation failing with ErrInjected.
+	ErrorRate float64
+	// BytesPerSecond throttles reads from and writes to objects. Zero means no throttling.
+	BytesPerSecond int64
+}
+
+// Chaos wraps a Store, injecting latency, throttling and intermittent errors, to validate
+// timeouts and retry handling against misbehaving storage. The config can be changed at any
+// time with SetConfig.
+type Chaos struct {
+	Store
+
+	mu  sync.Mutex
+	cfg ChaosConfig
+	rng *rand.Rand
+}
+
+// NewChaos wraps store with the given config. The seed makes the injected misbehavior
+// reproducible.
+func NewChaos(store Store, cfg ChaosConfig, seed int64) *Chaos {
+	return &Chaos{Store: store, cfg: cfg, rng: rand.New(rand.NewSource(seed))}
+}
+
+// SetConfig replaces the config, affecting operations started afterwards.
+func (c *Chaos) SetConfig(cfg ChaosConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cfg = cfg
+}
+
+// Config returns the current config.
+func (c *Chaos) Config() ChaosConfig {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cfg
+}
+
+// inject sleeps for the sampled latency and decides whether the operation fails. It returns
+// the throttle to apply to the data transferred by the operation.
+func (c *Chaos) inject(ctx context.Context) (int64, error) {
+	c.mu.Lock()
+	cfg := c.cfg
+	var delay time.Duration
+	if cfg.Latency != nil {
+		delay = cfg.Latency.Sample(c.rng)
+	}
+	fail := cfg.ErrorRate > 0 && c.rng.Float64() < cfg.ErrorRate
+	c.mu.Unlock()
+
+	if err := sleep(ctx, delay); err != nil {
+		return 0, err
+	}
+	if fail {
+		return 0, ErrInjected
+	}
+	return cfg.BytesPerSecond, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Chaos) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	bps, err := c.inject(ctx)
+	if err != nil {
+		return err
+	}
+	if bps > 0 {
+		r = &throttledReader{ctx: ctx, r: r, bps: bps}
+	}
+	return c.Store.Put(ctx, key, r, size)
+}
+
+func (c *Chaos) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	bps, err := c.inject(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := c.Store.Get(ctx, key)
+	if err != nil || bps <= 0 {
+		return rc, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{&throttledReader{ctx: ctx, r: rc, bps: bps}, rc}, nil
+}
+
+func (c *Chaos) List(ctx context.Context, prefix string) ([]string, error) {
+	if _, err := c.inject(ctx); err != nil {
+		return nil, err
+	}
+	return c.Store.List(ctx, prefix)
+}
+
+// throttledReader limits the rate of reads to bps bytes per second.
+type throttledReader struct {
+	ctx   context.Context
+	r     io.Reader
+	bps   int64
+	start time.Time
+	read  int64
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+	// Read at most a tenth of a second worth of data at a time, for a smooth rate.
+	if limit := t.bps/10 + 1; int64(len(p)) > limit {
+		p = p[:limit]
+	}
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+	due := t.start.Add(time.Duration(float64(t.read) / float64(t.bps) * float64(time.Second)))
+	if serr := sleep(t.ctx, time.Until(due)); serr != nil && err == nil {
+		err = serr
+	}
+	return n, err
+}
@@ -0,0 +1,106 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	require.NoError(t, m.Put(ctx, "a/2", bytes.NewReader([]byte("two")), 3))
+	require.NoError(t, m.Put(ctx, "a/1", bytes.NewReader([]byte("one")), 3))
+	require.NoError(t, m.Put(ctx, "b/1", bytes.NewReader([]byte("three")), 5))
+	require.Error(t, m.Put(ctx, "c", bytes.NewReader([]byte("x")), 2))
+
+	keys, err := m.List(ctx, "a/")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a/1", "a/2"}, keys)
+
+	rc, err := m.Get(ctx, "a/1")
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.Equal(t, "one", string(data))
+
+	_, err = m.Get(ctx, "missing")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestChaosErrorRate(t *testing.T) {
+	ctx := context.Background()
+	c := NewChaos(NewMemory(), ChaosConfig{ErrorRate: 0.5}, 1)
+	var failed int
+	for i := 0; i < 1000; i++ {
+		_, err := c.List(ctx, "")
+		if errors.Is(err, ErrInjected) {
+			failed++
+		} else {
+			require.NoError(t, err)
+		}
+	}
+	require.InDelta(t, 500, failed, 100)
+
+	// The config can be changed at runtime.
+	c.SetConfig(ChaosConfig{})
+	for i := 0; i < 100; i++ {
+		_, err := c.List(ctx, "")
+		require.NoError(t, err)
+	}
+}
+
+func TestChaosLatency(t *testing.T) {
+	c := NewChaos(NewMemory(), ChaosConfig{Latency: FixedLatency(20 * time.Millisecond)}, 1)
+	start := time.Now()
+	_, err := c.List(context.Background(), "")
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	// The latency respects the context deadline.
+	c.SetConfig(ChaosConfig{Latency: FixedLatency(time.Hour)})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = c.List(ctx, "")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestChaosThrottle(t *testing.T) {
+	ctx := context.Background()
+	c := NewChaos(NewMemory(), ChaosConfig{}, 1)
+	data := make([]byte, 2000)
+	require.NoError(t, c.Put(ctx, "k", bytes.NewReader(data), int64(len(data))))
+
+	c.SetConfig(ChaosConfig{BytesPerSecond: 20000})
+	start := time.Now()
+	rc, err := c.Get(ctx, "k")
+	require.NoError(t, err)
+	got, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	require.Equal(t, data, got)
+	// 2000 bytes at 20000 bytes per second take about 100ms.
+	require.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+}
+
+func TestLatencyDistributions(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		d := UniformLatency(time.Millisecond, 2*time.Millisecond).Sample(rng)
+		require.GreaterOrEqual(t, d, time.Millisecond)
+		require.Less(t, d, 2*time.Millisecond)
+		require.GreaterOrEqual(t, NormalLatency(time.Millisecond, time.Second).Sample(rng),
+			time.Duration(0))
+	}
+}
@@ -0,0 +1,112 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package objstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrNoRanges is returned by an HTTPReaderAt if the server ignores range requests.
+var ErrNoRanges = errors.New("objstore: server does not support range requests")
+
+// HTTPReaderAt reads an object over HTTP with range requests, such as an object of S3 through a
+// presigned URL. It implements io.ReaderAt, and is safe for concurrent use.
+type HTTPReaderAt struct {
+	client *http.Client
+	url    string
+	size   int64
+}
+
+// NewHTTPReaderAt returns a reader of the object at url, of which it gets the size with a HEAD
+// request. A nil client means http.DefaultClient.
+func NewHTTPReaderAt(client *http.Client, url string) (*HTTPReaderAt, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Head(url)
+	if err != nil {
+		return nil, fmt.Errorf("objstore: head %s: %w", url, err)
+	}
+	_ = resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, url)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("objstore: head %s: %s", url, resp.Status)
+	case resp.ContentLength < 0:
+		return nil, fmt.Errorf("objstore: head %s: unknown size", url)
+	}
+	return &HTTPReaderAt{client: client, url: url, size: resp.ContentLength}, nil
+}
+
+// Size returns the size of the object.
+func (r *HTTPReaderAt) Size() int64 {
+	return r.size
+}
+
+// ReadAt reads len(p) bytes of the object at off, with a single range request.
+func (r *HTTPReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("objstore: read %s: negative offset", r.url)
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	want := min(int64(len(p)), r.size-off)
+	if want == 0 {
+		return 0, nil
+	}
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+want-1))
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("objstore: read %s: %w", r.url, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		return 0, fmt.Errorf("%w: %s", ErrNoRanges, r.url)
+	case http.StatusNotFound:
+		return 0, fmt.Errorf("%w: %s", ErrNotFound, r.url)
+	default:
+		return 0, fmt.Errorf("objstore: read %s: %s", r.url, resp.Status)
+	}
+	if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != off {
+		return 0, fmt.Errorf("objstore: read %s: unexpected Content-Range %q", r.url,
+			resp.Header.Get("Content-Range"))
+	}
+	n, err := io.ReadFull(resp.Body, p[:want])
+	if err != nil {
+		return n, fmt.Errorf("objstore: read %s: %w", r.url, err)
+	}
+	if want < int64(len(p)) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// contentRangeStart parses the first byte of a Content-Range header like "bytes 0-99/1000".
+func contentRangeStart(h string) (int64, bool) {
+	h, ok := strings.CutPrefix(h, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	h, _, ok = strings.Cut(h, "-")
+	if !ok {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(h, 10, 64)
+	return start, err == nil
+}
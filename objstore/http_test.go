@@ -0,0 +1,133 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package objstore
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testObject() []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < 1<<20; i++ {
+		fmt.Fprintf(&buf, "%08d", i)
+	}
+	return buf.Bytes()
+}
+
+// serveObject serves data at /object, counting the requests.
+func serveObject(t *testing.T, data []byte, requests *atomic.Int64) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/object" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "object", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHTTPReaderAt(t *testing.T) {
+	data := testObject()
+	var requests atomic.Int64
+	srv := serveObject(t, data, &requests)
+
+	r, err := NewHTTPReaderAt(srv.Client(), srv.URL+"/object")
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), r.Size())
+
+	buf := make([]byte, 100)
+	n, err := r.ReadAt(buf, 12345)
+	require.NoError(t, err)
+	require.Equal(t, 100, n)
+	require.Equal(t, data[12345:12445], buf)
+
+	// Reads past the end are short.
+	n, err = r.ReadAt(buf, int64(len(data)-10))
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, data[len(data)-10:], buf[:n])
+	_, err = r.ReadAt(buf, int64(len(data)))
+	require.Equal(t, io.EOF, err)
+
+	_, err = NewHTTPReaderAt(srv.Client(), srv.URL+"/missing")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// A server that ignores ranges.
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		_, _ = w.Write(data)
+	}))
+	defer plain.Close()
+	r, err = NewHTTPReaderAt(plain.Client(), plain.URL)
+	require.NoError(t, err)
+	_, err = r.ReadAt(buf, 0)
+	require.ErrorIs(t, err, ErrNoRanges)
+}
+
+func TestCachedReaderAt(t *testing.T) {
+	data := testObject()
+	var requests atomic.Int64
+	srv := serveObject(t, data, &requests)
+	r, err := NewHTTPReaderAt(srv.Client(), srv.URL+"/object")
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "cache")
+	c, err := NewCachedReaderAt(r, r.Size(), path, 4096)
+	require.NoError(t, err)
+
+	read := func(off, n int) {
+		buf := make([]byte, n)
+		got, err := c.ReadAt(buf, int64(off))
+		require.NoError(t, err)
+		require.Equal(t, n, got)
+		require.Equal(t, data[off:off+n], buf)
+	}
+	requests.Store(0)
+	// Two pages, with a single request.
+	read(4000, 200)
+	require.Equal(t, int64(1), requests.Load())
+	require.Equal(t, int64(8192), c.Fetched())
+	// Cached.
+	read(4100, 50)
+	require.Equal(t, int64(1), requests.Load())
+	// One more page.
+	read(4000, 5000)
+	require.Equal(t, int64(2), requests.Load())
+	require.Equal(t, int64(3*4096), c.Fetched())
+
+	// Concurrent readers of the same pages read them once.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			read(1<<19, 1<<16)
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int64(3*4096+1<<16), c.Fetched())
+
+	// The last page is short.
+	buf := make([]byte, 100)
+	n, err := c.ReadAt(buf, int64(len(data)-10))
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, data[len(data)-10:], buf[:n])
+
+	require.NoError(t, c.Close())
+	require.NoFileExists(t, path)
+}
@@ -0,0 +1,207 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package objstore abstracts the object storage used for replication and remote data, so that
+// it can be backed by S3, by memory in tests, or wrapped to inject failures.
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// ErrNotFound is returned by Get if the object does not exist.
+var ErrNotFound = errors.New("objstore: object not found")
+
+// Store is a flat namespace of objects, each written whole by Put.
+type Store interface {
+	// Put uploads size bytes read from r as the object key, replacing any existing object.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get returns a reader over the object key. The caller must close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// List returns the keys of all objects starting with prefix, in lexical order.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// ReaderAtCloser reads an object at random offsets. The caller must close it.
+type ReaderAtCloser interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// RandomAccessStore is a Store whose objects can be read at random offsets, without downloading
+// them whole, and deleted. The stores returned by NewS3 and NewMemory are.
+type RandomAccessStore interface {
+	Store
+	// Open returns a reader of the object key at random offsets, and its size.
+	Open(ctx context.Context, key string) (ReaderAtCloser, int64, error)
+	// Delete deletes the object key. Deleting an object which does not exist is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// S3Config configures a Store backed by S3, or any S3 compatible service.
+type S3Config struct {
+	Bucket    string
+	Endpoint  string
+	Region    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+type s3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3 returns a Store backed by the bucket described by cfg.
+func NewS3(cfg S3Config) (Store, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Region: cfg.Region,
+		Secure: cfg.UseSSL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("objstore: s3 client: %w", err)
+	}
+	return &s3Store{client: client, bucket: cfg.Bucket}, nil
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	return err
+}
+
+func (s *s3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// The object is requested lazily: Stat sends the request, to report a missing object.
+	if _, err := obj.Stat(); err != nil {
+		_ = obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (s *s3Store) Open(ctx context.Context, key string) (ReaderAtCloser, int64, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+	// The object is read with a range request by every ReadAt.
+	info, err := obj.Stat()
+	if err != nil {
+		_ = obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, 0, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return nil, 0, err
+	}
+	return obj, info.Size, nil
+}
+
+func (s *s3Store) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *s3Store) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		keys = append(keys, obj.Key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Memory is a Store which keeps objects in memory. It is safe for concurrent use.
+type Memory struct {
+	sync.RWMutex
+	objects map[string][]byte
+}
+
+// NewMemory returns an empty in-memory Store.
+func NewMemory() *Memory {
+	return &Memory{objects: make(map[string][]byte)}
+}
+
+func (m *Memory) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return fmt.Errorf("objstore: put %s: read %d bytes, expected %d", key, len(data), size)
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.objects[key] = data
+	return nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.RLock()
+	defer m.RUnlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *Memory) Open(ctx context.Context, key string) (ReaderAtCloser, int64, error) {
+	m.RLock()
+	defer m.RUnlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return nopReaderAtCloser{bytes.NewReader(data)}, int64(len(data)), nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+type nopReaderAtCloser struct{ io.ReaderAt }
+
+func (nopReaderAtCloser) Close() error { return nil }
+
+func (m *Memory) List(ctx context.Context, prefix string) ([]string, error) {
+	m.RLock()
+	defer m.RUnlock()
+	var keys []string
+	for k := range m.objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -0,0 +1,112 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"context"
+	"time"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+
+	"github.com/luxfi/zapdb/table"
+)
+
+// The stages of Open, in their order, reported to Options.OpenProgress.
+const (
+	// OpenStageManifest is the reading of the manifest.
+	OpenStageManifest = "manifest"
+	// OpenStageMemtables is the replay of the memtable files, out of their number.
+	OpenStageMemtables = "memtables"
+	// OpenStageTables is the opening of the tables, out of their number.
+	OpenStageTables = "tables"
+	// OpenStageValueLog is the opening of the value log files, out of their number.
+	OpenStageValueLog = "vlog"
+	// OpenStageReady is reported once the DB serves reads and writes, right before Open returns.
+	OpenStageReady = "ready"
+	// OpenStageWarm is the loading of the tables into the block cache with StagedOpen, out of
+	// their number. The tables of level 0 are loaded before OpenStageReady, the others after.
+	OpenStageWarm = "warm"
+)
+
+// openProgress reports that done out of total of stage is done to OpenProgress, if set.
+func (opt Options) openProgress(stage string, done, total int) {
+	if opt.OpenProgress != nil {
+		opt.OpenProgress(stage, done, total)
+	}
+}
+
+// Warmed returns a channel closed once the tables opened with StagedOpen are all loaded into the
+// block cache, or the DB is closed. It's closed right away without StagedOpen.
+func (db *DB) Warmed() <-chan struct{} {
+	return db.warmed
+}
+
+// warmLevelZero loads the tables of level 0 into the block cache if the DB is opened with
+// StagedOpen, and returns the tables of the deeper levels for warmDeepLevels, with a reference
+// each.
+func (db *DB) warmLevelZero() []*table.Table {
+	if !db.opt.StagedOpen || db.blockCache == nil {
+		return nil
+	}
+	start := time.Now()
+	top := db.lc.levelTables(0, 1)
+	deep := db.lc.levelTables(1, len(db.lc.levels))
+	db.warmTotal = len(top) + len(deep)
+	db.opt.openProgress(OpenStageWarm, 0, db.warmTotal)
+	n := db.warmTables(context.Background(), top, 0)
+	db.opt.Infof("Warmed %d tables of level 0 in %s", n, time.Since(start).Round(time.Millisecond))
+	return deep
+}
+
+// warmDeepLevels loads the tables returned by warmLevelZero into the block cache in the
+// background, and closes warmed once they are.
+func (db *DB) warmDeepLevels(deep []*table.Table) {
+	if !db.opt.StagedOpen || db.blockCache == nil {
+		close(db.warmed)
+		return
+	}
+	db.closers.warm = z.NewCloser(1)
+	go func(c *z.Closer) {
+		defer c.Done()
+		defer close(db.warmed)
+		start := time.Now()
+		n := db.warmTables(c.Ctx(), deep, db.warmTotal-len(deep))
+		db.opt.Infof("Warmed %d tables of the deeper levels in %s", n,
+			time.Since(start).Round(time.Millisecond))
+	}(db.closers.warm)
+}
+
+// warmTables loads the blocks of tables into the block cache, reporting them as warmed after the
+// done tables, and releases their references. It stops early, and returns how many it loaded, if
+// ctx is done or a table can't be read.
+func (db *DB) warmTables(ctx context.Context, tables []*table.Table, done int) int {
+	defer func() { _ = decrRefs(tables) }()
+	for i, t := range tables {
+		if _, err := t.Warm(ctx, nil, true); err != nil {
+			if ctx.Err() == nil {
+				db.opt.Warningf("While warming table %d: %v", t.ID(), err)
+			}
+			return i
+		}
+		db.opt.openProgress(OpenStageWarm, done+i+1, db.warmTotal)
+	}
+	db.blockCache.Wait()
+	return len(tables)
+}
+
+// levelTables returns the tables of the levels from lo to hi, excluded, with a reference each.
+func (s *levelsController) levelTables(lo, hi int) []*table.Table {
+	var out []*table.Table
+	for _, l := range s.levels[lo:hi] {
+		l.RLock()
+		for _, t := range l.tables {
+			t.IncrRef()
+			out = append(out, t)
+		}
+		l.RUnlock()
+	}
+	return out
+}
@@ -0,0 +1,71 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenProgress(t *testing.T) {
+	dir := t.TempDir()
+	opt := getTestOptions(dir)
+	opt.MemTableSize = 1 << 15
+	opt.ValueThreshold = 1 << 10
+	db, err := Open(opt)
+	require.NoError(t, err)
+	key := func(i int) []byte { return fmt.Appendf(nil, "key%05d", i) }
+	wb := db.NewWriteBatch()
+	for i := range 5000 {
+		require.NoError(t, wb.Set(key(i), key(i)))
+	}
+	require.NoError(t, wb.Flush())
+	require.NoError(t, db.Flatten(1))
+	require.NoError(t, db.Close())
+
+	type report struct {
+		stage       string
+		done, total int
+	}
+	var reports []report
+	opt = opt.WithStagedOpen(true).WithOpenProgress(func(stage string, done, total int) {
+		reports = append(reports, report{stage, done, total})
+	})
+	db, err = Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	<-db.Warmed()
+
+	// The stages are reported in order, each up to its total.
+	var stages []string
+	last := map[string]report{}
+	for _, r := range reports {
+		if len(stages) == 0 || stages[len(stages)-1] != r.stage {
+			stages = append(stages, r.stage)
+		}
+		require.LessOrEqual(t, r.done, r.total)
+		require.GreaterOrEqual(t, r.done, last[r.stage].done)
+		last[r.stage] = r
+	}
+	require.Equal(t, []string{OpenStageManifest, OpenStageMemtables, OpenStageTables,
+		OpenStageValueLog, OpenStageWarm, OpenStageReady, OpenStageWarm}, stages)
+	for stage, r := range last {
+		require.Equal(t, r.total, r.done, stage)
+	}
+	require.Equal(t, len(db.Tables()), last[OpenStageWarm].total)
+	require.Greater(t, len(db.Tables()), 1)
+
+	require.NoError(t, db.View(func(txn *Txn) error {
+		for i := range 5000 {
+			item, err := txn.Get(key(i))
+			require.NoError(t, err)
+			require.Equal(t, key(i), getItemValue(t, item))
+		}
+		return nil
+	}))
+}
@@ -13,7 +13,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/luxfi/zapdb/objstore"
 	"github.com/luxfi/zapdb/options"
+	"github.com/luxfi/zapdb/pb"
 	"github.com/luxfi/zapdb/table"
 	"github.com/luxfi/zapdb/y"
 	"github.com/dgraph-io/ristretto/v2/z"
@@ -41,16 +43,70 @@ type Options struct {
 	SyncWrites        bool
 	NumVersionsToKeep int
 	ReadOnly          bool
+	Follower          bool
 	Logger            Logger
 	Compression       options.CompressionType
 	InMemory          bool
 	MetricsEnabled    bool
+	// Label of the metrics of this DB under badger_db. Defaults to Dir.
+	MetricsLabel string
+	// Upper bounds of the buckets of the latency histograms of this DB.
+	LatencyBuckets []time.Duration
 	// Sets the Stream.numGo field
 	NumGoroutines int
+	// VersionGC decides which versions of the keys, past NumVersionsToKeep, the compactions and
+	// the TTL reaper may purge. Nil keeps NumVersionsToKeep versions.
+	VersionGC VersionGC
+	// A ReadOnly DB catches up with the writes of the process writing to its directory every
+	// RefreshInterval. See DB.Refresh.
+	RefreshInterval time.Duration
+
+	// Sync policies per component. SyncDefault defers to SyncWrites for the value log and WAL.
+	ValueLogSyncPolicy options.SyncPolicy
+	ManifestSyncPolicy options.SyncPolicy
+	TableSyncPolicy    options.SyncPolicy
+	SyncInterval       time.Duration
+
+	// Bounds on acknowledged writes that may be lost on power failure when SyncWrites is off.
+	MaxUnsyncedBytes    int64
+	MaxUnsyncedDuration time.Duration
+
+	// Durability, if set, decides ValueLogSyncPolicy in a single choice.
+	Durability options.Durability
+	// The writer waits up to GroupCommitWindow for more writes to join a batch, so that they
+	// share a sync.
+	GroupCommitWindow time.Duration
+
+	// Number of internal events kept by DB.FlightRecorder.
+	FlightRecorderSize int
+
+	// Limits on the writes of a single transaction. Zero means no limit.
+	TxnMaxEntries int64
+	TxnMaxMemory  int64
+
+	// Limits on the size of a single key and value. Zero means the limit imposed by the
+	// storage format.
+	MaxKeySize   int
+	MaxValueSize int64
+	// Values longer than ValueSplitSize are split into chunks of that size. Zero doesn't split.
+	ValueSplitSize int64
+
+	// Memory shared by the prefetched values of all iterators. Zero means no limit.
+	MaxPrefetchMemory int64
+
+	// Options of column families, by name. See DB.ColumnFamily.
+	ColumnFamilies map[string]ColumnFamilyOptions
 
 	// Fine tuning options.
 
-	MemTableSize        int64
+	MemTableSize int64
+	// The memtable is flushed, before reaching MemTableSize, once it has MemTableMaxEntries
+	// entries, its values are in MemTableMaxValueLogFiles value log files, or its first write is
+	// MemTableMaxAge old, for each which isn't zero.
+	MemTableMaxEntries       int64
+	MemTableMaxValueLogFiles int
+	MemTableMaxAge           time.Duration
+
 	BaseTableSize       int64
 	BaseLevelSize       int64
 	LevelSizeMultiplier int
@@ -66,30 +122,98 @@ type Options struct {
 	BloomFalsePositive float64
 	BlockCacheSize     int64
 	IndexCacheSize     int64
+	// The block cache is split into BlockCacheShards shards, if more than one.
+	BlockCacheShards int
+	// BlockCache, if set, is used as the block cache instead of one of BlockCacheSize bytes.
+	BlockCache table.BlockCache
+	// The prefixes of the keys are added to prefix bloom filters of the tables, if Extract is set.
+	PrefixExtractor PrefixExtractor
 
 	NumLevelZeroTables      int
 	NumLevelZeroTablesStall int
 
 	ValueLogFileSize   int64
 	ValueLogMaxEntries uint32
+	// The value log files are garbage collected in the background by ValueLogGCPolicy, if its
+	// Interval is set.
+	ValueLogGCPolicy ValueLogGCPolicy
+	// The background jobs are restricted to, and run at the start of, MaintenanceWindows.
+	MaintenanceWindows []MaintenanceWindow
 
 	NumCompactors        int
 	CompactL0OnClose     bool
 	LmaxCompaction       bool
 	ZSTDCompressionLevel int
 
+	// When set, the tables written by compactions are verified before they replace their inputs.
+	ParanoidCompactionChecks bool
+	// When set, reads check the order of keys and versions and the value pointers they follow.
+	StrictInvariantChecks bool
+
+	// Compactions pause while the p99 latency of Txn.Get is above ReadLatencySLO, unless a level
+	// has a score of CompactionBacklogScore or more. A zero ReadLatencySLO never pauses them.
+	ReadLatencySLO         time.Duration
+	CompactionBacklogScore float64
+
+	// Called by compactions on the versions up to the discard timestamp, to keep, drop or modify
+	// them.
+	CompactionFilter func(key, value []byte, version uint64) Decision
+
+	// Encode the values of the keys with their prefixes on write, and decode them on read.
+	ValueTransformers []ValueTransformer
+
+	// Snapshots of the internal metrics are persisted every StatsHistoryInterval, and kept for
+	// StatsHistoryRetention. See DB.StatsHistory.
+	StatsHistoryInterval  time.Duration
+	StatsHistoryRetention time.Duration
+
+	// A sample of HeatmapSampleRate of the accesses is counted by their prefixes of up to
+	// HeatmapPrefixLen bytes, and persisted every HeatmapInterval. See DB.Heatmap.
+	HeatmapSampleRate float64
+	HeatmapPrefixLen  int
+	HeatmapInterval   time.Duration
+
+	// The transactions failed with a conflict are counted by the prefixes of ConflictPrefixLen
+	// bytes of the keys of the conflicts.
+	ConflictPrefixLen int
+
+	// The tables of expired keys are looked for every TTLReaperInterval, and compacted.
+	TTLReaperInterval time.Duration
+
+	// The lifecycle policies archive keys to LifecycleArchive, and delete them, every
+	// LifecycleInterval. See DB.SetLifecyclePolicy.
+	LifecycleInterval time.Duration
+	LifecycleArchive  objstore.Store
+
+	// The tables of ColdStorageLevel and below, older than ColdStorageAge, are moved to
+	// ColdStorageDir or RemoteTableStore, if set. See DB.MoveColdTables.
+	ColdStorageDir   string
+	ColdStorageLevel int
+	ColdStorageAge   time.Duration
+	RemoteTableStore TableStore
+
 	// When set, checksum will be validated for each entry read from the value log file.
 	VerifyValueChecksum bool
 
 	// Encryption related options.
 	EncryptionKey                 []byte        // encryption key
+	EncryptionAlgo                pb.EncryptionAlgo
 	EncryptionKeyRotationDuration time.Duration // key rotation duration
+	// KeyProvider, if set, gives the encryption key in place of EncryptionKey.
+	KeyProvider KeyProvider
 
 	// BypassLockGuard will bypass the lock guard on badger. Bypassing lock
 	// guard can cause data corruption if multiple badger instances are using
 	// the same directory. Use this options with caution.
 	BypassLockGuard bool
 
+	// OpenProgress, if set, is called by Open as it goes through its stages, with how much of
+	// each stage is done. The stages are OpenStageManifest and the others.
+	OpenProgress func(stage string, done, total int)
+	// With StagedOpen, Open loads the blocks of the tables of level 0 into the block cache before
+	// it returns, and those of the deeper levels in the background. See DB.Warmed.
+	StagedOpen bool
+
 	// ChecksumVerificationMode decides when db should verify checksums for SSTable blocks.
 	ChecksumVerificationMode options.ChecksumVerificationMode
 
@@ -98,6 +222,14 @@ type Options struct {
 	// conflict detection is disabled.
 	DetectConflicts bool
 
+	// MaxAsyncWrites is the number of writes of DB.ApplyAsync in flight at most. ApplyAsync
+	// blocks until one of them is done once there are as many.
+	MaxAsyncWrites int
+
+	// Budgets of the bytes written per second by the writes and by the compactions.
+	WriteRateLimiter      RateLimiter
+	CompactionRateLimiter RateLimiter
+
 	// NamespaceOffset specifies the offset from where the next 8 bytes contains the namespace.
 	NamespaceOffset int
 
@@ -109,6 +241,14 @@ type Options struct {
 	// This is only useful for databases built on top of Badger (like Dgraph).
 	// Not recommended for most users.
 	managedTxns bool
+	// asOf is the version the transactions read at, set by OpenAt.
+	asOf uint64
+
+	// manager shares its caches and compaction slots with the DB, if set by Manager.Open.
+	manager *Manager
+
+	// archive holds the tables of the DB, if set by OpenArchive.
+	archive *archive
 
 	// 4. Flags for testing purposes
 	// ------------------------------
@@ -137,10 +277,18 @@ func DefaultOptions(path string) Options {
 		NumCompactors:           4, // Run at least 2 compactors. Zero-th compactor prioritizes L0.
 		NumLevelZeroTables:      5,
 		NumLevelZeroTablesStall: 15,
+		CompactionBacklogScore:  2,
+		StatsHistoryRetention:   14 * 24 * time.Hour,
+		HeatmapPrefixLen:        16,
+		ConflictPrefixLen:       16,
+		HeatmapInterval:         time.Minute,
+		LifecycleInterval:       10 * time.Minute,
 		NumMemtables:            5,
 		BloomFalsePositive:      0.01,
 		BlockSize:               4 * 1024,
 		SyncWrites:              false,
+		SyncInterval:            time.Second,
+		FlightRecorderSize:      1024,
 		NumVersionsToKeep:       1,
 		CompactL0OnClose:        false,
 		VerifyValueChecksum:     false,
@@ -173,6 +321,7 @@ func DefaultOptions(path string) Options {
 		EncryptionKey:                 []byte{},
 		EncryptionKeyRotationDuration: 10 * 24 * time.Hour, // Default 10 days.
 		DetectConflicts:               true,
+		MaxAsyncWrites:                1000,
 		NamespaceOffset:               -1,
 	}
 }
@@ -181,20 +330,27 @@ func buildTableOptions(db *DB) table.Options {
 	opt := db.opt
 	dk, err := db.registry.LatestDataKey()
 	y.Check(err)
-	return table.Options{
+	topt := table.Options{
 		ReadOnly:             opt.ReadOnly,
+		NoSync:               opt.TableSyncPolicy == options.SyncNever,
 		MetricsEnabled:       db.opt.MetricsEnabled,
+		Metrics:              db.metrics,
 		TableSize:            uint64(opt.BaseTableSize),
 		BlockSize:            opt.BlockSize,
 		BloomFalsePositive:   opt.BloomFalsePositive,
 		ChkMode:              opt.ChecksumVerificationMode,
 		Compression:          opt.Compression,
 		ZSTDCompressionLevel: opt.ZSTDCompressionLevel,
+		ExtractPrefix:        opt.PrefixExtractor.Extract,
+		PrefixFilter:         opt.PrefixExtractor.Name,
 		BlockCache:           db.blockCache,
 		IndexCache:           db.indexCache,
+		CacheID:              db.cacheID,
 		AllocPool:            db.allocPool,
 		DataKey:              dk,
 	}
+	db.dicts.Load().setTableOptions(&topt, -1)
+	return topt
 }
 
 const (
@@ -293,7 +449,8 @@ func generateSuperFlag(options Options) string {
 // It specially handles compression subflag.
 // Valid options are {none,snappy,zstd:<level>}
 // Example: compression=zstd:3;
-// Unsupported: Options.Logger, Options.EncryptionKey
+// Unsupported: Options.Logger, Options.EncryptionKey, Options.KeyProvider,
+// Options.LifecycleArchive, Options.BlockCache
 func (opt Options) FromSuperFlag(superflag string) Options {
 	// currentOptions act as a default value for the options superflag.
 	currentOptions := generateSuperFlag(opt)
@@ -375,12 +532,228 @@ func (opt Options) WithValueDir(val string) Options {
 // When set to true, Badger would call an additional msync after writes to flush mmap buffer over to
 // disk to survive hard reboots. Most users of Badger should not need to do this.
 //
+// SyncWrites only applies to the value log and WAL, and only while ValueLogSyncPolicy is
+// options.SyncDefault. See WithValueLogSyncPolicy for finer control.
+//
 // The default value of SyncWrites is false.
 func (opt Options) WithSyncWrites(val bool) Options {
 	opt.SyncWrites = val
 	return opt
 }
 
+// WithValueLogSyncPolicy returns a new Options value with ValueLogSyncPolicy set to the given
+// value.
+//
+// ValueLogSyncPolicy decides when appends to the value log and the memtable WAL are synced.
+// SyncAlways is equivalent to SyncWrites=true. SyncInterval syncs both logs in the background
+// every SyncInterval, bounding the window of acknowledged writes which can be lost on power
+// failure. SyncNever is equivalent to SyncWrites=false.
+//
+// The default value of ValueLogSyncPolicy is options.SyncDefault, which defers to SyncWrites.
+func (opt Options) WithValueLogSyncPolicy(val options.SyncPolicy) Options {
+	opt.ValueLogSyncPolicy = val
+	return opt
+}
+
+// WithDurability returns a new Options value with Durability set to the given value.
+//
+// Durability chooses when the writes to the value log and WAL are made durable:
+// options.SyncEveryWrite before acknowledging them, options.SyncEveryInterval every SyncInterval
+// in the background, or options.SyncOnClose only when the DB is closed or synced explicitly. It
+// sets ValueLogSyncPolicy, and Open fails if ValueLogSyncPolicy or SyncWrites ask otherwise.
+//
+// The default value of Durability is options.DurabilityDefault, which defers to
+// ValueLogSyncPolicy and SyncWrites.
+func (opt Options) WithDurability(val options.Durability) Options {
+	opt.Durability = val
+	return opt
+}
+
+// WithGroupCommitWindow returns a new Options value with GroupCommitWindow set to the given
+// value.
+//
+// GroupCommitWindow is how long the writer waits for more writes to join a batch, from the first
+// write of the batch, before writing it. A longer window makes bigger batches which share a sync,
+// raising the throughput of concurrent synced writes at the cost of their latency. Without a
+// window, a batch holds the writes queued while the previous batch was written.
+//
+// The default value of GroupCommitWindow is 0.
+func (opt Options) WithGroupCommitWindow(val time.Duration) Options {
+	opt.GroupCommitWindow = val
+	return opt
+}
+
+// WithManifestSyncPolicy returns a new Options value with ManifestSyncPolicy set to the given
+// value.
+//
+// ManifestSyncPolicy decides when updates to the MANIFEST file are synced. Relaxing it from
+// SyncAlways means that, after a power failure, the MANIFEST might not reference tables which
+// were already created and whose data was removed from the logs. Only use SyncInterval or
+// SyncNever if the data can be rebuilt from elsewhere.
+//
+// The default value of ManifestSyncPolicy is options.SyncDefault, which is SyncAlways.
+func (opt Options) WithManifestSyncPolicy(val options.SyncPolicy) Options {
+	opt.ManifestSyncPolicy = val
+	return opt
+}
+
+// WithTableSyncPolicy returns a new Options value with TableSyncPolicy set to the given value.
+//
+// TableSyncPolicy decides whether newly created SSTables are synced before they are added to
+// the MANIFEST. With SyncNever, a power failure shortly after a memtable flush or compaction can
+// leave the MANIFEST pointing at incomplete tables. SyncInterval is not supported for tables,
+// since a table must be durable before it is referenced.
+//
+// The default value of TableSyncPolicy is options.SyncDefault, which is SyncAlways.
+func (opt Options) WithTableSyncPolicy(val options.SyncPolicy) Options {
+	opt.TableSyncPolicy = val
+	return opt
+}
+
+// WithSyncInterval returns a new Options value with SyncInterval set to the given value.
+//
+// SyncInterval is the period of the background sync for components whose sync policy is
+// options.SyncInterval.
+//
+// The default value of SyncInterval is 1 second.
+func (opt Options) WithSyncInterval(val time.Duration) Options {
+	opt.SyncInterval = val
+	return opt
+}
+
+// WithMaxUnsyncedBytes returns a new Options value with MaxUnsyncedBytes set to the given value.
+//
+// When writes are not synced synchronously, MaxUnsyncedBytes triggers a background sync of the
+// value log and WAL once this many bytes have been written since the last sync. Together with
+// MaxUnsyncedDuration it bounds how much acknowledged data can be lost on power failure.
+//
+// The default value of MaxUnsyncedBytes is 0, which disables the bound.
+func (opt Options) WithMaxUnsyncedBytes(val int64) Options {
+	opt.MaxUnsyncedBytes = val
+	return opt
+}
+
+// WithMaxUnsyncedDuration returns a new Options value with MaxUnsyncedDuration set to the given
+// value.
+//
+// When writes are not synced synchronously, MaxUnsyncedDuration makes sure that no write stays
+// unsynced for longer than this duration, by syncing the value log and WAL in the background.
+//
+// The default value of MaxUnsyncedDuration is 0, which disables the bound.
+func (opt Options) WithMaxUnsyncedDuration(val time.Duration) Options {
+	opt.MaxUnsyncedDuration = val
+	return opt
+}
+
+// WithFlightRecorderSize returns a new Options value with FlightRecorderSize set to the given
+// value.
+//
+// FlightRecorderSize is the number of most recent internal events, like commits, flushes, stalls
+// and GC passes, kept in memory and returned by DB.FlightRecorder. Setting it to zero disables
+// the flight recorder.
+//
+// The default value of FlightRecorderSize is 1024.
+func (opt Options) WithFlightRecorderSize(val int) Options {
+	opt.FlightRecorderSize = val
+	return opt
+}
+
+// WithMaxPrefetchMemory returns a new Options value with MaxPrefetchMemory set to the given
+// value.
+//
+// MaxPrefetchMemory caps the memory held by values prefetched by iterators with
+// IteratorOptions.PrefetchValues set. The budget is shared fairly between the open prefetching
+// iterators. Once an iterator holds its share, further values are loaded lazily on Item.Value
+// until it moves past the values it already holds. When more iterators are opened, those holding
+// more than their new share evict the values they prefetched farthest ahead as they move on.
+// Setting it to zero disables the cap.
+//
+// The default value of MaxPrefetchMemory is 0.
+func (opt Options) WithMaxPrefetchMemory(val int64) Options {
+	opt.MaxPrefetchMemory = val
+	return opt
+}
+
+// WithColumnFamily returns a new Options value with the options of the column family name set to
+// cfo in ColumnFamilies.
+//
+// The keys of a column family are kept apart from the keys of the DB and of the other column
+// families, in the same WAL and transactions. A column family without options of its own shares
+// the table options of the DB, and its entries don't expire by default. See DB.ColumnFamily.
+func (opt Options) WithColumnFamily(name string, cfo ColumnFamilyOptions) Options {
+	cfs := make(map[string]ColumnFamilyOptions, len(opt.ColumnFamilies)+1)
+	for n, o := range opt.ColumnFamilies {
+		cfs[n] = o
+	}
+	cfs[name] = cfo
+	opt.ColumnFamilies = cfs
+	return opt
+}
+
+// WithTxnMaxEntries returns a new Options value with TxnMaxEntries set to the given value.
+//
+// TxnMaxEntries is the maximum number of writes in a single transaction. Set, SetEntry and
+// Delete return a *TxnLimitError as soon as a write would exceed it, instead of the transaction
+// growing until it hits ErrTxnTooBig.
+//
+// The default value of TxnMaxEntries is 0, which means no limit besides ErrTxnTooBig.
+func (opt Options) WithTxnMaxEntries(val int64) Options {
+	opt.TxnMaxEntries = val
+	return opt
+}
+
+// WithTxnMaxMemory returns a new Options value with TxnMaxMemory set to the given value.
+//
+// TxnMaxMemory is the maximum number of bytes of keys and values buffered by a single
+// transaction. Set, SetEntry and Delete return a *TxnLimitError as soon as a write would exceed
+// it.
+//
+// The default value of TxnMaxMemory is 0, which means no limit besides ErrTxnTooBig.
+func (opt Options) WithTxnMaxMemory(val int64) Options {
+	opt.TxnMaxMemory = val
+	return opt
+}
+
+// WithMaxKeySize returns a new Options value with MaxKeySize set to the given value.
+//
+// MaxKeySize is the maximum length of a key. Set, SetEntry and Delete return an error matching
+// ErrKeyTooLarge for longer keys. It can't be more than 65000, the most the table format allows.
+//
+// The default value of MaxKeySize is 0, which means 65000.
+func (opt Options) WithMaxKeySize(val int) Options {
+	opt.MaxKeySize = val
+	return opt
+}
+
+// WithMaxValueSize returns a new Options value with MaxValueSize set to the given value.
+//
+// MaxValueSize is the maximum length of a value. Set and SetEntry return an error matching
+// ErrValueTooLarge for longer values. Values that don't fit can be split into chunks with
+// ValueSplitSize, or with the chunked package.
+//
+// The default value of MaxValueSize is 0, which means ValueLogFileSize.
+func (opt Options) WithMaxValueSize(val int64) Options {
+	opt.MaxValueSize = val
+	return opt
+}
+
+// WithValueSplitSize returns a new Options value with ValueSplitSize set to the given value.
+//
+// ValueSplitSize is the length above which Set and SetEntry split a value into chunks of that
+// length, written as entries of their own under an internal prefix, with a manifest of the chunks
+// as the value of the key. Reads join the chunks back transparently, so that values longer than
+// MaxValueSize, which applies to each chunk, can be written. The chunks of a value are written
+// in the same transaction as it, and deleted by compactions once it's discarded.
+//
+// Item.ValueSize and Item.EstimatedSize report the size of the manifest of a split value.
+// ValueSplitSize must not be above MaxValueSize.
+//
+// The default value of ValueSplitSize is 0, which doesn't split values.
+func (opt Options) WithValueSplitSize(val int64) Options {
+	opt.ValueSplitSize = val
+	return opt
+}
+
 // WithNumVersionsToKeep returns a new Options value with NumVersionsToKeep set to the given value.
 //
 // NumVersionsToKeep sets how many versions to keep per key at most.
@@ -391,6 +764,18 @@ func (opt Options) WithNumVersionsToKeep(val int) Options {
 	return opt
 }
 
+// WithVersionGC returns a new Options value with VersionGC set to the given value.
+//
+// VersionGC decides when the versions of the keys older than the NumVersionsToKeep newest ones
+// may be purged: by age, by count or by a watermark, see VersionGCByAge, VersionGCByCount and
+// VersionGCByWatermark. No version read by a transaction running is purged either way.
+//
+// The default value of VersionGC is nil.
+func (opt Options) WithVersionGC(gc VersionGC) Options {
+	opt.VersionGC = gc
+	return opt
+}
+
 // WithNumGoroutines sets the number of goroutines to be used in Stream.
 //
 // The default value of NumGoroutines is 8.
@@ -401,10 +786,13 @@ func (opt Options) WithNumGoroutines(val int) Options {
 
 // WithReadOnly returns a new Options value with ReadOnly set to the given value.
 //
-// When ReadOnly is true the DB will be opened on read-only mode.
-// Multiple processes can open the same Badger DB.
-// Note: if the DB being opened had crashed before and has vlog data to be replayed,
-// ReadOnly will cause Open to fail with an appropriate message.
+// When ReadOnly is true the DB will be opened on read-only mode, without modifying its files,
+// and the writes fail. It takes no lock on the directory, so that any number of processes can
+// open the DB while another one writes to it, such as tools inspecting a live database. The
+// transactions in the WAL are replayed into memory, up to the last one written completely, so
+// the DB is read as of its opening, until DB.Refresh. The writer removes the files it's done with
+// without truncating them, so that they are read until the read-only DB unmaps them. It isn't
+// supported on Windows and Plan 9.
 //
 // The default value of ReadOnly is false.
 func (opt Options) WithReadOnly(val bool) Options {
@@ -412,6 +800,29 @@ func (opt Options) WithReadOnly(val bool) Options {
 	return opt
 }
 
+// WithRefreshInterval returns a new Options value with RefreshInterval set to the given value.
+//
+// RefreshInterval is how often a DB opened with ReadOnly calls DB.Refresh, to read the writes of
+// the process writing to its directory since. Such a DB is a read replica of the writer on the
+// same host, lagging by up to RefreshInterval. It's ignored by the other DBs and by OpenAt.
+//
+// The default value of RefreshInterval is 0, which never refreshes the DB by itself.
+func (opt Options) WithRefreshInterval(val time.Duration) Options {
+	opt.RefreshInterval = val
+	return opt
+}
+
+// WithFollower returns a new Options value with Follower set to the given value.
+//
+// When Follower is true the DB is opened as a follower of a leader, see DB.Follow: it serves
+// reads, while the writes other than those replicated from the leader fail with ErrFollower.
+//
+// The default value of Follower is false.
+func (opt Options) WithFollower(val bool) Options {
+	opt.Follower = val
+	return opt
+}
+
 // WithMetricsEnabled returns a new Options value with MetricsEnabled set to the given value.
 //
 // When MetricsEnabled is set to false, then the DB will be opened and no badger metrics
@@ -427,6 +838,29 @@ func (opt Options) WithMetricsEnabled(val bool) Options {
 	return opt
 }
 
+// WithLatencyBuckets returns a new Options value with LatencyBuckets set to the given value.
+//
+// LatencyBuckets are the upper bounds of the buckets of the latency histograms of Get, Put,
+// Commit, Iterator.Seek and compactions kept for this DB, and returned by DB.LatencyHistograms.
+// The process-wide histograms in badger_latency_us always use y.DefaultLatencyBuckets.
+//
+// The default value of LatencyBuckets is nil, which means y.DefaultLatencyBuckets.
+func (opt Options) WithLatencyBuckets(val []time.Duration) Options {
+	opt.LatencyBuckets = val
+	return opt
+}
+
+// WithMetricsLabel returns a new Options value with MetricsLabel set to the given value.
+//
+// Besides adding to the process-wide metrics, every DB publishes its own metrics in the
+// badger_db expvar map, keyed by MetricsLabel. Set it to tell apart DBs in the same process.
+//
+// The default value of MetricsLabel is empty, which means Dir, or "memory-<n>" in InMemory mode.
+func (opt Options) WithMetricsLabel(val string) Options {
+	opt.MetricsLabel = val
+	return opt
+}
+
 // WithLogger returns a new Options value with Logger set to the given value.
 //
 // Logger provides a way to configure what logger each value of badger.DB uses.
@@ -530,6 +964,45 @@ func (opt Options) WithMemTableSize(val int64) Options {
 	return opt
 }
 
+// WithMemTableMaxEntries returns a new Options value with MemTableMaxEntries set to the given
+// value.
+//
+// MemTableMaxEntries is the number of entries at which the memtable is flushed, even if it's
+// smaller than MemTableSize. Zero means no limit. The flushes are counted by cause in the
+// flush_num_memtable metric.
+//
+// The default value of MemTableMaxEntries is 0.
+func (opt Options) WithMemTableMaxEntries(val int64) Options {
+	opt.MemTableMaxEntries = val
+	return opt
+}
+
+// WithMemTableMaxValueLogFiles returns a new Options value with MemTableMaxValueLogFiles set to
+// the given value.
+//
+// MemTableMaxValueLogFiles is the number of value log files, the segments of the log of the
+// values above ValueThreshold, which the values of the memtable can be in before it's flushed.
+// Zero means no limit.
+//
+// The default value of MemTableMaxValueLogFiles is 0.
+func (opt Options) WithMemTableMaxValueLogFiles(val int) Options {
+	opt.MemTableMaxValueLogFiles = val
+	return opt
+}
+
+// WithMemTableMaxAge returns a new Options value with MemTableMaxAge set to the given value.
+//
+// MemTableMaxAge is how long the entries are kept in the memtable at most: it's flushed once
+// its first write is that old, even if the DB isn't written to anymore, so that a store with
+// little traffic doesn't keep its writes in the WAL for hours. The age is checked on writes and
+// every quarter of MemTableMaxAge. Zero means no limit.
+//
+// The default value of MemTableMaxAge is 0.
+func (opt Options) WithMemTableMaxAge(val time.Duration) Options {
+	opt.MemTableMaxAge = val
+	return opt
+}
+
 // WithBloomFalsePositive returns a new Options value with BloomFalsePositive set
 // to the given value.
 //
@@ -546,6 +1019,20 @@ func (opt Options) WithBloomFalsePositive(val float64) Options {
 	return opt
 }
 
+// WithPrefixExtractor returns a new Options value with PrefixExtractor set to the given value.
+//
+// PrefixExtractor extracts the prefixes of the keys added to a prefix bloom filter in every
+// SSTable built from now on, like FixedPrefixExtractor. An Iterator with a Prefix skips the
+// tables whose filter doesn't have the prefix of Prefix, which saves the seeks of narrow scans
+// over many tables. The keys point-looked up use the bloom filter of BloomFalsePositive, which
+// is also the false positive probability of the prefix bloom filters.
+//
+// The default value of PrefixExtractor has no Extract, and builds no prefix bloom filter.
+func (opt Options) WithPrefixExtractor(val PrefixExtractor) Options {
+	opt.PrefixExtractor = val
+	return opt
+}
+
 // WithBlockSize returns a new Options value with BlockSize set to the given value.
 //
 // BlockSize sets the size of any block in SSTable. SSTable is divided into multiple blocks
@@ -600,6 +1087,34 @@ func (opt Options) WithValueLogMaxEntries(val uint32) Options {
 	return opt
 }
 
+// WithValueLogGCPolicy returns a new Options value with ValueLogGCPolicy set to the given value.
+//
+// ValueLogGCPolicy schedules the value log GC, so that RunValueLogGC needn't be called in a loop.
+// Every Interval, the value log files whose discard stats, collected by the compactions, cross
+// the thresholds of the policy are rewritten, the most discardable first. See DB.ValueLogGCStats
+// for its progress, also published in the gc_*_vlog metrics.
+//
+// The default value of ValueLogGCPolicy has no Interval, which leaves the GC to RunValueLogGC.
+func (opt Options) WithValueLogGCPolicy(val ValueLogGCPolicy) Options {
+	opt.ValueLogGCPolicy = val
+	return opt
+}
+
+// WithMaintenanceWindows returns a new Options value with MaintenanceWindows set to the given
+// value.
+//
+// MaintenanceWindows schedule the heavy background jobs off-peak. At the start of a window,
+// matching its cron spec, its Jobs are run once: the value log GC, the reaping of expired keys,
+// a Flatten or a scrub of the tables. The periodic runs of the value log GC of ValueLogGCPolicy
+// and of the reaper of TTLReaperInterval only happen while a window listing them is open, if
+// any window with a Duration does.
+//
+// The default value of MaintenanceWindows is nil, which runs the jobs whenever they're due.
+func (opt Options) WithMaintenanceWindows(val []MaintenanceWindow) Options {
+	opt.MaintenanceWindows = val
+	return opt
+}
+
 // WithNumCompactors sets the number of compaction workers to run concurrently.  Setting this to
 // zero stops compactions, which could eventually cause writes to block forever.
 //
@@ -609,6 +1124,181 @@ func (opt Options) WithNumCompactors(val int) Options {
 	return opt
 }
 
+// WithParanoidCompactionChecks returns a new Options value with ParanoidCompactionChecks set to
+// the given value.
+//
+// ParanoidCompactionChecks makes every compaction re-read the tables it wrote, verify their
+// checksums, and check that their keys are sorted, match the counts and ranges in their indexes,
+// and were all present in the input tables, before the manifest drops the inputs. A compaction
+// failing the checks returns ErrCompactionCheck and leaves the inputs in place, so that bad RAM
+// or a bad disk is caught before any data is deleted. The checks cost an extra read of every
+// table written.
+//
+// The default value of ParanoidCompactionChecks is false.
+func (opt Options) WithParanoidCompactionChecks(val bool) Options {
+	opt.ParanoidCompactionChecks = val
+	return opt
+}
+
+// WithStrictInvariantChecks returns a new Options value with StrictInvariantChecks set to the
+// given value.
+//
+// StrictInvariantChecks makes reads check invariants the DB otherwise assumes: iterators check
+// that keys, and the versions of every key, come in order, Txn.Get that the version it read isn't
+// above the read timestamp of the transaction, and values read from the value log that their value
+// pointer spans exactly one entry. A failed check returns an InvariantError, matching
+// ErrInvariantViolated, instead of data which may be wrong: from Iterator.Err for iterators, which
+// stop at the key out of order, and from Txn.Get and Item.Value otherwise. The checks cost a few
+// percent of CPU on reads.
+//
+// The default value of StrictInvariantChecks is false.
+func (opt Options) WithStrictInvariantChecks(val bool) Options {
+	opt.StrictInvariantChecks = val
+	return opt
+}
+
+// WithReadLatencySLO returns a new Options value with ReadLatencySLO set to the given value.
+//
+// ReadLatencySLO is the p99 latency of Txn.Get the DB should keep. Every second, the p99 latency
+// of the Gets of the last second is compared with it: compactions are paused while it is above,
+// and resume once it is back below. While paused, a level is still compacted if its score reaches
+// CompactionBacklogScore, and L0 if it has NumLevelZeroTablesStall tables, so that the backlog
+// doesn't stall writes. Pauses and resumes are recorded by the flight recorder and counted in
+// the metrics.
+//
+// The default value of ReadLatencySLO is 0, which never pauses compactions.
+func (opt Options) WithReadLatencySLO(val time.Duration) Options {
+	opt.ReadLatencySLO = val
+	return opt
+}
+
+// WithCompactionBacklogScore returns a new Options value with CompactionBacklogScore set to the
+// given value.
+//
+// CompactionBacklogScore is the compaction score from which a level is compacted even while
+// compactions are paused because of ReadLatencySLO. The score of L0 is its number of tables over
+// NumLevelZeroTables, and the score of the other levels their size over their target size.
+//
+// The default value of CompactionBacklogScore is 2.
+func (opt Options) WithCompactionBacklogScore(val float64) Options {
+	opt.CompactionBacklogScore = val
+	return opt
+}
+
+// WithCompactionFilter returns a new Options value with CompactionFilter set to the given value.
+//
+// CompactionFilter is called by compactions on every version of a key at or below the discard
+// timestamp, below the read timestamps of the running transactions, with its value, to decide
+// whether to keep it, drop it or modify its value. It prunes data, like old state, without writing
+// deletes for it. Dropping a version deletes the key as of that version. Deleted and expired
+// versions, merge deltas and internal keys aren't passed to it. Values stored in the value log are
+// read to be passed to it.
+//
+// The newest of those versions is still read by the running transactions, unless the key has a
+// newer version they read. The decision isn't written at a version of its own, like a delete, so
+// the transactions reading the version while a compaction filters it see it change: the key is
+// gone, or has the new value, once the compaction is done. The filter is meant for data which
+// isn't read anymore.
+//
+// CompactionFilter is called concurrently by the compactors, and must be deterministic: a version
+// is passed to it again by every compaction it goes through. The value it is passed is only valid
+// until it returns.
+//
+// The default value of CompactionFilter is nil.
+func (opt Options) WithCompactionFilter(
+	val func(key, value []byte, version uint64) Decision) Options {
+	opt.CompactionFilter = val
+	return opt
+}
+
+// WithStatsHistoryInterval returns a new Options value with StatsHistoryInterval set to the given
+// value.
+//
+// StatsHistoryInterval is how often a snapshot of the internal metrics of the DB, such as the
+// shape of the levels, the time writes were stalled and the hit ratios of the caches, is written
+// to the DB under an internal prefix, to be read back with DB.StatsHistory. Snapshots are small,
+// and are only taken by DBs which aren't opened in ReadOnly mode.
+//
+// The default value of StatsHistoryInterval is 0, which doesn't take snapshots.
+func (opt Options) WithStatsHistoryInterval(val time.Duration) Options {
+	opt.StatsHistoryInterval = val
+	return opt
+}
+
+// WithStatsHistoryRetention returns a new Options value with StatsHistoryRetention set to the
+// given value.
+//
+// StatsHistoryRetention is how long the snapshots taken every StatsHistoryInterval are kept: they
+// expire after it, and are removed by compactions. Zero keeps them forever.
+//
+// The default value of StatsHistoryRetention is 14 days, which allows week-over-week comparisons.
+func (opt Options) WithStatsHistoryRetention(val time.Duration) Options {
+	opt.StatsHistoryRetention = val
+	return opt
+}
+
+// WithHeatmapSampleRate returns a new Options value with HeatmapSampleRate set to the given value.
+//
+// HeatmapSampleRate is the fraction, from 0 to 1, of the point reads and the writes counted by
+// the prefixes of their keys, to be read back with DB.Heatmap. Each sampled access counts for
+// 1/HeatmapSampleRate accesses, so that a low rate estimates the counts at a small cost.
+//
+// The default value of HeatmapSampleRate is 0, which doesn't count accesses.
+func (opt Options) WithHeatmapSampleRate(val float64) Options {
+	opt.HeatmapSampleRate = val
+	return opt
+}
+
+// WithHeatmapPrefixLen returns a new Options value with HeatmapPrefixLen set to the given value.
+//
+// HeatmapPrefixLen is the length, in bytes, of the longest prefix the accesses are counted by:
+// DB.Heatmap sums the counts up by shorter prefixes. At most 65536 distinct prefixes are counted,
+// so it should be short enough for the prefixes of the keys to be fewer.
+//
+// The default value of HeatmapPrefixLen is 16.
+func (opt Options) WithHeatmapPrefixLen(val int) Options {
+	opt.HeatmapPrefixLen = val
+	return opt
+}
+
+// WithConflictPrefixLen returns a new Options value with ConflictPrefixLen set to the given value.
+//
+// ConflictPrefixLen is the length, in bytes, of the prefixes of the keys the transactions failed
+// with a ConflictError are counted by, in the conflict_num_txn metric. It should be short enough
+// for the prefixes of the keys to be few, like the prefixes of the tables of an application.
+//
+// The default value of ConflictPrefixLen is 16.
+func (opt Options) WithConflictPrefixLen(val int) Options {
+	opt.ConflictPrefixLen = val
+	return opt
+}
+
+// WithHeatmapInterval returns a new Options value with HeatmapInterval set to the given value.
+//
+// HeatmapInterval is how often the counts of the heatmap are written to the DB, under an internal
+// prefix, so that they are kept across restarts. They are written on Close as well. Counts are
+// only persisted by DBs which aren't opened in ReadOnly or managed mode.
+//
+// The default value of HeatmapInterval is 1 minute.
+func (opt Options) WithHeatmapInterval(val time.Duration) Options {
+	opt.HeatmapInterval = val
+	return opt
+}
+
+// WithTTLReaperInterval returns a new Options value with TTLReaperInterval set to the given value.
+//
+// Expired keys are otherwise only removed when compactions happen to pick their tables, which may
+// never happen to a table no writes overlap. Every TTLReaperInterval, the levels below L0 are
+// scanned for tables whose keys with a TTL have all expired, and those tables are compacted, out
+// of the compaction priorities. The number of expired keys found is published in the
+// expired_num_lsm metric, and the number of compactions run in compaction_ttl_num_lsm.
+//
+// The default value of TTLReaperInterval is 0, which doesn't look for them.
+func (opt Options) WithTTLReaperInterval(val time.Duration) Options {
+	opt.TTLReaperInterval = val
+	return opt
+}
+
 // WithCompactL0OnClose determines whether Level 0 should be compacted before closing the DB.  This
 // ensures that both reads and writes are efficient when the DB is opened later.
 //
@@ -618,6 +1308,99 @@ func (opt Options) WithCompactL0OnClose(val bool) Options {
 	return opt
 }
 
+// WithValueTransformers returns a new Options value with ValueTransformers set to the given
+// value.
+//
+// ValueTransformers encode the values of the keys with their prefixes when they're set, and
+// decode them when they're read, as values of items or of iterators. The values are stored as
+// encoded, tagged with the ID and version of their transformer: a transformer must be kept in
+// ValueTransformers as long as values encoded by it are stored, even if its prefix changes.
+// Compaction filters and merge operators work on the stored values; merge deltas aren't encoded.
+// Backups, archives and streams hold the values as decoded.
+//
+// The default value of ValueTransformers is nil.
+func (opt Options) WithValueTransformers(val ...ValueTransformer) Options {
+	opt.ValueTransformers = val
+	return opt
+}
+
+// WithLifecycleInterval returns a new Options value with LifecycleInterval set to the given value.
+//
+// LifecycleInterval is how often the keys of the lifecycle policies set with
+// DB.SetLifecyclePolicy are archived and deleted, once they are old enough. It is also the
+// precision of their age. The TTL and MaxVersions of the policies don't depend on it.
+//
+// The default value of LifecycleInterval is 10 minutes. Zero never archives or deletes keys.
+func (opt Options) WithLifecycleInterval(val time.Duration) Options {
+	opt.LifecycleInterval = val
+	return opt
+}
+
+// WithLifecycleArchive returns a new Options value with LifecycleArchive set to the given value.
+//
+// LifecycleArchive is the object store the keys of the lifecycle policies with an ArchiveAfter
+// are archived to, as backups which DB.Load restores.
+//
+// The default value of LifecycleArchive is nil.
+func (opt Options) WithLifecycleArchive(val objstore.Store) Options {
+	opt.LifecycleArchive = val
+	return opt
+}
+
+// WithColdStorageDir returns a new Options value with ColdStorageDir set to the given value.
+//
+// ColdStorageDir is the directory the tables of the cold storage policy of ColdStorageLevel and
+// ColdStorageAge are moved to, typically on a second, slower and cheaper volume than Dir. The
+// manifest records the directory of every table, and reads span both transparently. The tables
+// are checked for the policy every minute, or when DB.MoveColdTables is called. Compactions read
+// the tables in cold storage, and write the tables they create to Dir. Once set, ColdStorageDir
+// must be set whenever the DB is opened.
+//
+// The default value of ColdStorageDir is "", which keeps every table in Dir.
+func (opt Options) WithColdStorageDir(val string) Options {
+	opt.ColdStorageDir = val
+	return opt
+}
+
+// WithColdStorageLevel returns a new Options value with ColdStorageLevel set to the given value.
+//
+// ColdStorageLevel is the first level whose tables are moved to ColdStorageDir. Level 0 is never
+// moved.
+//
+// The default value of ColdStorageLevel is 0, which moves the tables of the last level only.
+func (opt Options) WithColdStorageLevel(val int) Options {
+	opt.ColdStorageLevel = val
+	return opt
+}
+
+// WithColdStorageAge returns a new Options value with ColdStorageAge set to the given value.
+//
+// ColdStorageAge is the age of the tables moved to ColdStorageDir, since their creation by a
+// flush or compaction.
+//
+// The default value of ColdStorageAge is 0, which moves the tables of ColdStorageLevel whatever
+// their age.
+func (opt Options) WithColdStorageAge(val time.Duration) Options {
+	opt.ColdStorageAge = val
+	return opt
+}
+
+// WithRemoteTableStore returns a new Options value with RemoteTableStore set to the given value.
+//
+// RemoteTableStore stores the tables of the cold storage policy of ColdStorageLevel and
+// ColdStorageAge, instead of ColdStorageDir, typically in object storage, see
+// NewObjectTableStore. The tables are read from it block by block, through the block cache, so
+// that only the indices of the tables and the blocks read are held locally. The manifest records
+// the tables in RemoteTableStore, and the store must be set whenever the DB is opened. The
+// objects of the store which aren't tables of the manifest are deleted when the DB is opened,
+// so that the store can't be shared between DBs.
+//
+// The default value of RemoteTableStore is nil, which keeps every table on the local disk.
+func (opt Options) WithRemoteTableStore(val TableStore) Options {
+	opt.RemoteTableStore = val
+	return opt
+}
+
 // WithEncryptionKey is used to encrypt the data with AES. Type of AES is used based on the key
 // size. For example 16 bytes will use AES-128. 24 bytes will use AES-192. 32 bytes will
 // use AES-256.
@@ -626,6 +1409,37 @@ func (opt Options) WithEncryptionKey(key []byte) Options {
 	return opt
 }
 
+// WithKeyProvider returns a new Options value with KeyProvider set to the given value.
+//
+// KeyProvider gives the master key encrypting the data keys, in place of EncryptionKey, from a
+// key management service such as AWS KMS, HashiCorp Vault or an HSM. The key is asked for on
+// Open, and replaced by DB.RotateMasterKey. EncryptionKey must not be set along with it.
+//
+// The default value of KeyProvider is nil.
+func (opt Options) WithKeyProvider(val KeyProvider) Options {
+	opt.KeyProvider = val
+	return opt
+}
+
+// WithEncryptionAlgo returns a new Options value with EncryptionAlgo set to the given value.
+//
+// EncryptionAlgo is the algorithm used to encrypt the data, if EncryptionKey is set.
+// pb.EncryptionAlgo_aes runs AES in CTR mode, which doesn't detect data tampered with at rest.
+// pb.EncryptionAlgo_aes_gcm and pb.EncryptionAlgo_chacha20poly1305 append a tag to every block of
+// the tables and every entry of the value log, verified on read, with the header of the entry.
+// ChaCha20-Poly1305 is faster than AES on CPUs without AES instructions, as found on many ARM
+// boards; it needs a key of 32 bytes.
+// The algorithm applies to the data keys generated from now on, so that data encrypted with the
+// previous one can still be read: an AES database switched to AES-GCM is migrated as its tables
+// are compacted and its value log files rotated. The MANIFEST records the algorithm of every
+// table, so that one written with an authenticated algorithm is never read without it.
+//
+// The default value of EncryptionAlgo is pb.EncryptionAlgo_aes.
+func (opt Options) WithEncryptionAlgo(val pb.EncryptionAlgo) Options {
+	opt.EncryptionAlgo = val
+	return opt
+}
+
 // WithEncryptionKeyRotationDuration returns new Options value with the duration set to
 // the given value.
 //
@@ -684,6 +1498,32 @@ func (opt Options) WithBlockCacheSize(size int64) Options {
 	return opt
 }
 
+// WithBlockCacheShards returns a new Options value with BlockCacheShards set to the given value.
+//
+// The block cache is split into this many shards, ristretto caches of BlockCacheSize/n bytes
+// each, which the blocks are spread over by the hash of their keys. Sharding the cache lowers the
+// contention of the reads of many cores, at the cost of a less precise eviction policy. The
+// metrics of the shards are returned by DB.BlockCacheShardMetrics.
+//
+// The default value of BlockCacheShards is 0, a single cache.
+func (opt Options) WithBlockCacheShards(n int) Options {
+	opt.BlockCacheShards = n
+	return opt
+}
+
+// WithBlockCache returns a new Options value with BlockCache set to the given value.
+//
+// The DB uses this cache for its blocks instead of creating one, and ignores BlockCacheSize and
+// BlockCacheShards. The cache can be shared by many DBs, whose keys it tells apart, and isn't
+// closed with them. The BlockCache interface is implemented by ristretto caches of
+// table.Block and by ShardedBlockCache, or can be implemented by custom caches.
+//
+// The default value of BlockCache is nil.
+func (opt Options) WithBlockCache(c table.BlockCache) Options {
+	opt.BlockCache = c
+	return opt
+}
+
 // WithInMemory returns a new Options value with Inmemory mode set to the given value.
 //
 // When badger is running in InMemory mode, everything is stored in memory. No value/sst files are
@@ -762,6 +1602,67 @@ func (opt Options) WithDetectConflicts(b bool) Options {
 	return opt
 }
 
+// WithMaxAsyncWrites returns a new Options value with MaxAsyncWrites set to the given value.
+//
+// MaxAsyncWrites is the number of writes of DB.ApplyAsync in flight at most, which bounds the
+// memory held by the writes pipelined by their callers.
+//
+// The default value of MaxAsyncWrites is 1000.
+func (opt Options) WithMaxAsyncWrites(val int) Options {
+	opt.MaxAsyncWrites = val
+	return opt
+}
+
+// WithWriteRateLimiter returns a new Options value with WriteRateLimiter set to the given value.
+//
+// WriteRateLimiter budgets the bytes written by the transactions and batches: a write waits for
+// the budget before it's queued, so that a burst of writes is spread out instead of stalling the
+// DB. DB.Backpressure adds the wait of the limiter to its EstimatedDelay. See NewRateLimiter.
+//
+// The default value of WriteRateLimiter is nil, which doesn't limit writes.
+func (opt Options) WithWriteRateLimiter(val RateLimiter) Options {
+	opt.WriteRateLimiter = val
+	return opt
+}
+
+// WithCompactionRateLimiter returns a new Options value with CompactionRateLimiter set to the
+// given value.
+//
+// CompactionRateLimiter budgets the bytes of the tables written by compactions, so that they
+// leave disk bandwidth to reads and writes. It applies on top of the shared write rate of a
+// Manager. See NewRateLimiter.
+//
+// The default value of CompactionRateLimiter is nil, which doesn't limit compactions.
+func (opt Options) WithCompactionRateLimiter(val RateLimiter) Options {
+	opt.CompactionRateLimiter = val
+	return opt
+}
+
+// WithOpenProgress returns a new Options value with OpenProgress set to the given value.
+//
+// OpenProgress is called by Open as it goes through its stages: OpenStageManifest,
+// OpenStageMemtables, OpenStageTables, OpenStageValueLog and OpenStageReady, then OpenStageWarm
+// with StagedOpen, with how much of each stage is done out of its total. It's only called by one
+// goroutine at a time, and should return quickly.
+//
+// The default value of OpenProgress is nil.
+func (opt Options) WithOpenProgress(val func(stage string, done, total int)) Options {
+	opt.OpenProgress = val
+	return opt
+}
+
+// WithStagedOpen returns a new Options value with StagedOpen set to the given value.
+//
+// With StagedOpen, Open loads the blocks of the tables of level 0, which hold the most recent
+// keys, into the block cache before it returns, and those of the deeper levels in the background
+// while the DB serves reads. DB.Warmed tells when they are all loaded.
+//
+// The default value of StagedOpen is false.
+func (opt Options) WithStagedOpen(b bool) Options {
+	opt.StagedOpen = b
+	return opt
+}
+
 // WithNamespaceOffset returns a new Options value with NamespaceOffset set to the given value. DB
 // will expect the namespace in each key at the 8 bytes starting from NamespaceOffset. A negative
 // value means that namespace is not stored in the key.
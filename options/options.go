@@ -31,3 +31,38 @@ const (
 	// ZSTD mode indicates that a block is compressed using ZSTD algorithm.
 	ZSTD CompressionType = 2
 )
+
+// SyncPolicy specifies when writes to a file are synced to stable storage.
+type SyncPolicy int
+
+const (
+	// SyncDefault leaves the decision to the component's default behavior. For the value log
+	// and WAL, that is determined by Options.SyncWrites. Manifest updates and table creation
+	// are always synced.
+	SyncDefault SyncPolicy = iota
+	// SyncAlways syncs after every write. No acknowledged write is lost on power failure.
+	SyncAlways
+	// SyncInterval syncs periodically in the background, every Options.SyncInterval. Writes
+	// acknowledged within the last interval can be lost on power failure.
+	SyncInterval
+	// SyncNever leaves syncing to the operating system. Writes survive process crashes, but an
+	// unbounded amount of acknowledged writes can be lost on power failure.
+	SyncNever
+)
+
+// Durability is a single choice of when the writes to the value log and WAL are made durable,
+// trading durability for throughput. Each one sets the SyncPolicy of the value log and WAL.
+type Durability int
+
+const (
+	// DurabilityDefault leaves the decision to Options.ValueLogSyncPolicy and SyncWrites.
+	DurabilityDefault Durability = iota
+	// SyncEveryWrite syncs every batch of writes before acknowledging it, as SyncAlways. The
+	// writes committed within Options.GroupCommitWindow of each other share a sync.
+	SyncEveryWrite
+	// SyncEveryInterval syncs in the background every Options.SyncInterval, as SyncInterval.
+	SyncEveryInterval
+	// SyncOnClose only syncs when the DB is closed or DB.Sync is called, as SyncNever. Writes
+	// survive process crashes, but not power failures.
+	SyncOnClose
+)
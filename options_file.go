@@ -0,0 +1,356 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/luxfi/zapdb/options"
+)
+
+// OptionsEnvPrefix prefixes the environment variables overriding the options read by FromFile.
+const OptionsEnvPrefix = "BADGER_"
+
+// optionsEnums are the names of the values of the enum options in the config files.
+var optionsEnums = map[reflect.Type][]string{
+	reflect.TypeFor[options.CompressionType](): {"none", "snappy", "zstd"},
+	reflect.TypeFor[options.SyncPolicy]():      {"default", "always", "interval", "never"},
+	reflect.TypeFor[options.Durability]():      {"default", "every_write", "every_interval", "on_close"},
+	reflect.TypeFor[options.ChecksumVerificationMode](): {
+		"none", "table_read", "block_read", "table_and_block_read"},
+}
+
+// optionsField is an option which can be set from a config file.
+type optionsField struct {
+	name  string
+	value reflect.Value
+}
+
+// fileFields returns the fields of opt which can be set from a config file, in order: the
+// exported ones of scalar types, time.Duration and the enums of the options package.
+func (opt *Options) fileFields() []optionsField {
+	v := reflect.ValueOf(opt).Elem()
+	var fields []optionsField
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if !f.IsExported() || f.Type.PkgPath() != "" && f.Type != reflect.TypeFor[time.Duration]() &&
+			optionsEnums[f.Type] == nil {
+			continue
+		}
+		switch f.Type.Kind() {
+		case reflect.Bool, reflect.String, reflect.Float64,
+			reflect.Int, reflect.Int64, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			fields = append(fields, optionsField{name: strings.ToLower(f.Name), value: v.Field(i)})
+		}
+	}
+	return fields
+}
+
+// FromFile returns opt with the options set in the config file at path, overridden by the
+// environment variables named after them, and checked like by Open. The file is in TOML if its
+// extension is .toml, or in YAML if it's .yaml or .yml.
+//
+// The options are keyed by the names of the fields of Options, case insensitive like for
+// FromSuperFlag, e.g. numcompactors. The environment variables are the names in upper case,
+// prefixed by OptionsEnvPrefix, e.g. BADGER_NUMCOMPACTORS=2. The durations are strings like
+// "1m30s", and the enums of the options package are the names of their values in snake case,
+// e.g. compression = "zstd" or valuelogsyncpolicy = "interval". Only the options of those types
+// and of scalar types can be set; the others, like Logger or EncryptionKey, are kept from opt.
+//
+// The TOML files are flat: they can't have tables or arrays.
+func (opt Options) FromFile(path string) (Options, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return opt, err
+	}
+	var values map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".toml":
+		values, err = parseTOML(data)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	default:
+		return opt, fmt.Errorf("Unknown format of options file %s", path)
+	}
+	if err != nil {
+		return opt, fmt.Errorf("While parsing options file %s: %w", path, err)
+	}
+
+	fields := opt.fileFields()
+	byName := make(map[string]reflect.Value, len(fields))
+	for _, f := range fields {
+		byName[f.name] = f.value
+	}
+	for key, val := range values {
+		field, ok := byName[strings.ToLower(key)]
+		if !ok {
+			return opt, fmt.Errorf("Unknown option %q in options file %s", key, path)
+		}
+		if err := setOptionsField(field, val); err != nil {
+			return opt, fmt.Errorf("Invalid option %q in options file %s: %w", key, path, err)
+		}
+	}
+	for _, f := range fields {
+		env := OptionsEnvPrefix + strings.ToUpper(f.name)
+		if val, ok := os.LookupEnv(env); ok {
+			if err := setOptionsField(f.value, val); err != nil {
+				return opt, fmt.Errorf("Invalid option in environment variable %s: %w", env, err)
+			}
+		}
+	}
+	return opt, opt.check()
+}
+
+// check returns the error Open would return for the options, without side effects.
+func (opt Options) check() error {
+	needCache := opt.Compression != options.None || len(opt.EncryptionKey) > 0 ||
+		opt.KeyProvider != nil
+	for _, cfo := range opt.ColumnFamilies {
+		needCache = needCache || cfo.Compression != options.None
+	}
+	if needCache && opt.BlockCacheSize == 0 {
+		// Open panics instead.
+		return errors.New("BlockCacheSize should be set since compression/encryption are enabled")
+	}
+	// The master key isn't needed to check the other options.
+	opt.KeyProvider = nil
+	return checkAndSetOptions(&opt)
+}
+
+// setOptionsField sets field to val, as decoded from a config file, or a string.
+func setOptionsField(field reflect.Value, val any) error {
+	if names := optionsEnums[field.Type()]; names != nil {
+		s, ok := val.(string)
+		if !ok {
+			return fmt.Errorf("%v must be one of %s", val, strings.Join(names, ", "))
+		}
+		i := slices.Index(names, strings.ToLower(s))
+		if i < 0 {
+			return fmt.Errorf("%q must be one of %s", s, strings.Join(names, ", "))
+		}
+		if field.CanInt() {
+			field.SetInt(int64(i))
+		} else {
+			field.SetUint(uint64(i))
+		}
+		return nil
+	}
+	if field.Type() == reflect.TypeFor[time.Duration]() {
+		s, ok := val.(string)
+		if !ok {
+			return fmt.Errorf("duration %v must be a string like 1m30s", val)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch v := val.(type) {
+	case string:
+		return setOptionsFieldString(field, v)
+	case bool:
+		if field.Kind() == reflect.Bool {
+			field.SetBool(v)
+			return nil
+		}
+	case int:
+		return setOptionsFieldString(field, strconv.Itoa(v))
+	case int64:
+		return setOptionsFieldString(field, strconv.FormatInt(v, 10))
+	case uint64:
+		return setOptionsFieldString(field, strconv.FormatUint(v, 10))
+	case float64:
+		if field.Kind() == reflect.Float64 {
+			field.SetFloat(v)
+			return nil
+		}
+	}
+	return fmt.Errorf("%v is not a %s", val, field.Kind())
+}
+
+// setOptionsFieldString sets field to the value of its kind in s.
+func setOptionsFieldString(field reflect.Value, s string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(u)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("%q is not a %s", s, field.Kind())
+	}
+	return nil
+}
+
+// ToFile writes the options which FromFile can set to the config file at path, in TOML if its
+// extension is .toml, or in YAML if it's .yaml or .yml.
+func (opt Options) ToFile(path string) error {
+	var buf bytes.Buffer
+	fields := opt.fileFields()
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".toml":
+		for _, f := range fields {
+			fmt.Fprintf(&buf, "%s = %s\n", f.name, formatTOML(fileValue(f.value)))
+		}
+	case ".yaml", ".yml":
+		doc := &yaml.Node{Kind: yaml.MappingNode}
+		for _, f := range fields {
+			var val yaml.Node
+			if err := val.Encode(fileValue(f.value)); err != nil {
+				return err
+			}
+			doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: f.name}, &val)
+		}
+		data, err := yaml.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	default:
+		return fmt.Errorf("Unknown format of options file %s", path)
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// fileValue returns the value of field as written to a config file.
+func fileValue(field reflect.Value) any {
+	if names := optionsEnums[field.Type()]; names != nil {
+		var i int
+		if field.CanInt() {
+			i = int(field.Int())
+		} else {
+			i = int(field.Uint())
+		}
+		if i < len(names) {
+			return names[i]
+		}
+		return strconv.Itoa(i)
+	}
+	if d, ok := field.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	return field.Interface()
+}
+
+// formatTOML returns val, a value of fileValue, in TOML.
+func formatTOML(val any) string {
+	switch v := val.(type) {
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eE") {
+			s += ".0"
+		}
+		return s
+	}
+	return fmt.Sprint(val)
+}
+
+// parseTOML parses a flat TOML document: key = value lines of strings, booleans and numbers,
+// with comments.
+func parseTOML(data []byte) (map[string]any, error) {
+	values := make(map[string]any)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			return nil, fmt.Errorf("line %d: tables are not supported", n)
+		}
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"`)
+		val, err := parseTOMLValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %q", n, key)
+		}
+		values[key] = val
+	}
+	return values, sc.Err()
+}
+
+func parseTOMLValue(raw string) (any, error) {
+	if raw != "" && (raw[0] == '"' || raw[0] == '\'') {
+		// The value ends at the closing quote, which may be followed by a comment.
+		end := 1
+		for ; end < len(raw) && raw[end] != raw[0]; end++ {
+			if raw[0] == '"' && raw[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(raw) {
+			return nil, fmt.Errorf("unterminated string %s", raw)
+		}
+		if rest := strings.TrimSpace(raw[end+1:]); rest != "" && rest[0] != '#' {
+			return nil, fmt.Errorf("unexpected %q after string", rest)
+		}
+		if raw[0] == '\'' {
+			return raw[1:end], nil
+		}
+		return strconv.Unquote(raw[:end+1])
+	}
+	if i := strings.IndexByte(raw, '#'); i >= 0 {
+		raw = strings.TrimSpace(raw[:i])
+	}
+	switch raw {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	num := strings.ReplaceAll(raw, "_", "")
+	if i, err := strconv.ParseInt(num, 0, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(num, 64); err == nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("unsupported value %s", raw)
+}
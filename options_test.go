@@ -6,8 +6,13 @@
 package badger
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
 
 	"github.com/luxfi/zapdb/options"
 )
@@ -45,6 +50,58 @@ func TestOptions(t *testing.T) {
 			t.Fatal("generated superFlag != expected options")
 		}
 	})
+
+	t.Run("files", func(t *testing.T) {
+		o1 := DefaultOptions(t.TempDir())
+		o1.NumCompactors = 3
+		o1.Compression = options.ZSTD
+		o1.ValueLogSyncPolicy = options.SyncInterval
+		o1.TTLReaperInterval = 90 * time.Second
+		o1.BloomFalsePositive = 0.05
+		o1.CompactionBacklogScore = 3
+		for _, name := range []string{"badger.toml", "badger.yaml"} {
+			path := filepath.Join(t.TempDir(), name)
+			require.NoError(t, o1.ToFile(path))
+			o2, err := Options{}.FromFile(path)
+			require.NoError(t, err)
+			require.True(t, optionsEqual(o1, o2), name)
+			require.Equal(t, o1.TTLReaperInterval, o2.TTLReaperInterval)
+			require.Equal(t, o1.ValueLogSyncPolicy, o2.ValueLogSyncPolicy)
+		}
+	})
+
+	t.Run("file overrides", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "badger.toml")
+		require.NoError(t, os.WriteFile(path, []byte(`
+# Tuning of the compactions.
+NumCompactors = 3 # at least 2
+compression = "zstd"
+numlevelzerotables = 1_000
+durability = 'every_interval'
+`), 0o644))
+		t.Setenv("BADGER_NUMCOMPACTORS", "6")
+		t.Setenv("BADGER_SYNCINTERVAL", "250ms")
+		opt, err := DefaultOptions(t.TempDir()).FromFile(path)
+		require.NoError(t, err)
+		require.Equal(t, 6, opt.NumCompactors)
+		require.Equal(t, options.ZSTD, opt.Compression)
+		require.Equal(t, 1000, opt.NumLevelZeroTables)
+		require.Equal(t, options.SyncEveryInterval, opt.Durability)
+		require.Equal(t, 250*time.Millisecond, opt.SyncInterval)
+
+		// The options are checked like by Open.
+		t.Setenv("BADGER_NUMCOMPACTORS", "1")
+		_, err = DefaultOptions(t.TempDir()).FromFile(path)
+		require.ErrorContains(t, err, "Cannot have 1 compactor")
+		t.Setenv("BADGER_NUMCOMPACTORS", "many")
+		_, err = DefaultOptions(t.TempDir()).FromFile(path)
+		require.ErrorContains(t, err, "BADGER_NUMCOMPACTORS")
+
+		path = filepath.Join(t.TempDir(), "badger.yml")
+		require.NoError(t, os.WriteFile(path, []byte("numcompactor: 2\n"), 0o644))
+		_, err = DefaultOptions(t.TempDir()).FromFile(path)
+		require.ErrorContains(t, err, `Unknown option "numcompactor"`)
+	})
 }
 
 // optionsEqual just compares the values of two Options structs
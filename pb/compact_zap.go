@@ -0,0 +1,215 @@
+//go:build !grpc
+
+/*
+ * SPDX-FileCopyrightText: 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package pb
+
+import (
+	"encoding/binary"
+)
+
+// Format selects the encoding of KV and KVList.
+type Format byte
+
+const (
+	// FormatFixed uses fixed 4 and 8 byte fields. It is the default, and what Marshal returns.
+	FormatFixed Format = iota
+	// FormatCompact uses uvarints for lengths and integers, so small records take a few bytes
+	// of overhead instead of 37.
+	FormatCompact
+)
+
+func uvarintSize(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
+
+func bytesSize(b []byte) int {
+	return uvarintSize(uint64(len(b))) + len(b)
+}
+
+func appendBytes(buf, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// compactReader decodes compact fields, remembering the first error.
+type compactReader struct {
+	data []byte
+	err  error
+}
+
+func (r *compactReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = errBufferTooSmall
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *compactReader) bytes() []byte {
+	n := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.data)) {
+		r.err = errBufferTooSmall
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, r.data)
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *compactReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) == 0 {
+		r.err = errBufferTooSmall
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (k *KV) compactSize() int {
+	return bytesSize(k.Key) + bytesSize(k.Value) + bytesSize(k.UserMeta) +
+		uvarintSize(k.Version) + uvarintSize(k.ExpiresAt) + bytesSize(k.Meta) +
+		uvarintSize(uint64(k.StreamId)) + 1
+}
+
+func (k *KV) appendCompact(buf []byte) []byte {
+	buf = appendBytes(buf, k.Key)
+	buf = appendBytes(buf, k.Value)
+	buf = appendBytes(buf, k.UserMeta)
+	buf = binary.AppendUvarint(buf, k.Version)
+	buf = binary.AppendUvarint(buf, k.ExpiresAt)
+	buf = appendBytes(buf, k.Meta)
+	buf = binary.AppendUvarint(buf, uint64(k.StreamId))
+	if k.StreamDone {
+		return append(buf, 1)
+	}
+	return append(buf, 0)
+}
+
+func (k *KV) unmarshalCompact(data []byte) error {
+	r := compactReader{data: data}
+	k.Key = r.bytes()
+	k.Value = r.bytes()
+	k.UserMeta = r.bytes()
+	k.Version = r.uvarint()
+	k.ExpiresAt = r.uvarint()
+	k.Meta = r.bytes()
+	streamID := r.uvarint()
+	k.StreamDone = r.byte() == 1
+	if r.err != nil {
+		return r.err
+	}
+	if streamID > 1<<32-1 {
+		return errInvalidData
+	}
+	k.StreamId = uint32(streamID)
+	return nil
+}
+
+// SizeFormat returns the size of KV encoded in format f.
+func (k *KV) SizeFormat(f Format) int {
+	if f == FormatCompact {
+		return formatHeaderSize + k.compactSize()
+	}
+	return k.Size()
+}
+
+// MarshalFormat encodes KV in format f. Unmarshal decodes either format.
+func (k *KV) MarshalFormat(f Format) ([]byte, error) {
+	switch f {
+	case FormatFixed:
+		return k.Marshal()
+	case FormatCompact:
+		buf := make([]byte, 0, k.SizeFormat(f))
+		return k.appendCompact(appendFormatHeader(buf, f)), nil
+	}
+	return nil, errInvalidData
+}
+
+func (l *KVList) compactSize() int {
+	size := uvarintSize(uint64(len(l.Kv))) + uvarintSize(l.AllocRef)
+	for _, kv := range l.Kv {
+		n := kv.compactSize()
+		size += uvarintSize(uint64(n)) + n
+	}
+	return size
+}
+
+func (l *KVList) unmarshalCompact(data []byte, o UnmarshalOptions) error {
+	r := compactReader{data: data}
+	count := r.uvarint()
+	if err := o.checkListLen(count); r.err == nil && err != nil {
+		return err
+	}
+	// Every KV takes at least 9 bytes, which bounds the allocation for corrupt counts.
+	if r.err == nil && count > uint64(len(r.data)/9) {
+		return errBufferTooSmall
+	}
+	l.Kv = make([]*KV, 0, count)
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		n := r.uvarint()
+		if r.err != nil {
+			break
+		}
+		if n > uint64(len(r.data)) {
+			return errBufferTooSmall
+		}
+		if err := o.checkKVSize(int(n)); err != nil {
+			return err
+		}
+		kv := &KV{}
+		if err := kv.unmarshalCompact(r.data[:n]); err != nil {
+			return err
+		}
+		l.Kv = append(l.Kv, kv)
+		r.data = r.data[n:]
+	}
+	l.AllocRef = r.uvarint()
+	return r.err
+}
+
+// SizeFormat returns the size of KVList encoded in format f.
+func (l *KVList) SizeFormat(f Format) int {
+	if f == FormatCompact {
+		return formatHeaderSize + l.compactSize()
+	}
+	return l.Size()
+}
+
+// MarshalFormat encodes KVList in format f. Unmarshal decodes either format.
+func (l *KVList) MarshalFormat(f Format) ([]byte, error) {
+	switch f {
+	case FormatFixed:
+		return l.Marshal()
+	case FormatCompact:
+		buf := appendFormatHeader(make([]byte, 0, l.SizeFormat(f)), f)
+		buf = binary.AppendUvarint(buf, uint64(len(l.Kv)))
+		for _, kv := range l.Kv {
+			buf = binary.AppendUvarint(buf, uint64(kv.compactSize()))
+			buf = kv.appendCompact(buf)
+		}
+		return binary.AppendUvarint(buf, l.AllocRef), nil
+	}
+	return nil, errInvalidData
+}
@@ -0,0 +1,54 @@
+//go:build grpc
+
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package pb
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+var update = flag.Bool("update", false, "Rewrite the protobuf encodings in testdata.")
+
+func TestConformanceProto(t *testing.T) {
+	for _, c := range conformanceCases {
+		t.Run(c.name, func(t *testing.T) {
+			msg := c.msg.(proto.Message)
+			data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+			require.NoError(t, err)
+			if *update {
+				require.NoError(t, os.WriteFile(conformancePath(c.name), data, 0644))
+			}
+			want, err := os.ReadFile(conformancePath(c.name))
+			require.NoError(t, err)
+			require.Equal(t, want, data)
+
+			got := newLike(c.msg).(proto.Message)
+			require.NoError(t, proto.Unmarshal(want, got))
+			require.True(t, proto.Equal(msg, got))
+		})
+	}
+}
+
+// TestSchema checks that Schema is the definition the types of the grpc build were generated from.
+func TestSchema(t *testing.T) {
+	file := (&KV{}).ProtoReflect().Descriptor().ParentFile()
+	msgs := file.Messages()
+	for i := range msgs.Len() {
+		require.Contains(t, Schema, "message "+string(msgs.Get(i).Name())+" {")
+		fields := msgs.Get(i).Fields()
+		for j := range fields.Len() {
+			f := fields.Get(j)
+			require.Regexp(t, fmt.Sprintf(`\b%s\s*=\s*%d;`, f.Name(), f.Number()), Schema)
+		}
+	}
+}
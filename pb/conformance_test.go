@@ -0,0 +1,64 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package pb
+
+import (
+	"path/filepath"
+	"reflect"
+)
+
+// conformanceCases are the messages whose protobuf encodings, as written by the grpc build, are in
+// testdata. The grpc build checks that it encodes them the same, and the native build that
+// UnmarshalLegacyProto decodes them back. The fields are the same in both builds.
+var conformanceCases = []struct {
+	name string
+	msg  any
+}{
+	{"kv", &KV{
+		Key:        []byte("key"),
+		Value:      []byte("value"),
+		UserMeta:   []byte{0x01},
+		Version:    1 << 40,
+		ExpiresAt:  1700000000,
+		Meta:       []byte{0x40},
+		StreamId:   7,
+		StreamDone: true,
+	}},
+	{"kvlist", &KVList{
+		Kv: []*KV{
+			{Key: []byte("a"), Value: []byte("1"), Version: 1},
+			{Key: []byte("b"), Meta: []byte{0x01}, Version: 2},
+		},
+		AllocRef: 42,
+	}},
+	{"manifest_change_set", &ManifestChangeSet{
+		Changes: []*ManifestChange{
+			{Id: 12, Op: ManifestChange_CREATE, Level: 3, KeyId: 5,
+				EncryptionAlgo: EncryptionAlgo_aes_gcm, Compression: 2},
+			{Id: 11, Op: ManifestChange_DELETE},
+			{Id: 1, Op: ManifestChange_DICTIONARY, Level: 0b110, Dictionary: []byte("dict")},
+			{Op: ManifestChange_LIFECYCLE, Lifecycle: []byte(`{"Prefix":"cGZ4"}`)},
+		},
+	}},
+	{"data_key", &DataKey{
+		KeyId:          9,
+		Data:           []byte("data"),
+		Iv:             []byte("iv"),
+		CreatedAt:      1700000000,
+		EncryptionAlgo: EncryptionAlgo_chacha20poly1305,
+	}},
+	{"checksum", &Checksum{Algo: Checksum_XXHash64, Sum: 0xdeadbeef}},
+	{"match", &Match{Prefix: []byte("prefix"), IgnoreBytes: "1, 2-3"}},
+}
+
+func conformancePath(name string) string {
+	return filepath.Join("testdata", name+".binpb")
+}
+
+// newLike returns a new zero message of the type of msg.
+func newLike(msg any) any {
+	return reflect.New(reflect.TypeOf(msg).Elem()).Interface()
+}
@@ -0,0 +1,45 @@
+//go:build !grpc
+
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package pb
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestConformanceLegacyProto checks that the protobuf encodings of the grpc build decode to the
+// same messages in the native build.
+func TestConformanceLegacyProto(t *testing.T) {
+	for _, c := range conformanceCases {
+		t.Run(c.name, func(t *testing.T) {
+			data, err := os.ReadFile(conformancePath(c.name))
+			require.NoError(t, err)
+			got := newLike(c.msg).(Message)
+			require.NoError(t, UnmarshalLegacyProto(data, got))
+			require.Equal(t, c.msg, got)
+
+			// The native encoding is its own, but round-trips the same message.
+			native, err := Marshal(got.(Marshaler))
+			require.NoError(t, err)
+			again := newLike(c.msg).(Unmarshaler)
+			require.NoError(t, Unmarshal(native, again))
+			reencoded, err := Marshal(again.(Marshaler))
+			require.NoError(t, err)
+			require.Equal(t, native, reencoded)
+		})
+	}
+}
+
+func TestSchema(t *testing.T) {
+	for _, name := range []string{"KV", "KVList", "ManifestChangeSet", "ManifestChange",
+		"Checksum", "DataKey", "Match"} {
+		require.Contains(t, Schema, "message "+name+" {")
+	}
+}
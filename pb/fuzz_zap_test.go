@@ -0,0 +1,160 @@
+//go:build !grpc
+
+/*
+ * SPDX-FileCopyrightText: 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package pb
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// fuzzLimits keeps the fuzzers from spending their time on huge allocations.
+var fuzzLimits = UnmarshalOptions{MaxKVSize: 1 << 20, MaxListLen: 1 << 12}
+
+// fuzzMessage fuzzes the decoding of the type returned by empty. Anything that decodes must
+// encode again, and decode to the same encoding.
+func fuzzMessage(f *testing.F, empty func() Message, seeds ...Message) {
+	for _, m := range seeds {
+		data, err := m.Marshal()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+		// The header-less encoding of version 0.
+		_, legacy, _ := payloadVersion(data)
+		if _, ok := m.(*Checksum); ok {
+			_, legacy, _ = checksumPayloadVersion(data)
+		}
+		f.Add(legacy)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		m := empty()
+		if err := fuzzLimits.Unmarshal(data, m); err != nil {
+			return
+		}
+		enc, err := m.Marshal()
+		if err != nil {
+			t.Fatalf("Marshal of a decoded %T failed: %v", m, err)
+		}
+		again := empty()
+		if err := again.Unmarshal(enc); err != nil {
+			t.Fatalf("Unmarshal of a re-encoded %T failed: %v", m, err)
+		}
+		enc2, err := again.Marshal()
+		if err != nil || !bytes.Equal(enc, enc2) {
+			t.Fatalf("%T doesn't round trip: %x != %x", m, enc, enc2)
+		}
+	})
+}
+
+var fuzzKV = &KV{Key: []byte("key"), Value: []byte("value"), UserMeta: []byte{1},
+	Version: 7, ExpiresAt: 9, Meta: []byte{2}, StreamId: 3, StreamDone: true}
+
+func FuzzKV(f *testing.F) {
+	compact, err := fuzzKV.MarshalFormat(FormatCompact)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(compact)
+	fuzzMessage(f, func() Message { return &KV{} }, fuzzKV, &KV{})
+}
+
+func FuzzKVList(f *testing.F) {
+	list := &KVList{Kv: []*KV{fuzzKV, {Key: []byte("k")}}, AllocRef: 5}
+	compact, err := list.MarshalFormat(FormatCompact)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(compact)
+	fuzzMessage(f, func() Message { return &KVList{} }, list, &KVList{})
+}
+
+func FuzzManifestChange(f *testing.F) {
+	fuzzMessage(f, func() Message { return &ManifestChange{} },
+		&ManifestChange{Id: 1, Op: ManifestChange_DELETE, Level: 2, KeyId: 3, Compression: 1})
+}
+
+func FuzzManifestChangeSet(f *testing.F) {
+	fuzzMessage(f, func() Message { return &ManifestChangeSet{} },
+		&ManifestChangeSet{Changes: []*ManifestChange{{Id: 1, Level: 2}, {Id: 3},
+			{Id: 4, Op: ManifestChange_DICTIONARY, Level: 1, Dictionary: []byte("dict")},
+			{Op: ManifestChange_LIFECYCLE, Lifecycle: []byte("{}")}}})
+}
+
+func FuzzDataKey(f *testing.F) {
+	fuzzMessage(f, func() Message { return &DataKey{} },
+		&DataKey{KeyId: 1, Data: []byte("data"), Iv: []byte("iv"), CreatedAt: -1},
+		&DataKey{KeyId: 2, EncryptionAlgo: EncryptionAlgo_chacha20poly1305})
+}
+
+func FuzzChecksum(f *testing.F) {
+	fuzzMessage(f, func() Message { return &Checksum{} },
+		&Checksum{Algo: Checksum_XXHash64, Sum: 42})
+}
+
+func FuzzMatch(f *testing.F) {
+	fuzzMessage(f, func() Message { return &Match{} },
+		&Match{Prefix: []byte("p"), IgnoreBytes: "1-3"})
+}
+
+func FuzzUnmarshalLegacyProto(f *testing.F) {
+	f.Add([]byte{0x0a, 0x05, 0x0a, 0x03, 'k', 'e', 'y', 0x50, 0x01})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, m := range []Message{&KV{}, &KVList{}, &ManifestChangeSet{}, &DataKey{},
+			&Checksum{}, &Match{}} {
+			if err := UnmarshalLegacyProto(data, m); err != nil {
+				continue
+			}
+			if _, err := m.Marshal(); err != nil {
+				t.Fatalf("Marshal of a decoded %T failed: %v", m, err)
+			}
+		}
+	})
+}
+
+func TestUnmarshalOptions(t *testing.T) {
+	list := &KVList{Kv: []*KV{fuzzKV, fuzzKV, fuzzKV}}
+	for _, f := range []Format{FormatFixed, FormatCompact} {
+		data, err := list.MarshalFormat(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		within := UnmarshalOptions{MaxKVSize: 64, MaxListLen: 3}
+		if err := within.Unmarshal(data, &KVList{}); err != nil {
+			t.Errorf("format %d: within the limits: %v", f, err)
+		}
+		for _, o := range []UnmarshalOptions{{MaxListLen: 2}, {MaxKVSize: 16}} {
+			if err := o.Unmarshal(data, &KVList{}); !errors.Is(err, errInvalidData) {
+				t.Errorf("format %d: %+v: got %v", f, o, err)
+			}
+		}
+	}
+
+	// A corrupt count fails without allocating for it.
+	data, err := list.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[formatHeaderSize+3] = 0x7f
+	allocs := testing.AllocsPerRun(1, func() {
+		if err := (&KVList{}).Unmarshal(data); err == nil {
+			t.Error("expected an error for a corrupt count")
+		}
+	})
+	if allocs > 1 {
+		t.Errorf("got %v allocations", allocs)
+	}
+	set, err := (&ManifestChangeSet{Changes: []*ManifestChange{{Id: 1}}}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set[versionHeaderSize+3] = 0x7f
+	if err := (&ManifestChangeSet{}).Unmarshal(set); err == nil {
+		t.Error("expected an error for a corrupt count")
+	}
+}
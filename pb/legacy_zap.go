@@ -0,0 +1,316 @@
+//go:build !grpc
+
+/*
+ * SPDX-FileCopyrightText: 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package pb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errLegacyProto = errors.New("invalid protobuf encoding")
+
+// protoReader decodes the protobuf wire format, as written by upstream Badger and by the grpc
+// build of this package.
+type protoReader struct {
+	data []byte
+}
+
+func (r *protoReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		return 0, errLegacyProto
+	}
+	r.data = r.data[n:]
+	return v, nil
+}
+
+// next returns the field number and wire type of the next field.
+func (r *protoReader) next() (int, int, error) {
+	tag, err := r.varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	field, wire := int(tag>>3), int(tag&7)
+	if field <= 0 || field > 1<<29-1 {
+		return 0, 0, errLegacyProto
+	}
+	return field, wire, nil
+}
+
+func (r *protoReader) bytes() ([]byte, error) {
+	n, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.data)) {
+		return nil, errLegacyProto
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b, nil
+}
+
+func (r *protoReader) copyBytes() ([]byte, error) {
+	b, err := r.bytes()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{}, b...), nil
+}
+
+// skip skips a field of an unknown number.
+func (r *protoReader) skip(wire int) error {
+	var n int
+	switch wire {
+	case wireVarint:
+		_, err := r.varint()
+		return err
+	case wireBytes:
+		_, err := r.bytes()
+		return err
+	case wireFixed64:
+		n = 8
+	case wireFixed32:
+		n = 4
+	default:
+		return fmt.Errorf("%w: wire type %d", errLegacyProto, wire)
+	}
+	if len(r.data) < n {
+		return errLegacyProto
+	}
+	r.data = r.data[n:]
+	return nil
+}
+
+// decodeProto calls field for every field of data. field returns false for fields it doesn't know,
+// which are skipped.
+func decodeProto(data []byte, field func(r *protoReader, num, wire int) (bool, error)) error {
+	r := &protoReader{data: data}
+	for len(r.data) > 0 {
+		num, wire, err := r.next()
+		if err != nil {
+			return err
+		}
+		ok, err := field(r, num, wire)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if err := r.skip(wire); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expect returns an error unless wire is the wire type of field num.
+func expect(num, wire, want int) error {
+	if wire != want {
+		return fmt.Errorf("%w: field %d has wire type %d", errLegacyProto, num, wire)
+	}
+	return nil
+}
+
+// UnmarshalLegacyProto decodes m from the protobuf encoding written by upstream Badger and the
+// grpc build, without depending on protobuf. m is one of the types of this package. Unknown
+// fields are skipped, as protobuf does.
+func UnmarshalLegacyProto(data []byte, m Message) error {
+	switch m := m.(type) {
+	case *KV:
+		*m = KV{}
+		return decodeProto(data, m.protoField)
+	case *KVList:
+		*m = KVList{}
+		return decodeProto(data, func(r *protoReader, num, wire int) (bool, error) {
+			switch num {
+			case 1:
+				if err := expect(num, wire, wireBytes); err != nil {
+					return false, err
+				}
+				b, err := r.bytes()
+				if err != nil {
+					return false, err
+				}
+				kv := &KV{}
+				if err := decodeProto(b, kv.protoField); err != nil {
+					return false, err
+				}
+				m.Kv = append(m.Kv, kv)
+			case 10:
+				return true, varintField(r, num, wire, &m.AllocRef)
+			default:
+				return false, nil
+			}
+			return true, nil
+		})
+	case *ManifestChange:
+		*m = ManifestChange{}
+		return decodeProto(data, m.protoField)
+	case *ManifestChangeSet:
+		*m = ManifestChangeSet{}
+		return decodeProto(data, func(r *protoReader, num, wire int) (bool, error) {
+			if num != 1 {
+				return false, nil
+			}
+			if err := expect(num, wire, wireBytes); err != nil {
+				return false, err
+			}
+			b, err := r.bytes()
+			if err != nil {
+				return false, err
+			}
+			change := &ManifestChange{}
+			if err := decodeProto(b, change.protoField); err != nil {
+				return false, err
+			}
+			m.Changes = append(m.Changes, change)
+			return true, nil
+		})
+	case *DataKey:
+		*m = DataKey{}
+		return decodeProto(data, func(r *protoReader, num, wire int) (bool, error) {
+			var err error
+			switch num {
+			case 1:
+				err = varintField(r, num, wire, &m.KeyId)
+			case 2:
+				m.Data, err = bytesField(r, num, wire)
+			case 3:
+				m.Iv, err = bytesField(r, num, wire)
+			case 4:
+				var v uint64
+				err = varintField(r, num, wire, &v)
+				m.CreatedAt = int64(v)
+			case 5:
+				var v uint64
+				err = varintField(r, num, wire, &v)
+				m.EncryptionAlgo = EncryptionAlgo(v)
+			default:
+				return false, nil
+			}
+			return true, err
+		})
+	case *Checksum:
+		*m = Checksum{}
+		return decodeProto(data, func(r *protoReader, num, wire int) (bool, error) {
+			var v uint64
+			var err error
+			switch num {
+			case 1:
+				err = varintField(r, num, wire, &v)
+				m.Algo = Checksum_Algorithm(v)
+			case 2:
+				err = varintField(r, num, wire, &m.Sum)
+			default:
+				return false, nil
+			}
+			return true, err
+		})
+	case *Match:
+		*m = Match{}
+		return decodeProto(data, func(r *protoReader, num, wire int) (bool, error) {
+			var b []byte
+			var err error
+			switch num {
+			case 1:
+				m.Prefix, err = bytesField(r, num, wire)
+			case 2:
+				b, err = bytesField(r, num, wire)
+				m.IgnoreBytes = string(b)
+			default:
+				return false, nil
+			}
+			return true, err
+		})
+	}
+	return fmt.Errorf("UnmarshalLegacyProto: unsupported type %T", m)
+}
+
+func varintField(r *protoReader, num, wire int, v *uint64) error {
+	if err := expect(num, wire, wireVarint); err != nil {
+		return err
+	}
+	var err error
+	*v, err = r.varint()
+	return err
+}
+
+func bytesField(r *protoReader, num, wire int) ([]byte, error) {
+	if err := expect(num, wire, wireBytes); err != nil {
+		return nil, err
+	}
+	return r.copyBytes()
+}
+
+func (k *KV) protoField(r *protoReader, num, wire int) (bool, error) {
+	var v uint64
+	var err error
+	switch num {
+	case 1:
+		k.Key, err = bytesField(r, num, wire)
+	case 2:
+		k.Value, err = bytesField(r, num, wire)
+	case 3:
+		k.UserMeta, err = bytesField(r, num, wire)
+	case 4:
+		err = varintField(r, num, wire, &k.Version)
+	case 5:
+		err = varintField(r, num, wire, &k.ExpiresAt)
+	case 6:
+		k.Meta, err = bytesField(r, num, wire)
+	case 10:
+		err = varintField(r, num, wire, &v)
+		k.StreamId = uint32(v)
+	case 11:
+		err = varintField(r, num, wire, &v)
+		k.StreamDone = v != 0
+	default:
+		return false, nil
+	}
+	return true, err
+}
+
+func (m *ManifestChange) protoField(r *protoReader, num, wire int) (bool, error) {
+	var v uint64
+	var err error
+	switch num {
+	case 1:
+		err = varintField(r, num, wire, &m.Id)
+	case 2:
+		err = varintField(r, num, wire, &v)
+		m.Op = ManifestChange_Operation(v)
+	case 3:
+		err = varintField(r, num, wire, &v)
+		m.Level = uint32(v)
+	case 4:
+		err = varintField(r, num, wire, &m.KeyId)
+	case 5:
+		err = varintField(r, num, wire, &v)
+		m.EncryptionAlgo = EncryptionAlgo(v)
+	case 6:
+		err = varintField(r, num, wire, &v)
+		m.Compression = uint32(v)
+	case 7:
+		m.Dictionary, err = bytesField(r, num, wire)
+	case 8:
+		m.Lifecycle, err = bytesField(r, num, wire)
+	default:
+		return false, nil
+	}
+	return true, err
+}
@@ -7,6 +7,8 @@
 
 package pb
 
+import "fmt"
+
 // Marshaler is the interface for types that can marshal themselves.
 type Marshaler interface {
 	Marshal() ([]byte, error)
@@ -38,11 +40,73 @@ func Size(m Sizer) int {
 }
 
 // MarshalOptions provides options for marshaling (compatibility with protobuf API).
-type MarshalOptions struct{}
+type MarshalOptions struct {
+	// Format is used by types supporting more than one encoding, KV and KVList.
+	Format Format
+}
+
+// UnmarshalOptions bounds the memory Unmarshal takes for untrusted data. Encodings exceeding
+// a bound fail with an invalid data error.
+type UnmarshalOptions struct {
+	// MaxKVSize bounds the size of the encoding of a KV, alone or in a KVList. Zero means no
+	// bound.
+	MaxKVSize int
+	// MaxListLen bounds the number of KVs of a KVList, and of changes of a ManifestChangeSet.
+	// Zero means no bound.
+	MaxListLen int
+}
+
+type optionsUnmarshaler interface {
+	unmarshalOptions(data []byte, o UnmarshalOptions) error
+}
+
+// Unmarshal decodes data into m within the bounds of o.
+func (o UnmarshalOptions) Unmarshal(data []byte, m Unmarshaler) error {
+	if om, ok := m.(optionsUnmarshaler); ok {
+		return om.unmarshalOptions(data, o)
+	}
+	return m.Unmarshal(data)
+}
+
+func (o UnmarshalOptions) checkKVSize(n int) error {
+	if o.MaxKVSize > 0 && n > o.MaxKVSize {
+		return fmt.Errorf("%w: KV of %d bytes exceeds the limit of %d", errInvalidData, n,
+			o.MaxKVSize)
+	}
+	return nil
+}
+
+func (o UnmarshalOptions) checkListLen(n uint64) error {
+	if o.MaxListLen > 0 && n > uint64(o.MaxListLen) {
+		return fmt.Errorf("%w: list of %d entries exceeds the limit of %d", errInvalidData, n,
+			o.MaxListLen)
+	}
+	return nil
+}
+
+type formatMarshaler interface {
+	MarshalFormat(Format) ([]byte, error)
+}
 
 // MarshalAppend appends the marshaled form to the provided buffer.
-func (MarshalOptions) MarshalAppend(b []byte, m Marshaler) ([]byte, error) {
-	data, err := m.Marshal()
+func (o MarshalOptions) MarshalAppend(b []byte, m Marshaler) ([]byte, error) {
+	if sm, ok := m.(sizedMarshaler); ok && o.Format == FormatFixed {
+		// Encode in place rather than through a temporary buffer.
+		start := len(b)
+		b = append(b, make([]byte, sm.Size())...)
+		n, err := sm.MarshalToSizedBuffer(b[start:])
+		if err != nil {
+			return nil, err
+		}
+		return b[:start+n], nil
+	}
+	var data []byte
+	var err error
+	if fm, ok := m.(formatMarshaler); ok && o.Format != FormatFixed {
+		data, err = fm.MarshalFormat(o.Format)
+	} else {
+		data, err = m.Marshal()
+	}
 	if err != nil {
 		return nil, err
 	}
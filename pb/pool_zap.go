@@ -0,0 +1,70 @@
+//go:build !grpc
+
+/*
+ * SPDX-FileCopyrightText: 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package pb
+
+import "sync"
+
+// maxPooledBuffer is the largest buffer ReleaseBuffer keeps, so that one huge message doesn't
+// pin its buffer for the life of the process.
+const maxPooledBuffer = 4 << 20
+
+var bufferPool = sync.Pool{
+	New: func() any { return new([]byte) },
+}
+
+// sizedMarshaler is implemented by the types that can encode into a buffer they don't own.
+type sizedMarshaler interface {
+	Sizer
+	MarshalToSizedBuffer([]byte) (int, error)
+}
+
+// GetBuffer returns a scratch buffer of length size from the pool. Hand it back with
+// ReleaseBuffer once done with it.
+func GetBuffer(size int) []byte {
+	bp := bufferPool.Get().(*[]byte)
+	buf := *bp
+	if cap(buf) < size {
+		buf = make([]byte, size)
+	}
+	*bp = nil
+	bufferPool.Put(bp)
+	return buf[:size]
+}
+
+// ReleaseBuffer hands buf back to the pool. It must not be used afterwards.
+func ReleaseBuffer(buf []byte) {
+	if cap(buf) == 0 || cap(buf) > maxPooledBuffer {
+		return
+	}
+	bp := bufferPool.Get().(*[]byte)
+	*bp = buf[:0]
+	bufferPool.Put(bp)
+}
+
+// MarshalTo encodes m into dst, and returns the encoded bytes. If dst is too small, the bytes
+// are encoded into a buffer from GetBuffer instead. Either way the result can be handed back
+// with ReleaseBuffer, once the caller is done with it.
+func MarshalTo(dst []byte, m Marshaler) ([]byte, error) {
+	sm, ok := m.(sizedMarshaler)
+	if !ok {
+		data, err := m.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		return append(dst[:0], data...), nil
+	}
+	size := sm.Size()
+	if cap(dst) < size {
+		dst = GetBuffer(size)
+	}
+	n, err := sm.MarshalToSizedBuffer(dst[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dst[:n], nil
+}
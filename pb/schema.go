@@ -0,0 +1,19 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package pb
+
+import _ "embed"
+
+//go:generate ./gen.sh
+
+// Schema is the protobuf definition of the messages of this package, badgerpb4.proto, from which
+// the types of the grpc build are generated. Other languages can decode the protobuf encodings
+// written by the grpc build and by upstream Badger with it, and the native build decodes them
+// with UnmarshalLegacyProto. The native encodings written by Marshal without the grpc build tag
+// aren't protobuf.
+//
+//go:embed badgerpb4.proto
+var Schema string
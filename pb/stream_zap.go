@@ -0,0 +1,199 @@
+//go:build !grpc
+
+/*
+ * SPDX-FileCopyrightText: 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package pb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// A KV stream starts with streamMagic, followed by one frame per KV:
+//
+//	[kvLen:4][crc32c:4][kv]
+//
+// and ends with a frame of length zero, which no KV has. A stream cut short is reported as
+// io.ErrUnexpectedEOF rather than a clean end.
+var streamMagic = []byte("zkv\x01")
+
+const frameHeaderSize = 8
+
+// DefaultMaxStreamKVSize bounds the size of a KV read from a stream, and so the memory taken
+// by a corrupt length.
+const DefaultMaxStreamKVSize = 1 << 30
+
+var (
+	// ErrStreamChecksum is returned for a frame whose checksum doesn't match.
+	ErrStreamChecksum = errors.New("kv stream checksum mismatch")
+	// ErrStreamHeader is returned for a stream that doesn't start with the KV stream header.
+	ErrStreamHeader = errors.New("not a kv stream")
+
+	errStreamClosed = errors.New("kv stream writer closed")
+
+	castagnoli = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// KVStreamWriter writes KVs to an io.Writer one frame at a time, so a list of any length can be
+// written with the memory of its largest KV.
+type KVStreamWriter struct {
+	w       *bufio.Writer
+	buf     []byte
+	started bool
+	err     error
+}
+
+// NewKVStreamWriter returns a KVStreamWriter writing to w. Close must be called to end the
+// stream.
+func NewKVStreamWriter(w io.Writer) *KVStreamWriter {
+	return &KVStreamWriter{w: bufio.NewWriter(w)}
+}
+
+func (s *KVStreamWriter) start() {
+	if !s.started {
+		s.started = true
+		_, s.err = s.w.Write(streamMagic)
+	}
+}
+
+// Write appends kv to the stream.
+func (s *KVStreamWriter) Write(kv *KV) error {
+	if s.start(); s.err != nil {
+		return s.err
+	}
+	size := kv.Size()
+	if cap(s.buf) < frameHeaderSize+size {
+		ReleaseBuffer(s.buf)
+		s.buf = GetBuffer(frameHeaderSize + size)
+	}
+	buf := s.buf[:frameHeaderSize+size]
+	if _, err := kv.MarshalToSizedBuffer(buf[frameHeaderSize:]); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(buf, uint32(size))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.Checksum(buf[frameHeaderSize:], castagnoli))
+	_, s.err = s.w.Write(buf)
+	return s.err
+}
+
+// WriteList appends every KV of list to the stream.
+func (s *KVStreamWriter) WriteList(list *KVList) error {
+	for _, kv := range list.Kv {
+		if err := s.Write(kv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes buffered frames to the underlying writer.
+func (s *KVStreamWriter) Flush() error {
+	if s.start(); s.err != nil {
+		return s.err
+	}
+	s.err = s.w.Flush()
+	return s.err
+}
+
+// Close ends the stream and flushes it. It doesn't close the underlying writer.
+func (s *KVStreamWriter) Close() error {
+	if s.start(); s.err != nil {
+		return s.err
+	}
+	var end [frameHeaderSize]byte
+	if _, s.err = s.w.Write(end[:]); s.err != nil {
+		return s.err
+	}
+	s.err = s.w.Flush()
+	ReleaseBuffer(s.buf)
+	s.buf = nil
+	if s.err != nil {
+		return s.err
+	}
+	s.err = errStreamClosed
+	return nil
+}
+
+// KVStreamReader reads the KVs written by a KVStreamWriter.
+type KVStreamReader struct {
+	r       *bufio.Reader
+	buf     []byte
+	started bool
+	err     error
+
+	// MaxKVSize bounds the size of the KVs read. It defaults to DefaultMaxStreamKVSize.
+	MaxKVSize int
+}
+
+// NewKVStreamReader returns a KVStreamReader reading from r.
+func NewKVStreamReader(r io.Reader) *KVStreamReader {
+	return &KVStreamReader{r: bufio.NewReader(r), MaxKVSize: DefaultMaxStreamKVSize}
+}
+
+// Read returns the next KV of the stream, or io.EOF once the stream ended.
+func (s *KVStreamReader) Read() (*KV, error) {
+	kv := &KV{}
+	if err := s.ReadInto(kv); err != nil {
+		return nil, err
+	}
+	return kv, nil
+}
+
+// ReadInto decodes the next KV of the stream into kv, or returns io.EOF once the stream ended.
+func (s *KVStreamReader) ReadInto(kv *KV) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.err = s.next(kv)
+	return s.err
+}
+
+func (s *KVStreamReader) next(kv *KV) error {
+	if !s.started {
+		s.started = true
+		magic := make([]byte, len(streamMagic))
+		if _, err := io.ReadFull(s.r, magic); err != nil {
+			return ErrStreamHeader
+		}
+		if string(magic) != string(streamMagic) {
+			return ErrStreamHeader
+		}
+	}
+	var hdr [frameHeaderSize]byte
+	if _, err := io.ReadFull(s.r, hdr[:]); err != nil {
+		return unexpected(err)
+	}
+	size := int(binary.LittleEndian.Uint32(hdr[:]))
+	if size == 0 {
+		return io.EOF
+	}
+	if size > s.MaxKVSize {
+		return fmt.Errorf("kv stream frame of %d bytes exceeds the limit of %d", size, s.MaxKVSize)
+	}
+	if cap(s.buf) < size {
+		s.buf = make([]byte, size)
+	}
+	buf := s.buf[:size]
+	if _, err := io.ReadFull(s.r, buf); err != nil {
+		return unexpected(err)
+	}
+	if crc32.Checksum(buf, castagnoli) != binary.LittleEndian.Uint32(hdr[4:]) {
+		return ErrStreamChecksum
+	}
+	// Unmarshal copies the fields, so buf can be reused.
+	return kv.Unmarshal(buf)
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -20,15 +20,20 @@ import (
 type EncryptionAlgo int32
 
 const (
-	EncryptionAlgo_aes EncryptionAlgo = 0
+	EncryptionAlgo_aes              EncryptionAlgo = 0
+	EncryptionAlgo_chacha20poly1305 EncryptionAlgo = 1
+	EncryptionAlgo_aes_gcm          EncryptionAlgo = 2
 )
 
 // ManifestChange_Operation defines manifest change operations.
 type ManifestChange_Operation int32
 
 const (
-	ManifestChange_CREATE ManifestChange_Operation = 0
-	ManifestChange_DELETE ManifestChange_Operation = 1
+	ManifestChange_CREATE     ManifestChange_Operation = 0
+	ManifestChange_DELETE     ManifestChange_Operation = 1
+	ManifestChange_DICTIONARY ManifestChange_Operation = 2
+	ManifestChange_LIFECYCLE  ManifestChange_Operation = 3
+	ManifestChange_MOVE       ManifestChange_Operation = 4
 )
 
 // Checksum_Algorithm defines checksum algorithm type.
@@ -68,9 +73,14 @@ func (k *KV) Reset()               { *k = KV{} }
 func (k *KV) String() string       { return "KV{...}" }
 
 // Size returns the encoded size of KV.
+func (k *KV) Size() int {
+	return formatHeaderSize + k.fixedSize()
+}
+
+// fixedSize returns the size of KV in FormatFixed, without header.
 // Format: [keyLen:4][key][valueLen:4][value][userMetaLen:4][userMeta]
 //         [version:8][expiresAt:8][metaLen:4][meta][streamId:4][streamDone:1]
-func (k *KV) Size() int {
+func (k *KV) fixedSize() int {
 	return 4 + len(k.Key) +
 		4 + len(k.Value) +
 		4 + len(k.UserMeta) +
@@ -93,6 +103,12 @@ func (k *KV) MarshalToSizedBuffer(buf []byte) (int, error) {
 	if len(buf) < k.Size() {
 		return 0, io.ErrShortBuffer
 	}
+	n := len(appendFormatHeader(buf[:0], FormatFixed))
+	return n + k.marshalFixed(buf[n:]), nil
+}
+
+// marshalFixed writes KV in FormatFixed, without header, and returns its size.
+func (k *KV) marshalFixed(buf []byte) int {
 	offset := 0
 
 	// Key
@@ -139,11 +155,25 @@ func (k *KV) MarshalToSizedBuffer(buf []byte) (int, error) {
 	}
 	offset++
 
-	return offset, nil
+	return offset
 }
 
-// Unmarshal decodes KV from binary format.
+// Unmarshal decodes KV from binary format, in either Format.
 func (k *KV) Unmarshal(data []byte) error {
+	return k.unmarshalOptions(data, UnmarshalOptions{})
+}
+
+func (k *KV) unmarshalOptions(data []byte, o UnmarshalOptions) error {
+	f, data, err := payloadFormat(data)
+	if err != nil {
+		return err
+	}
+	if err := o.checkKVSize(len(data)); err != nil {
+		return err
+	}
+	if f == FormatCompact {
+		return k.unmarshalCompact(data)
+	}
 	if len(data) < 37 { // minimum size: 4+0+4+0+4+0+8+8+4+0+4+1
 		return errBufferTooSmall
 	}
@@ -239,11 +269,11 @@ func (l *KVList) GetAllocRef() uint64 { return l.AllocRef }
 func (l *KVList) Reset()              { *l = KVList{} }
 func (l *KVList) String() string      { return "KVList{...}" }
 
-// Size returns the encoded size of KVList.
+// Size returns the encoded size of KVList. Its KVs are encoded without header.
 func (l *KVList) Size() int {
-	size := 4 + 8 // count + allocRef
+	size := formatHeaderSize + 4 + 8 // header + count + allocRef
 	for _, kv := range l.Kv {
-		size += 4 + kv.Size() // length prefix + kv data
+		size += 4 + kv.fixedSize() // length prefix + kv data
 	}
 	return size
 }
@@ -251,7 +281,16 @@ func (l *KVList) Size() int {
 // Marshal encodes KVList to binary format.
 func (l *KVList) Marshal() ([]byte, error) {
 	buf := make([]byte, l.Size())
-	offset := 0
+	_, err := l.MarshalToSizedBuffer(buf)
+	return buf, err
+}
+
+// MarshalToSizedBuffer marshals KVList to a pre-allocated buffer.
+func (l *KVList) MarshalToSizedBuffer(buf []byte) (int, error) {
+	if len(buf) < l.Size() {
+		return 0, io.ErrShortBuffer
+	}
+	offset := len(appendFormatHeader(buf[:0], FormatFixed))
 
 	// Count
 	binary.LittleEndian.PutUint32(buf[offset:], uint32(len(l.Kv)))
@@ -259,21 +298,36 @@ func (l *KVList) Marshal() ([]byte, error) {
 
 	// KVs
 	for _, kv := range l.Kv {
-		kvSize := kv.Size()
+		kvSize := kv.fixedSize()
 		binary.LittleEndian.PutUint32(buf[offset:], uint32(kvSize))
 		offset += 4
-		kv.MarshalToSizedBuffer(buf[offset : offset+kvSize])
+		kv.marshalFixed(buf[offset : offset+kvSize])
 		offset += kvSize
 	}
 
 	// AllocRef
 	binary.LittleEndian.PutUint64(buf[offset:], l.AllocRef)
+	offset += 8
 
-	return buf, nil
+	return offset, nil
 }
 
-// Unmarshal decodes KVList from binary format.
+// minListKVSize is the smallest size of a KV in a KVList, length prefix included.
+const minListKVSize = 4 + 37
+
+// Unmarshal decodes KVList from binary format, in either Format.
 func (l *KVList) Unmarshal(data []byte) error {
+	return l.unmarshalOptions(data, UnmarshalOptions{})
+}
+
+func (l *KVList) unmarshalOptions(data []byte, o UnmarshalOptions) error {
+	f, data, err := payloadFormat(data)
+	if err != nil {
+		return err
+	}
+	if f == FormatCompact {
+		return l.unmarshalCompact(data, o)
+	}
 	if len(data) < 12 { // minimum: count(4) + allocRef(8)
 		return errBufferTooSmall
 	}
@@ -282,6 +336,13 @@ func (l *KVList) Unmarshal(data []byte) error {
 	// Count
 	count := int(binary.LittleEndian.Uint32(data[offset:]))
 	offset += 4
+	if err := o.checkListLen(uint64(count)); err != nil {
+		return err
+	}
+	// Bound the allocation for corrupt counts.
+	if count > (len(data)-offset)/minListKVSize {
+		return errBufferTooSmall
+	}
 
 	l.Kv = make([]*KV, count)
 	for i := 0; i < count; i++ {
@@ -290,9 +351,13 @@ func (l *KVList) Unmarshal(data []byte) error {
 		}
 		kvSize := int(binary.LittleEndian.Uint32(data[offset:]))
 		offset += 4
+		if err := o.checkKVSize(kvSize); err != nil {
+			return err
+		}
 		if offset+kvSize > len(data) {
 			return errBufferTooSmall
 		}
+		// KVs have no header, so they decode as version 0.
 		l.Kv[i] = &KV{}
 		if err := l.Kv[i].Unmarshal(data[offset : offset+kvSize]); err != nil {
 			return err
@@ -317,6 +382,8 @@ type ManifestChange struct {
 	KeyId          uint64
 	EncryptionAlgo EncryptionAlgo
 	Compression    uint32
+	Dictionary     []byte
+	Lifecycle      []byte
 }
 
 func (m *ManifestChange) GetId() uint64                       { return m.Id }
@@ -325,18 +392,44 @@ func (m *ManifestChange) GetLevel() uint32                    { return m.Level }
 func (m *ManifestChange) GetKeyId() uint64                    { return m.KeyId }
 func (m *ManifestChange) GetEncryptionAlgo() EncryptionAlgo   { return m.EncryptionAlgo }
 func (m *ManifestChange) GetCompression() uint32              { return m.Compression }
+func (m *ManifestChange) GetDictionary() []byte               { return m.Dictionary }
+func (m *ManifestChange) GetLifecycle() []byte                { return m.Lifecycle }
 func (m *ManifestChange) Reset()                              { *m = ManifestChange{} }
 func (m *ManifestChange) String() string                      { return "ManifestChange{...}" }
 
+// manifestChangeSize is the size of ManifestChange without header, and without payload.
+// Format: [id:8][op:4][level:4][keyId:8][encryptionAlgo:4][compression:4][payload]
+const manifestChangeSize = 8 + 4 + 4 + 8 + 4 + 4
+
+// payload returns the bytes ending the encoding of the change: its lifecycle for LIFECYCLE
+// changes, and its dictionary otherwise. They take the rest of the encoding, so that the
+// changes without them are encoded as before they were added.
+func (m *ManifestChange) payload() []byte {
+	if m.Op == ManifestChange_LIFECYCLE {
+		return m.Lifecycle
+	}
+	return m.Dictionary
+}
+
+// bodySize returns the encoded size of ManifestChange without header.
+func (m *ManifestChange) bodySize() int {
+	return manifestChangeSize + len(m.payload())
+}
+
 // Size returns the encoded size of ManifestChange.
-// Format: [id:8][op:4][level:4][keyId:8][encryptionAlgo:4][compression:4]
 func (m *ManifestChange) Size() int {
-	return 8 + 4 + 4 + 8 + 4 + 4 // 32 bytes
+	return versionHeaderSize + m.bodySize()
 }
 
 // Marshal encodes ManifestChange to binary format.
 func (m *ManifestChange) Marshal() ([]byte, error) {
 	buf := make([]byte, m.Size())
+	m.marshalBody(buf[len(appendVersionHeader(buf[:0])):])
+	return buf, nil
+}
+
+// marshalBody writes ManifestChange without header.
+func (m *ManifestChange) marshalBody(buf []byte) {
 	offset := 0
 
 	binary.LittleEndian.PutUint64(buf[offset:], m.Id)
@@ -355,13 +448,18 @@ func (m *ManifestChange) Marshal() ([]byte, error) {
 	offset += 4
 
 	binary.LittleEndian.PutUint32(buf[offset:], m.Compression)
+	offset += 4
 
-	return buf, nil
+	copy(buf[offset:], m.payload())
 }
 
 // Unmarshal decodes ManifestChange from binary format.
 func (m *ManifestChange) Unmarshal(data []byte) error {
-	if len(data) < 32 {
+	_, data, err := payloadVersion(data)
+	if err != nil {
+		return err
+	}
+	if len(data) < manifestChangeSize {
 		return errBufferTooSmall
 	}
 	offset := 0
@@ -382,6 +480,19 @@ func (m *ManifestChange) Unmarshal(data []byte) error {
 	offset += 4
 
 	m.Compression = binary.LittleEndian.Uint32(data[offset:])
+	offset += 4
+
+	var payload []byte
+	if offset < len(data) {
+		payload = make([]byte, len(data)-offset)
+		copy(payload, data[offset:])
+	}
+	m.Dictionary, m.Lifecycle = nil, nil
+	if m.Op == ManifestChange_LIFECYCLE {
+		m.Lifecycle = payload
+	} else {
+		m.Dictionary = payload
+	}
 
 	return nil
 }
@@ -395,11 +506,11 @@ func (m *ManifestChangeSet) GetChanges() []*ManifestChange { return m.Changes }
 func (m *ManifestChangeSet) Reset()                        { *m = ManifestChangeSet{} }
 func (m *ManifestChangeSet) String() string                { return "ManifestChangeSet{...}" }
 
-// Size returns the encoded size of ManifestChangeSet.
+// Size returns the encoded size of ManifestChangeSet. Its changes are encoded without header.
 func (m *ManifestChangeSet) Size() int {
-	size := 4 // count
-	for range m.Changes {
-		size += 4 + 32 // length prefix + ManifestChange size
+	size := versionHeaderSize + 4 // header + count
+	for _, change := range m.Changes {
+		size += 4 + change.bodySize() // length prefix + ManifestChange size
 	}
 	return size
 }
@@ -407,20 +518,17 @@ func (m *ManifestChangeSet) Size() int {
 // Marshal encodes ManifestChangeSet to binary format.
 func (m *ManifestChangeSet) Marshal() ([]byte, error) {
 	buf := make([]byte, m.Size())
-	offset := 0
+	offset := len(appendVersionHeader(buf[:0]))
 
 	binary.LittleEndian.PutUint32(buf[offset:], uint32(len(m.Changes)))
 	offset += 4
 
 	for _, change := range m.Changes {
-		changeData, err := change.Marshal()
-		if err != nil {
-			return nil, err
-		}
-		binary.LittleEndian.PutUint32(buf[offset:], uint32(len(changeData)))
+		sz := change.bodySize()
+		binary.LittleEndian.PutUint32(buf[offset:], uint32(sz))
 		offset += 4
-		copy(buf[offset:], changeData)
-		offset += len(changeData)
+		change.marshalBody(buf[offset : offset+sz])
+		offset += sz
 	}
 
 	return buf, nil
@@ -428,6 +536,14 @@ func (m *ManifestChangeSet) Marshal() ([]byte, error) {
 
 // Unmarshal decodes ManifestChangeSet from binary format.
 func (m *ManifestChangeSet) Unmarshal(data []byte) error {
+	return m.unmarshalOptions(data, UnmarshalOptions{})
+}
+
+func (m *ManifestChangeSet) unmarshalOptions(data []byte, o UnmarshalOptions) error {
+	_, data, err := payloadVersion(data)
+	if err != nil {
+		return err
+	}
 	if len(data) < 4 {
 		return errBufferTooSmall
 	}
@@ -435,6 +551,13 @@ func (m *ManifestChangeSet) Unmarshal(data []byte) error {
 
 	count := int(binary.LittleEndian.Uint32(data[offset:]))
 	offset += 4
+	if err := o.checkListLen(uint64(count)); err != nil {
+		return err
+	}
+	// Bound the allocation for corrupt counts.
+	if count > (len(data)-offset)/(4+manifestChangeSize) {
+		return errBufferTooSmall
+	}
 
 	m.Changes = make([]*ManifestChange, count)
 	for i := 0; i < count; i++ {
@@ -458,29 +581,36 @@ func (m *ManifestChangeSet) Unmarshal(data []byte) error {
 
 // DataKey represents an encryption data key.
 type DataKey struct {
-	KeyId     uint64
-	Data      []byte
-	Iv        []byte
-	CreatedAt int64
+	KeyId          uint64
+	Data           []byte
+	Iv             []byte
+	CreatedAt      int64
+	EncryptionAlgo EncryptionAlgo
 }
 
-func (d *DataKey) GetKeyId() uint64     { return d.KeyId }
-func (d *DataKey) GetData() []byte      { return d.Data }
-func (d *DataKey) GetIv() []byte        { return d.Iv }
-func (d *DataKey) GetCreatedAt() int64  { return d.CreatedAt }
-func (d *DataKey) Reset()               { *d = DataKey{} }
-func (d *DataKey) String() string       { return "DataKey{...}" }
+func (d *DataKey) GetKeyId() uint64                  { return d.KeyId }
+func (d *DataKey) GetData() []byte                   { return d.Data }
+func (d *DataKey) GetIv() []byte                     { return d.Iv }
+func (d *DataKey) GetCreatedAt() int64               { return d.CreatedAt }
+func (d *DataKey) GetEncryptionAlgo() EncryptionAlgo { return d.EncryptionAlgo }
+func (d *DataKey) Reset()                            { *d = DataKey{} }
+func (d *DataKey) String() string                    { return "DataKey{...}" }
 
 // Size returns the encoded size of DataKey.
-// Format: [keyId:8][dataLen:4][data][ivLen:4][iv][createdAt:8]
+// Format: [header:5][keyId:8][dataLen:4][data][ivLen:4][iv][createdAt:8][algo:4]
+// The algorithm is only written if it isn't AES, so that AES keys keep their original encoding.
 func (d *DataKey) Size() int {
-	return 8 + 4 + len(d.Data) + 4 + len(d.Iv) + 8
+	sz := versionHeaderSize + 8 + 4 + len(d.Data) + 4 + len(d.Iv) + 8
+	if d.EncryptionAlgo != EncryptionAlgo_aes {
+		sz += 4
+	}
+	return sz
 }
 
 // Marshal encodes DataKey to binary format.
 func (d *DataKey) Marshal() ([]byte, error) {
 	buf := make([]byte, d.Size())
-	offset := 0
+	offset := len(appendVersionHeader(buf[:0]))
 
 	binary.LittleEndian.PutUint64(buf[offset:], d.KeyId)
 	offset += 8
@@ -496,12 +626,21 @@ func (d *DataKey) Marshal() ([]byte, error) {
 	offset += len(d.Iv)
 
 	binary.LittleEndian.PutUint64(buf[offset:], uint64(d.CreatedAt))
+	offset += 8
+
+	if d.EncryptionAlgo != EncryptionAlgo_aes {
+		binary.LittleEndian.PutUint32(buf[offset:], uint32(d.EncryptionAlgo))
+	}
 
 	return buf, nil
 }
 
 // Unmarshal decodes DataKey from binary format.
 func (d *DataKey) Unmarshal(data []byte) error {
+	_, data, err := payloadVersion(data)
+	if err != nil {
+		return err
+	}
 	if len(data) < 24 { // minimum: keyId(8) + dataLen(4) + ivLen(4) + createdAt(8)
 		return errBufferTooSmall
 	}
@@ -535,6 +674,12 @@ func (d *DataKey) Unmarshal(data []byte) error {
 		return errBufferTooSmall
 	}
 	d.CreatedAt = int64(binary.LittleEndian.Uint64(data[offset:]))
+	offset += 8
+
+	d.EncryptionAlgo = EncryptionAlgo_aes
+	if offset+4 <= len(data) {
+		d.EncryptionAlgo = EncryptionAlgo(binary.LittleEndian.Uint32(data[offset:]))
+	}
 
 	return nil
 }
@@ -551,23 +696,28 @@ func (c *Checksum) Reset()                      { *c = Checksum{} }
 func (c *Checksum) String() string              { return "Checksum{...}" }
 
 // Size returns the encoded size of Checksum.
-// Format: [algo:4][sum:8]
+// Format: [header:1][algo:4][sum:8]
 func (c *Checksum) Size() int {
-	return 4 + 8 // 12 bytes
+	return checksumHeaderSize + 4 + 8 // 13 bytes
 }
 
 // Marshal encodes Checksum to binary format.
 func (c *Checksum) Marshal() ([]byte, error) {
 	buf := make([]byte, c.Size())
+	body := buf[len(appendChecksumHeader(buf[:0])):]
 
-	binary.LittleEndian.PutUint32(buf[0:], uint32(c.Algo))
-	binary.LittleEndian.PutUint64(buf[4:], c.Sum)
+	binary.LittleEndian.PutUint32(body[0:], uint32(c.Algo))
+	binary.LittleEndian.PutUint64(body[4:], c.Sum)
 
 	return buf, nil
 }
 
 // Unmarshal decodes Checksum from binary format.
 func (c *Checksum) Unmarshal(data []byte) error {
+	_, data, err := checksumPayloadVersion(data)
+	if err != nil {
+		return err
+	}
 	if len(data) < 12 {
 		return errBufferTooSmall
 	}
@@ -590,15 +740,15 @@ func (m *Match) Reset()                  { *m = Match{} }
 func (m *Match) String() string          { return "Match{...}" }
 
 // Size returns the encoded size of Match.
-// Format: [prefixLen:4][prefix][ignoreBytesLen:4][ignoreBytes]
+// Format: [header:5][prefixLen:4][prefix][ignoreBytesLen:4][ignoreBytes]
 func (m *Match) Size() int {
-	return 4 + len(m.Prefix) + 4 + len(m.IgnoreBytes)
+	return versionHeaderSize + 4 + len(m.Prefix) + 4 + len(m.IgnoreBytes)
 }
 
 // Marshal encodes Match to binary format.
 func (m *Match) Marshal() ([]byte, error) {
 	buf := make([]byte, m.Size())
-	offset := 0
+	offset := len(appendVersionHeader(buf[:0]))
 
 	binary.LittleEndian.PutUint32(buf[offset:], uint32(len(m.Prefix)))
 	offset += 4
@@ -614,6 +764,10 @@ func (m *Match) Marshal() ([]byte, error) {
 
 // Unmarshal decodes Match from binary format.
 func (m *Match) Unmarshal(data []byte) error {
+	_, data, err := payloadVersion(data)
+	if err != nil {
+		return err
+	}
 	if len(data) < 8 { // minimum: prefixLen(4) + ignoreBytesLen(4)
 		return errBufferTooSmall
 	}
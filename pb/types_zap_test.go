@@ -8,7 +8,12 @@
 package pb
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
 )
 
 func TestKVMarshalUnmarshal(t *testing.T) {
@@ -114,6 +119,44 @@ func TestManifestChangeMarshalUnmarshal(t *testing.T) {
 	if mc2.Level != mc.Level {
 		t.Errorf("Level mismatch: got %d, want %d", mc2.Level, mc.Level)
 	}
+	if mc2.Dictionary != nil {
+		t.Errorf("Dictionary mismatch: got %x, want nil", mc2.Dictionary)
+	}
+
+	// The dictionary takes the rest of the encoding.
+	dc := &ManifestChange{Id: 7, Op: ManifestChange_DICTIONARY, Level: 6,
+		Dictionary: []byte("dictionary")}
+	set, err := (&ManifestChangeSet{Changes: []*ManifestChange{dc, mc}}).Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var set2 ManifestChangeSet
+	if err := set2.Unmarshal(set); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if len(set2.Changes) != 2 {
+		t.Fatalf("Changes mismatch: got %d, want 2", len(set2.Changes))
+	}
+	if got := set2.Changes[0]; got.Op != dc.Op || got.Level != dc.Level ||
+		string(got.Dictionary) != "dictionary" {
+		t.Errorf("Dictionary change mismatch: got %+v, want %+v", got, dc)
+	}
+	if got := set2.Changes[1]; got.Id != mc.Id || got.Dictionary != nil {
+		t.Errorf("Create change mismatch: got %+v, want %+v", got, mc)
+	}
+
+	// So does the lifecycle of LIFECYCLE changes.
+	lc := &ManifestChange{Op: ManifestChange_LIFECYCLE, Lifecycle: []byte("lifecycle")}
+	data, err = lc.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if err := mc2.Unmarshal(data); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if string(mc2.Lifecycle) != "lifecycle" || mc2.Dictionary != nil {
+		t.Errorf("Lifecycle change mismatch: got %+v, want %+v", mc2, lc)
+	}
 }
 
 func TestChecksumMarshalUnmarshal(t *testing.T) {
@@ -167,6 +210,25 @@ func TestDataKeyMarshalUnmarshal(t *testing.T) {
 	if dk2.CreatedAt != dk.CreatedAt {
 		t.Errorf("CreatedAt mismatch: got %d, want %d", dk2.CreatedAt, dk.CreatedAt)
 	}
+	if dk2.EncryptionAlgo != EncryptionAlgo_aes {
+		t.Errorf("EncryptionAlgo mismatch: got %d, want aes", dk2.EncryptionAlgo)
+	}
+
+	// The algorithm is only encoded if it isn't AES.
+	dk.EncryptionAlgo = EncryptionAlgo_chacha20poly1305
+	chacha, err := dk.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if len(chacha) != len(data)+4 {
+		t.Errorf("Size mismatch: got %d, want %d", len(chacha), len(data)+4)
+	}
+	if err := dk2.Unmarshal(chacha); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if dk2.EncryptionAlgo != EncryptionAlgo_chacha20poly1305 {
+		t.Errorf("EncryptionAlgo mismatch: got %d, want chacha20poly1305", dk2.EncryptionAlgo)
+	}
 }
 
 func TestMarshalUnmarshalInterface(t *testing.T) {
@@ -252,3 +314,365 @@ func TestKVClone(t *testing.T) {
 		t.Errorf("Clone shares memory with original")
 	}
 }
+
+func TestKVCompactFormat(t *testing.T) {
+	kv := &KV{
+		Key:        []byte("k"),
+		Value:      []byte("v"),
+		Version:    300,
+		ExpiresAt:  1 << 40,
+		Meta:       []byte{0x02},
+		StreamId:   7,
+		StreamDone: true,
+	}
+	data, err := kv.MarshalFormat(FormatCompact)
+	if err != nil {
+		t.Fatalf("MarshalFormat failed: %v", err)
+	}
+	if len(data) != kv.SizeFormat(FormatCompact) {
+		t.Errorf("SizeFormat mismatch: got %d, want %d", kv.SizeFormat(FormatCompact), len(data))
+	}
+	if len(data) >= kv.Size() {
+		t.Errorf("compact size %d not below fixed size %d", len(data), kv.Size())
+	}
+
+	kv2 := &KV{}
+	if err := kv2.Unmarshal(data); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !bytes.Equal(kv2.Key, kv.Key) || !bytes.Equal(kv2.Value, kv.Value) ||
+		!bytes.Equal(kv2.Meta, kv.Meta) || kv2.Version != kv.Version ||
+		kv2.ExpiresAt != kv.ExpiresAt || kv2.StreamId != kv.StreamId ||
+		kv2.StreamDone != kv.StreamDone {
+		t.Errorf("round trip mismatch: got %+v, want %+v", kv2, kv)
+	}
+
+	for i := 0; i < len(data); i++ {
+		if err := (&KV{}).Unmarshal(data[:i]); err == nil && i >= formatHeaderSize {
+			t.Errorf("Unmarshal of %d truncated bytes succeeded", i)
+		}
+	}
+	bad := append([]byte{}, data...)
+	bad[4] = 0x7f
+	if err := (&KV{}).Unmarshal(bad); err == nil {
+		t.Error("Unmarshal of an unknown format succeeded")
+	}
+}
+
+func TestKVListCompactFormat(t *testing.T) {
+	list := &KVList{AllocRef: 99}
+	for i := 0; i < 100; i++ {
+		list.Kv = append(list.Kv, &KV{Key: []byte{byte(i)}, Value: []byte{1}, Version: uint64(i)})
+	}
+	fixed, err := list.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	data, err := MarshalOptions{Format: FormatCompact}.MarshalAppend(nil, list)
+	if err != nil {
+		t.Fatalf("MarshalAppend failed: %v", err)
+	}
+	if len(data) != list.SizeFormat(FormatCompact) {
+		t.Errorf("SizeFormat mismatch: got %d, want %d", list.SizeFormat(FormatCompact), len(data))
+	}
+	if len(data)*3 > len(fixed) {
+		t.Errorf("compact size %d not well below fixed size %d", len(data), len(fixed))
+	}
+
+	for _, buf := range [][]byte{fixed, data} {
+		list2 := &KVList{}
+		if err := list2.Unmarshal(buf); err != nil {
+			t.Fatalf("Unmarshal failed: %v", err)
+		}
+		if len(list2.Kv) != len(list.Kv) || list2.AllocRef != list.AllocRef {
+			t.Fatalf("got %d KVs and AllocRef %d", len(list2.Kv), list2.AllocRef)
+		}
+		for i, kv := range list2.Kv {
+			if !bytes.Equal(kv.Key, list.Kv[i].Key) || kv.Version != list.Kv[i].Version {
+				t.Errorf("KV %d mismatch: got %+v", i, kv)
+			}
+		}
+	}
+
+	// A huge count must fail without allocating for it.
+	huge := appendFormatHeader(nil, FormatCompact)
+	huge = append(huge, 0xff, 0xff, 0xff, 0xff, 0x0f)
+	if err := (&KVList{}).Unmarshal(huge); err == nil {
+		t.Error("Unmarshal of a corrupt count succeeded")
+	}
+}
+
+func TestMarshalToPool(t *testing.T) {
+	list := &KVList{AllocRef: 7}
+	for i := 0; i < 10; i++ {
+		list.Kv = append(list.Kv, &KV{Key: []byte{byte(i)}, Value: []byte("value"), Version: 1})
+	}
+	want, err := list.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	// A large enough dst is used as is.
+	dst := make([]byte, 0, len(want)+10)
+	got, err := MarshalTo(dst, list)
+	if err != nil {
+		t.Fatalf("MarshalTo failed: %v", err)
+	}
+	if !bytes.Equal(got, want) || &got[0] != &dst[:1][0] {
+		t.Error("MarshalTo did not encode into dst")
+	}
+
+	// Otherwise the buffer comes from the pool, and goes back to it.
+	got, err = MarshalTo(nil, list)
+	if err != nil {
+		t.Fatalf("MarshalTo failed: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("MarshalTo into a pooled buffer mismatch")
+	}
+	ReleaseBuffer(got)
+
+	// Types without MarshalToSizedBuffer are encoded too.
+	cs := &Checksum{Algo: Checksum_XXHash64, Sum: 42}
+	csWant, _ := cs.Marshal()
+	got, err = MarshalTo(nil, cs)
+	if err != nil || !bytes.Equal(got, csWant) {
+		t.Errorf("MarshalTo of Checksum: got %v, %v", got, err)
+	}
+
+	if buf := GetBuffer(100); len(buf) != 100 {
+		t.Errorf("GetBuffer length: got %d, want 100", len(buf))
+	}
+
+	prefix := []byte("prefix")
+	appended, err := MarshalOptions{}.MarshalAppend(prefix, list)
+	if err != nil {
+		t.Fatalf("MarshalAppend failed: %v", err)
+	}
+	if !bytes.Equal(appended, append([]byte("prefix"), want...)) {
+		t.Error("MarshalAppend mismatch")
+	}
+}
+
+func BenchmarkMarshalTo(b *testing.B) {
+	list := &KVList{}
+	for i := 0; i < 100; i++ {
+		list.Kv = append(list.Kv, &KV{Key: []byte("key"), Value: make([]byte, 100)})
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, err := MarshalTo(nil, list)
+		if err != nil {
+			b.Fatal(err)
+		}
+		ReleaseBuffer(buf)
+	}
+}
+
+func TestKVStream(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewKVStreamWriter(&buf)
+	list := &KVList{}
+	for i := 0; i < 1000; i++ {
+		list.Kv = append(list.Kv, &KV{
+			Key: []byte{byte(i >> 8), byte(i)}, Value: bytes.Repeat([]byte{byte(i)}, i), Version: uint64(i),
+		})
+	}
+	if err := w.WriteList(list); err != nil {
+		t.Fatalf("WriteList failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := w.Write(list.Kv[0]); err == nil {
+		t.Error("Write after Close succeeded")
+	}
+	data := buf.Bytes()
+
+	r := NewKVStreamReader(bytes.NewReader(data))
+	for i := 0; ; i++ {
+		kv, err := r.Read()
+		if err == io.EOF {
+			if i != len(list.Kv) {
+				t.Fatalf("read %d KVs, want %d", i, len(list.Kv))
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("Read %d failed: %v", i, err)
+		}
+		if !bytes.Equal(kv.Key, list.Kv[i].Key) || !bytes.Equal(kv.Value, list.Kv[i].Value) {
+			t.Fatalf("KV %d mismatch", i)
+		}
+	}
+
+	// A truncated stream isn't mistaken for a complete one.
+	r = NewKVStreamReader(bytes.NewReader(data[:len(data)-frameHeaderSize]))
+	var err error
+	for err == nil {
+		_, err = r.Read()
+	}
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated stream: got %v, want io.ErrUnexpectedEOF", err)
+	}
+
+	corrupt := append([]byte{}, data...)
+	corrupt[len(streamMagic)+frameHeaderSize] ^= 0xff
+	if _, err := NewKVStreamReader(bytes.NewReader(corrupt)).Read(); err != ErrStreamChecksum {
+		t.Errorf("corrupt frame: got %v, want ErrStreamChecksum", err)
+	}
+	if _, err := NewKVStreamReader(bytes.NewReader([]byte("nope"))).Read(); err != ErrStreamHeader {
+		t.Errorf("bad header: got %v, want ErrStreamHeader", err)
+	}
+	r = NewKVStreamReader(bytes.NewReader(data))
+	r.MaxKVSize = 10
+	if _, err := r.Read(); err == nil {
+		t.Error("Read of a KV over MaxKVSize succeeded")
+	}
+}
+
+func TestFormatVersion(t *testing.T) {
+	kv := &KV{Key: []byte("k"), Value: []byte("v"), Version: 3}
+	list := &KVList{Kv: []*KV{kv}, AllocRef: 5}
+	set := &ManifestChangeSet{Changes: []*ManifestChange{{Id: 9, Level: 2}}}
+	messages := []struct {
+		m      Message
+		header int
+		empty  func() Message
+	}{
+		{kv, formatHeaderSize, func() Message { return &KV{} }},
+		{list, formatHeaderSize, func() Message { return &KVList{} }},
+		{set.Changes[0], versionHeaderSize, func() Message { return &ManifestChange{} }},
+		{set, versionHeaderSize, func() Message { return &ManifestChangeSet{} }},
+		{&DataKey{KeyId: 1, Data: []byte("d"), Iv: []byte("iv")}, versionHeaderSize,
+			func() Message { return &DataKey{} }},
+		{&Checksum{Sum: 7}, checksumHeaderSize, func() Message { return &Checksum{} }},
+		{&Match{Prefix: []byte("p")}, versionHeaderSize, func() Message { return &Match{} }},
+	}
+	for _, tc := range messages {
+		data, err := tc.m.Marshal()
+		if err != nil {
+			t.Fatalf("%T: Marshal failed: %v", tc.m, err)
+		}
+		version := Version
+		if _, ok := tc.m.(*Checksum); ok {
+			version = ChecksumVersion
+		}
+		if v, err := version(data); err != nil || v != FormatVersion {
+			t.Errorf("%T: Version = %d, %v", tc.m, v, err)
+		}
+
+		// Version 0 is the same layout without header.
+		legacy := data[tc.header:]
+		if v, _ := version(legacy); v != 0 {
+			t.Errorf("%T: legacy Version = %d", tc.m, v)
+		}
+		got := tc.empty()
+		if err := got.Unmarshal(legacy); err != nil {
+			t.Fatalf("%T: Unmarshal of version 0 failed: %v", tc.m, err)
+		}
+		again, err := got.Marshal()
+		if err != nil || !bytes.Equal(again, data) {
+			t.Errorf("%T: version 0 round trip mismatch", tc.m)
+		}
+
+		migrated, err := Migrate(legacy, tc.empty())
+		if err != nil || !bytes.Equal(migrated, data) {
+			t.Errorf("%T: Migrate = %v, %v", tc.m, migrated, err)
+		}
+
+		future := append([]byte{}, data...)
+		if tc.header == checksumHeaderSize {
+			future[0] = checksumVersionFlag | (FormatVersion + 1)
+		} else {
+			future[4] = FormatVersion + 1
+		}
+		if err := tc.empty().Unmarshal(future); !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("%T: Unmarshal of a future version: got %v", tc.m, err)
+		}
+	}
+}
+
+func TestUnmarshalLegacyProto(t *testing.T) {
+	// A KVList as protobuf encodes it, with an unknown field of every wire type.
+	var kv []byte
+	kv = protowire.AppendTag(kv, 1, protowire.BytesType)
+	kv = protowire.AppendBytes(kv, []byte("key"))
+	kv = protowire.AppendTag(kv, 2, protowire.BytesType)
+	kv = protowire.AppendBytes(kv, []byte("value"))
+	kv = protowire.AppendTag(kv, 4, protowire.VarintType)
+	kv = protowire.AppendVarint(kv, 1<<40)
+	kv = protowire.AppendTag(kv, 6, protowire.BytesType)
+	kv = protowire.AppendBytes(kv, []byte{0x40})
+	kv = protowire.AppendTag(kv, 7, protowire.Fixed32Type)
+	kv = protowire.AppendFixed32(kv, 1)
+	kv = protowire.AppendTag(kv, 10, protowire.VarintType)
+	kv = protowire.AppendVarint(kv, 3)
+	kv = protowire.AppendTag(kv, 11, protowire.VarintType)
+	kv = protowire.AppendVarint(kv, 1)
+
+	var data []byte
+	for i := 0; i < 2; i++ {
+		data = protowire.AppendTag(data, 1, protowire.BytesType)
+		data = protowire.AppendBytes(data, kv)
+	}
+	data = protowire.AppendTag(data, 8, protowire.Fixed64Type)
+	data = protowire.AppendFixed64(data, 1)
+	data = protowire.AppendTag(data, 10, protowire.VarintType)
+	data = protowire.AppendVarint(data, 42)
+
+	list := &KVList{}
+	if err := UnmarshalLegacyProto(data, list); err != nil {
+		t.Fatalf("UnmarshalLegacyProto failed: %v", err)
+	}
+	if len(list.Kv) != 2 || list.AllocRef != 42 {
+		t.Fatalf("got %d KVs, AllocRef %d", len(list.Kv), list.AllocRef)
+	}
+	want := &KV{Key: []byte("key"), Value: []byte("value"),
+		Version: 1 << 40, Meta: []byte{0x40}, StreamId: 3, StreamDone: true}
+	got := list.Kv[1]
+	if !bytes.Equal(got.Key, want.Key) || !bytes.Equal(got.Value, want.Value) ||
+		!bytes.Equal(got.Meta, want.Meta) || got.Version != want.Version ||
+		got.StreamId != want.StreamId || got.StreamDone != want.StreamDone {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Decoded values don't alias the input.
+	data[4] ^= 0xff
+	if !bytes.Equal(list.Kv[0].Key, []byte("key")) {
+		t.Errorf("decoded key aliases the input")
+	}
+
+	var set []byte
+	set = protowire.AppendTag(set, 1, protowire.BytesType)
+	var change []byte
+	change = protowire.AppendTag(change, 1, protowire.VarintType)
+	change = protowire.AppendVarint(change, 9)
+	change = protowire.AppendTag(change, 3, protowire.VarintType)
+	change = protowire.AppendVarint(change, 2)
+	set = protowire.AppendBytes(set, change)
+	changes := &ManifestChangeSet{}
+	if err := UnmarshalLegacyProto(set, changes); err != nil {
+		t.Fatalf("UnmarshalLegacyProto of a ManifestChangeSet failed: %v", err)
+	}
+	if len(changes.Changes) != 1 || changes.Changes[0].Id != 9 || changes.Changes[0].Level != 2 {
+		t.Errorf("got %+v", changes.Changes)
+	}
+
+	// Truncated input, a wrong wire type, and the zap encoding are rejected.
+	if err := UnmarshalLegacyProto(data[:len(data)-1], &KVList{}); err == nil {
+		t.Error("expected an error for truncated input")
+	}
+	bad := protowire.AppendTag(nil, 1, protowire.VarintType)
+	bad = protowire.AppendVarint(bad, 1)
+	if err := UnmarshalLegacyProto(bad, &KV{}); err == nil {
+		t.Error("expected an error for a wrong wire type")
+	}
+	zap, err := list.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if err := UnmarshalLegacyProto(zap, &KVList{}); err == nil {
+		t.Error("expected an error for the zap encoding")
+	}
+}
@@ -0,0 +1,133 @@
+//go:build !grpc
+
+/*
+ * SPDX-FileCopyrightText: 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package pb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// FormatVersion is the version of the encodings written by Marshal. Encodings start with four
+// 0xff bytes followed by the version byte. Version 0 is the original layout without header,
+// which Unmarshal still decodes: its first four bytes are a length or count, an enum, or the
+// low half of a manifest or data key ID, none of which reach 2^32-1.
+//
+// KV and KVList follow the version byte with a Format byte.
+//
+// Checksum, written for every block of every table, has a single byte header instead: 0x80 with
+// the version in its low bits. Its version 0 encoding starts with its algorithm, a small enum, so
+// its first byte never has the high bit set. The other types need the four 0xff bytes, as their
+// version 0 encodings start with a length, count or ID, whose first byte can be any value.
+const FormatVersion = 1
+
+const versionHeaderSize = 5
+
+// checksumVersionFlag is set in the one-byte header of Checksum, the version being in the other
+// bits.
+const checksumVersionFlag = 0x80
+
+const checksumHeaderSize = 1
+
+// formatHeaderSize is the size of the header of KV and KVList.
+const formatHeaderSize = versionHeaderSize + 1
+
+// ErrUnsupportedVersion is returned when decoding an encoding of a version newer than
+// FormatVersion.
+var ErrUnsupportedVersion = errors.New("unsupported pb format version")
+
+func appendVersionHeader(buf []byte) []byte {
+	return append(buf, 0xff, 0xff, 0xff, 0xff, FormatVersion)
+}
+
+func appendChecksumHeader(buf []byte) []byte {
+	return append(buf, checksumVersionFlag|FormatVersion)
+}
+
+func appendFormatHeader(buf []byte, f Format) []byte {
+	return append(appendVersionHeader(buf), byte(f))
+}
+
+// payloadVersion returns the version of data, and data without its header.
+func payloadVersion(data []byte) (int, []byte, error) {
+	if len(data) < versionHeaderSize || binary.LittleEndian.Uint32(data) != 0xffffffff {
+		return 0, data, nil
+	}
+	if v := int(data[4]); v >= 1 && v <= FormatVersion {
+		return v, data[versionHeaderSize:], nil
+	}
+	return 0, nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, data[4])
+}
+
+// checksumPayloadVersion returns the version of the Checksum encoding data, and data without its
+// header.
+func checksumPayloadVersion(data []byte) (int, []byte, error) {
+	if len(data) == 0 || data[0]&checksumVersionFlag == 0 {
+		return 0, data, nil
+	}
+	if v := int(data[0] &^ checksumVersionFlag); v >= 1 && v <= FormatVersion {
+		return v, data[checksumHeaderSize:], nil
+	}
+	return 0, nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, data[0]&^checksumVersionFlag)
+}
+
+// payloadFormat returns the Format of a KV or KVList encoding, and the encoding without its
+// header.
+func payloadFormat(data []byte) (Format, []byte, error) {
+	v, data, err := payloadVersion(data)
+	if err != nil || v == 0 {
+		return FormatFixed, data, err
+	}
+	if len(data) == 0 {
+		return 0, nil, errBufferTooSmall
+	}
+	if f := Format(data[0]); f == FormatFixed || f == FormatCompact {
+		return f, data[1:], nil
+	}
+	return 0, nil, errInvalidData
+}
+
+// Version returns the format version of an encoding, 0 for encodings without header. Checksum,
+// whose header is a single byte, is told apart by ChecksumVersion.
+func Version(data []byte) (int, error) {
+	v, _, err := payloadVersion(data)
+	return v, err
+}
+
+// ChecksumVersion returns the format version of an encoding of Checksum, 0 for encodings without
+// header.
+func ChecksumVersion(data []byte) (int, error) {
+	v, _, err := checksumPayloadVersion(data)
+	return v, err
+}
+
+// Message is implemented by all the types of this package.
+type Message interface {
+	Marshaler
+	Unmarshaler
+}
+
+// Migrate decodes data, of any supported version, into m and returns it encoded in
+// FormatVersion. Data already in FormatVersion is returned as is.
+func Migrate(data []byte, m Message) ([]byte, error) {
+	version := Version
+	if _, ok := m.(*Checksum); ok {
+		version = ChecksumVersion
+	}
+	v, err := version(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	if v == FormatVersion {
+		return data, nil
+	}
+	return m.Marshal()
+}
@@ -0,0 +1,69 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// percentileRunsPerTable is the number of runs of blocks each table is split into at most by
+// KeyAtPercentile, which is its precision.
+const percentileRunsPerTable = 64
+
+// keyWeight is a run of blocks of a table, by its first key and its size.
+type keyWeight struct {
+	key  []byte
+	size uint64
+}
+
+// KeyAtPercentile returns the approximate key at percentile p, from 0 to 100, of the keys with
+// prefix: the key before which p percent of their data is. It is estimated from the sizes of the
+// blocks in the indexes of the tables, without reading them, so that the keys of prefix can be
+// split into partitions of about the same size, or the progress of a scan over them reported.
+//
+// The versions and the deletions in the tables are counted like the keys, and the memtables
+// aren't counted. The precision is a 64th of a table, as the blocks of each table are grouped into
+// 64 runs at most. KeyAtPercentile returns nil if no table holds keys with prefix.
+func (db *DB) KeyAtPercentile(prefix []byte, p float64) ([]byte, error) {
+	if math.IsNaN(p) || p < 0 || p > 100 {
+		return nil, fmt.Errorf("Percentile %v must be within [0, 100]", p)
+	}
+	if db.IsClosed() {
+		return nil, ErrDBClosed
+	}
+	var weights []keyWeight
+	var total uint64
+	for _, l := range db.lc.levels {
+		l.RLock()
+		for _, t := range l.tables {
+			t.KeyWeights(percentileRunsPerTable, prefix, func(key []byte, size uint64) {
+				// The internal keys are left out, unless asked for.
+				if bytes.HasPrefix(key, badgerPrefix) && !bytes.HasPrefix(prefix, badgerPrefix) {
+					return
+				}
+				weights = append(weights, keyWeight{key: bytes.Clone(key), size: size})
+				total += size
+			})
+		}
+		l.RUnlock()
+	}
+	if len(weights) == 0 {
+		return nil, nil
+	}
+
+	slices.SortFunc(weights, func(a, b keyWeight) int { return bytes.Compare(a.key, b.key) })
+	target := uint64(p / 100 * float64(total))
+	var sum uint64
+	for _, w := range weights {
+		if sum += w.size; sum > target {
+			return w.key, nil
+		}
+	}
+	return weights[len(weights)-1].key, nil
+}
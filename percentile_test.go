@@ -0,0 +1,68 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyAtPercentile(t *testing.T) {
+	dir := t.TempDir()
+	opt := getTestOptions(dir).WithMemTableSize(1 << 20).WithValueThreshold(1 << 10)
+	db, err := Open(opt)
+	require.NoError(t, err)
+
+	key := func(prefix string, i int) []byte { return []byte(fmt.Sprintf("%s%06d", prefix, i)) }
+	val := bytes.Repeat([]byte("v"), 100)
+	wb := db.NewWriteBatch()
+	for i := 0; i < 20000; i++ {
+		for _, prefix := range []string{"a", "b", "c"} {
+			require.NoError(t, wb.Set(key(prefix, i), val))
+		}
+	}
+	require.NoError(t, wb.Flush())
+
+	// The memtables are flushed at the close.
+	require.NoError(t, db.Close())
+	db, err = Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	index := func(k []byte) int {
+		require.True(t, bytes.HasPrefix(k, []byte("b")), "%q", k)
+		// The first run starts at the prefix.
+		if len(k) == 1 {
+			return 0
+		}
+		var i int
+		_, err := fmt.Sscanf(string(k), "b%06d", &i)
+		require.NoError(t, err)
+		return i
+	}
+	for _, p := range []float64{0, 10, 25, 50, 75, 90, 100} {
+		k, err := db.KeyAtPercentile([]byte("b"), p)
+		require.NoError(t, err)
+		require.InDelta(t, p/100*20000, index(k), 20000*0.05, "percentile %v: %q", p, k)
+	}
+	k, err := db.KeyAtPercentile([]byte("d"), 50)
+	require.NoError(t, err)
+	require.Nil(t, k)
+
+	// Without a prefix, the percentiles span all the keys.
+	k, err = db.KeyAtPercentile(nil, 50)
+	require.NoError(t, err)
+	require.Equal(t, []byte("b"), k[:1])
+
+	for _, p := range []float64{-1, 101, math.NaN()} {
+		_, err := db.KeyAtPercentile(nil, p)
+		require.Error(t, err)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/luxfi/zapdb/y"
+)
+
+// prefetchBudget bounds the memory held by values prefetched by iterators. See
+// Options.MaxPrefetchMemory. A nil budget places no limit on prefetching.
+type prefetchBudget struct {
+	limit  int64
+	used   atomic.Int64
+	active atomic.Int64 // Number of open iterators that prefetch values.
+	// evicted counts the prefetched values dropped by evict.
+	evicted atomic.Int64
+
+	// slices pools the value buffers of closed iterators, so that new iterators do not
+	// allocate their own.
+	slices sync.Pool
+}
+
+func newPrefetchBudget(limit int64) *prefetchBudget {
+	if limit <= 0 {
+		return nil
+	}
+	b := &prefetchBudget{limit: limit}
+	b.slices.New = func() interface{} { return new(y.Slice) }
+	return b
+}
+
+// share returns the part of the budget an iterator may hold while other iterators are open.
+func (b *prefetchBudget) share() int64 {
+	n := b.active.Load()
+	if n < 1 {
+		n = 1
+	}
+	return b.limit / n
+}
+
+// acquire reserves sz bytes for it, returning false if the iterator should load the value
+// lazily instead. An iterator holding nothing is always allowed one value, so that a single
+// large value cannot stall it.
+func (b *prefetchBudget) acquire(it *Iterator, sz int64) bool {
+	if b == nil {
+		return true
+	}
+	if it.prefetched > 0 {
+		if it.prefetched+sz > b.share() {
+			return false
+		}
+		if b.used.Add(sz) > b.limit {
+			b.used.Add(-sz)
+			return false
+		}
+	} else {
+		b.used.Add(sz)
+	}
+	it.prefetched += sz
+	return true
+}
+
+// release returns the bytes reserved for item, once the iterator has moved past it.
+func (b *prefetchBudget) release(it *Iterator, item *Item) {
+	if b == nil || item.charge == 0 {
+		return
+	}
+	b.used.Add(-item.charge)
+	it.prefetched -= item.charge
+	item.charge = 0
+}
+
+// evict drops the values prefetched by it beyond its share of the budget, from the farthest
+// ahead, so that the iterators opened since it prefetched them get their share. The items
+// dropped load their values lazily, like those which didn't fit in the budget.
+func (b *prefetchBudget) evict(it *Iterator) {
+	if b == nil {
+		return
+	}
+	share := b.share()
+	if it.prefetched <= share {
+		return
+	}
+	// it.data is only linked forward, from the next item.
+	var charged []*Item
+	for item := it.data.head; item != nil; item = item.next {
+		if item.charge > 0 {
+			charged = append(charged, item)
+		}
+	}
+	for i := len(charged) - 1; i >= 0 && it.prefetched > share; i-- {
+		item := charged[i]
+		item.wg.Wait()
+		b.release(it, item)
+		item.val, item.err, item.status = nil, nil, 0
+		// The buffer of the value is dropped with it, rather than pooled.
+		item.slice = new(y.Slice)
+		b.evicted.Add(1)
+	}
+}
+
+func (b *prefetchBudget) getSlice() *y.Slice {
+	if b == nil {
+		return new(y.Slice)
+	}
+	return b.slices.Get().(*y.Slice)
+}
+
+func (b *prefetchBudget) putSlice(s *y.Slice) {
+	if b == nil || s == nil {
+		return
+	}
+	b.slices.Put(s)
+}
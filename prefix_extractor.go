@@ -0,0 +1,36 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import "fmt"
+
+// PrefixExtractor extracts the prefixes of the keys added to the prefix bloom filters of the
+// tables, so that an Iterator with a Prefix skips the tables which can't have it. See
+// Options.PrefixExtractor.
+type PrefixExtractor struct {
+	// Name identifies the extractor in the tables built with it. The filters of the tables built
+	// with an extractor of another name aren't used, so that the extractor can be changed: the
+	// name must change whenever Extract does.
+	Name string
+	// Extract returns the prefix of key, or nil if it has none. The prefix must be a prefix of key,
+	// and every key starting with it must have the same prefix. The tables skipped by an Iterator
+	// with a Prefix are the ones whose filter doesn't have the prefix Extract returns for Prefix.
+	Extract func(key []byte) []byte
+}
+
+// FixedPrefixExtractor returns a PrefixExtractor of the first n bytes of the keys. The keys shorter
+// than n bytes have no prefix.
+func FixedPrefixExtractor(n int) PrefixExtractor {
+	return PrefixExtractor{
+		Name: fmt.Sprintf("fixed:%d", n),
+		Extract: func(key []byte) []byte {
+			if len(key) < n {
+				return nil
+			}
+			return key[:n]
+		},
+	}
+}
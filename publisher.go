@@ -6,6 +6,7 @@
 package badger
 
 import (
+	"bytes"
 	"sync"
 	"sync/atomic"
 
@@ -77,9 +78,21 @@ func (p *publisher) publishUpdates(reqs requests) {
 	}()
 	batchedUpdates := make(map[uint64]*pb.KVList)
 	for _, req := range reqs {
+		// The metadata of the commit precedes its KVs sent to a subscriber.
+		var commitMeta *pb.KV
+		for _, e := range req.Entries {
+			if bytes.Equal(y.ParseKey(e.Key), commitMetadataKey) {
+				commitMeta = &pb.KV{
+					Key:     commitMetadataKey,
+					Value:   y.SafeCopy(nil, e.Value),
+					Version: y.ParseTs(e.Key),
+				}
+			}
+		}
+		sentMeta := make(map[uint64]bool)
 		for _, e := range req.Entries {
 			ids := p.indexer.Get(e.Key)
-			if len(ids) == 0 {
+			if len(ids) == 0 || commitMeta != nil && bytes.Equal(y.ParseKey(e.Key), commitMetadataKey) {
 				continue
 			}
 			k := y.SafeCopy(nil, e.Key)
@@ -94,6 +107,10 @@ func (p *publisher) publishUpdates(reqs requests) {
 				if _, ok := batchedUpdates[id]; !ok {
 					batchedUpdates[id] = &pb.KVList{}
 				}
+				if commitMeta != nil && !sentMeta[id] {
+					sentMeta[id] = true
+					batchedUpdates[id].Kv = append(batchedUpdates[id].Kv, commitMeta)
+				}
 				batchedUpdates[id].Kv = append(batchedUpdates[id].Kv, kv)
 			}
 		}
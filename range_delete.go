@@ -0,0 +1,460 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/luxfi/zapdb/table"
+	"github.com/luxfi/zapdb/y"
+)
+
+// rangeTombstonePrefix starts the keys of the range tombstones. It is followed by the length of
+// the start of the range as a uvarint, the start and the end. The version of the key is the
+// version of the tombstone, and it has no value.
+var rangeTombstonePrefix = []byte("!badger!range")
+
+// rangeTombstone deletes the versions of the keys from start, inclusive, to end, exclusive, below
+// version.
+type rangeTombstone struct {
+	start, end []byte
+	version    uint64
+}
+
+// deletes returns whether key is in the range of t. Internal keys are never deleted by range
+// tombstones.
+func (t rangeTombstone) deletes(key []byte) bool {
+	return bytes.Compare(key, t.start) >= 0 && bytes.Compare(key, t.end) < 0 &&
+		!bytes.HasPrefix(key, badgerPrefix)
+}
+
+func rangeTombstoneKey(start, end []byte) []byte {
+	key := make([]byte, 0, len(rangeTombstonePrefix)+binary.MaxVarintLen64+len(start)+len(end))
+	key = append(key, rangeTombstonePrefix...)
+	key = binary.AppendUvarint(key, uint64(len(start)))
+	key = append(key, start...)
+	return append(key, end...)
+}
+
+// parseRangeTombstone returns the tombstone of key, with its version, or false if key isn't the
+// key of a tombstone.
+func parseRangeTombstone(key []byte) (rangeTombstone, bool) {
+	rest := y.ParseKey(key)
+	if !bytes.HasPrefix(rest, rangeTombstonePrefix) {
+		return rangeTombstone{}, false
+	}
+	rest = rest[len(rangeTombstonePrefix):]
+	n, sz := binary.Uvarint(rest)
+	if sz <= 0 || uint64(len(rest)-sz) < n {
+		return rangeTombstone{}, false
+	}
+	rest = rest[sz:]
+	return rangeTombstone{
+		start:   y.SafeCopy(nil, rest[:n]),
+		end:     y.SafeCopy(nil, rest[n:]),
+		version: y.ParseTs(key),
+	}, true
+}
+
+// rangeFragment is a piece of the ranges of the tombstones, from start, inclusive, to end,
+// exclusive, which no tombstone starts or ends within.
+type rangeFragment struct {
+	start, end []byte
+	// versions are those of the tombstones covering the fragment, in ascending order.
+	versions []uint64
+}
+
+// rangeTombstones are the range tombstones of a DB. They are all kept in memory, a tombstone
+// costing one entry whatever the size of its range, until collectRangeTombstones finds no version
+// left for them to delete.
+type rangeTombstones struct {
+	sync.RWMutex
+	// n is the number of tombstones, read without the lock.
+	n atomic.Int64
+	// loaded is set once the tombstones written before the DB was opened are loaded.
+	loaded atomic.Bool
+	// all are the tombstones, by the key of their entry, with its version.
+	all map[string]rangeTombstone
+	// frags split the ranges of the tombstones into fragments not overlapping each other, in
+	// order, so that the tombstones covering a key are found by a binary search.
+	frags []rangeFragment
+	// cleanTs maps the IDs of the tables built by compactions to the discardTs they were built
+	// at: the versions the tombstones up to it delete aren't left in them.
+	cleanTs map[uint64]uint64
+}
+
+// find returns the index of the last fragment starting at key or before, or -1.
+func (r *rangeTombstones) find(key []byte) int {
+	return sort.Search(len(r.frags), func(i int) bool {
+		return bytes.Compare(r.frags[i].start, key) > 0
+	}) - 1
+}
+
+// seek returns the index of the first fragment starting at key or after.
+func (r *rangeTombstones) seek(key []byte) int {
+	return sort.Search(len(r.frags), func(i int) bool {
+		return bytes.Compare(r.frags[i].start, key) >= 0
+	})
+}
+
+// split splits the fragment key is within, so that a fragment starts at key.
+func (r *rangeTombstones) split(key []byte) {
+	i := r.find(key)
+	if i < 0 || bytes.Equal(r.frags[i].start, key) || bytes.Compare(key, r.frags[i].end) >= 0 {
+		return
+	}
+	f := rangeFragment{start: key, end: r.frags[i].end, versions: slices.Clone(r.frags[i].versions)}
+	r.frags[i].end = key
+	r.frags = slices.Insert(r.frags, i+1, f)
+}
+
+// add adds t. A range deleted again has a tombstone for each version, so that the transactions
+// reading in between still see the versions written since the first one.
+func (r *rangeTombstones) add(t rangeTombstone) {
+	k := string(y.KeyWithTs(rangeTombstoneKey(t.start, t.end), t.version))
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.all[k]; ok {
+		return
+	}
+	if r.all == nil {
+		r.all = make(map[string]rangeTombstone)
+	}
+	r.all[k] = t
+	r.n.Add(1)
+
+	r.split(t.start)
+	r.split(t.end)
+	i := r.seek(t.start)
+	for from := t.start; bytes.Compare(from, t.end) < 0; i++ {
+		if i < len(r.frags) && bytes.Equal(r.frags[i].start, from) {
+			f := &r.frags[i]
+			j, _ := slices.BinarySearch(f.versions, t.version)
+			f.versions = slices.Insert(f.versions, j, t.version)
+			from = f.end
+			continue
+		}
+		// The gap up to the next fragment, or to the end, gets a fragment of its own.
+		to := t.end
+		if i < len(r.frags) && bytes.Compare(r.frags[i].start, to) < 0 {
+			to = r.frags[i].start
+		}
+		r.frags = slices.Insert(r.frags, i, rangeFragment{start: from, end: to,
+			versions: []uint64{t.version}})
+		from = to
+	}
+}
+
+// remove removes the tombstones of the entry keys, and merges the fragments left alike.
+func (r *rangeTombstones) remove(keys []string) {
+	r.Lock()
+	defer r.Unlock()
+	for _, k := range keys {
+		t, ok := r.all[k]
+		if !ok {
+			continue
+		}
+		delete(r.all, k)
+		r.n.Add(-1)
+		// Fragments merged may span the bounds of t.
+		r.split(t.start)
+		r.split(t.end)
+		for i := r.seek(t.start); i < len(r.frags) && bytes.Compare(r.frags[i].start, t.end) < 0; i++ {
+			f := &r.frags[i]
+			if j, ok := slices.BinarySearch(f.versions, t.version); ok {
+				f.versions = slices.Delete(f.versions, j, j+1)
+			}
+		}
+	}
+	frags := r.frags[:0]
+	for _, f := range r.frags {
+		switch n := len(frags); {
+		case len(f.versions) == 0:
+		case n > 0 && bytes.Equal(frags[n-1].end, f.start) &&
+			slices.Equal(frags[n-1].versions, f.versions):
+			frags[n-1].end = f.end
+		default:
+			frags = append(frags, f)
+		}
+	}
+	clear(r.frags[len(frags):])
+	r.frags = frags
+}
+
+func (r *rangeTombstones) reset() {
+	r.Lock()
+	defer r.Unlock()
+	r.all, r.frags, r.cleanTs = nil, nil, nil
+	r.n.Store(0)
+}
+
+// covers returns whether version of key is deleted by a range tombstone as of readTs.
+func (r *rangeTombstones) covers(key []byte, version, readTs uint64) bool {
+	if r.n.Load() == 0 || bytes.HasPrefix(key, badgerPrefix) {
+		return false
+	}
+	r.RLock()
+	defer r.RUnlock()
+	i := r.find(key)
+	if i < 0 || bytes.Compare(key, r.frags[i].end) >= 0 {
+		return false
+	}
+	versions := r.frags[i].versions
+	j := sort.Search(len(versions), func(j int) bool { return versions[j] > version })
+	return j < len(versions) && versions[j] <= readTs
+}
+
+// dropped returns whether the tombstone of the entry key, with its version, was removed.
+func (r *rangeTombstones) dropped(key []byte) bool {
+	if !r.loaded.Load() {
+		return false
+	}
+	r.RLock()
+	defer r.RUnlock()
+	_, ok := r.all[string(key)]
+	return !ok
+}
+
+// setCleanTs records that the versions deleted by the tombstones up to ts aren't left in the table
+// id.
+func (r *rangeTombstones) setCleanTs(id, ts uint64) {
+	r.Lock()
+	defer r.Unlock()
+	if r.cleanTs == nil {
+		r.cleanTs = make(map[uint64]uint64)
+	}
+	r.cleanTs[id] = ts
+}
+
+// dropTables forgets the tables compacted away.
+func (r *rangeTombstones) dropTables(tables ...[]*table.Table) {
+	r.Lock()
+	defer r.Unlock()
+	for _, ts := range tables {
+		for _, t := range ts {
+			delete(r.cleanTs, t.ID())
+		}
+	}
+}
+
+// collectRangeTombstones removes the tombstones left without versions to delete: those no
+// transaction reads below anymore, whose range holds no version below them in the memtables, nor
+// tables but those built by compactions since no transaction did. The compactions drop their
+// entries afterwards. The versions only move down the levels, so that checking the memtables, then
+// the levels from the top, meets them all.
+func (db *DB) collectRangeTombstones() {
+	r := &db.rangeDels
+	if r.n.Load() == 0 || !r.loaded.Load() {
+		return
+	}
+	discardTs := db.versionDiscardTs()
+	var keys []string
+	r.RLock()
+	for k, t := range r.all {
+		if t.version <= discardTs {
+			keys = append(keys, k)
+		}
+	}
+	r.RUnlock()
+
+	var drop []string
+	for _, k := range keys {
+		r.RLock()
+		t := r.all[k]
+		r.RUnlock()
+		if !db.memTablesBelow(t) && db.rangeTablesClean(t) {
+			drop = append(drop, k)
+		}
+	}
+	if len(drop) > 0 {
+		r.remove(drop)
+		db.opt.Debugf("Removed %d range tombstones", len(drop))
+	}
+}
+
+// rangeTablesClean returns whether the tables of the levels overlapping the range of t were all
+// built by compactions which deleted the versions t deletes.
+func (db *DB) rangeTablesClean(t rangeTombstone) bool {
+	kr := keyRange{left: y.KeyWithTs(t.start, math.MaxUint64), right: y.KeyWithTs(t.end, 0)}
+	var ids []uint64
+	for _, l := range db.lc.levels {
+		l.RLock()
+		if l.level == 0 {
+			for _, tbl := range l.tables {
+				if kr.overlapsWith(keyRange{left: tbl.Smallest(), right: tbl.Biggest()}) {
+					ids = append(ids, tbl.ID())
+				}
+			}
+		} else {
+			lo, hi := l.overlappingTables(levelHandlerRLocked{}, kr)
+			for _, tbl := range l.tables[lo:hi] {
+				ids = append(ids, tbl.ID())
+			}
+		}
+		l.RUnlock()
+	}
+	r := &db.rangeDels
+	r.RLock()
+	defer r.RUnlock()
+	for _, id := range ids {
+		if r.cleanTs[id] < t.version {
+			return false
+		}
+	}
+	return true
+}
+
+// memTablesBelow returns whether the memtables hold a version of a key in the range of t, below
+// it, which isn't deleted.
+func (db *DB) memTablesBelow(t rangeTombstone) bool {
+	mts, decr := db.getMemTables()
+	defer decr()
+	for _, mt := range mts {
+		it := mt.sl.NewIterator()
+		for it.Seek(y.KeyWithTs(t.start, math.MaxUint64)); it.Valid(); it.Next() {
+			key := y.ParseKey(it.Key())
+			if bytes.Compare(key, t.end) >= 0 {
+				break
+			}
+			vs := it.Value()
+			if y.ParseTs(it.Key()) < t.version && t.deletes(key) &&
+				!isDeletedOrExpired(vs.Meta, vs.ExpiresAt) {
+				_ = it.Close()
+				return true
+			}
+		}
+		_ = it.Close()
+	}
+	return false
+}
+
+// initRangeTombstones loads the range tombstones of the DB.
+func (db *DB) initRangeTombstones() error {
+	txn := db.newTransaction(false, true)
+	txn.readTs = math.MaxUint64 // Tombstones may be ahead of the oracle of a managed DB.
+	txn.doneRead = true
+	defer txn.Discard()
+
+	opt := DefaultIteratorOptions
+	opt.Prefix = rangeTombstonePrefix
+	opt.PrefetchValues = false
+	opt.InternalAccess = true
+	opt.AllVersions = true
+	opt.uncounted = true
+	it := txn.NewIterator(opt)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		// The entries of the tombstones removed are deleted by the compactions.
+		if it.Item().IsDeletedOrExpired() {
+			continue
+		}
+		if t, ok := parseRangeTombstone(y.KeyWithTs(it.Item().Key(), it.Item().Version())); ok {
+			db.rangeDels.add(t)
+		}
+	}
+	db.rangeDels.loaded.Store(true)
+	return nil
+}
+
+// rangeTombstonesSince returns the range tombstones read by txn committed after since, their
+// ranges clipped to prefix.
+func (txn *Txn) rangeTombstonesSince(since uint64, prefix []byte) []rangeTombstone {
+	opt := DefaultIteratorOptions
+	opt.Prefix = rangeTombstonePrefix
+	opt.PrefetchValues = false
+	opt.InternalAccess = true
+	opt.AllVersions = true
+	opt.SinceTs = since
+	opt.uncounted = true
+	it := txn.NewIterator(opt)
+	defer it.Close()
+
+	end := prefixEnd(prefix)
+	var ts []rangeTombstone
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		if item.IsDeletedOrExpired() {
+			continue
+		}
+		t, ok := parseRangeTombstone(y.KeyWithTs(item.Key(), item.Version()))
+		if !ok {
+			continue
+		}
+		if bytes.Compare(t.start, prefix) < 0 {
+			t.start = prefix
+		}
+		if end != nil && bytes.Compare(t.end, end) > 0 {
+			t.end = end
+		}
+		if bytes.Compare(t.start, t.end) < 0 {
+			ts = append(ts, t)
+		}
+	}
+	return ts
+}
+
+// DeleteRange deletes the keys from start, inclusive, to end, exclusive, as of the commit of the
+// transaction. Unlike deleting the keys one by one, it writes a single range tombstone, whatever
+// the number of keys in the range: reads skip the versions it covers, and compactions drop them
+// once no transaction reads them anymore. It returns ErrInvalidRange unless start is before end.
+//
+// The writes of the transaction to keys in the range are dropped, but those made after
+// DeleteRange are kept. Internal keys, including those of column families, aren't deleted.
+// Transactions which read keys in the range don't conflict with DeleteRange.
+// The DB keeps the tombstones in memory until the compactions have deleted the versions they
+// cover from all the levels, so DeleteRange is meant for truncating large ranges rather than for
+// deleting single keys. In managed mode, the versions written below a tombstone after it may be
+// read again once it's removed.
+func (txn *Txn) DeleteRange(start, end []byte) error {
+	if bytes.Compare(start, end) >= 0 {
+		return ErrInvalidRange
+	}
+	t := rangeTombstone{start: y.SafeCopy(nil, start), end: y.SafeCopy(nil, end)}
+	if err := txn.modifyKey(&Entry{Key: rangeTombstoneKey(start, end)}, true); err != nil {
+		return err
+	}
+	for k, e := range txn.pendingWrites {
+		if t.deletes(e.Key) {
+			txn.deletePending(k)
+		}
+	}
+	var dups []*Entry
+	for _, e := range txn.duplicateWrites {
+		if !t.deletes(e.Key) {
+			dups = append(dups, e)
+		}
+	}
+	txn.setDuplicates(dups)
+	txn.rangeDels = append(txn.rangeDels, t)
+	return nil
+}
+
+// rangeDeleted returns whether version of key, as read by the transaction, is deleted by a range
+// tombstone: a committed one as of its read timestamp, or one of its own, unless it wrote key
+// since.
+func (txn *Txn) rangeDeleted(key []byte, version uint64) bool {
+	if txn.db.rangeDels.covers(key, version, txn.readTs) {
+		return true
+	}
+	if len(txn.rangeDels) == 0 {
+		return false
+	}
+	if _, ok := txn.pendingWrites[string(key)]; ok {
+		return false
+	}
+	for _, t := range txn.rangeDels {
+		if t.deletes(key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,310 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/pb"
+	"github.com/luxfi/zapdb/trie"
+	"github.com/luxfi/zapdb/y"
+)
+
+func TestDeleteRange(t *testing.T) {
+	dir := t.TempDir()
+	opt := getTestOptions(dir).WithCompactL0OnClose(true)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	key := func(prefix string, i int) []byte { return []byte(fmt.Sprintf("%s%03d", prefix, i)) }
+	for _, prefix := range []string{"a", "b"} {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			for i := 0; i < 100; i++ {
+				if err := txn.Set(key(prefix, i), key("val", i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+	}
+	count := func(db *DB) (n int) {
+		require.NoError(t, db.View(func(txn *Txn) error {
+			it := txn.NewIterator(DefaultIteratorOptions)
+			defer it.Close()
+			for it.Rewind(); it.Valid(); it.Next() {
+				n++
+			}
+			opt := DefaultIteratorOptions
+			opt.Reverse = true
+			rit := txn.NewIterator(opt)
+			defer rit.Close()
+			var rn int
+			for rit.Rewind(); rit.Valid(); rit.Next() {
+				rn++
+			}
+			require.Equal(t, n, rn)
+			return nil
+		}))
+		return n
+	}
+	found := func(txn *Txn, k []byte) bool {
+		_, err := txn.Get(k)
+		if err == ErrKeyNotFound {
+			return false
+		}
+		require.NoError(t, err)
+		return true
+	}
+
+	before := db.NewTransaction(false)
+	defer before.Discard()
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		require.NoError(t, txn.Set(key("a", 20), []byte("dropped")))
+		require.ErrorIs(t, txn.DeleteRange(key("a", 50), key("a", 10)), ErrInvalidRange)
+		require.NoError(t, txn.DeleteRange(key("a", 10), key("a", 50)))
+		require.NoError(t, txn.Set(key("a", 30), []byte("kept")))
+		require.False(t, found(txn, key("a", 20)))
+		require.True(t, found(txn, key("a", 30)))
+		require.True(t, found(txn, key("a", 50)))
+		it := txn.NewIterator(DefaultIteratorOptions)
+		defer it.Close()
+		var n int
+		for it.Rewind(); it.Valid(); it.Next() {
+			n++
+		}
+		require.Equal(t, 161, n)
+		return nil
+	}))
+
+	check := func(db *DB) {
+		require.Equal(t, 161, count(db))
+		require.NoError(t, db.View(func(txn *Txn) error {
+			require.True(t, found(txn, key("a", 9)))
+			require.False(t, found(txn, key("a", 10)))
+			require.False(t, found(txn, key("a", 49)))
+			require.True(t, found(txn, key("a", 50)))
+			item, err := txn.Get(key("a", 30))
+			require.NoError(t, err)
+			require.NoError(t, item.Value(func(val []byte) error {
+				require.Equal(t, []byte("kept"), val)
+				return nil
+			}))
+			return nil
+		}))
+	}
+	check(db)
+	// Transactions which started before still read the range.
+	require.True(t, found(before, key("a", 20)))
+	before.Discard()
+	require.NoError(t, db.Close())
+
+	// The compaction on close drops the deleted versions.
+	db, err = Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	check(db)
+	var keys uint32
+	for _, ti := range db.Tables() {
+		keys += ti.KeyCount
+	}
+	// The 40 deleted keys are gone, but the one set again, and the tombstone is kept.
+	require.Equal(t, uint32(200-40+1+1), keys)
+
+	// Keys can be written again in the range.
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.Set(key("a", 20), []byte("new"))
+	}))
+	require.Equal(t, 162, count(db))
+}
+
+func TestRangeTombstones(t *testing.T) {
+	var r rangeTombstones
+	key := func(start, end string, version uint64) string {
+		return string(y.KeyWithTs(rangeTombstoneKey([]byte(start), []byte(end)), version))
+	}
+	add := func(start, end string, version uint64) {
+		r.add(rangeTombstone{start: []byte(start), end: []byte(end), version: version})
+	}
+	add("b", "d", 5)
+	add("b", "d", 10)
+	add("c", "f", 7)
+	add("c", "f", 7)
+	require.EqualValues(t, 3, r.n.Load())
+
+	// The range deleted again keeps both versions: the version written in between is read until
+	// the second one.
+	require.True(t, r.covers([]byte("b"), 4, 5))
+	require.False(t, r.covers([]byte("b"), 6, 9))
+	require.True(t, r.covers([]byte("b"), 6, 10))
+	require.True(t, r.covers([]byte("e"), 6, 7))
+	require.False(t, r.covers([]byte("e"), 7, 20))
+	require.False(t, r.covers([]byte("a"), 1, 20))
+	require.False(t, r.covers([]byte("f"), 1, 20))
+	require.False(t, r.covers([]byte("!badger!c"), 1, 20))
+
+	r.remove([]string{key("b", "d", 10)})
+	require.False(t, r.covers([]byte("b"), 6, 20))
+	require.True(t, r.covers([]byte("c"), 6, 20))
+	r.remove([]string{key("b", "d", 5), key("c", "f", 7)})
+	require.Zero(t, r.n.Load())
+	require.Empty(t, r.frags)
+}
+
+func TestRangeTombstoneCollect(t *testing.T) {
+	dir := t.TempDir()
+	opt := getTestOptions(dir).WithNumCompactors(0)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key%03d", i)) }
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		for i := 0; i < 100; i++ {
+			if err := txn.Set(key(i), []byte("val")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.DeleteRange(key(10), key(50))
+	}))
+	compactL0 := func() {
+		require.NoError(t, db.flushMemTableForCheckpoint())
+		prio := compactionPriority{level: 0, score: 1.71, t: db.lc.levelTargets()}
+		require.NoError(t, db.lc.doCompact(-1, prio))
+	}
+	check := func(db *DB) {
+		require.NoError(t, db.View(func(txn *Txn) error {
+			for i := 0; i < 100; i++ {
+				_, err := txn.Get(key(i))
+				if i >= 10 && i < 50 {
+					require.ErrorIs(t, err, ErrKeyNotFound)
+				} else {
+					require.NoError(t, err)
+				}
+			}
+			return nil
+		}))
+	}
+	check(db)
+
+	// The tombstone is kept while versions it deletes are in the memtables, or in tables not
+	// compacted since.
+	db.collectRangeTombstones()
+	require.EqualValues(t, 1, db.rangeDels.n.Load())
+	require.NoError(t, db.flushMemTableForCheckpoint())
+	db.collectRangeTombstones()
+	require.EqualValues(t, 1, db.rangeDels.n.Load())
+	compactL0()
+	require.Zero(t, db.rangeDels.n.Load())
+	check(db)
+
+	// The next compaction of its entry deletes it.
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		if err := txn.Set([]byte("!"), nil); err != nil {
+			return err
+		}
+		return txn.Set([]byte("~"), nil)
+	}))
+	compactL0()
+	require.NoError(t, db.Close())
+	db, err = Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	require.Zero(t, db.rangeDels.n.Load())
+	check(db)
+}
+
+func TestDeleteRangeIncremental(t *testing.T) {
+	db, err := Open(getTestOptions(t.TempDir()))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key%03d", i)) }
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		for i := 0; i < 100; i++ {
+			if err := txn.Set(key(i), []byte("val")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	var buf bytes.Buffer
+	since, err := db.Backup(&buf, 0)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.DeleteRange(key(10), key(50))
+	}))
+
+	// The incremental backup has the tombstone, which deletes the keys backed up before.
+	_, err = db.Backup(&buf, since)
+	require.NoError(t, err)
+	restored, err := Open(getTestOptions(t.TempDir()))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, restored.Close()) }()
+	require.NoError(t, restored.Load(&buf, 16))
+	require.NoError(t, restored.View(func(txn *Txn) error {
+		for i := 0; i < 100; i++ {
+			_, err := txn.Get(key(i))
+			if i >= 10 && i < 50 {
+				require.ErrorIs(t, err, ErrKeyNotFound)
+			} else {
+				require.NoError(t, err)
+			}
+		}
+		return nil
+	}))
+
+	// The changefeed has a delete of each key of the range.
+	filter := trie.NewTrie()
+	require.NoError(t, filter.AddMatch(pb.Match{Prefix: []byte("key")}, 0))
+	var deleted []string
+	_, err = db.feedChanges(filter, since, func(kvs *KVList) error {
+		for _, kv := range kvs.Kv {
+			require.Equal(t, []byte{bitDelete}, kv.Meta)
+			deleted = append(deleted, string(kv.Key))
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, deleted, 40)
+	require.Equal(t, string(key(10)), deleted[0])
+	require.Equal(t, string(key(49)), deleted[39])
+}
+
+func TestDeleteRangeStreamWriter(t *testing.T) {
+	db, err := Open(getTestOptions(t.TempDir()))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key%03d", i)) }
+
+	// The tombstone sorts before the keys it deletes, written at an older version.
+	buf := z.NewBuffer(1<<20, "test")
+	defer func() { require.NoError(t, buf.Release()) }()
+	KVToBuffer(&pb.KV{Key: rangeTombstoneKey(key(10), key(50)), Version: 2}, buf)
+	for i := 0; i < 100; i++ {
+		KVToBuffer(&pb.KV{Key: key(i), Value: []byte("val"), Version: 1}, buf)
+	}
+	sw := db.NewStreamWriter()
+	require.NoError(t, sw.Prepare())
+	require.NoError(t, sw.Write(buf))
+	require.NoError(t, sw.Flush())
+
+	// The tombstone deletes the keys without reopening the DB.
+	require.NoError(t, db.View(func(txn *Txn) error {
+		for i := 0; i < 100; i++ {
+			_, err := txn.Get(key(i))
+			if i >= 10 && i < 50 {
+				require.ErrorIs(t, err, ErrKeyNotFound)
+			} else {
+				require.NoError(t, err)
+			}
+		}
+		return nil
+	}))
+}
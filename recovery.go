@@ -0,0 +1,117 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bufio"
+	"hash/crc32"
+)
+
+// LogRecovery describes the tail of a value log or WAL file which was discarded while opening the
+// DB, because it held a torn or corrupt write.
+type LogRecovery struct {
+	Path string
+	// Offset is the end of the last valid entry. The file was truncated at this offset.
+	Offset uint32
+	// DiscardedBytes is the number of non-zero bytes found after Offset.
+	DiscardedBytes int64
+	// DiscardedEntries is the number of well-formed entries found after Offset, which belonged to
+	// a transaction that was not completely written.
+	DiscardedEntries int
+}
+
+// RecoveryReport describes what was discarded while recovering from an unclean shutdown.
+type RecoveryReport struct {
+	Logs []LogRecovery
+}
+
+// DiscardedBytes returns the total number of bytes discarded across all log files.
+func (r RecoveryReport) DiscardedBytes() int64 {
+	var n int64
+	for _, l := range r.Logs {
+		n += l.DiscardedBytes
+	}
+	return n
+}
+
+// DiscardedEntries returns the total number of entries discarded across all log files.
+func (r RecoveryReport) DiscardedEntries() int {
+	var n int
+	for _, l := range r.Logs {
+		n += l.DiscardedEntries
+	}
+	return n
+}
+
+// RecoveryReport returns the report of the log tails truncated while opening the DB. The report is
+// empty if the DB was shut down cleanly.
+func (db *DB) RecoveryReport() RecoveryReport {
+	return RecoveryReport{Logs: append([]LogRecovery{}, db.recovery.Logs...)}
+}
+
+func (db *DB) recordRecovery(lr *LogRecovery) {
+	if lr == nil {
+		return
+	}
+	db.opt.Warningf("Discarded torn tail of %s at offset %d: %d bytes, %d entries",
+		lr.Path, lr.Offset, lr.DiscardedBytes, lr.DiscardedEntries)
+	db.recovery.Logs = append(db.recovery.Logs, *lr)
+}
+
+// tornTail inspects the file after endOff, the end of the last valid entry. It returns nil if the
+// tail is clean, i.e. it starts with a zeroed out header like the one written by zeroNextEntry.
+func (lf *logFile) tornTail(endOff uint32) *LogRecovery {
+	size := int(lf.size.Load())
+	if size > len(lf.Data) {
+		size = len(lf.Data)
+	}
+	start := int(endOff)
+	if start >= size {
+		return nil
+	}
+	if isZeroed(lf.Data[start:min(start+maxHeaderSize, size)]) {
+		return nil
+	}
+
+	last := size - 1
+	for last >= start && lf.Data[last] == 0 {
+		last--
+	}
+
+	// Count the well-formed entries, regardless of transaction boundaries.
+	reader := bufio.NewReader(lf.NewReader(start))
+	read := &safeRead{
+		k:            make([]byte, 10),
+		v:            make([]byte, 10),
+		recordOffset: endOff,
+		lf:           lf,
+	}
+	var entries int
+	for {
+		e, err := read.Entry(reader)
+		if err != nil || e.isZero() {
+			break
+		}
+		entries++
+		read.recordOffset += uint32(e.hlen + len(e.Key) + len(e.Value) + lf.sealOverhead() +
+			crc32.Size)
+	}
+	return &LogRecovery{
+		Path:             lf.path,
+		Offset:           endOff,
+		DiscardedBytes:   int64(last - start + 1),
+		DiscardedEntries: entries,
+	}
+}
+
+func isZeroed(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
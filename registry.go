@@ -0,0 +1,128 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"errors"
+	"expvar"
+	"sort"
+	"sync"
+
+	"github.com/luxfi/zapdb/y"
+)
+
+// dbRegistry holds the DBs registered by name in the process.
+var dbRegistry = struct {
+	sync.RWMutex
+	dbs     map[string]*DB
+	publish sync.Once
+}{dbs: make(map[string]*DB)}
+
+// RegisteredDB describes a registered DB, as published under badger_registry.
+type RegisteredDB struct {
+	Dir          string `json:"dir"`
+	ValueDir     string `json:"value_dir"`
+	InMemory     bool   `json:"in_memory"`
+	ReadOnly     bool   `json:"read_only"`
+	Follower     bool   `json:"follower"`
+	MetricsLabel string `json:"metrics_label"`
+	MaxVersion   uint64 `json:"max_version"`
+	LSMSize      int64  `json:"size_bytes_lsm"`
+	VlogSize     int64  `json:"size_bytes_vlog"`
+}
+
+// Register makes db found by Lookup under name, until it's closed or unregistered, so that the
+// frameworks and the debug endpoints of a process can find its DBs. The registered DBs are
+// published under the badger_registry expvar, keyed by name. It fails if another DB is registered
+// under name.
+func Register(name string, db *DB) error {
+	switch {
+	case name == "":
+		return errors.New("Name of registered DB can't be empty")
+	case db == nil:
+		return errors.New("Registered DB can't be nil")
+	case db.IsClosed():
+		return ErrDBClosed
+	}
+	dbRegistry.publish.Do(func() {
+		expvar.Publish(y.BADGER_METRIC_PREFIX+"registry", expvar.Func(describeRegistered))
+	})
+	dbRegistry.Lock()
+	defer dbRegistry.Unlock()
+	if other, ok := dbRegistry.dbs[name]; ok && other != db {
+		return ErrNameRegistered
+	}
+	dbRegistry.dbs[name] = db
+	return nil
+}
+
+// Unregister removes the DB registered under name, if any.
+func Unregister(name string) {
+	dbRegistry.Lock()
+	defer dbRegistry.Unlock()
+	delete(dbRegistry.dbs, name)
+}
+
+// Lookup returns the DB registered under name.
+func Lookup(name string) (*DB, bool) {
+	dbRegistry.RLock()
+	defer dbRegistry.RUnlock()
+	db, ok := dbRegistry.dbs[name]
+	return db, ok
+}
+
+// Registered returns the names the DBs are registered under, sorted.
+func Registered() []string {
+	dbRegistry.RLock()
+	defer dbRegistry.RUnlock()
+	names := make([]string, 0, len(dbRegistry.dbs))
+	for name := range dbRegistry.dbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// unregisterDB removes db from the registry under all its names, once it's closing.
+func unregisterDB(db *DB) {
+	dbRegistry.Lock()
+	defer dbRegistry.Unlock()
+	for name, other := range dbRegistry.dbs {
+		if other == db {
+			delete(dbRegistry.dbs, name)
+		}
+	}
+}
+
+// describeRegistered returns the registered DBs by name, for badger_registry.
+func describeRegistered() any {
+	dbRegistry.RLock()
+	dbs := make(map[string]*DB, len(dbRegistry.dbs))
+	for name, db := range dbRegistry.dbs {
+		dbs[name] = db
+	}
+	dbRegistry.RUnlock()
+
+	out := make(map[string]RegisteredDB, len(dbs))
+	for name, db := range dbs {
+		if db.IsClosed() {
+			continue
+		}
+		lsm, vlog := db.Size()
+		out[name] = RegisteredDB{
+			Dir:          db.opt.Dir,
+			ValueDir:     db.opt.ValueDir,
+			InMemory:     db.opt.InMemory,
+			ReadOnly:     db.opt.ReadOnly,
+			Follower:     db.opt.Follower,
+			MetricsLabel: db.metrics.Label(),
+			MaxVersion:   db.MaxVersion(),
+			LSMSize:      lsm,
+			VlogSize:     vlog,
+		}
+	}
+	return out
+}
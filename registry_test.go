@@ -0,0 +1,52 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/y"
+)
+
+func TestRegistry(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(getTestOptions(dir))
+	require.NoError(t, err)
+	other, err := Open(getTestOptions(t.TempDir()))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, other.Close()) }()
+
+	require.NoError(t, Register("main", db))
+	require.NoError(t, Register("main", db))
+	require.ErrorIs(t, Register("main", other), ErrNameRegistered)
+	require.NoError(t, Register("other", other))
+	got, ok := Lookup("main")
+	require.True(t, ok)
+	require.Same(t, db, got)
+	require.Equal(t, []string{"main", "other"}, Registered())
+
+	// The registered DBs are published by name.
+	var published map[string]RegisteredDB
+	v := expvar.Get(y.BADGER_METRIC_PREFIX + "registry")
+	require.NotNil(t, v)
+	require.NoError(t, json.Unmarshal([]byte(v.String()), &published))
+	require.Equal(t, dir, published["main"].Dir)
+	require.Contains(t, published, "other")
+
+	Unregister("other")
+	_, ok = Lookup("other")
+	require.False(t, ok)
+
+	// A DB is unregistered once closed.
+	require.NoError(t, db.Close())
+	_, ok = Lookup("main")
+	require.False(t, ok)
+	require.ErrorIs(t, Register("main", db), ErrDBClosed)
+}
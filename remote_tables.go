@@ -0,0 +1,130 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/luxfi/zapdb/objstore"
+	"github.com/luxfi/zapdb/table"
+)
+
+// TableStore stores the files of the tables of the cold storage policy away from the local
+// disk, like in object storage. The tables are read from it at random offsets, block by block
+// through the block cache, so that a DB whose data is mostly cold runs on a small local disk.
+// See Options.RemoteTableStore.
+type TableStore interface {
+	// Put stores the file of table id, size bytes read from r, replacing any existing one.
+	Put(ctx context.Context, id uint64, r io.Reader, size int64) error
+	// Open returns a reader of the file of table id at random offsets, and its size.
+	Open(ctx context.Context, id uint64) (TableFile, int64, error)
+	// Delete deletes the file of table id.
+	Delete(ctx context.Context, id uint64) error
+	// List returns the IDs of the stored tables.
+	List(ctx context.Context) ([]uint64, error)
+}
+
+// TableFile reads the file of a table in a TableStore at random offsets. It's closed once the
+// table is.
+type TableFile interface {
+	io.ReaderAt
+	io.Closer
+}
+
+type objectTableStore struct {
+	store  objstore.RandomAccessStore
+	prefix string
+}
+
+// NewObjectTableStore returns a TableStore keeping the table files in store, as objects named
+// after the tables under prefix.
+func NewObjectTableStore(store objstore.RandomAccessStore, prefix string) TableStore {
+	return &objectTableStore{store: store, prefix: prefix}
+}
+
+func (s *objectTableStore) key(id uint64) string {
+	return s.prefix + table.IDToFilename(id)
+}
+
+func (s *objectTableStore) Put(ctx context.Context, id uint64, r io.Reader, size int64) error {
+	return s.store.Put(ctx, s.key(id), r, size)
+}
+
+func (s *objectTableStore) Open(ctx context.Context, id uint64) (TableFile, int64, error) {
+	return s.store.Open(ctx, s.key(id))
+}
+
+func (s *objectTableStore) Delete(ctx context.Context, id uint64) error {
+	return s.store.Delete(ctx, s.key(id))
+}
+
+func (s *objectTableStore) List(ctx context.Context) ([]uint64, error) {
+	keys, err := s.store.List(ctx, s.prefix)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint64
+	for _, key := range keys {
+		// Skip the objects under prefix which aren't tables, like those of a longer prefix.
+		name := strings.TrimPrefix(key, s.prefix)
+		if id, ok := table.ParseFileID(name); ok && table.IDToFilename(id) == name {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// remoteTableFile is the file of a table in a TableStore, deleted from it with the table.
+type remoteTableFile struct {
+	TableFile
+	store TableStore
+	id    uint64
+}
+
+func (f *remoteTableFile) Delete() error {
+	return errors.Join(f.Close(), f.store.Delete(context.Background(), f.id))
+}
+
+// openRemoteTable opens table id of the store, with topt.
+func openRemoteTable(store TableStore, id uint64, topt *table.Options) (*table.Table, error) {
+	f, size, err := store.Open(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+	t, err := table.OpenTableReaderAt(&remoteTableFile{TableFile: f, store: store, id: id},
+		size, id, topt)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// downloadTable copies the file of table id of the store to a new file dst.
+func downloadTable(store TableStore, id uint64, dst string) error {
+	f, size, err := store.Open(context.Background(), id)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, io.NewSectionReader(f, 0, size)); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,125 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/objstore"
+	"github.com/luxfi/zapdb/pb"
+	"github.com/luxfi/zapdb/table"
+)
+
+func TestRemoteTables(t *testing.T) {
+	dir := t.TempDir()
+	objects := objstore.NewMemory()
+	store := NewObjectTableStore(objects, "tables/")
+	opt := getTestOptions(dir).WithRemoteTableStore(store)
+
+	key := func(i int) []byte { return fmt.Appendf(nil, "key%05d", i) }
+	check := func(db *DB) {
+		require.NoError(t, db.View(func(txn *Txn) error {
+			for i := range 2000 {
+				item, err := txn.Get(key(i))
+				require.NoError(t, err)
+				require.Equal(t, fmt.Appendf(nil, "value%d", i), getItemValue(t, item))
+			}
+			return nil
+		}))
+	}
+
+	db, err := Open(opt)
+	require.NoError(t, err)
+	// The stream writer writes the tables to the last level.
+	buf := z.NewBuffer(1<<20, "test")
+	defer func() { require.NoError(t, buf.Release()) }()
+	for i := range 2000 {
+		KVToBuffer(&pb.KV{Key: key(i), Value: fmt.Appendf(nil, "value%d", i), Version: 1}, buf)
+	}
+	sw := db.NewStreamWriter()
+	require.NoError(t, sw.Prepare())
+	require.NoError(t, sw.Write(buf))
+	require.NoError(t, sw.Flush())
+
+	n, err := db.MoveColdTables()
+	require.NoError(t, err)
+	require.NotZero(t, n)
+
+	tables := db.Tables()
+	require.NotEmpty(t, tables)
+	for _, ti := range tables {
+		require.True(t, ti.Remote)
+		require.False(t, ti.Cold)
+		require.NoFileExists(t, table.NewFilename(ti.ID, dir))
+	}
+	ids, err := store.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, ids, len(tables))
+	check(db)
+
+	// The checkpoint downloads the remote tables.
+	cpDir := filepath.Join(t.TempDir(), "checkpoint")
+	require.NoError(t, db.Checkpoint(cpDir))
+	require.NoError(t, db.Close())
+	cp, err := Open(getTestOptions(cpDir))
+	require.NoError(t, err)
+	check(cp)
+	require.NoError(t, cp.Close())
+
+	// An object left by an interrupted move is deleted, and so are the objects which aren't
+	// tables of the store.
+	stray := tables[0].ID + 1000
+	require.NoError(t, store.Put(context.Background(), stray, bytes.NewReader(nil), 0))
+	db, err = Open(opt)
+	require.NoError(t, err)
+	ids, err = store.List(context.Background())
+	require.NoError(t, err)
+	require.NotContains(t, ids, stray)
+	check(db)
+
+	// The tables of the store are deleted once dropped.
+	require.NoError(t, db.DropAll())
+	require.NoError(t, db.Close())
+	keys, err := objects.List(context.Background(), "tables/")
+	require.NoError(t, err)
+	require.Empty(t, keys)
+
+	_, err = Open(opt.WithRemoteTableStore(nil))
+	require.NoError(t, err)
+}
+
+func TestRemoteTablesRequireStore(t *testing.T) {
+	dir := t.TempDir()
+	opt := getTestOptions(dir).WithRemoteTableStore(
+		NewObjectTableStore(objstore.NewMemory(), ""))
+
+	db, err := Open(opt)
+	require.NoError(t, err)
+	buf := z.NewBuffer(1<<20, "test")
+	defer func() { require.NoError(t, buf.Release()) }()
+	KVToBuffer(&pb.KV{Key: []byte("key"), Value: []byte("value"), Version: 1}, buf)
+	sw := db.NewStreamWriter()
+	require.NoError(t, sw.Prepare())
+	require.NoError(t, sw.Write(buf))
+	require.NoError(t, sw.Flush())
+	n, err := db.MoveColdTables()
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.NoError(t, db.Close())
+
+	_, err = Open(opt.WithRemoteTableStore(nil))
+	require.ErrorContains(t, err, "RemoteTableStore isn't set")
+
+	_, err = Open(opt.WithColdStorageDir(t.TempDir()))
+	require.ErrorContains(t, err, "both ColdStorageDir and RemoteTableStore")
+}
@@ -18,8 +18,7 @@ import (
 	"time"
 
 	"github.com/luxfi/age"
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/luxfi/zapdb/objstore"
 )
 
 // ReplicatorConfig configures encrypted streaming replication to S3.
@@ -33,6 +32,9 @@ type ReplicatorConfig struct {
 	UseSSL    bool
 	Path      string // S3 key prefix (e.g. "zapdb/node-0")
 
+	// Store overrides the S3 connection above, e.g. to wrap it with objstore.NewChaos.
+	Store objstore.Store
+
 	// Encryption (optional — if nil, backups are unencrypted).
 	AgeRecipient age.Recipient // age public key for encryption
 	AgeIdentity  age.Identity  // age private key for decryption (restore only)
@@ -69,14 +71,15 @@ func (c *ReplicatorConfig) maxPendingWrites() int {
 	return 16
 }
 
-// Replicator continuously streams incremental backups to S3, encrypted with age.
+// Replicator continuously streams incremental backups to an object store, S3 by default,
+// encrypted with age.
 type Replicator struct {
-	db   *DB
-	cfg  ReplicatorConfig
-	s3   *minio.Client
-	log  Logger
-	mu   sync.Mutex
-	stop context.CancelFunc
+	db    *DB
+	cfg   ReplicatorConfig
+	store objstore.Store
+	log   Logger
+	mu    sync.Mutex
+	stop  context.CancelFunc
 
 	sinceVersion uint64
 	lastSnapshot time.Time
@@ -84,13 +87,20 @@ type Replicator struct {
 
 // NewReplicator creates a Replicator. Call Start to begin replication.
 func NewReplicator(db *DB, cfg ReplicatorConfig) (*Replicator, error) {
-	s3, err := minio.New(cfg.Endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
-		Region: cfg.Region,
-		Secure: cfg.UseSSL,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("replicate: s3 client: %w", err)
+	store := cfg.Store
+	if store == nil {
+		var err error
+		store, err = objstore.NewS3(objstore.S3Config{
+			Bucket:    cfg.Bucket,
+			Endpoint:  cfg.Endpoint,
+			Region:    cfg.Region,
+			AccessKey: cfg.AccessKey,
+			SecretKey: cfg.SecretKey,
+			UseSSL:    cfg.UseSSL,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("replicate: %w", err)
+		}
 	}
 
 	log := cfg.Logger
@@ -99,10 +109,10 @@ func NewReplicator(db *DB, cfg ReplicatorConfig) (*Replicator, error) {
 	}
 
 	return &Replicator{
-		db:  db,
-		cfg: cfg,
-		s3:  s3,
-		log: log,
+		db:    db,
+		cfg:   cfg,
+		store: store,
+		log:   log,
 	}, nil
 }
 
@@ -169,10 +179,7 @@ func (r *Replicator) Incremental(ctx context.Context) error {
 	}
 
 	key := r.incKey(maxVersion)
-	_, err = r.s3.PutObject(ctx, r.cfg.Bucket, key, body, size, minio.PutObjectOptions{
-		ContentType: "application/octet-stream",
-	})
-	if err != nil {
+	if err := r.store.Put(ctx, key, body, size); err != nil {
 		return fmt.Errorf("upload %s: %w", key, err)
 	}
 
@@ -209,10 +216,7 @@ func (r *Replicator) Snapshot(ctx context.Context) error {
 	}
 
 	key := r.snapKey(time.Now())
-	_, err = r.s3.PutObject(ctx, r.cfg.Bucket, key, body, size, minio.PutObjectOptions{
-		ContentType: "application/octet-stream",
-	})
-	if err != nil {
+	if err := r.store.Put(ctx, key, body, size); err != nil {
 		return fmt.Errorf("upload %s: %w", key, err)
 	}
 
@@ -232,15 +236,13 @@ func (r *Replicator) Restore(ctx context.Context) error {
 	// Find latest snapshot.
 	snapPrefix := path.Join(r.cfg.Path, "snap") + "/"
 	latestSnap := ""
-	for obj := range r.s3.ListObjects(ctx, r.cfg.Bucket, minio.ListObjectsOptions{
-		Prefix:    snapPrefix,
-		Recursive: true,
-	}) {
-		if obj.Err != nil {
-			return fmt.Errorf("list snapshots: %w", obj.Err)
-		}
-		if obj.Key > latestSnap {
-			latestSnap = obj.Key
+	snaps, err := r.store.List(ctx, snapPrefix)
+	if err != nil {
+		return fmt.Errorf("list snapshots: %w", err)
+	}
+	for _, key := range snaps {
+		if key > latestSnap {
+			latestSnap = key
 		}
 	}
 
@@ -263,16 +265,14 @@ func (r *Replicator) Restore(ctx context.Context) error {
 		version uint64
 	}
 	var incs []incEntry
-	for obj := range r.s3.ListObjects(ctx, r.cfg.Bucket, minio.ListObjectsOptions{
-		Prefix:    incPrefix,
-		Recursive: true,
-	}) {
-		if obj.Err != nil {
-			return fmt.Errorf("list incrementals: %w", obj.Err)
-		}
-		v := versionFromKey(obj.Key)
+	incKeys, err := r.store.List(ctx, incPrefix)
+	if err != nil {
+		return fmt.Errorf("list incrementals: %w", err)
+	}
+	for _, key := range incKeys {
+		v := versionFromKey(key)
 		if v > snapVersion {
-			incs = append(incs, incEntry{key: obj.Key, version: v})
+			incs = append(incs, incEntry{key: key, version: v})
 		}
 	}
 
@@ -291,7 +291,7 @@ func (r *Replicator) Restore(ctx context.Context) error {
 }
 
 func (r *Replicator) downloadAndLoad(ctx context.Context, key string) error {
-	obj, err := r.s3.GetObject(ctx, r.cfg.Bucket, key, minio.GetObjectOptions{})
+	obj, err := r.store.Get(ctx, key)
 	if err != nil {
 		return fmt.Errorf("get %s: %w", key, err)
 	}
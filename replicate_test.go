@@ -7,12 +7,14 @@ package badger
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"testing"
 
 	"github.com/luxfi/age"
+	"github.com/luxfi/zapdb/objstore"
 	"github.com/stretchr/testify/require"
 )
 
@@ -424,3 +426,47 @@ func TestReplicateE2E(t *testing.T) {
 	t.Logf("All 150 keys verified, including overwrite of user:000000")
 	require.NoError(t, dst.Close())
 }
+
+// TestReplicatorObjectStore tests incremental replication and restore through an object store
+// which fails intermittently.
+func TestReplicatorObjectStore(t *testing.T) {
+	store := objstore.NewMemory()
+	chaos := objstore.NewChaos(store, objstore.ChaosConfig{ErrorRate: 1}, 1)
+
+	opt := DefaultOptions("").WithInMemory(true)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	r, err := NewReplicator(db, ReplicatorConfig{Path: "node-0", Store: chaos})
+	require.NoError(t, err)
+
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.Set([]byte("key1"), []byte("value1"))
+	}))
+	ctx := context.Background()
+	require.ErrorIs(t, r.Incremental(ctx), objstore.ErrInjected)
+	require.Zero(t, r.sinceVersion)
+
+	// Once the store recovers, the failed upload is retried by the next incremental.
+	chaos.SetConfig(objstore.ChaosConfig{})
+	require.NoError(t, r.Incremental(ctx))
+	keys, err := store.List(ctx, "node-0/inc/")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+
+	db2, err := Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db2.Close()) }()
+	r2, err := NewReplicator(db2, ReplicatorConfig{Path: "node-0", Store: store})
+	require.NoError(t, err)
+	require.NoError(t, r2.Restore(ctx))
+	require.NoError(t, db2.View(func(txn *Txn) error {
+		item, err := txn.Get([]byte("key1"))
+		require.NoError(t, err)
+		return item.Value(func(val []byte) error {
+			require.Equal(t, []byte("value1"), val)
+			return nil
+		})
+	}))
+}
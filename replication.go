@@ -0,0 +1,319 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+
+	"github.com/luxfi/zapdb/pb"
+)
+
+// replicationKey is the key a follower writes at the version of the leader it's consistent up
+// to, after applying the writes up to it.
+var replicationKey = []byte("!badger!replication")
+
+// replicationRetryInterval is how long Follow waits to connect to the leader again once the
+// replication stops.
+const replicationRetryInterval = time.Second
+
+// replicationHeartbeatInterval is how often the leader ends the writes up to its current version
+// even if there are none, so that the followers can tell how far behind they are.
+var replicationHeartbeatInterval = time.Second
+
+// ServeReplication ships the committed writes of the DB to the followers connecting on ln, which
+// may be a TLS listener, until ctx is done or ln fails. A follower is sent the versions written
+// since the last version it applied, all of the DB if none, as a stream of the keys like Backup,
+// then the new commits as they are made.
+//
+// The writes are sent as KVLists, each framed by its size like the lists of Backup. A list of a
+// single KV with StreamDone set ends the writes up to its version, which the follower can then
+// serve reads at, and has the time of the leader at that version in its Value, as 8 bytes in big
+// endian of unix nanoseconds. It's also sent every second without new writes. A follower resumes
+// from the last such version after a reconnect or a restart, so the versions since then must be
+// kept, see Changefeed.
+//
+// ServeReplication can't be used in managed mode.
+func (db *DB) ServeReplication(ctx context.Context, ln net.Listener) error {
+	if db.opt.managedTxns {
+		return ErrManagedTxn
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() { ln.Close() })
+	defer stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			stop := context.AfterFunc(ctx, func() { conn.Close() })
+			defer stop()
+			if err := db.serveFollower(ctx, conn); err != nil && ctx.Err() == nil {
+				db.opt.Warningf("Replication to %s stopped: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// serveFollower ships the writes to the follower on conn, from the version it sends.
+func (db *DB) serveFollower(ctx context.Context, conn net.Conn) error {
+	var since uint64
+	if err := binary.Read(conn, binary.LittleEndian, &since); err != nil {
+		return err
+	}
+
+	// The subscriber wakes the replication up once the DB is written to.
+	c := z.NewCloser(1)
+	s, err := db.pub.newSubscriber(c, []pb.Match{{}})
+	if err != nil {
+		return err
+	}
+	drain := func() {
+		for {
+			select {
+			case _, ok := <-s.sendCh:
+				if !ok {
+					return
+				}
+			default:
+				return
+			}
+		}
+	}
+	stop := func() {
+		c.Done()
+		s.active.Store(0)
+		drain()
+		db.pub.deleteSubscriber(s.id)
+	}
+
+	ticker := time.NewTicker(replicationHeartbeatInterval)
+	defer ticker.Stop()
+	w := bufio.NewWriter(conn)
+	for {
+		// The commits written while shipping are shipped by the next pass.
+		drain()
+		if since, err = db.shipChanges(ctx, w, since); err != nil {
+			stop()
+			return err
+		}
+		select {
+		case <-c.HasBeenClosed():
+			// The subscriber is deleted by cleanSubscribers.
+			c.Done()
+			return nil
+		case <-ctx.Done():
+			stop()
+			return ctx.Err()
+		case <-s.sendCh:
+		case <-ticker.C:
+		}
+	}
+}
+
+// shipChanges writes the versions committed after since to w, followed by the end of the writes
+// up to the version they were read at, which it returns.
+func (db *DB) shipChanges(ctx context.Context, w *bufio.Writer, since uint64) (uint64, error) {
+	// The read keeps the versions at readTs from being discarded by compactions meanwhile.
+	txn := db.NewTransaction(false)
+	defer txn.Discard()
+	now := time.Now()
+	if txn.readTs <= since {
+		return since, db.shipDone(w, since, now)
+	}
+
+	stream := db.NewStream()
+	stream.LogPrefix = "DB.ServeReplication"
+	stream.readTs = txn.readTs
+	stream.SinceTs = since
+	var maxVersion uint64
+	stream.setupBackup(w, since, &maxVersion, nil)
+	if err := stream.Orchestrate(ctx); err != nil {
+		return since, err
+	}
+	return txn.readTs, db.shipDone(w, txn.readTs, now)
+}
+
+// shipDone writes the end of the writes up to version, read at now, to w and flushes it.
+func (db *DB) shipDone(w *bufio.Writer, version uint64, now time.Time) error {
+	var at [8]byte
+	binary.BigEndian.PutUint64(at[:], uint64(now.UnixNano()))
+	done := &pb.KVList{Kv: []*pb.KV{{Version: version, Value: at[:], StreamDone: true}}}
+	if err := writeTo(done, w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// Follow replicates into the DB the writes of the leader serving ServeReplication at addr, over
+// TLS if tlsConfig is set. The writes are applied at the versions of the leader, and the reads
+// of the DB see the writes up to the last version the leader ended, so that they are consistent.
+// Follow connects to the leader again when the replication stops, and blocks until ctx is done or
+// the DB is closed.
+//
+// The DB must be opened with Options.Follower, so that only the writes of the leader change it.
+// To bootstrap a follower, open it on an empty directory: the leader sends it all of its keys.
+func (db *DB) Follow(ctx context.Context, addr string, tlsConfig *tls.Config) error {
+	if !db.opt.Follower {
+		return ErrNotFollower
+	}
+	for {
+		err := db.followOnce(ctx, addr, tlsConfig)
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case db.IsClosed():
+			return ErrDBClosed
+		}
+		db.opt.Warningf("Replication from %s stopped: %v. Retrying in %s", addr, err,
+			replicationRetryInterval)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(replicationRetryInterval):
+		}
+	}
+}
+
+// followOnce connects to the leader at addr and applies its writes until the connection fails.
+func (db *DB) followOnce(ctx context.Context, addr string, tlsConfig *tls.Config) error {
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		d := tls.Dialer{Config: tlsConfig}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	since, err := db.ReplicatedVersion()
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(conn, binary.LittleEndian, since); err != nil {
+		return err
+	}
+	return db.applyReplication(bufio.NewReaderSize(conn, 16<<10), since)
+}
+
+// applyReplication writes the lists shipped by the leader read from r, until r fails. since is
+// the version of the leader the DB is consistent up to.
+func (db *DB) applyReplication(r *bufio.Reader, since uint64) error {
+	unmarshalBuf := make([]byte, 1<<10)
+	ldr := db.NewKVLoader(16)
+	for {
+		var sz uint64
+		if err := binary.Read(r, binary.LittleEndian, &sz); err != nil {
+			return err
+		}
+		if cap(unmarshalBuf) < int(sz) {
+			unmarshalBuf = make([]byte, sz)
+		}
+		if _, err := io.ReadFull(r, unmarshalBuf[:sz]); err != nil {
+			return err
+		}
+		list := &pb.KVList{}
+		if err := unmarshalBackupList(unmarshalBuf[:sz], list); err != nil {
+			return err
+		}
+
+		for _, kv := range list.Kv {
+			if !kv.StreamDone {
+				if err := ldr.Set(kv); err != nil {
+					return err
+				}
+				continue
+			}
+			if kv.Version > since {
+				// The writes up to kv.Version are all applied once the version is recorded.
+				if err := ldr.Set(&pb.KV{Key: replicationKey, Version: kv.Version}); err != nil {
+					return err
+				}
+				if err := ldr.Finish(); err != nil {
+					return err
+				}
+				db.orc.advanceTo(kv.Version)
+				ldr = db.NewKVLoader(16)
+				since = kv.Version
+			}
+			if len(kv.Value) == 8 {
+				db.replicatedAt.Store(int64(binary.BigEndian.Uint64(kv.Value)))
+			}
+		}
+	}
+}
+
+// advanceTo makes the versions up to version readable, like after their commits.
+func (o *oracle) advanceTo(version uint64) {
+	o.Lock()
+	advance := version >= o.nextTxnTs
+	if advance {
+		o.nextTxnTs = version + 1
+	}
+	o.Unlock()
+	if advance {
+		o.txnMark.Done(version)
+	}
+}
+
+// ReplicatedVersion returns the version of the leader the DB, a follower, is consistent up to,
+// or 0 if it hasn't replicated any writes yet.
+func (db *DB) ReplicatedVersion() (uint64, error) {
+	if db.IsClosed() {
+		return 0, ErrDBClosed
+	}
+	var version uint64
+	err := db.View(func(txn *Txn) error {
+		item, err := txn.Get(replicationKey)
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		version = item.Version()
+		return nil
+	})
+	return version, err
+}
+
+// ReplicationLag returns how far behind the leader the reads of the DB, a follower, are: the time
+// since the leader was at the last version applied, or zero if none was applied since the DB was
+// opened. It keeps growing while the leader is unreachable. It's measured with the clocks of
+// both, so it's off by their skew.
+func (db *DB) ReplicationLag() time.Duration {
+	return db.replicationLag(time.Now())
+}
+
+func (db *DB) replicationLag(now time.Time) time.Duration {
+	return sinceNanos(now, db.replicatedAt.Load())
+}
@@ -0,0 +1,134 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplication(t *testing.T) {
+	leader, err := Open(getTestOptions(t.TempDir()))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, leader.Close()) }()
+
+	set := func(key, val string) {
+		require.NoError(t, leader.Update(func(txn *Txn) error {
+			return txn.Set([]byte(key), []byte(val))
+		}))
+	}
+	for i := range 100 {
+		set(fmt.Sprintf("key%03d", i), "v1")
+	}
+	require.NoError(t, leader.Update(func(txn *Txn) error {
+		return txn.Delete([]byte("key000"))
+	}))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error)
+	go func() { served <- leader.ServeReplication(ctx, ln) }()
+
+	followerOpt := getTestOptions(t.TempDir()).WithFollower(true)
+	follower, err := Open(followerOpt)
+	require.NoError(t, err)
+	follow := func() (context.CancelFunc, chan error) {
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+		go func() { done <- follower.Follow(ctx, ln.Addr().String(), nil) }()
+		return cancel, done
+	}
+	// caughtUp waits for the follower to have the version of key on the leader.
+	caughtUp := func(key string) {
+		var want uint64
+		require.NoError(t, leader.View(func(txn *Txn) error {
+			item, err := txn.Get([]byte(key))
+			want = item.Version()
+			return err
+		}))
+		require.Eventually(t, func() bool {
+			var got uint64
+			err := follower.View(func(txn *Txn) error {
+				item, err := txn.Get([]byte(key))
+				if err == nil {
+					got = item.Version()
+				}
+				return err
+			})
+			return err == nil && got == want
+		}, 10*time.Second, 10*time.Millisecond)
+	}
+	get := func(key string) (string, error) {
+		var val []byte
+		err := follower.View(func(txn *Txn) error {
+			item, err := txn.Get([]byte(key))
+			if err != nil {
+				return err
+			}
+			val, err = item.ValueCopy(nil)
+			return err
+		})
+		return string(val), err
+	}
+
+	// The follower is bootstrapped with the keys of the leader, then follows its new commits.
+	stopFollow, followed := follow()
+	caughtUp("key099")
+	_, err = get("key000")
+	require.ErrorIs(t, err, ErrKeyNotFound)
+	set("key001", "v2")
+	caughtUp("key001")
+	val, err := get("key001")
+	require.NoError(t, err)
+	require.Equal(t, "v2", val)
+
+	// The heartbeats of the leader keep the lag of the follower low without new writes.
+	require.Eventually(t, func() bool {
+		lag := follower.ReplicationLag()
+		return lag > 0 && lag < time.Second
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Zero(t, leader.ReplicationLag())
+
+	// Only the leader writes to the follower.
+	err = follower.Update(func(txn *Txn) error {
+		return txn.Set([]byte("key002"), []byte("v2"))
+	})
+	require.ErrorIs(t, err, ErrFollower)
+	require.ErrorIs(t, leader.Follow(ctx, ln.Addr().String(), nil), ErrNotFollower)
+
+	// The follower resumes from the version it's consistent up to after a restart.
+	stopFollow()
+	require.ErrorIs(t, <-followed, context.Canceled)
+	version, err := follower.ReplicatedVersion()
+	require.NoError(t, err)
+	require.NotZero(t, version)
+	require.NoError(t, follower.Close())
+	set("key002", "v2")
+
+	follower, err = Open(followerOpt)
+	require.NoError(t, err)
+	got, err := follower.ReplicatedVersion()
+	require.NoError(t, err)
+	require.Equal(t, version, got)
+	stopFollow, followed = follow()
+	caughtUp("key002")
+	val, err = get("key002")
+	require.NoError(t, err)
+	require.Equal(t, "v2", val)
+
+	stopFollow()
+	require.ErrorIs(t, <-followed, context.Canceled)
+	require.NoError(t, follower.Close())
+	cancel()
+	require.ErrorIs(t, <-served, context.Canceled)
+}
@@ -0,0 +1,89 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import "errors"
+
+// RuntimeOptions are the options which can be changed while the DB is open, by SetRuntimeOptions.
+// They mean what the fields of Options of the same names do, and are reset to those at the next
+// Open.
+type RuntimeOptions struct {
+	// NumCompactors is the number of compaction workers. When lowered, the workers above finish
+	// their compactions and wait; when raised, new workers are started. Zero pauses the
+	// compactions, and one isn't allowed, like for Open.
+	NumCompactors int
+	// BlockCacheSize and IndexCacheSize are the sizes of the caches. They can't be turned on or
+	// off, and can't be changed for the caches shared by a Manager, or for Options.BlockCache.
+	BlockCacheSize int64
+	IndexCacheSize int64
+	// ValueLogGCPolicy is the policy of the value log GC scheduler, which can't be turned on or
+	// off by its Interval.
+	ValueLogGCPolicy ValueLogGCPolicy
+}
+
+// runtimeOptions returns the RuntimeOptions of opt.
+func (opt *Options) runtimeOptions() *RuntimeOptions {
+	return &RuntimeOptions{
+		NumCompactors:    opt.NumCompactors,
+		BlockCacheSize:   opt.BlockCacheSize,
+		IndexCacheSize:   opt.IndexCacheSize,
+		ValueLogGCPolicy: opt.ValueLogGCPolicy,
+	}
+}
+
+// SetRuntimeOptions changes the RuntimeOptions of the DB, so that the compactions, the caches and
+// the value log GC can be tuned without reopening it. The compactions running keep going, and the
+// caches evict their entries above their new sizes as they're used. The other options of the DB
+// are as of Open; CurrentOptions returns them all.
+func (db *DB) SetRuntimeOptions(ro RuntimeOptions) error {
+	db.runtimeLock.Lock()
+	defer db.runtimeLock.Unlock()
+	cur := db.runtime.Load()
+	p := ro.ValueLogGCPolicy
+	switch {
+	case ro.NumCompactors < 0 || ro.NumCompactors == 1:
+		return errors.New("Invalid NumCompactors, must be 0 or at least 2")
+	case ro.BlockCacheSize < 0 || ro.IndexCacheSize < 0:
+		return errors.New("Invalid cache size, must not be negative")
+	case p.DiscardRatio < 0 || p.DiscardRatio >= 1:
+		return errors.New("Invalid ValueLogGCPolicy.DiscardRatio, must be within range of [0, 1)")
+	case p.Interval < 0 || p.MinDiscardBytes < 0 || p.MaxFilesPerRun < 0:
+		return errors.New("Invalid ValueLogGCPolicy, must not be negative")
+	case (p.Interval > 0) != (cur.ValueLogGCPolicy.Interval > 0):
+		return errors.New("The value log GC scheduler can't be turned on or off while the DB is open")
+	}
+	if ro.BlockCacheSize != cur.BlockCacheSize || ro.IndexCacheSize != cur.IndexCacheSize {
+		switch {
+		case db.opt.manager != nil:
+			return errors.New("Cannot resize the caches shared by a Manager")
+		case ro.BlockCacheSize != cur.BlockCacheSize && db.opt.BlockCache != nil:
+			return errors.New("Cannot resize Options.BlockCache")
+		case ro.BlockCacheSize != cur.BlockCacheSize && (db.blockCache == nil || ro.BlockCacheSize == 0),
+			ro.IndexCacheSize != cur.IndexCacheSize && (db.indexCache == nil || ro.IndexCacheSize == 0):
+			return errors.New("The caches can't be turned on or off while the DB is open")
+		}
+	}
+
+	if ro.BlockCacheSize != cur.BlockCacheSize {
+		db.blockCache.UpdateMaxCost(ro.BlockCacheSize)
+	}
+	if ro.IndexCacheSize != cur.IndexCacheSize {
+		db.indexCache.UpdateMaxCost(ro.IndexCacheSize)
+	}
+	db.runtime.Store(&ro)
+	db.lc.addCompactors(ro.NumCompactors)
+	return nil
+}
+
+// CurrentOptions returns a copy of the options of the DB, with the RuntimeOptions last set.
+func (db *DB) CurrentOptions() Options {
+	opt := db.opt
+	ro := db.runtime.Load()
+	opt.NumCompactors = ro.NumCompactors
+	opt.BlockCacheSize, opt.IndexCacheSize = ro.BlockCacheSize, ro.IndexCacheSize
+	opt.ValueLogGCPolicy = ro.ValueLogGCPolicy
+	return opt
+}
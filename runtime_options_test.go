@@ -0,0 +1,72 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetRuntimeOptions(t *testing.T) {
+	opt := getTestOptions(t.TempDir()).WithNumCompactors(2).WithBlockCacheSize(1 << 20).
+		WithIndexCacheSize(2 << 20).WithValueLogGCPolicy(ValueLogGCPolicy{Interval: time.Hour})
+	db, err := Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	running := func() int {
+		db.lc.compactors.Lock()
+		defer db.lc.compactors.Unlock()
+		return db.lc.compactors.running
+	}
+	require.Equal(t, 2, running())
+
+	ro := RuntimeOptions{
+		NumCompactors:  4,
+		BlockCacheSize: 4 << 20,
+		IndexCacheSize: 8 << 20,
+		ValueLogGCPolicy: ValueLogGCPolicy{
+			Interval: time.Minute, DiscardRatio: 0.3, MinDiscardBytes: 1 << 10, MaxFilesPerRun: 2},
+	}
+	require.NoError(t, db.SetRuntimeOptions(ro))
+	require.Equal(t, 4, running())
+	cost, err := db.CacheMaxCost(BlockCache, -1)
+	require.NoError(t, err)
+	require.Equal(t, int64(4<<20), cost)
+	cost, err = db.CacheMaxCost(IndexCache, -1)
+	require.NoError(t, err)
+	require.Equal(t, int64(8<<20), cost)
+
+	cur := db.CurrentOptions()
+	require.Equal(t, 4, cur.NumCompactors)
+	require.Equal(t, int64(4<<20), cur.BlockCacheSize)
+	require.Equal(t, int64(8<<20), cur.IndexCacheSize)
+	require.Equal(t, ro.ValueLogGCPolicy, cur.ValueLogGCPolicy)
+	require.Equal(t, opt.Dir, cur.Dir)
+	require.Equal(t, 2, db.Opts().NumCompactors)
+
+	// The workers above the new number wait, and aren't stopped.
+	ro.NumCompactors = 0
+	require.NoError(t, db.SetRuntimeOptions(ro))
+	require.Equal(t, 4, running())
+	require.NoError(t, db.Update(func(txn *Txn) error { return txn.Set([]byte("key"), []byte("val")) }))
+
+	for _, bad := range []func(ro *RuntimeOptions){
+		func(ro *RuntimeOptions) { ro.NumCompactors = 1 },
+		func(ro *RuntimeOptions) { ro.BlockCacheSize = -1 },
+		func(ro *RuntimeOptions) { ro.BlockCacheSize = 0 },
+		func(ro *RuntimeOptions) { ro.IndexCacheSize = 0 },
+		func(ro *RuntimeOptions) { ro.ValueLogGCPolicy.DiscardRatio = 1 },
+		func(ro *RuntimeOptions) { ro.ValueLogGCPolicy.Interval = 0 },
+	} {
+		bro := ro
+		bad(&bro)
+		require.Error(t, db.SetRuntimeOptions(bro))
+	}
+	require.Equal(t, ro, *db.runtime.Load())
+}
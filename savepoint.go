@@ -0,0 +1,118 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"slices"
+)
+
+// savepoint is the state of the pending writes of a transaction at Txn.Savepoint.
+type savepoint struct {
+	// undo is the length of the undo log of the transaction at the savepoint.
+	undo                int
+	rangeDels           int
+	count, size, memory int64
+}
+
+// Savepoint marks the pending writes of the transaction, so that RollbackToSavepoint can undo
+// those made since, without discarding the transaction. It returns the ID of the savepoint.
+// Savepoints nest: rolling back to one drops the savepoints taken after it.
+//
+// While the transaction has savepoints, its writes keep what they overwrite in memory, until it
+// ends or ReleaseSavepoint drops them.
+func (txn *Txn) Savepoint() (int, error) {
+	switch {
+	case !txn.update:
+		return 0, ErrReadOnlyTxn
+	case txn.discarded:
+		return 0, ErrDiscardedTxn
+	case txn.prepared != nil:
+		return 0, ErrTxnPrepared
+	}
+	txn.savepoints = append(txn.savepoints, savepoint{
+		undo:      len(txn.undo),
+		rangeDels: len(txn.rangeDels),
+		count:     txn.count,
+		size:      txn.size,
+		memory:    txn.memory,
+	})
+	return len(txn.savepoints), nil
+}
+
+// RollbackToSavepoint undoes the writes made since the savepoint id, returned by Savepoint, and
+// drops the savepoints taken after it. The savepoint itself is kept, so that it can be rolled
+// back to again. The keys written since are still checked for conflicts on commit. It returns
+// ErrSavepointNotFound if there is no savepoint id.
+func (txn *Txn) RollbackToSavepoint(id int) error {
+	switch {
+	case txn.discarded:
+		return ErrDiscardedTxn
+	case txn.prepared != nil:
+		return ErrTxnPrepared
+	case id <= 0 || id > len(txn.savepoints):
+		return ErrSavepointNotFound
+	}
+	sp := txn.savepoints[id-1]
+	for i := len(txn.undo) - 1; i >= sp.undo; i-- {
+		txn.undo[i]()
+	}
+	txn.undo = txn.undo[:sp.undo]
+	txn.rangeDels = txn.rangeDels[:sp.rangeDels]
+	txn.count, txn.size, txn.memory = sp.count, sp.size, sp.memory
+	txn.savepoints = txn.savepoints[:id]
+	return nil
+}
+
+// ReleaseSavepoint drops the savepoint id, and those taken after it, keeping the writes made
+// since. It returns ErrSavepointNotFound if there is no savepoint id.
+func (txn *Txn) ReleaseSavepoint(id int) error {
+	if id <= 0 || id > len(txn.savepoints) {
+		return ErrSavepointNotFound
+	}
+	txn.savepoints = txn.savepoints[:id-1]
+	if len(txn.savepoints) == 0 {
+		txn.undo = nil
+	}
+	return nil
+}
+
+// setPending sets the pending write of the key of e, logging how to undo it if the transaction
+// has savepoints.
+func (txn *Txn) setPending(e *Entry) {
+	if len(txn.savepoints) > 0 {
+		key := string(e.Key)
+		old, ok := txn.pendingWrites[key]
+		txn.undo = append(txn.undo, func() {
+			if ok {
+				txn.pendingWrites[key] = old
+			} else {
+				delete(txn.pendingWrites, key)
+			}
+		})
+	}
+	txn.pendingWrites[string(e.Key)] = e
+}
+
+// deletePending removes the pending write of key, logging how to undo it if the transaction has
+// savepoints.
+func (txn *Txn) deletePending(key string) {
+	if len(txn.savepoints) > 0 {
+		if old, ok := txn.pendingWrites[key]; ok {
+			txn.undo = append(txn.undo, func() { txn.pendingWrites[key] = old })
+		}
+	}
+	delete(txn.pendingWrites, key)
+}
+
+// setDuplicates replaces the duplicate writes, logging how to undo it if the transaction has
+// savepoints.
+func (txn *Txn) setDuplicates(dups []*Entry) {
+	if len(txn.savepoints) > 0 {
+		old := slices.Clone(txn.duplicateWrites)
+		txn.undo = append(txn.undo, func() { txn.duplicateWrites = old })
+	}
+	txn.duplicateWrites = dups
+}
@@ -0,0 +1,83 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSavepoint(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Set([]byte("c"), []byte("committed"))
+		}))
+
+		txn := db.NewTransaction(true)
+		defer txn.Discard()
+		get := func(key string) string {
+			item, err := txn.Get([]byte(key))
+			if err == ErrKeyNotFound {
+				return ""
+			}
+			require.NoError(t, err)
+			val, err := item.ValueCopy(nil)
+			require.NoError(t, err)
+			return string(val)
+		}
+
+		require.NoError(t, txn.Set([]byte("a"), []byte("1")))
+		count := txn.count
+		sp, err := txn.Savepoint()
+		require.NoError(t, err)
+		require.NoError(t, txn.Set([]byte("a"), []byte("2")))
+		require.NoError(t, txn.Set([]byte("b"), []byte("2")))
+		require.NoError(t, txn.Delete([]byte("c")))
+		inner, err := txn.Savepoint()
+		require.NoError(t, err)
+		require.NoError(t, txn.DeleteRange([]byte("a"), []byte("z")))
+		require.Equal(t, "", get("a"))
+
+		// Rolling back to the inner savepoint undoes the range delete only.
+		require.NoError(t, txn.RollbackToSavepoint(inner))
+		require.Equal(t, "2", get("a"))
+		require.Equal(t, "2", get("b"))
+		require.Equal(t, "", get("c"))
+
+		require.NoError(t, txn.RollbackToSavepoint(sp))
+		require.Equal(t, "1", get("a"))
+		require.Equal(t, "", get("b"))
+		require.Equal(t, "committed", get("c"))
+		require.Equal(t, count, txn.count)
+		require.ErrorIs(t, txn.RollbackToSavepoint(inner), ErrSavepointNotFound)
+
+		// The savepoint is kept after a rollback.
+		require.NoError(t, txn.Set([]byte("d"), []byte("4")))
+		require.NoError(t, txn.RollbackToSavepoint(sp))
+		require.Equal(t, "", get("d"))
+		require.NoError(t, txn.ReleaseSavepoint(sp))
+		require.ErrorIs(t, txn.RollbackToSavepoint(sp), ErrSavepointNotFound)
+		require.NoError(t, txn.Set([]byte("e"), []byte("5")))
+		require.NoError(t, txn.Commit())
+
+		require.NoError(t, db.View(func(txn *Txn) error {
+			for key, want := range map[string]string{"a": "1", "b": "", "c": "committed",
+				"d": "", "e": "5"} {
+				item, err := txn.Get([]byte(key))
+				if want == "" {
+					require.ErrorIs(t, err, ErrKeyNotFound, key)
+					continue
+				}
+				require.NoError(t, err)
+				val, err := item.ValueCopy(nil)
+				require.NoError(t, err)
+				require.Equal(t, want, string(val), key)
+			}
+			return nil
+		}))
+	})
+}
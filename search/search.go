@@ -0,0 +1,401 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package search maintains an inverted index of text documents on top of a DB.
+//
+// Index.Put tokenizes a document with an Analyzer and writes a posting for every token, in the
+// caller's transaction, so the index always agrees with the data it is written along with.
+// Postings are stored under prefix + "p" + token + "\x00" + document ID, and the tokens of
+// every document under prefix + "t" + document ID, so that replacing or deleting a document
+// removes its old postings. Queries are built from Term, Prefix, And and Or, and return
+// document IDs in ascending order.
+package search
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strings"
+	"unicode"
+
+	badger "github.com/luxfi/zapdb"
+)
+
+// ErrInvalidToken is returned by Put if the analyzer produces an empty token, or one containing
+// a zero byte.
+var ErrInvalidToken = errors.New("search: invalid token")
+
+// Analyzer splits a document into the tokens it is indexed under.
+type Analyzer interface {
+	Tokens(text string) []string
+}
+
+// SimpleAnalyzer lowercases text and splits it on anything that isn't a letter or a digit.
+type SimpleAnalyzer struct{}
+
+// Tokens implements Analyzer.
+func (SimpleAnalyzer) Tokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Index is an inverted index stored under a key prefix of a DB.
+type Index struct {
+	prefix   []byte
+	analyzer Analyzer
+}
+
+// New returns an Index keeping its postings under prefix. A nil analyzer means SimpleAnalyzer.
+func New(prefix []byte, analyzer Analyzer) *Index {
+	if analyzer == nil {
+		analyzer = SimpleAnalyzer{}
+	}
+	return &Index{prefix: append([]byte{}, prefix...), analyzer: analyzer}
+}
+
+func (x *Index) key(tag byte, parts ...string) []byte {
+	key := append(append([]byte{}, x.prefix...), tag)
+	for i, p := range parts {
+		if i > 0 {
+			key = append(key, 0)
+		}
+		key = append(key, p...)
+	}
+	return key
+}
+
+func (x *Index) postingKey(token string, doc []byte) []byte {
+	return x.key('p', token, string(doc))
+}
+
+func encodeTokens(tokens []string) []byte {
+	var buf []byte
+	for _, t := range tokens {
+		buf = binary.AppendUvarint(buf, uint64(len(t)))
+		buf = append(buf, t...)
+	}
+	return buf
+}
+
+func decodeTokens(buf []byte) ([]string, error) {
+	var tokens []string
+	for len(buf) > 0 {
+		n, sz := binary.Uvarint(buf)
+		if sz <= 0 || uint64(len(buf)-sz) < n {
+			return nil, errors.New("search: corrupt token list")
+		}
+		tokens = append(tokens, string(buf[sz:sz+int(n)]))
+		buf = buf[sz+int(n):]
+	}
+	return tokens, nil
+}
+
+// tokens returns the sorted, distinct tokens of text.
+func (x *Index) tokens(text string) ([]string, error) {
+	tokens := x.analyzer.Tokens(text)
+	sort.Strings(tokens)
+	out := tokens[:0]
+	for i, t := range tokens {
+		if t == "" || strings.IndexByte(t, 0) >= 0 {
+			return nil, ErrInvalidToken
+		}
+		if i == 0 || t != tokens[i-1] {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// Put indexes text as the document doc, replacing an earlier version of it.
+func (x *Index) Put(txn *badger.Txn, doc []byte, text string) error {
+	tokens, err := x.tokens(text)
+	if err != nil {
+		return err
+	}
+	if err := x.Delete(txn, doc); err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		if err := txn.Set(x.postingKey(t, doc), nil); err != nil {
+			return err
+		}
+	}
+	return txn.Set(x.key('t', string(doc)), encodeTokens(tokens))
+}
+
+// Delete removes the document doc from the index. Deleting a missing document is not an error.
+func (x *Index) Delete(txn *badger.Txn, doc []byte) error {
+	item, err := txn.Get(x.key('t', string(doc)))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var tokens []string
+	if err := item.Value(func(val []byte) error {
+		tokens, err = decodeTokens(val)
+		return err
+	}); err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		if err := txn.Delete(x.postingKey(t, doc)); err != nil {
+			return err
+		}
+	}
+	return txn.Delete(x.key('t', string(doc)))
+}
+
+// Query selects documents. Build one with Term, Prefix, And, Or or Index.Match.
+type Query interface {
+	open(x *Index, txn *badger.Txn) cursor
+}
+
+// cursor walks document IDs in ascending order.
+type cursor interface {
+	valid() bool
+	doc() []byte
+	next()
+	// seek moves to the first document not less than doc.
+	seek(doc []byte)
+	close()
+}
+
+type termQuery string
+
+// Term matches documents containing token.
+func Term(token string) Query {
+	return termQuery(token)
+}
+
+func (q termQuery) open(x *Index, txn *badger.Txn) cursor {
+	opt := badger.IteratorOptions{Prefix: x.key('p', string(q), "")}
+	c := &termCursor{it: txn.NewIterator(opt), prefix: opt.Prefix}
+	c.it.Rewind()
+	return c
+}
+
+type termCursor struct {
+	it     *badger.Iterator
+	prefix []byte
+}
+
+func (c *termCursor) valid() bool   { return c.it.Valid() }
+func (c *termCursor) doc() []byte   { return c.it.Item().Key()[len(c.prefix):] }
+func (c *termCursor) next()         { c.it.Next() }
+func (c *termCursor) close()        { c.it.Close() }
+func (c *termCursor) seek(d []byte) { c.it.Seek(append(append([]byte{}, c.prefix...), d...)) }
+
+type prefixQuery string
+
+// Prefix matches documents containing a token starting with prefix.
+func Prefix(prefix string) Query {
+	return prefixQuery(prefix)
+}
+
+func (q prefixQuery) open(x *Index, txn *badger.Txn) cursor {
+	// Documents come out ordered by token first, so collect and sort them.
+	opt := badger.IteratorOptions{Prefix: x.key('p', string(q))}
+	it := txn.NewIterator(opt)
+	defer it.Close()
+	seen := make(map[string]struct{})
+	var docs [][]byte
+	for it.Rewind(); it.Valid(); it.Next() {
+		key := it.Item().Key()[len(x.prefix)+1:]
+		doc := key[bytes.IndexByte(key, 0)+1:]
+		if _, ok := seen[string(doc)]; !ok {
+			seen[string(doc)] = struct{}{}
+			docs = append(docs, append([]byte{}, doc...))
+		}
+	}
+	sort.Slice(docs, func(i, j int) bool { return bytes.Compare(docs[i], docs[j]) < 0 })
+	return &sliceCursor{docs: docs}
+}
+
+type sliceCursor struct {
+	docs [][]byte
+}
+
+func (c *sliceCursor) valid() bool { return len(c.docs) > 0 }
+func (c *sliceCursor) doc() []byte { return c.docs[0] }
+func (c *sliceCursor) next()       { c.docs = c.docs[1:] }
+func (c *sliceCursor) close()      {}
+func (c *sliceCursor) seek(d []byte) {
+	i := sort.Search(len(c.docs), func(i int) bool { return bytes.Compare(c.docs[i], d) >= 0 })
+	c.docs = c.docs[i:]
+}
+
+type andQuery []Query
+
+// And matches documents matched by all of qs.
+func And(qs ...Query) Query {
+	return andQuery(qs)
+}
+
+func (q andQuery) open(x *Index, txn *badger.Txn) cursor {
+	c := &andCursor{}
+	for _, sub := range q {
+		c.cs = append(c.cs, sub.open(x, txn))
+	}
+	c.align()
+	return c
+}
+
+type andCursor struct {
+	cs []cursor
+}
+
+// align advances the cursors until all of them are on the same document.
+func (c *andCursor) align() {
+	for c.valid() {
+		target := c.cs[0].doc()
+		for _, sub := range c.cs[1:] {
+			if bytes.Compare(sub.doc(), target) > 0 {
+				target = sub.doc()
+			}
+		}
+		target = append([]byte{}, target...)
+		done := true
+		for _, sub := range c.cs {
+			if !bytes.Equal(sub.doc(), target) {
+				sub.seek(target)
+				done = false
+				if !sub.valid() {
+					return
+				}
+			}
+		}
+		if done {
+			return
+		}
+	}
+}
+
+func (c *andCursor) valid() bool {
+	if len(c.cs) == 0 {
+		return false
+	}
+	for _, sub := range c.cs {
+		if !sub.valid() {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *andCursor) doc() []byte { return c.cs[0].doc() }
+
+func (c *andCursor) next() {
+	c.cs[0].next()
+	c.align()
+}
+
+func (c *andCursor) seek(d []byte) {
+	c.cs[0].seek(d)
+	c.align()
+}
+
+func (c *andCursor) close() {
+	for _, sub := range c.cs {
+		sub.close()
+	}
+}
+
+type orQuery []Query
+
+// Or matches documents matched by any of qs.
+func Or(qs ...Query) Query {
+	return orQuery(qs)
+}
+
+func (q orQuery) open(x *Index, txn *badger.Txn) cursor {
+	c := &orCursor{}
+	for _, sub := range q {
+		c.cs = append(c.cs, sub.open(x, txn))
+	}
+	return c
+}
+
+type orCursor struct {
+	cs []cursor
+}
+
+func (c *orCursor) valid() bool {
+	for _, sub := range c.cs {
+		if sub.valid() {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *orCursor) doc() []byte {
+	var lowest []byte
+	for _, sub := range c.cs {
+		if sub.valid() && (lowest == nil || bytes.Compare(sub.doc(), lowest) < 0) {
+			lowest = sub.doc()
+		}
+	}
+	return lowest
+}
+
+func (c *orCursor) next() {
+	cur := append([]byte{}, c.doc()...)
+	for _, sub := range c.cs {
+		if sub.valid() && bytes.Equal(sub.doc(), cur) {
+			sub.next()
+		}
+	}
+}
+
+func (c *orCursor) seek(d []byte) {
+	for _, sub := range c.cs {
+		if sub.valid() {
+			sub.seek(d)
+		}
+	}
+}
+
+func (c *orCursor) close() {
+	for _, sub := range c.cs {
+		sub.close()
+	}
+}
+
+// Match returns a query matching documents containing every token of text, as split by the
+// analyzer of the index.
+func (x *Index) Match(text string) Query {
+	var qs []Query
+	for _, t := range x.analyzer.Tokens(text) {
+		qs = append(qs, Term(t))
+	}
+	return And(qs...)
+}
+
+// Results iterates over the IDs of the documents matching a query. It must be closed.
+type Results struct {
+	c cursor
+}
+
+// Search returns the documents matching q, as of the snapshot of txn. A query opens an iterator
+// for every term, so txn must be read-only unless q is a single Term or Prefix.
+func (x *Index) Search(txn *badger.Txn, q Query) *Results {
+	return &Results{c: q.open(x, txn)}
+}
+
+// Valid returns false when iteration is done.
+func (r *Results) Valid() bool { return r.c.valid() }
+
+// Doc returns the ID of the current document. It is only valid until Next is called.
+func (r *Results) Doc() []byte { return r.c.doc() }
+
+// Next advances to the next document.
+func (r *Results) Next() { r.c.next() }
+
+// Close releases the iterators of the query.
+func (r *Results) Close() { r.c.close() }
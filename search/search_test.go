@@ -0,0 +1,79 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	badger "github.com/luxfi/zapdb"
+	"github.com/luxfi/zapdb/testkit"
+)
+
+func TestSearch(t *testing.T) {
+	db := testkit.OpenInMemory(t)
+
+	x := New([]byte("idx/"), nil)
+	docs := map[string]string{
+		"1": "The quick brown fox",
+		"2": "A quick, QUICK test of the index",
+		"3": "Brown bears and brownies",
+		"4": "Nothing to see here",
+	}
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		for id, text := range docs {
+			require.NoError(t, x.Put(txn, []byte(id), text))
+		}
+		return nil
+	}))
+
+	search := func(q Query) []string {
+		var ids []string
+		require.NoError(t, db.View(func(txn *badger.Txn) error {
+			r := x.Search(txn, q)
+			defer r.Close()
+			for ; r.Valid(); r.Next() {
+				ids = append(ids, string(r.Doc()))
+			}
+			return nil
+		}))
+		return ids
+	}
+
+	require.Equal(t, []string{"1", "2"}, search(Term("quick")))
+	require.Equal(t, []string{"1", "3"}, search(Term("brown")))
+	require.Equal(t, []string{"1"}, search(And(Term("quick"), Term("brown"))))
+	require.Equal(t, []string{"1"}, search(x.Match("Brown FOX")))
+	require.Equal(t, []string{"1", "2", "3"}, search(Or(Term("quick"), Term("brown"))))
+	require.Equal(t, []string{"1", "3"}, search(Prefix("brown")))
+	require.Equal(t, []string{"3"}, search(And(Prefix("bear"), Or(Term("fox"), Term("brownies")))))
+	require.Empty(t, search(Term("missing")))
+	require.Empty(t, search(And()))
+
+	// Replacing a document removes its old postings.
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		require.NoError(t, x.Put(txn, []byte("1"), "a slow red fox"))
+		return x.Delete(txn, []byte("3"))
+	}))
+	require.Equal(t, []string{"2"}, search(Term("quick")))
+	require.Empty(t, search(Prefix("brown")))
+	require.Equal(t, []string{"1"}, search(Term("fox")))
+}
+
+type invalidAnalyzer struct{}
+
+func (invalidAnalyzer) Tokens(string) []string { return []string{"a\x00b"} }
+
+func TestInvalidToken(t *testing.T) {
+	db := testkit.OpenInMemory(t)
+
+	x := New([]byte("idx/"), invalidAnalyzer{})
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		require.ErrorIs(t, x.Put(txn, []byte("1"), "text"), ErrInvalidToken)
+		return nil
+	}))
+}
@@ -0,0 +1,368 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"github.com/luxfi/zapdb/y"
+)
+
+// ShadowOptions are the options of a Shadow.
+type ShadowOptions struct {
+	// CompareReads has every Txn.Get of the primary DB read the key from the shadow DB as well,
+	// at the same read timestamp, and compare the results. It slows reads down.
+	CompareReads bool
+	// SampleRate is the fraction of the Gets compared when CompareReads is set, from 0 to 1. Zero
+	// means every Get.
+	SampleRate float64
+
+	// CompareOnly compares the reads without mirroring the writes. The shadow DB is then a
+	// candidate copy of the primary DB, such as a DB restored from its backup or converted to
+	// another format, and may be opened in ReadOnly mode. Keys written to the primary DB after the
+	// last version of the copy are skipped.
+	CompareOnly bool
+
+	// OnDivergence is called with every divergence found. It is called synchronously, by the
+	// reader that found it. If nil, divergences are logged as warnings of the primary DB.
+	OnDivergence func(Divergence)
+}
+
+// VersionedValue is a version of a key, as read by a Shadow.
+type VersionedValue struct {
+	Value     []byte
+	UserMeta  byte
+	Version   uint64
+	ExpiresAt uint64
+}
+
+// Divergence is a key read differently from the primary and shadow DBs.
+type Divergence struct {
+	Key    []byte
+	ReadTs uint64
+	// Primary and Shadow are the versions read from each DB, nil if the key wasn't found.
+	Primary, Shadow *VersionedValue
+}
+
+// ShadowStats are the counters of a Shadow.
+type ShadowStats struct {
+	// Mirrored is the number of batches, such as transactions, written to the shadow DB, and
+	// MirrorErrors the number of them which failed to be written.
+	Mirrored     int64
+	MirrorErrors int64
+	// Compared is the number of keys compared, Diverged the number of them which were read
+	// differently, and CompareErrors the number of comparisons which failed to read a key.
+	Compared      int64
+	Diverged      int64
+	CompareErrors int64
+	// Skipped is the number of keys not compared in CompareOnly mode, because they were written
+	// to the primary DB after the copy was made.
+	Skipped int64
+}
+
+// Shadow mirrors the writes to a primary DB to a shadow DB, opened with other options or by
+// another version, and compares what is read from both. It validates a migration under
+// production traffic, before cutting over to the new options.
+//
+// Writes are mirrored with their versions, by the writer of the primary DB, before the commits
+// return. The shadow DB should then start as a copy of the primary DB, such as a checkpoint of
+// it or a DB loaded from its backup, and must not be written to otherwise. Writes which don't
+// go through the write channel, like those of a StreamWriter, DropAll and DropPrefix, aren't
+// mirrored. A failure to mirror a write doesn't fail the write: it is logged and counted.
+//
+// With ShadowOptions.CompareOnly, a Shadow compares a sample of the reads with a candidate copy of
+// the primary DB, to gain confidence in an upgrade before moving reads to it, and writes aren't
+// mirrored.
+type Shadow struct {
+	primary, shadow *DB
+	opt             ShadowOptions
+	// maxVersion is the last version of the copy in CompareOnly mode.
+	maxVersion uint64
+
+	// mu keeps Stop from returning while writes are mirrored.
+	mu      sync.RWMutex
+	stopped bool
+
+	mirrored      atomic.Int64
+	mirrorErrors  atomic.Int64
+	compared      atomic.Int64
+	diverged      atomic.Int64
+	compareErrors atomic.Int64
+	skipped       atomic.Int64
+}
+
+// NewShadow starts mirroring the writes to primary to shadow, unless opt.CompareOnly is set. The
+// primary DB can have one Shadow at a time. Stop it before closing the shadow DB.
+func NewShadow(primary, shadow *DB, opt ShadowOptions) (*Shadow, error) {
+	switch {
+	case primary == shadow:
+		return nil, errors.New("Cannot shadow a DB with itself")
+	case opt.SampleRate < 0 || opt.SampleRate > 1:
+		return nil, errors.New("Shadow SampleRate must be between 0 and 1")
+	case !opt.CompareOnly && (primary.opt.ReadOnly || shadow.opt.ReadOnly):
+		return nil, errors.New("Cannot shadow a DB opened in ReadOnly mode")
+	}
+	s := &Shadow{primary: primary, shadow: shadow, opt: opt, maxVersion: math.MaxUint64}
+	if opt.CompareOnly {
+		s.maxVersion = shadow.MaxVersion()
+	}
+	if !primary.shadow.CompareAndSwap(nil, s) {
+		return nil, errors.New("DB is already shadowed")
+	}
+	return s, nil
+}
+
+// Stop stops mirroring the writes and comparing the reads. Once it returns, the shadow DB is no
+// longer written to, and can be closed.
+func (s *Shadow) Stop() {
+	s.primary.shadow.CompareAndSwap(s, nil)
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+}
+
+// Stats returns the counters of the Shadow.
+func (s *Shadow) Stats() ShadowStats {
+	return ShadowStats{
+		Mirrored:      s.mirrored.Load(),
+		MirrorErrors:  s.mirrorErrors.Load(),
+		Compared:      s.compared.Load(),
+		Diverged:      s.diverged.Load(),
+		CompareErrors: s.compareErrors.Load(),
+		Skipped:       s.skipped.Load(),
+	}
+}
+
+// mirror writes the entries of reqs, written to the primary DB, to the shadow DB. It is called by
+// the writer of the primary DB.
+func (s *Shadow) mirror(reqs []*request) {
+	if s.opt.CompareOnly {
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.stopped {
+		return
+	}
+	// A request is a transaction, so it is mirrored as one as well.
+	sent := make([]*request, 0, len(reqs))
+	for _, r := range reqs {
+		if len(r.Entries) == 0 {
+			continue
+		}
+		entries := make([]*Entry, len(r.Entries))
+		for i, e := range r.Entries {
+			entries[i] = &Entry{
+				Key:       e.Key,
+				Value:     e.Value,
+				ExpiresAt: e.ExpiresAt,
+				UserMeta:  e.UserMeta,
+				meta:      e.meta,
+			}
+		}
+		req, err := s.shadow.sendToWriteCh(entries)
+		if err != nil {
+			s.mirrorFailed(err)
+			continue
+		}
+		sent = append(sent, req)
+	}
+	for _, req := range sent {
+		if err := req.Wait(); err != nil {
+			s.mirrorFailed(err)
+			continue
+		}
+		s.mirrored.Add(1)
+	}
+}
+
+func (s *Shadow) mirrorFailed(err error) {
+	s.mirrorErrors.Add(1)
+	s.primary.opt.Errorf("Shadow: while mirroring writes: %v", err)
+}
+
+// shadowTxn returns a read-only transaction of the shadow DB at readTs.
+func (s *Shadow) shadowTxn(readTs uint64) *Txn {
+	txn := s.shadow.newTransaction(false, true)
+	txn.readTs = readTs
+	txn.doneRead = true // It isn't tracked by the oracle of the shadow DB.
+	return txn
+}
+
+// sampleRead returns whether to compare a Get.
+func (s *Shadow) sampleRead() bool {
+	return s.opt.CompareReads && (s.opt.SampleRate == 0 || rand.Float64() < s.opt.SampleRate)
+}
+
+// skip returns whether key, read as primary from the primary DB, was written after the copy was
+// made, in CompareOnly mode.
+func (s *Shadow) skip(key []byte, readTs uint64, primary *VersionedValue) (bool, error) {
+	if s.maxVersion == math.MaxUint64 {
+		return false, nil
+	}
+	version := uint64(0)
+	if primary != nil {
+		version = primary.Version
+	} else {
+		// The key may have been deleted or have expired since.
+		vs, err := s.primary.get(y.KeyWithTs(key, readTs))
+		if err != nil {
+			return false, err
+		}
+		version = vs.Version
+	}
+	if version <= s.maxVersion {
+		return false, nil
+	}
+	s.skipped.Add(1)
+	return true, nil
+}
+
+// compareGet compares the result of a Txn.Get of key on the primary DB with the shadow DB.
+func (s *Shadow) compareGet(key []byte, readTs uint64, item *Item, err error) {
+	if err != nil && err != ErrKeyNotFound {
+		return
+	}
+	primary, err := versionedValueOf(item)
+	if err != nil {
+		s.compareErrors.Add(1)
+		return
+	}
+	if skip, err := s.skip(key, readTs, primary); err != nil || skip {
+		if err != nil {
+			s.compareErrors.Add(1)
+		}
+		return
+	}
+	txn := s.shadowTxn(readTs)
+	defer txn.Discard()
+	sitem, err := txn.Get(key)
+	if err != nil && err != ErrKeyNotFound {
+		s.compareErrors.Add(1)
+		return
+	}
+	shadow, err := versionedValueOf(sitem)
+	if err != nil {
+		s.compareErrors.Add(1)
+		return
+	}
+	s.compare(key, readTs, primary, shadow)
+}
+
+// Verify compares every key of the primary DB, including those of column families, with the
+// shadow DB, at the current read timestamp. It returns the number of divergences found, which
+// are also reported like those of reads. It doesn't sample the keys.
+func (s *Shadow) Verify() (int, error) {
+	var n int
+	err := s.primary.View(func(txn *Txn) error {
+		stxn := s.shadowTxn(txn.readTs)
+		defer stxn.Discard()
+		opt := DefaultIteratorOptions
+		opt.columnFamilies = true
+		pit, sit := txn.NewIterator(opt), stxn.NewIterator(opt)
+		defer pit.Close()
+		defer sit.Close()
+
+		pit.Rewind()
+		sit.Rewind()
+		for pit.Valid() || sit.Valid() {
+			var pitem, sitem *Item
+			switch {
+			case !sit.Valid():
+				pitem = pit.Item()
+			case !pit.Valid():
+				sitem = sit.Item()
+			default:
+				switch c := bytes.Compare(pit.Item().Key(), sit.Item().Key()); {
+				case c < 0:
+					pitem = pit.Item()
+				case c > 0:
+					sitem = sit.Item()
+				default:
+					pitem, sitem = pit.Item(), sit.Item()
+				}
+			}
+			item := pitem
+			if item == nil {
+				item = sitem
+			}
+			key := item.KeyCopy(nil)
+			primary, err := versionedValueOf(pitem)
+			if err != nil {
+				return err
+			}
+			skip, err := s.skip(key, txn.readTs, primary)
+			if err != nil {
+				return err
+			}
+			if !skip {
+				shadow, err := versionedValueOf(sitem)
+				if err != nil {
+					return err
+				}
+				if !s.compare(key, txn.readTs, primary, shadow) {
+					n++
+				}
+			}
+			if pitem != nil {
+				pit.Next()
+			}
+			if sitem != nil {
+				sit.Next()
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+// compare counts a comparison, and reports a divergence if primary and shadow differ. It returns
+// whether they are the same.
+func (s *Shadow) compare(key []byte, readTs uint64, primary, shadow *VersionedValue) bool {
+	s.compared.Add(1)
+	if primary.equal(shadow) {
+		return true
+	}
+	s.diverged.Add(1)
+	d := Divergence{Key: key, ReadTs: readTs, Primary: primary, Shadow: shadow}
+	if s.opt.OnDivergence != nil {
+		s.opt.OnDivergence(d)
+	} else {
+		s.primary.opt.Warningf("Shadow: key %q diverged at %d: primary %+v, shadow %+v",
+			key, readTs, primary, shadow)
+	}
+	return false
+}
+
+// versionedValueOf returns the version read as item, or nil if item is nil.
+func versionedValueOf(item *Item) (*VersionedValue, error) {
+	if item == nil {
+		return nil, nil
+	}
+	val, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &VersionedValue{
+		Value:     val,
+		UserMeta:  item.UserMeta(),
+		Version:   item.Version(),
+		ExpiresAt: item.ExpiresAt(),
+	}, nil
+}
+
+func (v *VersionedValue) equal(o *VersionedValue) bool {
+	if v == nil || o == nil {
+		return v == o
+	}
+	return v.Version == o.Version && v.UserMeta == o.UserMeta && v.ExpiresAt == o.ExpiresAt &&
+		bytes.Equal(v.Value, o.Value)
+}
@@ -0,0 +1,187 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/options"
+)
+
+func TestShadow(t *testing.T) {
+	dir, err := os.MkdirTemp("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	primary, err := Open(getTestOptions(dir + "/primary"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, primary.Close()) }()
+	// The shadow DB has other options, as for a migration.
+	shadow, err := Open(getTestOptions(dir + "/shadow").
+		WithCompression(options.ZSTD).WithValueThreshold(16))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, shadow.Close()) }()
+
+	var mu sync.Mutex
+	var divergences []Divergence
+	s, err := NewShadow(primary, shadow, ShadowOptions{
+		CompareReads: true,
+		OnDivergence: func(d Divergence) {
+			mu.Lock()
+			defer mu.Unlock()
+			divergences = append(divergences, d)
+		},
+	})
+	require.NoError(t, err)
+	_, err = NewShadow(primary, shadow, ShadowOptions{})
+	require.Error(t, err)
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, primary.Update(func(txn *Txn) error {
+			key := []byte(fmt.Sprintf("key%03d", i))
+			return txn.SetEntry(NewEntry(key, []byte(fmt.Sprintf("a long enough value %d", i))).
+				WithMeta(byte(i)))
+		}))
+	}
+	require.NoError(t, primary.Update(func(txn *Txn) error {
+		require.NoError(t, txn.Delete([]byte("key000")))
+		return primary.ColumnFamily("state").Set(txn, []byte("key"), []byte("val"))
+	}))
+	wb := primary.NewWriteBatch()
+	require.NoError(t, wb.Set([]byte("batch"), []byte("val")))
+	require.NoError(t, wb.Flush())
+	require.Equal(t, int64(102), s.Stats().Mirrored)
+
+	// The reads of the primary DB are compared with the shadow DB.
+	require.NoError(t, primary.View(func(txn *Txn) error {
+		for _, key := range []string{"key000", "key001", "key099", "missing", "batch"} {
+			_, err := txn.Get([]byte(key))
+			if err != ErrKeyNotFound {
+				require.NoError(t, err)
+			}
+		}
+		return nil
+	}))
+	stats := s.Stats()
+	require.Equal(t, int64(5), stats.Compared)
+	require.Zero(t, stats.Diverged)
+	n, err := s.Verify()
+	require.NoError(t, err)
+	require.Zero(t, n)
+	require.Empty(t, divergences)
+
+	// DropPrefix isn't mirrored, so the shadow DB keeps the dropped keys.
+	require.NoError(t, primary.DropPrefix([]byte("key001")))
+	require.NoError(t, primary.Update(func(txn *Txn) error {
+		return txn.Set([]byte("key002"), []byte("new"))
+	}))
+	compared := s.Stats().Compared
+	require.NoError(t, primary.View(func(txn *Txn) error {
+		_, err := txn.Get([]byte("key002"))
+		return err
+	}))
+	require.Equal(t, compared+1, s.Stats().Compared)
+	require.Zero(t, s.Stats().Diverged)
+	n, err = s.Verify()
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Len(t, divergences, 1)
+	require.Equal(t, []byte("key001"), divergences[0].Key)
+	require.Nil(t, divergences[0].Primary)
+	require.Equal(t, []byte("a long enough value 1"), divergences[0].Shadow.Value)
+	require.Equal(t, byte(1), divergences[0].Shadow.UserMeta)
+
+	s.Stop()
+	require.NoError(t, primary.Update(func(txn *Txn) error {
+		return txn.Set([]byte("after"), []byte("val"))
+	}))
+	require.NoError(t, shadow.View(func(txn *Txn) error {
+		_, err := txn.Get([]byte("after"))
+		require.ErrorIs(t, err, ErrKeyNotFound)
+		return nil
+	}))
+	// A stopped Shadow can be replaced.
+	s, err = NewShadow(primary, shadow, ShadowOptions{})
+	require.NoError(t, err)
+	s.Stop()
+}
+
+func TestShadowCompareOnly(t *testing.T) {
+	dir, err := os.MkdirTemp("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	primary, err := Open(getTestOptions(dir + "/primary"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, primary.Close()) }()
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key%03d", i)) }
+	for i := 0; i < 100; i++ {
+		require.NoError(t, primary.Update(func(txn *Txn) error {
+			return txn.Set(key(i), []byte(fmt.Sprintf("val%d", i)))
+		}))
+	}
+
+	// The candidate is restored from a backup, and opened in ReadOnly mode.
+	var bak bytes.Buffer
+	_, err = primary.Backup(&bak, 0)
+	require.NoError(t, err)
+	candidate, err := Open(getTestOptions(dir + "/candidate"))
+	require.NoError(t, err)
+	require.NoError(t, candidate.Load(&bak, 16))
+	require.NoError(t, candidate.Close())
+	candidate, err = Open(getTestOptions(dir + "/candidate").WithReadOnly(true))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, candidate.Close()) }()
+
+	var mu sync.Mutex
+	var divergences []Divergence
+	s, err := NewShadow(primary, candidate, ShadowOptions{
+		CompareReads: true,
+		SampleRate:   0.5,
+		CompareOnly:  true,
+		OnDivergence: func(d Divergence) {
+			mu.Lock()
+			defer mu.Unlock()
+			divergences = append(divergences, d)
+		},
+	})
+	require.NoError(t, err)
+	defer s.Stop()
+
+	// Writes after the backup aren't mirrored, nor compared.
+	require.NoError(t, primary.Update(func(txn *Txn) error {
+		require.NoError(t, txn.Set(key(0), []byte("new")))
+		return txn.Delete(key(1))
+	}))
+	require.NoError(t, primary.View(func(txn *Txn) error {
+		for i := 0; i < 100; i++ {
+			if _, err := txn.Get(key(i)); err != ErrKeyNotFound {
+				require.NoError(t, err)
+			}
+		}
+		return nil
+	}))
+	stats := s.Stats()
+	require.Zero(t, stats.MirrorErrors)
+	require.Zero(t, stats.Diverged)
+	// Half of the reads are compared.
+	require.InDelta(t, 50, stats.Compared+stats.Skipped, 25)
+
+	n, err := s.Verify()
+	require.NoError(t, err)
+	require.Zero(t, n)
+	require.Equal(t, stats.Skipped+2, s.Stats().Skipped)
+	require.Empty(t, divergences)
+
+	_, err = NewShadow(candidate, primary, ShadowOptions{SampleRate: 2})
+	require.Error(t, err)
+}
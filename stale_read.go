@@ -0,0 +1,127 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// staleSnapshot is a read timestamp shared by the transactions of DB.ViewStale.
+type staleSnapshot struct {
+	readTs uint64
+	// taken is the time readTs was taken at, or a little before.
+	taken time.Time
+	// refs counts the transactions reading at readTs, plus one while the snapshot is the current
+	// one of the DB. The read mark of readTs is done once it drops to zero.
+	refs atomic.Int64
+	// expire stops the snapshot from being the current one once it's older than the staleness
+	// allowed by the call which took it.
+	expire *time.Timer
+}
+
+// acquire adds a reference to s, unless it's released already.
+func (s *staleSnapshot) acquire() bool {
+	for {
+		n := s.refs.Load()
+		if n == 0 {
+			return false
+		}
+		if s.refs.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+func (s *staleSnapshot) release(orc *oracle) {
+	if s.refs.Add(-1) == 0 {
+		orc.readMark.Done(s.readTs)
+	}
+}
+
+// staleReads holds the current snapshot of DB.ViewStale.
+type staleReads struct {
+	sync.Mutex // Serializes the refreshes of snap.
+	snap       atomic.Pointer[staleSnapshot]
+}
+
+// fresh returns the current snapshot, with a reference, if it was taken within maxStaleness.
+func (sr *staleReads) fresh(maxStaleness time.Duration) *staleSnapshot {
+	if s := sr.snap.Load(); s != nil && time.Since(s.taken) <= maxStaleness && s.acquire() {
+		return s
+	}
+	return nil
+}
+
+// staleSnapshot returns a snapshot taken within maxStaleness, with a reference, taking a new one if
+// the current one is older.
+func (db *DB) staleSnapshot(maxStaleness time.Duration) *staleSnapshot {
+	sr := &db.staleReads
+	if s := sr.fresh(maxStaleness); s != nil {
+		return s
+	}
+	sr.Lock()
+	defer sr.Unlock()
+	// Another transaction may have refreshed it.
+	if s := sr.fresh(maxStaleness); s != nil {
+		return s
+	}
+	s := &staleSnapshot{taken: time.Now()}
+	s.readTs = db.orc.readTs()
+	s.refs.Store(2)
+	if old := sr.snap.Swap(s); old != nil {
+		old.expire.Stop()
+		old.release(db.orc)
+	}
+	// The snapshot is released once expired, even if ViewStale isn't called anymore to replace
+	// it, so that it doesn't keep the versions it reads from being discarded. Whoever removes it
+	// from snap releases the reference of the DB.
+	s.expire = time.AfterFunc(maxStaleness, func() {
+		if sr.snap.CompareAndSwap(s, nil) {
+			s.release(db.orc)
+		}
+	})
+	return s
+}
+
+// dropStaleSnapshot releases the current snapshot of ViewStale.
+func (db *DB) dropStaleSnapshot() {
+	sr := &db.staleReads
+	sr.Lock()
+	defer sr.Unlock()
+	if s := sr.snap.Swap(nil); s != nil {
+		s.expire.Stop()
+		s.release(db.orc)
+	}
+}
+
+// ViewStale is like View, but the transaction may not see the writes committed in the last
+// maxStaleness. It reads at a snapshot shared by the calls to ViewStale, refreshed by the first
+// call finding it older than its maxStaleness, so that most calls don't go through the oracle
+// or wait for the commits in flight. Reads tolerating a few hundred milliseconds of staleness
+// scale better with it.
+//
+// The snapshot keeps the versions it reads from being discarded until it's older than the
+// maxStaleness of the call which took it, and the transactions reading at it are done. If
+// ViewStale is used with managed transactions, or on a DB of OpenAt, it's the same as View.
+func (db *DB) ViewStale(maxStaleness time.Duration, fn func(txn *Txn) error) error {
+	if db.IsClosed() {
+		return ErrDBClosed
+	}
+	if db.opt.managedTxns || db.opt.asOf != 0 {
+		return db.View(fn)
+	}
+	s := db.staleSnapshot(maxStaleness)
+	defer s.release(db.orc)
+	txn := db.newTransaction(false, true)
+	txn.readTs = s.readTs
+	// The read mark of readTs is done by s.
+	txn.doneRead = true
+	defer txn.Discard()
+
+	return fn(txn)
+}
@@ -0,0 +1,78 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestViewStale(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		set := func(val string) {
+			require.NoError(t, db.Update(func(txn *Txn) error {
+				return txn.Set([]byte("key"), []byte(val))
+			}))
+		}
+		get := func(maxStaleness time.Duration) string {
+			var val []byte
+			require.NoError(t, db.ViewStale(maxStaleness, func(txn *Txn) error {
+				item, err := txn.Get([]byte("key"))
+				if err != nil {
+					return err
+				}
+				val, err = item.ValueCopy(nil)
+				return err
+			}))
+			return string(val)
+		}
+
+		set("v1")
+		require.Equal(t, "v1", get(time.Hour))
+		set("v2")
+		// The snapshot is shared until it's older than the staleness allowed.
+		require.Equal(t, "v1", get(time.Hour))
+		require.Equal(t, "v2", get(0))
+		require.Equal(t, "v2", get(time.Hour))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					require.Equal(t, "v2", get(time.Duration(j%2)*time.Hour))
+				}
+			}()
+		}
+		wg.Wait()
+
+		// The versions read by the snapshot are kept until it's replaced.
+		set("v3")
+		db.dropStaleSnapshot()
+		require.Equal(t, "v3", get(time.Hour))
+		s := db.staleReads.snap.Load()
+		require.Less(t, db.orc.discardAtOrBelow(), s.readTs)
+		set("v4")
+		require.Equal(t, "v4", get(0))
+		require.Zero(t, s.refs.Load())
+
+		// The snapshot is released once expired, without another call to ViewStale.
+		set("v5")
+		db.dropStaleSnapshot()
+		require.Equal(t, "v5", get(50*time.Millisecond))
+		s = db.staleReads.snap.Load()
+		require.Less(t, db.orc.discardAtOrBelow(), s.readTs)
+		require.Eventually(t, func() bool {
+			return db.orc.discardAtOrBelow() >= s.readTs
+		}, 5*time.Second, 10*time.Millisecond)
+		require.Zero(t, s.refs.Load())
+		require.Nil(t, db.staleReads.snap.Load())
+	})
+}
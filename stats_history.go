@@ -0,0 +1,156 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/dgraph-io/ristretto/v2"
+	"github.com/dgraph-io/ristretto/v2/z"
+
+	"github.com/luxfi/zapdb/y"
+)
+
+// statsHistoryPrefix starts the keys of the snapshots of the stats history. It is followed by the
+// time of the snapshot, in nanoseconds since the epoch, big endian, so that snapshots sort by time.
+var statsHistoryPrefix = []byte("!badger!stats")
+
+// StatsSnapshot is a snapshot of the internal metrics of a DB, as kept by its stats history.
+type StatsSnapshot struct {
+	Time   time.Time
+	Levels []LevelInfo
+	// NumMemtables is the number of memtables, including the one being written to.
+	NumMemtables int
+	// StallTime is the time writes were stalled by L0 since the previous snapshot.
+	StallTime time.Duration
+	// BlockCacheHitRatio and IndexCacheHitRatio are the hit ratios of the caches since the
+	// previous snapshot, or zero if they weren't read. Caches shared through a Manager count the
+	// reads of every DB.
+	BlockCacheHitRatio float64
+	IndexCacheHitRatio float64
+}
+
+// statsHistory takes the snapshots of the stats history of a DB.
+type statsHistory struct {
+	db *DB
+	// The counters as of the previous snapshot.
+	stall              int64
+	blockHits, blockMs uint64
+	indexHits, indexMs uint64
+}
+
+// run takes a snapshot every StatsHistoryInterval, until lc is closed.
+func (h *statsHistory) run(lc *z.Closer) {
+	defer lc.Done()
+	h.snapshot() // The counters start now.
+	ticker := time.NewTicker(h.db.opt.StatsHistoryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lc.HasBeenClosed():
+			return
+		case <-ticker.C:
+		}
+		if err := h.save(h.snapshot()); err != nil {
+			h.db.opt.Warningf("While saving stats snapshot: %v", err)
+		}
+	}
+}
+
+// snapshot returns a snapshot of the metrics, and makes it the previous one.
+func (h *statsHistory) snapshot() StatsSnapshot {
+	db := h.db
+	db.lock.RLock()
+	numMemtables := len(db.imm) + 1
+	db.lock.RUnlock()
+	stall := db.lc.l0stallsMs.Load()
+	s := StatsSnapshot{
+		Time:         time.Now(),
+		Levels:       db.Levels(),
+		NumMemtables: numMemtables,
+		StallTime:    time.Duration(stall - h.stall),
+	}
+	h.stall = stall
+	s.BlockCacheHitRatio = hitRatio(db.BlockCacheShardMetrics(), &h.blockHits, &h.blockMs)
+	s.IndexCacheHitRatio = hitRatio([]*ristretto.Metrics{db.IndexCacheMetrics()}, &h.indexHits, &h.indexMs)
+	return s
+}
+
+// hitRatio returns the hit ratio of the cache with the metrics of its shards ms since the hits and
+// misses counted last, and updates them.
+func hitRatio(metrics []*ristretto.Metrics, hits, misses *uint64) float64 {
+	var h, ms uint64
+	for _, m := range metrics {
+		h, ms = h+m.Hits(), ms+m.Misses()
+	}
+	dh, dms := h-*hits, ms-*misses
+	*hits, *misses = h, ms
+	if dh+dms == 0 {
+		return 0
+	}
+	return float64(dh) / float64(dh+dms)
+}
+
+// save writes s to the DB, to expire after StatsHistoryRetention.
+func (h *statsHistory) save(s StatsSnapshot) error {
+	val, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	key := binary.BigEndian.AppendUint64(y.SafeCopy(nil, statsHistoryPrefix),
+		uint64(s.Time.UnixNano()))
+	// Like the banned namespaces, snapshots are written at version 1, so that they don't need a
+	// transaction, even in managed mode.
+	e := &Entry{Key: y.KeyWithTs(key, 1), Value: val}
+	if ttl := h.db.opt.StatsHistoryRetention; ttl > 0 {
+		e.WithTTL(ttl)
+	}
+	req, err := h.db.sendToWriteCh([]*Entry{e})
+	if err != nil {
+		return err
+	}
+	return req.Wait()
+}
+
+// StatsHistory returns the snapshots of the internal metrics of the DB taken in the last window,
+// oldest first, or all of them if window is zero. Snapshots are taken every StatsHistoryInterval,
+// kept across restarts, and expire after StatsHistoryRetention, so that the behavior of the DB
+// can be compared over time without an external monitoring system.
+func (db *DB) StatsHistory(window time.Duration) ([]StatsSnapshot, error) {
+	if db.IsClosed() {
+		return nil, ErrDBClosed
+	}
+	// The snapshots are written at version 1, which a fresh DB may not read yet.
+	txn := db.newTransaction(false, true)
+	txn.readTs = math.MaxUint64
+	txn.doneRead = true
+	defer txn.Discard()
+
+	opt := DefaultIteratorOptions
+	opt.Prefix = statsHistoryPrefix
+	opt.InternalAccess = true
+	it := txn.NewIterator(opt)
+	defer it.Close()
+	seek := statsHistoryPrefix
+	if window > 0 {
+		since := time.Now().Add(-window).UnixNano()
+		seek = binary.BigEndian.AppendUint64(y.SafeCopy(nil, statsHistoryPrefix), uint64(since))
+	}
+	var out []StatsSnapshot
+	for it.Seek(seek); it.Valid(); it.Next() {
+		var s StatsSnapshot
+		if err := it.Item().Value(func(val []byte) error {
+			return json.Unmarshal(val, &s)
+		}); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
@@ -0,0 +1,62 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsHistory(t *testing.T) {
+	dir := t.TempDir()
+	opt := getTestOptions(dir).WithStatsHistoryInterval(10 * time.Millisecond)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.Set([]byte("key"), []byte("val"))
+	}))
+	require.Eventually(t, func() bool {
+		history, err := db.StatsHistory(0)
+		require.NoError(t, err)
+		return len(history) >= 3
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, db.Close())
+
+	// The history is kept across restarts, and hidden from the iterators of the DB.
+	db, err = Open(opt.WithStatsHistoryInterval(0))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	history, err := db.StatsHistory(0)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, len(history), 3)
+	for i, s := range history {
+		require.Len(t, s.Levels, opt.MaxLevels)
+		require.GreaterOrEqual(t, s.NumMemtables, 1)
+		if i > 0 {
+			require.True(t, s.Time.After(history[i-1].Time))
+		}
+	}
+	require.NoError(t, db.View(func(txn *Txn) error {
+		it := txn.NewIterator(DefaultIteratorOptions)
+		defer it.Close()
+		var n int
+		for it.Rewind(); it.Valid(); it.Next() {
+			n++
+		}
+		require.Equal(t, 1, n)
+		return nil
+	}))
+
+	time.Sleep(10 * time.Millisecond)
+	recent, err := db.StatsHistory(time.Millisecond)
+	require.NoError(t, err)
+	require.Empty(t, recent)
+	recent, err = db.StatsHistory(time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, history, recent)
+}
@@ -34,7 +34,7 @@ var maxStreamSize = uint64(100 << 20) // 100MB
 // order, use Iterator.
 type Stream struct {
 	// Prefix to only iterate over certain range of keys. If set to nil (default), Stream would
-	// iterate over the entire DB.
+	// iterate over the entire DB, including the keys of its column families.
 	Prefix []byte
 
 	// Number of goroutines to use for iterating over key ranges. Defaults to 8.
@@ -95,8 +95,10 @@ type Stream struct {
 	kvChan       chan *z.Buffer
 	nextStreamId atomic.Uint32
 	doneMarkers  bool
-	scanned      atomic.Uint64 // used to estimate the ETA for data scan.
-	numProducers atomic.Int32
+	// rangeTombstones has the range tombstones committed after SinceTs sent ahead of the keys.
+	rangeTombstones bool
+	scanned         atomic.Uint64 // used to estimate the ETA for data scan.
+	numProducers    atomic.Int32
 }
 
 // SendDoneMarkers when true would send out done markers on the stream. False by default.
@@ -168,17 +170,47 @@ func (st *Stream) produceRanges(ctx context.Context) {
 	close(st.rangeCh)
 }
 
+// newTxn returns a read-only transaction at readTs, or at the current version if unset.
+func (st *Stream) newTxn() *Txn {
+	if st.readTs == 0 {
+		return st.db.NewTransaction(false)
+	}
+	// Like NewTransactionAt, but also in normal mode, where the read at readTs is held by the
+	// caller.
+	txn := st.db.newTransaction(false, true)
+	txn.readTs = st.readTs
+	txn.doneRead = true
+	return txn
+}
+
+// sendRangeTombstones sends the range tombstones committed after SinceTs, clipped to Prefix, to
+// kvChan. The versions they delete aren't streamed, so that the writes of the stream need them to
+// delete those versions where they're applied.
+func (st *Stream) sendRangeTombstones() {
+	txn := st.newTxn()
+	defer txn.Discard()
+	ts := txn.rangeTombstonesSince(st.SinceTs, st.Prefix)
+	if len(ts) == 0 {
+		return
+	}
+	buf := z.NewBuffer(1<<10, "Stream.RangeTombstones")
+	for _, t := range ts {
+		KVToBuffer(&pb.KV{
+			Key:      rangeTombstoneKey(t.start, t.end),
+			Version:  t.version,
+			UserMeta: []byte{0},
+			Meta:     []byte{0},
+		}, buf)
+	}
+	st.kvChan <- buf
+}
+
 // produceKVs picks up ranges from rangeCh, generates KV lists and sends them to kvChan.
 func (st *Stream) produceKVs(ctx context.Context, threadId int) error {
 	st.numProducers.Add(1)
 	defer st.numProducers.Add(-1)
 
-	var txn *Txn
-	if st.readTs > 0 {
-		txn = st.db.NewTransactionAt(st.readTs, false)
-	} else {
-		txn = st.db.NewTransaction(false)
-	}
+	txn := st.newTxn()
 	defer txn.Discard()
 
 	// produceKVs is running iterate serially. So, we can define the outList here.
@@ -195,6 +227,7 @@ func (st *Stream) produceKVs(ctx context.Context, threadId int) error {
 		iterOpts.Prefix = st.Prefix
 		iterOpts.PrefetchValues = true
 		iterOpts.SinceTs = st.SinceTs
+		iterOpts.columnFamilies = true
 		itr := txn.NewIterator(iterOpts)
 		itr.ThreadId = threadId
 		defer itr.Close()
@@ -424,6 +457,9 @@ func (st *Stream) Orchestrate(ctx context.Context) error {
 	if st.KeyToList == nil {
 		st.KeyToList = st.ToList
 	}
+	if st.rangeTombstones {
+		st.sendRangeTombstones()
+	}
 
 	// Picks up ranges from Badger, and sends them to rangeCh.
 	go st.produceRanges(ctx)
@@ -37,6 +37,8 @@ type StreamWriter struct {
 	maxVersion uint64
 	writers    map[uint32]*sortedWriter
 	prevLevel  int
+	// rangeDels are the range tombstones written, which Flush adds to those of the DB.
+	rangeDels []rangeTombstone
 }
 
 // NewStreamWriter creates a StreamWriter. Right after creating StreamWriter, Prepare must be
@@ -187,6 +189,11 @@ func (sw *StreamWriter) Write(buf *z.Buffer) error {
 			streamReqs[kv.StreamId] = req
 		}
 		req.Entries = append(req.Entries, e)
+		if t, ok := parseRangeTombstone(e.Key); ok {
+			sw.writeLock.Lock()
+			sw.rangeDels = append(sw.rangeDels, t)
+			sw.writeLock.Unlock()
+		}
 		return nil
 	})
 	if err != nil {
@@ -294,6 +301,9 @@ func (sw *StreamWriter) Flush() error {
 	for _, l := range sw.db.lc.levels {
 		l.sortTables()
 	}
+	for _, t := range sw.rangeDels {
+		sw.db.rangeDels.add(t)
+	}
 
 	// Now sync the directories, so all the files are registered.
 	if sw.db.opt.ValueDir != sw.db.opt.Dir {
@@ -497,11 +507,12 @@ func (w *sortedWriter) createTable(builder *table.Builder) error {
 	lhandler := lc.levels[w.level]
 	// Now that table can be opened successfully, let's add this to the MANIFEST.
 	change := &pb.ManifestChange{
-		Id:          tbl.ID(),
-		KeyId:       tbl.KeyID(),
-		Op:          pb.ManifestChange_CREATE,
-		Level:       uint32(lhandler.level),
-		Compression: uint32(tbl.CompressionType()),
+		Id:             tbl.ID(),
+		KeyId:          tbl.KeyID(),
+		Op:             pb.ManifestChange_CREATE,
+		Level:          uint32(lhandler.level),
+		Compression:    uint32(tbl.CompressionType()),
+		EncryptionAlgo: tbl.EncryptionAlgo(),
 	}
 	if err := w.db.manifest.addChanges([]*pb.ManifestChange{change}, w.db.opt); err != nil {
 		return err
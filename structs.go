@@ -207,8 +207,8 @@ func (e *Entry) WithTTL(dur time.Duration) *Entry {
 	return e
 }
 
-// withMergeBit sets merge bit in entry's metadata. This
-// function is called by MergeOperator's Add method.
+// withMergeBit sets merge bit in entry's metadata, making it a merge delta. This
+// function is called by Txn.Merge.
 func (e *Entry) withMergeBit() *Entry {
 	e.meta = bitMergeEntry
 	return e
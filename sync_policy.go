@@ -0,0 +1,193 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+
+	"github.com/luxfi/zapdb/options"
+)
+
+// resolveSyncPolicies replaces options.SyncDefault with the concrete policy of each component
+// and validates the combination. SyncWrites is kept in agreement with ValueLogSyncPolicy,
+// because the write path consults it directly.
+func resolveSyncPolicies(opt *Options) error {
+	if err := resolveDurability(opt); err != nil {
+		return err
+	}
+	switch opt.ValueLogSyncPolicy {
+	case options.SyncDefault:
+		if opt.SyncWrites {
+			opt.ValueLogSyncPolicy = options.SyncAlways
+		} else {
+			opt.ValueLogSyncPolicy = options.SyncNever
+		}
+	case options.SyncAlways:
+		opt.SyncWrites = true
+	case options.SyncInterval, options.SyncNever:
+		opt.SyncWrites = false
+	default:
+		return fmt.Errorf("Invalid ValueLogSyncPolicy: %d", opt.ValueLogSyncPolicy)
+	}
+
+	switch opt.ManifestSyncPolicy {
+	case options.SyncDefault:
+		opt.ManifestSyncPolicy = options.SyncAlways
+	case options.SyncAlways, options.SyncInterval, options.SyncNever:
+	default:
+		return fmt.Errorf("Invalid ManifestSyncPolicy: %d", opt.ManifestSyncPolicy)
+	}
+
+	switch opt.TableSyncPolicy {
+	case options.SyncDefault:
+		opt.TableSyncPolicy = options.SyncAlways
+	case options.SyncAlways, options.SyncNever:
+	case options.SyncInterval:
+		return errors.New("TableSyncPolicy cannot be SyncInterval. Use SyncAlways or SyncNever")
+	default:
+		return fmt.Errorf("Invalid TableSyncPolicy: %d", opt.TableSyncPolicy)
+	}
+
+	if (opt.ValueLogSyncPolicy == options.SyncInterval ||
+		opt.ManifestSyncPolicy == options.SyncInterval) && opt.SyncInterval <= 0 {
+		return errors.New("SyncInterval must be greater than zero when using SyncInterval policy")
+	}
+	if opt.MaxUnsyncedBytes < 0 {
+		return fmt.Errorf("Invalid MaxUnsyncedBytes: %d", opt.MaxUnsyncedBytes)
+	}
+	if opt.MaxUnsyncedDuration < 0 {
+		return fmt.Errorf("Invalid MaxUnsyncedDuration: %s", opt.MaxUnsyncedDuration)
+	}
+	if opt.GroupCommitWindow < 0 {
+		return fmt.Errorf("Invalid GroupCommitWindow: %s", opt.GroupCommitWindow)
+	}
+	return nil
+}
+
+// resolveDurability sets ValueLogSyncPolicy from Durability, if set, and checks that the other
+// options don't ask for another durability.
+func resolveDurability(opt *Options) error {
+	var policy options.SyncPolicy
+	switch opt.Durability {
+	case options.DurabilityDefault:
+		return nil
+	case options.SyncEveryWrite:
+		policy = options.SyncAlways
+	case options.SyncEveryInterval:
+		policy = options.SyncInterval
+	case options.SyncOnClose:
+		policy = options.SyncNever
+		if opt.MaxUnsyncedBytes > 0 || opt.MaxUnsyncedDuration > 0 {
+			return errors.New("MaxUnsyncedBytes and MaxUnsyncedDuration cannot be set " +
+				"with SyncOnClose durability")
+		}
+	default:
+		return fmt.Errorf("Invalid Durability: %d", opt.Durability)
+	}
+	if opt.ValueLogSyncPolicy != options.SyncDefault && opt.ValueLogSyncPolicy != policy {
+		return fmt.Errorf("ValueLogSyncPolicy %d conflicts with Durability %d",
+			opt.ValueLogSyncPolicy, opt.Durability)
+	}
+	if opt.SyncWrites && policy != options.SyncAlways {
+		return fmt.Errorf("SyncWrites conflicts with Durability %d", opt.Durability)
+	}
+	opt.ValueLogSyncPolicy = policy
+	return nil
+}
+
+func (db *DB) needsPeriodicSync() bool {
+	if db.opt.InMemory || db.opt.ReadOnly {
+		return false
+	}
+	return db.opt.ValueLogSyncPolicy == options.SyncInterval ||
+		db.opt.ManifestSyncPolicy == options.SyncInterval ||
+		db.boundsUnsynced()
+}
+
+// logsSynced returns true if the value log and WAL get synced at all, in which case the entries
+// of newly created log files must be synced in their directories too.
+func (db *DB) logsSynced() bool {
+	return db.opt.ValueLogSyncPolicy != options.SyncNever || db.boundsUnsynced()
+}
+
+// boundsUnsynced returns true if MaxUnsyncedBytes or MaxUnsyncedDuration apply.
+func (db *DB) boundsUnsynced() bool {
+	return !db.opt.SyncWrites && (db.opt.MaxUnsyncedBytes > 0 || db.opt.MaxUnsyncedDuration > 0)
+}
+
+// periodicSync syncs the components configured with options.SyncInterval, and the logs whenever
+// MaxUnsyncedBytes or MaxUnsyncedDuration is reached, until the closer is signalled. A final sync
+// is done on the way out, so that a clean Close leaves nothing unsynced.
+func (db *DB) periodicSync(lc *z.Closer) {
+	defer lc.Done()
+
+	// A nil channel blocks forever, disabling the corresponding case below.
+	var intervalCh, boundCh <-chan time.Time
+	if db.opt.ValueLogSyncPolicy == options.SyncInterval ||
+		db.opt.ManifestSyncPolicy == options.SyncInterval {
+		ticker := time.NewTicker(db.opt.SyncInterval)
+		defer ticker.Stop()
+		intervalCh = ticker.C
+	}
+	if db.boundsUnsynced() && db.opt.MaxUnsyncedDuration > 0 {
+		// Any write is synced by the following tick, so it stays unsynced for at most
+		// MaxUnsyncedDuration, plus the time taken by the sync itself.
+		ticker := time.NewTicker(db.opt.MaxUnsyncedDuration)
+		defer ticker.Stop()
+		boundCh = ticker.C
+	}
+	for {
+		select {
+		case <-intervalCh:
+			if err := db.syncIntervalComponents(); err != nil {
+				db.opt.Errorf("While running periodic sync: %v", err)
+			}
+		case <-boundCh:
+			if err := db.syncUnsynced(); err != nil {
+				db.opt.Errorf("While syncing unsynced writes: %v", err)
+			}
+		case <-db.unsyncedCh:
+			if err := db.syncUnsynced(); err != nil {
+				db.opt.Errorf("While syncing unsynced writes: %v", err)
+			}
+		case <-lc.HasBeenClosed():
+			if err := db.syncIntervalComponents(); err != nil {
+				db.opt.Errorf("While running final periodic sync: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// syncUnsynced syncs the value log and WAL if anything was written to them since the last sync.
+func (db *DB) syncUnsynced() error {
+	// Swap before syncing, so writes racing with the sync are counted towards the next one.
+	if db.unsyncedBytes.Swap(0) == 0 {
+		return nil
+	}
+	return db.Sync()
+}
+
+func (db *DB) syncIntervalComponents() error {
+	var logErr, manifestErr error
+	if db.opt.ValueLogSyncPolicy == options.SyncInterval {
+		db.unsyncedBytes.Store(0)
+		logErr = db.Sync()
+	} else if db.boundsUnsynced() {
+		logErr = db.syncUnsynced()
+	}
+	if db.opt.ManifestSyncPolicy == options.SyncInterval {
+		manifestErr = db.manifest.syncIfDirty()
+	}
+	if logErr != nil {
+		return logErr
+	}
+	return manifestErr
+}
@@ -0,0 +1,176 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/options"
+)
+
+func TestResolveSyncPolicies(t *testing.T) {
+	opt := DefaultOptions("")
+	require.NoError(t, resolveSyncPolicies(&opt))
+	require.Equal(t, options.SyncNever, opt.ValueLogSyncPolicy)
+	require.Equal(t, options.SyncAlways, opt.ManifestSyncPolicy)
+	require.Equal(t, options.SyncAlways, opt.TableSyncPolicy)
+
+	opt = DefaultOptions("").WithSyncWrites(true)
+	require.NoError(t, resolveSyncPolicies(&opt))
+	require.Equal(t, options.SyncAlways, opt.ValueLogSyncPolicy)
+
+	// An explicit value log policy wins over SyncWrites.
+	opt = DefaultOptions("").WithSyncWrites(true).WithValueLogSyncPolicy(options.SyncInterval)
+	require.NoError(t, resolveSyncPolicies(&opt))
+	require.False(t, opt.SyncWrites)
+
+	opt = DefaultOptions("").WithTableSyncPolicy(options.SyncInterval)
+	require.Error(t, resolveSyncPolicies(&opt))
+
+	opt = DefaultOptions("").WithManifestSyncPolicy(options.SyncInterval).WithSyncInterval(0)
+	require.Error(t, resolveSyncPolicies(&opt))
+}
+
+func TestManifestSyncPolicy(t *testing.T) {
+	var syncs atomic.Int32
+	oldSync := syncFunc
+	syncFunc = func(f *os.File) error {
+		syncs.Add(1)
+		return f.Sync()
+	}
+	defer func() { syncFunc = oldSync }()
+
+	dir, err := os.MkdirTemp("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	opt := getTestOptions(dir).
+		WithManifestSyncPolicy(options.SyncInterval).
+		WithSyncInterval(10 * time.Millisecond)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	require.True(t, db.needsPeriodicSync())
+
+	require.NoError(t, db.manifest.addChanges(nil, db.opt))
+	db.manifest.appendLock.Lock()
+	require.True(t, db.manifest.dirty)
+	db.manifest.appendLock.Unlock()
+
+	require.Eventually(t, func() bool {
+		db.manifest.appendLock.Lock()
+		defer db.manifest.appendLock.Unlock()
+		return !db.manifest.dirty
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Greater(t, syncs.Load(), int32(0))
+	require.NoError(t, db.Close())
+}
+
+func TestValueLogSyncIntervalPolicy(t *testing.T) {
+	opt := getTestOptions("").
+		WithValueLogSyncPolicy(options.SyncInterval).
+		WithSyncInterval(10 * time.Millisecond)
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		require.False(t, db.opt.SyncWrites)
+		require.True(t, db.needsPeriodicSync())
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Set([]byte("key"), []byte("value"))
+		}))
+		time.Sleep(30 * time.Millisecond)
+	})
+}
+
+func TestMaxUnsyncedBounds(t *testing.T) {
+	write := func(t *testing.T, db *DB) {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Set([]byte("key"), make([]byte, 1<<10))
+		}))
+	}
+
+	t.Run("bytes", func(t *testing.T) {
+		opt := getTestOptions("").WithMaxUnsyncedBytes(512)
+		runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+			require.True(t, db.needsPeriodicSync())
+			write(t, db)
+			require.Eventually(t, func() bool {
+				return db.unsyncedBytes.Load() == 0
+			}, 5*time.Second, 5*time.Millisecond)
+		})
+	})
+	t.Run("duration", func(t *testing.T) {
+		opt := getTestOptions("").WithMaxUnsyncedDuration(20 * time.Millisecond)
+		runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+			write(t, db)
+			require.Eventually(t, func() bool {
+				return db.unsyncedBytes.Load() == 0
+			}, 5*time.Second, 5*time.Millisecond)
+		})
+	})
+	t.Run("sync writes", func(t *testing.T) {
+		opt := getTestOptions("").WithSyncWrites(true).WithMaxUnsyncedBytes(512)
+		runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+			require.False(t, db.needsPeriodicSync())
+			write(t, db)
+			require.Zero(t, db.unsyncedBytes.Load())
+		})
+	})
+}
+
+func TestResolveDurability(t *testing.T) {
+	for d, policy := range map[options.Durability]options.SyncPolicy{
+		options.SyncEveryWrite:    options.SyncAlways,
+		options.SyncEveryInterval: options.SyncInterval,
+		options.SyncOnClose:       options.SyncNever,
+	} {
+		opt := DefaultOptions("").WithDurability(d)
+		require.NoError(t, resolveSyncPolicies(&opt))
+		require.Equal(t, policy, opt.ValueLogSyncPolicy)
+		require.Equal(t, d == options.SyncEveryWrite, opt.SyncWrites)
+	}
+
+	opt := DefaultOptions("").WithDurability(options.SyncOnClose).WithSyncWrites(true)
+	require.Error(t, resolveSyncPolicies(&opt))
+	opt = DefaultOptions("").WithDurability(options.SyncOnClose).
+		WithValueLogSyncPolicy(options.SyncInterval)
+	require.Error(t, resolveSyncPolicies(&opt))
+	opt = DefaultOptions("").WithDurability(options.SyncOnClose).WithMaxUnsyncedBytes(1 << 20)
+	require.Error(t, resolveSyncPolicies(&opt))
+	opt = DefaultOptions("").WithGroupCommitWindow(-time.Second)
+	require.Error(t, resolveSyncPolicies(&opt))
+}
+
+func TestGroupCommitWindow(t *testing.T) {
+	opt := getTestOptions("").
+		WithDurability(options.SyncEveryWrite).
+		WithGroupCommitWindow(20 * time.Millisecond)
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		var wg sync.WaitGroup
+		for i := range 50 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				require.NoError(t, db.Update(func(txn *Txn) error {
+					return txn.Set(fmt.Appendf(nil, "key%d", i), []byte("value"))
+				}))
+			}()
+		}
+		wg.Wait()
+
+		// The writes share batches, and the batches are synced.
+		stats := db.WritePipelineStats()
+		require.Equal(t, int64(50), stats.Batches.Requests)
+		require.Less(t, stats.Batches.Count, int64(50))
+		require.Greater(t, stats.Batches.MaxRequests, int64(1))
+		require.Greater(t, stats.Batches.MeanRequests(), 1.0)
+		require.GreaterOrEqual(t, stats.Syncs, stats.Batches.Count)
+	})
+}
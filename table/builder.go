@@ -6,6 +6,7 @@
 package table
 
 import (
+	"bytes"
 	"crypto/aes"
 	"errors"
 	"math"
@@ -73,10 +74,15 @@ type Builder struct {
 
 	lenOffsets    uint32
 	keyHashes     []uint32 // Used for building the bloomfilter.
+	prefixHashes  []uint32 // Used for building the prefix bloomfilter.
+	lastPrefix    []byte   // The prefix of the last key, if it has one.
 	opts          *Options
 	maxVersion    uint64
 	onDiskSize    uint32
 	staleDataSize int
+	// The latest expiry of the keys which expire, and their number.
+	maxExpiresAt     uint64
+	expiringKeyCount uint32
 
 	// Used to concurrently compress/encrypt blocks.
 	wg        sync.WaitGroup
@@ -207,10 +213,22 @@ func (b *Builder) keyDiff(newKey []byte) []byte {
 
 func (b *Builder) addHelper(key []byte, v y.ValueStruct, vpLen uint32) {
 	b.keyHashes = append(b.keyHashes, y.Hash(y.ParseKey(key)))
+	if b.opts.ExtractPrefix != nil {
+		// The keys are sorted, so that the keys of a prefix follow each other.
+		p := b.opts.ExtractPrefix(y.ParseKey(key))
+		if len(p) > 0 && (len(b.prefixHashes) == 0 || !bytes.Equal(p, b.lastPrefix)) {
+			b.prefixHashes = append(b.prefixHashes, y.Hash(p))
+			b.lastPrefix = append(b.lastPrefix[:0], p...)
+		}
+	}
 
 	if version := y.ParseTs(key); version > b.maxVersion {
 		b.maxVersion = version
 	}
+	if v.ExpiresAt > 0 {
+		b.maxExpiresAt = max(b.maxExpiresAt, v.ExpiresAt)
+		b.expiringKeyCount++
+	}
 
 	// diffKey stores the difference of key with baseKey.
 	var diffKey []byte
@@ -307,9 +325,9 @@ func (b *Builder) shouldFinishBlock(key []byte, value y.ValueStruct) bool {
 		uint32(len(key)) + value.EncodedSize() + entriesOffsetsSize
 
 	if b.shouldEncrypt() {
-		// IV is added at the end of the block, while encrypting.
-		// So, size of IV is added to estimatedSize.
-		estimatedSize += aes.BlockSize
+		// IV is added at the end of the block, while encrypting, with the tag of the
+		// algorithm if it has one. So, their size is added to estimatedSize.
+		estimatedSize += aes.BlockSize + uint32(y.SealOverhead(b.DataKey().EncryptionAlgo))
 	}
 
 	// Integer overflow check for table size.
@@ -430,12 +448,16 @@ func (b *Builder) Done() buildData {
 		alloc:     b.alloc,
 	}
 
-	var f y.Filter
+	var f, pf y.Filter
 	if b.opts.BloomFalsePositive > 0 {
 		bits := y.BloomBitsPerKey(len(b.keyHashes), b.opts.BloomFalsePositive)
 		f = y.NewFilter(b.keyHashes, bits)
+		if len(b.prefixHashes) > 0 {
+			bits = y.BloomBitsPerKey(len(b.prefixHashes), b.opts.BloomFalsePositive)
+			pf = y.NewFilter(b.prefixHashes, bits)
+		}
 	}
-	index, dataSize := b.buildIndex(f)
+	index, dataSize := b.buildIndex(f, pf)
 
 	var err error
 	if b.shouldEncrypt() {
@@ -488,14 +510,15 @@ func (b *Builder) encrypt(data []byte) ([]byte, error) {
 	if err != nil {
 		return data, y.Wrapf(err, "Error while generating IV in Builder.encrypt")
 	}
-	needSz := len(data) + len(iv)
-	dst := b.alloc.Allocate(needSz)
+	algo := b.DataKey().EncryptionAlgo
+	sealedSz := len(data) + y.SealOverhead(algo)
+	dst := b.alloc.Allocate(sealedSz + len(iv))
 
-	if err = y.XORBlock(dst[:len(data)], data, b.DataKey().Data, iv); err != nil {
+	if err = y.SealBlock(algo, dst[:sealedSz], data, b.DataKey().Data, iv, nil); err != nil {
 		return data, y.Wrapf(err, "Error while encrypting in Builder.encrypt")
 	}
 
-	y.AssertTrue(len(iv) == copy(dst[len(data):], iv))
+	y.AssertTrue(len(iv) == copy(dst[sealedSz:], iv))
 	return dst, nil
 }
 
@@ -517,12 +540,15 @@ func (b *Builder) compressData(data []byte) ([]byte, error) {
 	case options.ZSTD:
 		sz := y.ZSTDCompressBound(len(data))
 		dst := b.alloc.Allocate(sz)
+		if b.opts.ZSTDDictionary != nil {
+			return b.opts.ZSTDDictionary.Compress(dst, data)
+		}
 		return y.ZSTDCompress(dst, data, b.opts.ZSTDCompressionLevel)
 	}
 	return nil, errors.New("Unsupported compression type")
 }
 
-func (b *Builder) buildIndex(bloom []byte) ([]byte, uint32) {
+func (b *Builder) buildIndex(bloom, prefixBloom []byte) ([]byte, uint32) {
 	builder := fbs.NewBuilder(3 << 20)
 
 	boList, dataSize := b.writeBlockOffsets(builder)
@@ -540,6 +566,11 @@ func (b *Builder) buildIndex(bloom []byte) ([]byte, uint32) {
 	if len(bloom) > 0 {
 		bfoff = builder.CreateByteVector(bloom)
 	}
+	var pfoff, peoff fbs.UOffsetT
+	if len(prefixBloom) > 0 {
+		pfoff = builder.CreateByteVector(prefixBloom)
+		peoff = builder.CreateString(b.opts.PrefixFilter)
+	}
 	b.onDiskSize += dataSize
 	fb.TableIndexStart(builder)
 	fb.TableIndexAddOffsets(builder, boEnd)
@@ -549,6 +580,10 @@ func (b *Builder) buildIndex(bloom []byte) ([]byte, uint32) {
 	fb.TableIndexAddKeyCount(builder, uint32(len(b.keyHashes)))
 	fb.TableIndexAddOnDiskSize(builder, b.onDiskSize)
 	fb.TableIndexAddStaleDataSize(builder, uint32(b.staleDataSize))
+	fb.TableIndexAddMaxExpiresAt(builder, b.maxExpiresAt)
+	fb.TableIndexAddExpiringKeyCount(builder, b.expiringKeyCount)
+	fb.TableIndexAddPrefixBloomFilter(builder, pfoff)
+	fb.TableIndexAddPrefixExtractor(builder, peoff)
 	builder.Finish(fb.TableIndexEnd(builder))
 
 	buf := builder.FinishedBytes()
@@ -240,14 +240,18 @@ func (itr *Iterator) seekToLast() {
 
 func (itr *Iterator) seekHelper(blockIdx int, key []byte) {
 	itr.bpos = blockIdx
-	block, err := itr.t.block(blockIdx, itr.useCache())
-	if err != nil {
-		itr.err = err
-		return
+	// Seeks within the block already loaded, like those of the sorted keys of a MultiGet, don't
+	// read it again.
+	if itr.bi.block == nil || itr.bi.blockID != blockIdx || len(itr.bi.data) == 0 {
+		block, err := itr.t.block(blockIdx, itr.useCache())
+		if err != nil {
+			itr.err = err
+			return
+		}
+		itr.bi.tableID = itr.t.id
+		itr.bi.blockID = itr.bpos
+		itr.bi.setBlock(block)
 	}
-	itr.bi.tableID = itr.t.id
-	itr.bi.blockID = itr.bpos
-	itr.bi.setBlock(block)
 	itr.bi.seek(key, origin)
 	itr.err = itr.bi.Error()
 }
@@ -7,13 +7,16 @@ package table
 
 import (
 	"bytes"
+	"context"
 	"crypto/aes"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -42,6 +45,10 @@ type Options struct {
 	// Open tables in read only mode.
 	ReadOnly       bool
 	MetricsEnabled bool
+	// Metrics of the DB the table belongs to. If nil, the process-wide metrics are used.
+	Metrics *y.MetricsSet
+	// NoSync skips the msync of newly created table files, leaving it to the OS.
+	NoSync bool
 
 	// Maximum size of the table.
 	TableSize     uint64
@@ -65,13 +72,26 @@ type Options struct {
 	Compression options.CompressionType
 
 	// Block cache is used to cache decompressed and decrypted blocks.
-	BlockCache *ristretto.Cache[[]byte, *Block]
+	BlockCache BlockCache
 	IndexCache *ristretto.Cache[uint64, *fb.TableIndex]
+	// CacheID sets the keys of the table apart from those of other DBs sharing its caches.
+	CacheID uint32
 
 	AllocPool *z.AllocatorPool
 
 	// ZSTDCompressionLevel is the ZSTD compression level used for compressing blocks.
 	ZSTDCompressionLevel int
+	// ZSTDDictionary, if set, compresses the blocks built with ZSTD compression.
+	ZSTDDictionary *y.ZSTDDictionary
+	// ZSTDDecoder, if set, decompresses the blocks read with ZSTD compression. It must know the
+	// dictionaries the blocks were compressed with.
+	ZSTDDecoder *y.ZSTDDecoder
+
+	// ExtractPrefix, if set, extracts the prefixes of the keys added to the prefix bloom filter
+	// of the tables built, named PrefixFilter. Only the prefix filters named PrefixFilter are
+	// used by the tables read.
+	ExtractPrefix func(key []byte) []byte
+	PrefixFilter  string
 }
 
 // TableInterface is useful for testing.
@@ -79,6 +99,7 @@ type TableInterface interface {
 	Smallest() []byte
 	Biggest() []byte
 	DoesNotHave(hash uint32) bool
+	DoesNotHavePrefix(prefix []byte) bool
 	MaxVersion() uint64
 }
 
@@ -102,9 +123,17 @@ type Table struct {
 	indexStart     int
 	indexLen       int
 	hasBloomFilter bool
+	// hasPrefixFilter is set if the table has a prefix bloom filter of Options.PrefixFilter.
+	hasPrefixFilter bool
 
 	IsInmemory bool // Set to true if the table is on level 0 and opened in memory.
 	opt        *Options
+
+	// src is read instead of the mapping of the table, if set by OpenTableReaderAt. The tail of
+	// the table, from tailOff on, holds its index and is kept in memory.
+	src     io.ReaderAt
+	tail    []byte
+	tailOff int
 }
 
 type cheapIndex struct {
@@ -114,6 +143,8 @@ type cheapIndex struct {
 	OnDiskSize        uint32
 	BloomFilterLength int
 	OffsetsLength     int
+	MaxExpiresAt      uint64
+	ExpiringKeyCount  uint32
 }
 
 func (t *Table) cheapIndex() *cheapIndex {
@@ -133,6 +164,13 @@ func (t *Table) UncompressedSize() uint32 { return t.cheapIndex().UncompressedSi
 // KeyCount is the total number of keys in this table.
 func (t *Table) KeyCount() uint32 { return t.cheapIndex().KeyCount }
 
+// MaxExpiresAt is the latest expiry of the keys of this table which expire, or 0 if none does.
+// Tables built before it was recorded return 0.
+func (t *Table) MaxExpiresAt() uint64 { return t.cheapIndex().MaxExpiresAt }
+
+// ExpiringKeyCount is the number of keys in this table which expire.
+func (t *Table) ExpiringKeyCount() uint32 { return t.cheapIndex().ExpiringKeyCount }
+
 // OnDiskSize returns the total size of key-values stored in this table (including the
 // disk space occupied on the value log).
 func (t *Table) OnDiskSize() uint32 { return t.cheapIndex().OnDiskSize }
@@ -155,9 +193,13 @@ func (t *Table) DecrRef() error {
 		// at least one reference pointing to them.
 
 		// Delete all blocks from the cache.
-		for i := 0; i < t.offsetsLength(); i++ {
+		for i := 0; t.opt.BlockCache != nil && i < t.offsetsLength(); i++ {
 			t.opt.BlockCache.Del(t.blockCacheKey(i))
 		}
+		if t.opt.ReadOnly {
+			// The file is left to the process which wrote it.
+			return t.Close(-1)
+		}
 		if err := t.Delete(); err != nil {
 			return err
 		}
@@ -170,6 +212,24 @@ func BlockEvictHandler(b *Block) {
 	b.decrRef()
 }
 
+// BlockCache caches the decompressed and decrypted blocks of the tables by key. It is
+// implemented by *ristretto.Cache[[]byte, *Block], and can be implemented by other caches.
+//
+// A block set in the cache holds a reference the cache releases with BlockEvictHandler once it
+// drops the block: when it's evicted, replaced, deleted or cleared, or if it's not admitted. If
+// Set returns false, the block isn't cached, and the reference is released by the caller.
+type BlockCache interface {
+	Get(key []byte) (*Block, bool)
+	Set(key []byte, b *Block, cost int64) bool
+	Del(key []byte)
+	// Wait waits for the pending sets to be applied.
+	Wait()
+	Clear()
+	Close()
+	MaxCost() int64
+	UpdateMaxCost(maxCost int64)
+}
+
 type Block struct {
 	offset            int
 	data              []byte
@@ -254,8 +314,10 @@ func CreateTable(fname string, builder *Builder) (*Table, error) {
 
 	written := bd.Copy(mf.Data)
 	y.AssertTrue(written == len(mf.Data))
-	if err := z.Msync(mf.Data); err != nil {
-		return nil, y.Wrapf(err, "while calling msync on %s", fname)
+	if !builder.opts.NoSync {
+		if err := z.Msync(mf.Data); err != nil {
+			return nil, y.Wrapf(err, "while calling msync on %s", fname)
+		}
 	}
 	return OpenTable(mf, *builder.opts)
 }
@@ -330,6 +392,95 @@ func OpenInMemoryTable(data []byte, id uint64, opt *Options) (*Table, error) {
 	return t, nil
 }
 
+// tableTailSize is the size of the first read of the tail of a table opened by
+// OpenTableReaderAt. It fits the index of most tables.
+const tableTailSize = 64 << 10
+
+// OpenTableReaderAt is similar to OpenInMemoryTable but it opens the table of the given size in
+// r, such as a table in object storage. The index of the table is read once, and its blocks are
+// read from r as they are needed, so r must stay usable until the table is closed. If r has a
+// Close or a Delete method, it's called when the table is closed or deleted.
+func OpenTableReaderAt(r io.ReaderAt, size int64, id uint64, opt *Options) (*Table, error) {
+	tail, err := readTableTail(r, size)
+	if err != nil {
+		return nil, y.Wrapf(err, "while reading the index of table %d", id)
+	}
+	t := &Table{
+		MmapFile:   &z.MmapFile{},
+		opt:        opt,
+		tableSize:  int(size),
+		IsInmemory: false, // Its file persists in r, unlike the one of an in-memory table.
+		id:         id,
+		src:        r,
+		tail:       tail,
+		tailOff:    int(size) - len(tail),
+	}
+	// Caller is given one reference.
+	t.ref.Store(1)
+
+	if err := t.initBiggestAndSmallest(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// IsRemote returns whether the table is read from the reader given to OpenTableReaderAt.
+func (t *Table) IsRemote() bool {
+	return t.src != nil
+}
+
+// Delete deletes the file of the table. The reader of a table opened by OpenTableReaderAt is
+// deleted, if it has a Delete method.
+func (t *Table) Delete() error {
+	if d, ok := t.src.(interface{ Delete() error }); ok {
+		return d.Delete()
+	}
+	return y.DeleteMmapFile(t.MmapFile)
+}
+
+// Close closes the file of the table, truncating it to maxSz if not negative. The reader of a
+// table opened by OpenTableReaderAt is closed, if it has a Close method.
+func (t *Table) Close(maxSz int64) error {
+	if c, ok := t.src.(io.Closer); ok {
+		return c.Close()
+	}
+	return t.MmapFile.Close(maxSz)
+}
+
+// readTableTail reads the end of the table of the given size in r, from its index on.
+func readTableTail(r io.ReaderAt, size int64) ([]byte, error) {
+	var tail []byte
+	// need returns the n last bytes of the table, reading more of it if needed.
+	need := func(n int64) ([]byte, error) {
+		if n > size {
+			return nil, errors.New("table index out of bounds. Data corrupted")
+		}
+		if n > int64(len(tail)) {
+			buf := make([]byte, min(max(n, tableTailSize), size))
+			if read, err := r.ReadAt(buf, size-int64(len(buf))); read < len(buf) {
+				if err == nil || err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return nil, err
+			}
+			tail = buf
+		}
+		return tail[int64(len(tail))-n:], nil
+	}
+	// The footer is the index, the index length, the checksum and the checksum length.
+	n := int64(4)
+	buf, err := need(n)
+	if err != nil {
+		return nil, err
+	}
+	n += int64(y.BytesToU32(buf)) + 4
+	if buf, err = need(n); err != nil {
+		return nil, err
+	}
+	n += int64(y.BytesToU32(buf))
+	return need(n)
+}
+
 func (t *Table) initBiggestAndSmallest() error {
 	// This defer will help gathering debugging info in case initIndex crashes.
 	defer func() {
@@ -404,7 +555,22 @@ func (t *Table) initBiggestAndSmallest() error {
 }
 
 func (t *Table) read(off, sz int) ([]byte, error) {
-	return t.Bytes(off, sz)
+	switch {
+	case t.src == nil:
+		return t.Bytes(off, sz)
+	case off < 0 || sz < 0 || off+sz > t.tableSize:
+		return nil, io.EOF
+	case off >= t.tailOff:
+		return t.tail[off-t.tailOff : off-t.tailOff+sz], nil
+	}
+	buf := make([]byte, sz)
+	if n, err := t.src.ReadAt(buf, int64(off)); n < sz {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
 }
 
 func (t *Table) readNoFail(off, sz int) []byte {
@@ -463,9 +629,13 @@ func (t *Table) initIndex() (*fb.BlockOffset, error) {
 		OnDiskSize:        index.OnDiskSize(),
 		OffsetsLength:     index.OffsetsLength(),
 		BloomFilterLength: index.BloomFilterLength(),
+		MaxExpiresAt:      index.MaxExpiresAt(),
+		ExpiringKeyCount:  index.ExpiringKeyCount(),
 	}
 
 	t.hasBloomFilter = len(index.BloomFilterBytes()) > 0
+	t.hasPrefixFilter = len(index.PrefixBloomFilterBytes()) > 0 && t.opt.ExtractPrefix != nil &&
+		string(index.PrefixExtractor()) == t.opt.PrefixFilter
 
 	var bo fb.BlockOffset
 	y.AssertTrue(index.Offsets(&bo, 0))
@@ -498,6 +668,84 @@ func (t *Table) KeySplits(n int, prefix []byte) []string {
 	return res
 }
 
+// KeyWeights splits the blocks of the table which may hold keys with prefix into at most n runs
+// of about the same number of blocks, and calls fn with the first key of each run, without its
+// version, and the size of its blocks, in order. The key of a run starting before prefix is
+// prefix. The keys are only valid during the calls.
+func (t *Table) KeyWeights(n int, prefix []byte, fn func(key []byte, size uint64)) {
+	var bo fb.BlockOffset
+	oLen := t.offsetsLength()
+	firstKey := func(i int) []byte {
+		y.AssertTrue(t.offsets(&bo, i))
+		return y.ParseKey(bo.KeyBytes())
+	}
+	// The blocks from start to end may hold keys with prefix: the one starting before it, if it
+	// goes past it, and those starting with it.
+	lo := sort.Search(oLen, func(i int) bool { return bytes.Compare(firstKey(i), prefix) > 0 })
+	start, end := lo, lo
+	if lo > 0 && (lo < oLen || bytes.Compare(y.ParseKey(t.biggest), prefix) >= 0) {
+		start = lo - 1
+	}
+	for end < oLen && bytes.HasPrefix(firstKey(end), prefix) {
+		end++
+	}
+	if start == end || n <= 0 {
+		return
+	}
+
+	jump := (end - start + n - 1) / n
+	for i := start; i < end; i += jump {
+		var size uint64
+		for j := i; j < min(i+jump, end); j++ {
+			y.AssertTrue(t.offsets(&bo, j))
+			size += uint64(bo.Len())
+		}
+		key := firstKey(i)
+		if bytes.Compare(key, prefix) < 0 {
+			key = prefix
+		}
+		fn(key, size)
+	}
+}
+
+// Warm loads the index of the table, with its bloom filter, into the index cache if the table is
+// encrypted; unencrypted tables keep their index in memory. If blocks is set, it loads the blocks
+// which may hold keys with prefix into the block cache as well, and returns how many. It stops
+// early if ctx is done.
+func (t *Table) Warm(ctx context.Context, prefix []byte, blocks bool) (int, error) {
+	t.fetchIndex()
+	if !blocks || t.opt.BlockCache == nil {
+		return 0, nil
+	}
+	var ko fb.BlockOffset
+	seek := y.KeyWithTs(prefix, math.MaxUint64)
+	start := sort.Search(t.offsetsLength(), func(i int) bool {
+		y.AssertTrue(t.offsets(&ko, i))
+		return y.CompareKeys(ko.KeyBytes(), seek) > 0
+	})
+	// The block before the first one starting after seek may hold keys with prefix.
+	if start > 0 {
+		start--
+	}
+	var n int
+	for i := start; i < t.offsetsLength(); i++ {
+		y.AssertTrue(t.offsets(&ko, i))
+		if i > start && !bytes.HasPrefix(y.ParseKey(ko.KeyBytes()), prefix) {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		blk, err := t.block(i, true)
+		if err != nil {
+			return n, err
+		}
+		blk.decrRef()
+		n++
+	}
+	return n, nil
+}
+
 func (t *Table) fetchIndex() *fb.TableIndex {
 	if !t.shouldDecrypt() {
 		return t._index
@@ -552,7 +800,7 @@ func (t *Table) block(idx int, useCache bool) (*Block, error) {
 	if blk.data, err = t.read(blk.offset, int(ko.Len())); err != nil {
 		return nil, y.Wrapf(err,
 			"failed to read from file: %s at offset: %d, len: %d",
-			t.Fd.Name(), blk.offset, ko.Len())
+			t.Filename(), blk.offset, ko.Len())
 	}
 
 	if t.shouldDecrypt() {
@@ -567,7 +815,7 @@ func (t *Table) block(idx int, useCache bool) (*Block, error) {
 	if err = t.decompress(blk); err != nil {
 		return nil, y.Wrapf(err,
 			"failed to decode compressed data in file: %s at offset: %d, len: %d",
-			t.Fd.Name(), blk.offset, ko.Len())
+			t.Filename(), blk.offset, ko.Len())
 	}
 
 	// Read meta data related to block.
@@ -627,17 +875,20 @@ func (t *Table) blockCacheKey(idx int) []byte {
 	y.AssertTrue(t.id < math.MaxUint32)
 	y.AssertTrue(uint32(idx) < math.MaxUint32)
 
-	buf := make([]byte, 8)
+	buf := make([]byte, 8, 12)
 	// Assume t.ID does not overflow uint32.
 	binary.BigEndian.PutUint32(buf[:4], uint32(t.ID()))
 	binary.BigEndian.PutUint32(buf[4:], uint32(idx))
+	if t.opt.CacheID != 0 {
+		buf = binary.BigEndian.AppendUint32(buf, t.opt.CacheID)
+	}
 	return buf
 }
 
 // indexKey returns the cache key for block offsets. blockOffsets
 // are stored in the index cache.
 func (t *Table) indexKey() uint64 {
-	return t.id
+	return uint64(t.opt.CacheID)<<32 | t.id
 }
 
 // IndexSize is the size of table index in bytes.
@@ -657,8 +908,14 @@ func (t *Table) Smallest() []byte { return t.smallest }
 // Biggest is its biggest key, or nil if there are none
 func (t *Table) Biggest() []byte { return t.biggest }
 
-// Filename is NOT the file name.  Just kidding, it is.
-func (t *Table) Filename() string { return t.Fd.Name() }
+// Filename is NOT the file name.  Just kidding, it is. Tables without a file get the name
+// they would have.
+func (t *Table) Filename() string {
+	if t.Fd == nil {
+		return IDToFilename(t.id)
+	}
+	return t.Fd.Name()
+}
 
 // ID is the table's ID number (used to make the file name).
 func (t *Table) ID() uint64 { return t.id }
@@ -670,16 +927,45 @@ func (t *Table) DoesNotHave(hash uint32) bool {
 		return false
 	}
 
-	y.NumLSMBloomHitsAdd(t.opt.MetricsEnabled, "DoesNotHave_ALL", 1)
+	t.bloomHitsAdd("DoesNotHave_ALL")
 	index := t.fetchIndex()
 	bf := index.BloomFilterBytes()
 	mayContain := y.Filter(bf).MayContain(hash)
 	if !mayContain {
-		y.NumLSMBloomHitsAdd(t.opt.MetricsEnabled, "DoesNotHave_HIT", 1)
+		t.bloomHitsAdd("DoesNotHave_HIT")
 	}
 	return !mayContain
 }
 
+// DoesNotHavePrefix returns true if the table has no key starting with prefix, as told by its
+// prefix bloom filter. The keys starting with prefix must have the prefix Options.ExtractPrefix
+// returns for prefix.
+func (t *Table) DoesNotHavePrefix(prefix []byte) bool {
+	if !t.hasPrefixFilter {
+		return false
+	}
+	p := t.opt.ExtractPrefix(prefix)
+	if len(p) == 0 {
+		return false
+	}
+
+	t.bloomHitsAdd("DoesNotHavePrefix_ALL")
+	index := t.fetchIndex()
+	mayContain := y.Filter(index.PrefixBloomFilterBytes()).MayContain(y.Hash(p))
+	if !mayContain {
+		t.bloomHitsAdd("DoesNotHavePrefix_HIT")
+	}
+	return !mayContain
+}
+
+func (t *Table) bloomHitsAdd(key string) {
+	if t.opt.Metrics != nil {
+		t.opt.Metrics.NumLSMBloomHitsAdd(key, 1)
+		return
+	}
+	y.NumLSMBloomHitsAdd(t.opt.MetricsEnabled, key, 1)
+}
+
 // readTableIndex reads table index from the sst and returns its pb format.
 func (t *Table) readTableIndex() (*fb.TableIndex, error) {
 	data := t.readNoFail(t.indexStart, t.indexLen)
@@ -734,6 +1020,14 @@ func (t *Table) KeyID() uint64 {
 	return 0
 }
 
+// EncryptionAlgo returns the algorithm the table is encrypted with, as set on its data key.
+func (t *Table) EncryptionAlgo() pb.EncryptionAlgo {
+	if t.opt.DataKey != nil {
+		return t.opt.DataKey.EncryptionAlgo
+	}
+	return pb.EncryptionAlgo_aes
+}
+
 // decrypt decrypts the given data. It should be called only after checking shouldDecrypt.
 func (t *Table) decrypt(data []byte, viaCalloc bool) ([]byte, error) {
 	// Last BlockSize bytes of the data is the IV.
@@ -741,13 +1035,21 @@ func (t *Table) decrypt(data []byte, viaCalloc bool) ([]byte, error) {
 	// Rest all bytes are data.
 	data = data[:len(data)-aes.BlockSize]
 
+	algo := t.opt.DataKey.EncryptionAlgo
+	sz := len(data) - y.SealOverhead(algo)
+	if sz < 0 {
+		return nil, errors.New("encrypted data shorter than its tag. Data corrupted")
+	}
 	var dst []byte
 	if viaCalloc {
-		dst = z.Calloc(len(data), "Table.Decrypt")
+		dst = z.Calloc(sz, "Table.Decrypt")
 	} else {
-		dst = make([]byte, len(data))
+		dst = make([]byte, sz)
 	}
-	if err := y.XORBlock(dst, data, t.opt.DataKey.Data, iv); err != nil {
+	if err := y.OpenBlock(algo, dst, data, t.opt.DataKey.Data, iv, nil); err != nil {
+		if viaCalloc {
+			z.Free(dst)
+		}
 		return nil, y.Wrapf(err, "while decrypt")
 	}
 	return dst, nil
@@ -811,7 +1113,11 @@ func (t *Table) decompress(b *Block) error {
 			sz = int(hdr.FrameContentSize)
 		}
 		dst = z.Calloc(sz, "Table.Decompress")
-		b.data, err = y.ZSTDDecompress(dst, b.data)
+		if t.opt.ZSTDDecoder != nil {
+			b.data, err = t.opt.ZSTDDecoder.Decompress(dst, b.data)
+		} else {
+			b.data, err = y.ZSTDDecompress(dst, b.data)
+		}
 		if err != nil {
 			z.Free(dst)
 			return y.Wrap(err, "failed to decompress")
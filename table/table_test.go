@@ -882,6 +882,38 @@ func TestDoesNotHaveRace(t *testing.T) {
 	wg.Wait()
 }
 
+func TestDoesNotHavePrefix(t *testing.T) {
+	opts := getTestTableOptions()
+	opts.ExtractPrefix = func(key []byte) []byte {
+		if len(key) < 3 {
+			return nil
+		}
+		return key[:3]
+	}
+	opts.PrefixFilter = "fixed:3"
+	var keyValues [][]string
+	for _, prefix := range []string{"aa/", "cc/", "ee/"} {
+		for i := 0; i < 100; i++ {
+			keyValues = append(keyValues, []string{key(prefix, i), "v"})
+		}
+	}
+	tbl := buildTable(t, keyValues, opts)
+	defer func() { require.NoError(t, tbl.DecrRef()) }()
+
+	require.False(t, tbl.DoesNotHavePrefix([]byte("aa/")))
+	require.False(t, tbl.DoesNotHavePrefix([]byte("cc/00")))
+	require.True(t, tbl.DoesNotHavePrefix([]byte("bb/")))
+	require.True(t, tbl.DoesNotHavePrefix([]byte("dd/00")))
+	// The prefix "d" has no prefix of the extractor, and any key may start with it.
+	require.False(t, tbl.DoesNotHavePrefix([]byte("d")))
+
+	// The filter of another extractor isn't used.
+	opts.PrefixFilter = "fixed:2"
+	other, err := OpenTable(tbl.MmapFile, opts)
+	require.NoError(t, err)
+	require.False(t, other.DoesNotHavePrefix([]byte("bb/")))
+}
+
 func TestMaxVersion(t *testing.T) {
 	opt := getTestTableOptions()
 	b := NewTableBuilder(opt)
@@ -896,3 +928,37 @@ func TestMaxVersion(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, N, int(table.MaxVersion()))
 }
+
+func TestOpenTableReaderAt(t *testing.T) {
+	// The index of the table with small blocks doesn't fit in the first read of the tail.
+	for _, blockSize := range []int{4 << 10, 64} {
+		t.Run(fmt.Sprintf("blockSize=%d", blockSize), func(t *testing.T) {
+			opts := getTestTableOptions()
+			opts.BlockSize = blockSize
+			tbl := buildTestTable(t, "key", 10000, opts)
+			defer func() { require.NoError(t, tbl.DecrRef()) }()
+			data := tbl.Data[:tbl.Size()]
+
+			remote, err := OpenTableReaderAt(bytes.NewReader(data), int64(len(data)), 1, &opts)
+			require.NoError(t, err)
+			defer func() { require.NoError(t, remote.DecrRef()) }()
+			require.Equal(t, tbl.Smallest(), remote.Smallest())
+			require.Equal(t, tbl.Biggest(), remote.Biggest())
+			require.Equal(t, tbl.KeyCount(), remote.KeyCount())
+			require.NoError(t, remote.VerifyChecksum())
+
+			it := remote.NewIterator(0)
+			defer it.Close()
+			count := 0
+			for it.Rewind(); it.Valid(); it.Next() {
+				require.EqualValues(t, y.KeyWithTs([]byte(key("key", count)), 0), it.Key())
+				require.EqualValues(t, fmt.Sprintf("%d", count), string(it.Value().Value))
+				count++
+			}
+			require.Equal(t, 10000, count)
+
+			_, err = OpenTableReaderAt(bytes.NewReader(data[:100]), int64(len(data)), 1, &opts)
+			require.Error(t, err)
+		})
+	}
+}
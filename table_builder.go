@@ -0,0 +1,91 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/luxfi/zapdb/table"
+	"github.com/luxfi/zapdb/y"
+)
+
+// TableBuilder builds a table file without a DB, e.g. from a snapshot, to be moved into a DB by
+// IngestExternalFiles. The values are stored in the table, whatever their size, and the table
+// is neither encrypted nor compressed with a dictionary.
+type TableBuilder struct {
+	b *table.Builder
+	// last is the last key added, with its version.
+	last []byte
+}
+
+// NewTableBuilder returns a TableBuilder of a table for the DBs opened with opt: its blocks are
+// of opt.BlockSize, compressed with opt.Compression, and its bloom filters are built with
+// opt.BloomFalsePositive and opt.PrefixExtractor. ReachedCapacity tells when it has about
+// opt.BaseTableSize bytes.
+func NewTableBuilder(opt Options) *TableBuilder {
+	return &TableBuilder{b: table.NewTableBuilder(table.Options{
+		TableSize:            uint64(opt.BaseTableSize),
+		BlockSize:            opt.BlockSize,
+		BloomFalsePositive:   opt.BloomFalsePositive,
+		Compression:          opt.Compression,
+		ZSTDCompressionLevel: opt.ZSTDCompressionLevel,
+		ExtractPrefix:        opt.PrefixExtractor.Extract,
+		PrefixFilter:         opt.PrefixExtractor.Name,
+	})}
+}
+
+// Add adds the key of e at version, which must be positive, with its value, user metadata and
+// expiration. The keys must be added in increasing order, and the versions of a key in
+// decreasing order.
+func (b *TableBuilder) Add(e *Entry, version uint64) error {
+	if version == 0 {
+		return fmt.Errorf("Invalid version 0 of key %q", e.Key)
+	}
+	key := y.KeyWithTs(e.Key, version)
+	if b.last != nil && y.CompareKeys(b.last, key) >= 0 {
+		return fmt.Errorf("Key %q at version %d added out of order, after %q at version %d",
+			e.Key, version, y.ParseKey(b.last), y.ParseTs(b.last))
+	}
+	b.b.Add(key, y.ValueStruct{
+		Value:     e.Value,
+		Meta:      e.meta &^ bitValuePointer,
+		UserMeta:  e.UserMeta,
+		ExpiresAt: e.ExpiresAt,
+	}, 0)
+	b.last = key
+	return nil
+}
+
+// Empty returns whether no key was added.
+func (b *TableBuilder) Empty() bool {
+	return b.b.Empty()
+}
+
+// ReachedCapacity returns whether the table has about the size of a table of the DB, so that the
+// next keys go to a new table.
+func (b *TableBuilder) ReachedCapacity() bool {
+	return b.b.ReachedCapacity()
+}
+
+// Finish writes the table into the new file path, and syncs it. The TableBuilder can't be used
+// afterwards.
+func (b *TableBuilder) Finish(path string) error {
+	defer b.Close()
+	if b.b.Empty() {
+		return errors.New("Cannot write an empty table")
+	}
+	_, err := writeTableFile(path, b.b)
+	return err
+}
+
+// Close releases the memory of the TableBuilder, without writing the table.
+func (b *TableBuilder) Close() {
+	if b.b != nil {
+		b.b.Close()
+		b.b = nil
+	}
+}
@@ -0,0 +1,320 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+
+	"github.com/luxfi/zapdb/table"
+	"github.com/luxfi/zapdb/y"
+)
+
+// Refresh catches a DB opened with Options.ReadOnly up with the writes of the process writing to
+// its directory since it was opened, or last refreshed: the transactions appended to the WALs,
+// the tables flushed and compacted, and the value log files written. The transactions started
+// afterwards read them, while those running keep reading as of their start. With
+// Options.RefreshInterval, the DB refreshes itself periodically, as a read replica on the same
+// host.
+//
+// The tables, WALs and value log files deleted by the writer are closed once they aren't read
+// anymore, and those it wrote again under the same IDs, after a DropAll, are opened again. Refresh fails, and can be retried, if a file it opens is deleted or created
+// meanwhile. With encryption, the data keys are only read at the opening, so the files
+// encrypted with the keys rotated since can't be read. Refresh returns ErrNotReadOnly if the DB
+// isn't read-only, or was opened by OpenAt.
+func (db *DB) Refresh() error {
+	if !db.opt.ReadOnly || db.opt.InMemory || db.opt.asOf != 0 {
+		return ErrNotReadOnly
+	}
+	if db.IsClosed() {
+		return ErrDBClosed
+	}
+	db.refreshLock.Lock()
+	defer db.refreshLock.Unlock()
+
+	// The WALs are read before the manifest, and the memtables whose WALs are gone dropped
+	// after, so that the writes flushed in between are read from either.
+	fids, err := memTableFids(db.opt.Dir)
+	if err != nil {
+		return err
+	}
+	if err := db.refreshMemTables(fids); err != nil {
+		return err
+	}
+	if err := db.lc.refresh(); err != nil {
+		return err
+	}
+	db.dropMemTables(fids)
+	// The value log files are listed last, so that the values of the entries read are in them.
+	if err := db.vlog.refresh(); err != nil {
+		return err
+	}
+
+	// The next transactions read up to the last version replayed.
+	maxVersion := db.MaxVersion()
+	db.orc.Lock()
+	defer db.orc.Unlock()
+	if maxVersion >= db.orc.nextTxnTs {
+		db.orc.txnMark.Done(maxVersion)
+		db.orc.nextTxnTs = maxVersion + 1
+	}
+	return nil
+}
+
+// refreshMemTables replays the transactions appended to the WALs of fids since they were last
+// replayed, opening the new ones.
+func (db *DB) refreshMemTables(fids []int) error {
+	db.lock.RLock()
+	replayed := make(map[int]bool, len(db.imm))
+	for _, mt := range db.imm {
+		if sameFile(mt.wal.Fd, mt.wal.path) {
+			replayed[int(mt.wal.fid)] = true
+		}
+	}
+	db.lock.RUnlock()
+
+	var opened []*memTable
+	for _, fid := range fids {
+		if replayed[fid] {
+			continue
+		}
+		mt, err := db.openMemTable(fid, os.O_RDONLY)
+		if err != nil {
+			for _, mt := range opened {
+				mt.DecrRef()
+			}
+			return y.Wrapf(err, "while opening fid: %d", fid)
+		}
+		opened = append(opened, mt)
+	}
+
+	// The memtables are read concurrently with the replay, but their maxVersion is guarded by the
+	// lock.
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	for _, mt := range db.imm {
+		if !replayed[int(mt.wal.fid)] {
+			continue
+		}
+		endOff, err := mt.wal.iterate(true, mt.replayed, mt.replayFunction(mt.opt))
+		if err != nil {
+			return y.Wrapf(err, "while iterating wal: %s", mt.wal.Fd.Name())
+		}
+		mt.replayed = endOff
+	}
+	// The WALs are created in the order of their IDs.
+	db.imm = append(db.imm, opened...)
+	return nil
+}
+
+// dropMemTables releases the memtables whose WALs aren't in fids anymore, flushed by the writer,
+// or were replaced.
+func (db *DB) dropMemTables(fids []int) {
+	db.lock.Lock()
+	var imm, dropped []*memTable
+	for _, mt := range db.imm {
+		if slices.Contains(fids, int(mt.wal.fid)) && sameFile(mt.wal.Fd, mt.wal.path) {
+			imm = append(imm, mt)
+		} else {
+			dropped = append(dropped, mt)
+		}
+	}
+	db.imm = imm
+	db.lock.Unlock()
+	for _, mt := range dropped {
+		mt.DecrRef()
+	}
+}
+
+// refresh replaces the tables of the levels by those of the manifest of a read-only DB, opening
+// the new ones and releasing those gone.
+func (s *levelsController) refresh() error {
+	db := s.kv
+	fp, err := os.Open(filepath.Join(db.opt.Dir, ManifestFilename))
+	if err != nil {
+		return err
+	}
+	mf, _, err := ReplayManifestFile(fp, db.opt.ExternalMagicVersion, db.opt)
+	_ = fp.Close()
+	if err != nil {
+		return y.Wrapf(err, "while replaying manifest")
+	}
+
+	old := make([][]*table.Table, len(s.levels))
+	current := make(map[uint64]*table.Table)
+	for i, l := range s.levels {
+		l.RLock()
+		old[i] = slices.Clone(l.tables)
+		l.RUnlock()
+		for _, t := range old[i] {
+			current[t.ID()] = t
+		}
+	}
+	// The writer starts the IDs of the tables over after a DropAll. The tables written again
+	// under the ID of one still open are opened, in a new space of the caches, as the keys of
+	// their blocks are their IDs.
+	replaced := false
+	for id, t := range current {
+		if t.Fd != nil && !sameFile(t.Fd, t.Fd.Name()) {
+			delete(current, id)
+			replaced = true
+		}
+	}
+	if replaced {
+		if m := db.opt.manager; m != nil {
+			db.cacheID = m.nextCacheID()
+		} else {
+			db.cacheID = blockCacheIDs.Add(1)
+		}
+	}
+	tables := make([][]*table.Table, len(s.levels))
+	for id, tm := range mf.Tables {
+		t, ok := current[id]
+		if ok {
+			t.IncrRef()
+		} else if t, err = openTable(db, id, tm); err != nil {
+			decrRefs(slices.Concat(tables...))
+			return err
+		} else if t == nil {
+			continue
+		}
+		tables[tm.Level] = append(tables[tm.Level], t)
+	}
+
+	// The levels are replaced from the bottom up, so that the reads going down the levels
+	// meanwhile find the keys compacted down in one of them.
+	for i := len(s.levels) - 1; i >= 0; i-- {
+		s.levels[i].initTables(tables[i])
+	}
+	return decrRefs(slices.Concat(old...))
+}
+
+// refresh opens the value log files written by the process writing to the directory of a
+// read-only DB, and closes those it deleted once no iterator reads them.
+func (vlog *valueLog) refresh() error {
+	files, err := os.ReadDir(vlog.dirPath)
+	if err != nil {
+		return errFile(err, vlog.dirPath, "Unable to open log dir.")
+	}
+	found := make(map[uint32]bool)
+	for _, file := range files {
+		name, ok := strings.CutSuffix(file.Name(), ".vlog")
+		if !ok {
+			continue
+		}
+		fid, err := strconv.ParseUint(name, 10, 32)
+		if err != nil {
+			return errFile(err, file.Name(), "Unable to parse log id.")
+		}
+		found[uint32(fid)] = true
+	}
+
+	// The files written again under the ID of one still open, after a DropAll, are opened in its
+	// place.
+	vlog.filesLock.RLock()
+	var fids []uint32
+	replaced := make(map[uint32]bool)
+	for fid := range found {
+		if lf, ok := vlog.filesMap[fid]; !ok {
+			fids = append(fids, fid)
+		} else if !sameFile(lf.Fd, lf.path) {
+			fids = append(fids, fid)
+			replaced[fid] = true
+		}
+	}
+	vlog.filesLock.RUnlock()
+
+	var opened []*logFile
+	for _, fid := range fids {
+		lf := &logFile{
+			fid:      fid,
+			path:     vlog.fpath(fid),
+			registry: vlog.db.registry,
+			opt:      vlog.opt,
+		}
+		if err := lf.open(lf.path, os.O_RDONLY, 2*vlog.opt.ValueLogFileSize); err != nil {
+			for _, lf := range opened {
+				_ = lf.Close(-1)
+			}
+			return y.Wrapf(err, "Open existing file: %q", lf.path)
+		}
+		opened = append(opened, lf)
+	}
+
+	vlog.filesLock.Lock()
+	if len(replaced) > 0 && vlog.iteratorCount() > 0 {
+		vlog.filesLock.Unlock()
+		for _, lf := range opened {
+			_ = lf.Close(-1)
+		}
+		return errors.New("Value log files were replaced while iterators read them")
+	}
+	var gone []*logFile
+	for _, lf := range opened {
+		if replaced[lf.fid] {
+			gone = append(gone, vlog.filesMap[lf.fid])
+		}
+		vlog.filesMap[lf.fid] = lf
+	}
+	if vlog.iteratorCount() == 0 {
+		for fid, lf := range vlog.filesMap {
+			if !found[fid] {
+				gone = append(gone, lf)
+				delete(vlog.filesMap, fid)
+			}
+		}
+	}
+	vlog.maxFid = 0
+	for fid := range vlog.filesMap {
+		vlog.maxFid = max(vlog.maxFid, fid)
+	}
+	vlog.filesLock.Unlock()
+
+	var rerr error
+	for _, lf := range gone {
+		// Wait for the reads of the file.
+		lf.lock.Lock()
+		if err := lf.Close(-1); err != nil && rerr == nil {
+			rerr = err
+		}
+		lf.lock.Unlock()
+	}
+	return rerr
+}
+
+// sameFile returns whether f is still the file at path, and not one written there since.
+func sameFile(f *os.File, path string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	pi, err := os.Stat(path)
+	return err == nil && os.SameFile(fi, pi)
+}
+
+// runRefresh refreshes the DB every RefreshInterval, until lc is closed.
+func (db *DB) runRefresh(lc *z.Closer) {
+	defer lc.Done()
+	ticker := time.NewTicker(db.opt.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lc.HasBeenClosed():
+			return
+		case <-ticker.C:
+			if err := db.Refresh(); err != nil {
+				db.opt.Warningf("While refreshing the DB: %v", err)
+			}
+		}
+	}
+}
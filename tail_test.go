@@ -0,0 +1,147 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefresh(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("Read-only mode is not supported")
+	}
+	opt := getTestOptions(t.TempDir()).
+		WithMemTableSize(1 << 20).
+		WithValueLogFileSize(1 << 20).
+		WithValueThreshold(1 << 10).
+		WithBaseTableSize(1 << 18)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	val := func(i int) []byte {
+		// Every fourth value goes to the value log.
+		if i%4 == 0 {
+			return bytes.Repeat([]byte{byte(i)}, 2<<10)
+		}
+		return []byte(fmt.Sprint(i))
+	}
+	write := func(from, to int) {
+		for i := from; i < to; i += 100 {
+			wb := db.NewWriteBatch()
+			for j := i; j < min(i+100, to); j++ {
+				require.NoError(t, wb.Set([]byte(fmt.Sprintf("key%06d", j)), val(j)))
+			}
+			require.NoError(t, wb.Flush())
+		}
+	}
+	check := func(ro *DB, n int) {
+		require.NoError(t, ro.View(func(txn *Txn) error {
+			it := txn.NewIterator(DefaultIteratorOptions)
+			defer it.Close()
+			i := 0
+			for it.Rewind(); it.Valid(); it.Next() {
+				require.Equal(t, []byte(fmt.Sprintf("key%06d", i)), it.Item().Key())
+				require.Equal(t, val(i), getItemValue(t, it.Item()))
+				i++
+			}
+			require.Equal(t, n, i)
+			return nil
+		}))
+	}
+
+	write(0, 1000)
+	ro, err := Open(opt.WithReadOnly(true))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, ro.Close()) }()
+	check(ro, 1000)
+
+	// The writes flushed, compacted, or in new WALs and value log files are read once refreshed.
+	write(1000, 5000)
+	require.NoError(t, db.Flatten(1))
+	write(5000, 6000)
+	check(ro, 1000)
+	require.NoError(t, ro.Refresh())
+	check(ro, 6000)
+
+	// The transactions running keep their view.
+	txn := ro.NewTransaction(false)
+	defer txn.Discard()
+	write(6000, 7000)
+	require.NoError(t, ro.Refresh())
+	_, err = txn.Get([]byte("key006000"))
+	require.ErrorIs(t, err, ErrKeyNotFound)
+	check(ro, 7000)
+
+	// With a RefreshInterval, the DB refreshes itself.
+	tail, err := Open(opt.WithReadOnly(true).WithRefreshInterval(10 * time.Millisecond))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, tail.Close()) }()
+	write(7000, 8000)
+	require.Eventually(t, func() bool {
+		return tail.View(func(txn *Txn) error {
+			_, err := txn.Get([]byte("key007999"))
+			return err
+		}) == nil
+	}, 10*time.Second, 10*time.Millisecond)
+	check(tail, 8000)
+
+	require.ErrorIs(t, db.Refresh(), ErrNotReadOnly)
+}
+
+func TestRefreshAfterDropAll(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("Read-only mode is not supported")
+	}
+	opt := getTestOptions(t.TempDir()).WithValueThreshold(1 << 10)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	val := func(gen, i int) []byte { return bytes.Repeat([]byte{byte(gen), byte(i)}, 1<<10) }
+	write := func(gen, n int) {
+		wb := db.NewWriteBatch()
+		for i := 0; i < n; i++ {
+			require.NoError(t, wb.Set([]byte(fmt.Sprintf("key%04d", i)), val(gen, i)))
+		}
+		require.NoError(t, wb.Flush())
+		require.NoError(t, db.flushMemTableForCheckpoint())
+	}
+	check := func(ro *DB, gen, n int) {
+		require.NoError(t, ro.View(func(txn *Txn) error {
+			it := txn.NewIterator(DefaultIteratorOptions)
+			defer it.Close()
+			i := 0
+			for it.Rewind(); it.Valid(); it.Next() {
+				require.Equal(t, []byte(fmt.Sprintf("key%04d", i)), it.Item().Key())
+				require.Equal(t, val(gen, i), getItemValue(t, it.Item()))
+				i++
+			}
+			require.Equal(t, n, i)
+			return nil
+		}))
+		require.NotEmpty(t, ro.Tables())
+	}
+
+	write(1, 1000)
+	ro, err := Open(opt.WithReadOnly(true))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, ro.Close()) }()
+	check(ro, 1, 1000)
+
+	// The writer starts the IDs of its tables and value log files over, and the read-only DB
+	// reads the new files written under the IDs of those it has open.
+	require.NoError(t, db.DropAll())
+	write(2, 500)
+	require.NoError(t, ro.Refresh())
+	check(ro, 2, 500)
+}
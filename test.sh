@@ -61,6 +61,8 @@ manual() {
 	go test $tags $timeout $covermode $coverprofile -failfast -run='TestBigStream' --manual=true && write_coverage || return 1
 	go test $tags $timeout $covermode $coverprofile -failfast -run='TestGoroutineLeak' --manual=true && write_coverage || return 1
 	go test $tags $timeout $covermode $coverprofile -failfast -run='TestGetMore' --manual=true && write_coverage || return 1
+	# The failpoints are compiled in only with their build tag.
+	go test $tags,failpoints $timeout $covermode $coverprofile -failfast -run='Failpoint' . ./failpoint && write_coverage || return 1
 
 	echo "==> DONE manual tests"
 }
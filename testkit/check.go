@@ -0,0 +1,70 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package testkit
+
+import (
+	"bytes"
+	"fmt"
+
+	badger "github.com/luxfi/zapdb"
+)
+
+// CheckIteratorOrder checks that an iterator over the DB returns keys in strictly increasing
+// order, or strictly decreasing order if reverse is set.
+func CheckIteratorOrder(db *badger.DB, reverse bool) error {
+	return db.View(func(txn *badger.Txn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.PrefetchValues = false
+		opt.Reverse = reverse
+		it := txn.NewIterator(opt)
+		defer it.Close()
+
+		var prev []byte
+		for it.Rewind(); it.Valid(); it.Next() {
+			key := it.Item().Key()
+			if prev != nil {
+				cmp := bytes.Compare(prev, key)
+				if (!reverse && cmp >= 0) || (reverse && cmp <= 0) {
+					return fmt.Errorf("iterator out of order (reverse=%v): %q followed by %q",
+						reverse, prev, key)
+				}
+			}
+			prev = append(prev[:0], key...)
+		}
+		return nil
+	})
+}
+
+// CheckVersionMonotonicity checks that all versions of every key are returned in strictly
+// decreasing version order, and that no version is above the read timestamp.
+func CheckVersionMonotonicity(db *badger.DB) error {
+	return db.View(func(txn *badger.Txn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.PrefetchValues = false
+		opt.AllVersions = true
+		it := txn.NewIterator(opt)
+		defer it.Close()
+
+		readTs := txn.ReadTs()
+		var prevKey []byte
+		var prevVersion uint64
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			version := item.Version()
+			if version > readTs {
+				return fmt.Errorf("key %q has version %d above read timestamp %d",
+					item.Key(), version, readTs)
+			}
+			if bytes.Equal(prevKey, item.Key()) && version >= prevVersion {
+				return fmt.Errorf("key %q has version %d after version %d",
+					item.Key(), version, prevVersion)
+			}
+			prevKey = append(prevKey[:0], item.Key()...)
+			prevVersion = version
+		}
+		return nil
+	})
+}
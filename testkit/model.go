@@ -0,0 +1,202 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package testkit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	badger "github.com/luxfi/zapdb"
+)
+
+type modelValue struct {
+	value     []byte
+	expiresAt uint64
+}
+
+// Model is an in-memory reference implementation of the key-value semantics of zapdb.
+type Model struct {
+	kv map[string]modelValue
+}
+
+// NewModel returns an empty Model.
+func NewModel() *Model {
+	return &Model{kv: make(map[string]modelValue)}
+}
+
+// Apply applies a set or delete Op to the model. Gets are ignored.
+func (m *Model) Apply(op Op, expiresAt uint64) {
+	switch op.Kind {
+	case OpSet:
+		m.kv[string(op.Key)] = modelValue{value: op.Value, expiresAt: expiresAt}
+	case OpDelete:
+		delete(m.kv, string(op.Key))
+	}
+}
+
+// Get returns the value of the key at time now, and whether it was found.
+func (m *Model) Get(key []byte, now time.Time) ([]byte, bool) {
+	v, ok := m.kv[string(key)]
+	if !ok || expired(v.expiresAt, now) {
+		return nil, false
+	}
+	return v.value, true
+}
+
+// Keys returns the sorted keys of the model which are live at time now.
+func (m *Model) Keys(now time.Time) [][]byte {
+	var keys [][]byte
+	for k, v := range m.kv {
+		if !expired(v.expiresAt, now) {
+			keys = append(keys, []byte(k))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	return keys
+}
+
+func expired(expiresAt uint64, now time.Time) bool {
+	return expiresAt != 0 && expiresAt <= uint64(now.Unix())
+}
+
+// nearExpiry returns true if the key expires within a second of now, in which case the DB and
+// the model may legitimately disagree on whether it is live.
+func nearExpiry(expiresAt uint64, now time.Time) bool {
+	if expiresAt == 0 {
+		return false
+	}
+	d := int64(expiresAt) - now.Unix()
+	return d >= -1 && d <= 1
+}
+
+// OpenInMemory opens an in-memory DB, without logging, which is closed when tb ends.
+func OpenInMemory(tb testing.TB) *badger.DB {
+	tb.Helper()
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		tb.Fatalf("opening in-memory DB: %v", err)
+	}
+	tb.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			tb.Errorf("closing in-memory DB: %v", err)
+		}
+	})
+	return db
+}
+
+// RunModel applies ops to both db and a fresh Model, one transaction per Op, comparing the result
+// of every get. It then compares the full contents of the DB against the model, and runs the
+// invariant checkers. The returned Model can be used for further checks.
+func RunModel(db *badger.DB, ops []Op) (*Model, error) {
+	m := NewModel()
+	for i, op := range ops {
+		var err error
+		switch op.Kind {
+		case OpSet:
+			e := badger.NewEntry(op.Key, op.Value)
+			if op.TTL > 0 {
+				e = e.WithTTL(op.TTL)
+			}
+			err = db.Update(func(txn *badger.Txn) error { return txn.SetEntry(e) })
+			m.Apply(op, e.ExpiresAt)
+		case OpDelete:
+			err = db.Update(func(txn *badger.Txn) error { return txn.Delete(op.Key) })
+			m.Apply(op, 0)
+		case OpGet:
+			err = compareGet(db, m, op.Key)
+		}
+		if err != nil {
+			return m, fmt.Errorf("op %d (%s %q): %w", i, op.Kind, op.Key, err)
+		}
+	}
+	if err := Compare(db, m); err != nil {
+		return m, err
+	}
+	if err := CheckIteratorOrder(db, false); err != nil {
+		return m, err
+	}
+	if err := CheckIteratorOrder(db, true); err != nil {
+		return m, err
+	}
+	return m, CheckVersionMonotonicity(db)
+}
+
+func compareGet(db *badger.DB, m *Model, key []byte) error {
+	return db.View(func(txn *badger.Txn) error {
+		now := time.Now()
+		want, ok := m.Get(key, now)
+		if v, found := m.kv[string(key)]; found && nearExpiry(v.expiresAt, now) {
+			return nil
+		}
+		item, err := txn.Get(key)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			if ok {
+				return fmt.Errorf("key not found in DB, model has %d bytes", len(want))
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("key found in DB, but not in model")
+		}
+		got, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, want) {
+			return fmt.Errorf("value mismatch: DB has %d bytes, model has %d bytes", len(got), len(want))
+		}
+		return nil
+	})
+}
+
+// Compare checks that the live keys and values in the DB are exactly those of the model.
+func Compare(db *badger.DB, m *Model) error {
+	return db.View(func(txn *badger.Txn) error {
+		now := time.Now()
+		var got [][]byte
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			key := item.KeyCopy(nil)
+			v, ok := m.kv[string(key)]
+			if ok && nearExpiry(v.expiresAt, now) {
+				continue
+			}
+			want, ok := m.Get(key, now)
+			if !ok {
+				return fmt.Errorf("key %q found in DB, but not in model", key)
+			}
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(val, want) {
+				return fmt.Errorf("key %q: value mismatch: DB has %d bytes, model has %d bytes",
+					key, len(val), len(want))
+			}
+			got = append(got, key)
+		}
+
+		var want [][]byte
+		for _, key := range m.Keys(now) {
+			if !nearExpiry(m.kv[string(key)].expiresAt, now) {
+				want = append(want, key)
+			}
+		}
+		if len(got) != len(want) {
+			return fmt.Errorf("DB has %d live keys, model has %d", len(got), len(want))
+		}
+		return nil
+	})
+}
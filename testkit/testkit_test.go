@@ -0,0 +1,62 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package testkit
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkloadDeterministic(t *testing.T) {
+	cfg := DefaultWorkloadConfig()
+	cfg.TTLRatio = 0.5
+	cfg.TTLs = []time.Duration{time.Hour}
+	a := NewWorkload(cfg, 42).Ops(1000)
+	b := NewWorkload(cfg, 42).Ops(1000)
+	require.Equal(t, a, b)
+
+	var sets, ttls int
+	for _, op := range a {
+		require.True(t, bytes.HasPrefix(op.Key, []byte(cfg.KeyPrefix)))
+		if op.Kind == OpSet {
+			sets++
+			require.GreaterOrEqual(t, len(op.Value), cfg.MinValueSize)
+			require.LessOrEqual(t, len(op.Value), cfg.MaxValueSize)
+			if op.TTL > 0 {
+				ttls++
+			}
+		}
+	}
+	require.Greater(t, sets, 0)
+	require.Greater(t, ttls, 0)
+
+	// rand.NewZipf takes a ZipfS above 1: the keys are uniformly distributed otherwise.
+	cfg.ZipfS = 1
+	require.Nil(t, NewWorkload(cfg, 42).zipf)
+}
+
+func TestRunModel(t *testing.T) {
+	db := OpenInMemory(t)
+
+	cfg := DefaultWorkloadConfig()
+	cfg.NumKeys = 200
+	cfg.TTLRatio = 0.2
+	cfg.TTLs = []time.Duration{time.Hour, 24 * time.Hour}
+	_, err := RunModel(db, NewWorkload(cfg, 1).Ops(2000))
+	require.NoError(t, err)
+}
+
+func TestCompareDetectsDivergence(t *testing.T) {
+	db := OpenInMemory(t)
+
+	m, err := RunModel(db, []Op{{Kind: OpSet, Key: []byte("a"), Value: []byte("1")}})
+	require.NoError(t, err)
+	m.Apply(Op{Kind: OpSet, Key: []byte("b"), Value: []byte("2")}, 0)
+	require.Error(t, Compare(db, m))
+}
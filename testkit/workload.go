@@ -0,0 +1,164 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package testkit contains workload generators, invariant checkers and a model-based test
+// harness for zapdb, and OpenInMemory, the DB fixture of the tests of zapdb's packages. It can be
+// used by downstream projects to test their usage of zapdb.
+package testkit
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// OpKind is the kind of an Op.
+type OpKind int
+
+const (
+	OpSet OpKind = iota
+	OpDelete
+	OpGet
+)
+
+func (k OpKind) String() string {
+	switch k {
+	case OpSet:
+		return "set"
+	case OpDelete:
+		return "delete"
+	case OpGet:
+		return "get"
+	}
+	return fmt.Sprintf("OpKind(%d)", int(k))
+}
+
+// Op is a single operation of a workload.
+type Op struct {
+	Kind  OpKind
+	Key   []byte
+	Value []byte
+	// TTL is the time to live of a set. Zero means the key doesn't expire.
+	TTL time.Duration
+}
+
+// WorkloadConfig describes the workload produced by a Workload.
+type WorkloadConfig struct {
+	// NumKeys is the size of the key space.
+	NumKeys uint64
+	// ZipfS and ZipfV are the parameters of the zipfian distribution of keys, see rand.NewZipf,
+	// which takes a ZipfS above 1 and a ZipfV of 1 or more. If ZipfS is 1 or below, zero
+	// included, keys are uniformly distributed instead, and a ZipfV below 1 is taken as 1.
+	ZipfS float64
+	ZipfV float64
+	// KeyPrefix is prepended to every generated key.
+	KeyPrefix string
+
+	// MinValueSize and MaxValueSize bound the size of the generated values.
+	MinValueSize int
+	MaxValueSize int
+
+	// SetRatio, DeleteRatio and GetRatio are the relative frequencies of each kind of Op.
+	SetRatio    int
+	DeleteRatio int
+	GetRatio    int
+
+	// TTLRatio is the fraction of sets which have a TTL, picked uniformly from TTLs.
+	TTLRatio float64
+	TTLs     []time.Duration
+}
+
+// DefaultWorkloadConfig returns a write-heavy workload over 10000 zipfian keys.
+func DefaultWorkloadConfig() WorkloadConfig {
+	return WorkloadConfig{
+		NumKeys:      10000,
+		ZipfS:        1.1,
+		ZipfV:        1,
+		KeyPrefix:    "key",
+		MinValueSize: 8,
+		MaxValueSize: 1 << 10,
+		SetRatio:     70,
+		DeleteRatio:  10,
+		GetRatio:     20,
+	}
+}
+
+// Workload generates a deterministic stream of Ops for a given seed.
+type Workload struct {
+	cfg  WorkloadConfig
+	rng  *rand.Rand
+	zipf *rand.Zipf
+}
+
+// NewWorkload returns a Workload for the given config and seed.
+func NewWorkload(cfg WorkloadConfig, seed int64) *Workload {
+	if cfg.NumKeys == 0 {
+		cfg.NumKeys = 1
+	}
+	if cfg.MaxValueSize < cfg.MinValueSize {
+		cfg.MaxValueSize = cfg.MinValueSize
+	}
+	if cfg.SetRatio+cfg.DeleteRatio+cfg.GetRatio == 0 {
+		cfg.SetRatio = 1
+	}
+	w := &Workload{cfg: cfg, rng: rand.New(rand.NewSource(seed))}
+	if cfg.ZipfS > 1 {
+		v := cfg.ZipfV
+		if v < 1 {
+			v = 1
+		}
+		w.zipf = rand.NewZipf(w.rng, cfg.ZipfS, v, cfg.NumKeys-1)
+	}
+	return w
+}
+
+// Key returns a key picked from the configured distribution.
+func (w *Workload) Key() []byte {
+	var n uint64
+	if w.zipf != nil {
+		n = w.zipf.Uint64()
+	} else {
+		n = uint64(w.rng.Int63n(int64(w.cfg.NumKeys)))
+	}
+	return []byte(fmt.Sprintf("%s%010d", w.cfg.KeyPrefix, n))
+}
+
+// Value returns a random value with a size between MinValueSize and MaxValueSize.
+func (w *Workload) Value() []byte {
+	sz := w.cfg.MinValueSize
+	if d := w.cfg.MaxValueSize - w.cfg.MinValueSize; d > 0 {
+		sz += w.rng.Intn(d + 1)
+	}
+	v := make([]byte, sz)
+	w.rng.Read(v)
+	return v
+}
+
+// Next returns the next Op of the workload.
+func (w *Workload) Next() Op {
+	total := w.cfg.SetRatio + w.cfg.DeleteRatio + w.cfg.GetRatio
+	r := w.rng.Intn(total)
+	switch {
+	case r < w.cfg.SetRatio:
+		op := Op{Kind: OpSet, Key: w.Key(), Value: w.Value()}
+		if len(w.cfg.TTLs) > 0 && w.rng.Float64() < w.cfg.TTLRatio {
+			op.TTL = w.cfg.TTLs[w.rng.Intn(len(w.cfg.TTLs))]
+		}
+		return op
+	case r < w.cfg.SetRatio+w.cfg.DeleteRatio:
+		return Op{Kind: OpDelete, Key: w.Key()}
+	default:
+		return Op{Kind: OpGet, Key: w.Key()}
+	}
+}
+
+// Ops returns the next n Ops of the workload.
+func (w *Workload) Ops(n int) []Op {
+	ops := make([]Op, n)
+	for i := range ops {
+		ops[i] = w.Next()
+	}
+	return ops
+}
@@ -0,0 +1,130 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+
+	"github.com/luxfi/zapdb/table"
+)
+
+// ttlReaper compacts the tables of expired keys, which compactions would otherwise only pick
+// once the size of their level calls for it.
+type ttlReaper struct {
+	db *DB
+	// The reaps of the reaper and of the maintenance windows don't overlap.
+	sync.Mutex
+	// expired is the number of expired keys published in the metrics.
+	expired int64
+}
+
+// run reaps the expired keys every TTLReaperInterval, until lc is closed.
+func (r *ttlReaper) run(lc *z.Closer) {
+	defer lc.Done()
+	defer func() {
+		r.Lock()
+		defer r.Unlock()
+		r.db.metrics.NumExpiredKeysLSMAdd(-r.expired)
+		r.expired = 0
+	}()
+
+	ticker := time.NewTicker(r.db.opt.TTLReaperInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lc.HasBeenClosed():
+			return
+		case now := <-ticker.C:
+			if !r.db.maintenanceAllowed(MaintenanceTTLReap, now) {
+				continue
+			}
+		}
+		r.reap(lc)
+	}
+}
+
+// reap publishes the number of expired keys in the levels below L0, and compacts the tables
+// holding them, level by level, until lc is closed.
+func (r *ttlReaper) reap(lc *z.Closer) {
+	r.Lock()
+	defer r.Unlock()
+	db := r.db
+	now, discardTs := time.Now(), db.versionDiscardTs()
+	var expired int64
+	// The number of tables to compact in each level, so that a table left with expired keys
+	// isn't compacted over and over.
+	numTables := make([]int, len(db.lc.levels))
+	for _, l := range db.lc.levels[1:] {
+		l.RLock()
+		tables := expiredTables(l.tables, now, discardTs)
+		l.RUnlock()
+		for _, t := range tables {
+			expired += int64(t.ExpiringKeyCount())
+		}
+		numTables[l.level] = len(tables)
+	}
+	db.metrics.NumExpiredKeysLSMAdd(expired - r.expired)
+	r.expired = expired
+
+	for level, n := range numTables {
+		p := compactionPriority{level: level, reapTTL: true}
+		for ; n > 0; n-- {
+			if ok, _ := db.qos.allow(p); !ok {
+				return
+			}
+			if !db.acquireCompaction(lc) {
+				return
+			}
+			err := db.lc.doCompact(176, p)
+			db.releaseCompaction()
+			if err == errFillTables {
+				break
+			}
+			if err != nil {
+				db.opt.Warningf("While compacting the expired keys of level %d: %v", level, err)
+				break
+			}
+			db.metrics.NumCompactionsTTLAdd(1)
+		}
+	}
+}
+
+// expiredTables returns the tables whose keys with a TTL have all expired by now, and whose
+// versions no transaction reads anymore, so that compacting them drops the expired keys.
+// Expired keys are kept as delete markers while lower levels may hold older versions of them,
+// so they are pushed down a level by every compaction of their tables, until dropped.
+func expiredTables(tables []*table.Table, now time.Time, discardTs uint64) []*table.Table {
+	var out []*table.Table
+	for _, t := range tables {
+		if exp := t.MaxExpiresAt(); exp != 0 && exp <= uint64(now.Unix()) &&
+			t.MaxVersion() <= discardTs {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// fillSingleMaxLevelTable picks one of tables of the last level, to be compacted on its own.
+// Unlike fillMaxLevelTables, it doesn't pick tables by their stale data.
+func (s *levelsController) fillSingleMaxLevelTable(tables []*table.Table, cd *compactDef) bool {
+	for _, t := range tables {
+		cd.thisSize = t.Size()
+		cd.thisRange = getKeyRange(t)
+		cd.nextRange = cd.thisRange
+		if s.cstatus.overlapsWith(cd.thisLevel.level, cd.thisRange) {
+			continue
+		}
+		cd.top = []*table.Table{t}
+		cd.bot = []*table.Table{}
+		if s.cstatus.compareAndAdd(thisAndNextLevelRLocked{}, *cd) {
+			return true
+		}
+	}
+	return false
+}
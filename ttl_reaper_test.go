@@ -0,0 +1,96 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"expvar"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/options"
+	"github.com/luxfi/zapdb/pb"
+	"github.com/luxfi/zapdb/table"
+	"github.com/luxfi/zapdb/y"
+)
+
+// createTTLTable adds a table of keys, at version 1, to level. Keys map to their ExpiresAt.
+func createTTLTable(t *testing.T, db *DB, level int, keys []string, expiresAt map[string]uint64) {
+	b := table.NewTableBuilder(table.Options{
+		BlockSize:          db.opt.BlockSize,
+		BloomFalsePositive: db.opt.BloomFalsePositive,
+		ChkMode:            options.NoVerification,
+	})
+	defer b.Close()
+	for _, k := range keys {
+		b.Add(y.KeyWithTs([]byte(k), 1), y.ValueStruct{Value: []byte("val"), ExpiresAt: expiresAt[k]}, 0)
+	}
+	tab, err := table.CreateTable(table.NewFilename(db.lc.reserveFileID(), db.opt.Dir), b)
+	require.NoError(t, err)
+	require.NoError(t, db.manifest.addChanges([]*pb.ManifestChange{
+		newCreateChange(tab.ID(), level, 0, tab.CompressionType(), pb.EncryptionAlgo_aes),
+	}, db.opt))
+	db.lc.levels[level].Lock()
+	db.lc.levels[level].tables = append(db.lc.levels[level].tables, tab)
+	db.lc.levels[level].Unlock()
+}
+
+func TestTTLReaper(t *testing.T) {
+	db, err := Open(getTestOptions(t.TempDir()).WithTTLReaperInterval(10 * time.Millisecond))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	// Let the versions of the tables be discarded.
+	for i := 0; i < 2; i++ {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Set([]byte("z"), []byte("val"))
+		}))
+	}
+
+	past := uint64(time.Now().Add(-time.Minute).Unix())
+	future := uint64(time.Now().Add(time.Hour).Unix())
+	expiresAt := make(map[string]uint64)
+	var l1, lmax []string
+	for i := 0; i < 10; i++ {
+		k := fmt.Sprintf("a%d", i)
+		lmax = append(lmax, k)
+		expiresAt[k] = past
+	}
+	lmax = append(lmax, "b") // Never expires.
+	for i := 0; i < 10; i++ {
+		k := fmt.Sprintf("d%d", i)
+		l1 = append(l1, k)
+		expiresAt[k] = past
+	}
+	last := db.opt.MaxLevels - 1
+	createTTLTable(t, db, last, lmax, expiresAt)
+	createTTLTable(t, db, last, []string{"c"}, map[string]uint64{"c": future})
+	createTTLTable(t, db, 1, l1, expiresAt)
+	require.Equal(t, uint64(past), db.lc.levels[last].tables[0].MaxExpiresAt())
+	require.Equal(t, uint32(10), db.lc.levels[last].tables[0].ExpiringKeyCount())
+
+	count := func(name string) int64 { return db.metrics.Vars().Get(name).(*expvar.Int).Value() }
+	require.Eventually(t, func() bool {
+		var keys uint32
+		for _, ti := range db.Tables() {
+			keys += ti.KeyCount
+		}
+		return keys == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	require.GreaterOrEqual(t, count("compaction_ttl_num_lsm"), int64(2))
+	require.Eventually(t, func() bool {
+		return count("expired_num_lsm") == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The table of keys yet to expire is left alone.
+	var ids []uint64
+	for _, ti := range db.Tables() {
+		ids = append(ids, ti.ID)
+	}
+	require.Len(t, ids, 2)
+	require.Contains(t, ids, db.lc.levels[last].tables[1].ID())
+}
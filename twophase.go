@@ -0,0 +1,355 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+
+	"github.com/luxfi/zapdb/pb"
+	"github.com/luxfi/zapdb/y"
+)
+
+// preparedTxnPrefix starts the keys of the records of the prepared transactions. It is followed by
+// the ID of the transaction.
+var preparedTxnPrefix = []byte("!badger!prepared!")
+
+func preparedTxnKey(id []byte) []byte {
+	return append(y.SafeCopy(nil, preparedTxnPrefix), id...)
+}
+
+// prepare checks txn for conflicts, like newCommitTs, and then keeps the other transactions from
+// writing the keys it reads and writes, until the transaction prepared as id is committed or
+// rolled back.
+func (o *oracle) prepare(txn *Txn, id string) error {
+	o.Lock()
+	defer o.Unlock()
+	if _, ok := o.prepared[id]; ok {
+		return fmt.Errorf("Transaction %q is already prepared", id)
+	}
+	conflict := o.findConflict(txn)
+	if conflict == nil {
+		conflict = o.preparedConflict(txn)
+	}
+	if conflict != nil {
+		txn.db.recordConflict(conflict)
+		return conflict
+	}
+	keys := maps.Clone(txn.conflictKeys)
+	txn.readsLock.Lock()
+	for _, fp := range txn.reads {
+		keys[fp] = struct{}{}
+	}
+	txn.readsLock.Unlock()
+	o.addPrepared(id, keys)
+	return nil
+}
+
+// addPrepared keeps the other transactions from writing keys, the fingerprints of the keys read
+// and written by the transaction prepared as id. Must be called while having a lock.
+func (o *oracle) addPrepared(id string, keys map[uint64]struct{}) {
+	if o.prepared == nil {
+		o.prepared = make(map[string]map[uint64]struct{})
+	}
+	o.prepared[id] = keys
+}
+
+func (o *oracle) isPrepared(id string) bool {
+	o.Lock()
+	defer o.Unlock()
+	_, ok := o.prepared[id]
+	return ok
+}
+
+func (o *oracle) unprepare(id string) {
+	o.Lock()
+	defer o.Unlock()
+	delete(o.prepared, id)
+}
+
+// preparedConflict returns the conflict of txn if it writes a key read or written by another
+// prepared transaction, or is a prepared transaction committed or rolled back already. Must be
+// called while having a lock.
+func (o *oracle) preparedConflict(txn *Txn) *ConflictError {
+	if _, ok := o.prepared[string(txn.prepared)]; txn.prepared != nil && !ok {
+		return &ConflictError{Prepared: string(txn.prepared)}
+	}
+	for id, keys := range o.prepared {
+		if txn.prepared != nil && id == string(txn.prepared) {
+			continue
+		}
+		for fp := range txn.conflictKeys {
+			if _, has := keys[fp]; has {
+				conflict := txn.conflictOn(fp, 0)
+				conflict.Prepared = id
+				return conflict
+			}
+		}
+	}
+	return nil
+}
+
+// encodePreparedTxn encodes the record of a prepared transaction: the number of the keys it read,
+// their fingerprints, and its pending writes.
+func encodePreparedTxn(reads []uint64, writes map[string]*Entry) ([]byte, error) {
+	buf := binary.AppendUvarint(nil, uint64(len(reads)))
+	for _, fp := range reads {
+		buf = binary.BigEndian.AppendUint64(buf, fp)
+	}
+	list := &pb.KVList{}
+	for _, e := range writes {
+		list.Kv = append(list.Kv, &pb.KV{
+			Key:       e.Key,
+			Value:     e.Value,
+			UserMeta:  []byte{e.UserMeta},
+			Meta:      []byte{e.meta},
+			ExpiresAt: e.ExpiresAt,
+		})
+	}
+	data, err := pb.Marshal(list)
+	if err != nil {
+		return nil, err
+	}
+	return append(buf, data...), nil
+}
+
+// decodePreparedTxn decodes the record of a prepared transaction.
+func decodePreparedTxn(data []byte) ([]uint64, []*Entry, error) {
+	n, sz := binary.Uvarint(data)
+	if sz <= 0 || uint64(len(data)-sz)/8 < n {
+		return nil, nil, errors.New("Invalid prepared transaction record")
+	}
+	data = data[sz:]
+	reads := make([]uint64, n)
+	for i := range reads {
+		reads[i] = binary.BigEndian.Uint64(data[i*8:])
+	}
+	list := &pb.KVList{}
+	if err := pb.Unmarshal(data[n*8:], list); err != nil {
+		return nil, nil, y.Wrapf(err, "While decoding prepared transaction record")
+	}
+	entries := make([]*Entry, 0, len(list.Kv))
+	for _, kv := range list.Kv {
+		if len(kv.UserMeta) != 1 || len(kv.Meta) != 1 {
+			return nil, nil, errors.New("Invalid prepared transaction record")
+		}
+		entries = append(entries, &Entry{
+			Key:       kv.Key,
+			Value:     kv.Value,
+			UserMeta:  kv.UserMeta[0],
+			ExpiresAt: kv.ExpiresAt,
+			meta:      kv.Meta[0],
+		})
+	}
+	return reads, entries, nil
+}
+
+// Prepare prepares the transaction as id, the first phase of a two-phase commit: it checks the
+// transaction for conflicts, and persists a record of its writes durably, so that it can be
+// committed even after a crash. Once prepared, the transaction can't conflict anymore: the other
+// transactions writing the keys it read or wrote fail with ErrConflict until it is committed with
+// Commit, or rolled back with Rollback, the second phase.
+//
+// A prepared transaction takes no writes anymore. If it is discarded before being committed or
+// rolled back, or the DB is closed or crashes, it stays prepared: PreparedTxns lists it, and
+// PreparedTxn returns it to be committed or rolled back. The writes of WriteBatch, StreamWriter
+// and Load aren't transactions, and aren't kept from writing the keys of prepared transactions.
+//
+// Prepare requires Options.DetectConflicts, and can't be used in managed mode.
+func (txn *Txn) Prepare(id []byte) error {
+	db := txn.db
+	switch {
+	case !txn.update:
+		return ErrReadOnlyTxn
+	case txn.discarded:
+		return ErrDiscardedTxn
+	case db.opt.managedTxns:
+		return ErrManagedTxn
+	case !db.opt.DetectConflicts:
+		return errors.New("Prepare requires Options.DetectConflicts")
+	case len(id) == 0:
+		return errors.New("Prepared transaction ID can't be empty")
+	case txn.prepared != nil:
+		return ErrTxnPrepared
+	}
+	txn.readsLock.Lock()
+	record, err := encodePreparedTxn(txn.reads, txn.pendingWrites)
+	txn.readsLock.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := db.orc.prepare(txn, string(id)); err != nil {
+		return err
+	}
+	key := preparedTxnKey(id)
+	err = db.Update(func(rtxn *Txn) error {
+		return rtxn.modifyKey(&Entry{Key: key, Value: record}, true)
+	})
+	if err == nil {
+		if err = db.syncPrepared(); err != nil {
+			_ = db.Update(func(rtxn *Txn) error {
+				return rtxn.modifyKey(&Entry{Key: key, meta: bitDelete}, true)
+			})
+		}
+	}
+	if err != nil {
+		db.orc.unprepare(string(id))
+		return y.Wrapf(err, "While persisting prepared transaction %q", id)
+	}
+	txn.prepared = y.SafeCopy(nil, id)
+	return nil
+}
+
+// deletePreparedRecord adds the deletion of the record of the prepared transaction to its writes,
+// so that it's deleted as the transaction commits.
+func (txn *Txn) deletePreparedRecord() {
+	if txn.prepared == nil || txn.discarded {
+		return
+	}
+	key := preparedTxnKey(txn.prepared)
+	txn.pendingWrites[string(key)] = &Entry{Key: key, meta: bitDelete}
+}
+
+// syncPrepared syncs the records of the prepared transactions, and the writes of the committed
+// ones, unless every write is synced already.
+func (db *DB) syncPrepared() error {
+	if db.opt.SyncWrites || db.opt.InMemory {
+		return nil
+	}
+	return db.Sync()
+}
+
+// Rollback rolls back the prepared transaction, deleting its record, and discards it. It only
+// discards a transaction which isn't prepared.
+func (txn *Txn) Rollback() error {
+	if txn.prepared == nil {
+		txn.Discard()
+		return nil
+	}
+	if txn.discarded {
+		return ErrDiscardedTxn
+	}
+	db := txn.db
+	id := string(txn.prepared)
+	if !db.orc.isPrepared(id) {
+		return ErrPreparedTxnNotFound
+	}
+	err := db.Update(func(rtxn *Txn) error {
+		return rtxn.modifyKey(&Entry{Key: preparedTxnKey(txn.prepared), meta: bitDelete}, true)
+	})
+	if err == nil {
+		err = db.syncPrepared()
+	}
+	if err != nil {
+		return y.Wrapf(err, "While rolling back prepared transaction %q", id)
+	}
+	db.orc.unprepare(id)
+	txn.Discard()
+	return nil
+}
+
+// PreparedTxns returns the IDs of the prepared transactions, neither committed nor rolled back
+// yet, like the ones recovered from their records when the DB was opened.
+func (db *DB) PreparedTxns() [][]byte {
+	db.orc.Lock()
+	ids := slices.Sorted(maps.Keys(db.orc.prepared))
+	db.orc.Unlock()
+	out := make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, []byte(id))
+	}
+	return out
+}
+
+// PreparedTxn returns a new transaction holding the writes of the transaction prepared as id, to
+// be committed with Commit, or rolled back with Rollback. It returns ErrPreparedTxnNotFound if
+// there is no such transaction. Only one of the transactions returned for id can be committed or
+// rolled back, the others fail with ErrConflict and ErrPreparedTxnNotFound.
+func (db *DB) PreparedTxn(id []byte) (*Txn, error) {
+	if !db.orc.isPrepared(string(id)) {
+		return nil, ErrPreparedTxnNotFound
+	}
+	txn := db.NewTransaction(true)
+	record, err := txn.getInternal(preparedTxnKey(id))
+	if err == ErrKeyNotFound {
+		err = ErrPreparedTxnNotFound
+	}
+	var entries []*Entry
+	if err == nil {
+		_, entries, err = decodePreparedTxn(record)
+	}
+	for _, e := range entries {
+		if err == nil {
+			err = txn.modifyKey(e, true)
+		}
+	}
+	if err != nil {
+		txn.Discard()
+		return nil, err
+	}
+	txn.prepared = y.SafeCopy(nil, id)
+	return txn, nil
+}
+
+// getInternal returns a copy of the value of key, which may have badgerPrefix, without reading it.
+func (txn *Txn) getInternal(key []byte) ([]byte, error) {
+	opt := DefaultIteratorOptions
+	opt.Prefix = key
+	opt.PrefetchValues = false
+	opt.InternalAccess = true
+	opt.uncounted = true
+	it := txn.NewIterator(opt)
+	defer it.Close()
+	if it.Rewind(); !it.Valid() || !bytes.Equal(it.Item().Key(), key) {
+		return nil, ErrKeyNotFound
+	}
+	return it.Item().ValueCopy(nil)
+}
+
+// initPreparedTxns keeps the other transactions from writing the keys of the prepared
+// transactions, as recovered from their records.
+func (db *DB) initPreparedTxns() error {
+	return db.View(func(txn *Txn) error {
+		opt := DefaultIteratorOptions
+		opt.Prefix = preparedTxnPrefix
+		opt.InternalAccess = true
+		opt.uncounted = true
+		it := txn.NewIterator(opt)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			id := string(item.Key()[len(preparedTxnPrefix):])
+			err := item.Value(func(val []byte) error {
+				reads, entries, err := decodePreparedTxn(val)
+				if err != nil {
+					return err
+				}
+				keys := make(map[uint64]struct{}, len(reads)+len(entries))
+				for _, fp := range reads {
+					keys[fp] = struct{}{}
+				}
+				for _, e := range entries {
+					keys[z.MemHash(e.Key)] = struct{}{}
+				}
+				db.orc.Lock()
+				db.orc.addPrepared(id, keys)
+				db.orc.Unlock()
+				return nil
+			})
+			if err != nil {
+				return y.Wrapf(err, "While recovering prepared transaction %q", id)
+			}
+			db.opt.Infof("Recovered prepared transaction %q", id)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,117 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxnPrepare(t *testing.T) {
+	dir, err := os.MkdirTemp("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+	opts := getTestOptions(dir)
+
+	set := func(db *DB, key, val string) error {
+		return db.Update(func(txn *Txn) error { return txn.Set([]byte(key), []byte(val)) })
+	}
+	get := func(db *DB, key string) string {
+		var val []byte
+		err := db.View(func(txn *Txn) error {
+			item, err := txn.Get([]byte(key))
+			if err != nil {
+				return err
+			}
+			val, err = item.ValueCopy(nil)
+			return err
+		})
+		if err == ErrKeyNotFound {
+			return ""
+		}
+		require.NoError(t, err)
+		return string(val)
+	}
+	// prepare prepares a transaction as id, reading r and writing the keys w to v.
+	prepare := func(db *DB, id, r, v string, w ...string) *Txn {
+		txn := db.NewTransaction(true)
+		_, err := txn.Get([]byte(r))
+		require.True(t, err == nil || err == ErrKeyNotFound)
+		for _, key := range w {
+			require.NoError(t, txn.Set([]byte(key), []byte(v)))
+		}
+		require.NoError(t, txn.Prepare([]byte(id)))
+		return txn
+	}
+
+	db, err := Open(opts)
+	require.NoError(t, err)
+	require.NoError(t, set(db, "r", "0"))
+
+	// The other transactions can't write the keys a prepared transaction reads and writes.
+	txn := prepare(db, "t1", "r", "1", "a", "b")
+	require.ErrorIs(t, txn.Set([]byte("c"), nil), ErrTxnPrepared)
+	require.ErrorIs(t, set(db, "a", "x"), ErrConflict)
+	require.ErrorIs(t, set(db, "r", "x"), ErrConflict)
+	require.NoError(t, set(db, "c", "x"))
+	require.Error(t, db.NewTransaction(true).Prepare([]byte("t1")))
+	require.Equal(t, [][]byte{[]byte("t1")}, db.PreparedTxns())
+	require.NoError(t, txn.Commit())
+	require.Equal(t, "1", get(db, "a"))
+	require.Equal(t, "1", get(db, "b"))
+	require.Empty(t, db.PreparedTxns())
+	require.NoError(t, set(db, "r", "2"))
+
+	// A transaction conflicting as it's prepared isn't prepared.
+	txn = db.NewTransaction(true)
+	_, err = txn.Get([]byte("r"))
+	require.NoError(t, err)
+	require.NoError(t, txn.Set([]byte("d"), []byte("1")))
+	require.NoError(t, set(db, "r", "3"))
+	require.ErrorIs(t, txn.Prepare([]byte("t2")), ErrConflict)
+	txn.Discard()
+
+	// A rolled back transaction writes nothing.
+	txn = prepare(db, "t3", "r", "3", "d")
+	require.NoError(t, txn.Rollback())
+	require.Empty(t, db.PreparedTxns())
+	require.Equal(t, "", get(db, "d"))
+	require.NoError(t, set(db, "d", "x"))
+
+	// The prepared transactions survive a restart, and are committed or rolled back then.
+	prepare(db, "t4", "r", "4", "e").Discard()
+	prepare(db, "t5", "r", "5", "f").Discard()
+	require.NoError(t, db.Close())
+
+	db, err = Open(opts)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("t4"), []byte("t5")}, db.PreparedTxns())
+	require.ErrorIs(t, set(db, "e", "x"), ErrConflict)
+	require.ErrorIs(t, set(db, "r", "x"), ErrConflict)
+	_, err = db.PreparedTxn([]byte("t6"))
+	require.ErrorIs(t, err, ErrPreparedTxnNotFound)
+
+	txn, err = db.PreparedTxn([]byte("t4"))
+	require.NoError(t, err)
+	again, err := db.PreparedTxn([]byte("t4"))
+	require.NoError(t, err)
+	require.NoError(t, txn.Commit())
+	require.ErrorIs(t, again.Commit(), ErrConflict)
+	txn, err = db.PreparedTxn([]byte("t5"))
+	require.NoError(t, err)
+	require.NoError(t, txn.Rollback())
+	require.NoError(t, db.Close())
+
+	db, err = Open(opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	require.Empty(t, db.PreparedTxns())
+	require.Equal(t, "4", get(db, "e"))
+	require.Equal(t, "", get(db, "f"))
+	require.NoError(t, set(db, "r", "6"))
+}
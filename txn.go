@@ -16,6 +16,7 @@ import (
 	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/luxfi/zapdb/y"
 	"github.com/dgraph-io/ristretto/v2/z"
@@ -44,6 +45,14 @@ type oracle struct {
 	committedTxns []committedTxn
 	lastCleanupTs uint64
 
+	// rangeTxns is the number of SerializableSnapshot transactions running. The committed
+	// transactions keep the keys they write while there are any, to check them for conflicts.
+	rangeTxns int
+
+	// prepared holds the fingerprints of the keys read and written by the prepared transactions,
+	// by ID. The other transactions can't write them until they are committed or rolled back.
+	prepared map[string]map[uint64]struct{}
+
 	// closer is used to stop watermarks.
 	closer *z.Closer
 }
@@ -52,6 +61,8 @@ type committedTxn struct {
 	ts uint64
 	// ConflictKeys Keeps track of the entries written at timestamp ts.
 	conflictKeys map[uint64]struct{}
+	// keys are the keys written at timestamp ts, if SerializableSnapshot transactions were running.
+	keys []string
 }
 
 func newOracle(opt Options) *oracle {
@@ -124,10 +135,11 @@ func (o *oracle) discardAtOrBelow() uint64 {
 	return o.readMark.DoneUntil()
 }
 
-// hasConflict must be called while having a lock.
-func (o *oracle) hasConflict(txn *Txn) bool {
-	if len(txn.reads) == 0 {
-		return false
+// findConflict returns the first conflict of txn with the transactions committed since it
+// started, or nil if it has none. It must be called while having a lock.
+func (o *oracle) findConflict(txn *Txn) *ConflictError {
+	if len(txn.reads) == 0 && len(txn.readRanges) == 0 && txn.isolation != SnapshotIsolation {
+		return nil
 	}
 	for _, committedTxn := range o.committedTxns {
 		// If the committedTxn.ts is less than txn.readTs that implies that the
@@ -142,20 +154,35 @@ func (o *oracle) hasConflict(txn *Txn) bool {
 
 		for _, ro := range txn.reads {
 			if _, has := committedTxn.conflictKeys[ro]; has {
-				return true
+				return txn.conflictOn(ro, committedTxn.ts)
+			}
+		}
+		if key, ok := txn.writesReadRange(committedTxn); ok {
+			return &ConflictError{Key: key, Fingerprint: z.MemHash(key), Version: committedTxn.ts}
+		}
+		if txn.isolation == SnapshotIsolation {
+			if fp, ok := txn.writesWritten(committedTxn); ok {
+				return txn.conflictOn(fp, committedTxn.ts)
 			}
 		}
 	}
 
-	return false
+	return nil
 }
 
-func (o *oracle) newCommitTs(txn *Txn) (uint64, bool) {
+// newCommitTs returns the commit timestamp of txn, or the conflict it fails with.
+func (o *oracle) newCommitTs(txn *Txn) (uint64, *ConflictError) {
 	o.Lock()
 	defer o.Unlock()
 
-	if o.hasConflict(txn) {
-		return 0, true
+	if conflict := o.findConflict(txn); conflict != nil {
+		return 0, conflict
+	}
+	if conflict := o.preparedConflict(txn); conflict != nil {
+		return 0, conflict
+	}
+	if txn.prepared != nil {
+		delete(o.prepared, string(txn.prepared))
 	}
 
 	var ts uint64
@@ -174,17 +201,30 @@ func (o *oracle) newCommitTs(txn *Txn) (uint64, bool) {
 	}
 
 	y.AssertTrue(ts >= o.lastCleanupTs)
+	o.addCommitted(txn, ts)
+	return ts, nil
+}
 
-	if o.detectConflicts {
+// addCommitted records the keys written by txn at ts, for the conflict detection of the
+// transactions reading below ts. Must be called under o.Lock.
+func (o *oracle) addCommitted(txn *Txn, ts uint64) {
+	if !o.detectConflicts {
 		// We should ensure that txns are not added to o.committedTxns slice when
 		// conflict detection is disabled otherwise this slice would keep growing.
-		o.committedTxns = append(o.committedTxns, committedTxn{
-			ts:           ts,
-			conflictKeys: txn.conflictKeys,
-		})
+		return
 	}
-
-	return ts, false
+	var keys []string
+	if o.rangeTxns > 0 {
+		keys = make([]string, 0, len(txn.pendingWrites))
+		for key := range txn.pendingWrites {
+			keys = append(keys, key)
+		}
+	}
+	o.committedTxns = append(o.committedTxns, committedTxn{
+		ts:           ts,
+		conflictKeys: txn.conflictKeys,
+		keys:         keys,
+	})
 }
 
 func (o *oracle) doneRead(txn *Txn) {
@@ -241,15 +281,28 @@ type Txn struct {
 	commitTs uint64
 	size     int64
 	count    int64
+	memory   int64
 	db       *DB
 
 	reads []uint64 // contains fingerprints of keys read.
+	// The ranges of keys iterated, for SerializableSnapshot. Guarded by readsLock too.
+	readRanges []readRange
 	// contains fingerprints of keys written. This is used for conflict detection.
 	conflictKeys map[uint64]struct{}
 	readsLock    sync.Mutex // guards the reads slice. See addReadKey.
 
 	pendingWrites   map[string]*Entry // cache stores any writes done by txn.
 	duplicateWrites []*Entry          // Used in managed mode to store duplicate entries.
+	rangeDels       []rangeTombstone  // The ranges deleted by txn, without version.
+
+	savepoints []savepoint
+	// undo logs how to undo the writes made since the first savepoint, oldest first.
+	undo []func()
+
+	prepared []byte // The ID of Prepare, nil if the txn isn't prepared.
+
+	isolation   IsolationLevel
+	tracksRange bool // Whether the txn is counted in oracle.rangeTxns.
 
 	numIterators atomic.Int32
 	discarded    bool
@@ -332,43 +385,93 @@ func (txn *Txn) newPendingWritesIterator(reversed bool) *pendingWritesIterator {
 	}
 }
 
+// TxnLimitError is returned when adding an entry to a transaction would exceed
+// Options.TxnMaxEntries or Options.TxnMaxMemory. It matches ErrTxnTooBig with errors.Is, so
+// code splitting writes on ErrTxnTooBig, like WriteBatch, keeps working.
+type TxnLimitError struct {
+	// Limit is the name of the exceeded option.
+	Limit string
+	Max   int64
+	// Value is what the transaction would have reached with the rejected entry.
+	Value int64
+}
+
+func (e *TxnLimitError) Error() string {
+	return fmt.Sprintf("Txn would exceed %s: %d > %d", e.Limit, e.Value, e.Max)
+}
+
+// Is makes errors.Is(err, ErrTxnTooBig) true for a TxnLimitError.
+func (e *TxnLimitError) Is(target error) bool {
+	return target == ErrTxnTooBig
+}
+
 func (txn *Txn) checkSize(e *Entry) error {
 	count := txn.count + 1
 	// Extra bytes for the version in key.
 	size := txn.size + e.estimateSizeAndSetThreshold(txn.db.valueThreshold()) + 10
+	memory := txn.memory + int64(len(e.Key)+len(e.Value))
+	// Unlike count, TxnMaxEntries doesn't include the extra entry for BitFin.
+	if limit := txn.db.opt.TxnMaxEntries; limit > 0 && count-1 > limit {
+		return &TxnLimitError{Limit: "TxnMaxEntries", Max: limit, Value: count - 1}
+	}
+	if limit := txn.db.opt.TxnMaxMemory; limit > 0 && memory > limit {
+		return &TxnLimitError{Limit: "TxnMaxMemory", Max: limit, Value: memory}
+	}
 	if count >= txn.db.opt.maxBatchCount || size >= txn.db.opt.maxBatchSize {
 		return ErrTxnTooBig
 	}
-	txn.count, txn.size = count, size
+	txn.count, txn.size, txn.memory = count, size, memory
 	return nil
 }
 
-func exceedsSize(prefix string, max int64, key []byte) error {
-	return fmt.Errorf("%s with size %d exceeded %d limit. %s:\n%s",
-		prefix, len(key), max, prefix, hex.Dump(key[:1<<10]))
+// Count returns the number of writes added to the transaction so far, as counted against
+// Options.TxnMaxEntries. Writing the same key twice counts twice.
+func (txn *Txn) Count() int64 {
+	return txn.count - 1
+}
+
+// Size returns the number of bytes of keys and values added to the transaction so far, as
+// counted against Options.TxnMaxMemory.
+func (txn *Txn) Size() int64 {
+	return txn.memory
+}
+
+// Key length can't be more than uint16, as determined by table::header.  To keep things safe
+// and allow badger move prefix and a timestamp suffix, let's cut it down to 65000, instead of
+// using 65536.
+const maxKeySize = 65000
+
+func exceedsSize(err error, prefix string, max int64, key []byte) error {
+	return fmt.Errorf("%w: %s with size %d exceeded %d limit. %s:\n%s",
+		err, prefix, len(key), max, prefix, hex.Dump(key[:min(len(key), 1<<10)]))
 }
 
 func (txn *Txn) modify(e *Entry) error {
-	const maxKeySize = 65000
+	return txn.modifyKey(e, false)
+}
 
+// modifyKey adds e to the pending writes. Keys with badgerPrefix are rejected unless internal
+// is set.
+func (txn *Txn) modifyKey(e *Entry, internal bool) error {
 	switch {
 	case !txn.update:
 		return ErrReadOnlyTxn
 	case txn.discarded:
 		return ErrDiscardedTxn
+	case txn.prepared != nil:
+		return ErrTxnPrepared
 	case len(e.Key) == 0:
 		return ErrEmptyKey
-	case bytes.HasPrefix(e.Key, badgerPrefix):
+	case !internal && bytes.HasPrefix(e.Key, badgerPrefix):
 		return ErrInvalidKey
-	case len(e.Key) > maxKeySize:
-		// Key length can't be more than uint16, as determined by table::header.  To
-		// keep things safe and allow badger move prefix and a timestamp suffix, let's
-		// cut it down to 65000, instead of using 65536.
-		return exceedsSize("Key", maxKeySize, e.Key)
-	case int64(len(e.Value)) > txn.db.opt.ValueLogFileSize:
-		return exceedsSize("Value", txn.db.opt.ValueLogFileSize, e.Value)
+	case !internal && txn.db.opt.Follower:
+		return ErrFollower
+	case len(e.Key) > txn.db.opt.MaxKeySize:
+		return exceedsSize(ErrKeyTooLarge, "Key", int64(txn.db.opt.MaxKeySize), e.Key)
+	case int64(len(e.Value)) > txn.db.opt.MaxValueSize:
+		return exceedsSize(ErrValueTooLarge, "Value", txn.db.opt.MaxValueSize, e.Value)
 	case txn.db.opt.InMemory && int64(len(e.Value)) > txn.db.valueThreshold():
-		return exceedsSize("Value", txn.db.valueThreshold(), e.Value)
+		return exceedsSize(ErrValueTooLarge, "Value", txn.db.valueThreshold(), e.Value)
 	}
 
 	if err := txn.db.isBanned(e.Key); err != nil {
@@ -389,9 +492,12 @@ func (txn *Txn) modify(e *Entry) error {
 	// Add the entry to duplicateWrites only if both the entries have different versions. For
 	// same versions, we will overwrite the existing entry.
 	if oldEntry, ok := txn.pendingWrites[string(e.Key)]; ok && oldEntry.version != e.version {
-		txn.duplicateWrites = append(txn.duplicateWrites, oldEntry)
+		txn.setDuplicates(append(txn.duplicateWrites, oldEntry))
+	} else if ok {
+		// The chunks of an overwritten split value aren't written.
+		txn.dropPendingChunks(oldEntry)
 	}
-	txn.pendingWrites[string(e.Key)] = e
+	txn.setPending(e)
 	return nil
 }
 
@@ -405,11 +511,20 @@ func (txn *Txn) Set(key, val []byte) error {
 }
 
 // SetEntry takes an Entry struct and adds the key-value pair in the struct,
-// along with other metadata to the database.
+// along with other metadata to the database. If the entry doesn't expire, it expires
+// after the TTL of the lifecycle policy of its key, if any.
 //
 // The current transaction keeps a reference to the entry passed in argument.
 // Users must not modify the entry until the end of the transaction.
 func (txn *Txn) SetEntry(e *Entry) error {
+	e = txn.db.lifecycle.Load().setTTL(e)
+	e, err := txn.db.transformers.encode(e)
+	if err != nil {
+		return err
+	}
+	if e, chunks := txn.db.splitEntry(e); chunks != nil {
+		return txn.setSplit(e, chunks)
+	}
 	return txn.modify(e)
 }
 
@@ -429,9 +544,33 @@ func (txn *Txn) Delete(key []byte) error {
 	return txn.modify(e)
 }
 
+// SingleDelete deletes a key which was written, by Set or SetEntry, at most once since it was
+// last deleted, as with keys of queues which are written and later consumed.
+//
+// Reads see it like Delete, but compactions drop its delete marker, with the write it deletes, as
+// soon as they meet both, instead of keeping the marker until it reaches the last level, in case
+// older versions of the key are there. If the key was written more than once, earlier writes may
+// reappear once the marker is dropped.
+//
+// The current transaction keeps a reference to the key byte slice argument.
+// Users must not modify the key until the end of the transaction.
+func (txn *Txn) SingleDelete(key []byte) error {
+	e := &Entry{
+		Key:  key,
+		meta: bitDelete | bitSingleDelete,
+	}
+	return txn.modify(e)
+}
+
 // Get looks for key and returns corresponding Item.
 // If key is not found, ErrKeyNotFound is returned.
 func (txn *Txn) Get(key []byte) (item *Item, rerr error) {
+	start := time.Now()
+	defer func() {
+		d := time.Since(start)
+		txn.db.metrics.LatencyObserve(y.LatencyGet, d)
+		txn.db.qos.observeGet(d)
+	}()
 	if len(key) == 0 {
 		return nil, ErrEmptyKey
 	} else if txn.discarded {
@@ -441,6 +580,8 @@ func (txn *Txn) Get(key []byte) (item *Item, rerr error) {
 	if err := txn.db.isBanned(key); err != nil {
 		return nil, err
 	}
+	txn.refreshReadTs()
+	txn.db.heatmap.recordRead(key)
 
 	item = new(Item)
 	if txn.update {
@@ -451,6 +592,30 @@ func (txn *Txn) Get(key []byte) (item *Item, rerr error) {
 			// Fulfill from cache.
 			item.meta = e.meta
 			item.val = e.Value
+			if f := txn.db.mergeOps.get(key); f != nil && e.meta&bitMergeEntry > 0 {
+				// The delta is merged into the versions the transaction reads.
+				txn.addReadKey(key)
+				val, err := txn.db.mergeValue(f, key, txn.readTs, e.Value)
+				if err != nil {
+					return nil, err
+				}
+				item.meta &^= bitMergeEntry
+				item.val = val
+			}
+			if e.meta&bitTransformed > 0 {
+				val, err := txn.db.decodeValue(key, e.Value, func(chunkKey []byte) ([]byte, error) {
+					c, ok := txn.pendingWrites[string(chunkKey)]
+					if !ok {
+						return nil, fmt.Errorf("Chunk %q of split value not found", chunkKey)
+					}
+					return c.Value, nil
+				})
+				if err != nil {
+					return nil, err
+				}
+				item.meta &^= bitTransformed
+				item.val = val
+			}
 			item.userMeta = e.UserMeta
 			item.key = key
 			item.status = prefetched
@@ -463,16 +628,30 @@ func (txn *Txn) Get(key []byte) (item *Item, rerr error) {
 		// internally.
 		txn.addReadKey(key)
 	}
+	if shadow := txn.db.shadow.Load(); shadow != nil && shadow.sampleRead() {
+		defer func() { shadow.compareGet(key, txn.readTs, item, rerr) }()
+	}
 
 	seek := y.KeyWithTs(key, txn.readTs)
 	vs, err := txn.db.get(seek)
 	if err != nil {
 		return nil, y.Wrapf(err, "DB::Get key: %q", key)
 	}
+	return txn.readItem(item, key, vs)
+}
+
+// readItem fills item with vs, the version of key read by txn, or returns ErrKeyNotFound if
+// there's none, or it's deleted.
+func (txn *Txn) readItem(item *Item, key []byte, vs y.ValueStruct) (*Item, error) {
 	if vs.Value == nil && vs.Meta == 0 {
 		return nil, ErrKeyNotFound
 	}
-	if isDeletedOrExpired(vs.Meta, vs.ExpiresAt) {
+	if txn.db.opt.StrictInvariantChecks {
+		if err := checkVersion(key, vs.Version, txn.readTs); err != nil {
+			return nil, err
+		}
+	}
+	if isDeletedOrExpired(vs.Meta, vs.ExpiresAt) || txn.rangeDeleted(key, vs.Version) {
 		return nil, ErrKeyNotFound
 	}
 
@@ -487,7 +666,7 @@ func (txn *Txn) Get(key []byte) (item *Item, rerr error) {
 }
 
 func (txn *Txn) addReadKey(key []byte) {
-	if txn.update {
+	if txn.tracksReads() {
 		fp := z.MemHash(key)
 
 		// Because of the possibility of multiple iterators it is now possible
@@ -516,6 +695,11 @@ func (txn *Txn) Discard() {
 	if !txn.db.orc.isManaged {
 		txn.db.orc.doneRead(txn)
 	}
+	if txn.tracksRange {
+		txn.db.orc.Lock()
+		txn.db.orc.rangeTxns--
+		txn.db.orc.Unlock()
+	}
 }
 
 func (txn *Txn) commitAndSend() (func() error, error) {
@@ -528,8 +712,9 @@ func (txn *Txn) commitAndSend() (func() error, error) {
 	defer orc.writeChLock.Unlock()
 
 	commitTs, conflict := orc.newCommitTs(txn)
-	if conflict {
-		return nil, ErrConflict
+	if conflict != nil {
+		txn.db.recordConflict(conflict)
+		return nil, conflict
 	}
 
 	keepTogether := true
@@ -597,6 +782,9 @@ func (txn *Txn) commitAndSend() (func() error, error) {
 	}
 	ret := func() error {
 		err := req.Wait()
+		if err == nil && txn.prepared != nil {
+			err = txn.db.syncPrepared()
+		}
 		// Wait before marking commitTs as done.
 		// We can't defer doneCommit above, because it is being called from a
 		// callback here.
@@ -646,7 +834,13 @@ func (txn *Txn) commitPrecheck() error {
 //
 // If error is nil, the transaction is successfully committed. In case of a non-nil error, the LSM
 // tree won't be updated, so there's no need for any rollback.
+//
+// A transaction prepared with Prepare doesn't conflict, and its record is deleted as it commits.
+// Its writes are synced before Commit returns.
 func (txn *Txn) Commit() error {
+	start := time.Now()
+	defer func() { txn.db.metrics.LatencyObserve(y.LatencyCommit, time.Since(start)) }()
+	txn.deletePreparedRecord()
 	// txn.conflictKeys can be zero if conflict detection is turned off. So we
 	// should check txn.pendingWrites.
 	if len(txn.pendingWrites) == 0 {
@@ -701,6 +895,7 @@ func (txn *Txn) CommitWith(cb func(error)) {
 	if cb == nil {
 		panic("Nil callback provided to CommitWith")
 	}
+	txn.deletePreparedRecord()
 
 	if len(txn.pendingWrites) == 0 {
 		// Do not run these callbacks from here, because the CommitWith and the
@@ -726,7 +921,7 @@ func (txn *Txn) CommitWith(cb func(error)) {
 		return
 	}
 
-	go runTxnCallback(&txnCb{user: cb, commit: commitCb})
+	go runTxnCallback(&txnCb{user: txn.db.timeCallback(cb), commit: commitCb})
 }
 
 // ReadTs returns the read timestamp of the transaction.
@@ -759,24 +954,41 @@ func (db *DB) NewTransaction(update bool) *Txn {
 }
 
 func (db *DB) newTransaction(update, isManaged bool) *Txn {
+	return db.newTransactionWithOptions(update, isManaged, TxnOptions{})
+}
+
+func (db *DB) newTransactionWithOptions(update, isManaged bool, opt TxnOptions) *Txn {
 	if db.opt.ReadOnly && update {
 		// DB is read-only, force read-only transaction.
 		update = false
 	}
 
 	txn := &Txn{
-		update: update,
-		db:     db,
-		count:  1,                       // One extra entry for BitFin.
-		size:   int64(len(txnKey) + 10), // Some buffer for the extra entry.
+		update:    update,
+		db:        db,
+		count:     1,                       // One extra entry for BitFin.
+		size:      int64(len(txnKey) + 10), // Some buffer for the extra entry.
+		isolation: opt.Isolation,
 	}
 	if update {
 		if db.opt.DetectConflicts {
 			txn.conflictKeys = make(map[uint64]struct{})
+			// Counted before reading the timestamp, so that every transaction committed after
+			// it keeps its keys.
+			if opt.Isolation == SerializableSnapshot {
+				db.orc.Lock()
+				db.orc.rangeTxns++
+				db.orc.Unlock()
+				txn.tracksRange = true
+			}
 		}
 		txn.pendingWrites = make(map[string]*Entry)
 	}
-	if !isManaged {
+	if db.opt.asOf != 0 && !isManaged {
+		// The read mark isn't needed for the version pinned by OpenAt.
+		txn.readTs = db.opt.asOf
+		txn.doneRead = true
+	} else if !isManaged {
 		txn.readTs = db.orc.readTs()
 	}
 	return txn
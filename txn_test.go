@@ -6,6 +6,7 @@
 package badger
 
 import (
+	"expvar"
 	"fmt"
 	"math/rand"
 	"os"
@@ -815,7 +816,7 @@ func TestManagedDB(t *testing.T) {
 		require.NoError(t, txn.SetEntry(NewEntry(key(0), val(0))))
 		require.NoError(t, txnb.SetEntry(NewEntry(key(0), val(1))))
 		require.NoError(t, txn.CommitAt(11, nil))
-		require.Equal(t, ErrConflict, txnb.CommitAt(11, nil))
+		require.ErrorIs(t, txnb.CommitAt(11, nil), ErrConflict)
 	}
 	t.Run("disk mode", func(t *testing.T) {
 		db, err := Open(opt)
@@ -942,3 +943,89 @@ func TestConflict(t *testing.T) {
 		runTest(t, testAndSetItr)
 	})
 }
+
+func TestConflictError(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		set := func(key string) uint64 {
+			txn := db.NewTransaction(true)
+			defer txn.Discard()
+			require.NoError(t, txn.Set([]byte(key), []byte("v")))
+			require.NoError(t, txn.Commit())
+			return db.MaxVersion()
+		}
+		conflicts := func(prefix string) int64 {
+			v := db.metrics.Vars().Get("conflict_num_txn").(*expvar.Map).Get(prefix)
+			if v == nil {
+				return 0
+			}
+			return v.(*expvar.Int).Value()
+		}
+
+		// The key of a conflict is known if the transaction wrote it too.
+		txn := db.NewTransaction(true)
+		_, err := txn.Get([]byte("counter"))
+		require.ErrorIs(t, err, ErrKeyNotFound)
+		require.NoError(t, txn.Set([]byte("counter"), []byte("1")))
+		version := set("counter")
+		err = txn.Commit()
+		require.ErrorIs(t, err, ErrConflict)
+		var conflict *ConflictError
+		require.ErrorAs(t, err, &conflict)
+		require.Equal(t, []byte("counter"), conflict.Key)
+		require.Equal(t, z.MemHash([]byte("counter")), conflict.Fingerprint)
+		require.Equal(t, version, conflict.Version)
+		require.Contains(t, err.Error(), `key "counter" written at version`)
+		require.Equal(t, int64(1), conflicts("counter"))
+
+		// Otherwise only its fingerprint is.
+		txn = db.NewTransaction(true)
+		_, err = txn.Get([]byte("read"))
+		require.ErrorIs(t, err, ErrKeyNotFound)
+		require.NoError(t, txn.Set([]byte("written"), []byte("1")))
+		set("read")
+		require.ErrorAs(t, txn.Commit(), &conflict)
+		require.Nil(t, conflict.Key)
+		require.Equal(t, z.MemHash([]byte("read")), conflict.Fingerprint)
+		require.Equal(t, int64(1), conflicts("?"))
+	})
+}
+
+func TestTxnLimits(t *testing.T) {
+	opt := getTestOptions("").WithTxnMaxEntries(3).WithTxnMaxMemory(100)
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		txn := db.NewTransaction(true)
+		defer txn.Discard()
+		for i := 0; i < 3; i++ {
+			require.NoError(t, txn.Set([]byte(fmt.Sprintf("key%d", i)), []byte("val")))
+		}
+		require.Equal(t, int64(3), txn.Count())
+		require.Equal(t, int64(3*7), txn.Size())
+
+		err := txn.Delete([]byte("key3"))
+		var limitErr *TxnLimitError
+		require.ErrorAs(t, err, &limitErr)
+		require.Equal(t, "TxnMaxEntries", limitErr.Limit)
+		require.ErrorIs(t, err, ErrTxnTooBig)
+		// The rejected write is not counted.
+		require.Equal(t, int64(3), txn.Count())
+
+		txn2 := db.NewTransaction(true)
+		defer txn2.Discard()
+		err = txn2.Set([]byte("big"), make([]byte, 100))
+		require.ErrorAs(t, err, &limitErr)
+		require.Equal(t, "TxnMaxMemory", limitErr.Limit)
+		require.Equal(t, int64(103), limitErr.Value)
+		require.Zero(t, txn2.Size())
+
+		// WriteBatch splits its writes into transactions within the limits.
+		wb := db.NewWriteBatch()
+		for i := 0; i < 10; i++ {
+			require.NoError(t, wb.Set([]byte(fmt.Sprintf("wb%d", i)), []byte("val")))
+		}
+		require.NoError(t, wb.Flush())
+		require.NoError(t, db.View(func(txn *Txn) error {
+			_, err := txn.Get([]byte("wb9"))
+			return err
+		}))
+	})
+}
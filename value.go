@@ -20,6 +20,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -38,8 +39,13 @@ const (
 	bitDelete                 byte = 1 << 0 // Set if the key has been deleted.
 	bitValuePointer           byte = 1 << 1 // Set if the value is NOT stored directly next to key.
 	bitDiscardEarlierVersions byte = 1 << 2 // Set if earlier versions can be discarded.
-	// Set if item shouldn't be discarded via compactions (used by merge operator)
+	// Set if the value is a delta to merge into the earlier versions, by the merge operator of
+	// the key. See DB.RegisterMergeOperator.
 	bitMergeEntry byte = 1 << 3
+	// Set, with bitDelete, if the key was written once. See Txn.SingleDelete.
+	bitSingleDelete byte = 1 << 4
+	// Set if the value is encoded by one of Options.ValueTransformers.
+	bitTransformed byte = 1 << 5
 	// The MSB 2 bits are for transactions.
 	bitTxn    byte = 1 << 6 // Set if the entry is part of a txn.
 	bitFinTxn byte = 1 << 7 // Set if the entry is to indicate end of txn in value log.
@@ -110,12 +116,22 @@ func (r *safeRead) Entry(reader io.Reader) (*Entry, error) {
 	tee := newHashReader(reader)
 	var h header
 	hlen, err := h.DecodeFrom(tee)
-	if err != nil {
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
 		return nil, err
+	case err != nil:
+		// A garbled header, e.g. a varint overflow, is a torn write.
+		return nil, errTruncate
 	}
 	if h.klen > uint32(1<<16) { // Key length must be below uint16.
 		return nil, errTruncate
 	}
+	tagLen := int64(r.lf.sealOverhead())
+	if r.lf != nil && r.lf.MmapFile != nil &&
+		int64(h.klen)+int64(h.vlen)+tagLen > int64(len(r.lf.Data))-int64(r.recordOffset) {
+		// The entry can't extend beyond the end of the file.
+		return nil, errTruncate
+	}
 	kl := int(h.klen)
 	if cap(r.k) < kl {
 		r.k = make([]byte, 2*kl)
@@ -128,20 +144,13 @@ func (r *safeRead) Entry(reader io.Reader) (*Entry, error) {
 	e := &Entry{}
 	e.offset = r.recordOffset
 	e.hlen = hlen
-	buf := make([]byte, h.klen+h.vlen)
+	buf := make([]byte, int64(h.klen+h.vlen)+tagLen)
 	if _, err := io.ReadFull(tee, buf[:]); err != nil {
 		if err == io.EOF {
 			err = errTruncate
 		}
 		return nil, err
 	}
-	if r.lf.encryptionEnabled() {
-		if buf, err = r.lf.decryptKV(buf[:], r.recordOffset); err != nil {
-			return nil, err
-		}
-	}
-	e.Key = buf[:h.klen]
-	e.Value = buf[h.klen:]
 	var crcBuf [crc32.Size]byte
 	if _, err := io.ReadFull(reader, crcBuf[:]); err != nil {
 		if err == io.EOF {
@@ -153,6 +162,15 @@ func (r *safeRead) Entry(reader io.Reader) (*Entry, error) {
 	if crc != tee.Sum32() {
 		return nil, errTruncate
 	}
+	// The checksum is verified first, so that a torn write truncates the log, while an entry
+	// which fails authentication is an error.
+	if r.lf.encryptionEnabled() {
+		if buf, err = r.lf.decryptKV(buf, h, r.recordOffset); err != nil {
+			return nil, err
+		}
+	}
+	e.Key = buf[:h.klen]
+	e.Value = buf[h.klen : h.klen+h.vlen]
 	e.meta = h.meta
 	e.UserMeta = h.userMeta
 	e.ExpiresAt = h.expiresAt
@@ -177,6 +195,7 @@ func (vlog *valueLog) rewrite(f *logFile) error {
 
 	y.AssertTrue(vlog.db != nil)
 	var count, moved int
+	var movedBytes int64
 	fe := func(e Entry) error {
 		count++
 		if count%100000 == 0 {
@@ -213,6 +232,7 @@ func (vlog *valueLog) rewrite(f *logFile) error {
 		// an older vlog file. See the comments in the else part.
 		if vp.Fid == f.fid && vp.Offset == e.offset {
 			moved++
+			movedBytes += int64(len(e.Key) + len(e.Value))
 			// This new entry only contains the key, and a pointer to the value.
 			ne := new(Entry)
 			// Remove only the bitValuePointer and transaction markers. We
@@ -344,6 +364,7 @@ func (vlog *valueLog) rewrite(f *logFile) error {
 		vlog.filesLock.Unlock()
 	}
 
+	vlog.gcStats.recordRewrite(vlog.db, int64(f.size.Load())-movedBytes)
 	if deleteFileNow {
 		if err := vlog.deleteLogFile(f); err != nil {
 			return err
@@ -449,6 +470,9 @@ type valueLog struct {
 
 	garbageCh    chan struct{}
 	discardStats *discardStats
+	gcStats      vlogGCStats
+	// rotate is set to start a new file on the next write, whatever the size of the current one.
+	rotate atomic.Bool
 }
 
 func vlogFilePath(dirPath string, fid uint32) string {
@@ -509,6 +533,12 @@ func (vlog *valueLog) createVlogFile() (*logFile, error) {
 	if err != z.NewFile && err != nil {
 		return nil, err
 	}
+	if vlog.db.logsSynced() {
+		// The value log file gets synced, so its directory entry must be durable as well.
+		if err := syncDir(vlog.dirPath); err != nil {
+			return nil, y.Wrapf(err, "while creating value log file: %s", path)
+		}
+	}
 
 	vlog.filesLock.Lock()
 	vlog.filesMap[fid] = lf
@@ -541,9 +571,13 @@ func (vlog *valueLog) init(db *DB) {
 	vlog.dirPath = vlog.opt.ValueDir
 
 	vlog.garbageCh = make(chan struct{}, 1) // Only allow one GC at a time.
-	lf, err := InitDiscardStats(vlog.opt)
-	y.Check(err)
-	vlog.discardStats = lf
+	// The discard stats are only needed by the GC, which can't run in read-only mode, and are
+	// sorted in place when opened.
+	if !vlog.opt.ReadOnly {
+		lf, err := InitDiscardStats(vlog.opt)
+		y.Check(err)
+		vlog.discardStats = lf
+	}
 	// See TestPersistLFDiscardStats for purpose of statement below.
 	db.logToSyncChan(endVLogInitMsg)
 }
@@ -567,24 +601,29 @@ func (vlog *valueLog) open(db *DB) error {
 		return y.Wrapf(err, "Error while creating log file in valueLog.open")
 	}
 	fids := vlog.sortedFids()
-	for _, fid := range fids {
+	db.opt.openProgress(OpenStageValueLog, 0, len(fids))
+	flags := os.O_RDWR
+	if vlog.opt.ReadOnly {
+		flags = os.O_RDONLY
+	}
+	for i, fid := range fids {
 		lf, ok := vlog.filesMap[fid]
 		y.AssertTrue(ok)
 
-		// Just open in RDWR mode. This should not create a new log file.
+		// This should not create a new log file.
 		lf.opt = vlog.opt
-		if err := lf.open(vlog.fpath(fid), os.O_RDWR,
-			2*vlog.opt.ValueLogFileSize); err != nil {
+		if err := lf.open(vlog.fpath(fid), flags, 2*vlog.opt.ValueLogFileSize); err != nil {
 			return y.Wrapf(err, "Open existing file: %q", lf.path)
 		}
 		// We shouldn't delete the maxFid file.
-		if lf.size.Load() == vlogHeaderSize && fid != vlog.maxFid {
+		if lf.size.Load() == vlogHeaderSize && fid != vlog.maxFid && !vlog.opt.ReadOnly {
 			vlog.opt.Infof("Deleting empty file: %s", lf.path)
 			if err := lf.Delete(); err != nil {
 				return y.Wrapf(err, "while trying to delete empty file: %s", lf.path)
 			}
 			delete(vlog.filesMap, fid)
 		}
+		db.opt.openProgress(OpenStageValueLog, i+1, len(fids))
 	}
 
 	if vlog.opt.ReadOnly {
@@ -602,11 +641,13 @@ func (vlog *valueLog) open(db *DB) error {
 	if err != nil {
 		return y.Wrapf(err, "while iterating over: %s", last.path)
 	}
+	db.recordRecovery(last.tornTail(lastOff))
+	last.truncated = true
 	if err := last.Truncate(int64(lastOff)); err != nil {
 		return y.Wrapf(err, "while truncating last value log file: %s", last.path)
 	}
 
-	// Don't write to the old log file. Always create a new one.
+	// Don't write to the old log file, past its truncation. Always create a new one.
 	if _, err := vlog.createVlogFile(); err != nil {
 		return y.Wrapf(err, "Error while creating log file in valueLog.open")
 	}
@@ -667,6 +708,17 @@ type request struct {
 	Wg   sync.WaitGroup
 	Err  error
 	ref  atomic.Int32
+
+	enqueued time.Time // When the request was sent to the write channel.
+
+	// rotate, if set, asks the writer to hand the memtable to the flusher, once the entries of
+	// the batch are written, and is the cause of the flush. rotated is the last memtable to be
+	// flushed then, or nil if there is none.
+	rotate  string
+	rotated *memTable
+	// fence is called by the writer once the entries of the batch are written, while the writes
+	// after them wait.
+	fence func()
 }
 
 func (req *request) reset() {
@@ -675,6 +727,10 @@ func (req *request) reset() {
 	req.Wg = sync.WaitGroup{}
 	req.Err = nil
 	req.ref.Store(0)
+	req.enqueued = time.Time{}
+	req.rotate = ""
+	req.rotated = nil
+	req.fence = nil
 }
 
 func (req *request) IncrRef() {
@@ -736,6 +792,7 @@ func (vlog *valueLog) sync() error {
 
 	err := curlf.Sync()
 	curlf.lock.RUnlock()
+	vlog.db.pipeline.countSync(vlog.db.metrics)
 	return err
 }
 
@@ -794,11 +851,17 @@ func (vlog *valueLog) write(reqs []*request) error {
 	curlf := vlog.filesMap[maxFid]
 	vlog.filesLock.RUnlock()
 
+	start := time.Now()
 	defer func() {
+		pipeline, metrics := vlog.db.pipeline, vlog.db.metrics
+		pipeline.valueLogWrite.observe(metrics, time.Since(start))
 		if vlog.opt.SyncWrites {
+			syncStart := time.Now()
 			if err := curlf.Sync(); err != nil {
 				vlog.opt.Errorf("Error while curlf sync: %v\n", err)
 			}
+			pipeline.sync.observe(metrics, time.Since(syncStart))
+			pipeline.countSync(metrics)
 		}
 	}()
 
@@ -825,7 +888,7 @@ func (vlog *valueLog) write(reqs []*request) error {
 	}
 
 	toDisk := func() error {
-		if vlog.woffset() > uint32(vlog.opt.ValueLogFileSize) ||
+		if vlog.rotate.Swap(false) || vlog.woffset() > uint32(vlog.opt.ValueLogFileSize) ||
 			vlog.numEntriesWritten > vlog.opt.ValueLogMaxEntries {
 			if err := curlf.doneWriting(vlog.woffset()); err != nil {
 				return err
@@ -883,8 +946,8 @@ func (vlog *valueLog) write(reqs []*request) error {
 			bytesWritten += buf.Len()
 			// No need to flush anything, we write to file directly via mmap.
 		}
-		y.NumWritesVlogAdd(vlog.opt.MetricsEnabled, int64(written))
-		y.NumBytesWrittenVlogAdd(vlog.opt.MetricsEnabled, int64(bytesWritten))
+		vlog.db.metrics.NumWritesVlogAdd(int64(written))
+		vlog.db.metrics.NumBytesWrittenVlogAdd(int64(bytesWritten))
 
 		vlog.numEntriesWritten += uint32(written)
 		vlog.db.threshold.update(valueSizes)
@@ -951,9 +1014,14 @@ func (vlog *valueLog) Read(vp valuePointer, _ *y.Slice) ([]byte, func(), error)
 	}
 	var h header
 	headerLen := h.Decode(buf)
+	if vlog.opt.StrictInvariantChecks {
+		if err := checkValuePointer(lf, vp, buf, h, headerLen); err != nil {
+			return nil, cb, err
+		}
+	}
 	kv := buf[headerLen:]
 	if lf.encryptionEnabled() {
-		kv, err = lf.decryptKV(kv, vp.Offset)
+		kv, err = lf.decryptKV(kv, h, vp.Offset)
 		if err != nil {
 			return nil, cb, err
 		}
@@ -984,8 +1052,8 @@ func (vlog *valueLog) readValueBytes(vp valuePointer) ([]byte, *logFile, error)
 	}
 
 	buf, err := lf.read(vp)
-	y.NumReadsVlogAdd(vlog.db.opt.MetricsEnabled, 1)
-	y.NumBytesReadsVlogAdd(vlog.db.opt.MetricsEnabled, int64(len(buf)))
+	vlog.db.metrics.NumReadsVlogAdd(1)
+	vlog.db.metrics.NumBytesReadsVlogAdd(int64(len(buf)))
 	return buf, lf, err
 }
 
@@ -1085,7 +1153,9 @@ func (vlog *valueLog) runGC(discardRatio float64) error {
 		if lf == nil {
 			return ErrNoRewrite
 		}
-		return vlog.doRunGC(lf)
+		err := vlog.doRunGC(lf)
+		vlog.db.events.record(EventValueLogGC, int64(lf.fid), err)
+		return err
 	default:
 		return ErrRejected
 	}
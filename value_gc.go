@@ -0,0 +1,191 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/ristretto/v2/z"
+)
+
+// ValueLogGCPolicy is the policy of the value log GC scheduler, see Options.ValueLogGCPolicy.
+type ValueLogGCPolicy struct {
+	// Interval is how often the value log files are checked. Zero disables the scheduler.
+	Interval time.Duration
+	// DiscardRatio is the part of a value log file which must be discardable for it to be
+	// rewritten, like the discardRatio of RunValueLogGC. Zero means 0.5.
+	DiscardRatio float64
+	// MinDiscardBytes is the number of bytes a value log file must have discardable too, so that
+	// the small files aren't rewritten for little.
+	MinDiscardBytes int64
+	// MaxFilesPerRun is the number of value log files rewritten at most every Interval. Zero
+	// means one.
+	MaxFilesPerRun int
+}
+
+// ValueLogGCStats are the statistics of the value log GC, of RunValueLogGC and the scheduler of
+// Options.ValueLogGCPolicy, since the DB was opened.
+type ValueLogGCStats struct {
+	// Runs is the number of checks of the scheduler, and LastRun the time of the last one.
+	Runs    int64
+	LastRun time.Time
+	// FilesRewritten is the number of value log files rewritten, and BytesReclaimed the size of
+	// those files, less the data moved out of them.
+	FilesRewritten int64
+	BytesReclaimed int64
+	// DiscardBytes is the number of discardable bytes in the value log files, by their discard
+	// stats, as of the last check of the scheduler.
+	DiscardBytes int64
+}
+
+// vlogGCStats holds the ValueLogGCStats of the value log.
+type vlogGCStats struct {
+	runs           atomic.Int64
+	lastRun        atomic.Int64 // In Unix nanoseconds.
+	filesRewritten atomic.Int64
+	bytesReclaimed atomic.Int64
+	discardBytes   atomic.Int64
+}
+
+// recordRewrite records the rewrite of a value log file, reclaiming reclaimed bytes.
+func (s *vlogGCStats) recordRewrite(db *DB, reclaimed int64) {
+	reclaimed = max(reclaimed, 0)
+	s.filesRewritten.Add(1)
+	s.bytesReclaimed.Add(reclaimed)
+	db.metrics.NumGCRewritesVlogAdd(1)
+	db.metrics.NumGCBytesReclaimedVlogAdd(reclaimed)
+}
+
+// ValueLogGCStats returns the statistics of the value log GC.
+func (db *DB) ValueLogGCStats() ValueLogGCStats {
+	s := &db.vlog.gcStats
+	stats := ValueLogGCStats{
+		Runs:           s.runs.Load(),
+		FilesRewritten: s.filesRewritten.Load(),
+		BytesReclaimed: s.bytesReclaimed.Load(),
+		DiscardBytes:   s.discardBytes.Load(),
+	}
+	if ns := s.lastRun.Load(); ns != 0 {
+		stats.LastRun = time.Unix(0, ns)
+	}
+	return stats
+}
+
+// runGCScheduler runs the value log GC every ValueLogGCPolicy.Interval of the RuntimeOptions,
+// until lc is closed.
+func (vlog *valueLog) runGCScheduler(lc *z.Closer) {
+	defer lc.Done()
+	defer func() { vlog.db.metrics.NumGCDiscardBytesVlogAdd(-vlog.gcStats.discardBytes.Load()) }()
+
+	interval := vlog.db.runtime.Load().ValueLogGCPolicy.Interval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lc.HasBeenClosed():
+			return
+		case now := <-ticker.C:
+			if iv := vlog.db.runtime.Load().ValueLogGCPolicy.Interval; iv != interval {
+				interval = iv
+				ticker.Reset(interval)
+			}
+			if !vlog.db.maintenanceAllowed(MaintenanceValueLogGC, now) {
+				continue
+			}
+		}
+		if _, err := vlog.scheduledGC(lc); err != nil && !errors.Is(err, ErrRejected) {
+			vlog.opt.Warningf("While running value log GC: %v", err)
+		}
+	}
+}
+
+// scheduledGC rewrites the value log files crossing the thresholds of the policy, the most
+// discardable first, until lc is closed. It returns how many it rewrote.
+func (vlog *valueLog) scheduledGC(lc *z.Closer) (int, error) {
+	p := vlog.db.runtime.Load().ValueLogGCPolicy
+	ratio := p.DiscardRatio
+	if ratio <= 0 {
+		ratio = 0.5
+	}
+	fids, discard := vlog.gcCandidates(ratio, p.MinDiscardBytes)
+
+	s := &vlog.gcStats
+	s.runs.Add(1)
+	s.lastRun.Store(time.Now().UnixNano())
+	vlog.db.metrics.NumGCDiscardBytesVlogAdd(discard - s.discardBytes.Swap(discard))
+
+	var rewritten int
+	for _, fid := range fids[:min(len(fids), max(p.MaxFilesPerRun, 1))] {
+		if lc.Ctx().Err() != nil {
+			break
+		}
+		if err := vlog.gcFile(fid); err != nil {
+			return rewritten, err
+		}
+		rewritten++
+	}
+	return rewritten, nil
+}
+
+// gcCandidates returns the value log files whose discard stats have at least minDiscard bytes,
+// and ratio of their size, discardable, the most discardable first. It returns the number of
+// discardable bytes of all the files too.
+func (vlog *valueLog) gcCandidates(ratio float64, minDiscard int64) ([]uint32, int64) {
+	type candidate struct {
+		fid     uint32
+		discard int64
+	}
+	var candidates []candidate
+	var total int64
+
+	vlog.filesLock.RLock()
+	vlog.discardStats.Lock()
+	vlog.discardStats.Iterate(func(fid, discard uint64) {
+		lf, ok := vlog.filesMap[uint32(fid)]
+		// The file being written is never rewritten.
+		if !ok || uint32(fid) >= vlog.maxFid {
+			return
+		}
+		total += int64(discard)
+		if int64(discard) >= minDiscard && float64(discard) >= ratio*float64(lf.size.Load()) {
+			candidates = append(candidates, candidate{uint32(fid), int64(discard)})
+		}
+	})
+	vlog.discardStats.Unlock()
+	vlog.filesLock.RUnlock()
+
+	slices.SortFunc(candidates, func(a, b candidate) int { return cmp.Compare(b.discard, a.discard) })
+	fids := make([]uint32, 0, len(candidates))
+	for _, c := range candidates {
+		fids = append(fids, c.fid)
+	}
+	return fids, total
+}
+
+// gcFile rewrites the value log file fid, unless it's gone. It returns ErrRejected if another GC
+// is running.
+func (vlog *valueLog) gcFile(fid uint32) error {
+	select {
+	case vlog.garbageCh <- struct{}{}:
+		defer func() { <-vlog.garbageCh }()
+	default:
+		return ErrRejected
+	}
+	vlog.filesLock.RLock()
+	lf, ok := vlog.filesMap[fid]
+	ok = ok && fid < vlog.maxFid && !slices.Contains(vlog.filesToBeDeleted, fid)
+	vlog.filesLock.RUnlock()
+	if !ok {
+		return nil
+	}
+	err := vlog.doRunGC(lf)
+	vlog.db.events.record(EventValueLogGC, int64(fid), err)
+	return err
+}
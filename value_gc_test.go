@@ -0,0 +1,106 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueLogGCPolicy(t *testing.T) {
+	dir := t.TempDir()
+	opt := getTestOptions(dir)
+	opt.ValueLogFileSize = 1 << 20
+	opt.ValueThreshold = 1 << 10
+	opt.ValueLogGCPolicy = ValueLogGCPolicy{
+		Interval:        time.Hour,
+		DiscardRatio:    0.5,
+		MinDiscardBytes: 1 << 10,
+		MaxFilesPerRun:  2,
+	}
+	db, err := Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	key := func(i int) []byte { return fmt.Appendf(nil, "key%03d", i) }
+	val := make([]byte, 32<<10)
+	for i := range 100 {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Set(key(i), val)
+		}))
+	}
+	fids := db.vlog.sortedFids()
+	require.Greater(t, len(fids), 3)
+	size := func(fid uint32) int64 {
+		db.vlog.filesLock.RLock()
+		defer db.vlog.filesLock.RUnlock()
+		return int64(db.vlog.filesMap[fid].size.Load())
+	}
+
+	// Below the thresholds.
+	db.vlog.updateDiscardStats(map[uint32]int64{fids[0]: 512, fids[1]: size(fids[1]) / 4})
+	n, err := db.vlog.scheduledGC(db.closers.gcScheduler)
+	require.NoError(t, err)
+	require.Zero(t, n)
+	stats := db.ValueLogGCStats()
+	require.Equal(t, int64(1), stats.Runs)
+	require.Equal(t, size(fids[1])/4+512, stats.DiscardBytes)
+
+	// The most discardable first, MaxFilesPerRun at most.
+	db.vlog.updateDiscardStats(map[uint32]int64{
+		fids[0]: size(fids[0]), fids[1]: size(fids[1]) / 2, fids[2]: size(fids[2])})
+	n, err = db.vlog.scheduledGC(db.closers.gcScheduler)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	remaining := db.vlog.sortedFids()
+	require.NotContains(t, remaining, fids[0])
+	require.Contains(t, remaining, fids[1])
+	require.NotContains(t, remaining, fids[2])
+
+	stats = db.ValueLogGCStats()
+	require.Equal(t, int64(2), stats.Runs)
+	require.Equal(t, int64(2), stats.FilesRewritten)
+	require.False(t, stats.LastRun.IsZero())
+
+	// The values moved out of the files are still there.
+	require.NoError(t, db.View(func(txn *Txn) error {
+		for i := range 100 {
+			item, err := txn.Get(key(i))
+			require.NoError(t, err)
+			require.Equal(t, val, getItemValue(t, item))
+		}
+		return nil
+	}))
+}
+
+func TestValueLogGCScheduler(t *testing.T) {
+	dir := t.TempDir()
+	opt := getTestOptions(dir)
+	opt.ValueLogFileSize = 1 << 20
+	opt.ValueThreshold = 1 << 10
+	opt.ValueLogGCPolicy = ValueLogGCPolicy{Interval: 10 * time.Millisecond}
+	db, err := Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	val := make([]byte, 32<<10)
+	for i := range 100 {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Set(fmt.Appendf(nil, "key%03d", i%10), val)
+		}))
+	}
+	fid := db.vlog.sortedFids()[0]
+	db.vlog.updateDiscardStats(map[uint32]int64{fid: opt.ValueLogFileSize})
+
+	require.Eventually(t, func() bool {
+		return db.ValueLogGCStats().FilesRewritten > 0
+	}, 10*time.Second, 10*time.Millisecond)
+	require.NotContains(t, db.vlog.sortedFids(), fid)
+	require.Positive(t, db.ValueLogGCStats().BytesReclaimed)
+}
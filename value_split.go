@@ -0,0 +1,231 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+
+	"github.com/luxfi/zapdb/y"
+)
+
+// splitChunkPrefix starts the keys of the chunks of the values split by Options.ValueSplitSize.
+// It is followed by the key of the value, the nonce of the value and the index of the chunk, big
+// endian, so that the chunks of a value sort in order.
+var splitChunkPrefix = []byte("!badger!split!")
+
+// splitValueID is the transformer ID reserved for the split values. Their stored value is a
+// manifest of the chunks, tagged like the values encoded by a ValueTransformer.
+const splitValueID = math.MaxUint32
+
+// The flags of a split value.
+const (
+	// splitTransformed is set if the value joined from the chunks is encoded by a
+	// ValueTransformer.
+	splitTransformed byte = 1 << 0
+)
+
+// splitManifest is the manifest of the chunks of a split value.
+type splitManifest struct {
+	flags byte
+	// nonce tells the chunks of the value apart from those of the other values of its key.
+	nonce  uint64
+	size   uint64
+	chunks uint32
+}
+
+func (m splitManifest) encode() []byte {
+	buf := binary.AppendUvarint(nil, splitValueID)
+	buf = binary.AppendUvarint(buf, 0)
+	buf = append(buf, m.flags)
+	buf = binary.BigEndian.AppendUint64(buf, m.nonce)
+	buf = binary.AppendUvarint(buf, m.size)
+	return binary.AppendUvarint(buf, uint64(m.chunks))
+}
+
+// errSplitManifest is returned when reading a split value with an invalid manifest.
+var errSplitManifest = errors.New("Invalid manifest of split value")
+
+// decodeSplitManifest returns the manifest stored as the value of a split value, and ok false if
+// stored, encoded by a transformer, isn't one.
+func decodeSplitManifest(stored []byte) (m splitManifest, ok bool, err error) {
+	id, n := binary.Uvarint(stored)
+	if n <= 0 || id != splitValueID {
+		return m, false, nil
+	}
+	_, k := binary.Uvarint(stored[n:])
+	if k <= 0 || len(stored[n+k:]) < 9 {
+		return m, true, errSplitManifest
+	}
+	body := stored[n+k:]
+	m.flags = body[0]
+	m.nonce = binary.BigEndian.Uint64(body[1:9])
+	size, k := binary.Uvarint(body[9:])
+	if k <= 0 {
+		return m, true, errSplitManifest
+	}
+	chunks, j := binary.Uvarint(body[9+k:])
+	if j <= 0 || chunks > math.MaxUint32 {
+		return m, true, errSplitManifest
+	}
+	m.size, m.chunks = size, uint32(chunks)
+	return m, true, nil
+}
+
+func splitChunkKey(key []byte, nonce uint64, i uint32) []byte {
+	out := make([]byte, 0, len(splitChunkPrefix)+len(key)+12)
+	out = append(out, splitChunkPrefix...)
+	out = append(out, key...)
+	out = binary.BigEndian.AppendUint64(out, nonce)
+	return binary.BigEndian.AppendUint32(out, i)
+}
+
+// parseSplitChunkKey returns the key of the value of a chunk, and the nonce of the value.
+func parseSplitChunkKey(chunkKey []byte) (key []byte, nonce uint64, ok bool) {
+	if !bytes.HasPrefix(chunkKey, splitChunkPrefix) || len(chunkKey) < len(splitChunkPrefix)+12 {
+		return nil, 0, false
+	}
+	end := len(chunkKey) - 12
+	return chunkKey[len(splitChunkPrefix):end], binary.BigEndian.Uint64(chunkKey[end:]), true
+}
+
+// splitEntry returns the chunks of the value of e, and the entry of its manifest, if it's longer
+// than ValueSplitSize. It returns nil chunks if the value isn't split.
+func (db *DB) splitEntry(e *Entry) (*Entry, []*Entry) {
+	size := db.opt.ValueSplitSize
+	if size <= 0 || int64(len(e.Value)) <= size || e.meta&(bitDelete|bitMergeEntry) > 0 ||
+		bytes.HasPrefix(e.Key, badgerPrefix) {
+		return e, nil
+	}
+	m := splitManifest{nonce: rand.Uint64(), size: uint64(len(e.Value))}
+	if e.meta&bitTransformed > 0 {
+		m.flags |= splitTransformed
+	}
+	var chunks []*Entry
+	for val := e.Value; len(val) > 0; m.chunks++ {
+		n := min(int64(len(val)), size)
+		chunks = append(chunks, &Entry{
+			Key:       splitChunkKey(e.Key, m.nonce, m.chunks),
+			Value:     val[:n],
+			ExpiresAt: e.ExpiresAt,
+			version:   e.version,
+		})
+		val = val[n:]
+	}
+	ne := *e
+	ne.Value = m.encode()
+	ne.meta |= bitTransformed
+	return &ne, chunks
+}
+
+// setSplit adds the chunks of a split value, and its manifest e, to the pending writes, or none
+// of them.
+func (txn *Txn) setSplit(e *Entry, chunks []*Entry) error {
+	count, size, memory := txn.count, txn.size, txn.memory
+	var err error
+	for i, c := range chunks {
+		if err = txn.modifyKey(c, true); err != nil {
+			for _, c := range chunks[:i] {
+				txn.deletePending(string(c.Key))
+			}
+			break
+		}
+	}
+	if err == nil {
+		if err = txn.modify(e); err != nil {
+			for _, c := range chunks {
+				txn.deletePending(string(c.Key))
+			}
+		}
+	}
+	if err != nil {
+		txn.count, txn.size, txn.memory = count, size, memory
+	}
+	return err
+}
+
+// dropPendingChunks removes the chunks of old, a pending write overwritten in the transaction,
+// from the pending writes, if it's a split value.
+func (txn *Txn) dropPendingChunks(old *Entry) {
+	if old.meta&bitTransformed == 0 {
+		return
+	}
+	m, ok, err := decodeSplitManifest(old.Value)
+	if !ok || err != nil {
+		return
+	}
+	for i := uint32(0); i < m.chunks; i++ {
+		txn.deletePending(string(splitChunkKey(old.Key, m.nonce, i)))
+	}
+}
+
+// decodeValue returns the value of key stored with bitTransformed, joining the chunks of a split
+// value read by chunk.
+func (db *DB) decodeValue(key, stored []byte, chunk func(chunkKey []byte) ([]byte, error)) (
+	[]byte, error) {
+	m, ok, err := decodeSplitManifest(stored)
+	if err != nil {
+		return nil, y.Wrapf(err, "While reading value of key %q", key)
+	}
+	if !ok {
+		return db.transformers.decode(key, stored)
+	}
+	val := make([]byte, 0, m.size)
+	for i := uint32(0); i < m.chunks; i++ {
+		c, err := chunk(splitChunkKey(key, m.nonce, i))
+		if err != nil {
+			return nil, y.Wrapf(err, "While reading chunk %d of value of key %q", i, key)
+		}
+		val = append(val, c...)
+	}
+	if uint64(len(val)) != m.size {
+		return nil, fmt.Errorf("Chunks of value of key %q have %d bytes, not %d", key, len(val),
+			m.size)
+	}
+	if m.flags&splitTransformed > 0 {
+		return db.transformers.decode(key, val)
+	}
+	return val, nil
+}
+
+// readChunk returns the value of the chunk of a split value written at version.
+func (db *DB) readChunk(chunkKey []byte, version uint64) ([]byte, error) {
+	vs, err := db.get(y.KeyWithTs(chunkKey, version))
+	if err != nil {
+		return nil, err
+	}
+	if vs.Version != version || vs.Meta&bitDelete > 0 {
+		return nil, fmt.Errorf("Chunk %q of split value not found", chunkKey)
+	}
+	return db.readValue(vs)
+}
+
+// splitChunkLive tells if the version of the key of the value of a chunk, with its version,
+// is still the split value of the chunk. Compactions delete the chunks of the values discarded.
+func (db *DB) splitChunkLive(chunkKey []byte) bool {
+	key, nonce, ok := parseSplitChunkKey(y.ParseKey(chunkKey))
+	if !ok {
+		return true
+	}
+	version := y.ParseTs(chunkKey)
+	vs, err := db.get(y.KeyWithTs(key, version))
+	if err != nil {
+		return true
+	}
+	if vs.Version != version || vs.Meta&bitTransformed == 0 || vs.Meta&bitDelete > 0 {
+		return false
+	}
+	stored, err := db.readValue(vs)
+	if err != nil {
+		return true
+	}
+	m, ok, err := decodeSplitManifest(stored)
+	return err != nil || (ok && m.nonce == nonce)
+}
@@ -0,0 +1,96 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/y"
+)
+
+func TestValueSplit(t *testing.T) {
+	dir := t.TempDir()
+	opt := getTestOptions(dir).WithNumCompactors(0).WithMaxValueSize(1 << 10).
+		WithValueSplitSize(1 << 10)
+	db, err := Open(opt)
+	require.NoError(t, err)
+
+	big := bytes.Repeat([]byte("0123456789"), 1000)
+	key := []byte("big")
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		require.NoError(t, txn.Set(key, big))
+		// The chunks of the pending write are joined too.
+		item, err := txn.Get(key)
+		require.NoError(t, err)
+		require.Equal(t, big, getItemValue(t, item))
+		return txn.Set([]byte("small"), []byte("value"))
+	}))
+
+	read := func(db *DB) {
+		require.NoError(t, db.View(func(txn *Txn) error {
+			item, err := txn.Get(key)
+			require.NoError(t, err)
+			require.Equal(t, big, getItemValue(t, item))
+
+			// The chunks are hidden from the iterators.
+			it := txn.NewIterator(DefaultIteratorOptions)
+			defer it.Close()
+			var keys []string
+			for it.Rewind(); it.Valid(); it.Next() {
+				keys = append(keys, string(it.Item().Key()))
+				if bytes.Equal(it.Item().Key(), key) {
+					require.Equal(t, big, getItemValue(t, it.Item()))
+				}
+			}
+			require.Equal(t, []string{"big", "small"}, keys)
+			return nil
+		}))
+	}
+	read(db)
+	require.NoError(t, db.Close())
+
+	db, err = Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	read(db)
+
+	// Once the split value is overwritten and discarded, its chunks aren't live anymore.
+	var chunkKey []byte
+	require.NoError(t, db.View(func(txn *Txn) error {
+		it := txn.NewIterator(IteratorOptions{Prefix: splitChunkPrefix, InternalAccess: true})
+		defer it.Close()
+		it.Rewind()
+		require.True(t, it.Valid())
+		chunkKey = y.KeyWithTs(it.Item().KeyCopy(nil), it.Item().Version())
+		return nil
+	}))
+	require.True(t, db.splitChunkLive(chunkKey))
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.Set(key, []byte("value"))
+	}))
+	require.NoError(t, db.Close())
+	db, err = Open(opt)
+	require.NoError(t, err)
+	cdef := compactDef{
+		thisLevel: db.lc.levels[0],
+		nextLevel: db.lc.levels[1],
+		top:       db.lc.levels[0].tables,
+		t:         db.lc.levelTargets(),
+	}
+	cdef.t.baseLevel = 1
+	require.NoError(t, db.lc.runCompactDef(-1, 0, cdef))
+	require.False(t, db.splitChunkLive(chunkKey))
+
+	// A value overwritten in its transaction doesn't write its chunks.
+	txn := db.NewTransaction(true)
+	defer txn.Discard()
+	require.NoError(t, txn.Set([]byte("other"), big))
+	require.NoError(t, txn.Delete([]byte("other")))
+	require.Len(t, txn.pendingWrites, 1)
+}
@@ -718,10 +718,21 @@ func TestReadOnlyOpenWithPartialAppendToWAL(t *testing.T) {
 	require.NoError(t, os.WriteFile(kv.mtFilePath(1), buf, 0777))
 
 	opts.ReadOnly = true
-	// Badger should fail a read-only open with values to replay
-	_, err = Open(opts)
-	require.Error(t, err)
-	require.Regexp(t, "Log truncate required", err.Error())
+	// Badger should replay the complete transactions without truncating the WAL.
+	kv, err = Open(opts)
+	require.NoError(t, err)
+	require.NoError(t, kv.View(func(txn *Txn) error {
+		item, err := txn.Get(k0)
+		require.NoError(t, err)
+		require.Equal(t, v0, getItemValue(t, item))
+		_, err = txn.Get(k1)
+		require.ErrorIs(t, err, ErrKeyNotFound)
+		return nil
+	}))
+	require.NoError(t, kv.Close())
+	fi, err := os.Stat(kv.mtFilePath(1))
+	require.NoError(t, err)
+	require.Equal(t, int64(len(buf)), fi.Size())
 }
 
 func TestValueLogTrigger(t *testing.T) {
@@ -1271,3 +1282,53 @@ func TestFirstVlogFile(t *testing.T) {
 	require.NotZero(t, len(fids))
 	require.Equal(t, uint32(1), fids[0])
 }
+
+func TestValueLogTornTailReport(t *testing.T) {
+	dir, err := os.MkdirTemp("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	opt := getTestOptions(dir).WithValueThreshold(16)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.Set([]byte("foo"), bytes.Repeat([]byte("v"), 100))
+	}))
+	require.Empty(t, db.RecoveryReport().Logs)
+	vlogPath := db.vlog.fpath(db.vlog.maxFid)
+	require.NoError(t, db.Close())
+
+	// Simulate a torn write at the end of the value log.
+	fi, err := os.Stat(vlogPath)
+	require.NoError(t, err)
+	f, err := os.OpenFile(vlogPath, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.Write(bytes.Repeat([]byte{0xff}, 64))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	db, err = Open(opt)
+	require.NoError(t, err)
+	report := db.RecoveryReport()
+	require.Len(t, report.Logs, 1)
+	require.Equal(t, vlogPath, report.Logs[0].Path)
+	require.Equal(t, uint32(fi.Size()), report.Logs[0].Offset)
+	require.Equal(t, int64(64), report.DiscardedBytes())
+	require.Zero(t, report.DiscardedEntries())
+
+	require.NoError(t, db.View(func(txn *Txn) error {
+		item, err := txn.Get([]byte("foo"))
+		require.NoError(t, err)
+		val, err := item.ValueCopy(nil)
+		require.NoError(t, err)
+		require.Equal(t, bytes.Repeat([]byte("v"), 100), val)
+		return nil
+	}))
+	require.NoError(t, db.Close())
+
+	// The tail was truncated, so the next open is clean.
+	db, err = Open(opt)
+	require.NoError(t, err)
+	require.Empty(t, db.RecoveryReport().Logs)
+	require.NoError(t, db.Close())
+}
@@ -0,0 +1,127 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/luxfi/zapdb/y"
+)
+
+// ValueTransformer encodes the values of the keys with a prefix on write, and decodes them on
+// read, so that application-level encryption or packing of values is done by the store rather
+// than at every call site. See Options.ValueTransformers.
+//
+// The values encoded are tagged with the ID and Version of the transformer, so that they are
+// decoded by it whatever the transformers of their prefix later on.
+type ValueTransformer struct {
+	// Prefix is the prefix of the keys whose values are encoded. The transformer of the longest
+	// prefix of a key encodes its values.
+	Prefix []byte
+	// ID tells the transformer apart in the values it encoded. It must be unique among the
+	// transformers, and never change.
+	ID uint32
+	// Version is passed to Decode with the values encoded from now on, so that the values
+	// encoded by earlier versions of the transformer are still decoded.
+	Version uint32
+	// Encode returns the value stored for value.
+	Encode func(key, value []byte) ([]byte, error)
+	// Decode returns the value encoded by Encode, when the transformer was at version.
+	Decode func(key, encoded []byte, version uint32) ([]byte, error)
+}
+
+// valueTransformers are the transformers of Options.ValueTransformers.
+type valueTransformers struct {
+	// byPrefix are the transformers by prefix, the longest prefixes first.
+	byPrefix []*ValueTransformer
+	byID     map[uint32]*ValueTransformer
+}
+
+func newValueTransformers(list []ValueTransformer) (valueTransformers, error) {
+	vt := valueTransformers{byID: make(map[uint32]*ValueTransformer)}
+	prefixes := make(map[string]bool)
+	for i := range list {
+		t := &list[i]
+		switch {
+		case t.Encode == nil || t.Decode == nil:
+			return vt, fmt.Errorf("Value transformer %d must have both Encode and Decode", t.ID)
+		case t.ID == splitValueID:
+			return vt, fmt.Errorf("Value transformer ID %d is reserved", t.ID)
+		case vt.byID[t.ID] != nil:
+			return vt, fmt.Errorf("Value transformer ID %d is used twice", t.ID)
+		case prefixes[string(t.Prefix)]:
+			return vt, fmt.Errorf("Value transformer prefix %q is used twice", t.Prefix)
+		}
+		vt.byID[t.ID] = t
+		prefixes[string(t.Prefix)] = true
+		vt.byPrefix = append(vt.byPrefix, t)
+	}
+	sort.Slice(vt.byPrefix, func(i, j int) bool {
+		return len(vt.byPrefix[i].Prefix) > len(vt.byPrefix[j].Prefix)
+	})
+	return vt, nil
+}
+
+// get returns the transformer encoding the values of key, or nil if there is none.
+func (vt *valueTransformers) get(key []byte) *ValueTransformer {
+	if bytes.HasPrefix(key, badgerPrefix) {
+		return nil
+	}
+	for _, t := range vt.byPrefix {
+		if bytes.HasPrefix(key, t.Prefix) {
+			return t
+		}
+	}
+	return nil
+}
+
+// encode returns e with its value encoded by the transformer of its key, or e itself if it has
+// none. Deletes, merge deltas and values encoded already are left as they are.
+func (vt *valueTransformers) encode(e *Entry) (*Entry, error) {
+	if len(vt.byPrefix) == 0 || e.meta&(bitDelete|bitMergeEntry|bitTransformed) > 0 {
+		return e, nil
+	}
+	t := vt.get(e.Key)
+	if t == nil {
+		return e, nil
+	}
+	val, err := t.Encode(e.Key, e.Value)
+	if err != nil {
+		return nil, y.Wrapf(err, "While encoding value of key %q", e.Key)
+	}
+	// The value is prefixed with the ID and version of the transformer.
+	buf := make([]byte, 0, 2*binary.MaxVarintLen32+len(val))
+	buf = binary.AppendUvarint(buf, uint64(t.ID))
+	buf = binary.AppendUvarint(buf, uint64(t.Version))
+	ne := *e
+	ne.Value = append(buf, val...)
+	ne.meta |= bitTransformed
+	return &ne, nil
+}
+
+// decode returns the value of key, stored as encoded by a transformer.
+func (vt *valueTransformers) decode(key, stored []byte) ([]byte, error) {
+	id, n := binary.Uvarint(stored)
+	if n <= 0 {
+		return nil, fmt.Errorf("Invalid header of value of key %q encoded by transformer", key)
+	}
+	version, m := binary.Uvarint(stored[n:])
+	if m <= 0 {
+		return nil, fmt.Errorf("Invalid header of value of key %q encoded by transformer", key)
+	}
+	t := vt.byID[uint32(id)]
+	if t == nil {
+		return nil, fmt.Errorf("%w: %d, for key %q", ErrUnknownValueTransformer, id, key)
+	}
+	val, err := t.Decode(key, stored[n+m:], uint32(version))
+	if err != nil {
+		return nil, y.Wrapf(err, "While decoding value of key %q", key)
+	}
+	return val, nil
+}
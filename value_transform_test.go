@@ -0,0 +1,160 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/y"
+)
+
+// xorTransformer xors the values of prefix with its version.
+func xorTransformer(prefix string, id, version uint32) ValueTransformer {
+	xor := func(val []byte, version uint32) []byte {
+		out := make([]byte, len(val))
+		for i, b := range val {
+			out[i] = b ^ byte(version)
+		}
+		return out
+	}
+	return ValueTransformer{
+		Prefix:  []byte(prefix),
+		ID:      id,
+		Version: version,
+		Encode:  func(key, val []byte) ([]byte, error) { return xor(val, version), nil },
+		Decode: func(key, encoded []byte, version uint32) ([]byte, error) {
+			return xor(encoded, version), nil
+		},
+	}
+}
+
+func TestValueTransformers(t *testing.T) {
+	dir := t.TempDir()
+	opt := getTestOptions(dir).WithValueThreshold(32).
+		WithValueTransformers(xorTransformer("a", 1, 1), xorTransformer("ab", 2, 1))
+	db, err := Open(opt)
+	require.NoError(t, err)
+
+	small, large := []byte("small"), bytes.Repeat([]byte("large"), 10)
+	keys := []string{"a1", "ab1", "b1"}
+	stored := func(key string) []byte {
+		var val []byte
+		require.NoError(t, db.View(func(txn *Txn) error {
+			item, err := txn.Get([]byte(key))
+			require.NoError(t, err)
+			v, cb, err := item.yieldStoredValue()
+			val = y.SafeCopy(nil, v)
+			runCallback(cb)
+			return err
+		}))
+		return val
+	}
+	check := func(val []byte) {
+		require.NoError(t, db.View(func(txn *Txn) error {
+			for _, k := range keys {
+				item, err := txn.Get([]byte(k))
+				require.NoError(t, err)
+				v, err := item.ValueCopy(nil)
+				require.NoError(t, err)
+				require.Equal(t, val, v, "key %s", k)
+			}
+			it := txn.NewIterator(DefaultIteratorOptions)
+			defer it.Close()
+			var n int
+			for it.Rewind(); it.Valid(); it.Next() {
+				require.NoError(t, it.Item().Value(func(v []byte) error {
+					require.Equal(t, val, v)
+					return nil
+				}))
+				n++
+			}
+			require.Equal(t, len(keys), n)
+			return nil
+		}))
+	}
+	for _, val := range [][]byte{small, large} {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			for _, k := range keys {
+				require.NoError(t, txn.Set([]byte(k), val))
+			}
+			// Pending writes are read decoded.
+			item, err := txn.Get([]byte("a1"))
+			require.NoError(t, err)
+			v, err := item.ValueCopy(nil)
+			require.NoError(t, err)
+			require.Equal(t, val, v)
+			return nil
+		}))
+		check(val)
+	}
+	// The values are tagged with the transformer of the longest prefix.
+	require.Equal(t, append([]byte{1, 1}, xorBytes(large, 1)...), stored("a1"))
+	require.Equal(t, byte(2), stored("ab1")[0])
+	require.Equal(t, large, stored("b1"))
+
+	// Values are backed up decoded.
+	var bak bytes.Buffer
+	_, err = db.Backup(&bak, 0)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	// The values encoded by earlier versions are decoded with their version, whatever the prefix
+	// of the transformer now.
+	opt.ValueTransformers = []ValueTransformer{xorTransformer("x", 1, 2),
+		xorTransformer("ab", 2, 3)}
+	db, err = Open(opt)
+	require.NoError(t, err)
+	check(large)
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.Set([]byte("ab2"), small)
+	}))
+	require.Equal(t, []byte{2, 3}, stored("ab2")[:2])
+	require.NoError(t, db.Close())
+
+	opt.ValueTransformers = opt.ValueTransformers[1:]
+	db, err = Open(opt)
+	require.NoError(t, err)
+	require.NoError(t, db.View(func(txn *Txn) error {
+		item, err := txn.Get([]byte("a1"))
+		require.NoError(t, err)
+		_, err = item.ValueCopy(nil)
+		require.ErrorIs(t, err, ErrUnknownValueTransformer)
+		return nil
+	}))
+	require.NoError(t, db.Close())
+
+	restored, err := Open(getTestOptions(t.TempDir()))
+	require.NoError(t, err)
+	require.NoError(t, restored.Load(&bak, 16))
+	require.NoError(t, restored.View(func(txn *Txn) error {
+		for _, k := range keys {
+			item, err := txn.Get([]byte(k))
+			require.NoError(t, err)
+			v, err := item.ValueCopy(nil)
+			require.NoError(t, err)
+			require.Equal(t, large, v)
+		}
+		return nil
+	}))
+	require.NoError(t, restored.Close())
+
+	dup := getTestOptions(t.TempDir()).
+		WithValueTransformers(xorTransformer("a", 1, 1), xorTransformer("b", 1, 1))
+	_, err = Open(dup)
+	require.ErrorContains(t, err, fmt.Sprintf("ID %d is used twice", 1))
+}
+
+func xorBytes(val []byte, b byte) []byte {
+	out := make([]byte, len(val))
+	for i := range val {
+		out[i] = val[i] ^ b
+	}
+	return out
+}
@@ -0,0 +1,148 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"sync"
+	"time"
+)
+
+// VersionGC decides which older versions of the keys the compactions and the TTL reaper may
+// purge, on top of Options.NumVersionsToKeep, so that MVCC layers on top of the DB can pin the
+// versions they still read. See Options.VersionGC.
+type VersionGC interface {
+	// Watermark returns the version at and below which the versions may be purged, given
+	// discardTs, the read timestamp of the oldest transaction running, or the timestamp set by
+	// SetDiscardTs in managed mode, at and below which they may be by default. No version above
+	// the lower of both is purged.
+	Watermark(discardTs uint64) uint64
+	// Retain returns whether to keep version, the nth version of key, without timestamp, at or
+	// below the watermark, counted from the newest, once n is over Options.NumVersionsToKeep. The
+	// first version it doesn't retain is purged with the older versions of the key.
+	Retain(key []byte, version uint64, n int) bool
+}
+
+// versionDiscardTs returns the version at and below which versions may be purged: the read
+// timestamp of the oldest transaction running, lowered to the watermark of Options.VersionGC and
+// to the versions pinned by ViewAt.
+func (db *DB) versionDiscardTs() uint64 {
+	return db.pins.bound(db.gcWatermark(db.orc.discardAtOrBelow()))
+}
+
+// gcWatermark lowers discardTs to the watermark of Options.VersionGC.
+func (db *DB) gcWatermark(discardTs uint64) uint64 {
+	if gc := db.opt.VersionGC; gc != nil {
+		return min(discardTs, gc.Watermark(discardTs))
+	}
+	return discardTs
+}
+
+// VersionGCByCount returns a VersionGC keeping n versions of every key, at least, rather than
+// Options.NumVersionsToKeep, if fewer.
+func VersionGCByCount(n int) VersionGC {
+	return versionsByCount(n)
+}
+
+type versionsByCount int
+
+func (c versionsByCount) Watermark(discardTs uint64) uint64 {
+	return discardTs
+}
+
+func (c versionsByCount) Retain(key []byte, version uint64, n int) bool {
+	return n <= int(c)
+}
+
+// VersionGCByWatermark returns a VersionGC purging no version above the one returned by
+// watermark, given the version at and below which versions are purgeable by default, like the
+// oldest version still read by a layer on top of the DB.
+func VersionGCByWatermark(watermark func(discardTs uint64) uint64) VersionGC {
+	return versionsByWatermark(watermark)
+}
+
+type versionsByWatermark func(discardTs uint64) uint64
+
+func (w versionsByWatermark) Watermark(discardTs uint64) uint64 {
+	return w(discardTs)
+}
+
+func (w versionsByWatermark) Retain(key []byte, version uint64, n int) bool {
+	return false
+}
+
+// VersionGCByAge returns a VersionGC purging the versions only once they were purgeable for age,
+// so that reads at the versions of up to age ago find them, whichever versions the transactions
+// running hold. The watermark lags the versions seen purgeable over the last age, to the
+// precision of how often it's asked for by the compactions.
+func VersionGCByAge(age time.Duration) VersionGC {
+	return &versionsByAge{age: age}
+}
+
+type versionsByAge struct {
+	age time.Duration
+
+	mu sync.Mutex
+	// samples are the discard timestamps seen, the oldest first.
+	samples []versionSample
+}
+
+type versionSample struct {
+	at time.Time
+	ts uint64
+}
+
+// versionAgeSamples is the number of samples of the watermark kept over an age, at most.
+const versionAgeSamples = 100
+
+func (a *versionsByAge) Watermark(discardTs uint64) uint64 {
+	now := time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if n := len(a.samples); n == 0 || now.Sub(a.samples[n-1].at) >= a.age/versionAgeSamples {
+		a.samples = append(a.samples, versionSample{at: now, ts: discardTs})
+	}
+	// The watermark is the last discard timestamp seen at least age ago, and the samples before
+	// it aren't needed anymore.
+	var ts uint64
+	i := 0
+	for i < len(a.samples) && now.Sub(a.samples[i].at) >= a.age {
+		ts = a.samples[i].ts
+		i++
+	}
+	if i > 1 {
+		a.samples = append(a.samples[:0], a.samples[i-1:]...)
+	}
+	return min(ts, discardTs)
+}
+
+func (a *versionsByAge) Retain(key []byte, version uint64, n int) bool {
+	return false
+}
+
+// VersionGCs returns a VersionGC keeping the versions kept by any of policies: its watermark is
+// the lowest of theirs, and it retains the versions retained by any of them.
+func VersionGCs(policies ...VersionGC) VersionGC {
+	return versionGCs(policies)
+}
+
+type versionGCs []VersionGC
+
+func (gcs versionGCs) Watermark(discardTs uint64) uint64 {
+	ts := discardTs
+	for _, gc := range gcs {
+		ts = min(ts, gc.Watermark(discardTs))
+	}
+	return ts
+}
+
+func (gcs versionGCs) Retain(key []byte, version uint64, n int) bool {
+	for _, gc := range gcs {
+		if gc.Retain(key, version, n) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionGC(t *testing.T) {
+	compact := func(t *testing.T, gc VersionGC) []keyValVersion {
+		// Disable compactions and keep single version of each key.
+		opt := DefaultOptions("").WithNumCompactors(0).WithNumVersionsToKeep(1).WithVersionGC(gc)
+		opt.managedTxns = true
+		var got []keyValVersion
+		runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+			createAndOpen(db, []keyValVersion{
+				{"foo", "bar", 5, 0}, {"foo", "bar", 4, 0}, {"foo", "bar", 3, 0},
+				{"foo", "bar", 2, 0}, {"fooz", "baz", 1, 0},
+			}, 0)
+			createAndOpen(db, []keyValVersion{{"foo", "bar", 1, 0}}, 1)
+			db.SetDiscardTs(10)
+
+			cdef := compactDef{
+				thisLevel: db.lc.levels[0],
+				nextLevel: db.lc.levels[1],
+				top:       db.lc.levels[0].tables,
+				bot:       db.lc.levels[1].tables,
+				t:         db.lc.levelTargets(),
+			}
+			cdef.t.baseLevel = 1
+			require.NoError(t, db.lc.runCompactDef(-1, 0, cdef))
+
+			txn := db.NewTransactionAt(10, false)
+			defer txn.Discard()
+			it := txn.NewIterator(IteratorOptions{AllVersions: true})
+			defer it.Close()
+			for it.Rewind(); it.Valid(); it.Next() {
+				item := it.Item()
+				got = append(got, keyValVersion{
+					string(item.Key()), string(getItemValue(t, item)), int(item.Version()), 0,
+				})
+			}
+		})
+		return got
+	}
+
+	t.Run("by count", func(t *testing.T) {
+		require.Equal(t, []keyValVersion{
+			{"foo", "bar", 5, 0}, {"foo", "bar", 4, 0}, {"foo", "bar", 3, 0},
+			{"fooz", "baz", 1, 0},
+		}, compact(t, VersionGCByCount(3)))
+	})
+	t.Run("by watermark", func(t *testing.T) {
+		// The versions above the watermark are kept, and the newest at or below it.
+		require.Equal(t, []keyValVersion{
+			{"foo", "bar", 5, 0}, {"foo", "bar", 4, 0}, {"foo", "bar", 3, 0},
+			{"fooz", "baz", 1, 0},
+		}, compact(t, VersionGCByWatermark(func(discardTs uint64) uint64 { return 3 })))
+	})
+	t.Run("combined", func(t *testing.T) {
+		require.Equal(t, []keyValVersion{
+			{"foo", "bar", 5, 0}, {"foo", "bar", 4, 0}, {"foo", "bar", 3, 0},
+			{"foo", "bar", 2, 0}, {"fooz", "baz", 1, 0},
+		}, compact(t, VersionGCs(
+			VersionGCByCount(3),
+			VersionGCByWatermark(func(discardTs uint64) uint64 { return 4 }),
+		)))
+	})
+}
+
+func TestVersionGCByAge(t *testing.T) {
+	gc := VersionGCByAge(50 * time.Millisecond)
+	// Nothing was purgeable for that long yet.
+	require.Zero(t, gc.Watermark(10))
+	require.False(t, gc.Retain([]byte("foo"), 1, 2))
+
+	time.Sleep(60 * time.Millisecond)
+	require.Equal(t, uint64(10), gc.Watermark(30))
+	time.Sleep(60 * time.Millisecond)
+	require.Equal(t, uint64(30), gc.Watermark(40))
+	// The samples older than the watermark are dropped.
+	require.Len(t, gc.(*versionsByAge).samples, 2)
+	// Never above the discard timestamp.
+	require.Equal(t, uint64(5), gc.Watermark(5))
+}
@@ -0,0 +1,140 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// versionPins are the versions read by the transactions of DB.ViewAt, which the compactions
+// keep.
+type versionPins struct {
+	sync.Mutex
+	counts map[uint64]int
+	// discarded is the highest version at and below which the compactions may have purged the
+	// versions, but the newest of each key.
+	discarded uint64
+}
+
+// bound lowers discardTs, the version at and below which the versions may be purged, to the
+// lowest version pinned.
+func (p *versionPins) bound(discardTs uint64) uint64 {
+	p.Lock()
+	defer p.Unlock()
+	for version := range p.counts {
+		discardTs = min(discardTs, version)
+	}
+	p.discarded = max(p.discarded, discardTs)
+	return discardTs
+}
+
+// pin keeps the versions read at version from being purged, until unpin. It returns
+// ErrVersionDiscarded if they may have been already.
+func (p *versionPins) pin(version uint64) error {
+	p.Lock()
+	defer p.Unlock()
+	if version < p.discarded {
+		return ErrVersionDiscarded
+	}
+	if p.counts == nil {
+		p.counts = make(map[uint64]int)
+	}
+	p.counts[version]++
+	return nil
+}
+
+func (p *versionPins) unpin(version uint64) {
+	p.Lock()
+	defer p.Unlock()
+	if p.counts[version]--; p.counts[version] == 0 {
+		delete(p.counts, version)
+	}
+}
+
+// ViewAt is like View, but the transaction reads the DB as of version: it sees the versions
+// committed at or before it, and none after. The versions it reads aren't purged by the
+// compactions until fn returns, so that the state of the DB at past versions can be queried.
+//
+// The versions the DB keeps are those of the transactions running, or kept by
+// NumVersionsToKeep and Options.VersionGC. ViewAt returns ErrVersionDiscarded if the versions
+// at version may have been purged, as when it's below the read timestamp of the oldest
+// transaction the compactions ran for, or the watermark of VersionGC once the DB is reopened.
+// In managed mode, the versions below the timestamp of SetDiscardTs may be purged too, which is
+// only known to ViewAt once a compaction ran with it. Otherwise, ViewAt returns
+// ErrFutureVersion if version isn't committed yet.
+func (db *DB) ViewAt(version uint64, fn func(txn *Txn) error) error {
+	if db.IsClosed() {
+		return ErrDBClosed
+	}
+	if !db.opt.managedTxns {
+		db.orc.Lock()
+		last := db.orc.nextTxnTs - 1
+		db.orc.Unlock()
+		if db.opt.asOf != 0 {
+			last = min(last, db.opt.asOf)
+		}
+		if version > last {
+			return ErrFutureVersion
+		}
+		// Like a new transaction, wait for the commits up to version to be visible.
+		if err := db.orc.txnMark.WaitForMark(context.Background(), version); err != nil {
+			return err
+		}
+	}
+	if err := db.pins.pin(version); err != nil {
+		return err
+	}
+	defer db.pins.unpin(version)
+
+	txn := db.newTransaction(false, true)
+	txn.readTs = version
+	// The pin keeps the versions at readTs.
+	txn.doneRead = true
+	defer txn.Discard()
+
+	return fn(txn)
+}
+
+// OpenAt opens the DB in opt.Dir read-only, like Open with Options.ReadOnly, as of version: its
+// transactions see the versions committed at or before it, and none after, so that the DB can be
+// queried as it was then without restoring a backup. It can be opened while another process
+// writes to the DB, and reads the tables of Options.ColdStorageDir and Options.RemoteTableStore
+// like Open.
+//
+// The DB only has the past versions kept, as for ViewAt: OpenAt returns ErrVersionDiscarded if
+// the versions at version may have been purged, according to the watermark of
+// Options.VersionGC, or ErrFutureVersion if version isn't committed yet. The version must be
+// above zero. OpenAt doesn't support managed mode, in which NewTransactionAt reads at any
+// version already.
+func OpenAt(opt Options, version uint64) (*DB, error) {
+	if opt.managedTxns {
+		return nil, ErrManagedTxn
+	}
+	if version == 0 {
+		return nil, errors.New("OpenAt needs a version above zero")
+	}
+	opt.ReadOnly = true
+	opt.asOf = version
+	db, err := Open(opt)
+	if err != nil {
+		return nil, err
+	}
+	db.orc.Lock()
+	last := db.orc.nextTxnTs - 1
+	db.orc.Unlock()
+	// No compaction runs in read-only mode, so the pin only checks the version.
+	err = db.pins.pin(version)
+	if err == nil && version > last {
+		err = ErrFutureVersion
+	}
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,121 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestViewAt(t *testing.T) {
+	dir := t.TempDir()
+	opt := getTestOptions(dir).WithVersionGC(VersionGCByAge(time.Hour))
+	db, err := Open(opt)
+	require.NoError(t, err)
+
+	key := []byte("key")
+	var versions []uint64
+	write := func(db *DB, val string) {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			if val == "" {
+				return txn.Delete(key)
+			}
+			return txn.Set(key, []byte(val))
+		}))
+		versions = append(versions, db.MaxVersion())
+	}
+	write(db, "v1")
+	write(db, "v2")
+	write(db, "")
+
+	get := func(db *DB, version uint64) (string, error) {
+		var val []byte
+		err := db.ViewAt(version, func(txn *Txn) error {
+			item, err := txn.Get(key)
+			if err != nil {
+				return err
+			}
+			val, err = item.ValueCopy(nil)
+			return err
+		})
+		return string(val), err
+	}
+	check := func(db *DB) {
+		val, err := get(db, versions[0])
+		require.NoError(t, err)
+		require.Equal(t, "v1", val)
+		val, err = get(db, versions[1])
+		require.NoError(t, err)
+		require.Equal(t, "v2", val)
+		_, err = get(db, versions[2])
+		require.ErrorIs(t, err, ErrKeyNotFound)
+	}
+	check(db)
+	_, err = get(db, versions[2]+100)
+	require.ErrorIs(t, err, ErrFutureVersion)
+
+	// The versions read are pinned.
+	require.NoError(t, db.ViewAt(versions[0], func(txn *Txn) error {
+		require.LessOrEqual(t, db.versionDiscardTs(), versions[0])
+		return nil
+	}))
+
+	// The versions kept by VersionGC are read after a restart.
+	require.NoError(t, db.Close())
+	db, err = Open(opt)
+	require.NoError(t, err)
+	check(db)
+	require.NoError(t, db.Close())
+
+	// Without it, the versions before the restart may be gone.
+	db, err = Open(getTestOptions(dir))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	_, err = get(db, versions[0])
+	require.ErrorIs(t, err, ErrVersionDiscarded)
+}
+
+func TestOpenAt(t *testing.T) {
+	dir := t.TempDir()
+	opt := getTestOptions(dir).WithVersionGC(VersionGCByAge(time.Hour))
+	db, err := Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	var versions []uint64
+	for _, val := range []string{"v1", "v2", "v3"} {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			return txn.Set([]byte("key"), []byte(val))
+		}))
+		versions = append(versions, db.MaxVersion())
+	}
+
+	// The DB as of the second write, opened while the writer runs.
+	past, err := OpenAt(opt, versions[1])
+	require.NoError(t, err)
+	defer func() { require.NoError(t, past.Close()) }()
+	for _, view := range []func(func(*Txn) error) error{past.View,
+		func(fn func(*Txn) error) error { return past.ViewStale(time.Second, fn) }} {
+		require.NoError(t, view(func(txn *Txn) error {
+			item, err := txn.Get([]byte("key"))
+			require.NoError(t, err)
+			require.Equal(t, []byte("v2"), getItemValue(t, item))
+			return nil
+		}))
+	}
+	require.NoError(t, past.ViewAt(versions[0], func(txn *Txn) error {
+		item, err := txn.Get([]byte("key"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("v1"), getItemValue(t, item))
+		return nil
+	}))
+	require.ErrorIs(t, past.ViewAt(versions[2], func(*Txn) error { return nil }), ErrFutureVersion)
+
+	_, err = OpenAt(opt, versions[2]+100)
+	require.ErrorIs(t, err, ErrFutureVersion)
+}
@@ -0,0 +1,98 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/luxfi/zapdb/table"
+	"github.com/luxfi/zapdb/y"
+)
+
+// WarmDepth is how much of the tables DB.Warm loads.
+type WarmDepth int
+
+const (
+	// WarmIndex loads the indexes and bloom filters of the tables.
+	WarmIndex WarmDepth = iota
+	// WarmData loads the data blocks holding the keys as well.
+	WarmData
+)
+
+// WarmOptions are the options of DB.Warm.
+type WarmOptions struct {
+	Depth WarmDepth
+}
+
+// Warm loads the tables holding keys with any of prefixes into the caches, so that the first
+// reads of those keys, right after the DB is opened or a replica takes over, don't go to disk. If
+// prefixes is empty, every table is loaded. Data blocks are only loaded with a block cache, and
+// the loaded blocks may still be evicted by later reads.
+//
+// Warm returns once the caches are loaded, or with the error of ctx if it is done first. Call it
+// in its own goroutine to warm the caches in the background, while the DB serves reads.
+func (db *DB) Warm(ctx context.Context, prefixes [][]byte, opt WarmOptions) error {
+	if len(prefixes) == 0 {
+		prefixes = [][]byte{nil}
+	}
+	start := time.Now()
+	var numTables, numBlocks int
+	for _, prefix := range prefixes {
+		tables := db.lc.tablesWithPrefix(prefix)
+		for i, t := range tables {
+			err := ctx.Err()
+			if err == nil && db.IsClosed() {
+				err = ErrDBClosed
+			}
+			var n int
+			if err == nil {
+				n, err = t.Warm(ctx, prefix, opt.Depth >= WarmData)
+			}
+			numBlocks += n
+			if err != nil {
+				_ = decrRefs(tables[i:])
+				return err
+			}
+			numTables++
+			if err := t.DecrRef(); err != nil {
+				_ = decrRefs(tables[i+1:])
+				return err
+			}
+		}
+	}
+	if db.blockCache != nil && numBlocks > 0 {
+		db.blockCache.Wait()
+	}
+	db.opt.Infof("Warmed %d tables and %d blocks for %d prefixes in %s",
+		numTables, numBlocks, len(prefixes), time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// tablesWithPrefix returns the tables of every level which may hold keys with prefix, with a
+// reference each, from the top level down.
+func (s *levelsController) tablesWithPrefix(prefix []byte) []*table.Table {
+	var out []*table.Table
+	for _, l := range s.levels {
+		l.RLock()
+		for _, t := range l.tables {
+			if overlapsPrefix(t, prefix) {
+				t.IncrRef()
+				out = append(out, t)
+			}
+		}
+		l.RUnlock()
+	}
+	return out
+}
+
+// overlapsPrefix returns whether the key range of t overlaps the keys with prefix.
+func overlapsPrefix(t *table.Table, prefix []byte) bool {
+	smallest, biggest := y.ParseKey(t.Smallest()), y.ParseKey(t.Biggest())
+	return bytes.Compare(biggest, prefix) >= 0 &&
+		(bytes.Compare(smallest, prefix) <= 0 || bytes.HasPrefix(smallest, prefix))
+}
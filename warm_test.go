@@ -0,0 +1,66 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarm(t *testing.T) {
+	dir := t.TempDir()
+	opt := getTestOptions(dir).WithBlockCacheSize(10 << 20).WithBlockSize(256)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	key := func(prefix string, i int) []byte { return []byte(fmt.Sprintf("%s%04d", prefix, i)) }
+	for _, prefix := range []string{"a", "b", "c"} {
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			for i := 0; i < 200; i++ {
+				if err := txn.Set(key(prefix, i), []byte("value")); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+	}
+	require.NoError(t, db.Close())
+
+	db, err = Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	require.NotEmpty(t, db.Tables())
+
+	// Only the index is loaded at WarmIndex depth.
+	require.NoError(t, db.Warm(context.Background(), nil, WarmOptions{}))
+	require.Zero(t, db.BlockCacheMetrics().KeysAdded())
+
+	require.NoError(t, db.Warm(context.Background(), [][]byte{[]byte("b")},
+		WarmOptions{Depth: WarmData}))
+	added := db.BlockCacheMetrics().KeysAdded()
+	require.NotZero(t, added)
+
+	// The keys with the prefix are read from the block cache, the others aren't.
+	get := func(k []byte) {
+		require.NoError(t, db.View(func(txn *Txn) error {
+			_, err := txn.Get(k)
+			return err
+		}))
+	}
+	misses := db.BlockCacheMetrics().Misses()
+	for i := 0; i < 200; i++ {
+		get(key("b", i))
+	}
+	require.Equal(t, misses, db.BlockCacheMetrics().Misses())
+	get(key("c", 199))
+	require.Greater(t, db.BlockCacheMetrics().Misses(), misses)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, db.Warm(ctx, nil, WarmOptions{Depth: WarmData}), context.Canceled)
+}
@@ -0,0 +1,192 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package badger
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/luxfi/zapdb/y"
+)
+
+// Stages of the write pipeline, as named in the badger_write_pipeline_latency_us metric.
+const (
+	stageQueueWait     = "queue_wait"
+	stageValueLogWrite = "vlog_write"
+	stageSync          = "sync"
+	stageMemtableApply = "memtable_apply"
+	stageCallback      = "callback"
+)
+
+// StageStats summarizes the latency of one stage of the write pipeline.
+type StageStats struct {
+	// Count is the number of times the stage ran.
+	Count int64
+	Total time.Duration
+	Max   time.Duration
+}
+
+// Mean returns the mean latency of the stage.
+func (s StageStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// WritePipelineStats breaks down the latency of commits into the stages of the write pipeline,
+// to tell whether slow writes are caused by queueing, syncing or memtable stalls.
+type WritePipelineStats struct {
+	// QueueDepth is the number of write requests waiting to be picked up by the writer.
+	QueueDepth int
+	// AsyncWrites is the number of writes of DB.ApplyAsync in flight.
+	AsyncWrites int
+
+	// QueueWait is the time a request waits before the writer starts writing it. It includes
+	// waiting for earlier batches and for room in the memtable.
+	QueueWait StageStats
+	// ValueLogWrite is the time taken to append a batch to the value log, excluding sync.
+	ValueLogWrite StageStats
+	// Sync is the time taken to sync the value log and WAL, when SyncWrites is set.
+	Sync StageStats
+	// MemtableApply is the time taken to apply a request to the memtable, excluding sync.
+	MemtableApply StageStats
+	// Callback is the time taken by the callbacks passed to Txn.CommitWith.
+	Callback StageStats
+
+	// Syncs is the number of syncs of the value log and WAL, by the writes and in the background.
+	Syncs int64
+	// Batches sums up the batches of write requests, which share a sync when writes are synced.
+	Batches BatchStats
+}
+
+// BatchStats sums up the batches of write requests written by the write pipeline.
+type BatchStats struct {
+	// Count is the number of batches written.
+	Count int64
+	// Requests and Entries are the numbers of requests and entries of all the batches.
+	Requests, Entries int64
+	// MaxRequests is the number of requests of the biggest batch.
+	MaxRequests int64
+}
+
+// MeanRequests returns the mean number of requests of the batches.
+func (s BatchStats) MeanRequests() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.Requests) / float64(s.Count)
+}
+
+type stageTimer struct {
+	name  string
+	count atomic.Int64
+	total atomic.Int64
+	max   atomic.Int64
+}
+
+func (s *stageTimer) observe(metrics *y.MetricsSet, d time.Duration) {
+	s.count.Add(1)
+	s.total.Add(int64(d))
+	for {
+		cur := s.max.Load()
+		if int64(d) <= cur || s.max.CompareAndSwap(cur, int64(d)) {
+			break
+		}
+	}
+	metrics.WritePipelineLatencyAdd(s.name, d.Microseconds())
+}
+
+func (s *stageTimer) stats() StageStats {
+	return StageStats{
+		Count: s.count.Load(),
+		Total: time.Duration(s.total.Load()),
+		Max:   time.Duration(s.max.Load()),
+	}
+}
+
+type writePipeline struct {
+	queueWait     stageTimer
+	valueLogWrite stageTimer
+	sync          stageTimer
+	memtableApply stageTimer
+	callback      stageTimer
+
+	syncs         atomic.Int64
+	batches       atomic.Int64
+	batchRequests atomic.Int64
+	batchEntries  atomic.Int64
+	maxBatch      atomic.Int64
+}
+
+// countSync counts a sync of the value log or WAL.
+func (p *writePipeline) countSync(metrics *y.MetricsSet) {
+	p.syncs.Add(1)
+	metrics.NumSyncsLogsAdd(1)
+}
+
+// observeBatch counts a batch of write requests.
+func (p *writePipeline) observeBatch(metrics *y.MetricsSet, reqs []*request) {
+	var entries int64
+	for _, r := range reqs {
+		entries += int64(len(r.Entries))
+	}
+	n := int64(len(reqs))
+	p.batches.Add(1)
+	p.batchRequests.Add(n)
+	p.batchEntries.Add(entries)
+	for {
+		cur := p.maxBatch.Load()
+		if n <= cur || p.maxBatch.CompareAndSwap(cur, n) {
+			break
+		}
+	}
+	metrics.NumWriteBatchesAdd(1)
+	metrics.NumWriteBatchRequestsAdd(n)
+}
+
+func newWritePipeline() *writePipeline {
+	p := &writePipeline{}
+	p.queueWait.name = stageQueueWait
+	p.valueLogWrite.name = stageValueLogWrite
+	p.sync.name = stageSync
+	p.memtableApply.name = stageMemtableApply
+	p.callback.name = stageCallback
+	return p
+}
+
+// WritePipelineStats returns the latency breakdown of the write pipeline since the DB was
+// opened. The same latencies, in microseconds, are exported cumulatively in the
+// badger_write_pipeline_latency_us metric when MetricsEnabled is set, both for all DBs and
+// for this DB under badger_db.
+func (db *DB) WritePipelineStats() WritePipelineStats {
+	p := db.pipeline
+	return WritePipelineStats{
+		QueueDepth:    len(db.writeCh),
+		AsyncWrites:   len(db.asyncWrites),
+		QueueWait:     p.queueWait.stats(),
+		ValueLogWrite: p.valueLogWrite.stats(),
+		Sync:          p.sync.stats(),
+		MemtableApply: p.memtableApply.stats(),
+		Callback:      p.callback.stats(),
+		Syncs:         p.syncs.Load(),
+		Batches: BatchStats{
+			Count:       p.batches.Load(),
+			Requests:    p.batchRequests.Load(),
+			Entries:     p.batchEntries.Load(),
+			MaxRequests: p.maxBatch.Load(),
+		},
+	}
+}
+
+// timeCallback wraps a Txn.CommitWith callback to measure it.
+func (db *DB) timeCallback(cb func(error)) func(error) {
+	return func(err error) {
+		start := time.Now()
+		cb(err)
+		db.pipeline.callback.observe(db.metrics, time.Since(start))
+	}
+}
@@ -10,44 +10,138 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	stderrors "errors"
 	"io"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/luxfi/zapdb/pb"
 )
 
-// XORBlock encrypts the given data with AES and XOR's with IV.
+// xNonce returns the nonce of XChaCha20 for iv: iv, of AES block size, padded with zeros, so that
+// distinct IVs keep distinct nonces.
+func xNonce(iv []byte) []byte {
+	nonce := make([]byte, chacha20.NonceSizeX)
+	copy(nonce, iv)
+	return nonce
+}
+
+// newStream returns the keystream of algo for key and iv. AES runs in CTR mode, and ChaCha20 as
+// XChaCha20, which needs a key of 32 bytes.
+func newStream(algo pb.EncryptionAlgo, key, iv []byte) (cipher.Stream, error) {
+	if algo == pb.EncryptionAlgo_chacha20poly1305 {
+		return chacha20.NewUnauthenticatedCipher(key, xNonce(iv))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewCTR(block, iv), nil
+}
+
+// XORBlock encrypts the given data with algo and XOR's with IV.
 // Can be used for both encryption and decryption. IV is of
 // AES block size.
-func XORBlock(dst, src, key, iv []byte) error {
-	block, err := aes.NewCipher(key)
+func XORBlock(algo pb.EncryptionAlgo, dst, src, key, iv []byte) error {
+	stream, err := newStream(algo, key, iv)
 	if err != nil {
 		return err
 	}
-	stream := cipher.NewCTR(block, iv)
 	stream.XORKeyStream(dst, src)
 	return nil
 }
 
-func XORBlockAllocate(src, key, iv []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
+func XORBlockAllocate(algo pb.EncryptionAlgo, src, key, iv []byte) ([]byte, error) {
+	stream, err := newStream(algo, key, iv)
 	if err != nil {
 		return nil, err
 	}
-	stream := cipher.NewCTR(block, iv)
 	dst := make([]byte, len(src))
 	stream.XORKeyStream(dst, src)
 	return dst, nil
 }
 
-func XORBlockStream(w io.Writer, src, key, iv []byte) error {
-	block, err := aes.NewCipher(key)
+func XORBlockStream(algo pb.EncryptionAlgo, w io.Writer, src, key, iv []byte) error {
+	stream, err := newStream(algo, key, iv)
 	if err != nil {
 		return err
 	}
-	stream := cipher.NewCTR(block, iv)
 	sw := cipher.StreamWriter{S: stream, W: w}
 	_, err = io.Copy(sw, bytes.NewReader(src))
 	return Wrapf(err, "XORBlockStream")
 }
 
+// gcmTagSize is the size of the tag AES-GCM appends to the data it encrypts.
+const gcmTagSize = 16
+
+// ErrAuthenticationFailed is returned by OpenBlock for data which was tampered with, or
+// corrupted, after SealBlock encrypted it.
+var ErrAuthenticationFailed = stderrors.New("authentication of encrypted data failed")
+
+// newAEAD returns the AEAD of algo for key, with the nonce it takes for iv, or nil if algo doesn't
+// authenticate the data.
+func newAEAD(algo pb.EncryptionAlgo, key, iv []byte) (cipher.AEAD, []byte, error) {
+	switch algo {
+	case pb.EncryptionAlgo_chacha20poly1305:
+		aead, err := chacha20poly1305.NewX(key)
+		return aead, xNonce(iv), err
+	case pb.EncryptionAlgo_aes_gcm:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		aead, err := cipher.NewGCMWithNonceSize(block, len(iv))
+		return aead, iv, err
+	}
+	return nil, nil, nil
+}
+
+// SealOverhead returns the number of bytes SealBlock adds to the data it encrypts with algo.
+func SealOverhead(algo pb.EncryptionAlgo) int {
+	switch algo {
+	case pb.EncryptionAlgo_chacha20poly1305:
+		return chacha20poly1305.Overhead
+	case pb.EncryptionAlgo_aes_gcm:
+		return gcmTagSize
+	}
+	return 0
+}
+
+// SealBlock encrypts src into dst, of len(src) + SealOverhead(algo) bytes. ChaCha20-Poly1305 and
+// AES-GCM authenticate the data too, with ad, which isn't encrypted, so that OpenBlock fails on
+// data which was tampered with, while AES is the same as XORBlock. dst may start at src, to
+// encrypt in place.
+func SealBlock(algo pb.EncryptionAlgo, dst, src, key, iv, ad []byte) error {
+	aead, nonce, err := newAEAD(algo, key, iv)
+	if err != nil {
+		return err
+	}
+	if aead == nil {
+		return XORBlock(algo, dst, src, key, iv)
+	}
+	AssertTrue(len(dst) == len(src)+aead.Overhead())
+	aead.Seal(dst[:0], nonce, src, ad)
+	return nil
+}
+
+// OpenBlock decrypts src, as encrypted by SealBlock, into dst, of len(src) - SealOverhead(algo)
+// bytes. It returns ErrAuthenticationFailed if src, or ad, isn't what SealBlock was given.
+func OpenBlock(algo pb.EncryptionAlgo, dst, src, key, iv, ad []byte) error {
+	aead, nonce, err := newAEAD(algo, key, iv)
+	if err != nil {
+		return err
+	}
+	if aead == nil {
+		return XORBlock(algo, dst, src, key, iv)
+	}
+	AssertTrue(len(dst)+aead.Overhead() == len(src))
+	if _, err := aead.Open(dst[:0], nonce, src, ad); err != nil {
+		return ErrAuthenticationFailed
+	}
+	return nil
+}
+
 // GenerateIV generates IV.
 func GenerateIV() ([]byte, error) {
 	iv := make([]byte, aes.BlockSize)
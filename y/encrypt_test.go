@@ -8,12 +8,24 @@ package y
 import (
 	"crypto/aes"
 	"crypto/rand"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/zapdb/pb"
 )
 
+var encryptionAlgos = []pb.EncryptionAlgo{
+	pb.EncryptionAlgo_aes, pb.EncryptionAlgo_chacha20poly1305, pb.EncryptionAlgo_aes_gcm}
+
 func TestXORBlock(t *testing.T) {
+	for _, algo := range encryptionAlgos {
+		t.Run(fmt.Sprintf("algo=%d", algo), func(t *testing.T) { testXORBlock(t, algo) })
+	}
+}
+
+func testXORBlock(t *testing.T, algo pb.EncryptionAlgo) {
 	key := make([]byte, 32)
 	_, _ = rand.Read(key)
 
@@ -30,11 +42,11 @@ func TestXORBlock(t *testing.T) {
 	_, _ = rand.Read(src)
 
 	dst := make([]byte, 1024)
-	err := XORBlock(dst, src, key, iv)
+	err := XORBlock(algo, dst, src, key, iv)
 	require.NoError(t, err)
 
 	act := make([]byte, 1024)
-	err = XORBlock(act, dst, key, iv)
+	err = XORBlock(algo, act, dst, key, iv)
 	require.NoError(t, err)
 	require.Equal(t, src, act)
 
@@ -43,11 +55,42 @@ func TestXORBlock(t *testing.T) {
 	// reading data right off mmap. We should not modify that data, so we have to use a different
 	// slice for dst anyway.
 	cp := append([]byte{}, src...)
-	err = XORBlock(cp, cp, key, iv)
+	err = XORBlock(algo, cp, cp, key, iv)
 	require.NoError(t, err)
 	require.Equal(t, dst, cp)
 
-	err = XORBlock(cp, cp, key, iv)
+	err = XORBlock(algo, cp, cp, key, iv)
 	require.NoError(t, err)
 	require.Equal(t, src, cp)
 }
+
+func TestSealBlock(t *testing.T) {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	iv, err := GenerateIV()
+	require.NoError(t, err)
+	src := make([]byte, 1024)
+	_, _ = rand.Read(src)
+
+	for _, algo := range encryptionAlgos {
+		sealed := make([]byte, len(src)+SealOverhead(algo))
+		require.NoError(t, SealBlock(algo, sealed, src, key, iv, []byte("ad")))
+		opened := make([]byte, len(src))
+		require.NoError(t, OpenBlock(algo, opened, sealed, key, iv, []byte("ad")))
+		require.Equal(t, src, opened)
+
+		// ChaCha20-Poly1305 and AES-GCM detect tampering, of the additional data too.
+		if SealOverhead(algo) > 0 {
+			err := OpenBlock(algo, opened, sealed, key, iv, []byte("da"))
+			require.ErrorIs(t, err, ErrAuthenticationFailed)
+		}
+		sealed[0]++
+		err := OpenBlock(algo, opened, sealed, key, iv, []byte("ad"))
+		if SealOverhead(algo) > 0 {
+			require.ErrorIs(t, err, ErrAuthenticationFailed)
+		} else {
+			require.NoError(t, err)
+			require.NotEqual(t, src, opened)
+		}
+	}
+}
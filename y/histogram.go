@@ -0,0 +1,150 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package y
+
+import (
+	"encoding/json"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds of the buckets of latency histograms.
+var DefaultLatencyBuckets = []time.Duration{
+	50 * time.Microsecond, 100 * time.Microsecond, 250 * time.Microsecond,
+	500 * time.Microsecond, time.Millisecond, 2500 * time.Microsecond,
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond,
+	500 * time.Millisecond, time.Second, 2500 * time.Millisecond,
+	5 * time.Second, 10 * time.Second,
+}
+
+// Operations with a latency histogram.
+const (
+	LatencyGet          = "get"
+	LatencyPut          = "put"
+	LatencyCommit       = "commit"
+	LatencyIteratorSeek = "iterator_seek"
+	LatencyCompaction   = "compaction"
+)
+
+var latencyOps = []string{
+	LatencyGet, LatencyPut, LatencyCommit, LatencyIteratorSeek, LatencyCompaction,
+}
+
+// Histogram counts latencies into buckets. It is safe for concurrent use, and implements
+// expvar.Var, publishing its HistogramSnapshot as JSON.
+type Histogram struct {
+	bounds []time.Duration
+	counts []atomic.Int64 // counts[i] has values <= bounds[i]; the last one has the rest.
+	count  atomic.Int64
+	sum    atomic.Int64
+	max    atomic.Int64
+}
+
+// NewHistogram returns a Histogram with buckets ending at the given upper bounds. A nil bounds
+// means DefaultLatencyBuckets.
+func NewHistogram(bounds []time.Duration) *Histogram {
+	if len(bounds) == 0 {
+		bounds = DefaultLatencyBuckets
+	}
+	bounds = append([]time.Duration{}, bounds...)
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+	return &Histogram{bounds: bounds, counts: make([]atomic.Int64, len(bounds)+1)}
+}
+
+// Observe adds d to the histogram.
+func (h *Histogram) Observe(d time.Duration) {
+	i := sort.Search(len(h.bounds), func(i int) bool { return d <= h.bounds[i] })
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+	for {
+		cur := h.max.Load()
+		if int64(d) <= cur || h.max.CompareAndSwap(cur, int64(d)) {
+			break
+		}
+	}
+}
+
+// HistogramSnapshot is the state of a Histogram at one point in time.
+type HistogramSnapshot struct {
+	// Bounds are the upper bounds of the buckets, in microseconds.
+	Bounds []int64 `json:"bounds_us"`
+	// Counts has the number of values in every bucket. It has one more element than Bounds,
+	// for values above the last bound.
+	Counts []int64 `json:"counts"`
+	Count  int64   `json:"count"`
+	SumUs  int64   `json:"sum_us"`
+	MaxUs  int64   `json:"max_us"`
+}
+
+// Snapshot returns the current state of the histogram.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	s := HistogramSnapshot{
+		Bounds: make([]int64, len(h.bounds)),
+		Counts: make([]int64, len(h.counts)),
+		Count:  h.count.Load(),
+		SumUs:  time.Duration(h.sum.Load()).Microseconds(),
+		MaxUs:  time.Duration(h.max.Load()).Microseconds(),
+	}
+	for i, b := range h.bounds {
+		s.Bounds[i] = b.Microseconds()
+	}
+	for i := range h.counts {
+		s.Counts[i] = h.counts[i].Load()
+	}
+	return s
+}
+
+// Quantile returns the upper bound of the bucket holding the q-th quantile, for q in [0, 1].
+// Values above the last bound are reported as the largest value observed.
+func (s HistogramSnapshot) Quantile(q float64) time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	rank := int64(q * float64(s.Count))
+	if rank >= s.Count {
+		rank = s.Count - 1
+	}
+	var seen int64
+	for i, c := range s.Counts {
+		seen += c
+		if seen > rank && i < len(s.Bounds) {
+			return time.Duration(s.Bounds[i]) * time.Microsecond
+		}
+	}
+	return time.Duration(s.MaxUs) * time.Microsecond
+}
+
+// Sub returns the values observed after o was taken, s and o being snapshots of the same
+// Histogram, s the later one. MaxUs is the one of s.
+func (s HistogramSnapshot) Sub(o HistogramSnapshot) HistogramSnapshot {
+	d := s
+	d.Counts = make([]int64, len(s.Counts))
+	for i := range s.Counts {
+		d.Counts[i] = s.Counts[i] - o.Counts[i]
+	}
+	d.Count -= o.Count
+	d.SumUs -= o.SumUs
+	return d
+}
+
+// String implements expvar.Var.
+func (h *Histogram) String() string {
+	b, err := json.Marshal(h.Snapshot())
+	Check(err)
+	return string(b)
+}
+
+// latencyHistograms returns a histogram for every operation in latencyOps.
+func latencyHistograms(bounds []time.Duration) map[string]*Histogram {
+	hs := make(map[string]*Histogram, len(latencyOps))
+	for _, op := range latencyOps {
+		hs[op] = NewHistogram(bounds)
+	}
+	return hs
+}
@@ -0,0 +1,49 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package y
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]time.Duration{10 * time.Millisecond, time.Millisecond})
+	for _, d := range []time.Duration{
+		500 * time.Microsecond, time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond,
+		time.Second,
+	} {
+		h.Observe(d)
+	}
+
+	s := h.Snapshot()
+	require.Equal(t, []int64{1000, 10000}, s.Bounds)
+	require.Equal(t, []int64{2, 2, 1}, s.Counts)
+	require.Equal(t, int64(5), s.Count)
+	require.Equal(t, int64(1006500), s.SumUs)
+	require.Equal(t, int64(1000000), s.MaxUs)
+
+	require.Equal(t, time.Millisecond, s.Quantile(0))
+	require.Equal(t, 10*time.Millisecond, s.Quantile(0.5))
+	require.Equal(t, time.Second, s.Quantile(0.99))
+
+	var decoded HistogramSnapshot
+	require.NoError(t, json.Unmarshal([]byte(h.String()), &decoded))
+	require.Equal(t, s, decoded)
+
+	h.Observe(5 * time.Millisecond)
+	d := h.Snapshot().Sub(s)
+	require.Equal(t, []int64{0, 1, 0}, d.Counts)
+	require.Equal(t, int64(1), d.Count)
+	require.Equal(t, int64(5000), d.SumUs)
+	require.Equal(t, 10*time.Millisecond, d.Quantile(0.99))
+
+	require.Zero(t, NewHistogram(nil).Snapshot().Quantile(0.5))
+	require.Len(t, NewHistogram(nil).Snapshot().Bounds, len(DefaultLatencyBuckets))
+}
@@ -8,6 +8,7 @@ package y
 import (
 	"expvar"
 	"sync"
+	"time"
 )
 
 const (
@@ -59,8 +60,41 @@ var (
 	numMemtableGets *expvar.Int
 	// numCompactionTables is the number of tables being compacted
 	numCompactionTables *expvar.Int
+	// numCompactionsPaused is the number of DBs whose compactions are paused by their read SLO
+	numCompactionsPaused *expvar.Int
+	// numCompactionPauses is the number of times compactions were paused by the read SLO
+	numCompactionPauses *expvar.Int
+	// numCompactionsForced is the number of compactions run while paused, because of the backlog
+	numCompactionsForced *expvar.Int
+	// numExpiredKeysLSM is the number of expired keys left in the tables the TTL reaper may compact
+	numExpiredKeysLSM *expvar.Int
+	// numCompactionsTTL is the number of compactions run by the TTL reaper
+	numCompactionsTTL *expvar.Int
+	// numGCRewritesVlog is the number of value log files rewritten by the value log GC
+	numGCRewritesVlog *expvar.Int
+	// numGCBytesReclaimedVlog is the number of bytes of value log files reclaimed by the GC
+	numGCBytesReclaimedVlog *expvar.Int
+	// numGCDiscardBytesVlog is the number of discardable bytes in the value log files, as of the
+	// last check of the value log GC scheduler
+	numGCDiscardBytesVlog *expvar.Int
+	// numSyncsLogs is the number of syncs of the value log and WAL
+	numSyncsLogs *expvar.Int
+	// numWriteBatches is the number of batches of write requests written
+	numWriteBatches *expvar.Int
+	// numWriteBatchRequests is the number of write requests written in those batches
+	numWriteBatchRequests *expvar.Int
 	// Total writes by a user in bytes
 	numBytesWrittenUser *expvar.Int
+	// writePipelineLatency has the cumulative latency of each write pipeline stage in microseconds
+	writePipelineLatency *expvar.Map
+	// numTxnConflicts is the number of transactions failed with a conflict, by key prefix
+	numTxnConflicts *expvar.Map
+	// numMemtableFlushes is the number of memtables handed to the flusher, by cause
+	numMemtableFlushes *expvar.Map
+	// latency has a histogram of the latency of every operation in latencyOps
+	latency *expvar.Map
+	// latencyHistograms are the histograms published in latency
+	latencyHists map[string]*Histogram
 
 	// metricsOnce ensures metrics are only initialized once
 	metricsOnce sync.Once
@@ -112,6 +146,26 @@ func initMetrics() {
 
 	pendingWrites = getOrCreateMap(BADGER_METRIC_PREFIX + "write_pending_num_memtable")
 	numCompactionTables = getOrCreateInt(BADGER_METRIC_PREFIX + "compaction_current_num_lsm")
+	numCompactionsPaused = getOrCreateInt(BADGER_METRIC_PREFIX + "compaction_paused_num_lsm")
+	numCompactionPauses = getOrCreateInt(BADGER_METRIC_PREFIX + "compaction_pause_num_lsm")
+	numCompactionsForced = getOrCreateInt(BADGER_METRIC_PREFIX + "compaction_forced_num_lsm")
+	numExpiredKeysLSM = getOrCreateInt(BADGER_METRIC_PREFIX + "expired_num_lsm")
+	numCompactionsTTL = getOrCreateInt(BADGER_METRIC_PREFIX + "compaction_ttl_num_lsm")
+	numGCRewritesVlog = getOrCreateInt(BADGER_METRIC_PREFIX + "gc_rewrite_num_vlog")
+	numGCBytesReclaimedVlog = getOrCreateInt(BADGER_METRIC_PREFIX + "gc_reclaimed_bytes_vlog")
+	numGCDiscardBytesVlog = getOrCreateInt(BADGER_METRIC_PREFIX + "gc_discard_bytes_vlog")
+	numSyncsLogs = getOrCreateInt(BADGER_METRIC_PREFIX + "sync_num_logs")
+	numWriteBatches = getOrCreateInt(BADGER_METRIC_PREFIX + "write_batch_num")
+	numWriteBatchRequests = getOrCreateInt(BADGER_METRIC_PREFIX + "write_batch_requests_num")
+	writePipelineLatency = getOrCreateMap(BADGER_METRIC_PREFIX + "write_pipeline_latency_us")
+	numTxnConflicts = getOrCreateMap(BADGER_METRIC_PREFIX + "conflict_num_txn")
+	numMemtableFlushes = getOrCreateMap(BADGER_METRIC_PREFIX + "flush_num_memtable")
+
+	latency = getOrCreateMap(BADGER_METRIC_PREFIX + "latency_us")
+	latencyHists = latencyHistograms(DefaultLatencyBuckets)
+	for op, h := range latencyHists {
+		latency.Set(op, h)
+	}
 }
 
 // These variables are global and have cumulative values for all kv stores.
@@ -192,6 +246,17 @@ func NumLSMBloomHitsAdd(enabled bool, key string, val int64) {
 	addToMap(enabled, numLSMBloomHits, key, val)
 }
 
+func WritePipelineLatencyAdd(enabled bool, stage string, val int64) {
+	addToMap(enabled, writePipelineLatency, stage, val)
+}
+
+func LatencyObserve(enabled bool, op string, d time.Duration) {
+	if !enabled {
+		return
+	}
+	latencyHists[op].Observe(d)
+}
+
 func NumLSMGetsAdd(enabled bool, key string, val int64) {
 	addToMap(enabled, numLSMGets, key, val)
 }
@@ -0,0 +1,312 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package y
+
+import (
+	"expvar"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// perDB has a map of metrics for every open MetricsSet, keyed by its label.
+	perDB     *expvar.Map
+	perDBOnce sync.Once
+)
+
+// Names of the metrics of a MetricsSet that hold a map, rather than a single value.
+var metricsSetMaps = []string{
+	"get_num_lsm",
+	"hit_num_lsm_bloom_filter",
+	"write_bytes_compaction",
+	"size_bytes_lsm",
+	"size_bytes_vlog",
+	"write_pending_num_memtable",
+	"write_pipeline_latency_us",
+	"conflict_num_txn",
+	"flush_num_memtable",
+	"latency_us",
+}
+
+// MetricsSet holds the metrics of a single DB. It is published under badger_db, keyed by its
+// label, and has the same helpers as the process-wide metrics, which keep adding up the values
+// of all DBs. A nil MetricsSet records nothing.
+type MetricsSet struct {
+	label   string
+	vars    *expvar.Map
+	maps    map[string]*expvar.Map
+	latency map[string]*Histogram
+}
+
+// NewMetricsSet returns a MetricsSet published under label, replacing any set published under
+// the same label. Its latency histograms use buckets ending at latencyBuckets, or
+// DefaultLatencyBuckets if nil. It returns nil if enabled is false.
+func NewMetricsSet(label string, enabled bool, latencyBuckets []time.Duration) *MetricsSet {
+	if !enabled {
+		return nil
+	}
+	perDBOnce.Do(func() {
+		perDB = getOrCreateMap(BADGER_METRIC_PREFIX + "db")
+	})
+	m := &MetricsSet{
+		label:   label,
+		vars:    new(expvar.Map).Init(),
+		maps:    make(map[string]*expvar.Map, len(metricsSetMaps)),
+		latency: latencyHistograms(latencyBuckets),
+	}
+	for _, name := range metricsSetMaps {
+		sub := new(expvar.Map).Init()
+		m.maps[name] = sub
+		m.vars.Set(name, sub)
+	}
+	for op, h := range m.latency {
+		m.maps["latency_us"].Set(op, h)
+	}
+	perDB.Set(label, m.vars)
+	return m
+}
+
+// Label returns the label the MetricsSet is published under.
+func (m *MetricsSet) Label() string {
+	if m == nil {
+		return ""
+	}
+	return m.label
+}
+
+// Vars returns the metrics of the set.
+func (m *MetricsSet) Vars() *expvar.Map {
+	if m == nil {
+		return nil
+	}
+	return m.vars
+}
+
+// Unpublish removes the MetricsSet from badger_db, once its DB is closed.
+func (m *MetricsSet) Unpublish() {
+	if m == nil {
+		return
+	}
+	if perDB.Get(m.label) == m.vars {
+		perDB.Delete(m.label)
+	}
+}
+
+// Gauge is a metric read from a function when it's published, for the values which change
+// without any event to record them, like the age of the oldest pending data.
+type Gauge func() int64
+
+// Value returns the current value of the gauge.
+func (g Gauge) Value() int64 {
+	return g()
+}
+
+// String returns the value of the gauge in JSON, to implement expvar.Var.
+func (g Gauge) String() string {
+	return strconv.FormatInt(g(), 10)
+}
+
+// GaugeSet publishes g under name in the set. Gauges aren't added up across DBs, so they have no
+// process-wide metric.
+func (m *MetricsSet) GaugeSet(name string, g Gauge) {
+	if m == nil {
+		return
+	}
+	m.vars.Set(name, g)
+}
+
+func (m *MetricsSet) addInt(global *expvar.Int, name string, val int64) {
+	if m == nil {
+		return
+	}
+	global.Add(val)
+	m.vars.Add(name, val)
+}
+
+func (m *MetricsSet) addToMap(global *expvar.Map, name, key string, val int64) {
+	if m == nil {
+		return
+	}
+	global.Add(key, val)
+	m.maps[name].Add(key, val)
+}
+
+func (m *MetricsSet) storeToMap(global *expvar.Map, name, key string, val expvar.Var) {
+	if m == nil {
+		return
+	}
+	global.Set(key, val)
+	m.maps[name].Set(key, val)
+}
+
+func (m *MetricsSet) getFromMap(name, key string) expvar.Var {
+	if m == nil {
+		return nil
+	}
+	return m.maps[name].Get(key)
+}
+
+func (m *MetricsSet) NumIteratorsCreatedAdd(val int64) {
+	m.addInt(numIteratorsCreated, "iterator_num_user", val)
+}
+
+func (m *MetricsSet) NumGetsWithResultsAdd(val int64) {
+	m.addInt(numGetsWithResults, "get_with_result_num_user", val)
+}
+
+func (m *MetricsSet) NumReadsVlogAdd(val int64) {
+	m.addInt(numReadsVlog, "read_num_vlog", val)
+}
+
+func (m *MetricsSet) NumBytesWrittenUserAdd(val int64) {
+	m.addInt(numBytesWrittenUser, "write_bytes_user", val)
+}
+
+func (m *MetricsSet) NumWritesVlogAdd(val int64) {
+	m.addInt(numWritesVlog, "write_num_vlog", val)
+}
+
+func (m *MetricsSet) NumBytesReadsVlogAdd(val int64) {
+	m.addInt(numBytesReadVlog, "read_bytes_vlog", val)
+}
+
+func (m *MetricsSet) NumBytesReadsLSMAdd(val int64) {
+	m.addInt(numBytesReadLSM, "read_bytes_lsm", val)
+}
+
+func (m *MetricsSet) NumBytesWrittenVlogAdd(val int64) {
+	m.addInt(numBytesVlogWritten, "write_bytes_vlog", val)
+}
+
+func (m *MetricsSet) NumBytesWrittenToL0Add(val int64) {
+	m.addInt(numBytesWrittenToL0, "write_bytes_l0", val)
+}
+
+func (m *MetricsSet) NumBytesCompactionWrittenAdd(key string, val int64) {
+	m.addToMap(numBytesCompactionWritten, "write_bytes_compaction", key, val)
+}
+
+func (m *MetricsSet) NumGetsAdd(val int64) {
+	m.addInt(numGets, "get_num_user", val)
+}
+
+func (m *MetricsSet) NumPutsAdd(val int64) {
+	m.addInt(numPuts, "put_num_user", val)
+}
+
+func (m *MetricsSet) NumMemtableGetsAdd(val int64) {
+	m.addInt(numMemtableGets, "get_num_memtable", val)
+}
+
+func (m *MetricsSet) NumCompactionTablesAdd(val int64) {
+	m.addInt(numCompactionTables, "compaction_current_num_lsm", val)
+}
+
+func (m *MetricsSet) NumCompactionsPausedAdd(val int64) {
+	m.addInt(numCompactionsPaused, "compaction_paused_num_lsm", val)
+}
+
+func (m *MetricsSet) NumCompactionPausesAdd(val int64) {
+	m.addInt(numCompactionPauses, "compaction_pause_num_lsm", val)
+}
+
+func (m *MetricsSet) NumCompactionsForcedAdd(val int64) {
+	m.addInt(numCompactionsForced, "compaction_forced_num_lsm", val)
+}
+
+func (m *MetricsSet) NumExpiredKeysLSMAdd(val int64) {
+	m.addInt(numExpiredKeysLSM, "expired_num_lsm", val)
+}
+
+func (m *MetricsSet) NumCompactionsTTLAdd(val int64) {
+	m.addInt(numCompactionsTTL, "compaction_ttl_num_lsm", val)
+}
+
+func (m *MetricsSet) NumGCRewritesVlogAdd(val int64) {
+	m.addInt(numGCRewritesVlog, "gc_rewrite_num_vlog", val)
+}
+
+func (m *MetricsSet) NumGCBytesReclaimedVlogAdd(val int64) {
+	m.addInt(numGCBytesReclaimedVlog, "gc_reclaimed_bytes_vlog", val)
+}
+
+func (m *MetricsSet) NumGCDiscardBytesVlogAdd(val int64) {
+	m.addInt(numGCDiscardBytesVlog, "gc_discard_bytes_vlog", val)
+}
+
+func (m *MetricsSet) NumSyncsLogsAdd(val int64) {
+	m.addInt(numSyncsLogs, "sync_num_logs", val)
+}
+
+func (m *MetricsSet) NumWriteBatchesAdd(val int64) {
+	m.addInt(numWriteBatches, "write_batch_num", val)
+}
+
+func (m *MetricsSet) NumWriteBatchRequestsAdd(val int64) {
+	m.addInt(numWriteBatchRequests, "write_batch_requests_num", val)
+}
+
+func (m *MetricsSet) LSMSizeSet(key string, val expvar.Var) {
+	m.storeToMap(lsmSize, "size_bytes_lsm", key, val)
+}
+
+func (m *MetricsSet) VlogSizeSet(key string, val expvar.Var) {
+	m.storeToMap(vlogSize, "size_bytes_vlog", key, val)
+}
+
+func (m *MetricsSet) PendingWritesSet(key string, val expvar.Var) {
+	m.storeToMap(pendingWrites, "write_pending_num_memtable", key, val)
+}
+
+func (m *MetricsSet) NumLSMBloomHitsAdd(key string, val int64) {
+	m.addToMap(numLSMBloomHits, "hit_num_lsm_bloom_filter", key, val)
+}
+
+func (m *MetricsSet) WritePipelineLatencyAdd(stage string, val int64) {
+	m.addToMap(writePipelineLatency, "write_pipeline_latency_us", stage, val)
+}
+
+func (m *MetricsSet) NumTxnConflictsAdd(prefix string, val int64) {
+	m.addToMap(numTxnConflicts, "conflict_num_txn", prefix, val)
+}
+
+func (m *MetricsSet) NumMemtableFlushesAdd(cause string, val int64) {
+	m.addToMap(numMemtableFlushes, "flush_num_memtable", cause, val)
+}
+
+// LatencyObserve adds d to the latency histogram of op, one of the Latency constants.
+func (m *MetricsSet) LatencyObserve(op string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	latencyHists[op].Observe(d)
+	m.latency[op].Observe(d)
+}
+
+// LatencySnapshots returns the latency histograms of the set, keyed by operation.
+func (m *MetricsSet) LatencySnapshots() map[string]HistogramSnapshot {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]HistogramSnapshot, len(m.latency))
+	for op, h := range m.latency {
+		out[op] = h.Snapshot()
+	}
+	return out
+}
+
+func (m *MetricsSet) NumLSMGetsAdd(key string, val int64) {
+	m.addToMap(numLSMGets, "get_num_lsm", key, val)
+}
+
+func (m *MetricsSet) LSMSizeGet(key string) expvar.Var {
+	return m.getFromMap("size_bytes_lsm", key)
+}
+
+func (m *MetricsSet) VlogSizeGet(key string) expvar.Var {
+	return m.getFromMap("size_bytes_vlog", key)
+}
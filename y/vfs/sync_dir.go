@@ -0,0 +1,29 @@
+//go:build !windows && !aix
+// +build !windows,!aix
+
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package vfs
+
+import (
+	"os"
+
+	"github.com/luxfi/zapdb/y"
+)
+
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return y.Wrapf(err, "While opening directory: %s.", dir)
+	}
+
+	err = syncFile(f)
+	closeErr := f.Close()
+	if err != nil {
+		return y.Wrapf(err, "While syncing directory: %s.", dir)
+	}
+	return y.Wrapf(closeErr, "While closing directory: %s.", dir)
+}
@@ -0,0 +1,14 @@
+//go:build windows || aix
+// +build windows aix
+
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package vfs
+
+// Windows and AIX do not support fsync on a directory. Renames are still atomic, but their
+// durability on crash may be affected. See
+// https://github.com/dgraph-io/badger/issues/699#issuecomment-504133587 for more details.
+func syncDir(dir string) error { return nil }
@@ -0,0 +1,58 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package vfs contains helpers to make file system metadata changes durable.
+package vfs
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/luxfi/zapdb/y"
+)
+
+// These are variables to allow injection of failures at test time.
+var (
+	syncFile = func(f *os.File) error { return f.Sync() }
+	rename   = os.Rename
+)
+
+// SyncDir syncs the directory, so that the entries of files created, renamed or deleted in it
+// survive a crash. (See the man page for fsync, or see
+// https://github.com/coreos/etcd/issues/6368 for an example.)
+func SyncDir(dir string) error {
+	return syncDir(dir)
+}
+
+// SyncFile syncs the contents of the file at path.
+func SyncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return y.Wrapf(err, "While opening file: %s.", path)
+	}
+	err = syncFile(f)
+	closeErr := f.Close()
+	if err != nil {
+		return y.Wrapf(err, "While syncing file: %s.", path)
+	}
+	return y.Wrapf(closeErr, "While closing file: %s.", path)
+}
+
+// AtomicReplace replaces the file at path with the file at tmpPath, which must be completely
+// written and closed. The contents of tmpPath are synced before the rename, and the parent
+// directory after it. After a crash at any point, path holds either the old or the new contents,
+// and once AtomicReplace returns the new contents are durable.
+//
+// tmpPath must be in the same directory as path, since rename is only atomic within a file
+// system.
+func AtomicReplace(tmpPath, path string) error {
+	if err := SyncFile(tmpPath); err != nil {
+		return err
+	}
+	if err := rename(tmpPath, path); err != nil {
+		return y.Wrapf(err, "While renaming %s to %s.", tmpPath, path)
+	}
+	return SyncDir(filepath.Dir(path))
+}
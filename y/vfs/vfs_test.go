@@ -0,0 +1,91 @@
+/*
+ * SPDX-FileCopyrightText: © 2017-2025 Istari Digital, Inc.
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package vfs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "MANIFEST")
+	tmpPath := filepath.Join(dir, "MANIFEST-REWRITE")
+	require.NoError(t, os.WriteFile(path, []byte("old"), 0600))
+	require.NoError(t, os.WriteFile(tmpPath, []byte("new"), 0600))
+	return path, tmpPath
+}
+
+func requireContents(t *testing.T, path, want string) {
+	got, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, want, string(got))
+}
+
+func TestAtomicReplace(t *testing.T) {
+	var synced []string
+	defer func(old func(*os.File) error) { syncFile = old }(syncFile)
+	syncFile = func(f *os.File) error {
+		synced = append(synced, f.Name())
+		return f.Sync()
+	}
+
+	path, tmpPath := writeFiles(t)
+	require.NoError(t, AtomicReplace(tmpPath, path))
+	requireContents(t, path, "new")
+	_, err := os.Stat(tmpPath)
+	require.True(t, os.IsNotExist(err))
+
+	// The file must be synced before the rename, and the directory after it.
+	require.Equal(t, []string{tmpPath, filepath.Dir(path)}, synced)
+}
+
+// TestAtomicReplaceCrash injects a failure at every step of AtomicReplace, and checks that path
+// holds either the old or the new contents.
+func TestAtomicReplaceCrash(t *testing.T) {
+	errCrash := errors.New("crash")
+
+	t.Run("file sync", func(t *testing.T) {
+		defer func(old func(*os.File) error) { syncFile = old }(syncFile)
+		syncFile = func(*os.File) error { return errCrash }
+
+		path, tmpPath := writeFiles(t)
+		require.ErrorContains(t, AtomicReplace(tmpPath, path), errCrash.Error())
+		requireContents(t, path, "old")
+	})
+	t.Run("rename", func(t *testing.T) {
+		defer func(old func(string, string) error) { rename = old }(rename)
+		rename = func(string, string) error { return errCrash }
+
+		path, tmpPath := writeFiles(t)
+		require.ErrorContains(t, AtomicReplace(tmpPath, path), errCrash.Error())
+		requireContents(t, path, "old")
+		requireContents(t, tmpPath, "new")
+	})
+	t.Run("dir sync", func(t *testing.T) {
+		defer func(old func(*os.File) error) { syncFile = old }(syncFile)
+		path, tmpPath := writeFiles(t)
+		syncFile = func(f *os.File) error {
+			if f.Name() == filepath.Dir(path) {
+				return errCrash
+			}
+			return f.Sync()
+		}
+
+		require.ErrorContains(t, AtomicReplace(tmpPath, path), errCrash.Error())
+		requireContents(t, path, "new")
+	})
+	t.Run("missing tmp file", func(t *testing.T) {
+		path, tmpPath := writeFiles(t)
+		require.NoError(t, os.Remove(tmpPath))
+		require.Error(t, AtomicReplace(tmpPath, path))
+		requireContents(t, path, "old")
+	})
+}
@@ -93,6 +93,24 @@ func OpenTruncFile(filename string, sync bool) (*os.File, error) {
 	return os.OpenFile(filename, flags, 0600)
 }
 
+// DeleteMmapFile unmaps, closes and removes the file of m. Unlike m.Delete, it doesn't truncate
+// the file first: the processes mapping it, like read-only DBs, read it until they unmap it, and
+// its space is freed then.
+func DeleteMmapFile(m *z.MmapFile) error {
+	// Badger can set m.Data without a file, in which case there is nothing to delete.
+	if m.Fd == nil {
+		return nil
+	}
+	if err := z.Munmap(m.Data); err != nil {
+		return Wrapf(err, "while munmap file: %s", m.Fd.Name())
+	}
+	m.Data = nil
+	if err := m.Fd.Close(); err != nil {
+		return Wrapf(err, "while close file: %s", m.Fd.Name())
+	}
+	return os.Remove(m.Fd.Name())
+}
+
 // SafeCopy does append(a[:0], src...).
 func SafeCopy(a, src []byte) []byte {
 	b := append(a[:0], src...)
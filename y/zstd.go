@@ -8,6 +8,7 @@ package y
 import (
 	"sync"
 
+	"github.com/klauspost/compress/dict"
 	"github.com/klauspost/compress/zstd"
 )
 
@@ -39,6 +40,67 @@ func ZSTDCompress(dst, src []byte, compressionLevel int) ([]byte, error) {
 	return encoder.EncodeAll(src, dst[:0]), nil
 }
 
+// ZSTDDecoder decompresses the blocks compressed with any of its dictionaries, or without one.
+type ZSTDDecoder struct {
+	decoder *zstd.Decoder
+}
+
+// NewZSTDDecoder returns a decoder of the blocks compressed with dicts, or without a dictionary.
+func NewZSTDDecoder(dicts ...[]byte) (*ZSTDDecoder, error) {
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderDicts(dicts...))
+	if err != nil {
+		return nil, err
+	}
+	return &ZSTDDecoder{decoder: decoder}, nil
+}
+
+// Decompress decompresses a block using ZSTD algorithm.
+func (d *ZSTDDecoder) Decompress(dst, src []byte) ([]byte, error) {
+	return d.decoder.DecodeAll(src, dst[:0])
+}
+
+// ZSTDDictionary compresses blocks using ZSTD algorithm with a dictionary.
+type ZSTDDictionary struct {
+	id      uint32
+	encoder *zstd.Encoder
+}
+
+// NewZSTDDictionary returns a ZSTDDictionary compressing blocks with dict.
+func NewZSTDDictionary(dict []byte, compressionLevel int) (*ZSTDDictionary, error) {
+	info, err := zstd.InspectDictionary(dict)
+	if err != nil {
+		return nil, err
+	}
+	level := zstd.EncoderLevelFromZstd(compressionLevel)
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(level), zstd.WithEncoderDict(dict))
+	if err != nil {
+		return nil, err
+	}
+	return &ZSTDDictionary{id: info.ID(), encoder: encoder}, nil
+}
+
+// ID returns the ID of the dictionary.
+func (d *ZSTDDictionary) ID() uint32 {
+	return d.id
+}
+
+// Compress compresses a block using ZSTD algorithm with the dictionary.
+func (d *ZSTDDictionary) Compress(dst, src []byte) ([]byte, error) {
+	return d.encoder.EncodeAll(src, dst[:0]), nil
+}
+
+// TrainZSTDDictionary trains a ZSTD dictionary of ID id, and of at most maxSize bytes, on
+// samples of the data it is to compress.
+func TrainZSTDDictionary(samples [][]byte, id uint32, maxSize, compressionLevel int) (
+	[]byte, error) {
+	return dict.BuildZstdDict(samples, dict.Options{
+		MaxDictSize: maxSize,
+		HashBytes:   6,
+		ZstdDictID:  id,
+		ZstdLevel:   zstd.EncoderLevelFromZstd(compressionLevel),
+	})
+}
+
 // ZSTDCompressBound returns the worst case size needed for a destination buffer.
 // Klauspost ZSTD library does not provide any API for Compression Bound. This
 // calculation is based on the DataDog ZSTD library.